@@ -0,0 +1,216 @@
+package go_playground
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// AdaptiveConcurrency adjusts how many tasks run at once to what the
+// downstream the handler calls copes with, by additive increase and
+// multiplicative decrease. Each Interval the attempts that ended are
+// looked at: past MaxErrorRate failing, or TargetLatency on average, the
+// limit is multiplied by Decrease; otherwise it grows by one while the
+// tasks used all of it. Workers above the limit wait before starting an
+// attempt, with their task
+type AdaptiveConcurrency struct {
+	Min int // lowest limit, 1 by default
+	Max int // highest limit, the workers of the pool when zero
+
+	Interval      time.Duration // how often the limit is adjusted, 1s by default
+	MaxErrorRate  float64       // failed fraction of attempts backed off from, 0.1 by default
+	TargetLatency time.Duration // average attempt duration backed off from, none when zero
+	Decrease      float64       // factor applied to the limit when backing off, 0.5 by default
+	MinSamples    int           // attempts an interval needs to be judged, 10 by default
+}
+
+// DefaultAdaptiveConcurrency halves the limit on 10% of failures
+var DefaultAdaptiveConcurrency = AdaptiveConcurrency{
+	Min:          1,
+	Interval:     time.Second,
+	MaxErrorRate: 0.1,
+	Decrease:     0.5,
+	MinSamples:   10,
+}
+
+// WithAdaptiveConcurrency bounds the tasks running at once with a limit
+// following the error rate and latency of the handler, see
+// AdaptiveConcurrency
+func WithAdaptiveConcurrency(ac AdaptiveConcurrency) Option {
+	return func(p *WorkerPool) {
+		p.adaptiveConfig = &ac
+	}
+}
+
+// normalize fills zero fields from the defaults
+func (ac AdaptiveConcurrency) normalize() AdaptiveConcurrency {
+	d := DefaultAdaptiveConcurrency
+	if ac.Min < 1 {
+		ac.Min = d.Min
+	}
+	if ac.Max > 0 && ac.Max < ac.Min {
+		ac.Max = ac.Min
+	}
+	if ac.Interval <= 0 {
+		ac.Interval = d.Interval
+	}
+	if ac.MaxErrorRate <= 0 {
+		ac.MaxErrorRate = d.MaxErrorRate
+	}
+	if ac.Decrease <= 0 || ac.Decrease >= 1 {
+		ac.Decrease = d.Decrease
+	}
+	if ac.MinSamples < 1 {
+		ac.MinSamples = d.MinSamples
+	}
+	return ac
+}
+
+// aimdLimiter implements AdaptiveConcurrency. A nil limiter never holds
+// an attempt back
+type aimdLimiter struct {
+	cfg AdaptiveConcurrency
+	max func() int // the highest limit, following the workers unless Max is set
+	log *slog.Logger
+
+	mu   sync.Mutex
+	cond chan struct{} // closed and replaced whenever a slot frees or the limit changes
+
+	limit    int
+	inflight int
+
+	// Attempts of the current interval
+	samples   int
+	failures  int
+	elapsed   time.Duration
+	saturated bool // the tasks used the whole limit
+}
+
+// newAIMDLimiter starts at the highest limit, that of the initial workers
+// unless Max is set
+func newAIMDLimiter(cfg AdaptiveConcurrency, initial int, workers func() int, log *slog.Logger) *aimdLimiter {
+	cfg = cfg.normalize()
+	l := &aimdLimiter{cfg: cfg, log: log, cond: make(chan struct{})}
+	l.max = func() int {
+		if cfg.Max > 0 {
+			return cfg.Max
+		}
+		return max(workers(), cfg.Min)
+	}
+	l.limit = cfg.Max
+	if l.limit == 0 {
+		l.limit = max(initial, cfg.Min)
+	}
+	return l
+}
+
+// acquire waits for the running attempts to be under the limit and
+// counts one more, reporting false when ctx ends first
+func (l *aimdLimiter) acquire(ctx context.Context) bool {
+	if l == nil {
+		return true
+	}
+	for {
+		l.mu.Lock()
+		if l.inflight < l.limit {
+			l.inflight++
+			if l.inflight == l.limit {
+				l.saturated = true
+			}
+			l.mu.Unlock()
+			return true
+		}
+		l.saturated = true
+		cond := l.cond
+		l.mu.Unlock()
+		select {
+		case <-cond:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// release ends an attempt, counting its outcome when sample is set. Runs
+// stopped by the pool rather than failed by the downstream are not
+func (l *aimdLimiter) release(elapsed time.Duration, err error, sample bool) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	if sample {
+		l.samples++
+		l.elapsed += elapsed
+		if err != nil {
+			l.failures++
+		}
+	}
+	l.notifyLocked()
+}
+
+func (l *aimdLimiter) notifyLocked() {
+	close(l.cond)
+	l.cond = make(chan struct{})
+}
+
+// current returns the limit
+func (l *aimdLimiter) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return min(l.limit, l.max())
+}
+
+// adjust applies AIMD to the attempts of the interval just ended
+func (l *aimdLimiter) adjust() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	samples, failures, elapsed, saturated := l.samples, l.failures, l.elapsed, l.saturated
+	l.samples, l.failures, l.elapsed, l.saturated = 0, 0, 0, l.inflight >= l.limit
+
+	from, top := l.limit, l.max()
+	switch {
+	case samples < l.cfg.MinSamples:
+	case float64(failures)/float64(samples) > l.cfg.MaxErrorRate,
+		l.cfg.TargetLatency > 0 && elapsed/time.Duration(samples) > l.cfg.TargetLatency:
+		l.limit = max(int(float64(l.limit)*l.cfg.Decrease), l.cfg.Min)
+		if l.limit < from {
+			l.log.Warn("adaptive concurrency: backing off", "from", from, "to", l.limit,
+				"failures", failures, "attempts", samples, "avg_duration", elapsed/time.Duration(samples))
+		}
+	case saturated && l.limit < top:
+		l.limit++
+		l.log.Debug("adaptive concurrency: raised", "from", from, "to", l.limit)
+	}
+	// Workers may have been retired since
+	l.limit = min(l.limit, top)
+	if l.limit != from {
+		l.notifyLocked()
+	}
+}
+
+// adaptConcurrency adjusts the limit every interval until the pool shuts
+// down
+func (p *WorkerPool) adaptConcurrency() {
+	ticker := time.NewTicker(p.adaptive.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.quit:
+			return
+		case <-ticker.C:
+			p.adaptive.adjust()
+		}
+	}
+}
+
+// ConcurrencyLimit returns how many tasks may run at once: the limit of
+// WithAdaptiveConcurrency, else the workers of the pool
+func (p *WorkerPool) ConcurrencyLimit() int {
+	if p.adaptive == nil {
+		return p.Workers()
+	}
+	return p.adaptive.current()
+}
@@ -0,0 +1,190 @@
+package go_playground
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// adminStatus is the body of GET /admin
+type adminStatus struct {
+	Queue        string         `json:"queue,omitempty"`
+	Paused       bool           `json:"paused"`
+	Circuit      string         `json:"circuit"`
+	Leader       bool           `json:"leader"`
+	Workers      int            `json:"workers"`
+	TaskTypes    []string       `json:"task_types,omitempty"` // with a registered handler
+	BusyWorkers  int            `json:"busy_workers"`
+	Draining     int            `json:"draining_workers,omitempty"` // finishing their task before leaving
+	QueueDepth   int            `json:"queue_depth"`
+	InFlight     []int          `json:"in_flight"`
+	Stuck        []int          `json:"stuck,omitempty"`
+	WorkerStatus []WorkerStatus `json:"worker_status"`
+
+	Replication *ReplicationStatus `json:"replication,omitempty"` // with a backend replicating to a standby
+}
+
+// resizeRequest is the body of POST /admin/workers
+type resizeRequest struct {
+	Workers int `json:"workers"`
+}
+
+// replayResponse is the body of POST /admin/replay. Error is set when a
+// submission failed, after the tasks listed were replayed
+type replayResponse struct {
+	ReplayResult
+	Error string `json:"error,omitempty"`
+}
+
+// adminRoutes adds the pool introspection and control routes under /admin
+func (s *Server) adminRoutes(r *mux.Router) {
+	r.HandleFunc("/admin", s.adminStatusHandler).Methods("GET")
+	r.HandleFunc("/admin/pause", s.pauseHandler).Methods("POST")
+	r.HandleFunc("/admin/resume", s.resumeHandler).Methods("POST")
+	r.HandleFunc("/admin/workers", s.resizeHandler).Methods("POST")
+	r.HandleFunc("/admin/flush", s.flushHandler).Methods("POST")
+	r.HandleFunc("/admin/replay", s.replayHandler).Methods("POST")
+	r.HandleFunc("/admin/snapshot", s.snapshotHandler).Methods("GET")
+	r.HandleFunc("/admin/snapshot", s.importHandler).Methods("POST")
+	r.HandleFunc("/admin/chaos", s.getChaosHandler).Methods("GET")
+	r.HandleFunc("/admin/chaos", s.setChaosHandler).Methods("PUT")
+	r.HandleFunc("/admin/chaos", s.clearChaosHandler).Methods("DELETE")
+}
+
+func (s *Server) adminStatusHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	status := adminStatus{
+		Queue:        p.Name(),
+		Paused:       p.Paused(),
+		Circuit:      p.CircuitState().String(),
+		Leader:       p.IsLeader(),
+		Workers:      p.Workers(),
+		TaskTypes:    p.HandledTypes(),
+		BusyWorkers:  p.BusyWorkers(),
+		Draining:     p.DrainingWorkers(),
+		QueueDepth:   p.QueueDepth(),
+		InFlight:     p.InFlight(),
+		Stuck:        p.StuckTasks(),
+		WorkerStatus: p.WorkerStatuses(),
+	}
+	if rs, ok := p.Replication(); ok {
+		status.Replication = &rs
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) pauseHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	p.Pause()
+	s.audit(r, p, AuditPause, nil, nil)
+	respond(w, r, http.StatusOK, envelope{Status: "paused", Message: "Pool paused"}, "Pool paused")
+}
+
+func (s *Server) resumeHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	p.Resume()
+	s.audit(r, p, AuditResume, nil, nil)
+	respond(w, r, http.StatusOK, envelope{Status: "resumed", Message: "Pool resumed"}, "Pool resumed")
+}
+
+func (s *Server) resizeHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+
+	var req resizeRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		badRequest(w, malformedBody(err))
+		return
+	}
+	if req.Workers < 1 {
+		writeError(w, http.StatusBadRequest, "workers must be at least 1", "workers")
+		return
+	}
+
+	from := p.Workers()
+	p.Resize(req.Workers)
+	s.audit(r, p, AuditResize, map[string]any{"from": from, "workers": req.Workers}, nil)
+	msg := fmt.Sprintf("Pool resized to %d workers", req.Workers)
+	respond(w, r, http.StatusOK, envelope{Status: "resized", Message: msg, Count: count(req.Workers)}, msg)
+}
+
+func (s *Server) flushHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+
+	n, err := p.Flush()
+	switch {
+	case errors.Is(err, ErrFlushUnsupported):
+		writeError(w, http.StatusNotImplemented, err.Error(), "")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	s.audit(r, p, AuditFlush, map[string]any{"flushed": n}, nil)
+	msg := fmt.Sprintf("%d queued events flushed", n)
+	respond(w, r, http.StatusOK, envelope{Status: "flushed", Message: msg, Count: count(n)}, msg)
+}
+
+func (s *Server) replayHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+
+	var f ReplayFilter
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		badRequest(w, malformedBody(err))
+		return
+	}
+	switch {
+	case f.Source != "" && f.Source != ReplayDeadLetters && f.Source != ReplayArchive:
+		writeError(w, http.StatusBadRequest, "source must be deadletter or archive", "source")
+		return
+	case f.State != "" && !f.State.Terminal():
+		writeError(w, http.StatusBadRequest, "state must be succeeded, failed or canceled", "state")
+		return
+	case f.Limit < 0:
+		writeError(w, http.StatusBadRequest, "limit must not be negative", "limit")
+		return
+	}
+
+	res, err := p.Replay(r.Context(), f)
+	switch {
+	case errors.Is(err, ErrReplayUnsupported):
+		writeError(w, http.StatusNotImplemented, err.Error(), "")
+		return
+	case err != nil && len(res.Tasks) == 0:
+		submitError(w, p, err)
+		return
+	}
+	s.audit(r, p, AuditReplay, map[string]any{"filter": f, "replayed": len(res.Tasks)}, err)
+	resp := replayResponse{ReplayResult: res}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	if resp.Tasks == nil {
+		resp.Tasks = []ReplayedTask{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,128 @@
+package go_playground
+
+import (
+	"cmp"
+	"hash/fnv"
+	"slices"
+	"strconv"
+)
+
+// Affinity routes the tasks sharing a PartitionKey to the same worker, for
+// handlers that keep per-key caches. Keys are spread over the workers by
+// consistent hashing: when the pool is resized only the keys of the
+// workers that joined or left move, their queued tasks following them.
+// Tasks without a key go to any worker and are stolen by idle ones as with
+// WorkStealing; keyed tasks are not. A worker replaced after a panic has
+// another ID, so its keys move too
+type Affinity struct {
+	LocalQueue   int // tasks queued on one worker at most, 2 by default
+	VirtualNodes int // points of each worker on the hash ring, 64 by default
+}
+
+// defaultVirtualNodes is the number of ring points per worker unless set
+const defaultVirtualNodes = 64
+
+// hashRing maps keys to workers by consistent hashing
+type hashRing struct {
+	vnodes int
+	points []ringPoint // sorted by hash
+}
+
+type ringPoint struct {
+	hash   uint64
+	worker int
+}
+
+func newHashRing(vnodes int) *hashRing {
+	if vnodes <= 0 {
+		vnodes = defaultVirtualNodes
+	}
+	return &hashRing{vnodes: vnodes}
+}
+
+// ringHash hashes s onto the ring. FNV alone leaves short keys that differ
+// in their last bytes close together, the murmur3 finalizer spreads them
+func ringHash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// add places the points of worker id on the ring
+func (r *hashRing) add(id int) {
+	for i := range r.vnodes {
+		r.points = append(r.points, ringPoint{hash: ringHash(strconv.Itoa(id) + "#" + strconv.Itoa(i)), worker: id})
+	}
+	slices.SortFunc(r.points, func(a, b ringPoint) int {
+		return cmp.Or(cmp.Compare(a.hash, b.hash), cmp.Compare(a.worker, b.worker))
+	})
+}
+
+// remove takes the points of worker id off the ring
+func (r *hashRing) remove(id int) {
+	r.points = slices.DeleteFunc(r.points, func(p ringPoint) bool { return p.worker == id })
+}
+
+// owner returns the worker of key, the one of the first point at or after
+// its hash, reporting false on an empty ring
+func (r *hashRing) owner(key string) (int, bool) {
+	if len(r.points) == 0 {
+		return 0, false
+	}
+	h := ringHash(key)
+	i, _ := slices.BinarySearchFunc(r.points, h, func(p ringPoint, h uint64) int { return cmp.Compare(p.hash, h) })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].worker, true
+}
+
+// routed returns the worker a task is bound to, false for tasks any worker
+// may run
+func (s *stealScheduler) routed(task Task) (int, bool) {
+	if s.ring == nil || task.PartitionKey == "" {
+		return 0, false
+	}
+	return s.ring.owner(task.PartitionKey)
+}
+
+// stealable returns the index of the oldest task of l a peer may take, -1
+// when there is none. Queues left by their owner are drained whatever the
+// keys of their tasks
+func (s *stealScheduler) stealable(l *localQueue) int {
+	if len(l.tasks) > 0 && (s.ring == nil || !l.owned) {
+		return 0
+	}
+	if s.ring == nil {
+		return -1
+	}
+	return slices.IndexFunc(l.tasks, func(t Task) bool { return t.PartitionKey == "" })
+}
+
+// rebalance moves the queued keyed tasks whose key changed worker to the
+// queue of their new owner, after the other tasks it holds
+func (s *stealScheduler) rebalance() {
+	if s.ring == nil || len(s.order) == 0 {
+		return
+	}
+	for _, l := range s.locals {
+		kept := l.tasks[:0]
+		for _, t := range l.tasks {
+			w, ok := s.routed(t)
+			if dest := s.locals[w]; ok && dest != l {
+				dest.tasks = append(dest.tasks, t)
+				signal(dest.notify)
+				continue
+			}
+			kept = append(kept, t)
+		}
+		clear(l.tasks[len(kept):])
+		l.tasks = kept
+	}
+}
@@ -0,0 +1,120 @@
+package amqpsource
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	pool "playground"
+)
+
+func TestHeader(t *testing.T) {
+	headers := amqp.Table{"Idempotency-Key": []byte("k"), "x-count": int32(3), "x-flag": true, "x-table": amqp.Table{}}
+	for name, want := range map[string]string{"idempotency-key": "k", "X-Count": "3", "x-flag": "true", "x-table": "", "missing": ""} {
+		if got := header(headers, name); got != want {
+			t.Errorf("header(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSinkMessage(t *testing.T) {
+	s := NewSink(SinkOptions{})
+	at := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	out, err := s.message(nil, pool.TaskEvent{Task: pool.Task{ID: 7, Type: "mail", CorrelationID: "req-1"}, State: pool.StateFailed, Time: at})
+	if err != nil {
+		t.Fatalf("message: %v", err)
+	}
+	msg := out.msg
+	if out.key != "task.failed" || msg.MessageId != "7.failed" || msg.CorrelationId != "req-1" || msg.Type != "mail" ||
+		msg.DeliveryMode != amqp.Persistent || !msg.Timestamp.Equal(at) || msg.Headers["task-state"] != "failed" {
+		t.Errorf("message = %q %+v", out.key, msg)
+	}
+	var ev Event
+	if err := json.Unmarshal(msg.Body, &ev); err != nil || ev.Task.ID != 7 || ev.State != pool.StateFailed {
+		t.Errorf("body %s decoded as %+v, %v", msg.Body, ev, err)
+	}
+}
+
+// broker returns a channel on the broker at AMQP_URL, skipping the test
+// without one, and a queue deleted at the end of the test
+func broker(t *testing.T) (string, *amqp.Channel, string) {
+	t.Helper()
+	url := os.Getenv("AMQP_URL")
+	if url == "" {
+		t.Skip("AMQP_URL is not set")
+	}
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		t.Fatalf("dialing %s: %v", url, err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	ch, err := conn.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := ch.QueueDeclare("amqpsource-test-"+strconv.FormatInt(time.Now().UnixNano(), 36), false, true, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return url, ch, q.Name
+}
+
+func TestSourceConsumesQueue(t *testing.T) {
+	url, ch, queue := broker(t)
+	if err := ch.Publish("", queue, false, false, amqp.Publishing{Body: []byte(`{"data":"hello"}`), MessageId: "m1", Type: "mail"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tasks := make(chan pool.Task, 1)
+	src := New(Options{Connection: Connection{URL: url, Logger: slog.New(slog.DiscardHandler)}, Queue: queue})
+	go src.Run(ctx, func(_ context.Context, task pool.Task) error {
+		tasks <- task
+		return nil
+	})
+	select {
+	case task := <-tasks:
+		if task.Data != "hello" || task.Type != "mail" || task.IdempotencyKey != "amqp:m1" {
+			t.Errorf("submitted %+v", task)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no task submitted")
+	}
+}
+
+func TestSinkPublishesEvents(t *testing.T) {
+	url, ch, queue := broker(t)
+	p := pool.NewTestPool(pool.WithHandler(pool.TaskHandlerFunc(func(context.Context, pool.Task) error { return nil })))
+	defer p.Shutdown(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sink := NewSink(SinkOptions{Connection: Connection{URL: url, Logger: slog.New(slog.DiscardHandler)}, RoutingKey: queue})
+	go sink.Run(ctx, p)
+	deliveries, err := ch.Consume(queue, "", true, false, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The sink subscribes once connected
+	time.Sleep(time.Second)
+	task, err := p.Submit(pool.Task{})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	select {
+	case d := <-deliveries:
+		var ev Event
+		if err := json.Unmarshal(d.Body, &ev); err != nil || ev.Task.ID != task.ID || ev.State != pool.StateSucceeded {
+			t.Errorf("published %s, want the success of task %d", d.Body, task.ID)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no event published")
+	}
+}
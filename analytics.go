@@ -0,0 +1,307 @@
+package go_playground
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Analytics keeps a rolling sample of the tasks submitted to a pool, so
+// GET /analytics can describe their payloads, types, tenants and arrival
+// rate without exporting every task
+type Analytics struct {
+	SampleSize int           // samples kept, the oldest going first, 10000 by default
+	Rate       float64       // share of the submissions sampled, all of them when zero
+	Window     time.Duration // longest window reported, 1h by default
+}
+
+// AnalyticsQuery selects the part of the sample a report covers, zero
+// fields taking their defaults
+type AnalyticsQuery struct {
+	Window time.Duration // up to now, Analytics.Window by default and at most
+	Bucket time.Duration // width of the arrival buckets, a 30th of the window by default
+	Top    int           // types and tenants listed at most, 10 by default
+}
+
+// AnalyticsReport describes the tasks sampled over a window. Counts are of
+// samples, rates and Estimated scale them back to all the submissions
+type AnalyticsReport struct {
+	From      time.Time     `json:"from"`
+	To        time.Time     `json:"to"`
+	Bucket    time.Duration `json:"bucket"`
+	Rate      float64       `json:"rate"`      // share of the submissions sampled
+	Samples   int           `json:"samples"`   // in the window
+	Estimated int           `json:"estimated"` // submissions in the window
+	// Truncated is set when the sample filled up, From moving past the
+	// start of the window asked for
+	Truncated bool             `json:"truncated,omitempty"`
+	Payload   PayloadSizes     `json:"payload"`
+	Types     []AnalyticsShare `json:"types"`   // most sampled first
+	Tenants   []AnalyticsShare `json:"tenants"` // most sampled first
+	Arrivals  []ArrivalsBucket `json:"arrivals"`
+}
+
+// PayloadSizes is the distribution of the Data sizes of the sampled tasks,
+// in bytes. Payloads uploaded to the PayloadStore are not counted
+type PayloadSizes struct {
+	Min  int     `json:"min"`
+	Max  int     `json:"max"`
+	Mean float64 `json:"mean"`
+	P50  int     `json:"p50"`
+	P90  int     `json:"p90"`
+	P99  int     `json:"p99"`
+	// Buckets double in size, from the smallest payload to the largest
+	Buckets []SizeBucket `json:"buckets"`
+}
+
+// SizeBucket counts the payloads larger than the previous bucket and of at
+// most UpTo bytes
+type SizeBucket struct {
+	UpTo    int `json:"up_to"`
+	Samples int `json:"samples"`
+}
+
+// AnalyticsShare is the part of the sample of a task type or tenant, empty
+// for the tasks without one
+type AnalyticsShare struct {
+	Name      string  `json:"name"`
+	Samples   int     `json:"samples"`
+	Share     float64 `json:"share"`      // of the samples in the window
+	MeanBytes float64 `json:"mean_bytes"` // of their payloads
+}
+
+// ArrivalsBucket counts the submissions sampled from Start over the width
+// of the report buckets
+type ArrivalsBucket struct {
+	Start   time.Time `json:"start"`
+	Samples int       `json:"samples"`
+	Rate    float64   `json:"rate"` // estimated submissions per second
+}
+
+// maxArrivalsBuckets bounds the buckets of a report, wider ones being used
+// past it
+const maxArrivalsBuckets = 1000
+
+// analyticsSample is a submission sampled
+type analyticsSample struct {
+	at     time.Time
+	size   int
+	typ    string
+	tenant string
+}
+
+// analyticsSampler keeps the samples in a ring, oldest first from next
+type analyticsSampler struct {
+	cfg Analytics
+
+	mu      sync.Mutex
+	samples []analyticsSample
+	next    int
+}
+
+func newAnalyticsSampler(cfg Analytics) *analyticsSampler {
+	if cfg.SampleSize <= 0 {
+		cfg.SampleSize = 10000
+	}
+	if cfg.Rate <= 0 || cfg.Rate > 1 {
+		cfg.Rate = 1
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = time.Hour
+	}
+	return &analyticsSampler{cfg: cfg}
+}
+
+// sample records task, submitted at now, if it is picked
+func (a *analyticsSampler) sample(task Task, now time.Time) {
+	if a == nil || (a.cfg.Rate < 1 && rand.Float64() >= a.cfg.Rate) {
+		return
+	}
+	s := analyticsSample{at: now, size: len(task.Data), typ: task.Type, tenant: task.Tenant}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.samples) < a.cfg.SampleSize {
+		a.samples = append(a.samples, s)
+		return
+	}
+	a.samples[a.next] = s
+	a.next = (a.next + 1) % len(a.samples)
+}
+
+// since returns the samples from from on, oldest first, and whether older
+// ones in the window were overwritten
+func (a *analyticsSampler) since(from time.Time) ([]analyticsSample, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ordered := slices.Concat(a.samples[a.next:], a.samples[:a.next])
+	i, _ := slices.BinarySearchFunc(ordered, from, func(s analyticsSample, t time.Time) int { return s.at.Compare(t) })
+	full := len(a.samples) == a.cfg.SampleSize
+	return ordered[i:], full && i == 0 && len(ordered) > 0 && ordered[0].at.After(from)
+}
+
+// Analytics reports on the submissions sampled over the window of q, with
+// ok unset on a pool without WithAnalytics
+func (p *WorkerPool) Analytics(q AnalyticsQuery) (report AnalyticsReport, ok bool) {
+	a := p.analytics
+	if a == nil {
+		return AnalyticsReport{}, false
+	}
+	window := a.cfg.Window
+	if q.Window > 0 {
+		window = min(q.Window, window)
+	}
+	bucket := q.Bucket
+	if bucket <= 0 {
+		bucket = max((window / 30).Round(time.Second), time.Second)
+	}
+	bucket = max(bucket, window/maxArrivalsBuckets)
+	top := cmp.Or(q.Top, 10)
+
+	now := time.Now()
+	report = AnalyticsReport{From: now.Add(-window), To: now, Bucket: bucket, Rate: a.cfg.Rate}
+	samples, truncated := a.since(report.From)
+	if truncated {
+		report.From, report.Truncated = samples[0].at, true
+	}
+	report.Samples = len(samples)
+	report.Estimated = int(math.Round(float64(len(samples)) / a.cfg.Rate))
+	report.Payload = payloadSizes(samples)
+	report.Types = topShares(samples, top, func(s analyticsSample) string { return s.typ })
+	report.Tenants = topShares(samples, top, func(s analyticsSample) string { return s.tenant })
+
+	// Buckets end at now, the first one possibly starting before From
+	n := int((report.To.Sub(report.From) + bucket - 1) / bucket)
+	report.Arrivals = make([]ArrivalsBucket, max(n, 1))
+	start := report.To.Add(-time.Duration(len(report.Arrivals)) * bucket)
+	for i := range report.Arrivals {
+		report.Arrivals[i].Start = start.Add(time.Duration(i) * bucket)
+	}
+	for _, s := range samples {
+		i := min(int(s.at.Sub(start)/bucket), len(report.Arrivals)-1)
+		report.Arrivals[i].Samples++
+	}
+	for i := range report.Arrivals {
+		report.Arrivals[i].Rate = float64(report.Arrivals[i].Samples) / a.cfg.Rate / bucket.Seconds()
+	}
+	return report, true
+}
+
+// payloadSizes computes the distribution of the payload sizes of samples
+func payloadSizes(samples []analyticsSample) PayloadSizes {
+	ps := PayloadSizes{Buckets: []SizeBucket{}}
+	if len(samples) == 0 {
+		return ps
+	}
+	sizes := make([]int, len(samples))
+	total := 0
+	for i, s := range samples {
+		sizes[i] = s.size
+		total += s.size
+	}
+	slices.Sort(sizes)
+	percentile := func(p float64) int {
+		return sizes[max(int(math.Ceil(p*float64(len(sizes))))-1, 0)]
+	}
+	ps.Min, ps.Max = sizes[0], sizes[len(sizes)-1]
+	ps.Mean = float64(total) / float64(len(sizes))
+	ps.P50, ps.P90, ps.P99 = percentile(0.5), percentile(0.9), percentile(0.99)
+
+	// Bucket 0 holds the empty payloads, bucket i those up to 2^(i-1) bytes
+	bucketOf := func(size int) int {
+		if size == 0 {
+			return 0
+		}
+		return bits.Len(uint(size-1)) + 1
+	}
+	first := bucketOf(ps.Min)
+	for i := first; i <= bucketOf(ps.Max); i++ {
+		b := SizeBucket{}
+		if i > 0 {
+			b.UpTo = 1 << (i - 1)
+		}
+		ps.Buckets = append(ps.Buckets, b)
+	}
+	for _, size := range sizes {
+		ps.Buckets[bucketOf(size)-first].Samples++
+	}
+	return ps
+}
+
+// topShares groups samples by key, returning the top largest groups
+func topShares(samples []analyticsSample, top int, key func(analyticsSample) string) []AnalyticsShare {
+	groups := make(map[string]*AnalyticsShare)
+	for _, s := range samples {
+		k := key(s)
+		g, ok := groups[k]
+		if !ok {
+			g = &AnalyticsShare{Name: k}
+			groups[k] = g
+		}
+		g.Samples++
+		g.MeanBytes += float64(s.size)
+	}
+	shares := make([]AnalyticsShare, 0, len(groups))
+	for _, g := range groups {
+		g.Share = float64(g.Samples) / float64(len(samples))
+		g.MeanBytes /= float64(g.Samples)
+		shares = append(shares, *g)
+	}
+	slices.SortFunc(shares, func(a, b AnalyticsShare) int {
+		return cmp.Or(cmp.Compare(b.Samples, a.Samples), cmp.Compare(a.Name, b.Name))
+	})
+	if len(shares) > top {
+		shares = shares[:top]
+	}
+	return shares
+}
+
+func (s *Server) analyticsRoutes(r *mux.Router) {
+	r.HandleFunc("/analytics", s.analyticsHandler).Methods("GET")
+}
+
+// analyticsHandler serves GET /analytics, a report on the submissions
+// sampled over the window, bucket and top parameters
+func (s *Server) analyticsHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	v := r.URL.Query()
+	var q AnalyticsQuery
+	for _, dp := range []struct {
+		name string
+		dst  *time.Duration
+	}{{"window", &q.Window}, {"bucket", &q.Bucket}} {
+		if s := v.Get(dp.name); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s %q, want a duration", dp.name, s), dp.name)
+				return
+			}
+			*dp.dst = d
+		}
+	}
+	if s := v.Get("top"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid top %q", s), "top")
+			return
+		}
+		q.Top = n
+	}
+	report, ok := p.Analytics(q)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "analytics are not enabled", "")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
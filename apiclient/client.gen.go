@@ -0,0 +1,1599 @@
+// Code generated by apiclient/internal/gen from openapi.json. DO NOT EDIT.
+
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// AdminStatus is the state of a pool, its circuit breaker and its workers
+type AdminStatus struct {
+	Queue  string `json:"queue,omitempty"`
+	Paused bool   `json:"paused"`
+	// One of closed, open, half-open
+	Circuit string `json:"circuit"`
+	// Whether this instance fires recurring schedules
+	Leader  bool `json:"leader"`
+	Workers int  `json:"workers"`
+	// With a registered handler
+	TaskTypes   []string `json:"task_types,omitempty"`
+	BusyWorkers int      `json:"busy_workers"`
+	// Workers finishing their task before leaving after a scale-down
+	DrainingWorkers int                `json:"draining_workers,omitempty"`
+	QueueDepth      int                `json:"queue_depth"`
+	InFlight        []int              `json:"in_flight"`
+	Stuck           []int              `json:"stuck,omitempty"`
+	WorkerStatus    []WorkerStatus     `json:"worker_status"`
+	Replication     *ReplicationStatus `json:"replication,omitempty"`
+}
+
+// AnalyticsReport is the tasks sampled from the submissions over a window. Counts are of samples, rates and estimated scale them back to all the submissions
+type AnalyticsReport struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Width of the arrival buckets in nanoseconds
+	Bucket time.Duration `json:"bucket"`
+	// Share of the submissions sampled
+	Rate float64 `json:"rate"`
+	// Submissions sampled in the window
+	Samples int `json:"samples"`
+	// Submissions in the window
+	Estimated int `json:"estimated"`
+	// The sample filled up, from moving past the start of the window asked for
+	Truncated bool         `json:"truncated,omitempty"`
+	Payload   PayloadSizes `json:"payload"`
+	// Most sampled first
+	Types []AnalyticsShare `json:"types"`
+	// Most sampled first
+	Tenants  []AnalyticsShare `json:"tenants"`
+	Arrivals []ArrivalsBucket `json:"arrivals"`
+}
+
+// AnalyticsShare is the part of the sample of a task type or tenant
+type AnalyticsShare struct {
+	// Empty for the tasks without one
+	Name    string `json:"name"`
+	Samples int    `json:"samples"`
+	// Of the samples in the window
+	Share float64 `json:"share"`
+	// Of their payloads
+	MeanBytes float64 `json:"mean_bytes"`
+}
+
+// ArrivalsBucket is the submissions sampled from start over the width of the report buckets
+type ArrivalsBucket struct {
+	Start   time.Time `json:"start"`
+	Samples int       `json:"samples"`
+	// Estimated submissions per second
+	Rate float64 `json:"rate"`
+}
+
+// BatchResponse is the envelope of a batch, with the IDs assigned and the status of each task in request order
+type BatchResponse struct {
+	// The status every task shares, as in statuses, or mixed
+	Status string `json:"status"`
+	// The line answered to text clients
+	Message string `json:"message"`
+	// The tasks submitted
+	Count int   `json:"count,omitempty"`
+	IDs   []int `json:"ids"`
+	// The status of each task, as in Submitted
+	Statuses []string `json:"statuses"`
+}
+
+// BudgetUsage is an execution budget in its current period
+type BudgetUsage struct {
+	// Length of a period in nanoseconds
+	Period int64 `json:"period"`
+	// Tasks started per period
+	Limit     int       `json:"limit"`
+	Used      int       `json:"used"`
+	Remaining int       `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+	// Task types counted, all when absent
+	Types []string `json:"types,omitempty"`
+}
+
+// BulkConfirmation is answered without confirm, the tasks a bulk operation would act on and the token confirming it; with confirm, the tasks acted on
+type BulkConfirmation struct {
+	// Set once confirmed
+	Tasks   []BulkTask `json:"tasks,omitempty"`
+	Action  string     `json:"action,omitempty"`
+	Matched int        `json:"matched,omitempty"`
+	// IDs of the first matching tasks
+	Sample []int `json:"sample,omitempty"`
+	// Passed as confirm with the same parameters, by the same client
+	ConfirmToken string     `json:"confirm_token,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+}
+
+// BulkResult is the tasks a bulk operation acted on
+type BulkResult struct {
+	Tasks []BulkTask `json:"tasks"`
+}
+
+// BulkTask is a task a bulk operation acted on
+type BulkTask struct {
+	ID int `json:"id"`
+	// Why the operation failed for this task
+	Error string `json:"error,omitempty"`
+}
+
+// DeadLetter is a task that failed for good
+type DeadLetter struct {
+	Task     Task      `json:"task"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// Envelope is the outcome of an action answering with no resource of its own
+type Envelope struct {
+	// The task acted on
+	ID int `json:"id,omitempty"`
+	// What the action did, such as paused, resized, flushed, canceled or purged
+	Status string `json:"status"`
+	// The line answered to text clients
+	Message string `json:"message"`
+	// The tasks flushed or purged, or the workers after a resize
+	Count int `json:"count,omitempty"`
+	// Routes of the task acted on
+	Links map[string]string `json:"links,omitempty"`
+}
+
+// Error is the body of failed requests
+type Error struct {
+	Error string `json:"error"`
+	// Stable machine-readable code, such as task_not_found or queue_full
+	Code string `json:"code"`
+	// The invalid parameter or field
+	Field string `json:"field,omitempty"`
+	// Set when a validator refused the task
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// EventRequest is a task to submit, every field optional
+type EventRequest struct {
+	// Payload handed to the handler
+	Data string `json:"data,omitempty"`
+	// Overrides the priority query parameter
+	Priority int `json:"priority,omitempty"`
+	// Duration such as 30s to wait before running, at most 24h
+	Delay string `json:"delay,omitempty"`
+	// Per-attempt limit, overriding the pool default
+	Timeout string `json:"timeout,omitempty"`
+	// Dropped if still queued after this duration
+	TTL string `json:"ttl,omitempty"`
+	// Named queue, which must match the path if any
+	Queue string `json:"queue,omitempty"`
+	// Selects the handler
+	Type string `json:"type,omitempty"`
+	// Orders the events sharing it
+	PartitionKey string `json:"partition_key,omitempty"`
+	// Ignored for authenticated clients, who are their own tenant
+	Tenant string `json:"tenant,omitempty"`
+	// Share of the pool capacity taken while running, 1 by default
+	Weight int `json:"weight,omitempty"`
+	// Key/value pairs to find the task by, keys of at most 63 bytes without a colon
+	Labels map[string]string `json:"labels,omitempty"`
+	// Version of the shape of data, the current one of the type when unset; older versions are migrated before running
+	SchemaVersion int `json:"schema_version,omitempty"`
+	// Skips the handler, the task succeeding once routed, to load-test the pipeline without side effects
+	DryRun bool `json:"dry_run,omitempty"`
+	// IDs of tasks that must succeed before this one is queued; it fails without running once one does not
+	DependsOn []int `json:"depends_on,omitempty"`
+	// Allows a second execution of an attempt still running after the hedging threshold, the first to succeed being taken; the handler must tolerate duplicates
+	Hedge bool `json:"hedge,omitempty"`
+	// Overrides the Idempotency-Key header
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// Receives the final record of the task
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+
+// FieldError is an invalid field of a task refused by a validator
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// PayloadSizes is distribution of the data sizes of the sampled tasks in bytes, uploaded payloads not counted
+type PayloadSizes struct {
+	Min  int     `json:"min"`
+	Max  int     `json:"max"`
+	Mean float64 `json:"mean"`
+	P50  int     `json:"p50"`
+	P90  int     `json:"p90"`
+	P99  int     `json:"p99"`
+	// Doubling in size, from the smallest payload to the largest
+	Buckets []SizeBucket `json:"buckets"`
+}
+
+// Progress is how far along a running task is, as reported by its handler
+type Progress struct {
+	Percent   int       `json:"percent"`
+	Message   string    `json:"message,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// QueueInfo is a pool and its load
+type QueueInfo struct {
+	// Empty for an unnamed default pool
+	Name        string `json:"name"`
+	Workers     int    `json:"workers"`
+	BusyWorkers int    `json:"busy_workers"`
+	QueueDepth  int    `json:"queue_depth"`
+	Paused      bool   `json:"paused"`
+}
+
+// RecoveryIssue is an inconsistency found by a recovery pass
+type RecoveryIssue struct {
+	// One of orphaned_claim, stuck_running, schema
+	Kind     string `json:"kind"`
+	TaskID   int    `json:"task_id,omitempty"`
+	Detail   string `json:"detail"`
+	Repaired bool   `json:"repaired,omitempty"`
+}
+
+// RecoveryReport is the outcome of a recovery pass; counts and repaired cover every issue, issues lists the first thousand
+type RecoveryReport struct {
+	Started time.Time `json:"started"`
+	// In nanoseconds
+	Duration time.Duration `json:"duration"`
+	// Set when run as the pool started rather than on request
+	Boot   bool `json:"boot"`
+	Repair bool `json:"repair"`
+	// Issues by kind
+	Counts    map[string]int  `json:"counts"`
+	Repaired  int             `json:"repaired"`
+	Issues    []RecoveryIssue `json:"issues"`
+	Truncated bool            `json:"truncated,omitempty"`
+	// Stopped the pass, the issues found before it being reported
+	Error string `json:"error,omitempty"`
+}
+
+// ReplicationStatus is how far the standby copy of the queue, in another region, is behind. Set with a backend replicating to a standby
+type ReplicationStatus struct {
+	// Whether this instance applies the changes to the standby
+	Active bool `json:"active"`
+	// Age of the oldest change not yet applied, in nanoseconds
+	Lag time.Duration `json:"lag"`
+	// Changes not yet applied
+	Backlog     int        `json:"backlog"`
+	LastApplied *time.Time `json:"last_applied,omitempty"`
+	// Full copies made by this instance
+	Resyncs int `json:"resyncs"`
+	// The standby took over and replication stopped
+	Promoted bool `json:"promoted,omitempty"`
+	// Of the last attempt, if it failed
+	Error string `json:"error,omitempty"`
+}
+
+// ResizeRequest is the number of workers wanted
+type ResizeRequest struct {
+	Workers int `json:"workers"`
+}
+
+// Schedule is a recurring task stored in the backend
+type Schedule struct {
+	Name      string    `json:"name"`
+	Cron      string    `json:"cron"`
+	Task      Task      `json:"task"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Unset if the schedule never fires again
+	NextRun *time.Time `json:"next_run,omitempty"`
+}
+
+// ScheduleRequest is a recurring task
+type ScheduleRequest struct {
+	// Generated when empty on POST, must match the path on PUT
+	Name string `json:"name,omitempty"`
+	// Five-field cron expression in server local time, @hourly, @daily, @weekly, @monthly, @yearly or @every <duration>
+	Cron string        `json:"cron"`
+	Task *EventRequest `json:"task,omitempty"`
+}
+
+// SizeBucket is the payloads larger than the previous bucket and of at most up_to bytes
+type SizeBucket struct {
+	UpTo    int `json:"up_to"`
+	Samples int `json:"samples"`
+}
+
+// Submitted is a submitted task with, unless waited for, the envelope of the submission
+type Submitted struct {
+	TaskRecord
+	// queued, delayed until run_at, blocked on depends_on, shed from the full queue or dead_lettered over the storage quota; the state of the task when it already ran
+	Status  string `json:"status,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Routes of the task: self, logs, result and wait
+	Links map[string]string `json:"links,omitempty"`
+}
+
+// Task is a unit of work with its scheduling options
+type Task struct {
+	ID       int    `json:"id"`
+	Data     string `json:"data"`
+	Priority int    `json:"priority"`
+	// Not dispatched before this time
+	RunAt *time.Time `json:"run_at,omitempty"`
+	// In nanoseconds
+	Delay time.Duration `json:"delay,omitempty"`
+	// Per-attempt limit in nanoseconds
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Number of times the handler has been run
+	Attempts int `json:"attempts"`
+	// Dropped if still queued at this time
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// In nanoseconds
+	TTL            time.Duration `json:"ttl,omitempty"`
+	Type           string        `json:"type,omitempty"`
+	PartitionKey   string        `json:"partition_key,omitempty"`
+	Tenant         string        `json:"tenant,omitempty"`
+	CorrelationID  string        `json:"correlation_id,omitempty"`
+	IdempotencyKey string        `json:"idempotency_key,omitempty"`
+	Queue          string        `json:"queue,omitempty"`
+	// W3C trace context
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+	// State last saved by the handler
+	Checkpoint  string `json:"checkpoint,omitempty"`
+	CallbackURL string `json:"callback_url,omitempty"`
+	WorkflowID  string `json:"workflow_id,omitempty"`
+	Step        string `json:"step,omitempty"`
+	GroupID     string `json:"group_id,omitempty"`
+	// Payload kept in the payload store, for uploads
+	PayloadRef string `json:"payload_ref,omitempty"`
+	// Share of the pool capacity taken while running
+	Weight int               `json:"weight,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// Headers copied from the submission request
+	Headers map[string]string `json:"headers,omitempty"`
+	// Version of the shape of data
+	SchemaVersion int `json:"schema_version,omitempty"`
+	// The handler is skipped
+	DryRun bool `json:"dry_run,omitempty"`
+	// Tasks that had to succeed first
+	DependsOn []int `json:"depends_on,omitempty"`
+	// Late attempts may run twice at once
+	Hedge bool `json:"hedge,omitempty"`
+	// ULID or UUID unique across instances, when the server gives tasks one
+	Uid string `json:"uid,omitempty"`
+}
+
+// TaskLog is a line logged by the handler of a task
+type TaskLog struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Attempt int               `json:"attempt"`
+	Attrs   map[string]string `json:"attrs,omitempty"`
+}
+
+// TaskLogs is the latest lines logged for a task
+type TaskLogs struct {
+	ID   int       `json:"id"`
+	Logs []TaskLog `json:"logs"`
+	// Older lines past the size limit
+	Dropped int `json:"dropped"`
+}
+
+// TaskRecord is a task with its state and outcome
+type TaskRecord struct {
+	Task
+	State TaskState `json:"state"`
+	Error string    `json:"error,omitempty"`
+	// Set by the handler
+	Output string `json:"output,omitempty"`
+	// Whether the result set by the handler is stored
+	HasResult  bool       `json:"has_result,omitempty"`
+	Progress   *Progress  `json:"progress,omitempty"`
+	QueuedAt   time.Time  `json:"queued_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// TaskState is where a task is in its lifecycle
+type TaskState string
+
+// TaskState values
+const (
+	TaskStateQueued    TaskState = "queued"
+	TaskStateRunning   TaskState = "running"
+	TaskStateSucceeded TaskState = "succeeded"
+	TaskStateFailed    TaskState = "failed"
+	TaskStateCanceled  TaskState = "canceled"
+)
+
+// UsageReport is the usage of the attempts over a period, the rows taking the most wall time first
+type UsageReport struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Unset on platforms where CPU time is not recorded
+	CpuMeasured bool        `json:"cpu_measured"`
+	Total       UsageTotals `json:"total"`
+	Rows        []UsageRow  `json:"rows"`
+}
+
+// UsageRow is the usage of a queue, tenant and type, the dimensions not grouped by being absent
+type UsageRow struct {
+	Queue    string `json:"queue,omitempty"`
+	Tenant   string `json:"tenant,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Attempts int    `json:"attempts"`
+	// Attempts that returned an error
+	Failed int `json:"failed"`
+	// In nanoseconds
+	WallTime time.Duration `json:"wall_time"`
+	// Of the threads running the handlers, in nanoseconds
+	CpuTime time.Duration `json:"cpu_time"`
+}
+
+// UsageTotals is sums of the attempts of a set of tasks
+type UsageTotals struct {
+	Attempts int `json:"attempts"`
+	// Attempts that returned an error
+	Failed int `json:"failed"`
+	// In nanoseconds
+	WallTime time.Duration `json:"wall_time"`
+	// Of the threads running the handlers, in nanoseconds
+	CpuTime time.Duration `json:"cpu_time"`
+}
+
+// WorkerStatus is what a worker is doing
+type WorkerStatus struct {
+	ID     int  `json:"id"`
+	Busy   bool `json:"busy"`
+	TaskID int  `json:"task_id,omitempty"`
+	// When the worker started or finished its last task
+	Since time.Time `json:"since"`
+	// Last sign of life of the task
+	Heartbeat time.Time `json:"heartbeat"`
+	// Flagged by the watchdog
+	Stuck bool `json:"stuck,omitempty"`
+	// Tasks in the local queue, with work stealing
+	Queued int `json:"queued,omitempty"`
+	// Tasks taken from peers, with work stealing
+	Stolen int `json:"stolen,omitempty"`
+	// Asked by a scale-down to leave once its current task is done
+	Draining      bool       `json:"draining,omitempty"`
+	DrainingSince *time.Time `json:"draining_since,omitempty"`
+}
+
+// GetAdminStatus calls GET /admin, to get the state of the default pool and its workers
+func (c *Client) GetAdminStatus(ctx context.Context) (*AdminStatus, error) {
+	path := "/admin"
+	resp, err := c.do(ctx, "GET", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out AdminStatus
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// FlushQueue calls POST /admin/flush, to drop every queued task of the default pool
+func (c *Client) FlushQueue(ctx context.Context) (*Envelope, error) {
+	path := "/admin/flush"
+	resp, err := c.do(ctx, "POST", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out Envelope
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PausePool calls POST /admin/pause, to stop handing queued tasks of the default pool to workers
+func (c *Client) PausePool(ctx context.Context) (*Envelope, error) {
+	path := "/admin/pause"
+	resp, err := c.do(ctx, "POST", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out Envelope
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetRecovery calls GET /admin/recovery, to get the last recovery report of the default pool
+func (c *Client) GetRecovery(ctx context.Context) (*RecoveryReport, error) {
+	path := "/admin/recovery"
+	resp, err := c.do(ctx, "GET", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out RecoveryReport
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RecoverParams are the query and header parameters of Recover
+type RecoverParams struct {
+	// true to requeue orphaned and stuck claims, fix stored data and dead-letter lost tasks, false by default
+	Repair string
+}
+
+// Recover calls POST /admin/recovery, to check the backend and task records of the default pool, optionally repairing the issues found
+func (c *Client) Recover(ctx context.Context, params *RecoverParams) (*RecoveryReport, error) {
+	path := "/admin/recovery"
+	query, header := url.Values{}, http.Header{}
+	if params != nil {
+		if params.Repair != "" {
+			query.Set("repair", params.Repair)
+		}
+	}
+	resp, err := c.do(ctx, "POST", path, query, header, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out RecoveryReport
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ResumePool calls POST /admin/resume, to resume a paused default pool
+func (c *Client) ResumePool(ctx context.Context) (*Envelope, error) {
+	path := "/admin/resume"
+	resp, err := c.do(ctx, "POST", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out Envelope
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ResizePool calls POST /admin/workers, to change the number of workers of the default pool
+func (c *Client) ResizePool(ctx context.Context, body ResizeRequest) (*Envelope, error) {
+	path := "/admin/workers"
+	resp, err := c.do(ctx, "POST", path, nil, nil, body, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out Envelope
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetAnalyticsParams are the query and header parameters of GetAnalytics
+type GetAnalyticsParams struct {
+	// Duration up to now the report covers, at most the configured window, which is the default
+	Window string
+	// Width of the arrival buckets as a duration, a 30th of the window by default
+	Bucket string
+	// Types and tenants listed at most, 10 by default
+	Top string
+}
+
+// GetAnalytics calls GET /analytics, to describe the tasks sampled from the submissions to the default pool
+func (c *Client) GetAnalytics(ctx context.Context, params *GetAnalyticsParams) (*AnalyticsReport, error) {
+	path := "/analytics"
+	query, header := url.Values{}, http.Header{}
+	if params != nil {
+		if params.Window != "" {
+			query.Set("window", params.Window)
+		}
+		if params.Bucket != "" {
+			query.Set("bucket", params.Bucket)
+		}
+		if params.Top != "" {
+			query.Set("top", params.Top)
+		}
+	}
+	resp, err := c.do(ctx, "GET", path, query, header, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out AnalyticsReport
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetBudget calls GET /budget, to get the remaining execution budgets of the default pool
+func (c *Client) GetBudget(ctx context.Context) ([]BudgetUsage, error) {
+	path := "/budget"
+	resp, err := c.do(ctx, "GET", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out []BudgetUsage
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListDeadLettersParams are the query and header parameters of ListDeadLetters
+type ListDeadLettersParams struct {
+	// Type of the tasks
+	Type string
+	// Substring of the error
+	Error string
+	// Failed at or after this RFC 3339 time
+	Since string
+	// Failed before this RFC 3339 time
+	Until string
+	// failed_at, the default, or -failed_at for the latest first
+	Sort string
+	// Items per page, 100 by default and up to 1000
+	Limit string
+	// X-Next-Cursor of the previous page, passed with the same parameters
+	Cursor string
+}
+
+// ListDeadLetters calls GET /deadletter, to list a page of the dead letters of the default pool, oldest failure first
+func (c *Client) ListDeadLetters(ctx context.Context, params *ListDeadLettersParams) ([]DeadLetter, error) {
+	path := "/deadletter"
+	query, header := url.Values{}, http.Header{}
+	if params != nil {
+		if params.Type != "" {
+			query.Set("type", params.Type)
+		}
+		if params.Error != "" {
+			query.Set("error", params.Error)
+		}
+		if params.Since != "" {
+			query.Set("since", params.Since)
+		}
+		if params.Until != "" {
+			query.Set("until", params.Until)
+		}
+		if params.Sort != "" {
+			query.Set("sort", params.Sort)
+		}
+		if params.Limit != "" {
+			query.Set("limit", params.Limit)
+		}
+		if params.Cursor != "" {
+			query.Set("cursor", params.Cursor)
+		}
+	}
+	resp, err := c.do(ctx, "GET", path, query, header, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out []DeadLetter
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PurgeDeadLetters calls DELETE /deadletter, to drop every dead letter of the default pool
+func (c *Client) PurgeDeadLetters(ctx context.Context) (*Envelope, error) {
+	path := "/deadletter"
+	resp, err := c.do(ctx, "DELETE", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out Envelope
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RetryDeadLetter calls POST /deadletter/{id}/retry, to submit a dead-lettered task of the default pool again
+func (c *Client) RetryDeadLetter(ctx context.Context, id int) (*Envelope, error) {
+	path := "/deadletter/" + url.PathEscape(strconv.Itoa(id)) + "/retry"
+	resp, err := c.do(ctx, "POST", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out Envelope
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SubmitEventParams are the query and header parameters of SubmitEvent
+type SubmitEventParams struct {
+	// low, normal, high or a number, higher first; the body may set it per event
+	Priority string
+	// true or a duration such as 10s, at most 1m, to answer with the final record of the task
+	Wait string
+	// Deduplicates submissions, suffixed with the position of each event of a batch
+	IdempotencyKey string
+}
+
+// SubmitEvent calls POST /event, to submit a task to the default pool
+func (c *Client) SubmitEvent(ctx context.Context, params *SubmitEventParams, body *EventRequest) (*Submitted, error) {
+	path := "/event"
+	query, header := url.Values{}, http.Header{}
+	if params != nil {
+		if params.Priority != "" {
+			query.Set("priority", params.Priority)
+		}
+		if params.Wait != "" {
+			query.Set("wait", params.Wait)
+		}
+		if params.IdempotencyKey != "" {
+			header.Set("Idempotency-Key", params.IdempotencyKey)
+		}
+	}
+	var payload any
+	if body != nil {
+		payload = body
+	}
+	resp, err := c.do(ctx, "POST", path, query, header, payload, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out Submitted
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetTask calls GET /event/{id}, to get the record of a task of the default pool
+func (c *Client) GetTask(ctx context.Context, id int) (*TaskRecord, error) {
+	path := "/event/" + url.PathEscape(strconv.Itoa(id))
+	resp, err := c.do(ctx, "GET", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out TaskRecord
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CancelTask calls DELETE /event/{id}, to cancel a queued or running task of the default pool
+func (c *Client) CancelTask(ctx context.Context, id int) (*Envelope, error) {
+	path := "/event/" + url.PathEscape(strconv.Itoa(id))
+	resp, err := c.do(ctx, "DELETE", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out Envelope
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetTaskLogs calls GET /event/{id}/logs, to get the lines a task of the default pool logged
+func (c *Client) GetTaskLogs(ctx context.Context, id int) (*TaskLogs, error) {
+	path := "/event/" + url.PathEscape(strconv.Itoa(id)) + "/logs"
+	resp, err := c.do(ctx, "GET", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out TaskLogs
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetTaskResult calls GET /event/{id}/result, to get the result a task of the default pool set
+func (c *Client) GetTaskResult(ctx context.Context, id int) (*json.RawMessage, error) {
+	path := "/event/" + url.PathEscape(strconv.Itoa(id)) + "/result"
+	resp, err := c.do(ctx, "GET", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out json.RawMessage
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// WaitTaskParams are the query and header parameters of WaitTask
+type WaitTaskParams struct {
+	// How long to wait, such as 10s, at most 1m and 30s by default
+	Timeout string
+}
+
+// WaitTask calls GET /event/{id}/wait, to wait for a task of the default pool to finish
+func (c *Client) WaitTask(ctx context.Context, id int, params *WaitTaskParams) (*TaskRecord, error) {
+	path := "/event/" + url.PathEscape(strconv.Itoa(id)) + "/wait"
+	query, header := url.Values{}, http.Header{}
+	if params != nil {
+		if params.Timeout != "" {
+			query.Set("timeout", params.Timeout)
+		}
+	}
+	resp, err := c.do(ctx, "GET", path, query, header, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out TaskRecord
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListTasksParams are the query and header parameters of ListTasks
+type ListTasksParams struct {
+	// key:value a task must carry, repeated for several labels
+	Label string
+	// State of the tasks
+	Status string
+	// Type of the tasks
+	Type string
+	// Tenant of the tasks
+	Tenant string
+	// UID of the task, when the server gives tasks one
+	Uid string
+	// Queue the tasks were submitted to, default for the unnamed pool
+	Queue string
+	// Queued at or after this RFC 3339 time
+	Since string
+	// Queued before this RFC 3339 time
+	Until string
+	// id, the default, or -id for the newest first
+	Sort string
+	// Items per page, 100 by default and up to 1000
+	Limit string
+	// X-Next-Cursor of the previous page, passed with the same parameters
+	Cursor string
+}
+
+// ListTasks calls GET /events, to list the tasks of the default pool matching labels, a status, a type or a tenant
+func (c *Client) ListTasks(ctx context.Context, params *ListTasksParams) ([]TaskRecord, error) {
+	path := "/events"
+	query, header := url.Values{}, http.Header{}
+	if params != nil {
+		if params.Label != "" {
+			query.Set("label", params.Label)
+		}
+		if params.Status != "" {
+			query.Set("status", params.Status)
+		}
+		if params.Type != "" {
+			query.Set("type", params.Type)
+		}
+		if params.Tenant != "" {
+			query.Set("tenant", params.Tenant)
+		}
+		if params.Uid != "" {
+			query.Set("uid", params.Uid)
+		}
+		if params.Queue != "" {
+			query.Set("queue", params.Queue)
+		}
+		if params.Since != "" {
+			query.Set("since", params.Since)
+		}
+		if params.Until != "" {
+			query.Set("until", params.Until)
+		}
+		if params.Sort != "" {
+			query.Set("sort", params.Sort)
+		}
+		if params.Limit != "" {
+			query.Set("limit", params.Limit)
+		}
+		if params.Cursor != "" {
+			query.Set("cursor", params.Cursor)
+		}
+	}
+	resp, err := c.do(ctx, "GET", path, query, header, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out []TaskRecord
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SubmitBatchParams are the query and header parameters of SubmitBatch
+type SubmitBatchParams struct {
+	// low, normal, high or a number, higher first; the body may set it per event
+	Priority string
+	// Deduplicates submissions, suffixed with the position of each event of a batch
+	IdempotencyKey string
+}
+
+// SubmitBatch calls POST /events/batch, to submit up to 1000 tasks to the default pool, all or none
+func (c *Client) SubmitBatch(ctx context.Context, params *SubmitBatchParams, body []EventRequest) (*BatchResponse, error) {
+	path := "/events/batch"
+	query, header := url.Values{}, http.Header{}
+	if params != nil {
+		if params.Priority != "" {
+			query.Set("priority", params.Priority)
+		}
+		if params.IdempotencyKey != "" {
+			header.Set("Idempotency-Key", params.IdempotencyKey)
+		}
+	}
+	resp, err := c.do(ctx, "POST", path, query, header, body, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out BatchResponse
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CancelTasksParams are the query and header parameters of CancelTasks
+type CancelTasksParams struct {
+	// key:value a task must carry, repeated for several labels
+	Label string
+	// State of the tasks
+	Status string
+	// Type of the tasks
+	Type string
+	// Tenant of the tasks
+	Tenant string
+	// UID of the task, when the server gives tasks one
+	Uid string
+	// Queue the tasks were submitted to, default for the unnamed pool
+	Queue string
+	// RFC 3339 time, included
+	Since string
+	// RFC 3339 time, excluded
+	Until string
+	// Duration such as 1h, queued longer ago than that
+	OlderThan string
+	// Token of the preview answered without it, valid once for 5 minutes by default
+	Confirm string
+}
+
+// CancelTasks calls POST /events/cancel, to cancel the queued and running tasks of the default pool matching at least one filter
+func (c *Client) CancelTasks(ctx context.Context, params *CancelTasksParams) (*BulkConfirmation, error) {
+	path := "/events/cancel"
+	query, header := url.Values{}, http.Header{}
+	if params != nil {
+		if params.Label != "" {
+			query.Set("label", params.Label)
+		}
+		if params.Status != "" {
+			query.Set("status", params.Status)
+		}
+		if params.Type != "" {
+			query.Set("type", params.Type)
+		}
+		if params.Tenant != "" {
+			query.Set("tenant", params.Tenant)
+		}
+		if params.Uid != "" {
+			query.Set("uid", params.Uid)
+		}
+		if params.Queue != "" {
+			query.Set("queue", params.Queue)
+		}
+		if params.Since != "" {
+			query.Set("since", params.Since)
+		}
+		if params.Until != "" {
+			query.Set("until", params.Until)
+		}
+		if params.OlderThan != "" {
+			query.Set("older_than", params.OlderThan)
+		}
+		if params.Confirm != "" {
+			query.Set("confirm", params.Confirm)
+		}
+	}
+	resp, err := c.do(ctx, "POST", path, query, header, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out BulkConfirmation
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RetryTasksParams are the query and header parameters of RetryTasks
+type RetryTasksParams struct {
+	// key:value a task must carry, repeated for several labels
+	Label string
+	// State of the tasks
+	Status string
+	// Type of the tasks
+	Type string
+	// Tenant of the tasks
+	Tenant string
+	// UID of the task, when the server gives tasks one
+	Uid string
+	// Queue the tasks were submitted to, default for the unnamed pool
+	Queue string
+	// RFC 3339 time, included
+	Since string
+	// RFC 3339 time, excluded
+	Until string
+	// Duration such as 1h, queued longer ago than that
+	OlderThan string
+}
+
+// RetryTasks calls POST /events/retry, to queue again the failed tasks of the default pool matching at least one filter
+func (c *Client) RetryTasks(ctx context.Context, params *RetryTasksParams) (*BulkResult, error) {
+	path := "/events/retry"
+	query, header := url.Values{}, http.Header{}
+	if params != nil {
+		if params.Label != "" {
+			query.Set("label", params.Label)
+		}
+		if params.Status != "" {
+			query.Set("status", params.Status)
+		}
+		if params.Type != "" {
+			query.Set("type", params.Type)
+		}
+		if params.Tenant != "" {
+			query.Set("tenant", params.Tenant)
+		}
+		if params.Uid != "" {
+			query.Set("uid", params.Uid)
+		}
+		if params.Queue != "" {
+			query.Set("queue", params.Queue)
+		}
+		if params.Since != "" {
+			query.Set("since", params.Since)
+		}
+		if params.Until != "" {
+			query.Set("until", params.Until)
+		}
+		if params.OlderThan != "" {
+			query.Set("older_than", params.OlderThan)
+		}
+	}
+	resp, err := c.do(ctx, "POST", path, query, header, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out BulkResult
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PurgeTasksParams are the query and header parameters of PurgeTasks
+type PurgeTasksParams struct {
+	// key:value a task must carry, repeated for several labels
+	Label string
+	// Type of the tasks
+	Type string
+	// Tenant of the tasks
+	Tenant string
+	// UID of the task, when the server gives tasks one
+	Uid string
+	// RFC 3339 time, included
+	Since string
+	// RFC 3339 time, excluded
+	Until string
+	// Duration such as 1h, queued longer ago than that
+	OlderThan string
+	// Token of the preview answered without it, valid once for 5 minutes by default
+	Confirm string
+}
+
+// PurgeTasks calls POST /purge, to drop the queued tasks of the default pool, those matching the filters when set
+func (c *Client) PurgeTasks(ctx context.Context, params *PurgeTasksParams) (*BulkConfirmation, error) {
+	path := "/purge"
+	query, header := url.Values{}, http.Header{}
+	if params != nil {
+		if params.Label != "" {
+			query.Set("label", params.Label)
+		}
+		if params.Type != "" {
+			query.Set("type", params.Type)
+		}
+		if params.Tenant != "" {
+			query.Set("tenant", params.Tenant)
+		}
+		if params.Uid != "" {
+			query.Set("uid", params.Uid)
+		}
+		if params.Since != "" {
+			query.Set("since", params.Since)
+		}
+		if params.Until != "" {
+			query.Set("until", params.Until)
+		}
+		if params.OlderThan != "" {
+			query.Set("older_than", params.OlderThan)
+		}
+		if params.Confirm != "" {
+			query.Set("confirm", params.Confirm)
+		}
+	}
+	resp, err := c.do(ctx, "POST", path, query, header, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out BulkConfirmation
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListQueues calls GET /queues, to list the default pool and the named queues
+func (c *Client) ListQueues(ctx context.Context) ([]QueueInfo, error) {
+	path := "/queues"
+	resp, err := c.do(ctx, "GET", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out []QueueInfo
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetQueueAdminStatus calls GET /queues/{queue}/admin, to get the state of a named queue and its workers
+func (c *Client) GetQueueAdminStatus(ctx context.Context, queue string) (*AdminStatus, error) {
+	path := "/queues/" + url.PathEscape(queue) + "/admin"
+	resp, err := c.do(ctx, "GET", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out AdminStatus
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PauseQueue calls POST /queues/{queue}/admin/pause, to stop handing queued tasks of a named queue to workers
+func (c *Client) PauseQueue(ctx context.Context, queue string) (*Envelope, error) {
+	path := "/queues/" + url.PathEscape(queue) + "/admin/pause"
+	resp, err := c.do(ctx, "POST", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out Envelope
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetQueueRecovery calls GET /queues/{queue}/admin/recovery, to get the last recovery report of a named queue
+func (c *Client) GetQueueRecovery(ctx context.Context, queue string) (*RecoveryReport, error) {
+	path := "/queues/" + url.PathEscape(queue) + "/admin/recovery"
+	resp, err := c.do(ctx, "GET", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out RecoveryReport
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RecoverQueueParams are the query and header parameters of RecoverQueue
+type RecoverQueueParams struct {
+	// true to requeue orphaned and stuck claims, fix stored data and dead-letter lost tasks, false by default
+	Repair string
+}
+
+// RecoverQueue calls POST /queues/{queue}/admin/recovery, to check the backend and task records of a named queue, optionally repairing the issues found
+func (c *Client) RecoverQueue(ctx context.Context, queue string, params *RecoverQueueParams) (*RecoveryReport, error) {
+	path := "/queues/" + url.PathEscape(queue) + "/admin/recovery"
+	query, header := url.Values{}, http.Header{}
+	if params != nil {
+		if params.Repair != "" {
+			query.Set("repair", params.Repair)
+		}
+	}
+	resp, err := c.do(ctx, "POST", path, query, header, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out RecoveryReport
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ResumeQueue calls POST /queues/{queue}/admin/resume, to resume a paused named queue
+func (c *Client) ResumeQueue(ctx context.Context, queue string) (*Envelope, error) {
+	path := "/queues/" + url.PathEscape(queue) + "/admin/resume"
+	resp, err := c.do(ctx, "POST", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out Envelope
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ResizeQueue calls POST /queues/{queue}/admin/workers, to change the number of workers of a named queue
+func (c *Client) ResizeQueue(ctx context.Context, queue string, body ResizeRequest) (*Envelope, error) {
+	path := "/queues/" + url.PathEscape(queue) + "/admin/workers"
+	resp, err := c.do(ctx, "POST", path, nil, nil, body, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out Envelope
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetQueueAnalyticsParams are the query and header parameters of GetQueueAnalytics
+type GetQueueAnalyticsParams struct {
+	// Duration up to now the report covers, at most the configured window, which is the default
+	Window string
+	// Width of the arrival buckets as a duration, a 30th of the window by default
+	Bucket string
+	// Types and tenants listed at most, 10 by default
+	Top string
+}
+
+// GetQueueAnalytics calls GET /queues/{queue}/analytics, to describe the tasks sampled from the submissions to a named queue
+func (c *Client) GetQueueAnalytics(ctx context.Context, queue string, params *GetQueueAnalyticsParams) (*AnalyticsReport, error) {
+	path := "/queues/" + url.PathEscape(queue) + "/analytics"
+	query, header := url.Values{}, http.Header{}
+	if params != nil {
+		if params.Window != "" {
+			query.Set("window", params.Window)
+		}
+		if params.Bucket != "" {
+			query.Set("bucket", params.Bucket)
+		}
+		if params.Top != "" {
+			query.Set("top", params.Top)
+		}
+	}
+	resp, err := c.do(ctx, "GET", path, query, header, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out AnalyticsReport
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetQueueBudget calls GET /queues/{queue}/budget, to get the remaining execution budgets of a named queue
+func (c *Client) GetQueueBudget(ctx context.Context, queue string) ([]BudgetUsage, error) {
+	path := "/queues/" + url.PathEscape(queue) + "/budget"
+	resp, err := c.do(ctx, "GET", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out []BudgetUsage
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SubmitQueueEventParams are the query and header parameters of SubmitQueueEvent
+type SubmitQueueEventParams struct {
+	// low, normal, high or a number, higher first; the body may set it per event
+	Priority string
+	// true or a duration such as 10s, at most 1m, to answer with the final record of the task
+	Wait string
+	// Deduplicates submissions, suffixed with the position of each event of a batch
+	IdempotencyKey string
+}
+
+// SubmitQueueEvent calls POST /queues/{queue}/events, to submit a task to a named queue
+func (c *Client) SubmitQueueEvent(ctx context.Context, queue string, params *SubmitQueueEventParams, body *EventRequest) (*Submitted, error) {
+	path := "/queues/" + url.PathEscape(queue) + "/events"
+	query, header := url.Values{}, http.Header{}
+	if params != nil {
+		if params.Priority != "" {
+			query.Set("priority", params.Priority)
+		}
+		if params.Wait != "" {
+			query.Set("wait", params.Wait)
+		}
+		if params.IdempotencyKey != "" {
+			header.Set("Idempotency-Key", params.IdempotencyKey)
+		}
+	}
+	var payload any
+	if body != nil {
+		payload = body
+	}
+	resp, err := c.do(ctx, "POST", path, query, header, payload, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out Submitted
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SubmitQueueBatchParams are the query and header parameters of SubmitQueueBatch
+type SubmitQueueBatchParams struct {
+	// low, normal, high or a number, higher first; the body may set it per event
+	Priority string
+	// Deduplicates submissions, suffixed with the position of each event of a batch
+	IdempotencyKey string
+}
+
+// SubmitQueueBatch calls POST /queues/{queue}/events/batch, to submit up to 1000 tasks to a named queue, all or none
+func (c *Client) SubmitQueueBatch(ctx context.Context, queue string, params *SubmitQueueBatchParams, body []EventRequest) (*BatchResponse, error) {
+	path := "/queues/" + url.PathEscape(queue) + "/events/batch"
+	query, header := url.Values{}, http.Header{}
+	if params != nil {
+		if params.Priority != "" {
+			query.Set("priority", params.Priority)
+		}
+		if params.IdempotencyKey != "" {
+			header.Set("Idempotency-Key", params.IdempotencyKey)
+		}
+	}
+	resp, err := c.do(ctx, "POST", path, query, header, body, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out BatchResponse
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetQueueTask calls GET /queues/{queue}/events/{id}, to get the record of a task of a named queue
+func (c *Client) GetQueueTask(ctx context.Context, queue string, id int) (*TaskRecord, error) {
+	path := "/queues/" + url.PathEscape(queue) + "/events/" + url.PathEscape(strconv.Itoa(id))
+	resp, err := c.do(ctx, "GET", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out TaskRecord
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CancelQueueTask calls DELETE /queues/{queue}/events/{id}, to cancel a queued or running task of a named queue
+func (c *Client) CancelQueueTask(ctx context.Context, queue string, id int) (*Envelope, error) {
+	path := "/queues/" + url.PathEscape(queue) + "/events/" + url.PathEscape(strconv.Itoa(id))
+	resp, err := c.do(ctx, "DELETE", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out Envelope
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PurgeQueueTasksParams are the query and header parameters of PurgeQueueTasks
+type PurgeQueueTasksParams struct {
+	// key:value a task must carry, repeated for several labels
+	Label string
+	// Type of the tasks
+	Type string
+	// Tenant of the tasks
+	Tenant string
+	// UID of the task, when the server gives tasks one
+	Uid string
+	// RFC 3339 time, included
+	Since string
+	// RFC 3339 time, excluded
+	Until string
+	// Duration such as 1h, queued longer ago than that
+	OlderThan string
+	// Token of the preview answered without it, valid once for 5 minutes by default
+	Confirm string
+}
+
+// PurgeQueueTasks calls POST /queues/{queue}/purge, to drop the queued tasks of a named queue, those matching the filters when set
+func (c *Client) PurgeQueueTasks(ctx context.Context, queue string, params *PurgeQueueTasksParams) (*BulkConfirmation, error) {
+	path := "/queues/" + url.PathEscape(queue) + "/purge"
+	query, header := url.Values{}, http.Header{}
+	if params != nil {
+		if params.Label != "" {
+			query.Set("label", params.Label)
+		}
+		if params.Type != "" {
+			query.Set("type", params.Type)
+		}
+		if params.Tenant != "" {
+			query.Set("tenant", params.Tenant)
+		}
+		if params.Uid != "" {
+			query.Set("uid", params.Uid)
+		}
+		if params.Since != "" {
+			query.Set("since", params.Since)
+		}
+		if params.Until != "" {
+			query.Set("until", params.Until)
+		}
+		if params.OlderThan != "" {
+			query.Set("older_than", params.OlderThan)
+		}
+		if params.Confirm != "" {
+			query.Set("confirm", params.Confirm)
+		}
+	}
+	resp, err := c.do(ctx, "POST", path, query, header, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out BulkConfirmation
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetQueueUsageReportParams are the query and header parameters of GetQueueUsageReport
+type GetQueueUsageReportParams struct {
+	// Duration up to now the report covers, such as 24h or 7d, 24h by default; whole accounting periods are reported
+	Period string
+	// Comma-separated dimensions of the rows among queue, tenant and type, all of them by default
+	GroupBy string
+}
+
+// GetQueueUsageReport calls GET /queues/{queue}/reports/usage, to report the wall and CPU time of the attempts of a named queue
+func (c *Client) GetQueueUsageReport(ctx context.Context, queue string, params *GetQueueUsageReportParams) (*UsageReport, error) {
+	path := "/queues/" + url.PathEscape(queue) + "/reports/usage"
+	query, header := url.Values{}, http.Header{}
+	if params != nil {
+		if params.Period != "" {
+			query.Set("period", params.Period)
+		}
+		if params.GroupBy != "" {
+			query.Set("group_by", params.GroupBy)
+		}
+	}
+	resp, err := c.do(ctx, "GET", path, query, header, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out UsageReport
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetUsageReportParams are the query and header parameters of GetUsageReport
+type GetUsageReportParams struct {
+	// Duration up to now the report covers, such as 24h or 7d, 24h by default; whole accounting periods are reported
+	Period string
+	// Comma-separated dimensions of the rows among queue, tenant and type, all of them by default
+	GroupBy string
+}
+
+// GetUsageReport calls GET /reports/usage, to report the wall and CPU time of the attempts of every queue
+func (c *Client) GetUsageReport(ctx context.Context, params *GetUsageReportParams) (*UsageReport, error) {
+	path := "/reports/usage"
+	query, header := url.Values{}, http.Header{}
+	if params != nil {
+		if params.Period != "" {
+			query.Set("period", params.Period)
+		}
+		if params.GroupBy != "" {
+			query.Set("group_by", params.GroupBy)
+		}
+	}
+	resp, err := c.do(ctx, "GET", path, query, header, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out UsageReport
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListSchedulesParams are the query and header parameters of ListSchedules
+type ListSchedulesParams struct {
+	// Items per page, 100 by default and up to 1000
+	Limit string
+	// X-Next-Cursor of the previous page, passed with the same parameters
+	Cursor string
+}
+
+// ListSchedules calls GET /schedules, to list a page of the recurring tasks of the default pool, sorted by name
+func (c *Client) ListSchedules(ctx context.Context, params *ListSchedulesParams) ([]Schedule, error) {
+	path := "/schedules"
+	query, header := url.Values{}, http.Header{}
+	if params != nil {
+		if params.Limit != "" {
+			query.Set("limit", params.Limit)
+		}
+		if params.Cursor != "" {
+			query.Set("cursor", params.Cursor)
+		}
+	}
+	resp, err := c.do(ctx, "GET", path, query, header, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out []Schedule
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateSchedule calls POST /schedules, to add a recurring task to the default pool
+func (c *Client) CreateSchedule(ctx context.Context, body ScheduleRequest) (*Schedule, error) {
+	path := "/schedules"
+	resp, err := c.do(ctx, "POST", path, nil, nil, body, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out Schedule
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetSchedule calls GET /schedules/{name}, to get a recurring task of the default pool
+func (c *Client) GetSchedule(ctx context.Context, name string) (*Schedule, error) {
+	path := "/schedules/" + url.PathEscape(name)
+	resp, err := c.do(ctx, "GET", path, nil, nil, nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out Schedule
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PutSchedule calls PUT /schedules/{name}, to create or replace a recurring task of the default pool
+func (c *Client) PutSchedule(ctx context.Context, name string, body ScheduleRequest) (*Schedule, error) {
+	path := "/schedules/" + url.PathEscape(name)
+	resp, err := c.do(ctx, "PUT", path, nil, nil, body, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var out Schedule
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteSchedule calls DELETE /schedules/{name}, to stop and remove a recurring task of the default pool
+func (c *Client) DeleteSchedule(ctx context.Context, name string) error {
+	path := "/schedules/" + url.PathEscape(name)
+	resp, err := c.do(ctx, "DELETE", path, nil, nil, nil, "text/plain")
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,131 @@
+// Package apiclient is a Go client of the HTTP API of the worker pool,
+// generated from the OpenAPI document the server serves at /openapi.json.
+// Run go generate after changing the document
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client calls the API of one server
+type Client struct {
+	base string // server URL without a trailing slash
+	http *http.Client
+	key  string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends requests with hc instead of http.DefaultClient
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithAPIKey authenticates requests with key, for servers with auth keys
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.key = key
+	}
+}
+
+// New returns a client of the server at baseURL, such as
+// http://localhost:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{base: strings.TrimRight(baseURL, "/"), http: http.DefaultClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ResponseError is returned for responses with an error status. Body holds
+// the error the server described, its text when it answered with plain
+// text
+type ResponseError struct {
+	StatusCode int
+	Body       Error
+}
+
+func (e *ResponseError) Error() string {
+	msg := fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Body.Error != "" {
+		msg += ": " + e.Body.Error
+	}
+	for _, f := range e.Body.Fields {
+		msg += fmt.Sprintf("; %s: %s", f.Field, f.Message)
+	}
+	return msg
+}
+
+// do sends a request with an optional JSON body, returning the response
+// when its status is a success
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, header http.Header, body any, accept string) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("encoding the request body: %w", err)
+		}
+		r = bytes.NewReader(b)
+	}
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", accept)
+	if c.key != "" {
+		req.Header.Set("X-API-Key", c.key)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	re := &ResponseError{StatusCode: resp.StatusCode}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "application/json" || json.Unmarshal(data, &re.Body) != nil {
+		re.Body = Error{Error: strings.TrimSpace(string(data))}
+	}
+	return nil, re
+}
+
+// decodeJSON reads the JSON body of resp into out
+func decodeJSON(resp *http.Response, out any) error {
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding the response: %w", err)
+	}
+	return nil
+}
+
+// readText returns the text body of resp without its trailing newline
+func readText(resp *http.Response) (string, error) {
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	return strings.TrimSpace(string(b)), err
+}
@@ -0,0 +1,3 @@
+package apiclient
+
+//go:generate go run ./internal/gen -spec ../openapi.json -out client.gen.go
@@ -0,0 +1,499 @@
+// Command gen writes the Go client of package apiclient from the OpenAPI
+// document of the HTTP API. It supports the subset of OpenAPI 3 the
+// document uses: component schemas made of objects, arrays, string enums
+// and allOf, path, query and header parameters, JSON request bodies, and
+// JSON or text responses
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type document struct {
+	Paths      map[string]pathItem `json:"paths"`
+	Components struct {
+		Schemas       map[string]*schema      `json:"schemas"`
+		Parameters    map[string]*parameter   `json:"parameters"`
+		RequestBodies map[string]*requestBody `json:"requestBodies"`
+		Responses     map[string]*response    `json:"responses"`
+	} `json:"components"`
+}
+
+type pathItem struct {
+	Parameters []*parameter `json:"parameters"`
+	Get        *operation   `json:"get"`
+	Post       *operation   `json:"post"`
+	Put        *operation   `json:"put"`
+	Delete     *operation   `json:"delete"`
+}
+
+type operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	Parameters  []*parameter         `json:"parameters"`
+	RequestBody *requestBody         `json:"requestBody"`
+	Responses   map[string]*response `json:"responses"`
+}
+
+type parameter struct {
+	Ref         string  `json:"$ref"`
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required"`
+	Description string  `json:"description"`
+	Schema      *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Ref      string               `json:"$ref"`
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Ref         string               `json:"$ref"`
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref         string     `json:"$ref"`
+	Type        string     `json:"type"`
+	Format      string     `json:"format"`
+	Description string     `json:"description"`
+	Enum        []string   `json:"enum"`
+	Items       *schema    `json:"items"`
+	Properties  properties `json:"properties"`
+	Required    []string   `json:"required"`
+	AllOf       []*schema  `json:"allOf"`
+	GoType      string     `json:"x-go-type"`
+	// AdditionalProperties is false, or the schema of the values of a map
+	AdditionalProperties json.RawMessage `json:"additionalProperties"`
+}
+
+// properties keeps the order of the properties in the document, which
+// becomes the order of the struct fields
+type properties []property
+
+type property struct {
+	name   string
+	schema *schema
+}
+
+func (ps *properties) UnmarshalJSON(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		s := new(schema)
+		if err := dec.Decode(s); err != nil {
+			return err
+		}
+		*ps = append(*ps, property{name: tok.(string), schema: s})
+	}
+	return nil
+}
+
+// refName returns the component named by a $ref
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// initialisms are written in capitals in Go names
+var initialisms = map[string]string{"id": "ID", "ids": "IDs", "url": "URL", "ttl": "TTL", "api": "API", "http": "HTTP"}
+
+// goName turns a JSON or header name into an exported Go name
+func goName(s string) string {
+	var b strings.Builder
+	for part := range strings.FieldsFuncSeq(s, func(r rune) bool { return r == '_' || r == '-' }) {
+		if v, ok := initialisms[strings.ToLower(part)]; ok {
+			b.WriteString(v)
+			continue
+		}
+		r := []rune(part)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	return b.String()
+}
+
+// lowerFirst turns a summary into the end of a doc comment sentence
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+type generator struct {
+	doc     *document
+	buf     bytes.Buffer
+	imports map[string]bool
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// comment writes text as a comment at the given indentation
+func (g *generator) comment(indent, text string) {
+	for line := range strings.SplitSeq(text, "\n") {
+		g.printf("%s// %s\n", indent, line)
+	}
+}
+
+// goType returns the Go type of s. Optional fields get pointers where the
+// zero value is a valid one, so omitempty leaves them out
+func (g *generator) goType(s *schema, optional bool) string {
+	if s.Ref != "" {
+		name := refName(s.Ref)
+		if t := g.doc.Components.Schemas[name]; optional && t.Type == "object" || optional && t.AllOf != nil {
+			return "*" + name
+		}
+		return name
+	}
+	if s.GoType != "" {
+		if pkg, _, ok := strings.Cut(s.GoType, "."); ok {
+			if pkg == "json" {
+				pkg = "encoding/json"
+			}
+			g.imports[pkg] = true
+		}
+		return s.GoType
+	}
+	switch s.Type {
+	case "string":
+		if s.Format == "date-time" {
+			g.imports["time"] = true
+			if optional {
+				return "*time.Time"
+			}
+			return "time.Time"
+		}
+		return "string"
+	case "integer":
+		if s.Format == "int64" {
+			return "int64"
+		}
+		return "int"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "[]" + g.goType(s.Items, false)
+	case "object":
+		if len(s.AdditionalProperties) > 0 && s.AdditionalProperties[0] == '{' {
+			var v schema
+			if err := json.Unmarshal(s.AdditionalProperties, &v); err != nil {
+				log.Fatal(err)
+			}
+			return "map[string]" + g.goType(&v, false)
+		}
+	}
+	log.Fatalf("unsupported schema %+v", s)
+	return ""
+}
+
+func (g *generator) schemas() {
+	names := make([]string, 0, len(g.doc.Components.Schemas))
+	for name := range g.doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := g.doc.Components.Schemas[name]
+		if s.Description != "" {
+			g.comment("", name+" is "+lowerFirst(s.Description))
+		} else {
+			g.printf("// %s is the schema of the same name\n", name)
+		}
+		switch {
+		case s.Type == "string" && len(s.Enum) > 0:
+			g.printf("type %s string\n\n", name)
+			g.printf("// %s values\nconst (\n", name)
+			for _, v := range s.Enum {
+				g.printf("\t%s%s %s = %q\n", name, goName(v), name, v)
+			}
+			g.printf(")\n\n")
+		case s.Type == "array":
+			g.printf("type %s %s\n\n", name, g.goType(s.Items, false))
+		default:
+			g.printf("type %s struct {\n", name)
+			parts := s.AllOf
+			if parts == nil {
+				parts = []*schema{s}
+			}
+			for _, part := range parts {
+				if part.Ref != "" {
+					g.printf("\t%s\n", refName(part.Ref))
+					continue
+				}
+				g.fields(part)
+			}
+			g.printf("}\n\n")
+		}
+	}
+}
+
+func (g *generator) fields(s *schema) {
+	for _, p := range s.Properties {
+		required := slices.Contains(s.Required, p.name)
+		tag := p.name
+		if !required {
+			tag += ",omitempty"
+		}
+		desc := p.schema.Description
+		if p.schema.Type == "string" && len(p.schema.Enum) > 0 {
+			desc = strings.TrimSpace(desc + " One of " + strings.Join(p.schema.Enum, ", "))
+		}
+		if desc != "" {
+			g.comment("\t", desc)
+		}
+		g.printf("\t%s %s `json:%q`\n", goName(p.name), g.goType(p.schema, !required), tag)
+	}
+}
+
+// op is an operation with its references resolved
+type op struct {
+	method, path string
+	*operation
+	pathParams, otherParams []*parameter
+	body                    *requestBody
+	result                  *schema // JSON response, nil for text
+	text                    bool
+}
+
+func (g *generator) resolve(method, path string, item pathItem, o *operation) op {
+	res := op{method: method, path: path, operation: o}
+	for _, p := range append(slices.Clone(item.Parameters), o.Parameters...) {
+		if p.Ref != "" {
+			p = g.doc.Components.Parameters[refName(p.Ref)]
+		}
+		if p.In == "path" {
+			res.pathParams = append(res.pathParams, p)
+		} else {
+			res.otherParams = append(res.otherParams, p)
+		}
+	}
+	if b := o.RequestBody; b != nil {
+		if b.Ref != "" {
+			b = g.doc.Components.RequestBodies[refName(b.Ref)]
+		}
+		res.body = b
+	}
+	codes := make([]string, 0, len(o.Responses))
+	for code := range o.Responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		if !strings.HasPrefix(code, "2") {
+			continue
+		}
+		r := o.Responses[code]
+		if r.Ref != "" {
+			r = g.doc.Components.Responses[refName(r.Ref)]
+		}
+		if mt, ok := r.Content["application/json"]; ok {
+			res.result = mt.Schema
+		} else if _, ok := r.Content["text/plain"]; ok {
+			res.text = true
+		}
+		break
+	}
+	return res
+}
+
+func (g *generator) operations() {
+	paths := make([]string, 0, len(g.doc.Paths))
+	for path := range g.doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		item := g.doc.Paths[path]
+		for _, m := range []struct {
+			method string
+			o      *operation
+		}{{"GET", item.Get}, {"POST", item.Post}, {"PUT", item.Put}, {"DELETE", item.Delete}} {
+			if m.o != nil {
+				g.operation(g.resolve(m.method, path, item, m.o))
+			}
+		}
+	}
+}
+
+func (g *generator) operation(o op) {
+	name := o.OperationID
+	if len(o.otherParams) > 0 {
+		g.printf("// %sParams are the query and header parameters of %s\n", name, name)
+		g.printf("type %sParams struct {\n", name)
+		for _, p := range o.otherParams {
+			if p.Description != "" {
+				g.comment("\t", p.Description)
+			}
+			g.printf("\t%s %s\n", goName(p.Name), g.goType(p.Schema, false))
+		}
+		g.printf("}\n\n")
+	}
+
+	args := []string{"ctx context.Context"}
+	for _, p := range o.pathParams {
+		args = append(args, p.Name+" "+g.goType(p.Schema, false))
+	}
+	if len(o.otherParams) > 0 {
+		args = append(args, "params *"+name+"Params")
+	}
+	if o.body != nil {
+		t := g.goType(o.body.Content["application/json"].Schema, false)
+		if !o.body.Required && !strings.HasPrefix(t, "[]") {
+			t = "*" + t
+		}
+		args = append(args, "body "+t)
+	}
+	result, zero := "", ""
+	switch {
+	case o.result != nil:
+		result = g.goType(o.result, false)
+		zero = "nil"
+		if !strings.HasPrefix(result, "[]") {
+			result = "*" + result
+		}
+	case o.text:
+		result, zero = "string", `""`
+	}
+
+	g.printf("// %s calls %s %s, to %s\n", name, o.method, o.path, lowerFirst(o.Summary))
+	if result != "" {
+		g.printf("func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(args, ", "), result)
+	} else {
+		g.printf("func (c *Client) %s(%s) error {\n", name, strings.Join(args, ", "))
+	}
+
+	// Path
+	path := fmt.Sprintf("%q", o.path)
+	for _, p := range o.pathParams {
+		value := p.Name
+		if g.goType(p.Schema, false) == "int" {
+			g.imports["strconv"] = true
+			value = "strconv.Itoa(" + p.Name + ")"
+		}
+		path = strings.Replace(path, "{"+p.Name+"}", `" + url.PathEscape(`+value+`) + "`, 1)
+	}
+	path = strings.TrimSuffix(strings.TrimPrefix(path, `"" + `), ` + ""`)
+	g.printf("\tpath := %s\n", path)
+
+	// Query and headers
+	query, header := "nil", "nil"
+	if len(o.otherParams) > 0 {
+		g.printf("\tquery, header := url.Values{}, http.Header{}\n")
+		g.printf("\tif params != nil {\n")
+		for _, p := range o.otherParams {
+			field := "params." + goName(p.Name)
+			switch p.In {
+			case "query":
+				g.printf("\t\tif %s != \"\" {\n\t\t\tquery.Set(%q, %s)\n\t\t}\n", field, p.Name, field)
+			case "header":
+				g.printf("\t\tif %s != \"\" {\n\t\t\theader.Set(%q, %s)\n\t\t}\n", field, p.Name, field)
+			}
+		}
+		g.printf("\t}\n")
+		query, header = "query", "header"
+	}
+	body := "nil"
+	if o.body != nil {
+		body = "body"
+		if a := args[len(args)-1]; strings.HasPrefix(a, "body *") {
+			g.printf("\tvar payload any\n\tif body != nil {\n\t\tpayload = body\n\t}\n")
+			body = "payload"
+		}
+	}
+	accept := "text/plain"
+	if o.result != nil {
+		accept = "application/json"
+	}
+	g.printf("\tresp, err := c.do(ctx, %q, path, %s, %s, %s, %q)\n", o.method, query, header, body, accept)
+
+	switch {
+	case o.result != nil:
+		g.printf("\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		g.printf("\tvar out %s\n", strings.TrimPrefix(result, "*"))
+		g.printf("\tif err := decodeJSON(resp, &out); err != nil {\n\t\treturn nil, err\n\t}\n")
+		if strings.HasPrefix(result, "*") {
+			g.printf("\treturn &out, nil\n")
+		} else {
+			g.printf("\treturn out, nil\n")
+		}
+	case o.text:
+		g.printf("\tif err != nil {\n\t\treturn %s, err\n\t}\n", zero)
+		g.printf("\treturn readText(resp)\n")
+	default:
+		g.printf("\tif err != nil {\n\t\treturn err\n\t}\n")
+		g.printf("\treturn resp.Body.Close()\n")
+	}
+	g.printf("}\n\n")
+}
+
+func main() {
+	specPath := flag.String("spec", "openapi.json", "OpenAPI document")
+	out := flag.String("out", "client.gen.go", "Go file to write")
+	pkg := flag.String("package", "apiclient", "package of the generated file")
+	flag.Parse()
+
+	b, err := os.ReadFile(*specPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var doc document
+	if err := json.Unmarshal(b, &doc); err != nil {
+		log.Fatalf("parsing %s: %v", *specPath, err)
+	}
+
+	g := &generator{doc: &doc, imports: map[string]bool{"context": true, "net/http": true, "net/url": true}}
+	g.schemas()
+	g.operations()
+
+	var file bytes.Buffer
+	fmt.Fprintf(&file, "// Code generated by apiclient/internal/gen from %s. DO NOT EDIT.\n\n", strings.TrimPrefix(*specPath, "../"))
+	fmt.Fprintf(&file, "package %s\n\nimport (\n", *pkg)
+	imports := make([]string, 0, len(g.imports))
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	for _, imp := range imports {
+		fmt.Fprintf(&file, "\t%q\n", imp)
+	}
+	file.WriteString(")\n\n")
+	file.Write(g.buf.Bytes())
+
+	src, err := format.Source(file.Bytes())
+	if err != nil {
+		log.Fatalf("formatting the generated code: %v\n%s", err, file.Bytes())
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,397 @@
+package go_playground
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArchiveSink stores the files written by the archiver
+type ArchiveSink interface {
+	// Put stores data under name, a slash separated path
+	Put(ctx context.Context, name string, data []byte) error
+}
+
+// ArchiveReader is implemented by sinks whose files can be read back, to
+// replay archived tasks
+type ArchiveReader interface {
+	// List returns the names of the files starting with prefix, sorted
+	List(ctx context.Context, prefix string) ([]string, error)
+	Get(ctx context.Context, name string) ([]byte, error)
+}
+
+// Archive configures the archiving of finished task records. Records are
+// buffered and written as newline-delimited JSON files, one ArchiveRecord
+// per line, each time Interval elapses or MaxRecords are buffered. Files
+// that cannot be stored are tried again with the next one
+type Archive struct {
+	Sink       ArchiveSink
+	Interval   time.Duration // how often a file is rolled, 1m by default
+	MaxRecords int           // records per file at most, 10000 by default
+	Prefix     string        // prepended to file names, such as "tasks/"
+	Compress   bool          // gzip the files, adding .gz to their names
+	// MaxBuffered bounds the records kept while the sink fails, the oldest
+	// being dropped past it. 10 files worth by default
+	MaxBuffered int
+	// Encryption encrypts the payload, checkpoint and output of the
+	// records with data keys of this provider, stored in the clear when nil
+	Encryption KeyProvider
+	// PayloadCompression compresses the payload, checkpoint and output of
+	// the records before they are encrypted. Mostly worth it together with
+	// Encryption, as Compress gzips the files otherwise
+	PayloadCompression *Compression
+}
+
+// archiveTimeLayout starts the base name of archive files
+const archiveTimeLayout = "20060102T150405Z"
+
+// DefaultArchive rolls a file every minute
+var DefaultArchive = Archive{Interval: time.Minute, MaxRecords: 10_000}
+
+// ArchiveRecord is one line of an archive file: the final record of a task
+// with the time it waited in the queue and spent running, in milliseconds
+type ArchiveRecord struct {
+	TaskRecord
+	WaitMillis int64 `json:"wait_ms"`
+	RunMillis  int64 `json:"run_ms"`
+}
+
+func newArchiveRecord(rec TaskRecord) ArchiveRecord {
+	ar := ArchiveRecord{TaskRecord: rec}
+	if rec.StartedAt != nil {
+		ar.WaitMillis = rec.StartedAt.Sub(rec.QueuedAt).Milliseconds()
+		if rec.FinishedAt != nil {
+			ar.RunMillis = rec.FinishedAt.Sub(*rec.StartedAt).Milliseconds()
+		}
+	}
+	return ar
+}
+
+// DirSink writes archive files below a local directory
+type DirSink struct {
+	Dir string
+}
+
+// Put implements ArchiveSink. The file appears complete or not at all
+func (s DirSink) Put(_ context.Context, name string, data []byte) error {
+	file := filepath.Join(s.Dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// List implements ArchiveReader, leaving out files still being written
+func (s DirSink) List(_ context.Context, prefix string) ([]string, error) {
+	var names []string
+	root := filepath.Join(s.Dir, filepath.FromSlash(path.Dir(prefix)))
+	err := filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(file, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Dir, file)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	slices.Sort(names)
+	return names, err
+}
+
+// Get implements ArchiveReader
+func (s DirSink) Get(_ context.Context, name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.Dir, filepath.FromSlash(name)))
+}
+
+// archiver buffers finished records and rolls them into files
+type archiver struct {
+	cfg    Archive
+	queue  string         // directory of the files, named after the pool
+	id     string         // tells apart the files of several processes
+	cipher *payloadCipher // nil without Archive.Encryption
+	// compressor is nil without Archive.PayloadCompression
+	compressor *payloadCompressor
+
+	mu      sync.Mutex
+	pending []ArchiveRecord
+	removed int // records ever taken off the front of pending
+	seq     int
+	full    chan struct{} // signalled when MaxRecords are pending
+	done    chan struct{} // closed by close to stop run
+	stopped chan struct{} // closed when run returns
+}
+
+func newArchiver(cfg Archive) *archiver {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultArchive.Interval
+	}
+	if cfg.MaxRecords <= 0 {
+		cfg.MaxRecords = DefaultArchive.MaxRecords
+	}
+	if cfg.MaxBuffered <= 0 {
+		cfg.MaxBuffered = 10 * cfg.MaxRecords
+	}
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	a := &archiver{
+		cfg:     cfg,
+		queue:   "default",
+		id:      hex.EncodeToString(b),
+		full:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if cfg.Encryption != nil {
+		a.cipher = newPayloadCipher(cfg.Encryption)
+	}
+	if cfg.PayloadCompression != nil {
+		a.compressor = newPayloadCompressor(*cfg.PayloadCompression)
+	}
+	return a
+}
+
+// archiveRecord queues the final record of a task for the next file
+func (p *WorkerPool) archiveRecord(rec TaskRecord) {
+	a := p.archiver
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pending = append(a.pending, newArchiveRecord(rec))
+	if over := len(a.pending) - a.cfg.MaxBuffered; over > 0 {
+		a.pending = a.pending[over:]
+		a.removed += over
+		p.metrics.archiveDropped.Add(float64(over))
+	}
+	// Once per file worth, so a failing sink is not retried on every record
+	if len(a.pending)%a.cfg.MaxRecords == 0 {
+		signal(a.full)
+	}
+}
+
+// runArchiver rolls files until the archiver is closed, then writes what
+// is left
+func (p *WorkerPool) runArchiver() {
+	a := p.archiver
+	defer close(a.stopped)
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-a.full:
+		case <-a.done:
+			for p.rollArchive(context.Background()) {
+			}
+			return
+		}
+		for p.rollArchive(context.Background()) {
+		}
+	}
+}
+
+// rollArchive writes one file of at most MaxRecords records. It reports
+// whether more records are waiting, false as well when the sink failed
+func (p *WorkerPool) rollArchive(ctx context.Context) bool {
+	a := p.archiver
+	a.mu.Lock()
+	n := min(len(a.pending), a.cfg.MaxRecords)
+	batch := a.pending[:n:n]
+	start := a.removed
+	if n > 0 {
+		a.seq++
+	}
+	seq := a.seq
+	a.mu.Unlock()
+	if n == 0 {
+		return false
+	}
+
+	if a.compressor != nil || a.cipher != nil {
+		sealed := make([]ArchiveRecord, len(batch))
+		for i, rec := range batch {
+			if a.compressor != nil {
+				a.compressor.compressRecord(&rec)
+			}
+			if a.cipher != nil {
+				if err := a.cipher.sealRecord(&rec); err != nil {
+					p.log.Error("archive: encrypting records", "error", err)
+					return false
+				}
+			}
+			sealed[i] = rec
+		}
+		batch = sealed
+	}
+	data, err := encodeArchive(batch, a.cfg.Compress)
+	if err != nil {
+		p.log.Error("archive: encoding records", "error", err)
+		return false
+	}
+	now := time.Now().UTC()
+	name := fmt.Sprintf("%s%s/%s/%s-%s-%06d.ndjson", a.cfg.Prefix, a.queue, now.Format("2006/01/02"),
+		now.Format(archiveTimeLayout), a.id, seq)
+	if a.cfg.Compress {
+		name += ".gz"
+	}
+	if err := a.cfg.Sink.Put(ctx, name, data); err != nil {
+		p.metrics.archiveFailures.Inc()
+		p.log.Error("archive: storing file", "name", name, "records", n, "error", err)
+		return false
+	}
+
+	a.mu.Lock()
+	// Records dropped meanwhile may have been part of the batch
+	if left := n - (a.removed - start); left > 0 {
+		a.pending = a.pending[left:]
+		a.removed += left
+	}
+	more := len(a.pending) > 0
+	a.mu.Unlock()
+	p.metrics.archivedRecords.Add(float64(n))
+	p.metrics.archiveFiles.Inc()
+	p.log.Debug("archive file written", "name", name, "records", n)
+	return more
+}
+
+// encodeArchive writes records as newline-delimited JSON
+func encodeArchive(records []ArchiveRecord, compress bool) ([]byte, error) {
+	var buf bytes.Buffer
+	var enc *json.Encoder
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(&buf)
+		enc = json.NewEncoder(zw)
+	} else {
+		enc = json.NewEncoder(&buf)
+	}
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return nil, err
+		}
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// sealRecord encrypts the payload, checkpoint and output of rec
+func (c *payloadCipher) sealRecord(rec *ArchiveRecord) (err error) {
+	if err := c.sealTask(&rec.Task); err != nil {
+		return err
+	}
+	rec.Output, err = c.seal("output", rec.Output)
+	return err
+}
+
+// openRecord decrypts what sealRecord encrypted
+func (c *payloadCipher) openRecord(rec *ArchiveRecord) (err error) {
+	if err := c.openTask(&rec.Task); err != nil {
+		return err
+	}
+	rec.Output, err = c.open("output", rec.Output)
+	return err
+}
+
+// compressRecord compresses the payload, checkpoint and output of rec
+func (c *payloadCompressor) compressRecord(rec *ArchiveRecord) {
+	c.compressTask(&rec.Task)
+	rec.Output = c.compress(rec.Output)
+}
+
+// decompressRecord decompresses what compressRecord compressed
+func decompressRecord(rec *ArchiveRecord) (err error) {
+	if err := decompressTask(&rec.Task); err != nil {
+		return err
+	}
+	rec.Output, err = decompress("output", rec.Output)
+	return err
+}
+
+// decodeArchive reads the records of an archive file, gunzipping it when
+// its name ends with .gz
+func decodeArchive(name string, data []byte) ([]ArchiveRecord, error) {
+	var r io.Reader = bytes.NewReader(data)
+	if strings.HasSuffix(name, ".gz") {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	var records []ArchiveRecord
+	dec := json.NewDecoder(r)
+	for {
+		var rec ArchiveRecord
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, rec)
+	}
+}
+
+// archiveFileTime returns the time a file was rolled, from its name
+func archiveFileTime(name string) (time.Time, bool) {
+	base := path.Base(name)
+	if len(base) < len(archiveTimeLayout) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(archiveTimeLayout, base[:len(archiveTimeLayout)])
+	return t, err == nil
+}
+
+// closeArchiver writes the records still buffered, waiting until ctx is
+// done at most
+func (p *WorkerPool) closeArchiver(ctx context.Context) error {
+	a := p.archiver
+	a.mu.Lock()
+	select {
+	case <-a.done:
+	default:
+		close(a.done)
+	}
+	a.mu.Unlock()
+	select {
+	case <-a.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,103 @@
+package go_playground
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Sink stores archive files in a bucket of any service speaking the S3
+// API, through the minio-go client. Google Cloud Storage works through its
+// XML API with HMAC keys, the endpoint https://storage.googleapis.com and
+// the region "auto"
+type S3Sink struct {
+	Endpoint  string // such as https://s3.eu-west-1.amazonaws.com
+	Region    string // such as eu-west-1
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client // its Transport is used, http.DefaultTransport when nil
+}
+
+// client returns a client of the endpoint addressing the bucket by path,
+// which every S3 service accepts
+func (s S3Sink) client() (*minio.Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/"))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("s3: endpoint %q is not a URL", s.Endpoint)
+	}
+	if u.Path != "" {
+		return nil, fmt.Errorf("s3: endpoint %q has a path", s.Endpoint)
+	}
+	transport := http.DefaultTransport
+	if s.Client != nil && s.Client.Transport != nil {
+		transport = s.Client.Transport
+	}
+	return minio.New(u.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(s.AccessKey, s.SecretKey, ""),
+		Secure:       u.Scheme == "https",
+		Region:       s.Region,
+		Transport:    transport,
+		BucketLookup: minio.BucketLookupPath,
+	})
+}
+
+// Put implements ArchiveSink
+func (s S3Sink) Put(ctx context.Context, name string, data []byte) error {
+	c, err := s.client()
+	if err != nil {
+		return err
+	}
+	contentType := "application/x-ndjson"
+	if strings.HasSuffix(name, ".gz") {
+		contentType = "application/gzip"
+	}
+	_, err = c.PutObject(ctx, s.Bucket, name, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return fmt.Errorf("s3: storing %s: %w", name, err)
+	}
+	return nil
+}
+
+// List implements ArchiveReader
+func (s S3Sink) List(ctx context.Context, prefix string) ([]string, error) {
+	c, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for obj := range c.ListObjects(ctx, s.Bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("s3: listing %s: %w", prefix, obj.Err)
+		}
+		names = append(names, obj.Key)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// Get implements ArchiveReader
+func (s S3Sink) Get(ctx context.Context, name string) ([]byte, error) {
+	c, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+	obj, err := c.GetObject(ctx, s.Bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("s3: reading %s: %w", name, err)
+	}
+	defer obj.Close()
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, fmt.Errorf("s3: reading %s: %w", name, err)
+	}
+	return data, nil
+}
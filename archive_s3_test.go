@@ -0,0 +1,154 @@
+package go_playground
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 serves the object calls of S3Sink on a single bucket
+type fakeS3 struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/eu-west-1/s3/aws4_request") {
+		f.t.Errorf("%s %s: Authorization %q, want a SigV4 signature of AKID in eu-west-1", r.Method, r.URL, auth)
+		http.Error(w, "bad signature", http.StatusForbidden)
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != "archive" {
+		http.Error(w, "no such bucket", http.StatusNotFound)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPut:
+		body, err := readS3Body(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = body
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodGet && key == "":
+		type content struct{ Key string }
+		var res struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Name     string
+			Prefix   string
+			KeyCount int
+			Contents []content
+		}
+		res.Name, res.Prefix = bucket, r.URL.Query().Get("prefix")
+		for k := range f.objects {
+			if strings.HasPrefix(k, res.Prefix) {
+				res.Contents = append(res.Contents, content{k})
+			}
+		}
+		res.KeyCount = len(res.Contents)
+		_ = xml.NewEncoder(w).Encode(res)
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2026 15:04:05 GMT")
+		_, _ = w.Write(data)
+	default:
+		http.Error(w, "unexpected call", http.StatusMethodNotAllowed)
+	}
+}
+
+// readS3Body reads a PUT body, decoding it when streamed in signed chunks
+func readS3Body(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var out bytes.Buffer
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		n, err := strconv.ParseInt(size, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("chunk size %q: %w", size, err)
+		}
+		if n == 0 {
+			return out.Bytes(), nil
+		}
+		if _, err := io.CopyN(&out, br, n); err != nil {
+			return nil, err
+		}
+		if _, err := br.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func TestS3SinkPutListGet(t *testing.T) {
+	fake := &fakeS3{t: t, objects: make(map[string][]byte)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	s := S3Sink{Endpoint: srv.URL, Region: "eu-west-1", Bucket: "archive", AccessKey: "AKID", SecretKey: "secret"}
+	ctx := context.Background()
+
+	files := map[string]string{
+		"2026/01/02/records-1.ndjson.gz": "one",
+		"2026/01/02/records 2.ndjson":    "two",
+		"2026/01/03/records-3.ndjson":    "three",
+	}
+	for name, data := range files {
+		if err := s.Put(ctx, name, []byte(data)); err != nil {
+			t.Fatalf("Put(%s): %v", name, err)
+		}
+	}
+
+	names, err := s.List(ctx, "2026/01/02/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if want := []string{"2026/01/02/records 2.ndjson", "2026/01/02/records-1.ndjson.gz"}; !slices.Equal(names, want) {
+		t.Errorf("List = %q, want %q", names, want)
+	}
+	for name, want := range files {
+		data, err := s.Get(ctx, name)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", name, err)
+		}
+		if string(data) != want {
+			t.Errorf("Get(%s) = %q, want %q", name, data, want)
+		}
+	}
+	if _, err := s.Get(ctx, "missing"); err == nil {
+		t.Error("Get of a missing object succeeded")
+	}
+}
+
+func TestS3SinkRejectsEndpointsWithPaths(t *testing.T) {
+	s := S3Sink{Endpoint: "https://example.com/s3", Bucket: "archive"}
+	if err := s.Put(context.Background(), "f", nil); err == nil {
+		t.Error("Put accepted an endpoint with a path")
+	}
+}
@@ -0,0 +1,51 @@
+package go_playground
+
+import (
+	"context"
+	"time"
+)
+
+// attemptValues carries what handlers reach through their context during
+// an attempt: its output, result, progress, checkpoint, logs, Once scope,
+// worker state and propagated headers. Holding them in one value saves a context and a slot
+// allocation per value and attempt
+type attemptValues struct {
+	context.Context
+	output     string
+	result     resultSlot
+	progress   ProgressReporter
+	checkpoint checkpointSlot
+	logs       *taskLogs
+	once       *onceScope
+	state      any
+	hasState   bool
+	headers    map[string]string
+	cpu        time.Duration // spent by the handler, see WithUsageAccounting
+}
+
+// Value returns the attempt slots, deferring other keys to the parent
+func (c *attemptValues) Value(key any) any {
+	switch key.(type) {
+	case outputKey:
+		return &c.output
+	case resultKey:
+		return &c.result
+	case progressKey:
+		return &c.progress
+	case checkpointKey:
+		return &c.checkpoint
+	case taskLogKey:
+		return c.logs
+	case onceKey:
+		return c.once
+	case headersKey:
+		if c.headers != nil {
+			return c.headers
+		}
+	case workerStateKey:
+		if c.hasState {
+			return c.state
+		}
+	}
+	return c.Context.Value(key)
+}
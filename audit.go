@@ -0,0 +1,288 @@
+package go_playground
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Audited actions
+const (
+	AuditPause            = "pause"
+	AuditResume           = "resume"
+	AuditResize           = "resize"
+	AuditFlush            = "flush"
+	AuditReplay           = "replay"
+	AuditImport           = "import"
+	AuditChaos            = "chaos"
+	AuditPurgeDeadLetters = "purge_deadletters"
+	AuditRetryDeadLetter  = "retry_deadletter"
+	AuditPutSchedule      = "put_schedule"
+	AuditDeleteSchedule   = "delete_schedule"
+	AuditReload           = "reload"
+	AuditCancelTasks      = "cancel_tasks"
+	AuditRetryTasks       = "retry_tasks"
+	AuditPurgeTasks       = "purge_tasks"
+	AuditRecover          = "recover"
+)
+
+// AuditEntry records an administrative action
+type AuditEntry struct {
+	ID      int64          `json:"id"` // assigned by the log, increasing
+	Time    time.Time      `json:"time"`
+	Actor   string         `json:"actor,omitempty"`  // authenticated client, empty on an open server
+	Remote  string         `json:"remote,omitempty"` // address of the client, empty for actions of the server itself
+	Action  string         `json:"action"`
+	Queue   string         `json:"queue,omitempty"`
+	Details map[string]any `json:"details,omitempty"` // parameters and outcome of the action
+	Error   string         `json:"error,omitempty"`   // set when the action failed part way
+}
+
+// AuditQuery selects audit entries, zero fields matching all
+type AuditQuery struct {
+	Since  time.Time
+	Until  time.Time
+	Action string
+	Actor  string
+	Queue  string
+	Limit  int // newest entries returned at most, all when zero
+}
+
+func (q AuditQuery) matches(e AuditEntry) bool {
+	return (q.Since.IsZero() || !e.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || e.Time.Before(q.Until)) &&
+		(q.Action == "" || e.Action == q.Action) &&
+		(q.Actor == "" || e.Actor == q.Actor) &&
+		(q.Queue == "" || e.Queue == q.Queue)
+}
+
+// AuditLog stores audit entries, append only
+type AuditLog interface {
+	// Append stores e, setting its ID
+	Append(e *AuditEntry) error
+	// Query returns the matching entries, oldest first
+	Query(q AuditQuery) ([]AuditEntry, error)
+}
+
+// limitEntries keeps the newest limit entries
+func limitEntries(entries []AuditEntry, limit int) []AuditEntry {
+	if limit > 0 && len(entries) > limit {
+		return entries[len(entries)-limit:]
+	}
+	return entries
+}
+
+// MemoryAuditLog keeps the latest audit entries in memory, for tests and
+// servers whose audit trail may be lost on restart
+type MemoryAuditLog struct {
+	max int
+
+	mu      sync.Mutex
+	entries []AuditEntry
+	nextID  int64
+}
+
+// NewMemoryAuditLog returns a log keeping the last max entries, all when
+// max is zero
+func NewMemoryAuditLog(max int) *MemoryAuditLog {
+	return &MemoryAuditLog{max: max}
+}
+
+// Append stores e, dropping the oldest entry when the log is full
+func (l *MemoryAuditLog) Append(e *AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.nextID++
+	e.ID = l.nextID
+	l.entries = append(l.entries, *e)
+	if l.max > 0 && len(l.entries) > l.max {
+		l.entries = slices.Delete(l.entries, 0, len(l.entries)-l.max)
+	}
+	return nil
+}
+
+// Query returns the matching entries, oldest first
+func (l *MemoryAuditLog) Query(q AuditQuery) ([]AuditEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []AuditEntry
+	for _, e := range l.entries {
+		if q.matches(e) {
+			out = append(out, e)
+		}
+	}
+	return limitEntries(out, q.Limit), nil
+}
+
+// FileAuditLog appends audit entries to a file as JSON lines, synced to
+// disk before Append returns. The file is only ever appended to
+type FileAuditLog struct {
+	mu     sync.Mutex
+	f      *os.File
+	nextID int64
+}
+
+// OpenFileAuditLog opens or creates the audit file at path, numbering new
+// entries after those it holds
+func OpenFileAuditLog(path string) (*FileAuditLog, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	l := &FileAuditLog{f: f}
+	err = l.scan(func(e AuditEntry) { l.nextID = max(l.nextID, e.ID) })
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// scan decodes the entries of the file in order
+func (l *FileAuditLog) scan(fn func(AuditEntry)) error {
+	sc := bufio.NewScanner(io.NewSectionReader(l.f, 0, math.MaxInt64))
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e AuditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return fmt.Errorf("audit log line %d: %w", line, err)
+		}
+		fn(e)
+	}
+	return sc.Err()
+}
+
+// Append writes e as one line and syncs the file
+func (l *FileAuditLog) Append(e *AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e.ID = l.nextID + 1
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := l.f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("writing audit entry: %w", err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return fmt.Errorf("syncing audit log: %w", err)
+	}
+	l.nextID = e.ID
+	return nil
+}
+
+// Query reads the file for the matching entries, oldest first
+func (l *FileAuditLog) Query(q AuditQuery) ([]AuditEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []AuditEntry
+	err := l.scan(func(e AuditEntry) {
+		if q.matches(e) {
+			out = append(out, e)
+		}
+	})
+	return limitEntries(out, q.Limit), err
+}
+
+// Close closes the file
+func (l *FileAuditLog) Close() error {
+	return l.f.Close()
+}
+
+// WithAuditLog records the administrative actions taken through the API in
+// l, queryable at GET /admin/audit
+func WithAuditLog(l AuditLog) ServerOption {
+	return func(s *Server) {
+		s.auditLog = l
+	}
+}
+
+// Audit records an action taken outside of the API, such as a
+// configuration reload, in the audit log if any
+func (s *Server) Audit(e AuditEntry) {
+	if s.auditLog == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if err := s.auditLog.Append(&e); err != nil {
+		s.pool.log.Error("recording audit entry", "action", e.Action, "error", err)
+	}
+}
+
+// audit records an action requested by r on pool p
+func (s *Server) audit(r *http.Request, p *WorkerPool, action string, details map[string]any, err error) {
+	if s.auditLog == nil {
+		return
+	}
+	e := AuditEntry{
+		Actor:   ClientID(r.Context()),
+		Remote:  clientIP(r),
+		Action:  action,
+		Queue:   p.Name(),
+		Details: details,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	s.Audit(e)
+}
+
+// auditResponse is the body of GET /admin/audit
+type auditResponse struct {
+	Entries []AuditEntry `json:"entries"`
+}
+
+// auditHandler answers GET /admin/audit with the entries matching the
+// since, until, action, actor and queue parameters, the newest limit ones,
+// 100 by default
+func (s *Server) auditHandler(w http.ResponseWriter, r *http.Request) {
+	if s.auditLog == nil {
+		writeError(w, http.StatusNotImplemented, "audit log is not enabled", "")
+		return
+	}
+	v := r.URL.Query()
+	query := AuditQuery{Action: v.Get("action"), Actor: v.Get("actor"), Queue: v.Get("queue"), Limit: 100}
+	for _, tp := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &query.Since}, {"until", &query.Until}} {
+		if s := v.Get(tp.name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s %q, want an RFC 3339 time", tp.name, s), tp.name)
+				return
+			}
+			*tp.dst = t
+		}
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit %q", s), "limit")
+			return
+		}
+		query.Limit = n
+	}
+	entries, err := s.auditLog.Query(query)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if entries == nil {
+		entries = []AuditEntry{}
+	}
+	writeJSON(w, http.StatusOK, auditResponse{Entries: entries})
+}
@@ -0,0 +1,166 @@
+package go_playground
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// APIKeyHeader carries the API key of a request, see Auth
+const APIKeyHeader = "X-API-Key"
+
+// Auth requires requests to present one of the configured keys, in the
+// X-API-Key header or as an Authorization bearer token
+type Auth struct {
+	Keys   map[string]string // client name -> API key or token
+	Public []string          // paths served without a key, besides the health probes and the dashboard
+	// Tenants maps clients to the tenant owning the tasks they submit, see
+	// TenantID. Several clients may share a tenant
+	Tenants map[string]string
+	// Admins lists the clients allowed on the admin and debug endpoints,
+	// under /admin, /queues/{name}/admin and /debug, and on the bulk
+	// actions: purge, cancel and retry of matching tasks and the purge of
+	// the dead letters. All clients are when it is empty
+	Admins []string
+}
+
+// ClientID returns the name of the client authenticated for the request
+// with ctx, empty without authentication
+func ClientID(ctx context.Context) string {
+	if slot, ok := ctx.Value(clientKey).(*string); ok {
+		return *slot
+	}
+	return ""
+}
+
+// TenantID returns the tenant of the client authenticated for the request
+// with ctx, as mapped by Auth.Tenants, or the client name when it is not
+// mapped
+func TenantID(ctx context.Context) string {
+	if tenant, ok := ctx.Value(tenantKey).(string); ok {
+		return tenant
+	}
+	return ClientID(ctx)
+}
+
+// authenticator checks keys by their hash, so lookups take the same time
+// whatever prefix of a key the caller guessed
+type authenticator struct {
+	clients  map[[sha256.Size]byte]string
+	tenants  map[string]string
+	public   map[string]bool
+	admins   map[string]bool // nil when every client is an admin
+	requests *prometheus.CounterVec
+}
+
+func newAuthenticator(a Auth) *authenticator {
+	au := &authenticator{
+		clients: make(map[[sha256.Size]byte]string, len(a.Keys)),
+		tenants: a.Tenants,
+		public:  make(map[string]bool, len(a.Public)),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workerpool_http_requests_total",
+			Help: "HTTP requests by authenticated client and status code.",
+		}, []string{"client", "code"}),
+	}
+	for name, key := range a.Keys {
+		if key == "" {
+			continue
+		}
+		au.clients[sha256.Sum256([]byte(key))] = name
+	}
+	// Orchestrators probe without credentials, and the API describes
+	// itself to anyone
+	au.public["/healthz"], au.public["/readyz"] = true, true
+	au.public["/openapi.json"] = true
+	for _, path := range a.Public {
+		au.public[path] = true
+	}
+	if len(a.Admins) > 0 {
+		au.admins = make(map[string]bool, len(a.Admins))
+		for _, name := range a.Admins {
+			au.admins[name] = true
+		}
+	}
+	return au
+}
+
+// register adds the request counter to reg, sharing the one already there
+// when several servers wrap the same pool
+func (au *authenticator) register(reg prometheus.Registerer) {
+	var are prometheus.AlreadyRegisteredError
+	if err := reg.Register(au.requests); errors.As(err, &are) {
+		au.requests = are.ExistingCollector.(*prometheus.CounterVec)
+	}
+}
+
+// presentedKey returns the key of a request, if any
+func presentedKey(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// isAdminPath reports whether a request of method on path needs an admin
+// client, see Auth.Admins. Bulk actions reach the tasks of every tenant
+func isAdminPath(method, path string) bool {
+	if rest, ok := strings.CutPrefix(path, "/queues/"); ok {
+		_, sub, _ := strings.Cut(rest, "/")
+		path = "/" + sub
+	}
+	switch path {
+	case "/admin", "/purge", "/events/cancel", "/events/retry":
+		return true
+	case "/deadletter":
+		return method == http.MethodDelete
+	}
+	return strings.HasPrefix(path, "/admin/") || strings.HasPrefix(path, "/debug/")
+}
+
+// middleware refuses requests without a known key with 401, and those of
+// clients other than Auth.Admins on admin paths with 403. It records the
+// client name for logging and rate limiting
+func (au *authenticator) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		client := ""
+		defer func() {
+			au.requests.WithLabelValues(client, strconv.Itoa(rec.status)).Inc()
+		}()
+
+		if au.public[r.URL.Path] || isDashboard(r) {
+			next.ServeHTTP(rec, r)
+			return
+		}
+		name, ok := au.clients[sha256.Sum256([]byte(presentedKey(r)))]
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="workerpool"`)
+			writeError(rec, http.StatusUnauthorized, "missing or invalid API key", "")
+			return
+		}
+		client = name
+		if slot, ok := r.Context().Value(clientKey).(*string); ok {
+			*slot = name
+		} else {
+			r = r.WithContext(context.WithValue(r.Context(), clientKey, &name))
+		}
+		if tenant, ok := au.tenants[name]; ok {
+			r = r.WithContext(context.WithValue(r.Context(), tenantKey, tenant))
+		}
+		if au.admins != nil && !au.admins[name] && isAdminPath(r.Method, r.URL.Path) {
+			writeError(rec, http.StatusForbidden, "client "+name+" is not an admin", "")
+			return
+		}
+		next.ServeHTTP(rec, r)
+	})
+}
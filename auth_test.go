@@ -0,0 +1,29 @@
+package go_playground
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBulkActionsNeedAnAdmin(t *testing.T) {
+	srv := NewServer(newPool(t), WithAuth(Auth{Keys: map[string]string{"ops": "ops-key", "acme": "acme-key"}, Admins: []string{"ops"}}))
+	for _, prefix := range []string{"", "/queues/default"} {
+		for _, route := range []struct{ method, path string }{
+			{http.MethodPost, "/events/cancel"},
+			{http.MethodPost, "/events/retry"},
+			{http.MethodDelete, "/deadletter"},
+			{http.MethodPost, "/purge"},
+		} {
+			path := prefix + route.path
+			if w := serve(srv, route.method, path, `{}`, APIKeyHeader, "acme-key"); w.Code != http.StatusForbidden {
+				t.Errorf("%s %s by a client = %d, want 403", route.method, path, w.Code)
+			}
+			if w := serve(srv, route.method, path, `{}`, APIKeyHeader, "ops-key"); w.Code == http.StatusForbidden || w.Code == http.StatusUnauthorized {
+				t.Errorf("%s %s by an admin = %d", route.method, path, w.Code)
+			}
+		}
+	}
+	if w := serve(srv, http.MethodGet, "/deadletter", "", APIKeyHeader, "acme-key"); w.Code != http.StatusOK {
+		t.Errorf("GET /deadletter by a client = %d, want 200", w.Code)
+	}
+}
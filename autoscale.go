@@ -0,0 +1,112 @@
+package go_playground
+
+import "time"
+
+// AutoscalePolicy controls how the pool grows and shrinks its workers
+type AutoscalePolicy struct {
+	MinWorkers int
+	MaxWorkers int
+	Interval   time.Duration // how often the queue is sampled
+
+	// The pool grows when more than ScaleUpDepth tasks per worker are waiting
+	// or the average task latency exceeds TargetLatency
+	ScaleUpDepth  float64
+	TargetLatency time.Duration
+
+	// The pool shrinks after the queue stayed empty with idle workers for
+	// ScaleDownAfter consecutive samples
+	ScaleDownAfter int
+
+	// Cooldown is the minimum time between two resizes
+	Cooldown time.Duration
+}
+
+// DefaultAutoscalePolicy scales between 1 and 20 workers
+var DefaultAutoscalePolicy = AutoscalePolicy{
+	MinWorkers:     1,
+	MaxWorkers:     20,
+	Interval:       time.Second,
+	ScaleUpDepth:   2,
+	ScaleDownAfter: 5,
+	Cooldown:       3 * time.Second,
+}
+
+// normalize fills zero fields from the defaults and fixes inverted bounds
+func (ap AutoscalePolicy) normalize() AutoscalePolicy {
+	d := DefaultAutoscalePolicy
+	if ap.MinWorkers < 1 {
+		ap.MinWorkers = d.MinWorkers
+	}
+	if ap.MaxWorkers < ap.MinWorkers {
+		ap.MaxWorkers = ap.MinWorkers
+	}
+	if ap.Interval <= 0 {
+		ap.Interval = d.Interval
+	}
+	if ap.ScaleUpDepth <= 0 {
+		ap.ScaleUpDepth = d.ScaleUpDepth
+	}
+	if ap.ScaleDownAfter < 1 {
+		ap.ScaleDownAfter = d.ScaleDownAfter
+	}
+	if ap.Cooldown < 0 {
+		ap.Cooldown = 0
+	}
+	return ap
+}
+
+// autoscale samples the queue until the pool shuts down
+func (p *WorkerPool) autoscale() {
+	ap := *p.autoscalePolicy
+	ticker := time.NewTicker(ap.Interval)
+	defer ticker.Stop()
+
+	var lastResize time.Time
+	idleSamples := 0
+	for {
+		select {
+		case <-p.quit:
+			return
+		case <-ticker.C:
+		}
+		// The backlog of a paused pool says nothing about its capacity
+		if p.Paused() {
+			idleSamples = 0
+			continue
+		}
+
+		workers := p.Workers()
+		depth := p.QueueDepth()
+		busy := int(p.busy.Load())
+		latency := p.avgLatency()
+
+		overloaded := float64(depth) > ap.ScaleUpDepth*float64(workers) ||
+			(ap.TargetLatency > 0 && latency > ap.TargetLatency && depth > 0)
+		if depth == 0 && busy < workers {
+			idleSamples++
+		} else {
+			idleSamples = 0
+		}
+
+		if time.Since(lastResize) < ap.Cooldown {
+			continue
+		}
+		switch {
+		case overloaded && workers < ap.MaxWorkers:
+			// Grow by the missing capacity, bounded by MaxWorkers
+			want := int(float64(depth)/ap.ScaleUpDepth) + 1
+			want = min(max(want, workers+1), ap.MaxWorkers)
+			for range want - workers {
+				p.addWorker()
+			}
+			p.log.Info("autoscaler: scaled up", "from", workers, "to", p.Workers(), "queue_depth", depth)
+			lastResize = time.Now()
+		case idleSamples >= ap.ScaleDownAfter && workers > ap.MinWorkers:
+			if p.retireWorker() {
+				p.log.Info("autoscaler: scaled down", "from", workers, "to", workers-1)
+				lastResize = time.Now()
+			}
+			idleSamples = 0
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package go_playground
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAutoscalePolicyNormalize(t *testing.T) {
+	got := AutoscalePolicy{MinWorkers: 4, MaxWorkers: 2, Cooldown: -time.Second}.normalize()
+	want := DefaultAutoscalePolicy
+	want.MinWorkers, want.MaxWorkers, want.Cooldown = 4, 4, 0
+	if got != want {
+		t.Errorf("normalize() = %+v, want %+v", got, want)
+	}
+}
+
+func TestAutoscaleFollowsQueueDepth(t *testing.T) {
+	release := make(chan struct{})
+	p := startPool(t,
+		WithAutoscale(AutoscalePolicy{MinWorkers: 1, MaxWorkers: 4, Interval: 5 * time.Millisecond, ScaleUpDepth: 1, ScaleDownAfter: 2}),
+		WithHandler(TaskHandlerFunc(func(ctx context.Context, _ Task) error {
+			select {
+			case <-release:
+			case <-ctx.Done():
+			}
+			return nil
+		})),
+	)
+	if p.Workers() != 1 {
+		t.Fatalf("pool started with %d workers, want 1", p.Workers())
+	}
+
+	submit(t, p, make([]Task, 10)...)
+	// Ten blocked tasks ask for more workers than MaxWorkers allows
+	waitWorkers(t, p, 4)
+	close(release)
+	waitWorkers(t, p, 1)
+}
@@ -0,0 +1,222 @@
+package go_playground
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// maxBatchSize bounds the number of tasks accepted by a single batch
+const maxBatchSize = 1000
+
+// batchQueue is implemented by backends that can enqueue several tasks
+// atomically
+type batchQueue interface {
+	// PushBatch adds all tasks or none of them. Bounded backends fail with
+	// ErrQueueFull instead of waiting for room
+	PushBatch(ts []Task) error
+}
+
+// SubmitBatch assigns IDs to the tasks and enqueues them together. When the
+// queue cannot hold the whole batch nothing is enqueued and the error is
+// returned, regardless of the overflow policy. Backends without batch
+// support receive the tasks one by one, and those accepted before a failure
+// stay queued. Tasks with a known IdempotencyKey are replaced by the task
+// submitted earlier, as with Submit. One task refused by a Validator
+// rejects the batch, with fields prefixed by the task index such as [2].data
+func (p *WorkerPool) SubmitBatch(tasks []Task) ([]Task, error) {
+	return p.SubmitBatchContext(context.Background(), tasks)
+}
+
+// SubmitBatchContext is SubmitBatch handing ctx to the interceptors of the
+// pool. Tasks they split or drop change the number of tasks returned,
+// which stay in order, the parts of a task in its place
+func (p *WorkerPool) SubmitBatchContext(ctx context.Context, tasks []Task) ([]Task, error) {
+	if len(p.interceptors) > 0 {
+		var err error
+		if tasks, err = p.intercept(ctx, tasks); err != nil {
+			return nil, err
+		}
+	}
+	return p.submitAll(tasks)
+}
+
+// submitAll submits a batch without intercepting it
+func (p *WorkerPool) submitAll(tasks []Task) ([]Task, error) {
+	if p.webhooks == nil && slices.ContainsFunc(tasks, func(t Task) bool { return t.CallbackURL != "" }) {
+		return nil, ErrCallbacksDisabled
+	}
+	if err := p.validateBatch(tasks); err != nil {
+		return nil, err
+	}
+	tasks = append([]Task(nil), tasks...)
+
+	// Claim every key before waiting on any, so batches sharing keys in
+	// different orders cannot wait on each other
+	entries := make(map[int]*keyEntry)
+	var fresh, dups []int
+	for i, t := range tasks {
+		if !p.idem.deduplicates(t) {
+			fresh = append(fresh, i)
+			continue
+		}
+		e, owner := p.idem.claim(t.IdempotencyKey)
+		entries[i] = e
+		if owner {
+			fresh = append(fresh, i)
+		} else {
+			dups = append(dups, i)
+		}
+	}
+
+	batch := make([]Task, len(fresh))
+	for j, i := range fresh {
+		batch[j] = tasks[i]
+	}
+	batch, err := p.submitBatch(batch)
+	for j, i := range fresh {
+		tasks[i] = batch[j]
+		if e, ok := entries[i]; ok {
+			p.idem.settle(tasks[i].IdempotencyKey, e, tasks[i], err)
+		}
+	}
+	if err != nil {
+		return tasks, err
+	}
+
+	for _, i := range dups {
+		e := entries[i]
+		<-e.done
+		if e.err == nil {
+			p.taskLogger(e.task).Info("duplicate submission", "idempotency_key", e.task.IdempotencyKey)
+			tasks[i] = e.task
+			continue
+		}
+		// The first submission failed, so this one takes its place
+		if tasks[i], err = p.submitOne(tasks[i]); err != nil {
+			return tasks, err
+		}
+	}
+	return tasks, nil
+}
+
+func (p *WorkerPool) submitBatch(tasks []Task) (_ []Task, err error) {
+	for _, t := range tasks {
+		if err := p.checkDependencies(t); err != nil {
+			return tasks, err
+		}
+	}
+	var now, later, blocked []Task
+	for i := range tasks {
+		id, err := p.newID()
+		if err != nil {
+			return tasks, err
+		}
+		tasks[i].ID = id
+		if err := p.stampUID(&tasks[i]); err != nil {
+			return tasks, err
+		}
+		tasks[i].Queue = p.name
+		span := p.traceEnqueue(&tasks[i])
+		defer func() { endSpan(span, err) }()
+		p.setDeadlines(&tasks[i])
+		stampSchema(&tasks[i])
+		switch {
+		case len(tasks[i].DependsOn) > 0:
+			blocked = append(blocked, tasks[i])
+		case p.until(tasks[i].RunAt) > 0:
+			later = append(later, tasks[i])
+		default:
+			now = append(now, tasks[i])
+		}
+	}
+
+	if p.storageFull() {
+		if p.storage.quota.Policy != StorageDeadLetter {
+			return tasks, p.refuseStorage(tasks[0])
+		}
+		// Every task is dead-lettered, the error naming the first
+		var first error
+		for _, t := range tasks {
+			if err := p.refuseStorage(t); first == nil {
+				first = err
+			}
+		}
+		return tasks, first
+	}
+	if err = p.tenants.reserve(tasks, p.metrics.tenantRefused); err != nil {
+		return tasks, err
+	}
+	// Reserve the delayed and blocked tasks up front so a shutdown cannot
+	// cut the batch in half
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		p.tenants.release(tasks)
+		return tasks, ErrPoolClosed
+	}
+	p.delayed.Add(len(later) + len(blocked))
+	p.mu.Unlock()
+
+	if err = p.pushBatch(now); err != nil {
+		p.delayed.Add(-len(later) - len(blocked))
+		p.tenants.release(tasks)
+		return tasks, err
+	}
+	for _, t := range later {
+		p.delay(t)
+	}
+	for _, t := range blocked {
+		p.block(t)
+	}
+	p.tenants.submitted(tasks)
+	at := time.Now()
+	for _, t := range tasks {
+		p.analytics.sample(t, at)
+	}
+	return tasks, nil
+}
+
+func (p *WorkerPool) pushBatch(tasks []Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	for _, t := range tasks {
+		p.track(t, StateQueued, nil)
+	}
+
+	bq, ok := p.queue.(batchQueue)
+	if !ok {
+		for i, t := range tasks {
+			if err := p.push(t); err != nil {
+				p.rejectAll(tasks[i:], err)
+				return err
+			}
+			p.logTask(t, slog.LevelInfo, "task enqueued", slog.Int("priority", t.Priority))
+		}
+		return nil
+	}
+
+	err := bq.PushBatch(tasks)
+	if errors.Is(err, ErrQueueClosed) {
+		err = ErrPoolClosed
+	}
+	if err != nil {
+		p.rejectAll(tasks, err)
+		return err
+	}
+	p.metrics.enqueued.Add(float64(len(tasks)))
+	for _, t := range tasks {
+		p.logTask(t, slog.LevelInfo, "task enqueued", slog.Int("priority", t.Priority))
+	}
+	return nil
+}
+
+func (p *WorkerPool) rejectAll(tasks []Task, err error) {
+	for _, t := range tasks {
+		p.taskLogger(t).Warn("task rejected", "error", err)
+		p.track(t, StateFailed, err)
+	}
+}
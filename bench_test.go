@@ -0,0 +1,141 @@
+package go_playground
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// benchPool starts a pool whose handler does nothing but count the tasks
+// down on done, so the benchmarks measure the pool itself
+func benchPool(b *testing.B, done *sync.WaitGroup, opts ...Option) *WorkerPool {
+	b.Helper()
+	p := NewWorkerPool(append([]Option{
+		WithWorkers(runtime.GOMAXPROCS(0)),
+		WithQueueSize(10_000),
+		// A full queue makes producers wait instead of failing
+		WithOverflowPolicy(OverflowBlock, 0),
+		WithLogger(slog.New(slog.DiscardHandler)),
+		WithHandler(TaskHandlerFunc(func(context.Context, Task) error {
+			if done != nil {
+				done.Done()
+			}
+			return nil
+		})),
+	}, opts...)...)
+	p.Start()
+	b.Cleanup(func() { _ = p.Shutdown(context.Background()) })
+	return p
+}
+
+// BenchmarkSubmit measures the enqueue path of a single producer
+func BenchmarkSubmit(b *testing.B) {
+	p := benchPool(b, nil)
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := p.Submit(Task{Data: "bench"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSubmitParallel measures the enqueue path under contention, every
+// P submitting at once
+func BenchmarkSubmitParallel(b *testing.B) {
+	p := benchPool(b, nil)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := p.Submit(Task{Data: "bench"}); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkThroughput measures tasks submitted by every P and run to the
+// end, through the shared dispatch channel and through work stealing
+func BenchmarkThroughput(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"shared", nil},
+		{"stealing", []Option{WithWorkStealing(WorkStealing{LocalQueue: 64})}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			var done sync.WaitGroup
+			p := benchPool(b, &done, bc.opts...)
+			b.ReportAllocs()
+			b.ResetTimer()
+			done.Add(b.N)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := p.Submit(Task{Data: "bench"}); err != nil {
+						b.Error(err)
+						done.Done()
+					}
+				}
+			})
+			done.Wait()
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "tasks/s")
+		})
+	}
+}
+
+// BenchmarkMemoryQueue measures a push and a pop of the memory queue, whose
+// heap entries are recycled
+func BenchmarkMemoryQueue(b *testing.B) {
+	q := NewMemoryQueue(1024)
+	defer q.Close()
+	task := Task{ID: 1, Data: "bench", Priority: 3}
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := q.Push(task); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := q.Pop(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDispatch measures the life of one task on a synchronous pool:
+// submission, records of its state transitions, handler context and logs,
+// without the scheduling noise of workers
+func BenchmarkDispatch(b *testing.B) {
+	p := NewTestPool(
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithHandler(TaskHandlerFunc(func(context.Context, Task) error { return nil })),
+	)
+	b.Cleanup(func() { _ = p.Shutdown(context.Background()) })
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := p.Submit(Task{Data: "bench"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLogTask compares the per-task log line of the hot path with the
+// logger taskLogger builds for the others
+func BenchmarkLogTask(b *testing.B) {
+	p := NewWorkerPool(WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	task := Task{ID: 1, CorrelationID: "req-1"}
+	b.Run("logTask", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			p.logTask(task, slog.LevelInfo, "task enqueued", slog.Int("priority", task.Priority))
+		}
+	})
+	b.Run("taskLogger", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			p.taskLogger(task).Info("task enqueued", "priority", task.Priority)
+		}
+	})
+}
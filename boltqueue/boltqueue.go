@@ -0,0 +1,408 @@
+// Package boltqueue is a durable QueueBackend stored in a BoltDB file
+package boltqueue
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	pool "playground"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	pendingBucket  = []byte("pending")
+	inflightBucket = []byte("inflight")
+	metaBucket     = []byte("meta")
+	scheduleBucket = []byte("schedules")
+	deadBucket     = []byte("deadletters")
+	// quarantineBucket keeps the entries CheckConsistency set aside, by
+	// key of the bucket they were in
+	quarantineBucket = []byte("quarantine")
+	lastIDKey        = []byte("last_id")
+)
+
+// Queue keeps tasks in BoltDB until they are acknowledged. Popped tasks
+// move to an in-flight bucket and are put back in the queue when the next
+// process opens the same database
+type Queue struct {
+	db    *bolt.DB
+	codec pool.Codec
+
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	pending  int
+	closed   bool
+	// recovered are the tasks New requeued from flight, for the next
+	// CheckConsistency to report
+	recovered []int
+}
+
+// Option configures a Queue
+type Option func(*Queue)
+
+// WithCodec sets how new tasks are stored, pool.JSONCodec by default.
+// Tasks stored with any registered codec, or before codecs existed, are
+// still read back
+func WithCodec(c pool.Codec) Option {
+	return func(q *Queue) {
+		q.codec = c
+	}
+}
+
+// New prepares the buckets in db and requeues tasks that were in flight
+// when the previous process stopped. The caller owns db and closes it after
+// the pool has shut down
+func New(db *bolt.DB, opts ...Option) (*Queue, error) {
+	q := &Queue{db: db, codec: pool.JSONCodec}
+	for _, opt := range opts {
+		opt(q)
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{pendingBucket, inflightBucket, metaBucket, scheduleBucket, deadBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		pending, inflight := tx.Bucket(pendingBucket), tx.Bucket(inflightBucket)
+		c := inflight.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			t, err := pool.UnmarshalTask(v)
+			if err != nil {
+				return fmt.Errorf("decoding in-flight task: %w", err)
+			}
+			if err := putPending(pending, t, v); err != nil {
+				return err
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			q.recovered = append(q.recovered, t.ID)
+		}
+		// Stats does not see writes of the running transaction, so count by hand
+		pc := pending.Cursor()
+		for k, _ := pc.First(); k != nil; k, _ = pc.Next() {
+			q.pending++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("boltqueue: %w", err)
+	}
+	return q, nil
+}
+
+// Push implements pool.QueueBackend
+func (q *Queue) Push(t pool.Task) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return pool.ErrQueueClosed
+	}
+
+	return q.put([]pool.Task{t})
+}
+
+// PushBatch adds all tasks in a single transaction
+func (q *Queue) PushBatch(ts []pool.Task) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return pool.ErrQueueClosed
+	}
+	return q.put(ts)
+}
+
+// put stores tasks as pending. The caller holds q.mu
+func (q *Queue) put(ts []pool.Task) error {
+	vals := make([][]byte, len(ts))
+	for i, t := range ts {
+		v, err := pool.MarshalTask(q.codec, t)
+		if err != nil {
+			return err
+		}
+		vals[i] = v
+	}
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		pending, meta := tx.Bucket(pendingBucket), tx.Bucket(metaBucket)
+		lastID := 0
+		if last := meta.Get(lastIDKey); last != nil {
+			lastID = int(binary.BigEndian.Uint64(last))
+		}
+		for i, t := range ts {
+			if err := putPending(pending, t, vals[i]); err != nil {
+				return err
+			}
+			lastID = max(lastID, t.ID)
+		}
+		return meta.Put(lastIDKey, itob(uint64(lastID)))
+	})
+	if err != nil {
+		return err
+	}
+
+	q.pending += len(ts)
+	q.notEmpty.Broadcast()
+	return nil
+}
+
+// Pop implements pool.QueueBackend
+func (q *Queue) Pop() (pool.Task, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.closed && q.pending == 0 {
+		q.notEmpty.Wait()
+	}
+	if q.pending == 0 {
+		return pool.Task{}, pool.ErrQueueClosed
+	}
+
+	var t pool.Task
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(pendingBucket).Cursor()
+		k, v := c.First()
+		if k == nil {
+			return fmt.Errorf("pending bucket is empty")
+		}
+		var err error
+		if t, err = pool.UnmarshalTask(v); err != nil {
+			return err
+		}
+		if err := tx.Bucket(inflightBucket).Put(itob(uint64(t.ID)), v); err != nil {
+			return err
+		}
+		return c.Delete()
+	})
+	if err != nil {
+		return pool.Task{}, err
+	}
+
+	q.pending--
+	return t, nil
+}
+
+// Ack implements pool.QueueBackend
+func (q *Queue) Ack(t pool.Task) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(inflightBucket).Delete(itob(uint64(t.ID)))
+	})
+}
+
+// SaveCheckpoint overwrites the in-flight copy of t, which New requeues if
+// the process stops before acknowledging it
+func (q *Queue) SaveCheckpoint(t pool.Task) error {
+	v, err := pool.MarshalTask(q.codec, t)
+	if err != nil {
+		return err
+	}
+	return q.db.Update(func(tx *bolt.Tx) error {
+		inflight := tx.Bucket(inflightBucket)
+		key := itob(uint64(t.ID))
+		if inflight.Get(key) == nil {
+			return fmt.Errorf("boltqueue: task %d is not in flight", t.ID)
+		}
+		return inflight.Put(key, v)
+	})
+}
+
+// Flush removes and returns every pending task. Tasks already popped stay
+// in flight
+func (q *Queue) Flush() ([]pool.Task, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var tasks []pool.Task
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(pendingBucket).ForEach(func(_, v []byte) error {
+			t, err := pool.UnmarshalTask(v)
+			if err != nil {
+				return err
+			}
+			tasks = append(tasks, t)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := tx.DeleteBucket(pendingBucket); err != nil {
+			return err
+		}
+		_, err = tx.CreateBucket(pendingBucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	q.pending = 0
+	return tasks, nil
+}
+
+// Len implements pool.QueueBackend
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending
+}
+
+// Close implements pool.QueueBackend. It does not close the database
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	return nil
+}
+
+// Ping checks that the database is still open
+func (q *Queue) Ping(ctx context.Context) error {
+	return q.db.View(func(*bolt.Tx) error { return nil })
+}
+
+// Codec returns the codec new tasks are stored with, for the pool to
+// report what a pool.CompressedCodec saves
+func (q *Queue) Codec() pool.Codec { return q.codec }
+
+// StorageBytes implements pool.StorageSizer, the size of the database
+// file, which holds the queue alone
+func (q *Queue) StorageBytes(ctx context.Context) (int64, error) {
+	var n int64
+	err := q.db.View(func(tx *bolt.Tx) error {
+		n = tx.Size()
+		return nil
+	})
+	return n, err
+}
+
+// LastTaskID returns the highest task ID ever pushed, so a restarted pool
+// does not reuse IDs of resumed tasks
+func (q *Queue) LastTaskID() int {
+	var id int
+	_ = q.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(metaBucket).Get(lastIDKey); v != nil {
+			id = int(binary.BigEndian.Uint64(v))
+		}
+		return nil
+	})
+	return id
+}
+
+// Pending returns the pending tasks in the order they are popped, leaving
+// them queued
+func (q *Queue) Pending() ([]pool.Task, error) {
+	tasks := []pool.Task{}
+	err := q.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(pendingBucket).ForEach(func(_, v []byte) error {
+			t, err := pool.UnmarshalTask(v)
+			if err != nil {
+				return err
+			}
+			tasks = append(tasks, t)
+			return nil
+		})
+	})
+	return tasks, err
+}
+
+// SaveSchedule implements pool.ScheduleStore, keeping the schedule across
+// restarts
+func (q *Queue) SaveSchedule(def pool.ScheduleDef) error {
+	v, err := json.Marshal(def)
+	if err != nil {
+		return err
+	}
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(scheduleBucket).Put([]byte(def.Name), v)
+	})
+}
+
+// DeleteSchedule implements pool.ScheduleStore
+func (q *Queue) DeleteSchedule(name string) (bool, error) {
+	var found bool
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(scheduleBucket)
+		found = b.Get([]byte(name)) != nil
+		return b.Delete([]byte(name))
+	})
+	return found, err
+}
+
+// LoadSchedules implements pool.ScheduleStore
+func (q *Queue) LoadSchedules() ([]pool.ScheduleDef, error) {
+	var defs []pool.ScheduleDef
+	err := q.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(scheduleBucket).ForEach(func(k, v []byte) error {
+			var def pool.ScheduleDef
+			if err := json.Unmarshal(v, &def); err != nil {
+				return fmt.Errorf("boltqueue: decoding schedule %q: %w", k, err)
+			}
+			defs = append(defs, def)
+			return nil
+		})
+	})
+	return defs, err
+}
+
+// SaveDeadLetter implements pool.DeadLetterStore, keeping the dead letter
+// across restarts
+func (q *Queue) SaveDeadLetter(dl pool.DeadLetter) error {
+	v, err := pool.MarshalDeadLetter(q.codec, dl)
+	if err != nil {
+		return err
+	}
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(deadBucket).Put(itob(uint64(dl.Task.ID)), v)
+	})
+}
+
+// DeleteDeadLetter implements pool.DeadLetterStore
+func (q *Queue) DeleteDeadLetter(id int) (bool, error) {
+	var found bool
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(deadBucket)
+		found = b.Get(itob(uint64(id))) != nil
+		return b.Delete(itob(uint64(id)))
+	})
+	return found, err
+}
+
+// LoadDeadLetters implements pool.DeadLetterStore
+func (q *Queue) LoadDeadLetters() ([]pool.DeadLetter, error) {
+	var dls []pool.DeadLetter
+	err := q.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(deadBucket).ForEach(func(k, v []byte) error {
+			dl, err := pool.UnmarshalDeadLetter(v)
+			if err != nil {
+				return fmt.Errorf("boltqueue: decoding dead letter %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			dls = append(dls, dl)
+			return nil
+		})
+	})
+	pool.SortDeadLetters(dls)
+	return dls, err
+}
+
+// putPending stores v under a key that sorts by priority (highest first),
+// then by insertion order
+func putPending(b *bolt.Bucket, t pool.Task, v []byte) error {
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 16)
+	copy(key, priorityKey(t.Priority))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return b.Put(key, v)
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
@@ -0,0 +1,70 @@
+package boltqueue_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pool "playground"
+	"playground/boltqueue"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestDeadLettersSurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+	start := func() (*pool.WorkerPool, *bolt.DB) {
+		db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			t.Fatalf("opening the database: %v", err)
+		}
+		q, err := boltqueue.New(db)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		p := pool.NewWorkerPool(
+			pool.WithQueueBackend(q),
+			pool.WithLogger(slog.New(slog.DiscardHandler)),
+			pool.WithHandler(pool.TaskHandlerFunc(func(context.Context, pool.Task) error {
+				return pool.Permanent(errors.New("broken"))
+			})),
+		)
+		p.Start()
+		return p, db
+	}
+	stop := func(p *pool.WorkerPool, db *bolt.DB) {
+		if err := p.Shutdown(context.Background()); err != nil {
+			t.Errorf("Shutdown: %v", err)
+		}
+		_ = db.Close()
+	}
+
+	p, db := start()
+	task, err := p.Submit(pool.Task{Data: "payload"})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if rec, err := p.WaitTask(ctx, task.ID); err != nil || rec.State != pool.StateFailed {
+		t.Fatalf("task %s, %v, want it failed", rec.State, err)
+	}
+	stop(p, db)
+
+	p, db = start()
+	defer stop(p, db)
+	dls := p.DeadLetters()
+	if len(dls) != 1 || dls[0].Task.ID != task.ID || dls[0].Task.Data != "payload" || dls[0].Error != "broken" {
+		t.Fatalf("dead letters after a restart %+v, want the one of task %d", dls, task.ID)
+	}
+	// Acknowledged once stored, so not delivered again
+	if depth := p.QueueDepth(); depth != 0 {
+		t.Errorf("queue depth %d after a restart, want 0", depth)
+	}
+	if n := p.PurgeDeadLetters(); n != 1 || len(p.DeadLetters()) != 0 {
+		t.Errorf("purged %d dead letters, %d left, want 1 and none", n, len(p.DeadLetters()))
+	}
+}
@@ -0,0 +1,151 @@
+package boltqueue
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	pool "playground"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// CheckConsistency implements pool.ConsistencyChecker. The tasks New put
+// back from flight are reported as orphaned claims, already requeued. It
+// then looks for entries that do not decode, pending entries out of
+// priority order, in-flight entries under the key of another task, a
+// pending count out of step and an ID counter behind the tasks. Repairs
+// put the entries back in order, fix the count and counter and move the
+// entries that cannot be trusted to the quarantine bucket, keyed by the
+// name of their bucket followed by their key, for inspection
+func (q *Queue) CheckConsistency(ctx context.Context, repair bool) (pool.ConsistencyReport, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var report pool.ConsistencyReport
+	for _, id := range q.recovered {
+		report.Issues = append(report.Issues, pool.RecoveryIssue{Kind: pool.IssueOrphanedClaim, TaskID: id,
+			Detail: "in flight when the database was last closed, requeued as it opened", Repaired: true})
+	}
+	q.recovered = nil
+
+	check := q.db.View
+	if repair {
+		check = q.db.Update
+	}
+	counted := 0
+	err := check(func(tx *bolt.Tx) error {
+		issue := func(is pool.RecoveryIssue) {
+			is.Repaired = repair
+			report.Issues = append(report.Issues, is)
+		}
+		// Moves happen once the cursors are done with the buckets
+		var quarantined, reordered []entry
+		maxID := 0
+
+		pending := tx.Bucket(pendingBucket)
+		err := pending.ForEach(func(k, v []byte) error {
+			counted++
+			t, err := pool.UnmarshalTask(v)
+			if err != nil {
+				issue(pool.RecoveryIssue{Kind: pool.IssueSchema, Detail: fmt.Sprintf("queued task does not decode: %v", err)})
+				quarantined = append(quarantined, entry{pendingBucket, bytes.Clone(k), bytes.Clone(v)})
+				return nil
+			}
+			maxID = max(maxID, t.ID)
+			report.Held = append(report.Held, t.ID)
+			if len(k) != 16 || !bytes.Equal(k[:8], priorityKey(t.Priority)) {
+				issue(pool.RecoveryIssue{Kind: pool.IssueSchema, TaskID: t.ID, Detail: "queued out of priority order"})
+				reordered = append(reordered, entry{pendingBucket, bytes.Clone(k), bytes.Clone(v)})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(inflightBucket).ForEach(func(k, v []byte) error {
+			t, err := pool.UnmarshalTask(v)
+			if err == nil && !bytes.Equal(k, itob(uint64(t.ID))) {
+				err = fmt.Errorf("stored under the key of another task")
+			}
+			if err != nil {
+				issue(pool.RecoveryIssue{Kind: pool.IssueSchema, Detail: fmt.Sprintf("task in flight cannot be trusted: %v", err)})
+				quarantined = append(quarantined, entry{inflightBucket, bytes.Clone(k), bytes.Clone(v)})
+				return nil
+			}
+			maxID = max(maxID, t.ID)
+			report.Held = append(report.Held, t.ID)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		lastID := 0
+		if last := tx.Bucket(metaBucket).Get(lastIDKey); last != nil {
+			lastID = int(binary.BigEndian.Uint64(last))
+		}
+		if lastID < maxID {
+			issue(pool.RecoveryIssue{Kind: pool.IssueSchema, Detail: fmt.Sprintf("ID counter at %d, behind task %d", lastID, maxID)})
+		}
+		if q.pending != counted {
+			issue(pool.RecoveryIssue{Kind: pool.IssueSchema, Detail: fmt.Sprintf("pending count at %d, %d tasks queued", q.pending, counted)})
+		}
+		if !repair {
+			return nil
+		}
+
+		for _, e := range reordered {
+			t, _ := pool.UnmarshalTask(e.value)
+			if err := pending.Delete(e.key); err != nil {
+				return err
+			}
+			if err := putPending(pending, t, e.value); err != nil {
+				return err
+			}
+		}
+		if len(quarantined) > 0 {
+			qb, err := tx.CreateBucketIfNotExists(quarantineBucket)
+			if err != nil {
+				return err
+			}
+			for _, e := range quarantined {
+				if err := qb.Put(append(append([]byte(nil), e.bucket...), e.key...), e.value); err != nil {
+					return err
+				}
+				if err := tx.Bucket(e.bucket).Delete(e.key); err != nil {
+					return err
+				}
+				if bytes.Equal(e.bucket, pendingBucket) {
+					counted--
+				}
+			}
+		}
+		if lastID < maxID {
+			return tx.Bucket(metaBucket).Put(lastIDKey, itob(uint64(maxID)))
+		}
+		return nil
+	})
+	if err != nil {
+		for i := range report.Issues {
+			report.Issues[i].Repaired = report.Issues[i].Kind == pool.IssueOrphanedClaim
+		}
+		return report, fmt.Errorf("boltqueue: %w", err)
+	}
+	if repair {
+		q.pending = counted
+		q.notEmpty.Broadcast()
+	}
+	return report, nil
+}
+
+// entry is a key and value read from bucket
+type entry struct {
+	bucket, key, value []byte
+}
+
+// priorityKey is the first half of the pending keys of tasks of priority
+func priorityKey(priority int) []byte {
+	return itob(uint64(-int64(priority)) ^ (1 << 63))
+}
@@ -0,0 +1,206 @@
+package go_playground
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a pool's circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed dispatches tasks normally
+	BreakerClosed BreakerState = iota
+	// BreakerHalfOpen dispatches a single trial task after the cooldown
+	BreakerHalfOpen
+	// BreakerOpen holds tasks in the queue
+	BreakerOpen
+)
+
+// String returns the state name
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// CircuitBreaker stops dispatching tasks while the handler keeps failing,
+// typically because a downstream dependency is down
+type CircuitBreaker struct {
+	Threshold int           // consecutive failed runs that open the circuit
+	Cooldown  time.Duration // time open before a trial task is let through
+
+	// OnStateChange, if set, is called after every transition, in order,
+	// from the worker or timer that caused it
+	OnStateChange func(from, to BreakerState)
+}
+
+// DefaultCircuitBreaker opens after 5 failures in a row for 30 seconds
+var DefaultCircuitBreaker = CircuitBreaker{Threshold: 5, Cooldown: 30 * time.Second}
+
+// breaker implements CircuitBreaker. A nil breaker is always closed
+type breaker struct {
+	cfg  CircuitBreaker
+	log  *slog.Logger
+	trip func()
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	trial    bool          // the half-open trial task has been dispatched
+	changed  chan struct{} // closed and replaced on every transition
+	pending  [][2]BreakerState
+
+	notifyMu sync.Mutex // keeps OnStateChange calls in order
+}
+
+func newBreaker(cfg CircuitBreaker, log *slog.Logger, trip func()) *breaker {
+	if cfg.Threshold < 1 {
+		cfg.Threshold = DefaultCircuitBreaker.Threshold
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = DefaultCircuitBreaker.Cooldown
+	}
+	return &breaker{cfg: cfg, log: log, trip: trip, changed: make(chan struct{})}
+}
+
+// wait blocks until the breaker lets another task be dispatched. It
+// reports false when ctx ends first
+func (b *breaker) wait(ctx context.Context) bool {
+	if b == nil {
+		return true
+	}
+	for {
+		b.mu.Lock()
+		switch {
+		case b.state == BreakerClosed:
+			b.mu.Unlock()
+			return true
+		case b.state == BreakerHalfOpen && !b.trial:
+			b.trial = true
+			b.mu.Unlock()
+			return true
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// report feeds the outcome of a handler run into the breaker
+func (b *breaker) report(err error) {
+	if b == nil {
+		return
+	}
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		if err == nil {
+			b.failures = 0
+			return
+		}
+		if b.failures++; b.failures >= b.cfg.Threshold {
+			b.open()
+		}
+	case BreakerHalfOpen:
+		if err != nil {
+			b.open()
+		} else {
+			b.failures = 0
+			b.setState(BreakerClosed)
+		}
+	}
+	// Runs finishing while open were dispatched before it tripped
+}
+
+// skip gives back the half-open trial slot when the trial task ended
+// without a verdict, such as being canceled
+func (b *breaker) skip() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen && b.trial {
+		b.trial = false
+		close(b.changed)
+		b.changed = make(chan struct{})
+	}
+}
+
+// open trips the breaker and schedules the half-open trial. The caller
+// holds b.mu
+func (b *breaker) open() {
+	b.setState(BreakerOpen)
+	b.trip()
+	time.AfterFunc(b.cfg.Cooldown, func() {
+		defer b.notify()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.state == BreakerOpen {
+			b.trial = false
+			b.setState(BreakerHalfOpen)
+		}
+	})
+}
+
+// setState moves to a new state and wakes the dispatcher. The caller holds
+// b.mu
+func (b *breaker) setState(to BreakerState) {
+	from := b.state
+	b.state = to
+	close(b.changed)
+	b.changed = make(chan struct{})
+
+	b.log.Warn("circuit breaker state changed", "from", from.String(), "to", to.String(), "failures", b.failures)
+	if b.cfg.OnStateChange != nil {
+		b.pending = append(b.pending, [2]BreakerState{from, to})
+	}
+}
+
+// notify runs OnStateChange for the transitions made so far, outside b.mu
+// so the callback may inspect the pool
+func (b *breaker) notify() {
+	b.notifyMu.Lock()
+	defer b.notifyMu.Unlock()
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+	for _, t := range pending {
+		b.cfg.OnStateChange(t[0], t[1])
+	}
+}
+
+// State returns the current state
+func (b *breaker) State() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// CircuitState returns the state of the pool's circuit breaker, always
+// closed when none is configured
+func (p *WorkerPool) CircuitState() BreakerState {
+	return p.breaker.State()
+}
@@ -0,0 +1,180 @@
+package go_playground
+
+import (
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ExecutionBudget caps the tasks a pool starts per period, such as the
+// calls a third-party API allows per day. Tasks reaching a worker once the
+// budget is spent are held as delayed tasks until the next period. Retries
+// of a started task and dry runs are not counted. Budgets are kept in memory: a restart
+// starts the period afresh
+type ExecutionBudget struct {
+	Limit int // tasks started per period
+	// Period is the length of a period, at most a day. Periods are aligned
+	// on midnight in Location, UTC by default, so an hourly budget resets
+	// on the hour
+	Period   time.Duration
+	Location *time.Location
+	// Types are the task types the budget counts, all when empty
+	Types []string
+}
+
+// BudgetUsage is the state of an ExecutionBudget in its current period
+type BudgetUsage struct {
+	Period    time.Duration `json:"period"`
+	Limit     int           `json:"limit"`
+	Used      int           `json:"used"`
+	Remaining int           `json:"remaining"`
+	ResetsAt  time.Time     `json:"resets_at"`
+	Types     []string      `json:"types,omitempty"`
+}
+
+// budgets holds the budgets of a pool, spent together under one lock so a
+// task is counted by all of its budgets or none. A nil budgets never holds
+// tasks
+type budgets struct {
+	mu    sync.Mutex
+	items []*budget
+}
+
+type budget struct {
+	cfg        ExecutionBudget
+	start, end time.Time
+	used       int
+}
+
+// WithExecutionBudget caps the tasks the pool starts per period, see
+// ExecutionBudget. Repeat it for, say, an hourly and a daily budget
+func WithExecutionBudget(b ExecutionBudget) Option {
+	return func(p *WorkerPool) {
+		if b.Limit <= 0 || b.Period <= 0 {
+			return
+		}
+		b.Period = min(b.Period, 24*time.Hour)
+		if b.Location == nil {
+			b.Location = time.UTC
+		}
+		if p.budgets == nil {
+			p.budgets = &budgets{}
+		}
+		p.budgets.items = append(p.budgets.items, &budget{cfg: b})
+	}
+}
+
+// applies reports whether the budget counts t
+func (b *budget) applies(t Task) bool {
+	return len(b.cfg.Types) == 0 || slices.Contains(b.cfg.Types, t.Type)
+}
+
+// roll moves the budget to the period now is in
+func (b *budget) roll(now time.Time) {
+	if now.Before(b.end) && !now.Before(b.start) {
+		return
+	}
+	local := now.In(b.cfg.Location)
+	y, m, d := local.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, b.cfg.Location)
+	next := midnight.AddDate(0, 0, 1)
+	b.start = midnight.Add(now.Sub(midnight) / b.cfg.Period * b.cfg.Period)
+	if b.end = b.start.Add(b.cfg.Period); b.end.After(next) {
+		b.end = next
+	}
+	b.used = 0
+}
+
+// take spends one start of every budget counting t, or none of them when
+// one is spent, returning then when the last spent one resets
+func (bs *budgets) take(t Task, now time.Time) (time.Time, bool) {
+	if bs == nil {
+		return time.Time{}, true
+	}
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	var resets time.Time
+	for _, b := range bs.items {
+		if !b.applies(t) {
+			continue
+		}
+		b.roll(now)
+		if b.used >= b.cfg.Limit && b.end.After(resets) {
+			resets = b.end
+		}
+	}
+	if !resets.IsZero() {
+		return resets, false
+	}
+	for _, b := range bs.items {
+		if b.applies(t) {
+			b.used++
+		}
+	}
+	return time.Time{}, true
+}
+
+// usage returns the state of every budget at now
+func (bs *budgets) usage(now time.Time) []BudgetUsage {
+	if bs == nil {
+		return nil
+	}
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	usage := make([]BudgetUsage, 0, len(bs.items))
+	for _, b := range bs.items {
+		b.roll(now)
+		usage = append(usage, BudgetUsage{
+			Period:    b.cfg.Period,
+			Limit:     b.cfg.Limit,
+			Used:      b.used,
+			Remaining: max(b.cfg.Limit-b.used, 0),
+			ResetsAt:  b.end,
+			Types:     b.cfg.Types,
+		})
+	}
+	return usage
+}
+
+// Budgets returns the state of the execution budgets of the pool, nil
+// without WithExecutionBudget
+func (p *WorkerPool) Budgets() []BudgetUsage {
+	return p.budgets.usage(p.clock.Now())
+}
+
+// heldByBudget puts a task that reached a worker once its budget is spent
+// back with the delayed tasks until the budget resets, reporting whether it
+// did
+func (p *WorkerPool) heldByBudget(task Task) bool {
+	if p.isDryRun(task) {
+		// A dry run calls nothing the budget guards
+		return false
+	}
+	resets, ok := p.budgets.take(task, p.clock.Now())
+	if ok {
+		return false
+	}
+	p.metrics.budgetDeferred.Inc()
+	return p.hold(task, resets, "its execution budget resets")
+}
+
+func (s *Server) budgetRoutes(r *mux.Router) {
+	r.HandleFunc("/budget", s.budgetHandler).Methods("GET")
+}
+
+// budgetHandler serves GET /budget, the remaining execution budgets of
+// the pool
+func (s *Server) budgetHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	usage := p.Budgets()
+	if usage == nil {
+		usage = []BudgetUsage{}
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
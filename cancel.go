@@ -0,0 +1,82 @@
+package go_playground
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrTaskCanceled is recorded on tasks stopped through Cancel
+	ErrTaskCanceled = errors.New("task canceled")
+	// ErrTaskTimeout is recorded on attempts that ran past their timeout
+	ErrTaskTimeout = errors.New("task timed out")
+	// ErrTaskFinished is returned when cancelling a task that already ended
+	ErrTaskFinished = errors.New("task already finished")
+)
+
+// Cancel stops a queued or running task. Queued tasks are skipped when
+// they reach a worker; running tasks get their context cancelled
+func (p *WorkerPool) Cancel(id int) error {
+	p.runMu.Lock()
+	if cancel, ok := p.running[id]; ok {
+		p.runMu.Unlock()
+		cancel(ErrTaskCanceled)
+		return nil
+	}
+
+	rec, err := p.store.Get(id)
+	if err != nil {
+		p.runMu.Unlock()
+		return err
+	}
+	if rec.State != StateQueued {
+		p.runMu.Unlock()
+		return ErrTaskFinished
+	}
+	p.canceled[id] = struct{}{}
+	p.runMu.Unlock()
+
+	p.track(rec.Task, StateCanceled, ErrTaskCanceled)
+	return nil
+}
+
+// begin registers a task as running and returns its context. It reports
+// false when the task was cancelled while it was still queued
+func (p *WorkerPool) begin(id int) (context.Context, bool) {
+	p.runMu.Lock()
+	defer p.runMu.Unlock()
+	if _, ok := p.canceled[id]; ok {
+		delete(p.canceled, id)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithCancelCause(p.ctx)
+	p.running[id] = cancel
+	return ctx, true
+}
+
+// end unregisters a running task
+func (p *WorkerPool) end(id int) {
+	p.runMu.Lock()
+	defer p.runMu.Unlock()
+	if cancel, ok := p.running[id]; ok {
+		cancel(nil)
+		delete(p.running, id)
+	}
+}
+
+// attemptContext bounds a single handler run by the task, handler or pool
+// timeout
+func (p *WorkerPool) attemptContext(ctx context.Context, task Task) (context.Context, context.CancelFunc) {
+	timeout := task.Timeout
+	if timeout <= 0 {
+		timeout = p.handlers.config(task.Type).timeout
+	}
+	if timeout <= 0 {
+		timeout = p.taskTimeout
+	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return p.withTimeoutCause(ctx, timeout, ErrTaskTimeout)
+}
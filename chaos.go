@@ -0,0 +1,178 @@
+package go_playground
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// Chaos errors
+var (
+	// ErrChaos is the error of the failures injected by Chaos
+	ErrChaos = errors.New("injected failure")
+	// ErrChaosDisabled is returned by SetChaos on a pool without WithChaos
+	ErrChaosDisabled = errors.New("fault injection is not enabled on this pool")
+)
+
+// Chaos injects faults into handler runs, to check that retries, backoff,
+// dead-lettering and alerting behave under failure. Rates are the
+// probability, from 0 to 1, of each fault per attempt. The zero value
+// injects nothing
+type Chaos struct {
+	LatencyRate float64       `json:"latency_rate,omitempty"`
+	Latency     time.Duration `json:"latency,omitempty"` // added before the handler runs
+	FailureRate float64       `json:"failure_rate,omitempty"`
+	PanicRate   float64       `json:"panic_rate,omitempty"`
+	Types       []string      `json:"types,omitempty"` // task types affected, all when empty
+}
+
+// validate checks the rates and latency
+func (c Chaos) validate() error {
+	for name, rate := range map[string]float64{"latency_rate": c.LatencyRate, "failure_rate": c.FailureRate, "panic_rate": c.PanicRate} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("%s must be between 0 and 1, got %v", name, rate)
+		}
+	}
+	if c.Latency < 0 {
+		return errors.New("latency must not be negative")
+	}
+	return nil
+}
+
+// chaos holds the faults in effect on a pool with WithChaos
+type chaos struct {
+	cfg atomic.Pointer[Chaos]
+}
+
+// SetChaos replaces the faults injected while the pool runs, the zero
+// Chaos stopping them. It fails with ErrChaosDisabled unless the pool was
+// created WithChaos, so a production pool cannot be made to fail by
+// mistake
+func (p *WorkerPool) SetChaos(c Chaos) error {
+	if p.chaos == nil {
+		return ErrChaosDisabled
+	}
+	if err := c.validate(); err != nil {
+		return err
+	}
+	p.chaos.cfg.Store(&c)
+	p.log.Warn("fault injection changed", "latency_rate", c.LatencyRate, "latency", c.Latency,
+		"failure_rate", c.FailureRate, "panic_rate", c.PanicRate, "types", c.Types)
+	return nil
+}
+
+// Chaos returns the faults injected, and whether fault injection is
+// enabled at all
+func (p *WorkerPool) Chaos() (Chaos, bool) {
+	if p.chaos == nil {
+		return Chaos{}, false
+	}
+	return *p.chaos.cfg.Load(), true
+}
+
+// chaosHandler injects the faults of the pool before running next
+func (p *WorkerPool) chaosHandler(next TaskHandler) TaskHandler {
+	return TaskHandlerFunc(func(ctx context.Context, t Task) error {
+		c := p.chaos.cfg.Load()
+		if len(c.Types) > 0 && !slices.Contains(c.Types, t.Type) {
+			return next.Handle(ctx, t)
+		}
+		if c.Latency > 0 && rand.Float64() < c.LatencyRate {
+			p.metrics.chaosFaults.WithLabelValues("latency").Inc()
+			select {
+			case <-time.After(c.Latency):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if rand.Float64() < c.PanicRate {
+			p.metrics.chaosFaults.WithLabelValues("panic").Inc()
+			panic(ErrChaos)
+		}
+		if rand.Float64() < c.FailureRate {
+			p.metrics.chaosFaults.WithLabelValues("failure").Inc()
+			return ErrChaos
+		}
+		return next.Handle(ctx, t)
+	})
+}
+
+// chaosResponse is the body of GET and PUT /admin/chaos
+type chaosResponse struct {
+	Chaos
+	Latency string `json:"latency,omitempty"`
+}
+
+func newChaosResponse(c Chaos) chaosResponse {
+	r := chaosResponse{Chaos: c}
+	if c.Latency > 0 {
+		r.Latency = c.Latency.String()
+	}
+	return r
+}
+
+func (s *Server) getChaosHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	c, enabled := p.Chaos()
+	if !enabled {
+		writeError(w, http.StatusForbidden, ErrChaosDisabled.Error(), "")
+		return
+	}
+	writeJSON(w, http.StatusOK, newChaosResponse(c))
+}
+
+// setChaosHandler replaces the faults with the body, whose latency is a
+// duration string such as "500ms"
+func (s *Server) setChaosHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	var req chaosResponse
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		badRequest(w, malformedBody(err))
+		return
+	}
+	c := req.Chaos
+	if req.Latency != "" {
+		d, err := time.ParseDuration(req.Latency)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid latency: "+err.Error(), "latency")
+			return
+		}
+		c.Latency = d
+	}
+	s.applyChaos(w, r, p, c)
+}
+
+func (s *Server) clearChaosHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	s.applyChaos(w, r, p, Chaos{})
+}
+
+func (s *Server) applyChaos(w http.ResponseWriter, r *http.Request, p *WorkerPool, c Chaos) {
+	switch err := p.SetChaos(c); {
+	case errors.Is(err, ErrChaosDisabled):
+		writeError(w, http.StatusForbidden, err.Error(), "")
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err.Error(), "")
+	default:
+		resp := newChaosResponse(c)
+		s.audit(r, p, AuditChaos, map[string]any{"chaos": resp}, nil)
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
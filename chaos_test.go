@@ -0,0 +1,41 @@
+package go_playground
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestChaosInjectsFailuresAndPanics(t *testing.T) {
+	for name, c := range map[string]Chaos{
+		"failure": {FailureRate: 1},
+		"panic":   {PanicRate: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			process(t, startPool(t, WithChaos(c)), StateFailed, Task{})
+		})
+	}
+}
+
+func TestChaosOnlyAffectsItsTypes(t *testing.T) {
+	p := startPool(t, WithChaos(Chaos{FailureRate: 1, Types: []string{"flaky"}}))
+	process(t, p, StateFailed, Task{Type: "flaky"})
+	process(t, p, StateSucceeded, Task{Type: "steady"})
+}
+
+func TestSetChaos(t *testing.T) {
+	p := startPool(t, WithChaos(Chaos{FailureRate: 1}))
+	if err := p.SetChaos(Chaos{FailureRate: 1.5}); err == nil {
+		t.Error("SetChaos accepted a rate above 1")
+	}
+	if err := p.SetChaos(Chaos{}); err != nil {
+		t.Fatalf("SetChaos: %v", err)
+	}
+	if c, enabled := p.Chaos(); !enabled || c.FailureRate != 0 {
+		t.Errorf("Chaos() = %+v, %v, want no faults, enabled", c, enabled)
+	}
+	process(t, p, StateSucceeded, Task{})
+
+	if err := newPool(t).SetChaos(Chaos{FailureRate: 1}); !errors.Is(err, ErrChaosDisabled) {
+		t.Errorf("SetChaos without WithChaos = %v, want %v", err, ErrChaosDisabled)
+	}
+}
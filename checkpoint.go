@@ -0,0 +1,54 @@
+package go_playground
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNoTask is returned by Checkpoint outside of a pool handler
+var ErrNoTask = errors.New("no task in context")
+
+// checkpointer is implemented by durable backends that can update the
+// stored copy of a task they handed out, so a redelivery after a crash or
+// restart carries its latest checkpoint
+type checkpointer interface {
+	// SaveCheckpoint replaces the in-flight copy of t
+	SaveCheckpoint(t Task) error
+}
+
+// checkpointKey is the context key of the running task's checkpointSlot
+type checkpointKey struct{}
+
+type checkpointSlot struct {
+	p    *WorkerPool
+	mu   sync.Mutex
+	task *Task
+}
+
+// Checkpoint saves state for the task run with ctx. Later attempts, and a
+// redelivery by a durable backend after the process died, get it back in
+// Task.Checkpoint so a long task can resume instead of starting over. With
+// a backend that cannot store checkpoints the state only survives retries
+// within this process
+func Checkpoint(ctx context.Context, state string) error {
+	slot, ok := ctx.Value(checkpointKey{}).(*checkpointSlot)
+	if !ok {
+		return ErrNoTask
+	}
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+	slot.task.Checkpoint = state
+	slot.p.beat(slot.task.ID, time.Now())
+
+	c, ok := slot.p.queue.(checkpointer)
+	if !ok {
+		return nil
+	}
+	if err := c.SaveCheckpoint(*slot.task); err != nil {
+		slot.p.taskLogger(*slot.task).Error("saving checkpoint", "error", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+// Package client is a Go SDK of the HTTP API of the worker pool. Requests
+// failing with 429, a 5xx status or a network error are retried with
+// backoff, honoring Retry-After, and submissions carry an idempotency key
+// so a retry does not enqueue a task twice on servers deduplicating them
+// (WithIdempotencyTTL)
+package client
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound matches the errors of requests for unknown tasks or queues
+var ErrNotFound = errors.New("not found")
+
+// Retry configures how failed requests are tried again
+type Retry struct {
+	MaxAttempts int           // including the first, 1 disables retries
+	MinBackoff  time.Duration // before the second attempt, doubling after
+	MaxBackoff  time.Duration // also caps Retry-After
+}
+
+// DefaultRetry makes up to 4 attempts over a few seconds
+var DefaultRetry = Retry{MaxAttempts: 4, MinBackoff: 200 * time.Millisecond, MaxBackoff: 10 * time.Second}
+
+// backoff returns the wait before attempt n+1, with up to 20% jitter
+func (r Retry) backoff(n int) time.Duration {
+	d := r.MinBackoff << (n - 1)
+	if d <= 0 || d > r.MaxBackoff {
+		d = r.MaxBackoff
+	}
+	return d - time.Duration(rand.Int64N(int64(d)/5+1))
+}
+
+// Client calls the API of one server
+type Client struct {
+	base  string // server URL without a trailing slash
+	http  *http.Client
+	key   string
+	queue string
+	retry Retry
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends requests with hc instead of http.DefaultClient.
+// Keep its Timeout unset for StreamEvents
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithAPIKey authenticates requests with key
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.key = key
+	}
+}
+
+// WithQueue addresses the named queue instead of the default pool
+func WithQueue(name string) Option {
+	return func(c *Client) {
+		c.queue = name
+	}
+}
+
+// WithRetry replaces DefaultRetry
+func WithRetry(r Retry) Option {
+	return func(c *Client) {
+		c.retry = r
+	}
+}
+
+// New returns a client of the server at baseURL, such as
+// http://localhost:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{base: strings.TrimRight(baseURL, "/"), http: http.DefaultClient, retry: DefaultRetry}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.retry.MaxAttempts = max(c.retry.MaxAttempts, 1)
+	return c
+}
+
+// Error is returned for responses with an error status
+type Error struct {
+	StatusCode int
+	Message    string
+	Code       string       // stable code of the failure, such as task_not_found, empty from older servers
+	Field      string       // the invalid parameter or field, if any
+	Fields     []FieldError // set when a validator refused the task
+	RetryAfter time.Duration
+}
+
+// FieldError is an invalid field of a task refused by a validator
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	for _, f := range e.Fields {
+		msg += fmt.Sprintf("; %s: %s", f.Field, f.Message)
+	}
+	return msg
+}
+
+// Is makes 404 errors match ErrNotFound
+func (e *Error) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// retryable reports whether a response status is worth another attempt
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500 && status != http.StatusNotImplemented
+}
+
+// request describes a call, sent again as is on retries
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   any
+	accept string
+}
+
+// do sends req, retrying as configured, and returns the response once its
+// status is a success
+func (c *Client) do(ctx context.Context, req request) (*http.Response, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, fmt.Errorf("encoding the request body: %w", err)
+		}
+	}
+	u := c.base + req.path
+	if len(req.query) > 0 {
+		u += "?" + req.query.Encode()
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, req, u, body)
+		if err == nil {
+			return resp, nil
+		}
+		var wait time.Duration
+		var e *Error
+		switch {
+		case ctx.Err() != nil:
+			return nil, err
+		case errors.As(err, &e) && !retryable(e.StatusCode):
+			return nil, err
+		case attempt >= c.retry.MaxAttempts:
+			return nil, err
+		case e != nil && e.RetryAfter > 0:
+			wait = min(e.RetryAfter, c.retry.MaxBackoff)
+		default:
+			wait = c.retry.backoff(attempt)
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, err
+		case <-t.C:
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, req request, u string, body []byte) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	hr, err := http.NewRequestWithContext(ctx, req.method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range req.header {
+		hr.Header[name] = values
+	}
+	if body != nil {
+		hr.Header.Set("Content-Type", "application/json")
+	}
+	if req.accept != "" {
+		hr.Header.Set("Accept", req.accept)
+	}
+	if c.key != "" {
+		hr.Header.Set("X-API-Key", c.key)
+	}
+
+	resp, err := c.http.Do(hr)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	return nil, responseError(resp)
+}
+
+// responseError describes an error response, from its JSON body or text
+func responseError(resp *http.Response) *Error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	e := &Error{StatusCode: resp.StatusCode, RetryAfter: retryAfter(resp.Header.Get("Retry-After"))}
+	var body struct {
+		Error  string       `json:"error"`
+		Code   string       `json:"code"`
+		Field  string       `json:"field"`
+		Fields []FieldError `json:"fields"`
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt == "application/json" && json.Unmarshal(data, &body) == nil {
+		e.Message, e.Code, e.Field, e.Fields = body.Error, body.Code, body.Field, body.Fields
+	} else {
+		e.Message = strings.TrimSpace(string(data))
+	}
+	return e
+}
+
+// retryAfter reads a Retry-After header, in seconds or as an HTTP date
+func retryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// decodeJSON reads the JSON body of resp into out
+func decodeJSON(resp *http.Response, out any) error {
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding the response: %w", err)
+	}
+	return nil
+}
+
+// newIdempotencyKey returns a random key for a submission that has none
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	_, _ = crand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TaskEvent is a state transition or progress update of a task
+type TaskEvent struct {
+	Task     Task      `json:"task"`
+	State    State     `json:"state"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+	Progress *Progress `json:"progress,omitempty"`
+}
+
+// StreamOptions filters the events of StreamEvents
+type StreamOptions struct {
+	TaskIDs  []int // only these tasks, all when empty
+	Terminal bool  // only final states
+}
+
+// Stream reads task events pushed by the server
+type Stream struct {
+	body io.ReadCloser
+	r    *bufio.Reader
+}
+
+// StreamEvents subscribes to task events. Connecting is retried like other
+// requests, a dropped stream is not: Next then fails and the caller
+// subscribes again
+func (c *Client) StreamEvents(ctx context.Context, opts StreamOptions) (*Stream, error) {
+	q := url.Values{}
+	if len(opts.TaskIDs) > 0 {
+		ids := make([]string, len(opts.TaskIDs))
+		for i, id := range opts.TaskIDs {
+			ids[i] = strconv.Itoa(id)
+		}
+		q.Set("task_id", strings.Join(ids, ","))
+	}
+	if opts.Terminal {
+		q.Set("terminal", "true")
+	}
+	resp, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   c.path("/events/stream", "/events/stream"),
+		query:  q,
+		accept: "text/event-stream",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Stream{body: resp.Body, r: bufio.NewReader(resp.Body)}, nil
+}
+
+// Next blocks for the next event. It returns io.EOF once the server ends
+// the stream, and the error of the context once it is done
+func (s *Stream) Next() (TaskEvent, error) {
+	var data []byte
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return TaskEvent{}, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			if data == nil {
+				continue
+			}
+			var ev TaskEvent
+			if err := json.Unmarshal(data, &ev); err != nil {
+				return TaskEvent{}, fmt.Errorf("decoding event: %w", err)
+			}
+			return ev, nil
+		case strings.HasPrefix(line, ":"):
+			// keep-alive comment
+		default:
+			field, value, _ := strings.Cut(line, ":")
+			if field == "data" {
+				value = strings.TrimPrefix(value, " ")
+				if data != nil {
+					data = append(data, '\n')
+				}
+				data = append(data, value...)
+			}
+		}
+	}
+}
+
+// Close ends the subscription
+func (s *Stream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,437 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// State is a step in the task lifecycle
+type State string
+
+const (
+	StateQueued    State = "queued"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateCanceled  State = "canceled"
+)
+
+// Terminal reports whether the task will not change state anymore
+func (s State) Terminal() bool {
+	return s == StateSucceeded || s == StateFailed || s == StateCanceled
+}
+
+// Task is a unit of work as the server reports it
+type Task struct {
+	ID             int               `json:"id"`
+	Data           string            `json:"data"`
+	Priority       int               `json:"priority"`
+	RunAt          time.Time         `json:"run_at,omitzero"`
+	Delay          time.Duration     `json:"delay,omitzero"`
+	Timeout        time.Duration     `json:"timeout,omitzero"`
+	Attempts       int               `json:"attempts"`
+	ExpiresAt      time.Time         `json:"expires_at,omitzero"`
+	TTL            time.Duration     `json:"ttl,omitzero"`
+	Type           string            `json:"type,omitempty"`
+	PartitionKey   string            `json:"partition_key,omitempty"`
+	Tenant         string            `json:"tenant,omitempty"`
+	CorrelationID  string            `json:"correlation_id,omitempty"`
+	IdempotencyKey string            `json:"idempotency_key,omitempty"`
+	Queue          string            `json:"queue,omitempty"`
+	TraceContext   map[string]string `json:"trace_context,omitempty"`
+	Checkpoint     string            `json:"checkpoint,omitempty"`
+	CallbackURL    string            `json:"callback_url,omitempty"`
+	WorkflowID     string            `json:"workflow_id,omitempty"`
+	Step           string            `json:"step,omitempty"`
+	GroupID        string            `json:"group_id,omitempty"`
+	PayloadRef     string            `json:"payload_ref,omitempty"`
+	Weight         int               `json:"weight,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	SchemaVersion  int               `json:"schema_version,omitempty"`
+	DryRun         bool              `json:"dry_run,omitempty"`
+	DependsOn      []int             `json:"depends_on,omitempty"`
+	Hedge          bool              `json:"hedge,omitempty"`
+	UID            string            `json:"uid,omitempty"`
+}
+
+// Progress is how far along a running task is
+type Progress struct {
+	Percent   int       `json:"percent"`
+	Message   string    `json:"message,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TaskLog is a line logged by the handler of a task
+type TaskLog struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Attempt int               `json:"attempt"`
+	Attrs   map[string]string `json:"attrs,omitempty"`
+}
+
+// TaskRecord is a task with its current state
+type TaskRecord struct {
+	Task
+	State       State      `json:"state"`
+	Error       string     `json:"error,omitempty"`
+	Output      string     `json:"output,omitempty"`
+	HasResult   bool       `json:"has_result,omitempty"`
+	Progress    *Progress  `json:"progress,omitempty"`
+	Logs        []TaskLog  `json:"logs,omitempty"`
+	LogsDropped int        `json:"logs_dropped,omitempty"`
+	QueuedAt    time.Time  `json:"queued_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// Event describes a task to submit. Zero fields take the server defaults,
+// an empty Data included
+type Event struct {
+	Data         string
+	Priority     int
+	Delay        time.Duration // not run before this long after submission
+	Timeout      time.Duration // per attempt
+	TTL          time.Duration // dropped if still queued after this long
+	Queue        string        // ignored WithQueue
+	Type         string
+	PartitionKey string
+	Tenant       string
+	Weight       int // share of the pool capacity, see WithWeightedCapacity
+	Labels       map[string]string
+	CallbackURL  string
+	// SchemaVersion is the version of the shape of Data, the current one
+	// of the type on the server when zero
+	SchemaVersion int
+	// DryRun skips the handler, the task succeeding once routed
+	DryRun bool
+	// DependsOn are the IDs of tasks that must succeed before this one
+	// runs. It fails without running once one of them does not
+	DependsOn []int
+	// Hedge allows a second execution of an attempt running late, the
+	// handler tolerating duplicates
+	Hedge bool
+	// IdempotencyKey replaces the random key the submission is sent with
+	IdempotencyKey string
+}
+
+// eventBody is the JSON request of an Event
+type eventBody struct {
+	Data           *string           `json:"data,omitempty"`
+	Priority       *int              `json:"priority,omitempty"`
+	Delay          string            `json:"delay,omitempty"`
+	Timeout        string            `json:"timeout,omitempty"`
+	TTL            string            `json:"ttl,omitempty"`
+	Queue          string            `json:"queue,omitempty"`
+	Type           string            `json:"type,omitempty"`
+	PartitionKey   string            `json:"partition_key,omitempty"`
+	Tenant         string            `json:"tenant,omitempty"`
+	Weight         *int              `json:"weight,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	SchemaVersion  *int              `json:"schema_version,omitempty"`
+	DryRun         bool              `json:"dry_run,omitempty"`
+	DependsOn      []int             `json:"depends_on,omitempty"`
+	Hedge          bool              `json:"hedge,omitempty"`
+	IdempotencyKey string            `json:"idempotency_key,omitempty"`
+	CallbackURL    string            `json:"callback_url,omitempty"`
+}
+
+func (c *Client) body(ev Event) eventBody {
+	b := eventBody{
+		Queue:          ev.Queue,
+		Type:           ev.Type,
+		PartitionKey:   ev.PartitionKey,
+		Tenant:         ev.Tenant,
+		Labels:         ev.Labels,
+		IdempotencyKey: ev.IdempotencyKey,
+		CallbackURL:    ev.CallbackURL,
+		DryRun:         ev.DryRun,
+		DependsOn:      ev.DependsOn,
+		Hedge:          ev.Hedge,
+		Delay:          duration(ev.Delay),
+		Timeout:        duration(ev.Timeout),
+		TTL:            duration(ev.TTL),
+	}
+	if ev.Data != "" {
+		b.Data = &ev.Data
+	}
+	if ev.Priority != 0 {
+		b.Priority = &ev.Priority
+	}
+	if ev.Weight != 0 {
+		b.Weight = &ev.Weight
+	}
+	if ev.SchemaVersion != 0 {
+		b.SchemaVersion = &ev.SchemaVersion
+	}
+	if c.queue != "" {
+		b.Queue = ""
+	}
+	return b
+}
+
+func duration(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// path returns the path of an endpoint of the default pool, or its
+// counterpart under /queues/{name} WithQueue
+func (c *Client) path(defaultPath, queuePath string) string {
+	if c.queue == "" {
+		return defaultPath
+	}
+	return "/queues/" + url.PathEscape(c.queue) + queuePath
+}
+
+// Submit enqueues a task and returns its record. Retries reuse the
+// idempotency key of the first attempt
+func (c *Client) Submit(ctx context.Context, ev Event) (TaskRecord, error) {
+	key := ev.IdempotencyKey
+	if key == "" {
+		key = newIdempotencyKey()
+	}
+	resp, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   c.path("/event", "/events"),
+		header: http.Header{"Idempotency-Key": {key}},
+		body:   c.body(ev),
+		accept: "application/json",
+	})
+	if err != nil {
+		return TaskRecord{}, err
+	}
+	var rec TaskRecord
+	if err := decodeJSON(resp, &rec); err != nil {
+		return TaskRecord{}, err
+	}
+	return rec, nil
+}
+
+// SubmitBatch enqueues the tasks of a batch at once, all or none, and
+// returns their IDs in order. The batch is sent with one idempotency key,
+// which the server derives a key per event from
+func (c *Client) SubmitBatch(ctx context.Context, evs []Event) ([]int, error) {
+	bodies := make([]eventBody, len(evs))
+	for i, ev := range evs {
+		bodies[i] = c.body(ev)
+	}
+	resp, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   c.path("/events/batch", "/events/batch"),
+		header: http.Header{"Idempotency-Key": {newIdempotencyKey()}},
+		body:   bodies,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		IDs []int `json:"ids"`
+	}
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return out.IDs, nil
+}
+
+// GetStatus returns the record of a task, failing with an error matching
+// ErrNotFound for unknown ones
+func (c *Client) GetStatus(ctx context.Context, id int) (TaskRecord, error) {
+	resp, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   c.path("/event/", "/events/") + strconv.Itoa(id),
+	})
+	if err != nil {
+		return TaskRecord{}, err
+	}
+	var rec TaskRecord
+	if err := decodeJSON(resp, &rec); err != nil {
+		return TaskRecord{}, err
+	}
+	return rec, nil
+}
+
+// GetResult decodes the result the handler of a task set into v. It fails
+// with an error matching ErrNotFound for unknown tasks and those without a
+// result, and with an *Error of status 409 for tasks not finished yet
+func (c *Client) GetResult(ctx context.Context, id int, v any) error {
+	resp, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   c.path("/event/", "/events/") + strconv.Itoa(id) + "/result",
+	})
+	if err != nil {
+		return err
+	}
+	return decodeJSON(resp, v)
+}
+
+// WaitTask blocks until a task finishes, for up to timeout (at most a
+// minute, the server default of 30s when zero), and returns its record.
+// The record of a task still going past timeout is not Terminal
+func (c *Client) WaitTask(ctx context.Context, id int, timeout time.Duration) (TaskRecord, error) {
+	var query url.Values
+	if timeout > 0 {
+		query = url.Values{"timeout": {timeout.String()}}
+	}
+	resp, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   c.path("/event/", "/events/") + strconv.Itoa(id) + "/wait",
+		query:  query,
+	})
+	if err != nil {
+		return TaskRecord{}, err
+	}
+	var rec TaskRecord
+	if err := decodeJSON(resp, &rec); err != nil {
+		return TaskRecord{}, err
+	}
+	return rec, nil
+}
+
+// Query selects tasks. Empty fields match every task
+type Query struct {
+	Labels map[string]string // every one must be carried by the task
+	State  State
+	Type   string
+	Tenant string
+	Queue  string
+	UID    string // when the server gives tasks one
+	// Since and Until bound the time the tasks were queued
+	Since time.Time
+	Until time.Time
+	Desc  bool // lists the newest tasks first
+	Limit int  // tasks listed or acted on at most, zero for the server default
+}
+
+func (q Query) values() url.Values {
+	v := url.Values{}
+	for k, val := range q.Labels {
+		v.Add("label", k+":"+val)
+	}
+	if q.State != "" {
+		v.Set("status", string(q.State))
+	}
+	if q.Type != "" {
+		v.Set("type", q.Type)
+	}
+	if q.Tenant != "" {
+		v.Set("tenant", q.Tenant)
+	}
+	if q.Queue != "" {
+		v.Set("queue", q.Queue)
+	}
+	if q.UID != "" {
+		v.Set("uid", q.UID)
+	}
+	if !q.Since.IsZero() {
+		v.Set("since", q.Since.Format(time.RFC3339Nano))
+	}
+	if !q.Until.IsZero() {
+		v.Set("until", q.Until.Format(time.RFC3339Nano))
+	}
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	return v
+}
+
+// ListTasks returns a page of the records of the tasks matching q, by
+// ascending ID or descending with q.Desc, and the cursor of the next page,
+// empty on the last one. Pass an empty cursor for the first page
+func (c *Client) ListTasks(ctx context.Context, q Query, cursor string) ([]TaskRecord, string, error) {
+	query := q.values()
+	if q.Desc {
+		query.Set("sort", "-id")
+	}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	resp, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   c.path("/events", "/events"),
+		query:  query,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	var recs []TaskRecord
+	if err := decodeJSON(resp, &recs); err != nil {
+		return nil, "", err
+	}
+	return recs, resp.Header.Get("X-Next-Cursor"), nil
+}
+
+// BulkTask is a task a bulk operation acted on, Error telling why it
+// failed for this one
+type BulkTask struct {
+	ID    int    `json:"id"`
+	Error string `json:"error,omitempty"`
+}
+
+// CancelTasks cancels the queued and running tasks matching q, which needs
+// at least one filter. The server asks for a confirmation, which is given
+func (c *Client) CancelTasks(ctx context.Context, q Query) ([]BulkTask, error) {
+	return c.confirmedBulk(ctx, "/events/cancel", q)
+}
+
+// PurgeTasks drops the queued tasks matching q, every queued task without
+// a filter. The server asks for a confirmation, which is given
+func (c *Client) PurgeTasks(ctx context.Context, q Query) ([]BulkTask, error) {
+	return c.confirmedBulk(ctx, "/purge", q)
+}
+
+// confirmedBulk makes a bulk request, then makes it again with the
+// confirmation token the server answered with
+func (c *Client) confirmedBulk(ctx context.Context, path string, q Query) ([]BulkTask, error) {
+	resp, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   c.path(path, path),
+		query:  q.values(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var preview struct {
+		ConfirmToken string `json:"confirm_token"`
+	}
+	if err := decodeJSON(resp, &preview); err != nil {
+		return nil, err
+	}
+	query := q.values()
+	query.Set("confirm", preview.ConfirmToken)
+	return c.bulkQuery(ctx, path, query)
+}
+
+// RetryTasks queues again the failed tasks matching q, which needs at
+// least one filter
+func (c *Client) RetryTasks(ctx context.Context, q Query) ([]BulkTask, error) {
+	return c.bulk(ctx, "/events/retry", q)
+}
+
+func (c *Client) bulk(ctx context.Context, path string, q Query) ([]BulkTask, error) {
+	return c.bulkQuery(ctx, path, q.values())
+}
+
+func (c *Client) bulkQuery(ctx context.Context, path string, query url.Values) ([]BulkTask, error) {
+	resp, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   c.path(path, path),
+		query:  query,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Tasks []BulkTask `json:"tasks"`
+	}
+	if err := decodeJSON(resp, &out); err != nil {
+		return nil, err
+	}
+	return out.Tasks, nil
+}
@@ -0,0 +1,173 @@
+package go_playground
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Clock tells the pool the time and waits for it, see WithClock. It drives
+// delays, expiry, timeouts, retry backoff, recurring schedules and the
+// times of task records. Handler durations are always measured in real
+// time
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer of a Clock
+type Timer interface {
+	// C receives the time once the timer fires
+	C() <-chan time.Time
+	// Stop prevents the timer from firing, reporting whether it stopped it
+	Stop() bool
+}
+
+// realClock is the Clock of the time package
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.t.C }
+func (t realTimer) Stop() bool          { return t.t.Stop() }
+
+// until returns the time left until t on the pool clock
+func (p *WorkerPool) until(t time.Time) time.Duration {
+	return t.Sub(p.clock.Now())
+}
+
+// sleep waits d on the pool clock, reporting false when ctx ends first
+func (p *WorkerPool) sleep(ctx context.Context, d time.Duration) bool {
+	t := p.clock.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// withTimeoutCause is context.WithTimeoutCause on the pool clock. Contexts
+// timed by another clock than the real one report no deadline
+func (p *WorkerPool) withTimeoutCause(ctx context.Context, d time.Duration, cause error) (context.Context, context.CancelFunc) {
+	if _, ok := p.clock.(realClock); ok {
+		return context.WithTimeoutCause(ctx, d, cause)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	t := p.clock.NewTimer(d)
+	go func() {
+		defer t.Stop()
+		select {
+		case <-t.C():
+			cancel(cause)
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+// FakeClock is a Clock that only moves when told to, for tests of backoff,
+// delays, expiry and schedules. Timers due after Advance or Set fire in
+// order of their due time
+type FakeClock struct {
+	mu      sync.Mutex
+	changed *sync.Cond // broadcast when timers are added
+	now     time.Time
+	timers  []*fakeTimer
+}
+
+// NewFakeClock returns a clock standing at start
+func NewFakeClock(start time.Time) *FakeClock {
+	c := &FakeClock{now: start}
+	c.changed = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now implements Clock
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer implements Clock. A timer of d <= 0 fires right away
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{c: c, at: c.now.Add(d), ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.ch <- c.now
+		return t
+	}
+	c.timers = append(c.timers, t)
+	c.changed.Broadcast()
+	return t
+}
+
+// Advance moves the clock forward by d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the clock to t, firing the timers due by then. It never moves
+// backwards
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.Before(c.now) {
+		return
+	}
+	c.now = t
+	slices.SortStableFunc(c.timers, func(a, b *fakeTimer) int { return a.at.Compare(b.at) })
+	n := 0
+	for _, ft := range c.timers {
+		if ft.at.After(t) {
+			break
+		}
+		ft.ch <- ft.at
+		n++
+	}
+	c.timers = slices.Delete(c.timers, 0, n)
+}
+
+// BlockUntil waits until at least n timers are pending, so a test can
+// advance the clock once the pool is waiting on it
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) < n {
+		c.changed.Wait()
+	}
+}
+
+// Timers returns the number of pending timers
+func (c *FakeClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+type fakeTimer struct {
+	c  *FakeClock
+	at time.Time
+	ch chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	i := slices.Index(t.c.timers, t)
+	if i < 0 {
+		return false
+	}
+	t.c.timers = slices.Delete(t.c.timers, i, i+1)
+	return true
+}
@@ -0,0 +1,94 @@
+package go_playground
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var clockStart = time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+
+func TestFakeClockFiresTimersInOrder(t *testing.T) {
+	c := NewFakeClock(clockStart)
+	late, early, stopped := c.NewTimer(2*time.Minute), c.NewTimer(time.Minute), c.NewTimer(time.Minute)
+	if !stopped.Stop() {
+		t.Error("Stop of a pending timer reported false")
+	}
+
+	c.Advance(30 * time.Second)
+	select {
+	case <-early.C():
+		t.Fatal("timer fired before its time")
+	default:
+	}
+	c.Advance(time.Hour)
+	if at := <-early.C(); !at.Equal(clockStart.Add(time.Minute)) {
+		t.Errorf("early timer fired at %v, want %v", at, clockStart.Add(time.Minute))
+	}
+	if at := <-late.C(); !at.Equal(clockStart.Add(2 * time.Minute)) {
+		t.Errorf("late timer fired at %v, want %v", at, clockStart.Add(2*time.Minute))
+	}
+	select {
+	case <-stopped.C():
+		t.Error("stopped timer fired")
+	default:
+	}
+	if late.Stop() || c.Timers() != 0 {
+		t.Errorf("Stop of a fired timer reported true or %d timers left", c.Timers())
+	}
+
+	c.Set(clockStart)
+	if now := c.Now(); !now.Equal(clockStart.Add(time.Hour + 30*time.Second)) {
+		t.Errorf("Set moved the clock back to %v", now)
+	}
+	select {
+	case <-c.NewTimer(0).C():
+	default:
+		t.Error("timer of no duration did not fire right away")
+	}
+}
+
+// failingFirst fails the first attempt of the handler and runs the others
+func failingFirst() Option {
+	var attempts atomic.Int64
+	return handle(func(Task) error {
+		if attempts.Add(1) == 1 {
+			return errBroken
+		}
+		return nil
+	})
+}
+
+func TestFakeClockDrivesRetryBackoff(t *testing.T) {
+	c := NewFakeClock(clockStart)
+	p := startPool(t, WithClock(c), failingFirst(), WithRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Hour, MaxBackoff: time.Hour, Multiplier: 2}))
+	task := submit(t, p, Task{})[0]
+
+	c.BlockUntil(1)
+	if rec, _ := p.Status(task.ID); rec.State == StateSucceeded {
+		t.Fatal("task retried before the backoff passed")
+	}
+	c.Advance(time.Hour)
+	if rec := waitState(t, p, task.ID); rec.State != StateSucceeded {
+		t.Errorf("task %s after the backoff, want %s", rec.State, StateSucceeded)
+	}
+}
+
+func TestFakeClockDrivesDelayedTasks(t *testing.T) {
+	c := NewFakeClock(clockStart)
+	p := startPool(t, WithClock(c), failingFirst(), WithRetryPolicy(RetryPolicy{MaxAttempts: 2}))
+	task := submit(t, p, Task{RunAt: clockStart.Add(time.Hour)})[0]
+	if rec, _ := p.Status(task.ID); !rec.QueuedAt.Equal(clockStart) {
+		t.Errorf("queued at %v, want the fake time %v", rec.QueuedAt, clockStart)
+	}
+
+	c.BlockUntil(1)
+	if rec, _ := p.Status(task.ID); rec.State != StateQueued {
+		t.Fatalf("task %s before its RunAt, want %s", rec.State, StateQueued)
+	}
+	c.Advance(time.Hour)
+	// The failed first attempt retries at once without a backoff
+	if rec := waitState(t, p, task.ID); rec.State != StateSucceeded {
+		t.Errorf("task %s after its RunAt, want %s", rec.State, StateSucceeded)
+	}
+}
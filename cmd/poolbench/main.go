@@ -0,0 +1,178 @@
+// Command poolbench measures how many tasks per second a WorkerPool can
+// take in and run, with a handler that does nothing, so the numbers show
+// the overhead of the pool itself
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pool "playground"
+)
+
+func main() {
+	tasks := flag.Int("tasks", 200_000, "tasks per run")
+	producers := flag.Int("producers", runtime.GOMAXPROCS(0), "goroutines submitting tasks")
+	workers := flag.Int("workers", runtime.GOMAXPROCS(0), "pool workers")
+	queueSize := flag.Int("queue-size", 10_000, "in-memory queue capacity")
+	batch := flag.Int("batch", 0, "submit with SubmitBatch in batches of this size, one by one when zero")
+	work := flag.Duration("work", 0, "time each task spends in the handler")
+	steal := flag.Int("steal", 0, "use work stealing with local queues of this size, a shared channel when zero")
+	runs := flag.Int("runs", 3, "runs to average")
+	cpuProfile := flag.String("cpuprofile", "", "write a CPU profile to this file")
+	flag.Parse()
+
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fatal(err)
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	fmt.Printf("%d tasks, %d producers, %d workers, queue %d, batch %d, work %s, steal %d\n",
+		*tasks, *producers, *workers, *queueSize, *batch, *work, *steal)
+	var enqueue, total, allocs float64
+	for i := range *runs {
+		r, err := run(config{
+			tasks:     *tasks,
+			producers: *producers,
+			workers:   *workers,
+			queueSize: *queueSize,
+			batch:     *batch,
+			work:      *work,
+			steal:     *steal,
+		})
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Printf("run %d: enqueue %10.0f tasks/s, end to end %10.0f tasks/s, %5.1f allocs/task, %6.0f B/task, %s\n",
+			i+1, r.enqueueRate(), r.totalRate(), r.allocsPerTask(), r.bytesPerTask(), r.total.Round(time.Millisecond))
+		enqueue += r.enqueueRate()
+		total += r.totalRate()
+		allocs += r.allocsPerTask()
+	}
+	fmt.Printf("mean:  enqueue %10.0f tasks/s, end to end %10.0f tasks/s, %5.1f allocs/task\n",
+		enqueue/float64(*runs), total/float64(*runs), allocs/float64(*runs))
+}
+
+type config struct {
+	tasks, producers, workers, queueSize, batch, steal int
+	work                                               time.Duration
+}
+
+type result struct {
+	tasks   int
+	enqueue time.Duration // until the last task was accepted
+	total   time.Duration // until the last task was run
+	mallocs uint64        // heap allocations while submitting and running
+	bytes   uint64        // heap bytes allocated meanwhile
+}
+
+func (r result) enqueueRate() float64   { return float64(r.tasks) / r.enqueue.Seconds() }
+func (r result) totalRate() float64     { return float64(r.tasks) / r.total.Seconds() }
+func (r result) allocsPerTask() float64 { return float64(r.mallocs) / float64(r.tasks) }
+func (r result) bytesPerTask() float64  { return float64(r.bytes) / float64(r.tasks) }
+
+// run submits cfg.tasks tasks from cfg.producers goroutines and waits for
+// the workers to run them all
+func run(cfg config) (result, error) {
+	var done sync.WaitGroup
+	done.Add(cfg.tasks)
+	handler := pool.TaskHandlerFunc(func(ctx context.Context, t pool.Task) error {
+		if cfg.work > 0 {
+			time.Sleep(cfg.work)
+		}
+		done.Done()
+		return nil
+	})
+	opts := []pool.Option{
+		pool.WithWorkers(cfg.workers),
+		pool.WithQueueSize(cfg.queueSize),
+		pool.WithHandler(handler),
+		// A full queue makes producers wait instead of failing
+		pool.WithOverflowPolicy(pool.OverflowBlock, 0),
+		pool.WithLogger(slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelWarn}))),
+	}
+	if cfg.steal > 0 {
+		opts = append(opts, pool.WithWorkStealing(pool.WorkStealing{LocalQueue: cfg.steal}))
+	}
+	p := pool.NewWorkerPool(opts...)
+	p.Start()
+	defer p.Shutdown(context.Background())
+
+	var next atomic.Int64
+	var failed atomic.Value
+	var producers sync.WaitGroup
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for range cfg.producers {
+		producers.Add(1)
+		go func() {
+			defer producers.Done()
+			if err := produce(p, cfg, &next); err != nil {
+				failed.CompareAndSwap(nil, err)
+			}
+		}()
+	}
+	producers.Wait()
+	enqueued := time.Since(start)
+	if err, ok := failed.Load().(error); ok {
+		return result{}, err
+	}
+	done.Wait()
+	total := time.Since(start)
+	runtime.ReadMemStats(&after)
+	return result{
+		tasks:   cfg.tasks,
+		enqueue: enqueued,
+		total:   total,
+		mallocs: after.Mallocs - before.Mallocs,
+		bytes:   after.TotalAlloc - before.TotalAlloc,
+	}, nil
+}
+
+// produce submits tasks until next reaches cfg.tasks
+func produce(p *pool.WorkerPool, cfg config, next *atomic.Int64) error {
+	if cfg.batch <= 0 {
+		for next.Add(1) <= int64(cfg.tasks) {
+			if _, err := p.Submit(pool.Task{Data: "bench"}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	batch := make([]pool.Task, cfg.batch)
+	for i := range batch {
+		batch[i] = pool.Task{Data: "bench"}
+	}
+	for {
+		end := next.Add(int64(cfg.batch))
+		n := cfg.batch - int(max(0, end-int64(cfg.tasks)))
+		if n <= 0 {
+			return nil
+		}
+		if _, err := p.SubmitBatch(batch[:n]); err != nil {
+			return err
+		}
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "poolbench:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// apiKeyHeader matches go_playground.APIKeyHeader
+const apiKeyHeader = "X-API-Key"
+
+// client sends requests to the HTTP API of cmd/server
+type client struct {
+	base  string // server URL without a trailing slash
+	queue string // named queue, empty for the default pool
+	key   string // API key, if the server requires one
+	gzip  bool   // compress request bodies
+	http  *http.Client
+}
+
+// apiError is the JSON error body returned by the server
+type apiError struct {
+	Error  string `json:"error"`
+	Field  string `json:"field,omitempty"`
+	Fields []struct {
+		Field   string `json:"field"`
+		Message string `json:"message"`
+	} `json:"fields,omitempty"` // set when a validator refused the task
+}
+
+// path prefixes a pool-level route with the queue, if any
+func (c *client) path(p string) string {
+	if c.queue == "" {
+		return p
+	}
+	return "/queues/" + url.PathEscape(c.queue) + p
+}
+
+// eventPath returns the route of one task, which is named differently
+// under a queue
+func (c *client) eventPath(id int) string {
+	if c.queue == "" {
+		return fmt.Sprintf("/event/%d", id)
+	}
+	return c.path(fmt.Sprintf("/events/%d", id))
+}
+
+// do sends a request with an optional JSON body and returns the response
+// body on success. Error responses become errors with the server message
+func (c *client) do(method, path string, query url.Values, body any) ([]byte, error) {
+	resp, err := c.send(method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, responseError(resp.StatusCode, data)
+	}
+	return data, nil
+}
+
+// list fetches every page of a listing, following the cursor of each
+// page, and returns the items as one JSON array
+func (c *client) list(path string, query url.Values) ([]byte, error) {
+	query = maps.Clone(query)
+	if query == nil {
+		query = url.Values{}
+	}
+	items := []json.RawMessage{}
+	for {
+		resp, err := c.send(http.MethodGet, path, query, nil)
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= 300 {
+			return nil, responseError(resp.StatusCode, data)
+		}
+		var page []json.RawMessage
+		if err := json.Unmarshal(data, &page); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", path, err)
+		}
+		items = append(items, page...)
+		cursor := resp.Header.Get("X-Next-Cursor")
+		if cursor == "" {
+			return json.Marshal(items)
+		}
+		query.Set("cursor", cursor)
+	}
+}
+
+// send sends a request and leaves reading the response to the caller
+func (c *client) send(method, path string, query url.Values, body any) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		if c.gzip {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			_, _ = zw.Write(b)
+			_ = zw.Close()
+			b = buf.Bytes()
+		}
+		r = bytes.NewReader(b)
+	}
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+		if c.gzip {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+	}
+	// Actions answer with a line of text rather than their JSON envelope
+	req.Header.Set("Accept", "text/plain, application/json;q=0.9")
+	if c.key != "" {
+		req.Header.Set(apiKeyHeader, c.key)
+	}
+	return c.http.Do(req)
+}
+
+// responseError turns an error response into an error, using the message
+// of a JSON apiError when there is one
+func responseError(status int, body []byte) error {
+	var e apiError
+	if json.Unmarshal(body, &e) == nil && e.Error != "" {
+		if len(e.Fields) > 0 {
+			msgs := make([]string, len(e.Fields))
+			for i, f := range e.Fields {
+				msgs[i] = "\n  " + f.Field + ": " + f.Message
+			}
+			return fmt.Errorf("%s: task refused%s", http.StatusText(status), strings.Join(msgs, ""))
+		}
+		if e.Field != "" {
+			return fmt.Errorf("%s: %s (%s)", http.StatusText(status), e.Error, e.Field)
+		}
+		return fmt.Errorf("%s: %s", http.StatusText(status), e.Error)
+	}
+	return fmt.Errorf("%s: %s", http.StatusText(status), strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,845 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBatchSize matches the limit of POST /events/batch
+const maxBatchSize = 1000
+
+// command is a poolctl subcommand
+type command struct {
+	usage string // arguments, after the command name
+	help  string
+	run   func(c *client, args []string) error
+}
+
+var commands = map[string]command{
+	"submit":     {"[-priority p] [-type t] [-partition-key k] [-weight n] [-delay d] [-timeout d] [-ttl d] [-dry-run] [-hedge] [-after id,...] [-wait d] [-lines] [file...]", "submit one task per file, or per line with -lines; reads stdin without files", submit},
+	"status":     {"id...", "print task records", status},
+	"cancel":     {"id...", "cancel tasks", cancel},
+	"purge":      {"[-type t] [-tenant t] [-label k:v]... [-older-than d] [-yes]", "drop the queued tasks matching the filters, every queued task without one, after confirming", purge},
+	"logs":       {"id...", "print the lines logged by the handler of tasks", logs},
+	"tail":       {"[-task id,...] [-terminal]", "print task events as they happen", tail},
+	"queues":     {"", "list the queues", queues},
+	"deadletter": {"list | retry id... | purge", "inspect and retry dead-lettered tasks", deadLetter},
+	"schedules":  {"list | get name | put [-data d] [-type t] [-priority n] [-timeout d] [-ttl d] name cron | delete name", "manage recurring tasks", schedules},
+	"replay":     {"[-from deadletter|archive] [-since t] [-until t] [-from-queue q] [-error text] [-state s] [-limit n] [-dry-run]", "submit again dead-lettered or archived tasks, after fixing their handler", replay},
+	"admin":      {"", "print the pool and worker status", admin},
+	"pause":      {"", "stop workers from taking new tasks", pause},
+	"resume":     {"", "let workers take tasks again", resume},
+	"snapshot":   {"export [-o file] | import file", "save the queued tasks, schedules and paused state to a file, or load such a file into a pool", snapshot},
+	"resize":     {"workers", "change the number of workers", resize},
+	"audit":      {"[-since t] [-until t] [-action a] [-actor a] [-limit n]", "print the administrative actions recorded by the server, of -queue only when set", audit},
+	"usage":      {"[-period p] [-group-by queue,tenant,type]", "print the wall and CPU time of the attempts per queue, tenant and type, of -queue only when set", usageCmd},
+	"recovery":   {"[-run] [-repair]", "print the last recovery report, or run a pass with -run, repairing the issues found with -repair", recovery},
+	"chaos":      {"[off | -failure-rate r] [-panic-rate r] [-latency d] [-latency-rate r] [-types t,...]", "print or change the faults injected into handlers, on a server with chaos enabled", chaosCmd},
+}
+
+// submitEvent is the body of POST /event
+type submitEvent struct {
+	Data    string `json:"data"`
+	Type    string `json:"type,omitempty"`
+	Key     string `json:"partition_key,omitempty"`
+	Weight  int    `json:"weight,omitempty"`
+	Delay   string `json:"delay,omitempty"`
+	Timeout string `json:"timeout,omitempty"`
+	TTL     string `json:"ttl,omitempty"`
+	DryRun  bool   `json:"dry_run,omitempty"`
+	Hedge   bool   `json:"hedge,omitempty"`
+	After   []int  `json:"depends_on,omitempty"`
+}
+
+func submit(c *client, args []string) error {
+	fs := flag.NewFlagSet("submit", flag.ExitOnError)
+	priority := fs.String("priority", "", "low, normal, high or a number")
+	typ := fs.String("type", "", "task type, for per-type concurrency limits")
+	key := fs.String("partition-key", "", "run the tasks in order with others of this key")
+	weight := fs.Int("weight", 0, "share of the pool capacity each task takes")
+	delay := fs.Duration("delay", 0, "run the tasks after this long")
+	timeout := fs.Duration("timeout", 0, "per-attempt timeout")
+	ttl := fs.Duration("ttl", 0, "drop the tasks if they have not started within this long")
+	dryRun := fs.Bool("dry-run", false, "skip the handler, the tasks succeeding once routed")
+	hedge := fs.Bool("hedge", false, "allow a second execution of late attempts, for handlers tolerating duplicates")
+	after := fs.String("after", "", "comma-separated IDs of tasks that must succeed before the tasks run")
+	wait := fs.Duration("wait", 0, "wait up to this long for each task and print its record")
+	lines := fs.Bool("lines", false, "submit one task per non-empty line, in batches")
+	fs.Parse(args)
+	if *lines && *wait > 0 {
+		return errors.New("-wait cannot be combined with -lines")
+	}
+
+	base := submitEvent{Type: *typ, Key: *key, Weight: *weight, Delay: durationParam(*delay), Timeout: durationParam(*timeout), TTL: durationParam(*ttl), DryRun: *dryRun, Hedge: *hedge}
+	if *after != "" {
+		ids, err := taskIDs(strings.Split(*after, ","))
+		if err != nil {
+			return fmt.Errorf("-after: %w", err)
+		}
+		base.After = ids
+	}
+	query := url.Values{}
+	if *priority != "" {
+		query.Set("priority", *priority)
+	}
+
+	inputs := fs.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	var batch []submitEvent
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		body, err := c.do(http.MethodPost, c.path("/events/batch"), query, batch)
+		if err != nil {
+			return err
+		}
+		var resp struct {
+			IDs []int `json:"ids"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return fmt.Errorf("decoding batch response: %w", err)
+		}
+		for _, id := range resp.IDs {
+			fmt.Println(id)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for _, name := range inputs {
+		data, err := readInput(name)
+		if err != nil {
+			return err
+		}
+		if !*lines {
+			ev := base
+			ev.Data = strings.TrimSuffix(string(data), "\n")
+			if err := submitOne(c, ev, query, *wait); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			continue
+		}
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		sc.Buffer(nil, len(data)+1)
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" {
+				continue
+			}
+			ev := base
+			ev.Data = line
+			batch = append(batch, ev)
+			if len(batch) == maxBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return flush()
+}
+
+// submitOne submits a task and prints its ID, or its record with wait
+func submitOne(c *client, ev submitEvent, query url.Values, wait time.Duration) error {
+	path := c.path("/events")
+	if c.queue == "" {
+		path = "/event"
+	}
+	if wait > 0 {
+		query = cloneValues(query)
+		query.Set("wait", wait.String())
+	}
+	body, err := c.do(http.MethodPost, path, query, ev)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return printJSON(body)
+	}
+	// "Event N added to queue", or delayed, waiting or shed
+	fields := strings.Fields(string(body))
+	if len(fields) > 1 {
+		if _, err := strconv.Atoi(fields[1]); err == nil {
+			fmt.Println(fields[1])
+			return nil
+		}
+	}
+	fmt.Print(string(body))
+	return nil
+}
+
+func status(c *client, args []string) error {
+	ids, err := taskIDs(args)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		body, err := c.do(http.MethodGet, c.eventPath(id), nil, nil)
+		if err != nil {
+			return fmt.Errorf("task %d: %w", id, err)
+		}
+		if err := printJSON(body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func logs(c *client, args []string) error {
+	ids, err := taskIDs(args)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		body, err := c.do(http.MethodGet, c.eventPath(id)+"/logs", nil, nil)
+		if err != nil {
+			return fmt.Errorf("task %d: %w", id, err)
+		}
+		var resp struct {
+			Logs []struct {
+				Time    time.Time         `json:"time"`
+				Level   string            `json:"level"`
+				Message string            `json:"message"`
+				Attempt int               `json:"attempt"`
+				Attrs   map[string]string `json:"attrs"`
+			} `json:"logs"`
+			Dropped int `json:"dropped"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return fmt.Errorf("decoding logs of task %d: %w", id, err)
+		}
+		if resp.Dropped > 0 {
+			fmt.Printf("task %d: %d older lines dropped\n", id, resp.Dropped)
+		}
+		for _, l := range resp.Logs {
+			line := fmt.Sprintf("%s %-5s task=%d attempt=%d %s", l.Time.Format(time.RFC3339Nano), l.Level, id, l.Attempt, l.Message)
+			for _, k := range slices.Sorted(maps.Keys(l.Attrs)) {
+				line += " " + k + "=" + strconv.Quote(l.Attrs[k])
+			}
+			fmt.Println(line)
+		}
+	}
+	return nil
+}
+
+func cancel(c *client, args []string) error {
+	ids, err := taskIDs(args)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		body, err := c.do(http.MethodDelete, c.eventPath(id), nil, nil)
+		if err != nil {
+			return fmt.Errorf("task %d: %w", id, err)
+		}
+		fmt.Print(string(body))
+	}
+	return nil
+}
+
+func purge(c *client, args []string) error {
+	fs := flag.NewFlagSet("purge", flag.ExitOnError)
+	query := url.Values{}
+	fs.Func("type", "only tasks of this type", func(s string) error { query.Set("type", s); return nil })
+	fs.Func("tenant", "only tasks of this tenant", func(s string) error { query.Set("tenant", s); return nil })
+	fs.Func("label", "only tasks carrying this key:value label, repeated for several", func(s string) error { query.Add("label", s); return nil })
+	fs.Func("older-than", "only tasks queued longer ago than this, such as 1h", func(s string) error { query.Set("older_than", s); return nil })
+	yes := fs.Bool("yes", false, "purge without asking")
+	fs.Parse(args)
+
+	body, err := c.do(http.MethodPost, c.path("/purge"), query, nil)
+	if err != nil {
+		return err
+	}
+	var preview struct {
+		Matched      int    `json:"matched"`
+		Sample       []int  `json:"sample"`
+		ConfirmToken string `json:"confirm_token"`
+	}
+	if err := json.Unmarshal(body, &preview); err != nil {
+		return fmt.Errorf("decoding purge preview: %w", err)
+	}
+	fmt.Printf("%d queued tasks match, such as %v\n", preview.Matched, preview.Sample)
+	if !*yes {
+		fmt.Print("Purge them? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			return errors.New("purge aborted")
+		}
+	}
+	query.Set("confirm", preview.ConfirmToken)
+	if body, err = c.do(http.MethodPost, c.path("/purge"), query, nil); err != nil {
+		return err
+	}
+	var resp struct {
+		Tasks []struct{ ID int } `json:"tasks"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("decoding purge response: %w", err)
+	}
+	fmt.Printf("%d tasks purged\n", len(resp.Tasks))
+	return nil
+}
+
+func tail(c *client, args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	tasks := fs.String("task", "", "comma-separated task IDs to follow, all tasks when empty")
+	terminal := fs.Bool("terminal", false, "only print final states")
+	fs.Parse(args)
+
+	query := url.Values{}
+	if *tasks != "" {
+		query.Set("task_id", *tasks)
+	}
+	if *terminal {
+		query.Set("terminal", "true")
+	}
+	resp, err := c.send(http.MethodGet, c.path("/events/stream"), query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return responseError(resp.StatusCode, body)
+	}
+
+	// Print the data of each event, one JSON object per line
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		if data, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+			fmt.Println(data)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return errors.New("stream closed by the server")
+}
+
+func queues(c *client, args []string) error {
+	body, err := c.do(http.MethodGet, "/queues", nil, nil)
+	if err != nil {
+		return err
+	}
+	var qs []struct {
+		Name        string `json:"name"`
+		Workers     int    `json:"workers"`
+		BusyWorkers int    `json:"busy_workers"`
+		QueueDepth  int    `json:"queue_depth"`
+		Paused      bool   `json:"paused"`
+	}
+	if err := json.Unmarshal(body, &qs); err != nil {
+		return fmt.Errorf("decoding queues: %w", err)
+	}
+	fmt.Printf("%-20s %8s %6s %8s %s\n", "NAME", "WORKERS", "BUSY", "DEPTH", "PAUSED")
+	for _, q := range qs {
+		fmt.Printf("%-20s %8d %6d %8d %t\n", q.Name, q.Workers, q.BusyWorkers, q.QueueDepth, q.Paused)
+	}
+	return nil
+}
+
+func deadLetter(c *client, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	switch args[0] {
+	case "list":
+		body, err := c.list(c.path("/deadletter"), nil)
+		if err != nil {
+			return err
+		}
+		return printJSON(body)
+	case "retry":
+		ids, err := taskIDs(args[1:])
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			body, err := c.do(http.MethodPost, c.path(fmt.Sprintf("/deadletter/%d/retry", id)), nil, nil)
+			if err != nil {
+				return fmt.Errorf("task %d: %w", id, err)
+			}
+			fmt.Print(string(body))
+		}
+		return nil
+	case "purge":
+		body, err := c.do(http.MethodDelete, c.path("/deadletter"), nil, nil)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(body))
+		return nil
+	}
+	return fmt.Errorf("unknown deadletter command %q, want list, retry or purge", args[0])
+}
+
+// scheduleRequest is the body of PUT /schedules/{name}
+type scheduleRequest struct {
+	Cron string        `json:"cron"`
+	Task scheduledTask `json:"task"`
+}
+
+type scheduledTask struct {
+	Data     string `json:"data,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Priority *int   `json:"priority,omitempty"`
+	Timeout  string `json:"timeout,omitempty"`
+	TTL      string `json:"ttl,omitempty"`
+}
+
+func schedules(c *client, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	name := func(args []string) (string, error) {
+		if len(args) != 1 {
+			return "", errors.New("want a schedule name")
+		}
+		return "/schedules/" + url.PathEscape(args[0]), nil
+	}
+	switch args[0] {
+	case "list":
+		body, err := c.list(c.path("/schedules"), nil)
+		if err != nil {
+			return err
+		}
+		return printJSON(body)
+	case "get":
+		p, err := name(args[1:])
+		if err != nil {
+			return err
+		}
+		body, err := c.do(http.MethodGet, c.path(p), nil, nil)
+		if err != nil {
+			return err
+		}
+		return printJSON(body)
+	case "put":
+		fs := flag.NewFlagSet("schedules put", flag.ExitOnError)
+		data := fs.String("data", "", "payload of each task")
+		typ := fs.String("type", "", "task type")
+		priority := fs.Int("priority", 0, "priority of each task, higher first")
+		timeout := fs.Duration("timeout", 0, "per-attempt timeout")
+		ttl := fs.Duration("ttl", 0, "drop a task if it has not started within this long")
+		fs.Parse(args[1:])
+		if fs.NArg() != 2 {
+			return errors.New("want a schedule name and a cron spec, such as '*/5 * * * *' or '@every 1h'")
+		}
+		req := scheduleRequest{Cron: fs.Arg(1), Task: scheduledTask{Data: *data, Type: *typ, Timeout: durationParam(*timeout), TTL: durationParam(*ttl)}}
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name == "priority" {
+				req.Task.Priority = priority
+			}
+		})
+		p, _ := name(fs.Args()[:1])
+		body, err := c.do(http.MethodPut, c.path(p), nil, req)
+		if err != nil {
+			return err
+		}
+		return printJSON(body)
+	case "delete":
+		p, err := name(args[1:])
+		if err != nil {
+			return err
+		}
+		_, err = c.do(http.MethodDelete, c.path(p), nil, nil)
+		return err
+	}
+	return fmt.Errorf("unknown schedules command %q, want list, get, put or delete", args[0])
+}
+
+// replayRequest is the body of POST /admin/replay
+type replayRequest struct {
+	Source string    `json:"source,omitempty"`
+	Since  time.Time `json:"since,omitzero"`
+	Until  time.Time `json:"until,omitzero"`
+	Queue  string    `json:"queue,omitempty"`
+	Error  string    `json:"error,omitempty"`
+	State  string    `json:"state,omitempty"`
+	Limit  int       `json:"limit,omitempty"`
+	DryRun bool      `json:"dry_run,omitempty"`
+}
+
+func replay(c *client, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	from := fs.String("from", "deadletter", "where the tasks are: deadletter or archive")
+	since := fs.String("since", "", "only tasks that ended at or after this RFC 3339 time, or this long ago such as 2h")
+	until := fs.String("until", "", "only tasks that ended before this time, same forms as -since")
+	queue := fs.String("from-queue", "", "replay the archived tasks of this queue, the target queue's by default")
+	errText := fs.String("error", "", "only tasks whose error contains this text")
+	state := fs.String("state", "", "final state of archived tasks, failed by default")
+	limit := fs.Int("limit", 0, "replay this many tasks at most")
+	dryRun := fs.Bool("dry-run", false, "list the matching tasks without submitting them")
+	fs.Parse(args)
+
+	req := replayRequest{Source: *from, Queue: *queue, Error: *errText, State: *state, Limit: *limit, DryRun: *dryRun}
+	var err error
+	if req.Since, err = timeParam(*since); err != nil {
+		return fmt.Errorf("-since: %w", err)
+	}
+	if req.Until, err = timeParam(*until); err != nil {
+		return fmt.Errorf("-until: %w", err)
+	}
+	body, err := c.do(http.MethodPost, c.path("/admin/replay"), nil, req)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Tasks []struct {
+			OriginalID int    `json:"original_id"`
+			ID         int    `json:"id"`
+			Error      string `json:"error"`
+		} `json:"tasks"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("decoding replay response: %w", err)
+	}
+	fmt.Printf("%-10s %-10s %s\n", "ORIGINAL", "ID", "ERROR")
+	for _, t := range resp.Tasks {
+		id := "-"
+		if t.ID != 0 {
+			id = strconv.Itoa(t.ID)
+		}
+		fmt.Printf("%-10d %-10s %s\n", t.OriginalID, id, t.Error)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("stopped after %d tasks: %s", len(resp.Tasks), resp.Error)
+	}
+	return nil
+}
+
+func admin(c *client, args []string) error {
+	body, err := c.do(http.MethodGet, c.path("/admin"), nil, nil)
+	if err != nil {
+		return err
+	}
+	return printJSON(body)
+}
+
+func pause(c *client, args []string) error {
+	return printText(c.do(http.MethodPost, c.path("/admin/pause"), nil, nil))
+}
+
+func resume(c *client, args []string) error {
+	return printText(c.do(http.MethodPost, c.path("/admin/resume"), nil, nil))
+}
+
+func resize(c *client, args []string) error {
+	if len(args) != 1 {
+		return errors.New("resize takes the number of workers")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return fmt.Errorf("invalid number of workers %q", args[0])
+	}
+	return printText(c.do(http.MethodPost, c.path("/admin/workers"), nil, map[string]int{"workers": n}))
+}
+
+func audit(c *client, args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	since := fs.String("since", "", "only actions at or after this RFC 3339 time, or this long ago such as 2h")
+	until := fs.String("until", "", "only actions before this time, same forms as -since")
+	action := fs.String("action", "", "only this action, such as pause or resize")
+	actor := fs.String("actor", "", "only actions of this client")
+	limit := fs.Int("limit", 0, "print the newest n actions, 100 when zero")
+	fs.Parse(args)
+
+	query := url.Values{}
+	for name, s := range map[string]string{"since": *since, "until": *until} {
+		t, err := timeParam(s)
+		if err != nil {
+			return fmt.Errorf("-%s: %w", name, err)
+		}
+		if !t.IsZero() {
+			query.Set(name, t.UTC().Format(time.RFC3339))
+		}
+	}
+	for name, v := range map[string]string{"action": *action, "actor": *actor, "queue": c.queue} {
+		if v != "" {
+			query.Set(name, v)
+		}
+	}
+	if *limit > 0 {
+		query.Set("limit", strconv.Itoa(*limit))
+	}
+	body, err := c.do(http.MethodGet, "/admin/audit", query, nil)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Entries []struct {
+			Time    time.Time       `json:"time"`
+			Actor   string          `json:"actor"`
+			Remote  string          `json:"remote"`
+			Action  string          `json:"action"`
+			Queue   string          `json:"queue"`
+			Details json.RawMessage `json:"details"`
+			Error   string          `json:"error"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("decoding audit response: %w", err)
+	}
+	fmt.Printf("%-20s %-12s %-16s %-18s %-10s %s\n", "TIME", "ACTOR", "REMOTE", "ACTION", "QUEUE", "DETAILS")
+	for _, e := range resp.Entries {
+		details := string(e.Details)
+		if e.Error != "" {
+			details = strings.TrimSpace(details + " error: " + e.Error)
+		}
+		fmt.Printf("%-20s %-12s %-16s %-18s %-10s %s\n", e.Time.Local().Format("2006-01-02 15:04:05"),
+			cmp.Or(e.Actor, "-"), cmp.Or(e.Remote, "-"), e.Action, cmp.Or(e.Queue, "-"), details)
+	}
+	return nil
+}
+
+func usageCmd(c *client, args []string) error {
+	fs := flag.NewFlagSet("usage", flag.ExitOnError)
+	period := fs.String("period", "", "report over this long up to now, such as 24h or 7d, 24h when empty")
+	groupBy := fs.String("group-by", "", "comma-separated dimensions of the rows, all of queue, tenant and type when empty")
+	fs.Parse(args)
+
+	query := url.Values{}
+	for name, v := range map[string]string{"period": *period, "group_by": *groupBy} {
+		if v != "" {
+			query.Set(name, v)
+		}
+	}
+	body, err := c.do(http.MethodGet, c.path("/reports/usage"), query, nil)
+	if err != nil {
+		return err
+	}
+	type totals struct {
+		Attempts int           `json:"attempts"`
+		Failed   int           `json:"failed"`
+		WallTime time.Duration `json:"wall_time"`
+		CPUTime  time.Duration `json:"cpu_time"`
+	}
+	var resp struct {
+		From        time.Time `json:"from"`
+		To          time.Time `json:"to"`
+		CPUMeasured bool      `json:"cpu_measured"`
+		Total       totals    `json:"total"`
+		Rows        []struct {
+			Queue  string `json:"queue"`
+			Tenant string `json:"tenant"`
+			Type   string `json:"type"`
+			totals
+		} `json:"rows"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("decoding usage response: %w", err)
+	}
+	cpu := func(d time.Duration) string {
+		if !resp.CPUMeasured {
+			return "-"
+		}
+		return d.Round(time.Millisecond).String()
+	}
+	fmt.Printf("from %s to %s\n", resp.From.Local().Format("2006-01-02 15:04"), resp.To.Local().Format("2006-01-02 15:04"))
+	fmt.Printf("%-12s %-16s %-16s %9s %7s %14s %14s\n", "QUEUE", "TENANT", "TYPE", "ATTEMPTS", "FAILED", "WALL", "CPU")
+	for _, r := range resp.Rows {
+		fmt.Printf("%-12s %-16s %-16s %9d %7d %14s %14s\n", cmp.Or(r.Queue, "-"), cmp.Or(r.Tenant, "-"), cmp.Or(r.Type, "-"),
+			r.Attempts, r.Failed, r.WallTime.Round(time.Millisecond), cpu(r.CPUTime))
+	}
+	t := resp.Total
+	fmt.Printf("%-46s %9d %7d %14s %14s\n", "TOTAL", t.Attempts, t.Failed, t.WallTime.Round(time.Millisecond), cpu(t.CPUTime))
+	return nil
+}
+
+func recovery(c *client, args []string) error {
+	fs := flag.NewFlagSet("recovery", flag.ExitOnError)
+	run := fs.Bool("run", false, "run a recovery pass rather than print the last report")
+	repair := fs.Bool("repair", false, "repair the issues found, implies -run")
+	fs.Parse(args)
+
+	if !*run && !*repair {
+		body, err := c.do(http.MethodGet, c.path("/admin/recovery"), nil, nil)
+		if err != nil {
+			return err
+		}
+		return printJSON(body)
+	}
+	query := url.Values{"repair": {strconv.FormatBool(*repair)}}
+	body, err := c.do(http.MethodPost, c.path("/admin/recovery"), query, nil)
+	if err != nil {
+		return err
+	}
+	return printJSON(body)
+}
+
+func snapshot(c *client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("want export or import")
+	}
+	switch args[0] {
+	case "export":
+		fs := flag.NewFlagSet("snapshot export", flag.ExitOnError)
+		out := fs.String("o", "-", "file to write, stdout by default")
+		fs.Parse(args[1:])
+		body, err := c.do(http.MethodGet, c.path("/admin/snapshot"), nil, nil)
+		if err != nil {
+			return err
+		}
+		if *out == "-" {
+			_, err = os.Stdout.Write(body)
+			return err
+		}
+		return os.WriteFile(*out, body, 0o600)
+	case "import":
+		if len(args) != 2 {
+			return errors.New("import takes the snapshot file, - for stdin")
+		}
+		data, err := readInput(args[1])
+		if err != nil {
+			return err
+		}
+		if !json.Valid(data) {
+			return fmt.Errorf("%s is not a JSON snapshot", args[1])
+		}
+		body, err := c.do(http.MethodPost, c.path("/admin/snapshot"), nil, json.RawMessage(data))
+		if err != nil {
+			return err
+		}
+		return printJSON(body)
+	}
+	return fmt.Errorf("unknown snapshot command %q, want export or import", args[0])
+}
+
+// chaosRequest is the body of PUT /admin/chaos
+type chaosRequest struct {
+	LatencyRate float64  `json:"latency_rate,omitempty"`
+	Latency     string   `json:"latency,omitempty"`
+	FailureRate float64  `json:"failure_rate,omitempty"`
+	PanicRate   float64  `json:"panic_rate,omitempty"`
+	Types       []string `json:"types,omitempty"`
+}
+
+func chaosCmd(c *client, args []string) error {
+	var body []byte
+	var err error
+	switch {
+	case len(args) == 0:
+		body, err = c.do(http.MethodGet, c.path("/admin/chaos"), nil, nil)
+	case len(args) == 1 && args[0] == "off":
+		body, err = c.do(http.MethodDelete, c.path("/admin/chaos"), nil, nil)
+	default:
+		body, err = setChaos(c, args)
+	}
+	if err != nil {
+		return err
+	}
+	return printJSON(body)
+}
+
+// setChaos sends the faults given as flags
+func setChaos(c *client, args []string) ([]byte, error) {
+	fs := flag.NewFlagSet("chaos", flag.ExitOnError)
+	failureRate := fs.Float64("failure-rate", 0, "probability, from 0 to 1, that an attempt fails")
+	panicRate := fs.Float64("panic-rate", 0, "probability that an attempt panics")
+	latency := fs.Duration("latency", 0, "delay added before the handler runs")
+	latencyRate := fs.Float64("latency-rate", 1, "probability that an attempt is delayed by -latency")
+	types := fs.String("types", "", "comma separated task types affected, all by default")
+	fs.Parse(args)
+
+	req := chaosRequest{FailureRate: *failureRate, PanicRate: *panicRate}
+	if *latency > 0 {
+		req.Latency, req.LatencyRate = latency.String(), *latencyRate
+	}
+	if *types != "" {
+		req.Types = strings.Split(*types, ",")
+	}
+	return c.do(http.MethodPut, c.path("/admin/chaos"), nil, req)
+}
+
+// readInput reads a file, or stdin for "-"
+func readInput(name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
+
+// taskIDs parses task ID arguments
+func taskIDs(args []string) ([]int, error) {
+	if len(args) == 0 {
+		return nil, errors.New("missing task ID")
+	}
+	ids := make([]int, len(args))
+	for i, a := range args {
+		id, err := strconv.Atoi(a)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("invalid task ID %q", a)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// durationParam formats an optional duration for the API
+func durationParam(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// timeParam parses an RFC 3339 time, or a duration before now
+func timeParam(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func cloneValues(v url.Values) url.Values {
+	c := make(url.Values, len(v))
+	for k, vs := range v {
+		c[k] = append([]string(nil), vs...)
+	}
+	return c
+}
+
+// printJSON prints a JSON response indented
+func printJSON(body []byte) error {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, body, "", "  "); err != nil {
+		return printText(body, nil)
+	}
+	buf.WriteByte('\n')
+	_, err := buf.WriteTo(os.Stdout)
+	return err
+}
+
+// printText prints a plain text response
+func printText(body []byte, err error) error {
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(body))
+	if len(body) > 0 && body[len(body)-1] != '\n' {
+		fmt.Println()
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Command poolctl submits and inspects tasks through the HTTP API of
+// cmd/server
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// envPrefix starts the name of every environment variable read by poolctl
+const envPrefix = "POOLCTL_"
+
+func main() {
+	addr := flag.String("addr", envOr("ADDR", "http://localhost:8080"), "server URL (env "+envPrefix+"ADDR)")
+	queue := flag.String("queue", os.Getenv(envPrefix+"QUEUE"), "named queue, the default pool when empty (env "+envPrefix+"QUEUE)")
+	key := flag.String("key", os.Getenv(envPrefix+"API_KEY"), "API key (env "+envPrefix+"API_KEY)")
+	gzipBodies := flag.Bool("gzip", false, "gzip request bodies, for large batches")
+	timeout := flag.Duration("timeout", 0, "request timeout, none when zero; keep it unset for tail")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	name, args := flag.Arg(0), flag.Args()[1:]
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "poolctl: unknown command %q\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	base := strings.TrimRight(*addr, "/")
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	c := &client{base: base, queue: *queue, key: *key, gzip: *gzipBodies, http: &http.Client{Timeout: *timeout}}
+	if err := cmd.run(c, args); err != nil {
+		fmt.Fprintf(os.Stderr, "poolctl %s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+func envOr(name, def string) string {
+	if v := os.Getenv(envPrefix + name); v != "" {
+		return v
+	}
+	return def
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "usage: poolctl [flags] command [arguments]")
+	fmt.Fprintln(out, "\ncommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Fprintf(out, "  %s %s\n    \t%s\n", name, cmd.usage, cmd.help)
+	}
+	fmt.Fprintln(out, "\nflags:")
+	flag.PrintDefaults()
+}
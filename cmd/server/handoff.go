@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// handoffEnv lists the listeners a restarted process inherits, in the order
+// of their file descriptors after the readiness pipe
+const handoffEnv = envPrefix + "HANDOFF_LISTENERS"
+
+// handoffReadyTimeout bounds how long the old process waits for the new
+// one before giving up on the restart
+const handoffReadyTimeout = time.Minute
+
+// handoff passes the listening sockets to a new process on restart, so
+// connections wait in the kernel backlog instead of being refused while
+// the old process drains
+type handoff struct {
+	log       *slog.Logger
+	inherited map[string]net.Listener
+	parent    *os.File // readiness pipe to the old process, nil on a cold start
+	readyOnce sync.Once
+
+	mu        sync.Mutex
+	listeners map[string]*pausableListener // passed on to the next process
+	order     []string
+}
+
+// pausableListener stops accepting on pause without closing the socket, so
+// connections keep queuing for the next process. Shutting the server down
+// right away could drop a connection accepted in the meantime
+type pausableListener struct {
+	*net.TCPListener
+	paused    chan struct{}
+	closed    chan struct{}
+	pauseOnce sync.Once
+	closeOnce sync.Once
+}
+
+func (l *pausableListener) Accept() (net.Conn, error) {
+	select {
+	case <-l.paused:
+		<-l.closed
+		return nil, net.ErrClosed
+	default:
+	}
+	conn, err := l.TCPListener.Accept()
+	if err != nil && l.isPaused() {
+		// Woken up by the deadline set by pause
+		<-l.closed
+		return nil, net.ErrClosed
+	}
+	return conn, err
+}
+
+func (l *pausableListener) isPaused() bool {
+	select {
+	case <-l.paused:
+		return true
+	default:
+		return false
+	}
+}
+
+// pause wakes a pending Accept and makes the next ones wait for Close
+func (l *pausableListener) pause() {
+	l.pauseOnce.Do(func() {
+		close(l.paused)
+		_ = l.SetDeadline(time.Now())
+	})
+}
+
+// dup returns a copy of the socket for the next process. Unlike File, it
+// leaves the listener non-blocking, so pause can still interrupt Accept
+func (l *pausableListener) dup() (*os.File, error) {
+	rc, err := l.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var fd int
+	var dupErr error
+	if err := rc.Control(func(s uintptr) { fd, dupErr = syscall.Dup(int(s)) }); err != nil {
+		return nil, err
+	}
+	if dupErr != nil {
+		return nil, dupErr
+	}
+	return os.NewFile(uintptr(fd), l.Addr().String()), nil
+}
+
+func (l *pausableListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return l.TCPListener.Close()
+}
+
+// newHandoff picks up the listeners of the process that spawned this one
+func newHandoff(log *slog.Logger) (*handoff, error) {
+	h := &handoff{log: log, inherited: make(map[string]net.Listener), listeners: make(map[string]*pausableListener)}
+	names := os.Getenv(handoffEnv)
+	if names == "" {
+		return h, nil
+	}
+	os.Unsetenv(handoffEnv)
+
+	h.parent = os.NewFile(3, "handoff-ready")
+	for i, name := range strings.Split(names, ",") {
+		f := os.NewFile(uintptr(4+i), name)
+		lis, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("inheriting %s listener: %w", name, err)
+		}
+		h.inherited[name] = lis
+	}
+	log.Info("restarted with inherited listeners", "listeners", names)
+	return h, nil
+}
+
+// restarted reports whether this process took over from an older one
+func (h *handoff) restarted() bool {
+	return h.parent != nil
+}
+
+// listen returns the inherited listener called name, or a new one on addr
+func (h *handoff) listen(name, addr string) (net.Listener, error) {
+	lis, ok := h.inherited[name]
+	if !ok {
+		var err error
+		if lis, err = net.Listen("tcp", addr); err != nil {
+			return nil, err
+		}
+	}
+	tl, ok := lis.(*net.TCPListener)
+	if !ok {
+		return lis, nil
+	}
+	pl := &pausableListener{TCPListener: tl, paused: make(chan struct{}), closed: make(chan struct{})}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners[name] = pl
+	h.order = append(h.order, name)
+	return pl, nil
+}
+
+// ready tells the old process it can start draining. Later calls do nothing
+func (h *handoff) ready() {
+	if h.parent == nil {
+		return
+	}
+	h.readyOnce.Do(func() {
+		if _, err := h.parent.Write([]byte{1}); err != nil {
+			h.log.Warn("telling the previous process to stop", "error", err)
+		}
+		h.parent.Close()
+	})
+}
+
+// restart starts a copy of this process on the same listeners and waits
+// until it is ready. This process then stops accepting connections and the
+// caller shuts it down
+func (h *handoff) restart() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	files := []*os.File{w}
+	h.mu.Lock()
+	names := h.order
+	for _, name := range names {
+		f, err := h.listeners[name].dup()
+		if err != nil {
+			h.mu.Unlock()
+			w.Close()
+			return fmt.Errorf("sharing %s listener: %w", name, err)
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+	h.mu.Unlock()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), handoffEnv+"="+strings.Join(names, ","))
+	cmd.ExtraFiles = files
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return err
+	}
+	h.log.Info("restarting", "pid", cmd.Process.Pid)
+
+	// A byte means ready; EOF means the new process exited first
+	ready := make(chan error, 1)
+	go func() {
+		var b [1]byte
+		_, err := r.Read(b[:])
+		if errors.Is(err, io.EOF) {
+			err = errors.New("new process exited before it was ready")
+		}
+		ready <- err
+	}()
+	go cmd.Wait() // reaps the child should it fail; it outlives us otherwise
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			return err
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for _, l := range h.listeners {
+			l.pause()
+		}
+		return nil
+	case <-time.After(handoffReadyTimeout):
+		_ = cmd.Process.Kill()
+		return errors.New("new process did not get ready in time")
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+	_ "time/tzdata" // processing_windows time zones on hosts without zoneinfo
+
+	pool "playground"
+	"playground/boltqueue"
+	"playground/grpcapi"
+	"playground/redisqueue"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/redis/go-redis/v9"
+	bolt "go.etcd.io/bbolt"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"golang.org/x/net/netutil"
+	"google.golang.org/grpc"
+)
+
+// defaultQueue names the main pool once named queues are configured
+const defaultQueue = "default"
+
+func main() {
+	configPath := flag.String("config", os.Getenv(envPrefix+"CONFIG"), "YAML configuration file")
+	listen := flag.String("listen", "", "HTTP listen address (defaults to :8080)")
+	queueDB := flag.String("queue-db", "", "BoltDB file for a persistent queue (in-memory when empty)")
+	redisAddr := flag.String("redis", "", "Redis address for a queue shared between instances")
+	rateLimit := flag.String("rate-limit", "", "per-client submission limit such as 10/s or 600/m (unlimited when empty)")
+	grpcAddr := flag.String("grpc-addr", "", "listen address for the gRPC API, such as :9090 (disabled when empty)")
+	rateBurst := flag.Int("rate-burst", 0, "burst size for -rate-limit (defaults to one second worth of requests)")
+	var queues queueFlags
+	promote := flag.Bool("promote", false, "promote the Redis at backend.redis_addr, the standby of a lost region, to primary and exit")
+	flag.Var(&queues, "queue", "extra in-memory queue served under /queues/{name}, as name=workers:size (repeatable)")
+	flag.Parse()
+
+	level := new(slog.LevelVar)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+	slog.SetDefault(logger)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fatal("loading configuration", err)
+	}
+	// Flags given explicitly win over the file and the environment
+	overrides := func(cfg *config) {
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "listen":
+				cfg.Listen = *listen
+			case "queue-db":
+				cfg.Backend = backendConfig{Type: "bolt", Path: *queueDB}
+			case "redis":
+				cfg.Backend = backendConfig{Type: "redis", RedisAddr: *redisAddr}
+			case "rate-limit":
+				cfg.RateLimit.Rate = *rateLimit
+			case "rate-burst":
+				cfg.RateLimit.Burst = *rateBurst
+			case "grpc-addr":
+				cfg.GRPCListen = *grpcAddr
+			}
+		})
+		cfg.Queues = append(cfg.Queues, queues...)
+	}
+	overrides(&cfg)
+	if err := cfg.validate(); err != nil {
+		fatal("invalid configuration", err)
+	}
+	if *promote && cfg.Backend.Type != "redis" {
+		fatal("invalid configuration", errors.New("-promote requires the redis backend"))
+	}
+	_ = level.UnmarshalText([]byte(cfg.LogLevel))
+
+	h, err := newHandoff(logger)
+	if err != nil {
+		fatal("taking over from the previous process", err)
+	}
+
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		fatal("setting up tracing", err)
+	}
+
+	// One generator for every pool keeps task IDs unique across queues
+	var idOpts []pool.Option
+	if cfg.IDs.Generator == "snowflake" {
+		gen, err := pool.NewSnowflake(cfg.IDs.Node)
+		if err != nil {
+			fatal("creating the ID generator", err)
+		}
+		logger.Info("using snowflake task IDs", "node", gen.Node())
+		idOpts = append(idOpts, pool.WithIDGenerator(gen))
+	}
+	switch cfg.IDs.UID {
+	case "ulid":
+		idOpts = append(idOpts, pool.WithUIDGenerator(pool.NewULID()))
+	case "uuid":
+		idOpts = append(idOpts, pool.WithUIDGenerator(pool.NewUUIDv7()))
+	}
+
+	overflow, _ := pool.ParseOverflowPolicy(cfg.Overflow)
+	opts := []pool.Option{
+		pool.WithLogger(logger),
+		pool.WithWorkers(cfg.Workers),
+		pool.WithQueueSize(cfg.QueueSize),
+		pool.WithOverflowPolicy(overflow, cfg.OverflowTimeout),
+		pool.WithTaskTimeout(cfg.TaskTimeout),
+		pool.WithRetryPolicy(cfg.retryPolicy()),
+		pool.WithIdempotencyTTL(cfg.IdempotencyTTL),
+	}
+	opts = append(opts, cfg.featureOptions()...)
+	opts = append(opts, idOpts...)
+	windows, _ := cfg.Windows.windows() // checked by validate
+	opts = append(opts, pool.WithProcessingWindows(windows))
+	opts = append(opts, cfg.Budgets.options()...)
+	if cs := cfg.CPUSizing; cs.PerCPU > 0 {
+		opts = append(opts, pool.WithCPUSizing(pool.CPUSizing{PerCPU: cs.PerCPU, Min: cs.Min, Max: cs.Max, Interval: cs.Interval, Pin: cs.Pin}))
+	}
+	codec, _ := pool.LookupCodec(cfg.Backend.Codec)
+	if keys, _ := cfg.Encryption.provider(); keys != nil {
+		// Registered so the tasks it stored decode
+		codec = pool.EncryptedCodec(codec, keys)
+		pool.RegisterCodec(codec)
+	}
+	// Both algorithms are registered so the tasks stored compressed decode
+	// once compression changed or is off
+	for _, a := range []pool.CompressionAlgorithm{pool.CompressZstd, pool.CompressSnappy} {
+		pool.RegisterCodec(pool.CompressedCodec(codec, pool.Compression{Algorithm: a}))
+	}
+	if c := cfg.Compression.compression(); c != nil {
+		codec = pool.CompressedCodec(codec, *c)
+		pool.RegisterCodec(codec)
+	}
+	switch cfg.Backend.Type {
+	case "redis":
+		rdb := redis.NewClient(&redis.Options{Addr: cfg.Backend.RedisAddr})
+		defer rdb.Close()
+		if err := rdb.Ping(context.Background()).Err(); err != nil {
+			fatal("connecting to Redis", err)
+		}
+		if *promote {
+			n, err := redisqueue.Promote(context.Background(), rdb, cfg.Backend.RedisPrefix)
+			if err != nil {
+				fatal("promoting the standby", err)
+			}
+			logger.Info("standby promoted, point the servers of this region at it", "addr", cfg.Backend.RedisAddr, "tasks", n)
+			return
+		}
+		if standby, err := redisqueue.IsStandby(context.Background(), rdb, cfg.Backend.RedisPrefix); err != nil || standby {
+			fatal("opening the redis queue", cmp.Or(err, errors.New("the Redis is the standby of another region, promote it with -promote first")))
+		}
+		ro := redisqueue.Options{
+			Prefix:            cfg.Backend.RedisPrefix,
+			Codec:             codec,
+			VisibilityTimeout: cfg.Backend.VisibilityTimeout,
+			CompletionTTL:     cfg.Backend.CompletionTTL,
+		}
+		if rc := cfg.Backend.Replication; rc.StandbyAddr != "" {
+			standby := redis.NewClient(&redis.Options{Addr: rc.StandbyAddr})
+			defer standby.Close()
+			ro.Standby = standby
+			ro.Replication = redisqueue.Replication{Interval: rc.Interval, MaxLog: int64(rc.MaxLog)}
+			logger.Info("replicating the queue to the standby", "addr", rc.StandbyAddr)
+		}
+		q := redisqueue.New(rdb, ro)
+		opts = append(opts, pool.WithQueueBackend(q), pool.WithStorageQuota(cfg.Backend.storageQuota()))
+		if cfg.LeaderElection.Enabled {
+			e := q.Elector()
+			logger.Info("leader election enabled", "id", e.ID())
+			opts = append(opts, pool.WithLeaderElection(pool.LeaderElection{Elector: e, TTL: cfg.LeaderElection.TTL}))
+		}
+	case "bolt":
+		lockTimeout := time.Second
+		if h.restarted() {
+			// The previous process holds the database until it has drained
+			h.ready()
+			lockTimeout = cfg.ShutdownTimeout + 5*time.Second
+		}
+		db, err := bolt.Open(cfg.Backend.Path, 0o600, &bolt.Options{Timeout: lockTimeout})
+		if err != nil {
+			fatal("opening queue database", err)
+		}
+		defer db.Close()
+
+		q, err := boltqueue.New(db, boltqueue.WithCodec(codec))
+		if err != nil {
+			fatal("opening persistent queue", err)
+		}
+		logger.Info("persistent queue opened", "path", cfg.Backend.Path, "pending", q.Len())
+		opts = append(opts, pool.WithQueueBackend(q), pool.WithStorageQuota(cfg.Backend.storageQuota()))
+	default:
+		if cfg.Backend.SpillFile != "" {
+			opts = append(opts, pool.WithSpillFile(cfg.Backend.SpillFile))
+		}
+	}
+
+	// Named queues share one registry, told apart by their queue label
+	var named []*pool.WorkerPool
+	if len(cfg.Queues) > 0 {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+		opts = append(opts, pool.WithName(defaultQueue), pool.WithMetricsRegistry(reg))
+		for _, q := range cfg.Queues {
+			qopts := append([]pool.Option{
+				pool.WithName(q.Name),
+				pool.WithLogger(logger),
+				pool.WithMetricsRegistry(reg),
+				pool.WithWorkers(q.Workers),
+				pool.WithQueueSize(q.Size),
+				pool.WithOverflowPolicy(overflow, cfg.OverflowTimeout),
+				pool.WithTaskTimeout(cfg.TaskTimeout),
+				pool.WithRetryPolicy(cfg.retryPolicy()),
+				pool.WithIdempotencyTTL(cfg.IdempotencyTTL),
+			}, cfg.featureOptions()...)
+			qopts = append(qopts, idOpts...)
+			if cfg.Backend.SpillFile != "" {
+				qopts = append(qopts, pool.WithSpillFile(cfg.Backend.SpillFile+"."+q.Name))
+			}
+			windows, _ := q.Windows.windows()
+			qopts = append(qopts, pool.WithProcessingWindows(windows))
+			qopts = append(qopts, q.Budgets.options()...)
+			np := pool.NewWorkerPool(qopts...)
+			cfg.registerHandlers(np)
+			named = append(named, np)
+		}
+	}
+
+	p := pool.NewWorkerPool(opts...)
+	cfg.registerHandlers(p)
+	p.Start()
+	for _, np := range named {
+		np.Start()
+	}
+
+	serverOpts := []pool.ServerOption{
+		pool.WithBodyLimit(int64(cfg.HTTP.MaxBodyBytes)),
+		pool.WithUploadLimit(int64(cfg.Payloads.MaxBytes)),
+		pool.WithIdempotentResponses(cfg.IdempotencyTTL),
+		pool.WithConcurrencyLimit(pool.ConcurrencyLimit{Global: cfg.HTTP.MaxInflight, PerClient: cfg.HTTP.MaxInflightClient}),
+	}
+	if cfg.HTTP.Compression {
+		serverOpts = append(serverOpts, pool.WithCompression(cfg.HTTP.CompressionLevel))
+	}
+	if cfg.HTTP.PropagateHeaders {
+		serverOpts = append(serverOpts, pool.WithHeaderPropagation(cfg.HTTP.ExtraHeaders...))
+	}
+	if len(cfg.Auth.Keys) > 0 {
+		serverOpts = append(serverOpts, pool.WithAuth(pool.Auth{Keys: cfg.Auth.Keys, Public: cfg.Auth.Public, Tenants: cfg.Auth.Tenants, Admins: cfg.Auth.Admins}))
+	}
+	if cfg.Debug.Enabled {
+		if len(cfg.Auth.Keys) == 0 {
+			logger.Warn("debug endpoints are served without authentication, set auth.keys")
+		}
+		serverOpts = append(serverOpts, pool.WithDebug())
+	}
+	if cfg.RateLimit.Rate != "" {
+		rate, _ := pool.ParseRate(cfg.RateLimit.Rate)
+		serverOpts = append(serverOpts, pool.WithRateLimit(pool.RateLimit{Rate: rate, Burst: cfg.RateLimit.Burst}))
+	}
+	for _, np := range named {
+		serverOpts = append(serverOpts, pool.WithQueue(np))
+	}
+	if cfg.Audit.File != "" {
+		auditLog, err := pool.OpenFileAuditLog(cfg.Audit.File)
+		if err != nil {
+			fatal("opening the audit log", err)
+		}
+		defer auditLog.Close()
+		serverOpts = append(serverOpts, pool.WithAuditLog(auditLog))
+	}
+
+	api := pool.NewServer(p, serverOpts...)
+	srv := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           api,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+		MaxHeaderBytes:    cfg.HTTP.MaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+	srv.RegisterOnShutdown(api.CloseStreams)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pools := map[string]*pool.WorkerPool{"": p, defaultQueue: p}
+	for _, np := range named {
+		pools[np.Name()] = np
+	}
+	reload := &reloader{path: *configPath, overrides: overrides, level: level, api: api, pools: pools, log: logger, cfg: cfg}
+	go reload.run(ctx)
+	go controlSignals(ctx, pools, level, logger)
+
+	sourceCtx, stopSources := context.WithCancel(context.Background())
+	waitSources, err := runSources(sourceCtx, &cfg, pools)
+	if err != nil {
+		fatal("starting sources", err)
+	}
+
+	lis, err := h.listen("http", srv.Addr)
+	if err != nil {
+		fatal("listening for HTTP", err)
+	}
+	if n := cfg.HTTP.MaxConnections; n > 0 {
+		// Further clients wait in the accept backlog
+		lis = netutil.LimitListener(lis, n)
+	}
+	if cfg.TLS.CertFile != "" {
+		certs, err := newCertReloader(cfg.TLS, logger)
+		if err != nil {
+			fatal("setting up TLS", err)
+		}
+		if !cfg.GracefulRestart {
+			go certs.reloadOnHangup(ctx)
+		}
+		srv.TLSConfig = certs.config()
+		lis = tls.NewListener(lis, srv.TLSConfig)
+	}
+	go func() {
+		logger.Info("server is running", "addr", srv.Addr, "tls", cfg.TLS.CertFile != "",
+			"client_auth", cfg.TLS.ClientAuth, "max_connections", cfg.HTTP.MaxConnections)
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("serving HTTP", err)
+		}
+	}()
+
+	var grpcServer *grpc.Server
+	if cfg.GRPCListen != "" {
+		lis, err := h.listen("grpc", cfg.GRPCListen)
+		if err != nil {
+			fatal("listening for gRPC", err)
+		}
+		grpcServer = grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler()))
+		grpcapi.Register(grpcServer, p)
+		go func() {
+			logger.Info("gRPC server is running", "addr", cfg.GRPCListen)
+			if err := grpcServer.Serve(lis); err != nil {
+				fatal("serving gRPC", err)
+			}
+		}()
+	}
+
+	h.ready()
+
+	waitForStop(ctx, &cfg, h)
+	stop()
+	logger.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Stop accepting events first, then drain whatever is already queued
+	stopSources()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("HTTP shutdown", "error", err)
+	}
+	waitSources()
+	grpcStopped := make(chan struct{})
+	go func() {
+		defer close(grpcStopped)
+		if grpcServer != nil {
+			grpcServer.GracefulStop()
+		}
+	}()
+	// Event streams end once the pool shutdown closes them
+	var wg sync.WaitGroup
+	for _, np := range append(named, p) {
+		wg.Go(func() {
+			if err := np.Shutdown(shutdownCtx); err != nil {
+				logger.Error("worker pool shutdown", "queue", np.Name(), "error", err)
+			}
+		})
+	}
+	wg.Wait()
+	if grpcServer != nil {
+		select {
+		case <-grpcStopped:
+		case <-shutdownCtx.Done():
+			grpcServer.Stop()
+		}
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("flushing traces", "error", err)
+	}
+	logger.Info("server stopped")
+}
+
+// waitForStop returns on SIGINT or SIGTERM, or once a process restarted on
+// SIGHUP with graceful_restart has taken over the listeners
+func waitForStop(ctx context.Context, cfg *config, h *handoff) {
+	if !cfg.GracefulRestart {
+		<-ctx.Done()
+		return
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := h.restart(); err != nil {
+				slog.Error("restart failed, still serving", "error", err)
+				continue
+			}
+			return
+		}
+	}
+}
+
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// queueSpec describes a named queue, given on the command line as
+// name=workers:size
+type queueSpec struct {
+	Name    string        `yaml:"name"`
+	Workers int           `yaml:"workers"`
+	Size    int           `yaml:"queue_size"`
+	Windows windowsConfig `yaml:"processing_windows"` // YAML only
+	Budgets budgetsConfig `yaml:"budgets"`            // YAML only
+}
+
+// queueFlags collects repeated -queue flags
+type queueFlags []queueSpec
+
+func (f *queueFlags) String() string {
+	specs := make([]string, len(*f))
+	for i, q := range *f {
+		specs[i] = fmt.Sprintf("%s=%d:%d", q.Name, q.Workers, q.Size)
+	}
+	return strings.Join(specs, ",")
+}
+
+func (f *queueFlags) Set(s string) error {
+	name, sizes, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("invalid queue %q, want name=workers:size", s)
+	}
+	w, n, ok := strings.Cut(sizes, ":")
+	workers, err := strconv.Atoi(w)
+	if !ok || err != nil {
+		return fmt.Errorf("invalid worker count in %q", s)
+	}
+	size, err := strconv.Atoi(n)
+	if err != nil {
+		return fmt.Errorf("invalid queue size in %q", s)
+	}
+	*f = append(*f, queueSpec{Name: name, Workers: workers, Size: size})
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	pool "playground"
+)
+
+// reloader applies changes to the configuration file without a restart,
+// on SIGHUP unless graceful_restart takes it, and when reload_interval
+// finds the file modified. Worker counts, the rate limit, the retry policy
+// and the log level change in place; other changes are reported as
+// needing a restart and left out
+type reloader struct {
+	path      string
+	overrides func(*config) // the flags, which still win over the file
+	level     *slog.LevelVar
+	api       *pool.Server
+	pools     map[string]*pool.WorkerPool // by queue name, "" for the default pool
+	log       *slog.Logger
+	cfg       config // in effect
+}
+
+// run reloads on the triggers of the configuration until ctx is done
+func (r *reloader) run(ctx context.Context) {
+	var hup chan os.Signal
+	if !r.cfg.GracefulRestart {
+		hup = make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+	}
+	var tick <-chan time.Time
+	var last os.FileInfo
+	if r.path != "" && r.cfg.ReloadInterval > 0 {
+		ticker := time.NewTicker(r.cfg.ReloadInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+		last, _ = os.Stat(r.path)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.reload("SIGHUP")
+			continue
+		case <-tick:
+			fi, err := os.Stat(r.path)
+			if err != nil || last != nil && fi.ModTime().Equal(last.ModTime()) && fi.Size() == last.Size() {
+				continue
+			}
+			last = fi
+		}
+		r.reload("file change")
+	}
+}
+
+// reload reads the configuration again and applies what can change at
+// runtime, logging what was applied and what needs a restart and
+// recording it in the audit log
+func (r *reloader) reload(trigger string) {
+	next, err := loadConfig(r.path)
+	if err == nil {
+		r.overrides(&next)
+		err = next.validate()
+	}
+	if err != nil {
+		r.log.Error("reloading configuration, keeping the current one", "error", err)
+		r.api.Audit(pool.AuditEntry{Action: pool.AuditReload, Details: map[string]any{"trigger": trigger}, Error: err.Error()})
+		return
+	}
+
+	applied := r.apply(next)
+	// What is left differing needs a restart
+	restart := diffConfig("", reflect.ValueOf(r.cfg), reflect.ValueOf(next))
+	r.api.Audit(pool.AuditEntry{Action: pool.AuditReload, Details: map[string]any{"trigger": trigger, "applied": applied, "needs_restart": restart}})
+	switch {
+	case len(applied) == 0 && len(restart) == 0:
+		r.log.Info("configuration reloaded, nothing changed")
+	case len(restart) == 0:
+		r.log.Info("configuration reloaded", "applied", applied)
+	default:
+		r.log.Warn("configuration reloaded, some changes need a restart", "applied", applied, "needs_restart", restart)
+	}
+}
+
+// apply makes the runtime settings of next take effect, recording them in
+// r.cfg, and returns the fields changed
+func (r *reloader) apply(next config) []string {
+	cur := &r.cfg
+	var applied []string
+
+	if next.LogLevel != cur.LogLevel {
+		var level slog.Level
+		_ = level.UnmarshalText([]byte(next.LogLevel))
+		r.level.Set(level)
+		cur.LogLevel = next.LogLevel
+		applied = append(applied, "log_level")
+	}
+	if next.Workers != cur.Workers {
+		r.pools[""].Resize(next.Workers)
+		cur.Workers = next.Workers
+		applied = append(applied, "workers")
+	}
+	for _, q := range next.Queues {
+		for i := range cur.Queues {
+			if c := &cur.Queues[i]; c.Name == q.Name && c.Workers != q.Workers {
+				r.pools[q.Name].Resize(q.Workers)
+				c.Workers = q.Workers
+				applied = append(applied, "queues."+q.Name+".workers")
+			}
+		}
+	}
+	if next.Retry != cur.Retry {
+		cur.Retry = next.Retry
+		for name, p := range r.pools {
+			// The default pool is listed under defaultQueue as well
+			if name != "" {
+				p.SetRetryPolicy(cur.retryPolicy())
+			}
+		}
+		applied = append(applied, "retry")
+	}
+	if next.RateLimit != cur.RateLimit {
+		rate, _ := pool.ParseRate(next.RateLimit.Rate)
+		r.api.SetRateLimit(pool.RateLimit{Rate: rate, Burst: next.RateLimit.Burst})
+		cur.RateLimit = next.RateLimit
+		applied = append(applied, "rate_limit")
+	}
+	return applied
+}
+
+// diffConfig returns the YAML paths of the settings that differ between a
+// and b, descending into nested sections
+func diffConfig(prefix string, a, b reflect.Value) []string {
+	var diff []string
+	for i := range a.NumField() {
+		f := a.Type().Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		if f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeFor[time.Time]() {
+			diff = append(diff, diffConfig(prefix+name+".", a.Field(i), b.Field(i))...)
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			diff = append(diff, prefix+name)
+		}
+	}
+	return diff
+}
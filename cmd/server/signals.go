@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"syscall"
+
+	pool "playground"
+)
+
+// controlSignals serves the controls reachable when the admin API is not,
+// until ctx is done: SIGUSR1 logs the state of every pool and SIGUSR2
+// turns debug logging on, the next SIGUSR2 restoring the level before it
+func controlSignals(ctx context.Context, pools map[string]*pool.WorkerPool, level *slog.LevelVar, log *slog.Logger) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(sigs)
+	var restore *slog.Level // the level before debug, nil when not toggled
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigs:
+			if sig == syscall.SIGUSR1 {
+				logState(pools, log)
+				continue
+			}
+			if restore == nil {
+				prev := level.Level()
+				restore = &prev
+				level.Set(slog.LevelDebug)
+				log.Warn("debug logging on, send SIGUSR2 again to turn it off", "previous_level", prev.String())
+				continue
+			}
+			log.Warn("debug logging off", "level", restore.String())
+			level.Set(*restore)
+			restore = nil
+		}
+	}
+}
+
+// logState logs the state of every pool, the default one once although
+// it is listed twice
+func logState(pools map[string]*pool.WorkerPool, log *slog.Logger) {
+	var unique []*pool.WorkerPool
+	for _, name := range slices.Sorted(maps.Keys(pools)) {
+		if p := pools[name]; !slices.Contains(unique, p) {
+			unique = append(unique, p)
+		}
+	}
+	log.Info("state report", "pools", len(unique), "goroutines", runtime.NumGoroutine())
+	for _, p := range unique {
+		st := p.State()
+		log.Info("pool state", "queue", st.Queue, "paused", st.Paused, "queue_depth", st.QueueDepth,
+			"workers", st.Workers, "in_flight", st.InFlight, "diagnostics", st.Diagnostics)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	pool "playground"
+	"playground/amqpsource"
+	"playground/dirsource"
+	"playground/httpsource"
+	"playground/kafkasource"
+	"playground/natssource"
+
+	"github.com/nats-io/nats.go"
+)
+
+type sourcesConfig struct {
+	NATS  natsSourceConfig  `yaml:"nats" env:"NATS"`
+	Kafka kafkaSourceConfig `yaml:"kafka" env:"KAFKA"`
+	HTTP  httpSourceConfig  `yaml:"http" env:"HTTP"`
+	Dir   dirSourceConfig   `yaml:"directory" env:"DIR"`
+	AMQP  amqpSourceConfig  `yaml:"amqp" env:"AMQP"`
+}
+
+// natsSourceConfig is disabled while Subject is empty
+type natsSourceConfig struct {
+	URL        string `yaml:"url" env:"URL"`
+	Subject    string `yaml:"subject" env:"SUBJECT"`
+	QueueGroup string `yaml:"queue_group" env:"QUEUE_GROUP"`
+	Queue      string `yaml:"queue" env:"QUEUE"` // pool fed, the default one when empty
+}
+
+// kafkaSourceConfig is disabled while Topic is empty
+type kafkaSourceConfig struct {
+	Brokers []string `yaml:"brokers" env:"BROKERS"`
+	Topic   string   `yaml:"topic" env:"TOPIC"`
+	GroupID string   `yaml:"group_id" env:"GROUP_ID"`
+	Queue   string   `yaml:"queue" env:"QUEUE"`
+}
+
+// httpSourceConfig is disabled while URL is empty
+type httpSourceConfig struct {
+	URL         string            `yaml:"url" env:"URL"`
+	Interval    time.Duration     `yaml:"interval" env:"INTERVAL"`
+	Headers     map[string]string `yaml:"headers" env:"HEADERS"` // such as Authorization
+	Items       string            `yaml:"items" env:"ITEMS"`     // response field of the items, the response itself when empty
+	Cursor      string            `yaml:"cursor" env:"CURSOR"`   // response field of the next cursor, none when empty
+	CursorParam string            `yaml:"cursor_param" env:"CURSOR_PARAM"`
+	ID          string            `yaml:"id" env:"ID"` // item field keying its task
+	Type        string            `yaml:"type" env:"TYPE"`
+	Queue       string            `yaml:"queue" env:"QUEUE"`
+}
+
+// dirSourceConfig is disabled while Path is empty
+type dirSourceConfig struct {
+	Path      string        `yaml:"path" env:"PATH"`
+	Recursive bool          `yaml:"recursive" env:"RECURSIVE"`
+	Pattern   string        `yaml:"pattern" env:"PATTERN"` // file names enqueued, all when empty
+	Settle    time.Duration `yaml:"settle" env:"SETTLE"`   // time unmodified before a file is enqueued
+	Type      string        `yaml:"type" env:"TYPE"`
+	Queue     string        `yaml:"queue" env:"QUEUE"`
+}
+
+// amqpSourceConfig is disabled while Consume and Exchange are empty
+type amqpSourceConfig struct {
+	URL        string `yaml:"url" env:"URL"`
+	Consume    string `yaml:"consume" env:"CONSUME"` // AMQP queue consumed, none when empty
+	Prefetch   int    `yaml:"prefetch" env:"PREFETCH"`
+	Exchange   string `yaml:"exchange" env:"EXCHANGE"` // receiving task events, none when empty
+	RoutingKey string `yaml:"routing_key" env:"ROUTING_KEY"`
+	Results    bool   `yaml:"results" env:"RESULTS"` // add the results of succeeded tasks to their events
+	Queue      string `yaml:"queue" env:"QUEUE"`     // pool fed and whose events are published
+}
+
+// runSources consumes the configured message buses into their pools until
+// ctx is done. The returned function waits for every source to stop
+func runSources(ctx context.Context, cfg *config, pools map[string]*pool.WorkerPool) (func(), error) {
+	var wg sync.WaitGroup
+	var closers []func()
+	start := func(src pool.Source, queue string) {
+		p := pools[queue]
+		wg.Go(func() { _ = p.Consume(ctx, src) })
+	}
+
+	if nc := cfg.Sources.NATS; nc.Subject != "" {
+		conn, err := nats.Connect(nc.URL, nats.Name("workerpool"))
+		if err != nil {
+			return nil, fmt.Errorf("connecting to NATS: %w", err)
+		}
+		closers = append(closers, conn.Close)
+		start(natssource.New(conn, natssource.Options{Subject: nc.Subject, QueueGroup: nc.QueueGroup}), nc.Queue)
+	}
+	if kc := cfg.Sources.Kafka; kc.Topic != "" {
+		start(kafkasource.New(kafkasource.Options{Brokers: kc.Brokers, Topic: kc.Topic, GroupID: kc.GroupID}), kc.Queue)
+	}
+	if hc := cfg.Sources.HTTP; hc.URL != "" {
+		header := make(http.Header)
+		for name, value := range hc.Headers {
+			header.Set(name, value)
+		}
+		start(httpsource.New(httpsource.Options{
+			URL:         hc.URL,
+			Interval:    hc.Interval,
+			Header:      header,
+			Items:       hc.Items,
+			Cursor:      hc.Cursor,
+			CursorParam: hc.CursorParam,
+			ID:          hc.ID,
+			Type:        hc.Type,
+		}), hc.Queue)
+	}
+
+	if dc := cfg.Sources.Dir; dc.Path != "" {
+		start(dirsource.New(dirsource.Options{
+			Dir:       dc.Path,
+			Recursive: dc.Recursive,
+			Pattern:   dc.Pattern,
+			Settle:    dc.Settle,
+			Type:      dc.Type,
+			// Files are enqueued once across restarts on backends with
+			// a completion log
+			Ledger: pools[dc.Queue].CompletionLog(),
+		}), dc.Queue)
+	}
+
+	if ac := cfg.Sources.AMQP; ac.Consume != "" || ac.Exchange != "" {
+		conn := amqpsource.Connection{URL: ac.URL}
+		if ac.Consume != "" {
+			start(amqpsource.New(amqpsource.Options{Connection: conn, Queue: ac.Consume, Prefetch: ac.Prefetch}), ac.Queue)
+		}
+		if ac.Exchange != "" {
+			sink := amqpsource.NewSink(amqpsource.SinkOptions{
+				Connection: conn,
+				Exchange:   ac.Exchange,
+				RoutingKey: ac.RoutingKey,
+				Results:    ac.Results,
+			})
+			p := pools[ac.Queue]
+			wg.Go(func() { _ = sink.Run(ctx, p) })
+		}
+	}
+
+	return func() {
+		wg.Wait()
+		for _, c := range closers {
+			c()
+		}
+	}, nil
+}
@@ -0,0 +1,205 @@
+package go_playground
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrUnknownCodec is returned when decoding a task written by a codec that
+// is not registered
+var ErrUnknownCodec = errors.New("unknown task codec")
+
+// Codec serializes whole tasks for backends that persist them or pass them
+// between processes. Backends wrap the encoding in an envelope naming the
+// codec, see MarshalTask, so tasks queued before a codec change still
+// decode after it
+type Codec interface {
+	// Name identifies the codec in envelopes and configuration
+	Name() string
+	Marshal(t Task) ([]byte, error)
+	Unmarshal(data []byte, t *Task) error
+}
+
+// Built-in codecs, registered under their names
+var (
+	JSONCodec    Codec = jsonCodec{}
+	ProtoCodec   Codec = protoCodec{}
+	MsgpackCodec Codec = msgpackCodec{}
+)
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		JSONCodec.Name():    JSONCodec,
+		ProtoCodec.Name():   ProtoCodec,
+		MsgpackCodec.Name(): MsgpackCodec,
+	}
+)
+
+// RegisterCodec makes c available to UnmarshalTask and LookupCodec,
+// replacing any codec of the same name
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[c.Name()] = c
+}
+
+// LookupCodec returns the codec registered under name
+func LookupCodec(name string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownCodec, name)
+	}
+	return c, nil
+}
+
+// CodecNames lists the registered codecs, sorted
+func CodecNames() []string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// envelopeMagic starts every envelope. Tasks stored before envelopes are
+// plain JSON objects and start with '{' instead
+var envelopeMagic = []byte("WPT")
+
+// envelopeVersion is the layout written by MarshalTask: the magic, this
+// version, the length of the codec name, the name and the encoded task
+const envelopeVersion = 1
+
+// MarshalTask encodes t with c, JSONCodec when nil, inside an envelope
+func MarshalTask(c Codec, t Task) ([]byte, error) {
+	if c == nil {
+		c = JSONCodec
+	}
+	name := c.Name()
+	if len(name) == 0 || len(name) > 255 {
+		return nil, fmt.Errorf("codec name %q must be 1 to 255 bytes", name)
+	}
+	body, err := c.Marshal(t)
+	if err != nil {
+		return nil, fmt.Errorf("encoding task %d with %s: %w", t.ID, name, err)
+	}
+	buf := make([]byte, 0, len(envelopeMagic)+2+len(name)+len(body))
+	buf = append(buf, envelopeMagic...)
+	buf = append(buf, envelopeVersion, byte(len(name)))
+	buf = append(buf, name...)
+	return append(buf, body...), nil
+}
+
+// UnmarshalTask decodes a task written by MarshalTask with any registered
+// codec, or a bare JSON task stored before envelopes existed
+func UnmarshalTask(data []byte) (Task, error) {
+	var t Task
+	if !bytes.HasPrefix(data, envelopeMagic) {
+		if len(data) > 0 && data[0] == '{' {
+			err := json.Unmarshal(data, &t)
+			return t, err
+		}
+		return t, errors.New("task is neither an envelope nor JSON")
+	}
+	rest := data[len(envelopeMagic):]
+	if len(rest) < 2 {
+		return t, errors.New("truncated task envelope")
+	}
+	if rest[0] != envelopeVersion {
+		return t, fmt.Errorf("unsupported task envelope version %d", rest[0])
+	}
+	n := int(rest[1])
+	rest = rest[2:]
+	if len(rest) < n {
+		return t, errors.New("truncated task envelope")
+	}
+	c, err := LookupCodec(string(rest[:n]))
+	if err != nil {
+		return t, err
+	}
+	if err := c.Unmarshal(rest[n:], &t); err != nil {
+		return t, fmt.Errorf("decoding task with %s: %w", c.Name(), err)
+	}
+	return t, nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                         { return "json" }
+func (jsonCodec) Marshal(t Task) ([]byte, error)       { return json.Marshal(t) }
+func (jsonCodec) Unmarshal(data []byte, t *Task) error { return json.Unmarshal(data, t) }
+
+// taskField describes a Task field for the binary codecs.
+// Numbers and names must never be reused once tasks were stored with them
+type taskField struct {
+	num  int    // protobuf field number
+	name string // msgpack key, the JSON name
+	ptr  func(t *Task) any
+}
+
+// taskFields lists every serialized field. Codecs skip fields they do not
+// know, so tasks written by a newer build still decode
+var taskFields = []taskField{
+	{1, "id", func(t *Task) any { return &t.ID }},
+	{2, "data", func(t *Task) any { return &t.Data }},
+	{3, "priority", func(t *Task) any { return &t.Priority }},
+	{4, "run_at", func(t *Task) any { return &t.RunAt }},
+	{5, "delay", func(t *Task) any { return &t.Delay }},
+	{6, "timeout", func(t *Task) any { return &t.Timeout }},
+	{7, "attempts", func(t *Task) any { return &t.Attempts }},
+	{8, "expires_at", func(t *Task) any { return &t.ExpiresAt }},
+	{9, "ttl", func(t *Task) any { return &t.TTL }},
+	{10, "type", func(t *Task) any { return &t.Type }},
+	{11, "partition_key", func(t *Task) any { return &t.PartitionKey }},
+	{12, "tenant", func(t *Task) any { return &t.Tenant }},
+	{13, "correlation_id", func(t *Task) any { return &t.CorrelationID }},
+	{14, "idempotency_key", func(t *Task) any { return &t.IdempotencyKey }},
+	{15, "queue", func(t *Task) any { return &t.Queue }},
+	{16, "trace_context", func(t *Task) any { return &t.TraceContext }},
+	{17, "checkpoint", func(t *Task) any { return &t.Checkpoint }},
+	{18, "callback_url", func(t *Task) any { return &t.CallbackURL }},
+	{19, "workflow_id", func(t *Task) any { return &t.WorkflowID }},
+	{20, "step", func(t *Task) any { return &t.Step }},
+	{21, "group_id", func(t *Task) any { return &t.GroupID }},
+	{22, "payload_ref", func(t *Task) any { return &t.PayloadRef }},
+	{23, "weight", func(t *Task) any { return &t.Weight }},
+	{24, "labels", func(t *Task) any { return &t.Labels }},
+	{25, "headers", func(t *Task) any { return &t.Headers }},
+	{26, "schema_version", func(t *Task) any { return &t.SchemaVersion }},
+	{27, "dry_run", func(t *Task) any { return &t.DryRun }},
+	{28, "depends_on", func(t *Task) any { return &t.DependsOn }},
+	{29, "hedge", func(t *Task) any { return &t.Hedge }},
+	{30, "uid", func(t *Task) any { return &t.UID }},
+}
+
+// isZeroField reports whether the field behind ptr holds its zero value,
+// which the binary codecs leave out
+func isZeroField(ptr any) bool {
+	switch v := ptr.(type) {
+	case *int:
+		return *v == 0
+	case *bool:
+		return !*v
+	case *string:
+		return *v == ""
+	case *time.Time:
+		return v.IsZero()
+	case *time.Duration:
+		return *v == 0
+	case *[]int:
+		return len(*v) == 0
+	case *map[string]string:
+		return len(*v) == 0
+	}
+	panic(fmt.Sprintf("unsupported task field type %T", ptr))
+}
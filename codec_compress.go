@@ -0,0 +1,240 @@
+package go_playground
+
+import (
+	"cmp"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrDecompress is returned when a compressed payload is corrupt or
+// decompresses past maxDecompressed
+var ErrDecompress = errors.New("cannot decompress payload")
+
+// CompressionAlgorithm picks how Compression compresses payloads
+type CompressionAlgorithm int
+
+const (
+	// CompressZstd compresses best, at some CPU cost
+	CompressZstd CompressionAlgorithm = iota
+	// CompressSnappy compresses less, but very fast
+	CompressSnappy
+)
+
+// compressionAlgorithms lists the algorithms in the order of their names in
+// errors
+var compressionAlgorithms = []CompressionAlgorithm{CompressZstd, CompressSnappy}
+
+// String returns the algorithm name
+func (a CompressionAlgorithm) String() string {
+	switch a {
+	case CompressZstd:
+		return "zstd"
+	case CompressSnappy:
+		return "snappy"
+	}
+	return fmt.Sprintf("CompressionAlgorithm(%d)", int(a))
+}
+
+// ParseCompressionAlgorithm accepts the names returned by String
+func ParseCompressionAlgorithm(s string) (CompressionAlgorithm, error) {
+	for _, a := range compressionAlgorithms {
+		if s == a.String() {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid compression algorithm %q, want zstd or snappy", s)
+}
+
+// Compression compresses the payloads and checkpoints of tasks stored by a
+// persistent backend, see CompressedCodec, or by the archive. Those
+// shorter than Threshold are stored as they are, as are those the
+// algorithm does not shrink
+type Compression struct {
+	Algorithm CompressionAlgorithm
+	Threshold int // in bytes, 1024 by default
+	Level     int // zstd level, from 1 fastest to 22 best, 3 by default
+}
+
+// defaultCompressionThreshold is the Threshold of a zero Compression
+const defaultCompressionThreshold = 1024
+
+// maxDecompressed bounds a decompressed payload, so a corrupt one cannot
+// take all the memory
+const maxDecompressed = 256 << 20
+
+// compressedVersion follows the algorithm name at the start of every
+// compressed payload, itself followed by base64 of the compressed bytes
+const compressedVersion = ":v1:"
+
+// CompressionStats is what a compressing codec or archive compressed since
+// the process started
+type CompressionStats struct {
+	Algorithm CompressionAlgorithm
+	Payloads  int64 // payloads stored compressed
+	Input     int64 // bytes of those payloads before compression
+	Output    int64 // and after, base64 included
+}
+
+// Ratio returns Output over Input, 1 before anything was compressed
+func (s CompressionStats) Ratio() float64 {
+	if s.Input == 0 {
+		return 1
+	}
+	return float64(s.Output) / float64(s.Input)
+}
+
+// payloadCompressor compresses the payloads of tasks
+type payloadCompressor struct {
+	cfg    Compression
+	prefix string
+	zstd   *zstd.Encoder // nil for snappy
+
+	payloads, input, output atomic.Int64
+}
+
+func newPayloadCompressor(c Compression) *payloadCompressor {
+	if c.Threshold <= 0 {
+		c.Threshold = defaultCompressionThreshold
+	}
+	c.Level = cmp.Or(c.Level, 3)
+	pc := &payloadCompressor{cfg: c, prefix: c.Algorithm.String() + compressedVersion}
+	if c.Algorithm != CompressSnappy {
+		pc.cfg.Algorithm, pc.prefix = CompressZstd, CompressZstd.String()+compressedVersion
+		// Fails only on invalid options
+		pc.zstd, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(c.Level)))
+	}
+	return pc
+}
+
+// compress returns s compressed, or s itself when it is short or does not
+// shrink. Values looking compressed are compressed whatever their size,
+// so decompress does not take them for compressed ones
+func (c *payloadCompressor) compress(s string) string {
+	forced := looksCompressed(s)
+	if len(s) < c.cfg.Threshold && !forced {
+		return s
+	}
+	var b []byte
+	if c.zstd != nil {
+		b = c.zstd.EncodeAll([]byte(s), nil)
+	} else {
+		b = snappy.Encode(nil, []byte(s))
+	}
+	out := c.prefix + base64.RawStdEncoding.EncodeToString(b)
+	if len(out) >= len(s) && !forced {
+		return s
+	}
+	c.payloads.Add(1)
+	c.input.Add(int64(len(s)))
+	c.output.Add(int64(len(out)))
+	return out
+}
+
+// compressTask compresses the payload and checkpoint of t
+func (c *payloadCompressor) compressTask(t *Task) {
+	t.Data = c.compress(t.Data)
+	t.Checkpoint = c.compress(t.Checkpoint)
+}
+
+func (c *payloadCompressor) stats() CompressionStats {
+	return CompressionStats{Algorithm: c.cfg.Algorithm, Payloads: c.payloads.Load(), Input: c.input.Load(), Output: c.output.Load()}
+}
+
+// looksCompressed reports whether s starts like a compressed value
+func looksCompressed(s string) bool {
+	for _, a := range compressionAlgorithms {
+		if strings.HasPrefix(s, a.String()+compressedVersion) {
+			return true
+		}
+	}
+	return false
+}
+
+// zstdDecoder decodes the zstd payloads of every compressor, its
+// DecodeAll being safe for concurrent use
+var zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+	// Fails only on invalid options
+	d, _ := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecompressed))
+	return d
+})
+
+// decompress returns a value compressed by any algorithm in the clear,
+// field naming it in errors. Other values are returned as they are
+func decompress(field, s string) (string, error) {
+	for _, a := range compressionAlgorithms {
+		enc, ok := strings.CutPrefix(s, a.String()+compressedVersion)
+		if !ok {
+			continue
+		}
+		b, err := base64.RawStdEncoding.DecodeString(enc)
+		if err != nil {
+			return "", fmt.Errorf("%w: malformed %s", ErrDecompress, field)
+		}
+		if a == CompressSnappy {
+			var n int
+			if n, err = snappy.DecodedLen(b); err == nil && n > maxDecompressed {
+				err = fmt.Errorf("%d bytes once decompressed, over %d", n, maxDecompressed)
+			}
+			if err == nil {
+				b, err = snappy.Decode(nil, b)
+			}
+		} else {
+			b, err = zstdDecoder().DecodeAll(b, nil)
+		}
+		if err != nil {
+			return "", fmt.Errorf("%w: %s: %v", ErrDecompress, field, err)
+		}
+		return string(b), nil
+	}
+	return s, nil
+}
+
+// decompressTask decompresses what compressTask compressed
+func decompressTask(t *Task) (err error) {
+	if t.Data, err = decompress("data", t.Data); err != nil {
+		return err
+	}
+	t.Checkpoint, err = decompress("checkpoint", t.Checkpoint)
+	return err
+}
+
+// CompressedCodec returns a codec compressing the payload and checkpoint
+// of tasks as c sets before inner encodes them, named after the algorithm
+// and inner, such as "zstd+json". Wrap an EncryptedCodec with it rather
+// than the reverse, as encrypted payloads do not compress. Like any codec
+// it must be registered for the tasks it stored to decode; it decodes the
+// payloads of either algorithm, so both are best registered
+func CompressedCodec(inner Codec, c Compression) Codec {
+	return &compressedCodec{inner: inner, compressor: newPayloadCompressor(c)}
+}
+
+type compressedCodec struct {
+	inner      Codec
+	compressor *payloadCompressor
+}
+
+func (c *compressedCodec) Name() string {
+	return c.compressor.cfg.Algorithm.String() + "+" + c.inner.Name()
+}
+
+func (c *compressedCodec) Marshal(t Task) ([]byte, error) {
+	c.compressor.compressTask(&t)
+	return c.inner.Marshal(t)
+}
+
+func (c *compressedCodec) Unmarshal(data []byte, t *Task) error {
+	if err := c.inner.Unmarshal(data, t); err != nil {
+		return err
+	}
+	return decompressTask(t)
+}
+
+// CompressionStats reports what the codec compressed, for the pool metrics
+func (c *compressedCodec) CompressionStats() CompressionStats { return c.compressor.stats() }
@@ -0,0 +1,180 @@
+package go_playground
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// msgpackCodec writes tasks as MessagePack maps keyed by the JSON field
+// names, leaving out empty fields. Times use the timestamp extension and
+// come back in UTC, and durations are integer nanoseconds
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+
+// msgpackFields indexes taskFields by key
+var msgpackFields = func() map[string]taskField {
+	m := make(map[string]taskField, len(taskFields))
+	for _, f := range taskFields {
+		m[f.name] = f
+	}
+	return m
+}()
+
+func (msgpackCodec) Marshal(t Task) ([]byte, error) {
+	n := 0
+	for _, f := range taskFields {
+		if !isZeroField(f.ptr(&t)) {
+			n++
+		}
+	}
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	if err := enc.EncodeMapLen(n); err != nil {
+		return nil, err
+	}
+	for _, f := range taskFields {
+		ptr := f.ptr(&t)
+		if isZeroField(ptr) {
+			continue
+		}
+		if err := enc.EncodeString(f.name); err != nil {
+			return nil, err
+		}
+		if err := encodeMsgpackField(enc, ptr); err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.name, err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeMsgpackField writes the task field behind ptr
+func encodeMsgpackField(enc *msgpack.Encoder, ptr any) error {
+	switch v := ptr.(type) {
+	case *int:
+		return enc.EncodeInt(int64(*v))
+	case *bool:
+		return enc.EncodeBool(*v)
+	case *string:
+		return enc.EncodeString(*v)
+	case *time.Time:
+		return enc.EncodeTime(*v)
+	case *time.Duration:
+		return enc.EncodeInt(int64(*v))
+	case *[]int:
+		if err := enc.EncodeArrayLen(len(*v)); err != nil {
+			return err
+		}
+		for _, x := range *v {
+			if err := enc.EncodeInt(int64(x)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *map[string]string:
+		if err := enc.EncodeMapLen(len(*v)); err != nil {
+			return err
+		}
+		for _, k := range slices.Sorted(maps.Keys(*v)) {
+			if err := enc.EncodeString(k); err != nil {
+				return err
+			}
+			if err := enc.EncodeString((*v)[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported task field type %T", ptr)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, t *Task) error {
+	*t = Task{}
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	n, err := dec.DecodeMapLen()
+	if err != nil {
+		return err
+	}
+	for range n {
+		key, err := dec.DecodeString()
+		if err != nil {
+			return err
+		}
+		f, known := msgpackFields[key]
+		if !known {
+			if err := dec.Skip(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := decodeMsgpackField(dec, f.ptr(t)); err != nil {
+			return fmt.Errorf("field %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// decodeMsgpackField decodes a value into the task field behind ptr
+func decodeMsgpackField(dec *msgpack.Decoder, ptr any) error {
+	switch p := ptr.(type) {
+	case *int:
+		v, err := dec.DecodeInt64()
+		*p = int(v)
+		return err
+	case *bool:
+		v, err := dec.DecodeBool()
+		*p = v
+		return err
+	case *string:
+		v, err := dec.DecodeString()
+		*p = v
+		return err
+	case *time.Time:
+		// Decoded in the local time zone otherwise
+		v, err := dec.DecodeTime()
+		*p = v.UTC()
+		return err
+	case *time.Duration:
+		v, err := dec.DecodeInt64()
+		*p = time.Duration(v)
+		return err
+	case *[]int:
+		n, err := dec.DecodeArrayLen()
+		if err != nil || n < 0 {
+			return err
+		}
+		*p = make([]int, 0, min(n, 1024))
+		for range n {
+			v, err := dec.DecodeInt64()
+			if err != nil {
+				return err
+			}
+			*p = append(*p, int(v))
+		}
+		return nil
+	case *map[string]string:
+		n, err := dec.DecodeMapLen()
+		if err != nil || n < 0 {
+			return err
+		}
+		*p = make(map[string]string, min(n, 1024))
+		for range n {
+			k, err := dec.DecodeString()
+			if err != nil {
+				return err
+			}
+			v, err := dec.DecodeString()
+			if err != nil {
+				return err
+			}
+			(*p)[k] = v
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported task field type %T", ptr)
+}
@@ -0,0 +1,118 @@
+package go_playground
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// fullTask sets every field of taskFields
+func fullTask() Task {
+	return Task{
+		ID: 42, Data: "hello", Priority: -3, RunAt: time.Date(2026, 3, 4, 5, 6, 7, 8, time.UTC),
+		Delay: 1500 * time.Millisecond, Timeout: time.Minute, Attempts: 2,
+		ExpiresAt: time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC), TTL: time.Hour,
+		Type: "mail", PartitionKey: "user-1", Tenant: "acme", CorrelationID: "req-1", IdempotencyKey: "key",
+		Queue: "emails", TraceContext: map[string]string{"traceparent": "00-abc-def-01"}, Checkpoint: "page=3",
+		CallbackURL: "https://example.com/done", WorkflowID: "wf", Step: "send", GroupID: "g",
+		PayloadRef: "ref", Weight: 70000, Labels: map[string]string{"b": "2", "a": "1"},
+		Headers: map[string]string{"X-Request-ID": "r"}, SchemaVersion: 4, DryRun: true,
+		DependsOn: []int{7, 300}, Hedge: true, UID: "01KDX4TQ3G8N6Y2B5C7D9E0F1H",
+	}
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	for name, task := range map[string]Task{"empty": {}, "full": fullTask()} {
+		t.Run(name, func(t *testing.T) {
+			b, err := msgpackCodec{}.Marshal(task)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			var got Task
+			if err := (msgpackCodec{}).Unmarshal(b, &got); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(got, task) {
+				t.Errorf("round trip gave\n%+v\nwant\n%+v", got, task)
+			}
+		})
+	}
+}
+
+func TestMsgpackTimesDecodeInUTC(t *testing.T) {
+	zone := time.FixedZone("UTC+5", 5*60*60)
+	task := Task{RunAt: time.Date(2026, 3, 4, 10, 0, 0, 0, zone)}
+	b, err := msgpackCodec{}.Marshal(task)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got Task
+	if err := (msgpackCodec{}).Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !got.RunAt.Equal(task.RunAt) || got.RunAt.Location() != time.UTC {
+		t.Errorf("RunAt decoded as %v, want %v in UTC", got.RunAt, task.RunAt.UTC())
+	}
+}
+
+// TestMsgpackDecodesStoredTasks decodes a task written by the codec of
+// earlier releases, which queues may still hold
+func TestMsgpackDecodesStoredTasks(t *testing.T) {
+	stored, _ := hex.DecodeString("8ca269642aa464617461a568656c6c6fa87072696f72697479fda672756e5f6174c70cff000000080000000069a7bdbf" +
+		"a564656c6179d259682f00a8617474656d70747302a474797065a46d61696ca674656e616e74a461636d65a6776569676874d200011170" +
+		"a66c6162656c7382a161a131a162a132a76472795f72756ec3aa646570656e64735f6f6e9207d20000012c")
+	want := Task{ID: 42, Data: "hello", Priority: -3, RunAt: time.Date(2026, 3, 4, 5, 6, 7, 8, time.UTC), Delay: 1500 * time.Millisecond,
+		Attempts: 2, Type: "mail", Tenant: "acme", Labels: map[string]string{"b": "2", "a": "1"}, DependsOn: []int{7, 300}, DryRun: true, Weight: 70000}
+	var got Task
+	if err := (msgpackCodec{}).Unmarshal(stored, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestMsgpackSkipsUnknownFields(t *testing.T) {
+	b, err := msgpack.Marshal(map[string]any{"id": 3, "added_later": map[string]any{"nested": []any{1, "x", 2.5, nil}}, "data": "d"})
+	if err != nil {
+		t.Fatalf("msgpack.Marshal: %v", err)
+	}
+	var got Task
+	if err := (msgpackCodec{}).Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got.ID != 3 || got.Data != "d" {
+		t.Errorf("decoded %+v, want ID 3 and data d", got)
+	}
+}
+
+func FuzzMsgpackUnmarshal(f *testing.F) {
+	for _, task := range []Task{{}, {ID: 1, Data: "x"}, fullTask()} {
+		b, err := msgpackCodec{}.Marshal(task)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var task Task
+		if err := (msgpackCodec{}).Unmarshal(data, &task); err != nil {
+			return
+		}
+		// What decodes encodes again to the same task
+		b, err := msgpackCodec{}.Marshal(task)
+		if err != nil {
+			t.Fatalf("Marshal of a decoded task: %v", err)
+		}
+		var again Task
+		if err := (msgpackCodec{}).Unmarshal(b, &again); err != nil {
+			t.Fatalf("Unmarshal of a re-encoded task: %v", err)
+		}
+		if !reflect.DeepEqual(again, task) {
+			t.Fatalf("re-encoded task decoded as\n%+v\nwant\n%+v", again, task)
+		}
+	})
+}
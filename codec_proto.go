@@ -0,0 +1,223 @@
+package go_playground
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protoCodec writes tasks in the protobuf wire format, as this message
+// would:
+//
+//	message Task {
+//	  sint64 id = 1;
+//	  string data = 2;
+//	  sint64 priority = 3;
+//	  int64 run_at = 4; // Unix nanoseconds
+//	  int64 delay = 5;  // nanoseconds
+//	  ...
+//	  map<string, string> trace_context = 16;
+//	}
+//
+// with the field numbers of taskFields
+type protoCodec struct{}
+
+func (protoCodec) Name() string { return "protobuf" }
+
+func (protoCodec) Marshal(t Task) ([]byte, error) {
+	var b []byte
+	for _, f := range taskFields {
+		ptr := f.ptr(&t)
+		if isZeroField(ptr) {
+			continue
+		}
+		num := protowire.Number(f.num)
+		switch v := ptr.(type) {
+		case *int:
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, protowire.EncodeZigZag(int64(*v)))
+		case *bool:
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, protowire.EncodeBool(*v))
+		case *string:
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendString(b, *v)
+		case *time.Time:
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(v.UnixNano()))
+		case *time.Duration:
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(*v))
+		case *[]int:
+			// Packed, as proto3 writes repeated scalars
+			var packed []byte
+			for _, x := range *v {
+				packed = protowire.AppendVarint(packed, protowire.EncodeZigZag(int64(x)))
+			}
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendBytes(b, packed)
+		case *map[string]string:
+			// Sorted, so equal tasks encode to equal bytes
+			for _, k := range slices.Sorted(maps.Keys(*v)) {
+				var entry []byte
+				entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+				entry = protowire.AppendString(entry, k)
+				entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+				entry = protowire.AppendString(entry, (*v)[k])
+				b = protowire.AppendTag(b, num, protowire.BytesType)
+				b = protowire.AppendBytes(b, entry)
+			}
+		}
+	}
+	return b, nil
+}
+
+// protoFields indexes taskFields by field number
+var protoFields = func() map[protowire.Number]taskField {
+	m := make(map[protowire.Number]taskField, len(taskFields))
+	for _, f := range taskFields {
+		m[protowire.Number(f.num)] = f
+	}
+	return m
+}()
+
+func (protoCodec) Unmarshal(data []byte, t *Task) error {
+	*t = Task{}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		f, known := protoFields[num]
+		if !known {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		n, err := consumeProtoField(f, typ, data, t)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.name, err)
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// consumeProtoField decodes one value of field f into t and returns the
+// bytes it used
+func consumeProtoField(f taskField, typ protowire.Type, data []byte, t *Task) (int, error) {
+	ptr := f.ptr(t)
+	if ints, ok := ptr.(*[]int); ok {
+		return consumeProtoInts(ints, typ, data)
+	}
+	if _, isMap := ptr.(*map[string]string); isMap || isStringField(ptr) {
+		if typ != protowire.BytesType {
+			return 0, errors.New("wrong wire type")
+		}
+		v, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		if s, ok := ptr.(*string); ok {
+			*s = string(v)
+			return n, nil
+		}
+		k, val, err := consumeProtoEntry(v)
+		if err != nil {
+			return 0, err
+		}
+		m := ptr.(*map[string]string)
+		if *m == nil {
+			*m = make(map[string]string)
+		}
+		(*m)[k] = val
+		return n, nil
+	}
+	if typ != protowire.VarintType {
+		return 0, errors.New("wrong wire type")
+	}
+	v, n := protowire.ConsumeVarint(data)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	switch p := ptr.(type) {
+	case *int:
+		*p = int(protowire.DecodeZigZag(v))
+	case *bool:
+		*p = protowire.DecodeBool(v)
+	case *time.Time:
+		*p = time.Unix(0, int64(v))
+	case *time.Duration:
+		*p = time.Duration(int64(v))
+	}
+	return n, nil
+}
+
+// consumeProtoInts appends to ints a repeated sint64, packed or not, and
+// returns the bytes it used
+func consumeProtoInts(ints *[]int, typ protowire.Type, data []byte) (int, error) {
+	switch typ {
+	case protowire.VarintType:
+		v, n := protowire.ConsumeVarint(data)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		*ints = append(*ints, int(protowire.DecodeZigZag(v)))
+		return n, nil
+	case protowire.BytesType:
+		packed, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		for len(packed) > 0 {
+			v, m := protowire.ConsumeVarint(packed)
+			if m < 0 {
+				return 0, protowire.ParseError(m)
+			}
+			*ints = append(*ints, int(protowire.DecodeZigZag(v)))
+			packed = packed[m:]
+		}
+		return n, nil
+	}
+	return 0, errors.New("wrong wire type")
+}
+
+// consumeProtoEntry decodes a map entry message
+func consumeProtoEntry(b []byte) (key, value string, err error) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return "", "", protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.BytesType || (num != 1 && num != 2) {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		} else {
+			var v []byte
+			v, n = protowire.ConsumeBytes(b)
+			if num == 1 {
+				key = string(v)
+			} else {
+				value = string(v)
+			}
+		}
+		if n < 0 {
+			return "", "", protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return key, value, nil
+}
+
+func isStringField(ptr any) bool {
+	_, ok := ptr.(*string)
+	return ok
+}
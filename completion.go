@@ -0,0 +1,127 @@
+package go_playground
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// CompletionLog remembers the tasks and side effects that completed, so a
+// task delivered again after its lease expired, or after a crash between
+// its handler returning and the backend being acknowledged, is not run
+// twice. Pools on a backend implementing it, such as redisqueue, use it
+type CompletionLog interface {
+	// Completed reports whether key was marked completed
+	Completed(key string) (bool, error)
+	MarkCompleted(key string) error
+}
+
+// completionKey is the key of a task in the completion log: its
+// idempotency key, so duplicates submitted to other processes are
+// suppressed as well, or else its ID
+func completionKey(t Task) string {
+	if t.IdempotencyKey != "" {
+		return "key/" + t.IdempotencyKey
+	}
+	return "task/" + strconv.Itoa(t.ID)
+}
+
+// completions returns the completion log of the backend, if any
+func (p *WorkerPool) completions() CompletionLog {
+	l, _ := p.queue.(CompletionLog)
+	return l
+}
+
+// CompletionLog returns the completion log of the backend, nil when it has
+// none. Sources may share it to remember what they enqueued
+func (p *WorkerPool) CompletionLog() CompletionLog {
+	return p.completions()
+}
+
+// alreadyCompleted reports whether a delivered task completed before, in
+// which case it is acknowledged without running again. When the log cannot
+// be read the task runs, at least once being preferred to not at all
+func (p *WorkerPool) alreadyCompleted(task Task) bool {
+	l := p.completions()
+	if l == nil {
+		return false
+	}
+	done, err := l.Completed(completionKey(task))
+	if err != nil {
+		p.taskLogger(task).Warn("completion log: checking task", "error", err)
+		return false
+	}
+	if !done {
+		return false
+	}
+	p.metrics.duplicates.Inc()
+	p.taskLogger(task).Info("duplicate delivery of a completed task, skipping")
+	p.track(task, StateSucceeded, nil)
+	p.ack(task)
+	return true
+}
+
+// markCompleted records that a task succeeded, before its backend is
+// acknowledged
+func (p *WorkerPool) markCompleted(task Task) {
+	if l := p.completions(); l != nil {
+		if err := l.MarkCompleted(completionKey(task)); err != nil {
+			p.taskLogger(task).Error("completion log: marking task", "error", err)
+		}
+	}
+}
+
+// onceKey is the context key of the running task's onceScope
+type onceKey struct{}
+
+// onceScope tracks the side effects of one delivery of a task. Without a
+// completion log they are only remembered across its retries
+type onceScope struct {
+	p    *WorkerPool
+	task Task
+
+	mu   sync.Mutex
+	done map[string]bool
+}
+
+// Once runs fn unless step already completed for the task run with ctx,
+// by an earlier attempt or by an earlier delivery when the backend keeps a
+// CompletionLog. Handlers wrap side effects that must not be repeated,
+// such as a payment, in it, with a step name unique within the task.
+// Tasks submitted with an IdempotencyKey share their steps with its
+// duplicates. Outside of a pool handler fn always runs
+func Once(ctx context.Context, step string, fn func() error) error {
+	s, ok := ctx.Value(onceKey{}).(*onceScope)
+	if !ok {
+		return fn()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done[step] {
+		return nil
+	}
+	key := completionKey(s.task) + "/" + step
+	l := s.p.completions()
+	if l != nil {
+		done, err := l.Completed(key)
+		if err != nil {
+			return fmt.Errorf("completion log: checking step %s: %w", step, err)
+		}
+		if done {
+			s.p.taskLogger(s.task).Info("step already completed, skipping", "step", step)
+			s.done[step] = true
+			return nil
+		}
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	s.done[step] = true
+	if l != nil {
+		if err := l.MarkCompleted(key); err != nil {
+			s.p.taskLogger(s.task).Error("completion log: marking step", "step", step, "error", err)
+		}
+	}
+	return nil
+}
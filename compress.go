@@ -0,0 +1,229 @@
+package go_playground
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// WithCompression compresses responses with gzip or deflate, as the client
+// prefers in Accept-Encoding, at a level of compress/flate such as
+// gzip.DefaultCompression. Bodies sent with Content-Encoding gzip or
+// deflate are decompressed either way
+func WithCompression(level int) ServerOption {
+	return func(s *Server) {
+		if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+			level = gzip.DefaultCompression
+		}
+		s.compressLevel = level
+		s.compress = true
+	}
+}
+
+// encoding decompresses request bodies and, WithCompression, compresses
+// responses
+func (s *Server) encoding(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !decompressBody(w, r) {
+			return
+		}
+		defer r.Body.Close()
+		if s.compress {
+			s.compressResponse(w, r, next)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decompressBody replaces the body of a request sent with a
+// Content-Encoding by what it inflates to, so the body limit applies to
+// that. Other encodings than gzip and deflate get 415
+func decompressBody(w http.ResponseWriter, r *http.Request) bool {
+	enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	var body io.ReadCloser
+	var err error
+	switch enc {
+	case "", "identity":
+		return true
+	case "gzip", "x-gzip":
+		body, err = gzip.NewReader(r.Body)
+	case "deflate":
+		body, err = zlib.NewReader(r.Body)
+	default:
+		w.Header().Set("Accept-Encoding", "gzip, deflate")
+		writeError(w, http.StatusUnsupportedMediaType, "unsupported Content-Encoding "+strconv.Quote(enc), "")
+		return false
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "malformed "+enc+" body: "+err.Error(), "")
+		return false
+	}
+	r.Body = body
+	r.ContentLength = -1
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	return true
+}
+
+// compressResponse serves r, compressing the response when the client
+// accepts it
+func (s *Server) compressResponse(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	enc := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+	w.Header().Add("Vary", "Accept-Encoding")
+	if enc == "" || r.Method == http.MethodHead {
+		next.ServeHTTP(w, r)
+		return
+	}
+	cw := &compressWriter{ResponseWriter: w, encoding: enc, level: s.compressLevel}
+	defer cw.close()
+	next.ServeHTTP(cw, r)
+}
+
+// acceptedEncoding picks gzip or deflate from an Accept-Encoding header,
+// the one with the highest q-value and gzip on a tie, or "" for neither
+func acceptedEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for part := range strings.SplitSeq(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch name = strings.ToLower(name); name {
+		case "*":
+			name = "gzip"
+		case "gzip", "deflate":
+		default:
+			continue
+		}
+		if q > bestQ || q == bestQ && name == "gzip" && q > 0 {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressible reports whether responses of the content type are worth
+// compressing
+func compressible(contentType string) bool {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mt, "text/"):
+		return true
+	case mt == "application/json", mt == "application/x-ndjson", mt == "application/javascript",
+		mt == "application/xml", mt == "image/svg+xml", strings.HasSuffix(mt, "+json"):
+		return true
+	}
+	return false
+}
+
+var (
+	gzipWriters sync.Map // level -> *sync.Pool of *gzip.Writer
+	zlibWriters sync.Map // level -> *sync.Pool of *zlib.Writer
+)
+
+// compressWriter compresses the body once the headers show it is worth it
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	level    int
+
+	decided bool
+	cw      io.WriteCloser // nil when the body goes out as is
+	put     func()         // returns cw to its pool
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	w.decide(code, nil)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.decide(http.StatusOK, b)
+		w.ResponseWriter.WriteHeader(http.StatusOK)
+	}
+	if w.cw == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.cw.Write(b)
+}
+
+// decide starts compressing unless the response is empty, partial,
+// already encoded or of a type that does not compress
+func (w *compressWriter) decide(code int, first []byte) {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	h := w.Header()
+	if h.Get("Content-Type") == "" && first != nil {
+		h.Set("Content-Type", http.DetectContentType(first))
+	}
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified ||
+		code == http.StatusPartialContent || h.Get("Content-Encoding") != "" || !compressible(h.Get("Content-Type")) {
+		return
+	}
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", w.encoding)
+	switch w.encoding {
+	case "gzip":
+		pool := writerPool(&gzipWriters, w.level, func() any {
+			gz, _ := gzip.NewWriterLevel(io.Discard, w.level)
+			return gz
+		})
+		gz := pool.Get().(*gzip.Writer)
+		gz.Reset(w.ResponseWriter)
+		w.cw, w.put = gz, func() { pool.Put(gz) }
+	case "deflate":
+		pool := writerPool(&zlibWriters, w.level, func() any {
+			zw, _ := zlib.NewWriterLevel(io.Discard, w.level)
+			return zw
+		})
+		zw := pool.Get().(*zlib.Writer)
+		zw.Reset(w.ResponseWriter)
+		w.cw, w.put = zw, func() { pool.Put(zw) }
+	}
+}
+
+func writerPool(pools *sync.Map, level int, newWriter func() any) *sync.Pool {
+	p, _ := pools.LoadOrStore(level, &sync.Pool{New: newWriter})
+	return p.(*sync.Pool)
+}
+
+// FlushError lets event streams push what they wrote through the
+// compressor, see http.ResponseController
+func (w *compressWriter) FlushError() error {
+	if !w.decided {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.cw.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close ends the compressed stream
+func (w *compressWriter) close() {
+	if w.cw == nil {
+		return
+	}
+	_ = w.cw.Close()
+	w.put()
+}
@@ -0,0 +1,229 @@
+package go_playground
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// ErrTaskFlushed is recorded on queued tasks dropped by Flush
+var ErrTaskFlushed = errors.New("task flushed from queue")
+
+// ErrFlushUnsupported is returned by Flush when the backend cannot drop
+// its pending tasks
+var ErrFlushUnsupported = errors.New("queue backend does not support flushing")
+
+// flusher is implemented by backends that can drop every pending task
+type flusher interface {
+	// Flush removes and returns the tasks waiting to be popped
+	Flush() ([]Task, error)
+}
+
+// WorkerStatus describes what a worker is doing
+type WorkerStatus struct {
+	ID     int       `json:"id"`
+	Busy   bool      `json:"busy"`
+	TaskID int       `json:"task_id,omitempty"`
+	Since  time.Time `json:"since"` // when the worker started or finished its last task
+
+	Heartbeat time.Time `json:"heartbeat"`       // last sign of life of the task, or the end of its retry backoff
+	Stuck     bool      `json:"stuck,omitempty"` // flagged by the watchdog
+
+	// With WithWorkStealing, the tasks in the local queue of the worker and
+	// those it took from its peers
+	Queued int `json:"queued,omitempty"`
+	Stolen int `json:"stolen,omitempty"`
+
+	// Draining is set on a worker a Resize asked to leave once its current
+	// task is done, since DrainingSince
+	Draining      bool      `json:"draining,omitempty"`
+	DrainingSince time.Time `json:"draining_since,omitzero"`
+}
+
+// Pause stops handing queued tasks to workers. Submissions are still
+// accepted and buffered, and running tasks finish normally. A paused pool
+// only drains on Shutdown once resumed or when its context expires
+func (p *WorkerPool) Pause() {
+	p.pauseMu.Lock()
+	defer p.pauseMu.Unlock()
+	if p.paused == nil {
+		p.paused = make(chan struct{})
+		p.log.Info("pool paused")
+	}
+}
+
+// Resume undoes Pause
+func (p *WorkerPool) Resume() {
+	p.pauseMu.Lock()
+	defer p.pauseMu.Unlock()
+	if p.paused != nil {
+		close(p.paused)
+		p.paused = nil
+		p.log.Info("pool resumed")
+	}
+}
+
+// Paused reports whether the pool is paused
+func (p *WorkerPool) Paused() bool {
+	p.pauseMu.Lock()
+	defer p.pauseMu.Unlock()
+	return p.paused != nil
+}
+
+// waitResumed blocks while the pool is paused. It reports false if the
+// pool was torn down meanwhile
+func (p *WorkerPool) waitResumed() bool {
+	p.pauseMu.Lock()
+	paused := p.paused
+	p.pauseMu.Unlock()
+	if paused == nil {
+		return true
+	}
+
+	select {
+	case <-paused:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+// RetryPolicy returns how failed tasks are retried
+func (p *WorkerPool) RetryPolicy() RetryPolicy {
+	p.retryMu.RLock()
+	defer p.retryMu.RUnlock()
+	return p.retry
+}
+
+// SetRetryPolicy changes how failed tasks are retried while the pool runs.
+// Tasks waiting out a backoff keep the one they got
+func (p *WorkerPool) SetRetryPolicy(rp RetryPolicy) {
+	if rp.MaxAttempts < 1 {
+		return
+	}
+	p.retryMu.Lock()
+	p.retry = rp
+	p.retryMu.Unlock()
+	p.log.Info("retry policy changed", "max_attempts", rp.MaxAttempts, "initial_backoff", rp.InitialBackoff, "max_backoff", rp.MaxBackoff)
+}
+
+// Resize sets the number of workers. Idle workers leave right away, busy
+// ones drain: they finish their current task, handing the next task of
+// its partition and their local queue to the others, before leaving. Until
+// then WorkerStatuses reports them draining, and growing the pool again
+// keeps them first. An autoscaler may change the count again later
+func (p *WorkerPool) Resize(n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	from := p.Workers() - p.DrainingWorkers()
+	if n > from {
+		kept := p.undrainWorkers(n - from)
+		for range n - from - kept {
+			p.startWorkerLocked()
+		}
+	}
+	p.mu.Unlock()
+
+	if n < from {
+		p.drainWorkers(from - n)
+	}
+	p.log.Info("pool resized", "from", from, "to", n)
+}
+
+// Flush drops every task waiting in the queue and returns how many were
+// dropped, leaving out those cancelled before. Delayed tasks and scheduled
+// cron runs are kept
+func (p *WorkerPool) Flush() (int, error) {
+	tasks, err := p.flush()
+	return len(tasks), err
+}
+
+// flush drops every task waiting in the queue and returns them
+func (p *WorkerPool) flush() ([]Task, error) {
+	f, ok := p.queue.(flusher)
+	if !ok {
+		return nil, ErrFlushUnsupported
+	}
+	tasks, err := f.Flush()
+	if err != nil {
+		return nil, err
+	}
+	tasks = p.dropCanceled(tasks)
+	for _, t := range tasks {
+		p.track(t, StateCanceled, ErrTaskFlushed)
+	}
+	// Tasks already popped into the local queues of the workers
+	local := p.stealer.flush()
+	for _, t := range local {
+		p.ack(t)
+	}
+	local = p.dropCanceled(local)
+	for _, t := range local {
+		p.track(t, StateCanceled, ErrTaskFlushed)
+	}
+	tasks = append(tasks, local...)
+	p.log.Warn("queue flushed", "tasks", len(tasks))
+	return tasks, nil
+}
+
+// dropCanceled removes from flushed tasks those cancelled before, which
+// keep their record and are forgotten by Cancel
+func (p *WorkerPool) dropCanceled(tasks []Task) []Task {
+	p.runMu.Lock()
+	defer p.runMu.Unlock()
+	return slices.DeleteFunc(tasks, func(t Task) bool {
+		_, ok := p.canceled[t.ID]
+		delete(p.canceled, t.ID)
+		return ok
+	})
+}
+
+// WorkerStatuses reports every running worker, ordered by ID
+func (p *WorkerPool) WorkerStatuses() []WorkerStatus {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	statuses := make([]WorkerStatus, 0, len(p.statuses))
+	for _, ws := range p.statuses {
+		ws.Queued, ws.Stolen = p.stealer.local(ws.ID)
+		if d := p.drains[ws.ID]; d != nil && !d.since.IsZero() {
+			ws.Draining, ws.DrainingSince = true, d.since
+		}
+		statuses = append(statuses, ws)
+	}
+	slices.SortFunc(statuses, func(a, b WorkerStatus) int { return a.ID - b.ID })
+	return statuses
+}
+
+// InFlight returns the IDs of the tasks currently held by workers
+func (p *WorkerPool) InFlight() []int {
+	p.runMu.Lock()
+	defer p.runMu.Unlock()
+	ids := make([]int, 0, len(p.running))
+	for id := range p.running {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// setStatus records what worker id is doing. A zero taskID means idle
+func (p *WorkerPool) setStatus(id, taskID int) {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	now := time.Now()
+	p.statuses[id] = WorkerStatus{ID: id, Busy: taskID != 0, TaskID: taskID, Since: now, Heartbeat: now}
+}
+
+func (p *WorkerPool) clearStatus(id int) {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	delete(p.statuses, id)
+	delete(p.drains, id)
+}
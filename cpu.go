@@ -0,0 +1,89 @@
+package go_playground
+
+import (
+	"math"
+	"runtime"
+	"time"
+)
+
+// CPUSizing sizes the pool from runtime.GOMAXPROCS, which the Go runtime
+// sets from the CPU limit of the container and updates as the limit
+// changes, so deployments need no hand-tuned worker count
+type CPUSizing struct {
+	// PerCPU is the workers per CPU, such as 2 for tasks waiting on I/O
+	// half of the time. Defaults to 1
+	PerCPU float64
+	// Min and Max bound the worker count, Max unbounded when zero
+	Min, Max int
+	// Interval is how often GOMAXPROCS is checked, the pool being resized
+	// when it changed. Defaults to 30s, negative never checks again
+	Interval time.Duration
+	// Pin binds each worker to an OS thread bound to one of the CPUs the
+	// process may use, round robin. Linux only, ignored with a warning
+	// elsewhere. Goroutines started by handlers are not pinned
+	Pin bool
+}
+
+// workers returns the worker count for procs CPUs
+func (cs CPUSizing) workers(procs int) int {
+	n := max(int(math.Round(cs.PerCPU*float64(procs))), cs.Min, 1)
+	if cs.Max > 0 {
+		n = min(n, cs.Max)
+	}
+	return n
+}
+
+// WithCPUSizing sets the worker count from GOMAXPROCS, see CPUSizing,
+// overriding WithWorkers. With WithAutoscale the pool starts at that count
+// and the autoscaler resizes it from there, GOMAXPROCS changes being left
+// to it
+func WithCPUSizing(cs CPUSizing) Option {
+	return func(p *WorkerPool) {
+		if cs.PerCPU <= 0 {
+			cs.PerCPU = 1
+		}
+		if cs.Interval == 0 {
+			cs.Interval = 30 * time.Second
+		}
+		p.cpuSizing = &cs
+		p.workers = cs.workers(runtime.GOMAXPROCS(0))
+	}
+}
+
+// followCPUs resizes the pool as GOMAXPROCS changes, until it shuts down
+func (p *WorkerPool) followCPUs() {
+	cs := *p.cpuSizing
+	procs := runtime.GOMAXPROCS(0)
+	ticker := time.NewTicker(cs.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.quit:
+			return
+		case <-ticker.C:
+		}
+		now := runtime.GOMAXPROCS(0)
+		if now == procs {
+			continue
+		}
+		p.log.Info("GOMAXPROCS changed, resizing the pool", "from", procs, "to", now)
+		procs = now
+		p.Resize(cs.workers(procs))
+	}
+}
+
+// pinWorker binds the goroutine of a worker to a CPU with WithCPUSizing
+// Pin. The OS thread is left locked: it exits with the worker rather than
+// running other goroutines with its affinity
+func (p *WorkerPool) pinWorker(id int) {
+	if p.cpuSizing == nil || !p.cpuSizing.Pin {
+		return
+	}
+	runtime.LockOSThread()
+	cpu, err := pinThread(id)
+	if err != nil {
+		p.pinWarning.Do(func() { p.log.Warn("workers not pinned to CPUs", "error", err) })
+		return
+	}
+	p.log.Debug("worker pinned", "worker", id, "cpu", cpu)
+}
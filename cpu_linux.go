@@ -0,0 +1,48 @@
+package go_playground
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// allowedCPUs are the CPUs the process may run on at startup, in order
+var allowedCPUs = sync.OnceValues(func() ([]int, error) {
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &set); err != nil {
+		return nil, err
+	}
+	var cpus []int
+	for cpu := range len(set) * 64 {
+		if set.IsSet(cpu) {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+})
+
+// cpuTimeMeasured tells usage reports that threadCPUTime works
+const cpuTimeMeasured = true
+
+// threadCPUTime returns the CPU time used by the calling thread
+func threadCPUTime() (time.Duration, bool) {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_THREAD_CPUTIME_ID, &ts); err != nil {
+		return 0, false
+	}
+	return time.Duration(ts.Nano()), true
+}
+
+// pinThread binds the calling thread to one of the allowed CPUs, chosen
+// round robin by worker, and returns it
+func pinThread(worker int) (int, error) {
+	cpus, err := allowedCPUs()
+	if err != nil || len(cpus) == 0 {
+		return 0, err
+	}
+	cpu := cpus[(worker-1)%len(cpus)]
+	var set unix.CPUSet
+	set.Set(cpu)
+	return cpu, unix.SchedSetaffinity(0, &set)
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package go_playground
+
+import (
+	"errors"
+	"time"
+)
+
+// pinThread fails: thread affinity is only set on Linux
+func pinThread(int) (int, error) {
+	return 0, errors.New("CPU pinning is only supported on Linux")
+}
+
+// cpuTimeMeasured tells usage reports that threadCPUTime fails here
+const cpuTimeMeasured = false
+
+// threadCPUTime fails: the CPU time of a thread is only read on Linux
+func threadCPUTime() (time.Duration, bool) {
+	return 0, false
+}
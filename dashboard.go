@@ -0,0 +1,34 @@
+package go_playground
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// dashboardPath is where the web dashboard is served
+const dashboardPath = "/ui/"
+
+// dashboardFiles is a single page reading the JSON API and the event
+// stream, so it needs no build step or extra endpoints
+//
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// dashboardRoutes serves the dashboard under dashboardPath. The files hold
+// no data and are served without a key; the page asks for one when the API
+// requires it
+func (s *Server) dashboardRoutes() {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err) // the directory is embedded at build time
+	}
+	s.router.Handle(strings.TrimSuffix(dashboardPath, "/"), http.RedirectHandler(dashboardPath, http.StatusMovedPermanently)).Methods("GET")
+	s.router.PathPrefix(dashboardPath).Handler(http.StripPrefix(dashboardPath, http.FileServerFS(files))).Methods("GET")
+}
+
+// isDashboard reports whether a request is for a dashboard file
+func isDashboard(r *http.Request) bool {
+	return r.Method == http.MethodGet && (r.URL.Path == strings.TrimSuffix(dashboardPath, "/") || strings.HasPrefix(r.URL.Path, dashboardPath))
+}
@@ -0,0 +1,217 @@
+// Dashboard of the worker pool API. Queue and worker state is polled; the
+// throughput chart and the failure list follow the event stream of each
+// queue. Streams are read with fetch rather than EventSource, which cannot
+// send the API key header
+"use strict";
+
+const refreshInterval = 2000;
+const reconnectDelay = 3000;
+const chartSeconds = 60;
+const maxFailures = 20;
+// Browsers allow few HTTP/1.1 connections per host, and each stream keeps
+// one open
+const maxStreams = 4;
+
+let apiKey = localStorage.getItem("workerpool-key") || "";
+const streams = new Map(); // queue name -> AbortController
+const deadLettersLoaded = new Set(); // queue names
+const failures = [];
+const buckets = new Map(); // second -> {ok, bad}
+
+// prefix returns the API path prefix of a queue; the first queue listed is
+// the default pool, served at the root
+function prefix(queue) {
+  return queue.isDefault ? "" : "/queues/" + encodeURIComponent(queue.name);
+}
+
+async function api(path, options = {}) {
+  const headers = {};
+  if (apiKey) {
+    headers["X-API-Key"] = apiKey;
+  }
+  const resp = await fetch(path, { ...options, headers });
+  if (resp.status === 401) {
+    document.getElementById("auth").hidden = false;
+    throw new Error("an API key is required");
+  }
+  if (!resp.ok) {
+    const body = await resp.json().catch(() => ({}));
+    throw new Error(body.error || resp.statusText);
+  }
+  return resp;
+}
+
+async function refresh() {
+  try {
+    const queues = (await (await api("/queues")).json()).map((q, i) => ({ ...q, isDefault: i === 0 }));
+    const admins = await Promise.all(queues.map((q) => api(prefix(q) + "/admin").then((r) => r.json())));
+    renderQueues(queues, admins);
+    queues.slice(0, maxStreams).forEach(follow);
+    setStatus("updated " + new Date().toLocaleTimeString());
+  } catch (err) {
+    setStatus(err.message);
+  }
+}
+
+function renderQueues(queues, admins) {
+  const body = document.querySelector("#queues tbody");
+  body.replaceChildren(...queues.map((q, i) => {
+    const tr = document.createElement("tr");
+    const workers = document.createElement("div");
+    workers.className = "workers";
+    for (const ws of admins[i].worker_status || []) {
+      const dot = document.createElement("span");
+      dot.className = "worker" + (ws.stuck ? " stuck" : ws.busy ? " busy" : "");
+      dot.title = ws.busy ? `worker ${ws.id}: task ${ws.task_id}` : `worker ${ws.id}: idle`;
+      workers.append(dot);
+    }
+    const state = q.paused ? "paused" : "running";
+    const circuit = admins[i].circuit && admins[i].circuit !== "closed" ? `, circuit ${admins[i].circuit}` : "";
+    tr.append(
+      cell(q.name),
+      cell(q.queue_depth, "num"),
+      cell(`${q.busy_workers}/${q.workers}`, "num"),
+      cell(workers),
+      cell(state + circuit, q.paused ? "paused" : ""),
+    );
+    return tr;
+  }));
+}
+
+function cell(content, className = "") {
+  const td = document.createElement("td");
+  td.className = className;
+  td.append(content);
+  return td;
+}
+
+// follow reads the terminal events of a queue until the page is closed,
+// reconnecting when the stream drops
+async function follow(queue) {
+  if (streams.has(queue.name)) {
+    return;
+  }
+  const abort = new AbortController();
+  streams.set(queue.name, abort);
+  loadDeadLetters(queue);
+  try {
+    const resp = await api(prefix(queue) + "/events/stream?terminal=true", { signal: abort.signal });
+    const reader = resp.body.pipeThrough(new TextDecoderStream()).getReader();
+    let pending = "";
+    for (;;) {
+      const { value, done } = await reader.read();
+      if (done) {
+        break;
+      }
+      pending += value;
+      const lines = pending.split("\n");
+      pending = lines.pop();
+      for (const line of lines) {
+        if (line.startsWith("data: ")) {
+          record(queue.name, JSON.parse(line.slice(6)));
+        }
+      }
+    }
+  } catch (err) {
+    setStatus(`stream of ${queue.name}: ${err.message}`);
+  }
+  setTimeout(() => {
+    if (streams.get(queue.name) === abort) {
+      streams.delete(queue.name);
+    }
+  }, reconnectDelay);
+}
+
+// loadDeadLetters seeds the failure list with the tasks that failed before
+// the page was opened
+async function loadDeadLetters(queue) {
+  if (deadLettersLoaded.has(queue.name)) {
+    return;
+  }
+  deadLettersLoaded.add(queue.name);
+  try {
+    const dead = await (await api(prefix(queue) + "/deadletter")).json();
+    for (const dl of dead.slice(-maxFailures)) {
+      addFailure({ time: new Date(dl.failed_at), queue: queue.name, id: dl.task.id, error: dl.error });
+    }
+  } catch (err) {
+    // The failure list still fills from the stream
+  }
+}
+
+function record(queue, ev) {
+  const second = Math.floor(Date.parse(ev.time) / 1000);
+  const b = buckets.get(second) || { ok: 0, bad: 0 };
+  if (ev.state === "succeeded") {
+    b.ok++;
+  } else if (ev.state === "failed") {
+    b.bad++;
+    addFailure({ time: new Date(ev.time), queue, id: ev.task.id, error: ev.error || "" });
+  }
+  buckets.set(second, b);
+}
+
+function addFailure(f) {
+  failures.push(f);
+  failures.sort((a, b) => b.time - a.time);
+  failures.length = Math.min(failures.length, maxFailures);
+  document.getElementById("no-failures").hidden = true;
+  document.querySelector("#failures tbody").replaceChildren(...failures.map((f) => {
+    const tr = document.createElement("tr");
+    tr.append(cell(f.time.toLocaleTimeString()), cell(f.queue), cell(f.id, "num"), cell(f.error, "error"));
+    return tr;
+  }));
+}
+
+function drawChart() {
+  const canvas = document.getElementById("throughput");
+  const ctx = canvas.getContext("2d");
+  const styles = getComputedStyle(document.documentElement);
+  const now = Math.floor(Date.now() / 1000);
+  for (const second of buckets.keys()) {
+    if (second <= now - chartSeconds) {
+      buckets.delete(second);
+    }
+  }
+
+  const series = [];
+  for (let s = now - chartSeconds + 1; s <= now; s++) {
+    series.push(buckets.get(s) || { ok: 0, bad: 0 });
+  }
+  const peak = Math.max(1, ...series.map((b) => b.ok + b.bad));
+  const w = canvas.width / chartSeconds;
+  const h = canvas.height - 16;
+
+  ctx.clearRect(0, 0, canvas.width, canvas.height);
+  series.forEach((b, i) => {
+    const ok = (b.ok / peak) * h;
+    const bad = (b.bad / peak) * h;
+    ctx.fillStyle = styles.getPropertyValue("--ok");
+    ctx.fillRect(i * w + 1, canvas.height - ok, w - 2, ok);
+    ctx.fillStyle = styles.getPropertyValue("--bad");
+    ctx.fillRect(i * w + 1, canvas.height - ok - bad, w - 2, bad);
+  });
+  ctx.fillStyle = styles.getPropertyValue("--muted");
+  ctx.font = "12px system-ui, sans-serif";
+  ctx.fillText(`peak ${peak}/s`, 4, 12);
+}
+
+function setStatus(text) {
+  document.getElementById("status").textContent = text;
+}
+
+document.getElementById("auth").addEventListener("submit", (e) => {
+  e.preventDefault();
+  apiKey = document.getElementById("key").value;
+  localStorage.setItem("workerpool-key", apiKey);
+  document.getElementById("auth").hidden = true;
+  for (const abort of streams.values()) {
+    abort.abort();
+  }
+  streams.clear();
+  refresh();
+});
+
+refresh();
+setInterval(refresh, refreshInterval);
+setInterval(drawChart, 1000);
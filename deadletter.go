@@ -0,0 +1,308 @@
+package go_playground
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrTaskNotFound is returned when no task matches the given ID
+var ErrTaskNotFound = errors.New("task not found")
+
+// DefaultDeadLetterLimit is the number of dead letters kept, see
+// WithDeadLetterLimit
+const DefaultDeadLetterLimit = 10000
+
+// DeadLetter is a task that failed permanently
+type DeadLetter struct {
+	Task     Task      `json:"task"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// DeadLetterStore persists dead letters. Backends implementing it, such as
+// redisqueue, pgqueue and boltqueue, keep them across restarts and share
+// them between the processes on the backend, and the pool acknowledges a
+// dead task only once its dead letter is stored. Others keep them in memory
+type DeadLetterStore interface {
+	// SaveDeadLetter stores dl, replacing the one of the same task
+	SaveDeadLetter(dl DeadLetter) error
+	// DeleteDeadLetter reports whether a dead letter of the task was stored
+	DeleteDeadLetter(id int) (bool, error)
+	// LoadDeadLetters returns the dead letters in failure order
+	LoadDeadLetters() ([]DeadLetter, error)
+}
+
+// storedDeadLetter is how MarshalDeadLetter encodes a dead letter
+type storedDeadLetter struct {
+	Task     []byte    `json:"task"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// MarshalDeadLetter encodes dl for a DeadLetterStore, its task with c as
+// MarshalTask does
+func MarshalDeadLetter(c Codec, dl DeadLetter) ([]byte, error) {
+	task, err := MarshalTask(c, dl.Task)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(storedDeadLetter{Task: task, Error: dl.Error, FailedAt: dl.FailedAt})
+}
+
+// UnmarshalDeadLetter decodes a dead letter written by MarshalDeadLetter
+func UnmarshalDeadLetter(data []byte) (DeadLetter, error) {
+	var s storedDeadLetter
+	if err := json.Unmarshal(data, &s); err != nil {
+		return DeadLetter{}, err
+	}
+	task, err := UnmarshalTask(s.Task)
+	if err != nil {
+		return DeadLetter{}, err
+	}
+	return DeadLetter{Task: task, Error: s.Error, FailedAt: s.FailedAt}, nil
+}
+
+// SortDeadLetters puts dls in failure order, as LoadDeadLetters returns
+// them, for stores that do not keep them in it
+func SortDeadLetters(dls []DeadLetter) {
+	slices.SortStableFunc(dls, func(a, b DeadLetter) int { return a.FailedAt.Compare(b.FailedAt) })
+}
+
+// memoryDeadLetters is the DeadLetterStore of backends without one
+type memoryDeadLetters struct {
+	mu    sync.Mutex
+	items []DeadLetter
+}
+
+func (m *memoryDeadLetters) SaveDeadLetter(dl DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items = slices.DeleteFunc(m.items, func(old DeadLetter) bool { return old.Task.ID == dl.Task.ID })
+	m.items = append(m.items, dl)
+	return nil
+}
+
+func (m *memoryDeadLetters) DeleteDeadLetter(id int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.items)
+	m.items = slices.DeleteFunc(m.items, func(dl DeadLetter) bool { return dl.Task.ID == id })
+	return len(m.items) < n, nil
+}
+
+func (m *memoryDeadLetters) LoadDeadLetters() ([]DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.items), nil
+}
+
+// deadLetterQueue keeps permanently failed tasks in a DeadLetterStore, at
+// most limit of them
+type deadLetterQueue struct {
+	// mu serializes the changes, so a dead letter is taken once
+	mu    sync.Mutex
+	store DeadLetterStore
+	// durable is set when store keeps the dead letters across restarts
+	durable bool
+	limit   int
+	count   int // dead letters stored, as far as this process knows
+	dropped func(n int)
+	log     *slog.Logger
+}
+
+// init sets the store and counts the dead letters it holds
+func (q *deadLetterQueue) init(store DeadLetterStore, durable bool, limit int, log *slog.Logger, dropped func(int)) {
+	q.store, q.durable, q.limit, q.log, q.dropped = store, durable, limit, log, dropped
+	dls, err := store.LoadDeadLetters()
+	if err != nil {
+		log.Error("loading dead letters", "error", err)
+	}
+	q.count = len(dls)
+}
+
+// add stores the dead letter of task, then drops the oldest ones past the
+// limit, a tenth of it at a time so a full queue is not reloaded on every
+// failure
+func (q *deadLetterQueue) add(task Task, err error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if serr := q.store.SaveDeadLetter(DeadLetter{Task: task, Error: err.Error(), FailedAt: time.Now()}); serr != nil {
+		return serr
+	}
+	q.count++
+	if q.limit <= 0 || q.count <= q.limit {
+		return nil
+	}
+	dls, lerr := q.store.LoadDeadLetters()
+	if lerr != nil {
+		q.log.Error("loading dead letters to drop the oldest", "error", lerr)
+		return nil
+	}
+	var oldest []DeadLetter
+	if len(dls) > q.limit {
+		oldest = dls[:len(dls)-(q.limit-q.limit/10)]
+	}
+	dropped := 0
+	for _, dl := range oldest {
+		if ok, derr := q.store.DeleteDeadLetter(dl.Task.ID); derr != nil {
+			q.log.Error("dropping dead letter", "task_id", dl.Task.ID, "error", derr)
+		} else if ok {
+			dropped++
+		}
+	}
+	q.count = len(dls) - dropped
+	if dropped > 0 {
+		q.log.Warn("dead-letter queue full, oldest dead letters dropped", "dropped", dropped, "limit", q.limit)
+		q.dropped(dropped)
+	}
+	return nil
+}
+
+func (q *deadLetterQueue) len() int {
+	dls, err := q.list()
+	if err != nil {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.count
+	}
+	return len(dls)
+}
+
+func (q *deadLetterQueue) list() ([]DeadLetter, error) {
+	return q.store.LoadDeadLetters()
+}
+
+// take removes and returns the dead letter for the given task ID
+func (q *deadLetterQueue) take(id int) (DeadLetter, bool, error) {
+	taken, err := q.takeMatching(func(dl DeadLetter) bool { return dl.Task.ID == id }, 1)
+	if len(taken) == 0 {
+		return DeadLetter{}, false, err
+	}
+	return taken[0], true, err
+}
+
+// takeMatching removes and returns up to limit dead letters for which
+// match is true, all of them when limit is zero. Those another process
+// took first are left out
+func (q *deadLetterQueue) takeMatching(match func(DeadLetter) bool, limit int) ([]DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	dls, err := q.store.LoadDeadLetters()
+	if err != nil {
+		return nil, err
+	}
+	var taken []DeadLetter
+	for _, dl := range dls {
+		if limit > 0 && len(taken) == limit {
+			break
+		}
+		if !match(dl) {
+			continue
+		}
+		ok, err := q.store.DeleteDeadLetter(dl.Task.ID)
+		if err != nil {
+			return taken, err
+		}
+		if ok {
+			taken = append(taken, dl)
+			q.count--
+		}
+	}
+	return taken, nil
+}
+
+// putBack restores a dead letter that could not be re-enqueued
+func (q *deadLetterQueue) putBack(dl DeadLetter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.store.SaveDeadLetter(dl); err != nil {
+		q.log.Error("restoring dead letter", "task_id", dl.Task.ID, "error", err)
+		return
+	}
+	q.count++
+}
+
+func (q *deadLetterQueue) purge() (int, error) {
+	taken, err := q.takeMatching(func(DeadLetter) bool { return true }, 0)
+	return len(taken), err
+}
+
+// WithDeadLetterLimit sets the number of dead letters kept,
+// DefaultDeadLetterLimit by default. The oldest are dropped past it. Zero
+// or less keeps them all
+func WithDeadLetterLimit(n int) Option {
+	return func(p *WorkerPool) {
+		p.deadLetterLimit = n
+	}
+}
+
+// WithDeadLetterStore keeps the dead letters in s rather than in the queue
+// backend, when it is a DeadLetterStore, or in memory. Dead tasks are
+// acknowledged once stored in s
+func WithDeadLetterStore(s DeadLetterStore) Option {
+	return func(p *WorkerPool) {
+		p.deadLetterStore = s
+	}
+}
+
+// initDeadLetters picks the store of the dead letters once the queue
+// backend is known
+func (p *WorkerPool) initDeadLetters() {
+	store, durable := p.deadLetterStore, p.deadLetterStore != nil
+	if st, ok := p.queue.(DeadLetterStore); ok && store == nil {
+		store, durable = st, true
+	}
+	if store == nil {
+		store = &memoryDeadLetters{}
+	}
+	p.dlq.init(store, durable, p.deadLetterLimit, p.log, func(n int) { p.metrics.deadLettersDropped.Add(float64(n)) })
+}
+
+// volatileQueue reports whether the queue backend keeps its tasks in
+// memory, so a task left unacknowledged is lost with the process anyway
+func (p *WorkerPool) volatileQueue() bool {
+	_, mem := p.queue.(*MemoryQueue)
+	return mem
+}
+
+// DeadLetters returns a snapshot of the permanently failed tasks
+func (p *WorkerPool) DeadLetters() []DeadLetter {
+	dls, err := p.dlq.list()
+	if err != nil {
+		p.log.Error("loading dead letters", "error", err)
+	}
+	return dls
+}
+
+// RetryDeadLetter moves a dead task back onto the queue with a fresh attempt count
+func (p *WorkerPool) RetryDeadLetter(id int) (Task, error) {
+	dl, ok, err := p.dlq.take(id)
+	if err != nil {
+		return Task{}, fmt.Errorf("taking dead letter: %w", err)
+	}
+	if !ok {
+		return Task{}, ErrTaskNotFound
+	}
+
+	task := dl.Task
+	task.Attempts = 0
+	if err := p.enqueue(task); err != nil {
+		p.dlq.putBack(dl)
+		return task, err
+	}
+	return task, nil
+}
+
+// PurgeDeadLetters drops all dead letters and returns how many were removed
+func (p *WorkerPool) PurgeDeadLetters() int {
+	n, err := p.dlq.purge()
+	if err != nil {
+		p.log.Error("purging dead letters", "error", err)
+	}
+	return n
+}
@@ -0,0 +1,102 @@
+package go_playground
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ackingQueue is a durable-looking backend recording the tasks acknowledged
+type ackingQueue struct {
+	*MemoryQueue
+	mu    sync.Mutex
+	acked []int
+}
+
+func (q *ackingQueue) Ack(t Task) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.acked = append(q.acked, t.ID)
+	return nil
+}
+
+func (q *ackingQueue) ackedIDs() []int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]int(nil), q.acked...)
+}
+
+// failingDeadLetters is a DeadLetterStore that cannot store anything
+type failingDeadLetters struct{ memoryDeadLetters }
+
+func (*failingDeadLetters) SaveDeadLetter(DeadLetter) error { return errors.New("store down") }
+
+func TestDeadLetterLimitDropsOldest(t *testing.T) {
+	p := startPool(t, failing(), WithDeadLetterLimit(10))
+	recs := process(t, p, StateFailed, make([]Task, 11)...)
+
+	dls := p.DeadLetters()
+	// Over the limit, the queue is brought back a tenth under it
+	if len(dls) != 9 {
+		t.Fatalf("%d dead letters, want 9", len(dls))
+	}
+	if got, want := dls[0].Task.ID, recs[2].ID; got != want {
+		t.Errorf("oldest dead letter kept is task %d, want %d", got, want)
+	}
+	if got, want := dls[len(dls)-1].Task.ID, recs[10].ID; got != want {
+		t.Errorf("newest dead letter is task %d, want %d", got, want)
+	}
+}
+
+func TestDeadLetterAckDependsOnDurableStore(t *testing.T) {
+	tests := []struct {
+		name  string
+		store DeadLetterStore
+		acked bool
+	}{
+		{"memory store", nil, false},
+		{"durable store", &memoryDeadLetters{}, true},
+		{"failing store", &failingDeadLetters{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &ackingQueue{MemoryQueue: NewMemoryQueue(10)}
+			opts := []Option{failing(), WithQueueBackend(q)}
+			if tt.store != nil {
+				opts = append(opts, WithDeadLetterStore(tt.store))
+			}
+			p := startPool(t, opts...)
+			rec := process(t, p, StateFailed, Task{})[0]
+
+			if acked := len(q.ackedIDs()) > 0; acked != tt.acked {
+				t.Errorf("task acknowledged: %v, want %v", acked, tt.acked)
+			}
+			if _, failing := tt.store.(*failingDeadLetters); !failing {
+				if dls := p.DeadLetters(); len(dls) != 1 || dls[0].Task.ID != rec.ID {
+					t.Errorf("dead letters %v, want the one of task %d", dls, rec.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestMarshalDeadLetterRoundTrip(t *testing.T) {
+	dl := DeadLetter{
+		Task:     Task{ID: 7, Type: "mail", Data: "hello", Attempts: 3},
+		Error:    "broken",
+		FailedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	b, err := MarshalDeadLetter(JSONCodec, dl)
+	if err != nil {
+		t.Fatalf("MarshalDeadLetter: %v", err)
+	}
+	got, err := UnmarshalDeadLetter(b)
+	if err != nil {
+		t.Fatalf("UnmarshalDeadLetter: %v", err)
+	}
+	if got.Task.ID != dl.Task.ID || got.Task.Data != dl.Task.Data || got.Task.Attempts != dl.Task.Attempts ||
+		got.Error != dl.Error || !got.FailedAt.Equal(dl.FailedAt) {
+		t.Errorf("round trip gave %+v, want %+v", got, dl)
+	}
+}
@@ -0,0 +1,268 @@
+package go_playground
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	runtimepprof "runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Goroutine labels of the workers, inherited by the goroutines their
+// handlers start
+const (
+	queueLabel  = "workerpool_queue"
+	workerLabel = "workerpool_worker"
+)
+
+// labelWorker labels the calling goroutine as worker id of the pool, so
+// its goroutines can be told apart in profiles and counted by Diagnostics
+func (p *WorkerPool) labelWorker(id int) {
+	ctx := runtimepprof.WithLabels(context.Background(), runtimepprof.Labels(
+		queueLabel, cmp.Or(p.name, "default"), workerLabel, strconv.Itoa(id)))
+	runtimepprof.SetGoroutineLabels(ctx)
+}
+
+// ChannelLen is the fill of a channel
+type ChannelLen struct {
+	Len int `json:"len"`
+	Cap int `json:"cap"`
+}
+
+// PoolDiagnostics is the internal state of a pool, see Diagnostics
+type PoolDiagnostics struct {
+	Queue       string `json:"queue"`
+	Workers     int    `json:"workers"`
+	BusyWorkers int    `json:"busy_workers"`
+	// Goroutines counts the goroutines of each worker, its own and those
+	// its handlers started that are still running
+	Goroutines  map[int]int  `json:"goroutines_per_worker"`
+	Backend     int          `json:"backend_len"`  // tasks in the queue backend
+	Held        int          `json:"held"`         // popped by the dispatcher, not handed off yet
+	GateHeld    int          `json:"gate_held"`    // held back by type, partition or tenant limits
+	LocalQueues int          `json:"local_queued"` // in the local queues of work stealing
+	Scheduled   int          `json:"scheduled"`    // delayed tasks and recurring schedules
+	Blocked     int          `json:"blocked"`      // waiting for their dependencies
+	Jobs        ChannelLen   `json:"jobs"`         // dispatcher to workers
+	GateReady   ChannelLen   `json:"gate_ready"`
+	Subscribers []ChannelLen `json:"event_subscribers"`
+}
+
+// RuntimeDiagnostics is the state of the Go runtime
+type RuntimeDiagnostics struct {
+	GoVersion    string    `json:"go_version"`
+	GOMAXPROCS   int       `json:"gomaxprocs"`
+	NumCPU       int       `json:"num_cpu"`
+	Goroutines   int       `json:"goroutines"`
+	HeapAlloc    uint64    `json:"heap_alloc_bytes"`
+	HeapInuse    uint64    `json:"heap_inuse_bytes"`
+	HeapObjects  uint64    `json:"heap_objects"`
+	Sys          uint64    `json:"sys_bytes"`
+	NumGC        int64     `json:"num_gc"`
+	LastGC       time.Time `json:"last_gc,omitzero"`
+	PauseTotal   string    `json:"gc_pause_total"`
+	RecentPauses []string  `json:"gc_recent_pauses"` // latest first
+	GCCPU        float64   `json:"gc_cpu_fraction"`
+}
+
+// debugResponse is the body of GET /debug/pool
+type debugResponse struct {
+	Runtime RuntimeDiagnostics `json:"runtime"`
+	Pools   []PoolDiagnostics  `json:"pools"`
+}
+
+// Diagnostics returns the internal state of the pool, for debugging
+// slowdowns
+func (p *WorkerPool) Diagnostics() PoolDiagnostics {
+	return p.diagnostics(workerGoroutines())
+}
+
+func (p *WorkerPool) diagnostics(goroutines map[string]map[int]int) PoolDiagnostics {
+	d := PoolDiagnostics{
+		Queue:       cmp.Or(p.name, "default"),
+		Workers:     p.Workers(),
+		BusyWorkers: p.BusyWorkers(),
+		Goroutines:  goroutines[cmp.Or(p.name, "default")],
+		Backend:     p.queue.Len(),
+		Held:        p.heldCount(),
+		LocalQueues: p.stealer.len(),
+		Blocked:     p.Blocked(),
+		Jobs:        ChannelLen{len(p.jobs), cap(p.jobs)},
+		Subscribers: p.events.lens(),
+	}
+	if d.Goroutines == nil {
+		d.Goroutines = map[int]int{}
+	}
+	d.GateHeld = p.gate.heldCount()
+	d.GateReady = ChannelLen{len(p.gate.ready), cap(p.gate.ready)}
+	p.sched.mu.Lock()
+	d.Scheduled = len(p.sched.items)
+	p.sched.mu.Unlock()
+	return d
+}
+
+// StateReport is what a pool is doing, see State
+type StateReport struct {
+	Queue       string          `json:"queue"`
+	Paused      bool            `json:"paused"`
+	QueueDepth  int             `json:"queue_depth"`
+	Workers     []WorkerStatus  `json:"workers"`
+	InFlight    []InFlightTask  `json:"in_flight"`
+	Diagnostics PoolDiagnostics `json:"diagnostics"`
+}
+
+// InFlightTask is a task held by a worker
+type InFlightTask struct {
+	ID            int        `json:"id"`
+	Type          string     `json:"type,omitempty"`
+	Tenant        string     `json:"tenant,omitempty"`
+	CorrelationID string     `json:"correlation_id,omitempty"`
+	Attempts      int        `json:"attempts"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	Progress      *Progress  `json:"progress,omitempty"`
+}
+
+// State reports the queue, the workers and the tasks they run, for
+// dumping to the log when the API is out of reach
+func (p *WorkerPool) State() StateReport {
+	r := StateReport{
+		Queue:       cmp.Or(p.name, "default"),
+		Paused:      p.Paused(),
+		QueueDepth:  p.QueueDepth(),
+		Workers:     p.WorkerStatuses(),
+		InFlight:    []InFlightTask{},
+		Diagnostics: p.Diagnostics(),
+	}
+	for _, id := range p.InFlight() {
+		rec, err := p.store.Get(id)
+		if err != nil {
+			r.InFlight = append(r.InFlight, InFlightTask{ID: id})
+			continue
+		}
+		r.InFlight = append(r.InFlight, InFlightTask{
+			ID:            id,
+			Type:          rec.Type,
+			Tenant:        rec.Tenant,
+			CorrelationID: rec.CorrelationID,
+			Attempts:      rec.Attempts,
+			StartedAt:     rec.StartedAt,
+			Progress:      rec.Progress,
+		})
+	}
+	return r
+}
+
+// lens returns the fill of the subscriber channels
+func (b *eventBus) lens() []ChannelLen {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	out := make([]ChannelLen, 0, len(b.subs))
+	for _, ch := range b.subs {
+		out = append(out, ChannelLen{len(ch), cap(ch)})
+	}
+	return out
+}
+
+// workerGoroutines counts the goroutines labelled with each worker, by
+// queue, from the goroutine profile
+func workerGoroutines() map[string]map[int]int {
+	var buf bytes.Buffer
+	if err := runtimepprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return nil
+	}
+	counts := make(map[string]map[int]int)
+	n := 0
+	sc := bufio.NewScanner(&buf)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		// Each stack starts with "<count> @ <pcs>", followed by its labels
+		if head, _, ok := strings.Cut(line, " @ "); ok {
+			n, _ = strconv.Atoi(head)
+			continue
+		}
+		labels, ok := strings.CutPrefix(line, "# labels: ")
+		if !ok {
+			continue
+		}
+		var m map[string]string
+		if json.Unmarshal([]byte(labels), &m) != nil {
+			continue
+		}
+		worker, err := strconv.Atoi(m[workerLabel])
+		if err != nil {
+			continue
+		}
+		q := m[queueLabel]
+		if counts[q] == nil {
+			counts[q] = make(map[int]int)
+		}
+		counts[q][worker] += n
+	}
+	return counts
+}
+
+func runtimeDiagnostics() RuntimeDiagnostics {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	gc := debug.GCStats{Pause: make([]time.Duration, 10)}
+	debug.ReadGCStats(&gc)
+	d := RuntimeDiagnostics{
+		GoVersion:    runtime.Version(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		NumCPU:       runtime.NumCPU(),
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    ms.HeapAlloc,
+		HeapInuse:    ms.HeapInuse,
+		HeapObjects:  ms.HeapObjects,
+		Sys:          ms.Sys,
+		NumGC:        gc.NumGC,
+		PauseTotal:   gc.PauseTotal.String(),
+		RecentPauses: make([]string, 0, len(gc.Pause)),
+		GCCPU:        ms.GCCPUFraction,
+	}
+	if gc.NumGC > 0 {
+		d.LastGC = gc.LastGC
+	}
+	for _, pause := range gc.Pause {
+		d.RecentPauses = append(d.RecentPauses, pause.String())
+	}
+	return d
+}
+
+// debugRoutes mounts net/http/pprof under /debug/pprof/ and the pool
+// diagnostics at /debug/pool
+func (s *Server) debugRoutes() {
+	s.router.HandleFunc("/debug/pool", s.debugPoolHandler).Methods("GET")
+	s.router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	s.router.HandleFunc("/debug/pprof/profile", s.unbounded(pprof.Profile))
+	s.router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	s.router.HandleFunc("/debug/pprof/trace", s.unbounded(pprof.Trace))
+	s.router.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+}
+
+// unbounded lifts the write timeout of the server for handlers that take
+// as long as their seconds parameter asks
+func (s *Server) unbounded(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		h(w, r)
+	}
+}
+
+func (s *Server) debugPoolHandler(w http.ResponseWriter, r *http.Request) {
+	goroutines := workerGoroutines()
+	resp := debugResponse{Runtime: runtimeDiagnostics()}
+	for _, p := range s.allPools() {
+		resp.Pools = append(resp.Pools, p.diagnostics(goroutines))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,208 @@
+package go_playground
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+var (
+	// ErrDependencyNotFound is returned by Submit for a task depending on
+	// an ID the pool has no record of
+	ErrDependencyNotFound = errors.New("dependency not found")
+	// ErrDependencyFailed is recorded on tasks one of whose dependencies
+	// failed or was cancelled
+	ErrDependencyFailed = errors.New("dependency did not succeed")
+)
+
+// dependencies holds the tasks submitted with Task.DependsOn until their
+// dependencies succeed. Like delayed tasks they live in memory and take a
+// slot in the delayed group, so Shutdown waits for them
+type dependencies struct {
+	mu         sync.Mutex
+	waiting    map[int]*blockedTask // by task ID
+	dependents map[int][]int        // IDs of the tasks waiting on each dependency
+}
+
+type blockedTask struct {
+	task    Task
+	pending int // dependencies yet to succeed
+}
+
+// checkDependencies refuses a task depending on tasks the pool does not
+// know
+func (p *WorkerPool) checkDependencies(task Task) error {
+	for _, id := range task.DependsOn {
+		if _, err := p.store.Get(id); errors.Is(err, ErrTaskNotFound) {
+			return fmt.Errorf("%w: task %d", ErrDependencyNotFound, id)
+		}
+	}
+	return nil
+}
+
+// enqueueBlocked holds a task with dependencies, see block
+func (p *WorkerPool) enqueueBlocked(task Task) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+	p.delayed.Add(1)
+	p.mu.Unlock()
+
+	p.block(task)
+	return nil
+}
+
+// block records task as queued and holds it until its dependencies
+// succeed, failing it as soon as one does not. The caller took its slot in
+// the delayed group
+func (p *WorkerPool) block(task Task) {
+	p.track(task, StateQueued, nil)
+
+	d := &p.deps
+	d.mu.Lock()
+	b := &blockedTask{task: task}
+	var failed error
+	ids := slices.Compact(slices.Sorted(slices.Values(task.DependsOn)))
+	for _, id := range ids {
+		rec, err := p.store.Get(id)
+		switch {
+		case err != nil:
+			failed = fmt.Errorf("%w: task %d: %v", ErrDependencyFailed, id, err)
+		case rec.State == StateSucceeded:
+		case rec.State.Terminal():
+			failed = dependencyError(rec)
+		default:
+			b.pending++
+		}
+		if failed != nil {
+			break
+		}
+	}
+	if failed == nil && b.pending > 0 {
+		if d.waiting == nil {
+			d.waiting = make(map[int]*blockedTask)
+			d.dependents = make(map[int][]int)
+		}
+		d.waiting[task.ID] = b
+		for _, id := range ids {
+			d.dependents[id] = append(d.dependents[id], task.ID)
+		}
+	}
+	d.mu.Unlock()
+
+	switch {
+	case failed != nil:
+		p.failBlocked(task, failed)
+	case b.pending == 0:
+		p.unblock(task)
+	default:
+		p.taskLogger(task).Info("task waiting for dependencies", "depends_on", ids, "pending", b.pending)
+	}
+}
+
+// dependencyError is the error of a task whose dependency rec did not
+// succeed
+func dependencyError(rec TaskRecord) error {
+	return fmt.Errorf("%w: task %d %s", ErrDependencyFailed, rec.ID, rec.State)
+}
+
+// blocked reports whether the task of id waits for its dependencies
+func (p *WorkerPool) blocked(id int) bool {
+	p.deps.mu.Lock()
+	defer p.deps.mu.Unlock()
+	_, ok := p.deps.waiting[id]
+	return ok
+}
+
+// dependencyDone moves on the tasks waiting on rec, which just ended. The
+// released tasks are queued from their own goroutine so a worker never
+// blocks on a full queue
+func (p *WorkerPool) dependencyDone(rec TaskRecord) {
+	d := &p.deps
+	d.mu.Lock()
+	var ready, failed []Task
+	blocked, self := d.waiting[rec.ID]
+	if self {
+		// Cancelled while waiting
+		delete(d.waiting, rec.ID)
+	}
+	for _, id := range d.dependents[rec.ID] {
+		b, ok := d.waiting[id]
+		if !ok {
+			continue
+		}
+		if rec.State != StateSucceeded {
+			delete(d.waiting, id)
+			failed = append(failed, b.task)
+			continue
+		}
+		if b.pending--; b.pending == 0 {
+			delete(d.waiting, id)
+			ready = append(ready, b.task)
+		}
+	}
+	delete(d.dependents, rec.ID)
+	d.mu.Unlock()
+
+	if self {
+		p.runMu.Lock()
+		delete(p.canceled, blocked.task.ID)
+		p.runMu.Unlock()
+		p.delayed.Done()
+	}
+	if len(ready) == 0 && len(failed) == 0 {
+		return
+	}
+	go func() {
+		for _, t := range failed {
+			p.failBlocked(t, dependencyError(rec))
+		}
+		for _, t := range ready {
+			p.unblock(t)
+		}
+	}()
+}
+
+// unblock queues a task whose dependencies all succeeded, or hands it to
+// the scheduler if its RunAt is still ahead
+func (p *WorkerPool) unblock(task Task) {
+	if p.synchronous {
+		defer p.delayed.Done()
+		if err := p.runInline(task); err != nil {
+			p.track(task, StateFailed, err)
+		}
+		return
+	}
+	if p.until(task.RunAt) > 0 {
+		p.sched.add(schedEntry{at: task.RunAt, task: task})
+		p.taskLogger(task).Info("task delayed", "run_at", task.RunAt)
+		return
+	}
+	defer p.delayed.Done()
+	if err := p.push(task); err != nil {
+		p.taskLogger(task).Warn("task rejected", "error", err)
+		p.track(task, StateFailed, err)
+		return
+	}
+	p.logTask(task, slog.LevelInfo, "task enqueued", slog.Int("priority", task.Priority))
+}
+
+// failBlocked fails a task whose dependency did not succeed, which in turn
+// fails the tasks depending on it
+func (p *WorkerPool) failBlocked(task Task, err error) {
+	defer p.delayed.Done()
+	p.metrics.dependencyFailed.Inc()
+	p.taskLogger(task).Warn("task failed with its dependency", "error", err)
+	p.track(task, StateFailed, err)
+}
+
+// Blocked returns the number of tasks waiting for their dependencies
+func (p *WorkerPool) Blocked() int {
+	p.deps.mu.Lock()
+	defer p.deps.mu.Unlock()
+	return len(p.deps.waiting)
+}
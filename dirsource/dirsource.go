@@ -0,0 +1,304 @@
+// Package dirsource is a pool.Source enqueuing a task per file created or
+// modified in a directory, watched with fsnotify
+package dirsource
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	pool "playground"
+)
+
+// File is the data of the tasks, as JSON
+type File struct {
+	Path    string    `json:"path"` // of the file, Dir joined with its relative path
+	Name    string    `json:"name"` // relative to Dir
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Mode    string    `json:"mode"`
+}
+
+// Options configures a Source
+type Options struct {
+	// Dir is the directory watched
+	Dir string
+	// Recursive watches the subdirectories of Dir as well
+	Recursive bool
+	// Pattern filters the files by name, as filepath.Match, all when empty
+	Pattern string
+	// Settle is how long a file must go unmodified before its task is
+	// enqueued, so files still being written are left alone. Defaults to
+	// 2s
+	Settle time.Duration
+	// Type is the type of the tasks
+	Type string
+	// Ledger remembers the versions of files enqueued, so each is enqueued
+	// once across restarts. Pass the completion log of a persistent
+	// backend, such as WorkerPool.CompletionLog with redisqueue or pgqueue,
+	// which remember files for their CompletionTTL. Defaults to memory,
+	// every file being enqueued again after a restart
+	Ledger pool.CompletionLog
+	// Logger receives watch errors. Defaults to slog.Default()
+	Logger *slog.Logger
+}
+
+// Source watches a directory through the change notifications of the
+// operating system, enqueuing a task for each new file and each file
+// whose size or modification time changed; deleted files are ignored.
+// Files present when Run starts are enqueued too. Tasks carry a File and
+// an idempotency key naming the version of the file, recorded in the
+// Ledger once the task is queued
+type Source struct {
+	opts    Options
+	seen    map[string]string    // relative path -> version enqueued, saving Ledger lookups
+	pending map[string]time.Time // relative path -> when to look at the file again
+}
+
+// New creates a source. Nothing is watched until Run
+func New(opts Options) *Source {
+	if opts.Settle <= 0 {
+		opts.Settle = 2 * time.Second
+	}
+	if opts.Ledger == nil {
+		opts.Ledger = &memoryLedger{keys: make(map[string]bool)}
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return &Source{opts: opts, seen: make(map[string]string), pending: make(map[string]time.Time)}
+}
+
+// Name implements pool.Source
+func (s *Source) Name() string {
+	return "dir:" + s.opts.Dir
+}
+
+// Run implements pool.Source
+func (s *Source) Run(ctx context.Context, submit func(context.Context, pool.Task) error) error {
+	if _, err := os.Stat(s.opts.Dir); err != nil {
+		return fmt.Errorf("dirsource: %w", err)
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("dirsource: %w", err)
+	}
+	defer w.Close()
+	// Watched before the walk, so no file created meanwhile is missed
+	if err := s.scan(w, s.opts.Dir); err != nil {
+		return fmt.Errorf("dirsource: watching %s: %w", s.opts.Dir, err)
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			s.changed(w, ev)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			s.opts.Logger.Error("dirsource: watching", "dir", s.opts.Dir, "error", err)
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// Changes were lost, look at every file again
+				if err := s.scan(w, s.opts.Dir); err != nil {
+					s.opts.Logger.Error("dirsource: scanning", "dir", s.opts.Dir, "error", err)
+				}
+			}
+		case <-timer.C:
+			s.settled(ctx, submit)
+		}
+		timer.Stop()
+		if next, ok := s.next(); ok {
+			timer.Reset(time.Until(next))
+		}
+	}
+}
+
+// scan watches dir, and its subdirectories with Recursive, and marks the
+// files in them pending
+func (s *Source) scan(w *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// A file removed during the walk is no reason to stop
+			if path != dir {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path != s.opts.Dir && !s.opts.Recursive {
+				return filepath.SkipDir
+			}
+			return w.Add(path)
+		}
+		if name, ok := s.wanted(path, d.Name()); ok {
+			s.pending[name] = time.Now()
+		}
+		return nil
+	})
+}
+
+// wanted returns the name of the file at path relative to Dir, and whether
+// it is to be enqueued
+func (s *Source) wanted(path, base string) (string, bool) {
+	if s.opts.Pattern != "" {
+		if ok, _ := filepath.Match(s.opts.Pattern, base); !ok {
+			return "", false
+		}
+	}
+	rel, err := filepath.Rel(s.opts.Dir, path)
+	if err != nil {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// changed follows a notification: files written are looked at once they
+// may have settled, new directories are watched with Recursive and
+// deleted files are forgotten, a file created again under their name
+// being looked up in the Ledger
+func (s *Source) changed(w *fsnotify.Watcher, ev fsnotify.Event) {
+	if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+		if name, ok := s.wanted(ev.Name, filepath.Base(ev.Name)); ok {
+			delete(s.pending, name)
+			delete(s.seen, name)
+		}
+		return
+	}
+	if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Write) {
+		return
+	}
+	if ev.Has(fsnotify.Create) && s.opts.Recursive {
+		if info, err := os.Lstat(ev.Name); err == nil && info.IsDir() {
+			// Files may have been created in it before it was watched
+			if err := s.scan(w, ev.Name); err != nil {
+				s.opts.Logger.Error("dirsource: watching", "dir", ev.Name, "error", err)
+			}
+			return
+		}
+	}
+	if name, ok := s.wanted(ev.Name, filepath.Base(ev.Name)); ok {
+		s.pending[name] = time.Now().Add(s.opts.Settle)
+	}
+}
+
+// next returns when the earliest pending file is to be looked at
+func (s *Source) next() (time.Time, bool) {
+	var at time.Time
+	for _, t := range s.pending {
+		if at.IsZero() || t.Before(at) {
+			at = t
+		}
+	}
+	return at, !at.IsZero()
+}
+
+// settled enqueues the pending files that went unmodified for Settle,
+// looking again later at those still being written
+func (s *Source) settled(ctx context.Context, submit func(context.Context, pool.Task) error) {
+	now := time.Now()
+	for name, at := range s.pending {
+		if at.After(now) {
+			continue
+		}
+		path := filepath.Join(s.opts.Dir, filepath.FromSlash(name))
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			delete(s.pending, name)
+			continue
+		}
+		if left := s.opts.Settle - now.Sub(info.ModTime()); left > 0 {
+			s.pending[name] = now.Add(left)
+			continue
+		}
+		delete(s.pending, name)
+		version := strconv.FormatInt(info.ModTime().UnixNano(), 10) + "-" + strconv.FormatInt(info.Size(), 10)
+		if s.seen[name] == version {
+			continue
+		}
+		s.enqueue(ctx, submit, File{
+			Path:    path,
+			Name:    name,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Mode:    info.Mode().String(),
+		}, version)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// maxKey is the longest idempotency key the pool takes, longer ones being
+// hashed
+const maxKey = 255
+
+// enqueue submits the task of a file version unless the Ledger has it
+func (s *Source) enqueue(ctx context.Context, submit func(context.Context, pool.Task) error, f File, version string) {
+	key := "file:" + f.Path + "@" + version
+	if len(key) > maxKey {
+		sum := sha256.Sum256([]byte(key))
+		key = "file:" + hex.EncodeToString(sum[:])
+	}
+	log := s.opts.Logger.With("dir", s.opts.Dir, "file", f.Name)
+	done, err := s.opts.Ledger.Completed("dirsource/" + key)
+	if err != nil {
+		log.Warn("dirsource: checking the ledger", "error", err)
+		return
+	}
+	if done {
+		s.seen[f.Name] = version
+		return
+	}
+	data, _ := json.Marshal(f)
+	task := pool.Task{Type: s.opts.Type, Data: string(data), IdempotencyKey: key}
+	if err := submit(ctx, task); err != nil {
+		if ctx.Err() == nil {
+			log.Warn("dirsource: dropping file", "error", err)
+			s.seen[f.Name] = version
+		}
+		return
+	}
+	s.seen[f.Name] = version
+	if err := s.opts.Ledger.MarkCompleted("dirsource/" + key); err != nil {
+		log.Error("dirsource: recording the file in the ledger", "error", err)
+	}
+}
+
+// memoryLedger is the Ledger of sources without one
+type memoryLedger struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+func (l *memoryLedger) Completed(key string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.keys[key], nil
+}
+
+func (l *memoryLedger) MarkCompleted(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.keys[key] = true
+	return nil
+}
@@ -0,0 +1,165 @@
+package dirsource_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	pool "playground"
+	"playground/dirsource"
+)
+
+// run starts a source on opts and returns the files it enqueues
+func run(t *testing.T, opts dirsource.Options) <-chan dirsource.File {
+	t.Helper()
+	opts.Settle = 20 * time.Millisecond
+	opts.Logger = slog.New(slog.DiscardHandler)
+	files := make(chan dirsource.File, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- dirsource.New(opts).Run(ctx, func(_ context.Context, task pool.Task) error {
+			var f dirsource.File
+			if err := json.Unmarshal([]byte(task.Data), &f); err != nil {
+				t.Errorf("task data %q: %v", task.Data, err)
+			}
+			files <- f
+			return nil
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run: %v", err)
+		}
+	})
+	// Let the watcher start
+	time.Sleep(20 * time.Millisecond)
+	return files
+}
+
+func write(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// next returns the next file enqueued
+func next(t *testing.T, files <-chan dirsource.File) dirsource.File {
+	t.Helper()
+	select {
+	case f := <-files:
+		return f
+	case <-time.After(5 * time.Second):
+		t.Fatal("no file enqueued")
+		return dirsource.File{}
+	}
+}
+
+// none checks that no more file is enqueued
+func none(t *testing.T, files <-chan dirsource.File) {
+	t.Helper()
+	select {
+	case f := <-files:
+		t.Errorf("%s enqueued, want nothing", f.Name)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSourceEnqueuesNewAndModifiedFiles(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "before.csv"), "old")
+	files := run(t, dirsource.Options{Dir: dir, Pattern: "*.csv"})
+	if f := next(t, files); f.Name != "before.csv" || f.Size != 3 {
+		t.Errorf("enqueued %+v, want the existing before.csv", f)
+	}
+
+	write(t, filepath.Join(dir, "skipped.txt"), "x")
+	write(t, filepath.Join(dir, "new.csv"), "hello")
+	if f := next(t, files); f.Name != "new.csv" || f.Path != filepath.Join(dir, "new.csv") || f.Size != 5 {
+		t.Errorf("enqueued %+v, want new.csv", f)
+	}
+	none(t, files)
+
+	write(t, filepath.Join(dir, "new.csv"), "hello again")
+	if f := next(t, files); f.Name != "new.csv" || f.Size != 11 {
+		t.Errorf("enqueued %+v, want the modified new.csv", f)
+	}
+	none(t, files)
+}
+
+func TestSourceWaitsForFilesToSettle(t *testing.T) {
+	dir := t.TempDir()
+	files := run(t, dirsource.Options{Dir: dir})
+	path := filepath.Join(dir, "growing")
+	for i := range 10 {
+		write(t, path, string(make([]byte, i+1)))
+		time.Sleep(5 * time.Millisecond)
+	}
+	if f := next(t, files); f.Size != 10 {
+		t.Errorf("enqueued %d bytes, want the 10 of the finished file", f.Size)
+	}
+	none(t, files)
+}
+
+func TestSourceWatchesNewSubdirectories(t *testing.T) {
+	dir := t.TempDir()
+	files := run(t, dirsource.Options{Dir: dir, Recursive: true})
+	sub := filepath.Join(dir, "a", "b")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write(t, filepath.Join(sub, "f"), "x")
+	if f := next(t, files); f.Name != "a/b/f" {
+		t.Errorf("enqueued %s, want a/b/f", f.Name)
+	}
+}
+
+func TestSourceIgnoresSubdirectoriesUnlessRecursive(t *testing.T) {
+	dir := t.TempDir()
+	files := run(t, dirsource.Options{Dir: dir})
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write(t, filepath.Join(dir, "sub", "f"), "x")
+	write(t, filepath.Join(dir, "top"), "x")
+	if f := next(t, files); f.Name != "top" {
+		t.Errorf("enqueued %s, want top", f.Name)
+	}
+	none(t, files)
+}
+
+// ledger is a CompletionLog outliving the sources of a test
+type ledger struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+func (l *ledger) Completed(key string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.keys[key], nil
+}
+
+func (l *ledger) MarkCompleted(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.keys[key] = true
+	return nil
+}
+
+func TestSourceEnqueuesFilesOnceAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "f"), "x")
+	l := &ledger{keys: make(map[string]bool)}
+	files := run(t, dirsource.Options{Dir: dir, Ledger: l})
+	next(t, files)
+	again := run(t, dirsource.Options{Dir: dir, Ledger: l})
+	none(t, again)
+}
@@ -0,0 +1,97 @@
+package go_playground
+
+import (
+	"fmt"
+	"math/rand/v2"
+)
+
+// DispatchStrategy decides which of the queued tasks of equal priority a
+// MemoryQueue hands out first. Priorities always come first
+type DispatchStrategy int
+
+const (
+	// DispatchFIFO pops tasks in submission order
+	DispatchFIFO DispatchStrategy = iota
+	// DispatchLIFO pops the newest task first, for workloads where fresh
+	// tasks matter more than old ones
+	DispatchLIFO
+	// DispatchRandom pops tasks in a random order, spreading the keys of
+	// consecutive tasks across caches and workers
+	DispatchRandom
+	// DispatchEDF pops the task with the earliest ExpiresAt first, tasks
+	// without one going last in submission order
+	DispatchEDF
+)
+
+// dispatchStrategies lists the strategies in the order of their names in
+// errors
+var dispatchStrategies = []DispatchStrategy{DispatchFIFO, DispatchLIFO, DispatchRandom, DispatchEDF}
+
+// String returns the strategy name
+func (s DispatchStrategy) String() string {
+	switch s {
+	case DispatchFIFO:
+		return "fifo"
+	case DispatchLIFO:
+		return "lifo"
+	case DispatchRandom:
+		return "random"
+	case DispatchEDF:
+		return "edf"
+	}
+	return fmt.Sprintf("DispatchStrategy(%d)", int(s))
+}
+
+// ParseDispatchStrategy accepts the names returned by String
+func ParseDispatchStrategy(s string) (DispatchStrategy, error) {
+	for _, ds := range dispatchStrategies {
+		if s == ds.String() {
+			return ds, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid dispatch strategy %q, want fifo, lifo, random or edf", s)
+}
+
+// NewDispatchQueue creates a MemoryQueue holding at most capacity tasks,
+// popping those of equal priority following s
+func NewDispatchQueue(capacity int, s DispatchStrategy) *MemoryQueue {
+	return newMemoryQueue(capacity, &taskHeap{strategy: s})
+}
+
+// queued prepares a task pushed to a queue following s
+func (s DispatchStrategy) queued(qt *queuedTask) {
+	if s == DispatchRandom {
+		qt.rank = rand.Uint64()
+	}
+}
+
+// before reports whether a is popped before b
+func (s DispatchStrategy) before(a, b *queuedTask) bool {
+	if a.task.Priority != b.task.Priority {
+		return a.task.Priority > b.task.Priority
+	}
+	switch s {
+	case DispatchLIFO:
+		return a.seq > b.seq
+	case DispatchRandom:
+		if a.rank != b.rank {
+			return a.rank < b.rank
+		}
+	case DispatchEDF:
+		if da, db := a.task.ExpiresAt, b.task.ExpiresAt; !da.Equal(db) {
+			return !da.IsZero() && (db.IsZero() || da.Before(db))
+		}
+	}
+	return a.seq < b.seq
+}
+
+// compare orders a and b for slices.SortFunc, see before
+func (s DispatchStrategy) compare(a, b *queuedTask) int {
+	switch {
+	case s.before(a, b):
+		return -1
+	case s.before(b, a):
+		return 1
+	}
+	return 0
+}
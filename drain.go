@@ -0,0 +1,126 @@
+package go_playground
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// workerDrain is how a worker is asked to leave after its current task.
+// Its tasks are never dropped: the one it runs finishes, the next of the
+// same partition and those in its local queue go to other workers
+type workerDrain struct {
+	signal  chan struct{} // closed when the worker is asked to leave
+	since   time.Time     // when it was asked, zero unless draining
+	leaving bool          // the worker saw the request and is leaving
+}
+
+// addDrain registers worker id, before it starts, so a Resize right after
+// can drain it. The caller holds p.mu
+func (p *WorkerPool) addDrain(id int) {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	p.drains[id] = &workerDrain{signal: make(chan struct{})}
+}
+
+// drainSignal returns the channel closed once worker id is asked to leave
+func (p *WorkerPool) drainSignal(id int) <-chan struct{} {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	if d := p.drains[id]; d != nil {
+		return d.signal
+	}
+	return nil
+}
+
+// leaveDrained reports whether worker id was asked to leave, committing it
+// to do so, as a later Resize may no longer take the request back
+func (p *WorkerPool) leaveDrained(id int) bool {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	d := p.drains[id]
+	if d == nil || d.since.IsZero() {
+		return false
+	}
+	d.leaving = true
+	p.log.Info("worker drained", "worker", id, "draining_for", time.Since(d.since))
+	return true
+}
+
+// drainWorkers asks n workers to leave, idle ones first, then the busy
+// ones started last, which leave once their current task is done. It
+// returns how many it asked
+func (p *WorkerPool) drainWorkers(n int) int {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	var ids []int
+	for id, d := range p.drains {
+		if d.since.IsZero() {
+			ids = append(ids, id)
+		}
+	}
+	slices.SortFunc(ids, func(a, b int) int {
+		if ab, bb := p.statuses[a].Busy, p.statuses[b].Busy; ab != bb {
+			if ab {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Compare(b, a)
+	})
+	ids = ids[:min(n, len(ids))]
+	now := time.Now()
+	for _, id := range ids {
+		d := p.drains[id]
+		d.since = now
+		close(d.signal)
+		if ws := p.statuses[id]; ws.Busy {
+			p.log.Info("worker draining", "worker", id, "task_id", ws.TaskID)
+		}
+	}
+	return len(ids)
+}
+
+// undrainWorkers takes back the request to leave of up to n draining
+// workers that have not seen it yet, and returns how many it kept
+func (p *WorkerPool) undrainWorkers(n int) int {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	kept := 0
+	for _, d := range p.drains {
+		if kept == n {
+			break
+		}
+		if !d.since.IsZero() && !d.leaving {
+			d.since = time.Time{}
+			d.signal = make(chan struct{})
+			kept++
+		}
+	}
+	return kept
+}
+
+// drainRequested reports whether worker id was asked to leave, without
+// committing it to
+func (p *WorkerPool) drainRequested(id int) bool {
+	select {
+	case <-p.drainSignal(id):
+		return true
+	default:
+		return false
+	}
+}
+
+// DrainingWorkers returns the number of workers finishing their task
+// before leaving after a Resize
+func (p *WorkerPool) DrainingWorkers() int {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	n := 0
+	for _, d := range p.drains {
+		if !d.since.IsZero() {
+			n++
+		}
+	}
+	return n
+}
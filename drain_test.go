@@ -0,0 +1,86 @@
+package go_playground
+
+import (
+	"testing"
+)
+
+// busyPool starts a pool of n workers each holding one task until release
+// is closed, and returns the tasks
+func busyPool(t *testing.T, n int, release <-chan struct{}) (*WorkerPool, []Task) {
+	t.Helper()
+	started := make(chan struct{}, n)
+	p := startPool(t, WithWorkers(n), handle(func(Task) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}))
+	tasks := submit(t, p, make([]Task, n)...)
+	for range n {
+		<-started
+	}
+	return p, tasks
+}
+
+func TestResizeDrainsBusyWorkers(t *testing.T) {
+	release := make(chan struct{})
+	p, tasks := busyPool(t, 3, release)
+
+	p.Resize(1)
+	if n := p.DrainingWorkers(); n != 2 {
+		t.Errorf("%d workers draining, want 2", n)
+	}
+	draining := 0
+	for _, ws := range p.WorkerStatuses() {
+		if ws.Draining {
+			draining++
+			if !ws.Busy || ws.DrainingSince.IsZero() {
+				t.Errorf("draining worker %+v, want busy since the resize", ws)
+			}
+		}
+	}
+	if draining != 2 || p.Workers() != 3 {
+		t.Errorf("%d of %d workers report draining, want 2 of 3", draining, p.Workers())
+	}
+
+	close(release)
+	for _, task := range tasks {
+		if rec := waitState(t, p, task.ID); rec.State != StateSucceeded {
+			t.Errorf("task %d of a drained worker %s, want %s", task.ID, rec.State, StateSucceeded)
+		}
+	}
+	waitWorkers(t, p, 1)
+	if n := p.DrainingWorkers(); n != 0 {
+		t.Errorf("%d workers still draining after they left", n)
+	}
+	process(t, p, StateSucceeded, Task{})
+}
+
+func TestResizeUpKeepsDrainingWorkers(t *testing.T) {
+	release := make(chan struct{})
+	p, tasks := busyPool(t, 2, release)
+
+	p.Resize(1)
+	p.Resize(2)
+	if n := p.DrainingWorkers(); n != 0 {
+		t.Errorf("%d workers draining after growing back, want 0", n)
+	}
+	if n := p.Workers(); n != 2 {
+		t.Errorf("%d workers after growing back, want the 2 drained", n)
+	}
+	close(release)
+	for _, task := range tasks {
+		waitState(t, p, task.ID)
+	}
+	if n := p.Workers(); n != 2 {
+		t.Errorf("%d workers once their tasks are done, want 2", n)
+	}
+}
+
+func TestResizeStopsIdleWorkers(t *testing.T) {
+	p := startPool(t, WithWorkers(3))
+	p.Resize(1)
+	waitWorkers(t, p, 1)
+	if n := p.DrainingWorkers(); n != 0 {
+		t.Errorf("%d idle workers left draining", n)
+	}
+}
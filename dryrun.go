@@ -0,0 +1,28 @@
+package go_playground
+
+import "context"
+
+// WithDryRun runs every task dry, see Task.DryRun, to load-test the
+// pipeline of a pool without the side effects of its handlers
+func WithDryRun() Option {
+	return func(p *WorkerPool) {
+		p.dryRun = true
+	}
+}
+
+// isDryRun reports whether the handler of t is skipped
+func (p *WorkerPool) isDryRun(t Task) bool {
+	return p.dryRun || t.DryRun
+}
+
+// simulate stands for the handler in a dry run: the task is routed, so a
+// type without a handler still fails, then succeeds at once. The middleware
+// and injected faults are skipped along with the handler
+func (p *WorkerPool) simulate(ctx context.Context, t Task) error {
+	if _, err := p.handlers.route(t); err != nil {
+		return err
+	}
+	p.metrics.dryRuns.WithLabelValues(t.Type).Inc()
+	LoggerFrom(ctx).Debug("handler skipped in a dry run")
+	return ctx.Err()
+}
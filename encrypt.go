@@ -0,0 +1,332 @@
+package go_playground
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDecrypt is returned when a sealed payload cannot be opened, because
+// its key is unknown or it was tampered with
+var ErrDecrypt = errors.New("cannot decrypt payload")
+
+// KeyProvider hands out the data keys payloads are encrypted with. Each
+// data key is stored wrapped by a master key next to the payloads it
+// encrypts, so master keys never leave the provider and can be rotated
+// while older payloads still decrypt
+type KeyProvider interface {
+	// DataKey returns a new 32 byte data key in the clear and wrapped by
+	// the current master key, with the ID of that master key
+	DataKey(ctx context.Context) (key, wrapped []byte, keyID string, err error)
+	// UnwrapKey returns the data key wrapped by the master key keyID
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider wrapping data keys with AES-256-GCM master
+// keys held in memory
+type StaticKeys struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewStaticKeys returns a provider wrapping new data keys with the key
+// named current. The other keys only unwrap, for payloads written before a
+// rotation. Keys are 32 bytes
+func NewStaticKeys(current string, keys map[string][]byte) (*StaticKeys, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("current key %q is not among the keys", current)
+	}
+	s := &StaticKeys{current: current, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if len(id) == 0 || len(id) > 255 {
+			return nil, fmt.Errorf("key ID %q must be 1 to 255 bytes", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q is %d bytes, want 32", id, len(key))
+		}
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		s.keys[id] = aead
+	}
+	return s, nil
+}
+
+// DataKey returns a random data key wrapped by the current key
+func (s *StaticKeys) DataKey(context.Context) ([]byte, []byte, string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, "", err
+	}
+	wrapped, err := seal(s.keys[s.current], key, nil)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return key, wrapped, s.current, nil
+}
+
+// UnwrapKey decrypts a data key wrapped by DataKey
+func (s *StaticKeys) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := s.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrDecrypt, keyID)
+	}
+	return open(aead, wrapped, nil)
+}
+
+// KMS is the part of a key management service KMSKeys needs, such as the
+// Encrypt and Decrypt calls of AWS KMS or Cloud KMS
+type KMS interface {
+	Encrypt(ctx context.Context, keyID string, plaintext []byte) ([]byte, error)
+	Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error)
+}
+
+// KMSKeys returns a provider wrapping random data keys with the master key
+// keyID of kms. Changing keyID rotates the master key, as long as kms
+// still decrypts with the former one
+func KMSKeys(kms KMS, keyID string) KeyProvider {
+	return kmsKeys{kms: kms, keyID: keyID}
+}
+
+type kmsKeys struct {
+	kms   KMS
+	keyID string
+}
+
+func (k kmsKeys) DataKey(ctx context.Context) ([]byte, []byte, string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, "", err
+	}
+	wrapped, err := k.kms.Encrypt(ctx, k.keyID, key)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("wrapping data key with %s: %w", k.keyID, err)
+	}
+	return key, wrapped, k.keyID, nil
+}
+
+func (k kmsKeys) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	key, err := k.kms.Decrypt(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unwrapping data key with %s: %v", ErrDecrypt, keyID, err)
+	}
+	return key, nil
+}
+
+// sealedPrefix starts every sealed payload, followed by base64 of the
+// master key ID, the wrapped data key, the nonce and the ciphertext
+const sealedPrefix = "enc:v1:"
+
+// Data keys are reused for this long, and unwrapped ones kept up to this
+// many, so the KMS is not called for every task
+const (
+	dataKeyLifetime    = 5 * time.Minute
+	maxUnwrappedKeys   = 1024
+	keyProviderTimeout = 10 * time.Second
+)
+
+// payloadCipher seals the payloads of tasks with data keys of a provider
+type payloadCipher struct {
+	keys KeyProvider
+
+	mu        sync.Mutex
+	current   *dataKey
+	unwrapped map[string]cipher.AEAD // by key ID and wrapped key
+}
+
+type dataKey struct {
+	aead    cipher.AEAD
+	header  []byte // key ID and wrapped key, as written before the nonce
+	expires time.Time
+}
+
+func newPayloadCipher(keys KeyProvider) *payloadCipher {
+	return &payloadCipher{keys: keys, unwrapped: make(map[string]cipher.AEAD)}
+}
+
+// dataKey returns the data key in use, fetching a new one once it expired
+func (c *payloadCipher) dataKey() (*dataKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current != nil && time.Now().Before(c.current.expires) {
+		return c.current, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), keyProviderTimeout)
+	defer cancel()
+	key, wrapped, keyID, err := c.keys.DataKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting a data key: %w", err)
+	}
+	if len(keyID) == 0 || len(keyID) > 255 || len(wrapped) > 0xffff {
+		return nil, fmt.Errorf("key ID %q or wrapped key of %d bytes out of range", keyID, len(wrapped))
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte{byte(len(keyID))}, keyID...)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrapped)))
+	header = append(header, wrapped...)
+	c.current = &dataKey{aead: aead, header: header, expires: time.Now().Add(dataKeyLifetime)}
+	return c.current, nil
+}
+
+// seal encrypts s, field naming what it is so a sealed value cannot be
+// moved to another field. Empty values stay empty
+func (c *payloadCipher) seal(field, s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	k, err := c.dataKey()
+	if err != nil {
+		return "", err
+	}
+	ct, err := seal(k.aead, []byte(s), []byte(field))
+	if err != nil {
+		return "", err
+	}
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(append(bytes.Clone(k.header), ct...)), nil
+}
+
+// open decrypts a value sealed by seal. Values without the prefix were
+// stored before encryption was enabled and are returned as they are
+func (c *payloadCipher) open(field, s string) (string, error) {
+	enc, ok := strings.CutPrefix(s, sealedPrefix)
+	if !ok {
+		return s, nil
+	}
+	b, err := base64.RawStdEncoding.DecodeString(enc)
+	if err != nil || len(b) < 1 {
+		return "", fmt.Errorf("%w: malformed %s", ErrDecrypt, field)
+	}
+	n := int(b[0])
+	if len(b) < 1+n+2 {
+		return "", fmt.Errorf("%w: truncated %s", ErrDecrypt, field)
+	}
+	keyID := string(b[1 : 1+n])
+	m := int(binary.BigEndian.Uint16(b[1+n:]))
+	rest := b[1+n+2:]
+	if len(rest) < m {
+		return "", fmt.Errorf("%w: truncated %s", ErrDecrypt, field)
+	}
+	aead, err := c.unwrap(keyID, rest[:m])
+	if err != nil {
+		return "", err
+	}
+	pt, err := open(aead, rest[m:], []byte(field))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrDecrypt, field, err)
+	}
+	return string(pt), nil
+}
+
+// unwrap returns the cipher of a wrapped data key, asking the provider
+// only for keys not seen lately
+func (c *payloadCipher) unwrap(keyID string, wrapped []byte) (cipher.AEAD, error) {
+	id := keyID + "\x00" + string(wrapped)
+	c.mu.Lock()
+	aead, ok := c.unwrapped[id]
+	c.mu.Unlock()
+	if ok {
+		return aead, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), keyProviderTimeout)
+	defer cancel()
+	key, err := c.keys.UnwrapKey(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if aead, err = newGCM(key); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if len(c.unwrapped) >= maxUnwrappedKeys {
+		clear(c.unwrapped)
+	}
+	c.unwrapped[id] = aead
+	c.mu.Unlock()
+	return aead, nil
+}
+
+// sealTask encrypts the payload and checkpoint of t
+func (c *payloadCipher) sealTask(t *Task) (err error) {
+	if t.Data, err = c.seal("data", t.Data); err != nil {
+		return err
+	}
+	t.Checkpoint, err = c.seal("checkpoint", t.Checkpoint)
+	return err
+}
+
+// openTask decrypts what sealTask encrypted
+func (c *payloadCipher) openTask(t *Task) (err error) {
+	if t.Data, err = c.open("data", t.Data); err != nil {
+		return err
+	}
+	t.Checkpoint, err = c.open("checkpoint", t.Checkpoint)
+	return err
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a random nonce, which it prepends
+func seal(aead cipher.AEAD, plaintext, ad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+func open(aead cipher.AEAD, sealed, ad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, sealed[:n], sealed[n:], ad)
+}
+
+// EncryptedCodec returns a codec encrypting the payload and checkpoint of
+// tasks with data keys of keys before encoding them with inner, for
+// backends persisting tasks. Other fields stay readable, backends ordering
+// and indexing on them. Register it with RegisterCodec so the tasks it
+// wrote decode, those written by inner alone still decoding as well
+func EncryptedCodec(inner Codec, keys KeyProvider) Codec {
+	return &encryptedCodec{inner: inner, cipher: newPayloadCipher(keys)}
+}
+
+type encryptedCodec struct {
+	inner  Codec
+	cipher *payloadCipher
+}
+
+func (c *encryptedCodec) Name() string { return "encrypted+" + c.inner.Name() }
+
+func (c *encryptedCodec) Marshal(t Task) ([]byte, error) {
+	if err := c.cipher.sealTask(&t); err != nil {
+		return nil, err
+	}
+	return c.inner.Marshal(t)
+}
+
+func (c *encryptedCodec) Unmarshal(data []byte, t *Task) error {
+	if err := c.inner.Unmarshal(data, t); err != nil {
+		return err
+	}
+	return c.cipher.openTask(t)
+}
@@ -0,0 +1,210 @@
+package go_playground
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error codes in the code field of error responses. Unlike the messages
+// they are stable, for clients to branch on
+const (
+	CodeBadRequest           = "bad_request"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeUnprocessable        = "unprocessable"
+	CodeRateLimited          = "rate_limited"
+	CodeInternal             = "internal"
+	CodeNotImplemented       = "not_implemented"
+	CodeUnavailable          = "unavailable"
+	CodeStorageFull          = "storage_full"
+
+	CodeUnknownQueue        = "unknown_queue"
+	CodeTaskNotFound        = "task_not_found"
+	CodeTaskFinished        = "task_finished"
+	CodeTaskNotFinished     = "task_not_finished"
+	CodeValidationFailed    = "validation_failed"
+	CodeTaskDropped         = "task_dropped"
+	CodeTaskDeadLettered    = "task_dead_lettered"
+	CodeCallbacksDisabled   = "callbacks_disabled"
+	CodeDependencyNotFound  = "dependency_not_found"
+	CodeQueueFull           = "queue_full"
+	CodeTenantQueueFull     = "tenant_queue_full"
+	CodeTenantDailyLimit    = "tenant_daily_limit"
+	CodeIdempotencyMismatch = "idempotency_mismatch"
+	CodeConfirmationInvalid = "confirmation_invalid"
+)
+
+// statusCodes are the codes of errors answered without a more specific one
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusConflict:              CodeConflict,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusUnsupportedMediaType:  CodeUnsupportedMediaType,
+	http.StatusUnprocessableEntity:   CodeUnprocessable,
+	http.StatusTooManyRequests:       CodeRateLimited,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusNotImplemented:        CodeNotImplemented,
+	http.StatusServiceUnavailable:    CodeUnavailable,
+	http.StatusInsufficientStorage:   CodeStorageFull,
+}
+
+// statusCode returns the error code of a status without a specific one
+func statusCode(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// envelope is the JSON body of an action answering with no resource of its
+// own, such as a pause or a cancellation
+type envelope struct {
+	ID      int               `json:"id,omitempty"` // the task acted on
+	Status  string            `json:"status"`       // what the action did, such as paused or canceled
+	Message string            `json:"message"`      // the line answered to text clients
+	Count   *int              `json:"count,omitempty"`
+	Links   map[string]string `json:"links,omitempty"`
+}
+
+// submitted is the JSON body of a submission: the record of the task and,
+// as in an envelope, what happened to it and where to follow it
+type submitted struct {
+	TaskRecord
+	Status  string            `json:"status"`
+	Message string            `json:"message"`
+	Links   map[string]string `json:"links"`
+}
+
+// submissionStatus says what became of a task just submitted, from its
+// record: queued, delayed until its RunAt, blocked on its dependencies,
+// shed from a full queue, dead-lettered over the storage quota, or the
+// state of a task that already ran
+func (p *WorkerPool) submissionStatus(rec TaskRecord) string {
+	switch rec.State {
+	case StateQueued:
+		switch {
+		case p.blocked(rec.ID):
+			return "blocked"
+		case p.until(rec.RunAt) > 0:
+			return "delayed"
+		}
+	case StateFailed:
+		switch rec.Error {
+		case ErrTaskShed.Error():
+			return "shed"
+		case ErrStorageFull.Error():
+			return "dead_lettered"
+		}
+	}
+	return string(rec.State)
+}
+
+// submissionMessage is the line answered to text clients for a task
+// submitted with status
+func submissionMessage(rec TaskRecord, status string) string {
+	switch status {
+	case "queued":
+		return fmt.Sprintf("Event %d added to queue", rec.ID)
+	case "delayed":
+		return fmt.Sprintf("Event %d delayed until %s", rec.ID, rec.RunAt.Format(time.RFC3339))
+	case "blocked":
+		return fmt.Sprintf("Event %d waiting for its dependencies", rec.ID)
+	case "shed":
+		return fmt.Sprintf("Event %d shed from the full queue", rec.ID)
+	case "dead_lettered":
+		return fmt.Sprintf("Event %d dead-lettered", rec.ID)
+	}
+	return fmt.Sprintf("Event %d %s", rec.ID, status)
+}
+
+// count returns a pointer to n for the count of an envelope, kept when zero
+func count(n int) *int {
+	return &n
+}
+
+// respond answers an action with body as JSON, or with msg as a line of
+// text when the client prefers text, as curl does by default
+func respond(w http.ResponseWriter, r *http.Request, status int, body any, msg string) {
+	if !wantsText(r) {
+		writeJSON(w, status, body)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, msg)
+}
+
+// wantsText reports whether the Accept header prefers text/plain over
+// JSON. A bare */*, sent by curl, counts as text; no header counts as JSON
+func wantsText(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return false
+	}
+	text, json, all := -1.0, -1.0, -1.0
+	for part := range strings.SplitSeq(accept, ",") {
+		mt, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch mt {
+		case "text/plain", "text/*":
+			text = max(text, q)
+		case "application/json", "application/*":
+			json = max(json, q)
+		case "*/*":
+			all = max(all, q)
+		}
+	}
+	if text < 0 && json < 0 {
+		return all > 0
+	}
+	return text > json
+}
+
+// taskLinks returns the routes of a task of p
+func (s *Server) taskLinks(p *WorkerPool, id int) map[string]string {
+	base := "/event/" + strconv.Itoa(id)
+	if p != s.pool {
+		base = "/queues/" + url.PathEscape(p.Name()) + "/events/" + strconv.Itoa(id)
+	}
+	return map[string]string{
+		"self":   base,
+		"logs":   base + "/logs",
+		"result": base + "/result",
+		"wait":   base + "/wait",
+	}
+}
+
+// notFoundHandler answers routes that do not exist with an error body
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, "no route for "+r.URL.Path, "")
+}
+
+// methodNotAllowedHandler answers known routes called with another method
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path, "")
+}
@@ -0,0 +1,50 @@
+package go_playground
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubmittedStatus(t *testing.T) {
+	// Room for one queued task, those submitted after it shed
+	p := newPool(t, WithQueueSize(1), WithOverflowPolicy(OverflowShedNewest, 0))
+	for _, tc := range []struct {
+		body, status, message string
+	}{
+		{`{"data":"a"}`, "queued", "added to queue"},
+		{`{"data":"b","delay":"1h"}`, "delayed", "delayed until " + time.Now().Add(time.Hour).UTC().Format("2006-01-02T15")},
+		{`{"data":"c","depends_on":[1]}`, "blocked", "waiting for its dependencies"},
+		{`{"data":"d"}`, "shed", "shed from the full queue"},
+	} {
+		var got submitted
+		decode(t, serve(NewServer(p), http.MethodPost, "/event", tc.body), &got)
+		if got.Status != tc.status || !strings.Contains(got.Message, tc.message) {
+			t.Errorf("POST /event %s = %s %q, want %s %q", tc.body, got.Status, got.Message, tc.status, tc.message)
+		}
+	}
+}
+
+func TestBatchEnvelope(t *testing.T) {
+	p := newPool(t)
+	dep, err := p.Submit(Task{Data: "dependency"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got batchResponse
+	decode(t, serve(NewServer(p), http.MethodPost, "/events/batch", fmt.Sprintf(`[{"data":"a"},{"data":"b","delay":"1h"},{"data":"c","depends_on":[%d]}]`, dep.ID)), &got)
+	if want := []string{"queued", "delayed", "blocked"}; got.Status != "mixed" || !slices.Equal(got.Statuses, want) {
+		t.Errorf("batch status %s %q, want mixed %q", got.Status, got.Statuses, want)
+	}
+	if len(got.IDs) != 3 || got.Count == nil || *got.Count != 3 || got.Message != "3 events submitted" {
+		t.Errorf("batch envelope %+v, want 3 IDs counted and submitted", got)
+	}
+
+	decode(t, serve(NewServer(newPool(t)), http.MethodPost, "/events/batch", `[{"data":"a"}]`), &got)
+	if got.Status != "queued" || got.Message != "1 events added to queue" {
+		t.Errorf("batch of a queued task = %s %q", got.Status, got.Message)
+	}
+}
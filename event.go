@@ -0,0 +1,274 @@
+package go_playground
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxEventDelay bounds how far in the future an event can be deferred
+const maxEventDelay = 24 * time.Hour
+
+// eventRequest is the JSON payload accepted by POST /event, and each item
+// of POST /events/batch
+type eventRequest struct {
+	Data     *string `json:"data"`
+	Priority *int    `json:"priority"`
+	Delay    string  `json:"delay"`
+	Timeout  string  `json:"timeout"`
+	TTL      string  `json:"ttl"`
+	Queue    string  `json:"queue"`
+	Type     string  `json:"type"`
+	// PartitionKey orders the events sharing it, see WithPartitioning
+	PartitionKey string `json:"partition_key"`
+	Tenant       string `json:"tenant"` // ignored for authenticated clients, who are their own tenant
+	// Weight is the share of the pool capacity the event takes, see
+	// WithWeightedCapacity
+	Weight *int `json:"weight"`
+	// Labels find the task again, see TaskQuery
+	Labels map[string]string `json:"labels"`
+	// SchemaVersion is the version of the shape of data, the current one
+	// of the type when unset, see RegisterMigration
+	SchemaVersion *int `json:"schema_version"`
+	// DryRun skips the handler, see Task.DryRun
+	DryRun bool `json:"dry_run"`
+	// DependsOn are the tasks that must succeed first, see Task.DependsOn
+	DependsOn []int `json:"depends_on"`
+	// Hedge allows a second execution of a late attempt, see Task.Hedge
+	Hedge bool `json:"hedge"`
+
+	IdempotencyKey string `json:"idempotency_key"`
+	CallbackURL    string `json:"callback_url"`
+}
+
+// maxDependencies bounds the tasks an event may depend on
+const maxDependencies = 100
+
+// maxEventWait bounds how long POST /event?wait and GET /event/{id}/wait
+// block for the task
+const maxEventWait = time.Minute
+
+// parseWait reads the wait query parameter: true to wait up to
+// maxEventWait, or a duration, capped at maxEventWait
+func parseWait(r *http.Request) (time.Duration, error) {
+	switch v := r.URL.Query().Get("wait"); v {
+	case "", "false":
+		return 0, nil
+	case "true":
+		return maxEventWait, nil
+	default:
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return 0, &badRequestError{field: "wait", msg: fmt.Sprintf("invalid wait %q, want true or a duration", v)}
+		}
+		return min(d, maxEventWait), nil
+	}
+}
+
+// defaultWaitTimeout is how long GET /event/{id}/wait blocks without a
+// timeout parameter
+const defaultWaitTimeout = 30 * time.Second
+
+// parseWaitTimeout reads the timeout query parameter of GET
+// /event/{id}/wait, capped at maxEventWait
+func parseWaitTimeout(r *http.Request) (time.Duration, error) {
+	v := r.URL.Query().Get("timeout")
+	if v == "" {
+		return defaultWaitTimeout, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, &badRequestError{field: "timeout", msg: fmt.Sprintf("invalid timeout %q, want a duration", v)}
+	}
+	return min(d, maxEventWait), nil
+}
+
+// IdempotencyHeader carries the idempotency key of a submission
+const IdempotencyHeader = "Idempotency-Key"
+
+// idempotencyKey reads the key from the request header, if any
+func idempotencyKey(r *http.Request) (string, error) {
+	key := r.Header.Get(IdempotencyHeader)
+	if len(key) > maxIdempotencyKey {
+		return "", &badRequestError{field: IdempotencyHeader, msg: fmt.Sprintf("idempotency key must be at most %d bytes", maxIdempotencyKey)}
+	}
+	return key, nil
+}
+
+// badRequestError describes an invalid field of the request
+type badRequestError struct {
+	field  string
+	msg    string
+	status int // 400 when zero
+}
+
+func (e *badRequestError) Error() string { return e.msg }
+
+// malformedBody describes a request body that failed to decode, as too
+// large when it went past the limit of WithBodyLimit
+func malformedBody(err error) error {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return &badRequestError{msg: fmt.Sprintf("body must be at most %d bytes", mbe.Limit), status: http.StatusRequestEntityTooLarge}
+	}
+	return &badRequestError{msg: "malformed JSON body: " + err.Error()}
+}
+
+// decodeEvent fills task from the JSON request body. An empty body leaves
+// the task untouched
+func decodeEvent(r *http.Request, task *Task) error {
+	return decodeEventJSON(r.Body, task)
+}
+
+func decodeEventJSON(body io.Reader, task *Task) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+
+	var req eventRequest
+	if err := dec.Decode(&req); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return malformedBody(err)
+	}
+	if dec.More() {
+		return &badRequestError{msg: "body must contain a single JSON object"}
+	}
+	return req.apply(task)
+}
+
+// decodeBatch reads a JSON array of event requests, each applied on top of
+// a copy of base. An idempotency key on base is suffixed with the position
+// of each event that does not set its own
+func decodeBatch(r *http.Request, base Task) ([]Task, error) {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	var reqs []eventRequest
+	if err := dec.Decode(&reqs); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, &badRequestError{msg: "body must contain a JSON array of events"}
+		}
+		return nil, malformedBody(err)
+	}
+	if dec.More() {
+		return nil, &badRequestError{msg: "body must contain a single JSON array"}
+	}
+	switch {
+	case len(reqs) == 0:
+		return nil, &badRequestError{msg: "batch must contain at least one event"}
+	case len(reqs) > maxBatchSize:
+		return nil, &badRequestError{msg: fmt.Sprintf("batch must contain at most %d events", maxBatchSize)}
+	}
+
+	tasks := make([]Task, len(reqs))
+	for i, req := range reqs {
+		tasks[i] = base
+		if base.IdempotencyKey != "" {
+			tasks[i].IdempotencyKey = fmt.Sprintf("%s/%d", base.IdempotencyKey, i)
+		}
+		if err := req.apply(&tasks[i]); err != nil {
+			be := err.(*badRequestError)
+			be.field = fmt.Sprintf("[%d].%s", i, be.field)
+			be.msg = fmt.Sprintf("event %d: %s", i, be.msg)
+			return nil, be
+		}
+	}
+	return tasks, nil
+}
+
+// apply validates the request and copies the fields it sets onto task
+func (req eventRequest) apply(task *Task) error {
+	if req.Data != nil {
+		if *req.Data == "" {
+			return &badRequestError{field: "data", msg: "data must not be empty"}
+		}
+		task.Data = *req.Data
+	}
+	if req.Priority != nil {
+		task.Priority = *req.Priority
+	}
+	if req.Delay != "" {
+		d, err := time.ParseDuration(req.Delay)
+		if err != nil {
+			return &badRequestError{field: "delay", msg: fmt.Sprintf("invalid delay %q", req.Delay)}
+		}
+		if d < 0 || d > maxEventDelay {
+			return &badRequestError{field: "delay", msg: fmt.Sprintf("delay must be between 0 and %s", maxEventDelay)}
+		}
+		task.Delay = d
+	}
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil || d <= 0 {
+			return &badRequestError{field: "timeout", msg: fmt.Sprintf("invalid timeout %q", req.Timeout)}
+		}
+		task.Timeout = d
+	}
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 {
+			return &badRequestError{field: "ttl", msg: fmt.Sprintf("invalid ttl %q", req.TTL)}
+		}
+		task.TTL = d
+	}
+	if req.Queue != "" {
+		task.Queue = req.Queue
+	}
+	if req.Type != "" {
+		task.Type = req.Type
+	}
+	if req.PartitionKey != "" {
+		task.PartitionKey = req.PartitionKey
+	}
+	if req.Weight != nil {
+		if *req.Weight < 1 {
+			return &badRequestError{field: "weight", msg: "weight must be at least 1"}
+		}
+		task.Weight = *req.Weight
+	}
+	if req.SchemaVersion != nil {
+		if *req.SchemaVersion < 1 {
+			return &badRequestError{field: "schema_version", msg: "schema version must be at least 1"}
+		}
+		task.SchemaVersion = *req.SchemaVersion
+	}
+	task.DryRun = req.DryRun
+	task.Hedge = req.Hedge
+	if len(req.DependsOn) > 0 {
+		if len(req.DependsOn) > maxDependencies {
+			return &badRequestError{field: "depends_on", msg: fmt.Sprintf("an event may depend on at most %d tasks", maxDependencies)}
+		}
+		for _, id := range req.DependsOn {
+			if id < 1 {
+				return &badRequestError{field: "depends_on", msg: fmt.Sprintf("invalid task ID %d", id)}
+			}
+		}
+		task.DependsOn = req.DependsOn
+	}
+	if len(req.Labels) > 0 {
+		if err := checkLabels(req.Labels); err != nil {
+			return err
+		}
+		task.Labels = req.Labels
+	}
+	if req.Tenant != "" && task.Tenant == "" {
+		task.Tenant = req.Tenant
+	}
+	if req.IdempotencyKey != "" {
+		if len(req.IdempotencyKey) > maxIdempotencyKey {
+			return &badRequestError{field: "idempotency_key", msg: fmt.Sprintf("idempotency key must be at most %d bytes", maxIdempotencyKey)}
+		}
+		task.IdempotencyKey = req.IdempotencyKey
+	}
+	if req.CallbackURL != "" {
+		if !validCallbackURL(req.CallbackURL) {
+			return &badRequestError{field: "callback_url", msg: fmt.Sprintf("invalid callback URL %q, want an absolute http or https URL", req.CallbackURL)}
+		}
+		task.CallbackURL = req.CallbackURL
+	}
+	return nil
+}
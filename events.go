@@ -0,0 +1,84 @@
+package go_playground
+
+import (
+	"sync"
+	"time"
+)
+
+// TaskEvent is a state transition of a task
+type TaskEvent struct {
+	Task  Task      `json:"task"`
+	State TaskState `json:"state"`
+	Error string    `json:"error,omitempty"`
+	Time  time.Time `json:"time"`
+
+	// Progress is set on progress updates, which keep the running state
+	Progress *Progress `json:"progress,omitempty"`
+}
+
+// eventBus fans task events out to subscribers. Slow subscribers miss
+// events instead of stalling the workers
+type eventBus struct {
+	mu     sync.RWMutex
+	subs   map[int]chan TaskEvent
+	nextID int
+	closed bool
+}
+
+func (b *eventBus) subscribe(buffer int) (<-chan TaskEvent, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan TaskEvent, max(buffer, 1))
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if b.subs == nil {
+		b.subs = make(map[int]chan TaskEvent)
+	}
+	b.nextID++
+	id := b.nextID
+	b.subs[id] = ch
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := b.subs[id]; ok {
+				delete(b.subs, id)
+				close(ch)
+			}
+		})
+	}
+}
+
+func (b *eventBus) publish(ev TaskEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// close ends every subscription
+func (b *eventBus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for id, ch := range b.subs {
+		delete(b.subs, id)
+		close(ch)
+	}
+}
+
+// Subscribe returns a channel of task state transitions and a function that
+// ends the subscription. Events are dropped while the channel buffer is
+// full, and the channel is closed when the pool shuts down
+func (p *WorkerPool) Subscribe(buffer int) (<-chan TaskEvent, func()) {
+	return p.events.subscribe(buffer)
+}
@@ -0,0 +1,152 @@
+package go_playground
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExecTaskType is the task type ExecTasks handlers are usually registered
+// for
+const ExecTaskType = "exec"
+
+// ExecTasks configures the handler running a command for each task. The
+// command is fixed here, tasks only choose what its stdin reads
+type ExecTasks struct {
+	// Command is the program and its arguments, run without a shell
+	Command []string
+	// Dir is the working directory, the one of the pool process when empty
+	Dir string
+	// Env lists the environment variables of the pool passed on, the
+	// command seeing none of the others. TASK_ID, TASK_TYPE, TASK_TENANT and
+	// TASK_ATTEMPT are always set
+	Env []string
+	// Timeout bounds each run below the attempt timeout. Defaults to 1m
+	Timeout time.Duration
+	// MaxOutputBytes of stdout and of stderr kept each, the rest being
+	// dropped. Defaults to 64 KiB
+	MaxOutputBytes int
+	// PermanentExitCodes fail the task without retries, other non-zero
+	// exit codes being retried by the retry policy
+	PermanentExitCodes []int
+}
+
+// ExecResult is the output of a task run by ExecTaskHandler, as JSON
+type ExecResult struct {
+	ExitCode  int    `json:"exit_code"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"` // output past MaxOutputBytes was dropped
+}
+
+// ExecTaskHandler returns the handler running cfg.Command with the data of
+// each task on stdin. Runs exiting with 0 succeed with their ExecResult as
+// output; the others fail with the exit code and the end of stderr
+func ExecTaskHandler(cfg ExecTasks) TaskHandler {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Minute
+	}
+	if cfg.MaxOutputBytes <= 0 {
+		cfg.MaxOutputBytes = 64 << 10
+	}
+	return TaskHandlerFunc(cfg.run)
+}
+
+// run makes one attempt of t
+func (cfg ExecTasks) run(ctx context.Context, t Task) error {
+	if len(cfg.Command) == 0 {
+		return Permanent(errors.New("exec tasks: no command configured"))
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, cfg.Command[0], cfg.Command[1:]...)
+	cmd.Dir = cfg.Dir
+	cmd.Env = cfg.environ(t)
+	cmd.Stdin = strings.NewReader(t.Data)
+	stdout, stderr := &cappedBuffer{max: cfg.MaxOutputBytes}, &cappedBuffer{max: cfg.MaxOutputBytes}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	// Pipes left open by children of a killed command stop waiting
+	cmd.WaitDelay = 5 * time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	res := ExecResult{
+		ExitCode:  cmd.ProcessState.ExitCode(),
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.dropped || stderr.dropped,
+	}
+	if out, merr := json.Marshal(res); merr == nil {
+		SetOutput(ctx, string(out))
+	}
+	LoggerFrom(ctx).Debug("exec task finished", "command", cfg.Command[0], "exit_code", res.ExitCode, "duration", time.Since(start))
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		return fmt.Errorf("%s: killed after %s: %w", cfg.Command[0], cfg.Timeout, ctx.Err())
+	case errors.As(err, &exitErr):
+		err = fmt.Errorf("%s exited with %d: %s", cfg.Command[0], res.ExitCode, lastLine(res.Stderr))
+		for _, code := range cfg.PermanentExitCodes {
+			if code == res.ExitCode {
+				return Permanent(err)
+			}
+		}
+		return err
+	}
+	// The command could not start, no retry fixes it
+	return Permanent(err)
+}
+
+// environ returns the environment of the command run for t
+func (cfg ExecTasks) environ(t Task) []string {
+	env := make([]string, 0, len(cfg.Env)+4)
+	for _, name := range cfg.Env {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+	return append(env,
+		"TASK_ID="+strconv.Itoa(t.ID),
+		"TASK_TYPE="+t.Type,
+		"TASK_TENANT="+t.Tenant,
+		"TASK_ATTEMPT="+strconv.Itoa(t.Attempts),
+	)
+}
+
+// lastLine returns the last non-empty line of s, where commands tell why
+// they failed
+func lastLine(s string) string {
+	s = strings.TrimRight(s, "\n")
+	return cmp.Or(s[strings.LastIndexByte(s, '\n')+1:], "no stderr")
+}
+
+// cappedBuffer keeps the first max bytes written to it, dropping the rest
+// without failing the writes so the command never blocks on its output.
+// The buffer is not embedded, its ReadFrom would bypass the cap
+type cappedBuffer struct {
+	buf     bytes.Buffer
+	max     int
+	dropped bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); len(p) > room {
+		b.dropped = true
+		b.buf.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string { return b.buf.String() }
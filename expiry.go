@@ -0,0 +1,45 @@
+package go_playground
+
+import "errors"
+
+// ErrTaskExpired is recorded on tasks still queued past their ExpiresAt
+var ErrTaskExpired = errors.New("task expired before it could run")
+
+// setDeadlines turns the relative Delay and TTL of a task being submitted
+// into RunAt and ExpiresAt, RunAt being pushed back to the next processing
+// window when it falls outside of them
+func (p *WorkerPool) setDeadlines(task *Task) {
+	now := p.clock.Now()
+	if task.RunAt.IsZero() && task.Delay > 0 {
+		task.RunAt = now.Add(task.Delay)
+	}
+	if task.ExpiresAt.IsZero() {
+		ttl := task.TTL
+		if ttl <= 0 {
+			ttl = p.taskTTL
+		}
+		if ttl > 0 {
+			task.ExpiresAt = now.Add(ttl)
+		}
+	}
+	p.holdForWindow(task)
+}
+
+// dropExpired ends a task that reached a worker after its ExpiresAt,
+// reporting whether it did. Retries of a task that started in time are
+// not affected
+func (p *WorkerPool) dropExpired(task Task) bool {
+	if task.ExpiresAt.IsZero() || p.clock.Now().Before(task.ExpiresAt) {
+		return false
+	}
+	p.metrics.expired.Inc()
+	if p.expiredDLQ {
+		p.deadLetter(task, ErrTaskExpired)
+		return true
+	}
+	p.taskLogger(task).Warn("task expired", "expires_at", task.ExpiresAt)
+	p.track(task, StateCanceled, ErrTaskExpired)
+	p.ack(task)
+	p.dropPayload(task)
+	return true
+}
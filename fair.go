@@ -0,0 +1,149 @@
+package go_playground
+
+import (
+	"cmp"
+	"container/heap"
+	"slices"
+)
+
+// FairScheduling shares dispatch between tenants in proportion to their
+// weights, so a tenant with a large backlog cannot starve the others
+type FairScheduling struct {
+	Weights       map[string]int // tenant -> share of dispatches
+	DefaultWeight int            // for tenants not in Weights, defaults to 1
+	// Strategy orders the tasks of a tenant of equal priority, see
+	// DispatchStrategy
+	Strategy DispatchStrategy
+}
+
+// NewFairQueue creates a MemoryQueue holding at most capacity tasks that
+// interleaves tenants following fs. Priorities only order the tasks of a
+// tenant, and when full the shedding policies evict from the tenant with
+// the most queued tasks
+func NewFairQueue(capacity int, fs FairScheduling) *MemoryQueue {
+	if fs.DefaultWeight < 1 {
+		fs.DefaultWeight = 1
+	}
+	return newMemoryQueue(capacity, &fairTasks{cfg: fs, tenants: make(map[string]*tenantTasks)})
+}
+
+// tenantTasks is the backlog of one tenant
+type tenantTasks struct {
+	name  string
+	tasks taskHeap
+	pass  float64 // virtual time of its next dispatch
+	index int     // position in fairTasks.active
+}
+
+// fairTasks implements stride scheduling: the tenant with the lowest pass
+// goes next, then its pass grows by the inverse of its weight. Tenants
+// joining start at the current virtual time so idle ones bank no credit
+type fairTasks struct {
+	cfg     FairScheduling
+	tenants map[string]*tenantTasks // tenants with queued tasks
+	active  tenantHeap
+	vtime   float64
+	n       int
+}
+
+func (f *fairTasks) Len() int { return f.n }
+
+func (f *fairTasks) add(qt queuedTask) {
+	t, ok := f.tenants[qt.task.Tenant]
+	if !ok {
+		t = &tenantTasks{name: qt.task.Tenant, tasks: taskHeap{strategy: f.cfg.Strategy}, pass: f.vtime}
+		f.tenants[t.name] = t
+		heap.Push(&f.active, t)
+	}
+	t.tasks.add(qt)
+	f.n++
+}
+
+func (f *fairTasks) next() queuedTask {
+	t := f.active[0]
+	qt := t.tasks.next()
+	f.vtime = t.pass
+	t.pass += 1 / float64(f.weight(t.name))
+	f.removed(t)
+	return qt
+}
+
+// shed applies pick to the largest backlog
+func (f *fairTasks) shed(t Task, pick shedPicker) (queuedTask, bool) {
+	var largest *tenantTasks
+	for _, t := range f.active {
+		if largest == nil || t.tasks.Len() > largest.tasks.Len() {
+			largest = t
+		}
+	}
+	qt, ok := largest.tasks.shed(t, pick)
+	if ok {
+		f.removed(largest)
+	}
+	return qt, ok
+}
+
+// removed updates the bookkeeping after a task of t was taken out
+func (f *fairTasks) removed(t *tenantTasks) {
+	f.n--
+	if t.tasks.Len() == 0 {
+		heap.Remove(&f.active, t.index)
+		delete(f.tenants, t.name)
+		return
+	}
+	heap.Fix(&f.active, t.index)
+}
+
+func (f *fairTasks) drain() []Task {
+	var all []*queuedTask
+	for _, t := range f.active {
+		all = append(all, t.tasks.items...)
+	}
+	slices.SortFunc(all, func(a, b *queuedTask) int { return cmp.Compare(a.seq, b.seq) })
+
+	tasks := make([]Task, len(all))
+	for i, qt := range all {
+		tasks[i] = qt.task
+	}
+	clear(f.tenants)
+	f.active, f.n = nil, 0
+	return tasks
+}
+
+func (f *fairTasks) weight(tenant string) int {
+	if w := f.cfg.Weights[tenant]; w > 0 {
+		return w
+	}
+	return f.cfg.DefaultWeight
+}
+
+// tenantHeap implements heap.Interface ordered by pass, then tenant name
+type tenantHeap []*tenantTasks
+
+func (h tenantHeap) Len() int { return len(h) }
+
+func (h tenantHeap) Less(i, j int) bool {
+	if h[i].pass != h[j].pass {
+		return h[i].pass < h[j].pass
+	}
+	return h[i].name < h[j].name
+}
+
+func (h tenantHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *tenantHeap) Push(x any) {
+	t := x.(*tenantTasks)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *tenantHeap) Pop() any {
+	old := *h
+	n := len(old)
+	t := old[n-1]
+	*h = old[:n-1]
+	return t
+}
@@ -0,0 +1,328 @@
+package go_playground
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// TypeConcurrency caps how many tasks of a Task.Type run at once, whatever
+// the number of workers. The dispatcher holds back tasks of a type at its
+// cap and keeps dispatching other types; a held task goes to the next idle
+// worker once a task of its type ends
+type TypeConcurrency struct {
+	Limits  map[string]int // Task.Type -> tasks running at once; unlisted types are not capped
+	MaxHeld int            // held tasks before the dispatcher waits for a slot, 100 by default
+}
+
+// Partitioning runs the tasks sharing a Task.PartitionKey one at a time,
+// in the order the queue hands them out, as a Kafka partition would, while
+// different keys run in parallel. A key's backlog stays on the worker that
+// ran its previous task. Tasks without a key are not ordered. Requeued
+// tasks, such as those stopped by the watchdog, go to the back of their
+// key
+type Partitioning struct {
+	MaxHeld int // tasks waiting for their key before the dispatcher waits, 100 by default
+}
+
+// WeightedCapacity gives the pool a budget of capacity units, such as
+// megabytes of memory or CPU shares, that running tasks take their Weight
+// of. The dispatcher holds back a task while its weight does not fit in
+// what the running tasks leave, and the tasks popped after it wait too, so
+// a heavy task is not overtaken forever by lighter ones. Tasks heavier than
+// Capacity are refused at submission
+type WeightedCapacity struct {
+	Capacity int // total weight of the tasks running at once
+	MaxHeld  int // held tasks before the dispatcher waits for room, 100 by default
+}
+
+// check is the Validator refusing tasks that could never fit
+func (wc WeightedCapacity) check(t Task) error {
+	if t.Weight > wc.Capacity {
+		return &ValidationError{Fields: []FieldError{{Field: "weight", Message: fmt.Sprintf("must be at most %d, the pool capacity, got %d", wc.Capacity, t.Weight)}}}
+	}
+	return nil
+}
+
+// weight returns the capacity units t takes, at least 1
+func weight(t Task) int {
+	return max(t.Weight, 1)
+}
+
+// defaultMaxHeld bounds the tasks held back by the dispatch gate unless set
+const defaultMaxHeld = 100
+
+// holdReason says why the gate held a task back
+type holdReason int
+
+const (
+	admitted holdReason = iota
+	heldByType
+	heldByPartition
+	heldByTenant
+	heldByCapacity
+)
+
+// dispatchGate holds back popped tasks that may not run yet: those whose
+// type is at its TypeConcurrency or HandlerConcurrency cap, those whose
+// PartitionKey has a task running or held, and those that do not fit in
+// the WeightedCapacity. Held tasks were popped from the queue but not
+// acknowledged, so durable backends redeliver them after a crash
+type dispatchGate struct {
+	limits      map[string]int       // nil without type limits
+	caps        func(typ string) int // the HandlerConcurrency of a type, zero without one
+	tenants     *TenantQuotas        // nil without tenant quotas
+	partitioned bool
+	capacity    int // zero without a weighted capacity
+	maxHeld     int
+	ready       chan Task // held tasks that may now run
+
+	mu            sync.Mutex
+	running       map[string]int      // by type
+	tenantRunning map[string]int      // by tenant, for capped tenants
+	busyKeys      map[string]struct{} // partition keys with a running task
+	heldKeys      map[string]int      // partition keys with held tasks
+	used          int                 // weight of the running tasks
+	starved       int                 // held tasks waiting for capacity
+	held          []Task              // in pop order
+	waiting       int                 // held or in ready
+	changed       chan struct{}       // closed and replaced whenever waiting drops
+}
+
+func newDispatchGate(limits map[string]int, caps func(string) int, tenants *TenantQuotas, partitioned bool, capacity, maxHeld int) *dispatchGate {
+	return &dispatchGate{
+		limits:      limits,
+		caps:        caps,
+		tenants:     tenants,
+		partitioned: partitioned,
+		capacity:    capacity,
+		maxHeld:     maxHeld,
+		// Never more tasks wait than maxHeld, so sends never block
+		ready:         make(chan Task, maxHeld),
+		running:       make(map[string]int),
+		tenantRunning: make(map[string]int),
+		busyKeys:      make(map[string]struct{}),
+		heldKeys:      make(map[string]int),
+		changed:       make(chan struct{}),
+	}
+}
+
+// key returns the partition key of a task, empty when it is not ordered
+func (g *dispatchGate) key(t Task) string {
+	if !g.partitioned {
+		return ""
+	}
+	return t.PartitionKey
+}
+
+// typeLimit returns the cap of the type of t, the one of its handler
+// before the one of TypeConcurrency, zero when it is not capped
+func (g *dispatchGate) typeLimit(t Task) int {
+	if n := g.caps(t.Type); n > 0 {
+		return n
+	}
+	return g.limits[t.Type]
+}
+
+// tenantLimit returns the in-flight quota of the tenant of t, zero when
+// it is not capped
+func (g *dispatchGate) tenantLimit(t Task) int {
+	if g.tenants == nil || t.Tenant == "" {
+		return 0
+	}
+	return g.tenants.quota(t.Tenant).MaxInFlight
+}
+
+// slotFree returns why t may not run for want of a slot of its type or
+// tenant or of capacity, admitted when it may. Tasks wait for capacity
+// behind those already waiting for it
+func (g *dispatchGate) slotFree(t Task) holdReason {
+	if limit := g.typeLimit(t); limit > 0 && g.running[t.Type] >= limit {
+		return heldByType
+	}
+	if limit := g.tenantLimit(t); limit > 0 && g.tenantRunning[t.Tenant] >= limit {
+		return heldByTenant
+	}
+	if g.capacity > 0 && (g.starved > 0 || g.used+weight(t) > g.capacity) {
+		return heldByCapacity
+	}
+	return admitted
+}
+
+// take marks t as running
+func (g *dispatchGate) take(t Task) {
+	// Counted whether capped or not, as handlers may get a cap at any time
+	g.running[t.Type]++
+	if g.tenantLimit(t) > 0 {
+		g.tenantRunning[t.Tenant]++
+	}
+	if k := g.key(t); k != "" {
+		g.busyKeys[k] = struct{}{}
+	}
+	if g.capacity > 0 {
+		g.used += weight(t)
+	}
+}
+
+// admit lets task run, or holds it back and says why. Tasks of a key wait
+// behind the held ones, so keys keep their order
+func (g *dispatchGate) admit(task Task) holdReason {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	reason := admitted
+	if k := g.key(task); k != "" {
+		if _, busy := g.busyKeys[k]; busy || g.heldKeys[k] > 0 {
+			reason = heldByPartition
+		}
+	}
+	if reason == admitted {
+		reason = g.slotFree(task)
+	}
+	if reason == admitted {
+		g.take(task)
+		return admitted
+	}
+	g.held = append(g.held, task)
+	if k := g.key(task); k != "" {
+		g.heldKeys[k]++
+	}
+	if reason == heldByCapacity {
+		g.starved++
+	}
+	g.waiting++
+	return reason
+}
+
+// release frees what an ended task held and lets the oldest held tasks
+// that may now run go. The next task of the same partition key is returned
+// for the caller to run, keeping a key on one worker; the others go to
+// ready
+func (g *dispatchGate) release(task Task) (next Task, ok bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.running[task.Type]--; g.running[task.Type] <= 0 {
+		delete(g.running, task.Type)
+	}
+	if g.tenantLimit(task) > 0 {
+		g.tenantRunning[task.Tenant]--
+	}
+	if k := g.key(task); k != "" {
+		delete(g.busyKeys, k)
+	}
+	if g.capacity > 0 {
+		g.used -= weight(task)
+	}
+
+	blocked := make(map[string]bool) // keys whose oldest held task stays
+	kept := g.held[:0]
+	g.starved = 0 // counted again as the held tasks are gone through
+	for _, h := range g.held {
+		k := g.key(h)
+		_, busy := g.busyKeys[k]
+		reason := heldByPartition
+		if k == "" || !(blocked[k] || busy) {
+			reason = g.slotFree(h)
+		}
+		if reason != admitted {
+			if k != "" {
+				blocked[k] = true
+			}
+			if reason == heldByCapacity {
+				g.starved++
+			}
+			kept = append(kept, h)
+			continue
+		}
+		g.take(h)
+		if k != "" {
+			if g.heldKeys[k]--; g.heldKeys[k] == 0 {
+				delete(g.heldKeys, k)
+			}
+		}
+		if !ok && k != "" && k == g.key(task) {
+			next, ok = h, true
+			continue
+		}
+		g.ready <- h
+	}
+	clear(g.held[len(kept):])
+	g.held = kept
+	return next, ok
+}
+
+// taken records that a worker picked up a task let go by release
+func (g *dispatchGate) taken() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.waiting--
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+// heldCount returns the number of tasks held back or waiting in ready
+func (g *dispatchGate) heldCount() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.waiting
+}
+
+// waitBelow blocks while more than n tasks are held back, reporting false
+// if ctx is done first
+func (g *dispatchGate) waitBelow(ctx context.Context, n int) bool {
+	for {
+		g.mu.Lock()
+		waiting, changed := g.waiting, g.changed
+		g.mu.Unlock()
+		if waiting <= n {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// admit applies the gate to a task popped by the dispatcher, first waiting
+// for room when too many tasks are held back. It reports false when the
+// task was held back, or the pool torn down
+func (p *WorkerPool) admit(task Task) bool {
+	if !p.gate.waitBelow(p.ctx, p.gate.maxHeld-1) {
+		return false
+	}
+	switch p.gate.admit(task) {
+	case heldByType:
+		p.metrics.typeHeld.WithLabelValues(task.Type).Inc()
+		p.taskLogger(task).Debug("task held back by its type limit", "type", task.Type)
+		return false
+	case heldByTenant:
+		p.metrics.tenantHeld.WithLabelValues(task.Tenant).Inc()
+		p.taskLogger(task).Debug("task held back by its tenant quota", "tenant", task.Tenant)
+		return false
+	case heldByCapacity:
+		p.metrics.capacityHeld.Inc()
+		p.taskLogger(task).Debug("task waiting for capacity", "weight", weight(task))
+		return false
+	case heldByPartition:
+		p.metrics.partitionHeld.Inc()
+		p.taskLogger(task).Debug("task waiting for its partition", "partition_key", task.PartitionKey)
+		return false
+	}
+	return true
+}
+
+// released frees the gate slots of a task a worker has finished and
+// returns the task of the same partition the worker should run next
+func (p *WorkerPool) released(task Task, alive bool) (Task, bool) {
+	next, ok := p.gate.release(task)
+	if ok && !alive {
+		// Left for the replacement worker, or any other
+		p.gate.ready <- next
+		return Task{}, false
+	}
+	if ok {
+		p.gate.taken()
+	}
+	return next, ok
+}
@@ -0,0 +1,111 @@
+package go_playground
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrency tracks how many tasks of each group run at once
+type concurrency struct {
+	mu      sync.Mutex
+	running map[string]int
+	peak    map[string]int
+}
+
+func newConcurrency() *concurrency {
+	return &concurrency{running: make(map[string]int), peak: make(map[string]int)}
+}
+
+func (c *concurrency) run(group string) {
+	c.mu.Lock()
+	c.running[group]++
+	c.peak[group] = max(c.peak[group], c.running[group])
+	c.mu.Unlock()
+	time.Sleep(2 * time.Millisecond)
+	c.mu.Lock()
+	c.running[group]--
+	c.mu.Unlock()
+}
+
+func TestPartitioningRunsKeysInOrder(t *testing.T) {
+	c := newConcurrency()
+	var mu sync.Mutex
+	order := make(map[string][]int)
+	p := startPool(t, WithWorkers(4), WithPartitioning(Partitioning{}), handle(func(task Task) error {
+		c.run(task.PartitionKey)
+		mu.Lock()
+		n, _ := strconv.Atoi(task.Data)
+		order[task.PartitionKey] = append(order[task.PartitionKey], n)
+		mu.Unlock()
+		return nil
+	}))
+
+	var tasks []Task
+	for i := range 20 {
+		tasks = append(tasks, Task{PartitionKey: "k" + strconv.Itoa(i%2), Data: strconv.Itoa(i)})
+	}
+	process(t, p, StateSucceeded, tasks...)
+	for key, peak := range c.peak {
+		if peak != 1 {
+			t.Errorf("%d tasks of key %s ran at once, want 1", peak, key)
+		}
+	}
+	for key, got := range order {
+		if len(got) != 10 || !slices.IsSorted(got) {
+			t.Errorf("key %s ran tasks %v, want its 10 in submission order", key, got)
+		}
+	}
+}
+
+func TestTypeConcurrencyCapsTypes(t *testing.T) {
+	c := newConcurrency()
+	p := startPool(t, WithWorkers(4), WithTypeConcurrency(TypeConcurrency{Limits: map[string]int{"slow": 1}}), handle(func(task Task) error {
+		c.run(task.Type)
+		return nil
+	}))
+
+	var tasks []Task
+	for range 10 {
+		tasks = append(tasks, Task{Type: "slow"}, Task{Type: "fast"})
+	}
+	process(t, p, StateSucceeded, tasks...)
+	if c.peak["slow"] != 1 {
+		t.Errorf("%d slow tasks ran at once, want 1", c.peak["slow"])
+	}
+	if c.peak["fast"] < 2 {
+		t.Errorf("at most %d fast tasks ran at once, want them in parallel", c.peak["fast"])
+	}
+}
+
+func TestWeightedCapacityBoundsRunningWeight(t *testing.T) {
+	var mu sync.Mutex
+	used, peak := 0, 0
+	p := startPool(t, WithWorkers(4), WithWeightedCapacity(WeightedCapacity{Capacity: 5}), handle(func(task Task) error {
+		mu.Lock()
+		used += task.Weight
+		peak = max(peak, used)
+		mu.Unlock()
+		time.Sleep(2 * time.Millisecond)
+		mu.Lock()
+		used -= task.Weight
+		mu.Unlock()
+		return nil
+	}))
+
+	var tasks []Task
+	for i := range 12 {
+		tasks = append(tasks, Task{Weight: 1 + i%3})
+	}
+	process(t, p, StateSucceeded, tasks...)
+	if peak > 5 {
+		t.Errorf("running tasks weighed %d at once, want at most the capacity 5", peak)
+	}
+	var verr *ValidationError
+	if _, err := p.Submit(Task{Weight: 6}); !errors.As(err, &verr) {
+		t.Errorf("Submit of a task over the capacity = %v, want a ValidationError", err)
+	}
+}
@@ -0,0 +1,237 @@
+package go_playground
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	// ErrGroupNotFound is returned for unknown group IDs
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrIdempotentGroup is returned by SubmitGroup for tasks with an
+	// IdempotencyKey, whose duplicates would never report to the group
+	ErrIdempotentGroup = errors.New("tasks of a group cannot have idempotency keys")
+)
+
+// groupRetention is how long finished groups stay queryable
+const groupRetention = time.Hour
+
+// GroupStatus aggregates the outcome of the tasks of a group. It is done
+// once every task has ended
+type GroupStatus struct {
+	ID         string     `json:"id"`
+	TaskIDs    []int      `json:"task_ids"`
+	Total      int        `json:"total"`
+	Succeeded  int        `json:"succeeded"`
+	Failed     int        `json:"failed"`
+	Canceled   int        `json:"canceled"`
+	Done       bool       `json:"done"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Pending returns the number of tasks that have not ended yet
+func (g GroupStatus) Pending() int {
+	return g.Total - g.Succeeded - g.Failed - g.Canceled
+}
+
+type groupRun struct {
+	status GroupStatus
+	done   chan struct{} // closed once every task has ended
+}
+
+// groups tracks the task groups submitted to a pool
+type groups struct {
+	mu        sync.Mutex
+	runs      map[string]*groupRun
+	lastSweep time.Time
+}
+
+// SubmitGroup submits tasks together, as SubmitBatch does, under a new
+// group ID whose aggregate status is returned by Group and WaitGroupDone
+func (p *WorkerPool) SubmitGroup(tasks []Task) (GroupStatus, error) {
+	if len(tasks) == 0 {
+		return GroupStatus{}, errors.New("group has no tasks")
+	}
+	run := &groupRun{
+		status: GroupStatus{
+			ID:        newCorrelationID(),
+			Total:     len(tasks),
+			CreatedAt: time.Now(),
+		},
+		done: make(chan struct{}),
+	}
+	tasks = append([]Task(nil), tasks...)
+	for i := range tasks {
+		if tasks[i].IdempotencyKey != "" {
+			return GroupStatus{}, ErrIdempotentGroup
+		}
+		tasks[i].GroupID = run.status.ID
+	}
+
+	// Registered first, tasks may end before SubmitBatch returns
+	p.groups.mu.Lock()
+	if p.groups.runs == nil {
+		p.groups.runs = make(map[string]*groupRun)
+	}
+	p.groups.sweep(run.status.CreatedAt)
+	p.groups.runs[run.status.ID] = run
+	p.groups.mu.Unlock()
+
+	tasks, err := p.SubmitBatch(tasks)
+	p.groups.mu.Lock()
+	defer p.groups.mu.Unlock()
+	if err != nil {
+		delete(p.groups.runs, run.status.ID)
+		return GroupStatus{}, err
+	}
+	run.status.TaskIDs = make([]int, len(tasks))
+	for i, t := range tasks {
+		run.status.TaskIDs[i] = t.ID
+	}
+	p.log.Info("group submitted", "group_id", run.status.ID, "tasks", len(tasks))
+	return run.status.clone(), nil
+}
+
+// Group returns the aggregate status of a group
+func (p *WorkerPool) Group(id string) (GroupStatus, error) {
+	p.groups.mu.Lock()
+	defer p.groups.mu.Unlock()
+	run, ok := p.groups.runs[id]
+	if !ok {
+		return GroupStatus{}, ErrGroupNotFound
+	}
+	return run.status.clone(), nil
+}
+
+// WaitGroupDone blocks until every task of the group has ended or ctx is
+// done, and returns the group status either way
+func (p *WorkerPool) WaitGroupDone(ctx context.Context, id string) (GroupStatus, error) {
+	p.groups.mu.Lock()
+	run, ok := p.groups.runs[id]
+	p.groups.mu.Unlock()
+	if !ok {
+		return GroupStatus{}, ErrGroupNotFound
+	}
+
+	var err error
+	select {
+	case <-run.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	status, _ := p.Group(id)
+	return status, err
+}
+
+// groupTaskDone counts a finished task towards its group
+func (p *WorkerPool) groupTaskDone(rec TaskRecord) {
+	if rec.GroupID == "" {
+		return
+	}
+	p.groups.mu.Lock()
+	defer p.groups.mu.Unlock()
+	run, ok := p.groups.runs[rec.GroupID]
+	if !ok || run.status.Done {
+		return
+	}
+
+	switch rec.State {
+	case StateSucceeded:
+		run.status.Succeeded++
+	case StateFailed:
+		run.status.Failed++
+	case StateCanceled:
+		run.status.Canceled++
+	}
+	if run.status.Pending() == 0 {
+		now := time.Now()
+		run.status.Done, run.status.FinishedAt = true, &now
+		close(run.done)
+		p.log.Info("group finished", "group_id", run.status.ID,
+			"succeeded", run.status.Succeeded, "failed", run.status.Failed, "canceled", run.status.Canceled)
+	}
+}
+
+func (g GroupStatus) clone() GroupStatus {
+	g.TaskIDs = append([]int(nil), g.TaskIDs...)
+	return g
+}
+
+// sweep forgets groups finished for longer than groupRetention. The caller
+// holds g.mu
+func (g *groups) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < time.Minute {
+		return
+	}
+	g.lastSweep = now
+	for id, run := range g.runs {
+		if f := run.status.FinishedAt; f != nil && now.Sub(*f) > groupRetention {
+			delete(g.runs, id)
+		}
+	}
+}
+
+// groupRoutes adds the task group routes to r
+func (s *Server) groupRoutes(r *mux.Router) {
+	r.Handle("/groups", s.limit(s.submitGroupHandler)).Methods("POST")
+	r.HandleFunc("/groups/{group}", s.groupHandler).Methods("GET")
+}
+
+// submitGroupHandler takes the same JSON array as POST /events/batch
+func (s *Server) submitGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(IdempotencyHeader) != "" {
+		writeError(w, http.StatusBadRequest, ErrIdempotentGroup.Error(), IdempotencyHeader)
+		return
+	}
+	p, tasks, ok := s.batchRequest(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := p.SubmitGroup(tasks)
+	switch {
+	case errors.Is(err, ErrIdempotentGroup):
+		writeError(w, http.StatusBadRequest, err.Error(), "idempotency_key")
+		return
+	case err != nil:
+		submitError(w, p, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+// groupHandler returns the group status, after waiting for it to finish
+// when asked to with the wait parameter as for POST /event
+func (s *Server) groupHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	wait, err := parseWait(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	id := mux.Vars(r)["group"]
+	var status GroupStatus
+	if wait > 0 {
+		holdOpen(w, wait)
+		ctx, cancel := context.WithTimeout(r.Context(), wait)
+		defer cancel()
+		status, err = p.WaitGroupDone(ctx, id)
+	} else {
+		status, err = p.Group(id)
+	}
+	if errors.Is(err, ErrGroupNotFound) {
+		writeError(w, http.StatusNotFound, err.Error(), "")
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
@@ -0,0 +1,202 @@
+// Package grpcapi serves the worker pool over gRPC
+package grpcapi
+
+import (
+	"context"
+	"errors"
+
+	pool "playground"
+	"playground/grpcapi/taskpb"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// eventBuffer is how many events a slow stream may fall behind before
+// it starts missing them
+const eventBuffer = 256
+
+// Server implements taskpb.TaskServiceServer on top of a WorkerPool
+type Server struct {
+	taskpb.UnimplementedTaskServiceServer
+	pool *pool.WorkerPool
+}
+
+// NewServer creates the gRPC service for the given pool
+func NewServer(p *pool.WorkerPool) *Server {
+	return &Server{pool: p}
+}
+
+// Register adds the task service for p to s
+func Register(s *grpc.Server, p *pool.WorkerPool) {
+	taskpb.RegisterTaskServiceServer(s, NewServer(p))
+}
+
+// SubmitTask implements taskpb.TaskServiceServer
+func (s *Server) SubmitTask(ctx context.Context, req *taskpb.SubmitTaskRequest) (*taskpb.SubmitTaskResponse, error) {
+	task := pool.Task{
+		Priority:      int(req.GetPriority()),
+		CorrelationID: req.GetCorrelationId(),
+	}
+	switch payload := req.GetPayload().(type) {
+	case *taskpb.SubmitTaskRequest_Data:
+		task.Data = payload.Data
+	case *taskpb.SubmitTaskRequest_Json:
+		b, err := protojson.Marshal(payload.Json)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "encoding json payload: %v", err)
+		}
+		task.Data = string(b)
+	}
+	if task.Data == "" {
+		return nil, status.Error(codes.InvalidArgument, "payload must not be empty")
+	}
+	if d := req.GetDelay(); d != nil {
+		if task.Delay = d.AsDuration(); task.Delay < 0 {
+			return nil, status.Error(codes.InvalidArgument, "delay must not be negative")
+		}
+	}
+	if t := req.GetTimeout(); t != nil {
+		if task.Timeout = t.AsDuration(); task.Timeout <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "timeout must be positive")
+		}
+	}
+
+	pool.TraceTask(ctx, &task)
+
+	task, err := s.pool.Submit(task)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &taskpb.SubmitTaskResponse{Id: int64(task.ID)}, nil
+}
+
+// GetTaskStatus implements taskpb.TaskServiceServer
+func (s *Server) GetTaskStatus(ctx context.Context, req *taskpb.GetTaskStatusRequest) (*taskpb.TaskStatus, error) {
+	rec, err := s.pool.Status(int(req.GetId()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	st := &taskpb.TaskStatus{
+		Id:            int64(rec.ID),
+		Data:          rec.Data,
+		Priority:      int32(rec.Priority),
+		Attempts:      int32(rec.Attempts),
+		State:         toState(rec.State),
+		Error:         rec.Error,
+		QueuedAt:      timestamppb.New(rec.QueuedAt),
+		CorrelationId: rec.CorrelationID,
+		Progress:      toProgress(rec.Progress),
+	}
+	if rec.StartedAt != nil {
+		st.StartedAt = timestamppb.New(*rec.StartedAt)
+	}
+	if rec.FinishedAt != nil {
+		st.FinishedAt = timestamppb.New(*rec.FinishedAt)
+	}
+	return st, nil
+}
+
+// StreamTaskEvents implements taskpb.TaskServiceServer
+func (s *Server) StreamTaskEvents(req *taskpb.StreamTaskEventsRequest, stream grpc.ServerStreamingServer[taskpb.TaskEvent]) error {
+	ids := make(map[int]bool, len(req.GetTaskIds()))
+	for _, id := range req.GetTaskIds() {
+		ids[int(id)] = true
+	}
+
+	events, cancel := s.pool.Subscribe(eventBuffer)
+	defer cancel()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case ev, ok := <-events:
+			if !ok {
+				return status.Error(codes.Unavailable, "server is shutting down")
+			}
+			if len(ids) > 0 && !ids[ev.Task.ID] {
+				continue
+			}
+			if req.GetTerminalOnly() && !ev.State.Terminal() {
+				continue
+			}
+			err := stream.Send(&taskpb.TaskEvent{
+				TaskId:        int64(ev.Task.ID),
+				State:         toState(ev.State),
+				Attempts:      int32(ev.Task.Attempts),
+				Error:         ev.Error,
+				Time:          timestamppb.New(ev.Time),
+				CorrelationId: ev.Task.CorrelationID,
+				Progress:      toProgress(ev.Progress),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func toProgress(pr *pool.Progress) *taskpb.Progress {
+	if pr == nil {
+		return nil
+	}
+	return &taskpb.Progress{
+		Percent:   int32(pr.Percent),
+		Message:   pr.Message,
+		UpdatedAt: timestamppb.New(pr.UpdatedAt),
+	}
+}
+
+func toState(s pool.TaskState) taskpb.TaskState {
+	switch s {
+	case pool.StateQueued:
+		return taskpb.TaskState_TASK_STATE_QUEUED
+	case pool.StateRunning:
+		return taskpb.TaskState_TASK_STATE_RUNNING
+	case pool.StateSucceeded:
+		return taskpb.TaskState_TASK_STATE_SUCCEEDED
+	case pool.StateFailed:
+		return taskpb.TaskState_TASK_STATE_FAILED
+	case pool.StateCanceled:
+		return taskpb.TaskState_TASK_STATE_CANCELED
+	}
+	return taskpb.TaskState_TASK_STATE_UNSPECIFIED
+}
+
+// toStatus maps pool errors to gRPC status codes
+func toStatus(err error) error {
+	var ve *pool.ValidationError
+	if errors.As(err, &ve) {
+		return validationStatus(ve)
+	}
+	switch {
+	case errors.Is(err, pool.ErrTaskNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, pool.ErrQueueFull), errors.Is(err, pool.ErrTenantQueueFull), errors.Is(err, pool.ErrTenantDailyLimit):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, pool.ErrPoolClosed):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, pool.ErrInvalidPayload):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// validationStatus reports the fields refused by a validator as
+// BadRequest details
+func validationStatus(ve *pool.ValidationError) error {
+	st := status.New(codes.InvalidArgument, ve.Error())
+	br := &errdetails.BadRequest{}
+	for _, f := range ve.Fields {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: f.Field, Description: f.Message})
+	}
+	if detailed, err := st.WithDetails(br); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
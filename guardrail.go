@@ -0,0 +1,97 @@
+package go_playground
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrMemoryBudget fails, without retries, the attempts whose tracked
+// allocations went past the MaxAllocBytes of their Guardrails
+var ErrMemoryBudget = errors.New("task over its memory budget")
+
+// Guardrails bound what a single task may hold, so one bad task cannot
+// take the process down with it. Zero fields leave a bound as it is
+type Guardrails struct {
+	// MaxResultBytes lowers the result limit of WithResults, SetResult
+	// failing with ErrResultTooLarge past it, and bounds the output set
+	// with SetOutput, a longer one failing the attempt without retries
+	MaxResultBytes int
+	// MaxLogBytes lowers the log bytes kept with the record of the task,
+	// see WithTaskLogLimit
+	MaxLogBytes int
+	// MaxAllocBytes is a soft budget of the memory the attempt holds: its
+	// result and output, and what the handler reports with TrackAllocation,
+	// as Go does not account allocations per goroutine. Past it the attempt
+	// is canceled with ErrMemoryBudget as cause and fails without retries
+	MaxAllocBytes int64
+}
+
+// allocBudgetKey is the context key of the *allocBudget of a guarded
+// attempt
+type allocBudgetKey struct{}
+
+// allocBudget counts the allocations tracked against a budget, those
+// within nested guardrails counting against the outer budgets as well
+type allocBudget struct {
+	max    int64
+	used   atomic.Int64
+	cancel context.CancelCauseFunc
+	parent *allocBudget
+}
+
+// TrackAllocation counts bytes held by the running task against the memory
+// budget of its Guardrails, negative bytes releasing what was counted. It
+// returns ErrMemoryBudget once the budget is spent, the attempt being
+// canceled, and nil for tasks without a budget or outside of a pool handler
+func TrackAllocation(ctx context.Context, bytes int64) error {
+	b, _ := ctx.Value(allocBudgetKey{}).(*allocBudget)
+	var err error
+	for ; b != nil; b = b.parent {
+		if used := b.used.Add(bytes); used > b.max && err == nil {
+			err = fmt.Errorf("%w: %d bytes tracked, budget is %d", ErrMemoryBudget, used, b.max)
+			b.cancel(err)
+		}
+	}
+	return err
+}
+
+// ApplyGuardrails bounds the tasks of the handlers it wraps with g, such as
+// Chain(h, ApplyGuardrails(g)) for those of one handler or
+// WithMiddleware(ApplyGuardrails(g)) for all of them
+func ApplyGuardrails(g Guardrails) TaskMiddleware {
+	return func(next TaskHandler) TaskHandler {
+		return TaskHandlerFunc(func(ctx context.Context, t Task) error {
+			if slot, ok := ctx.Value(resultKey{}).(*resultSlot); ok && g.MaxResultBytes > 0 {
+				slot.max = min(slot.max, g.MaxResultBytes)
+			}
+			if l, ok := ctx.Value(taskLogKey{}).(*taskLogs); ok && g.MaxLogBytes > 0 {
+				l.bound(g.MaxLogBytes)
+			}
+			if g.MaxAllocBytes > 0 {
+				parent, _ := ctx.Value(allocBudgetKey{}).(*allocBudget)
+				var cancel context.CancelCauseFunc
+				ctx, cancel = context.WithCancelCause(ctx)
+				defer cancel(nil)
+				ctx = context.WithValue(ctx, allocBudgetKey{}, &allocBudget{max: g.MaxAllocBytes, cancel: cancel, parent: parent})
+			}
+
+			err := next.Handle(ctx, t)
+			if cause := context.Cause(ctx); errors.Is(cause, ErrMemoryBudget) {
+				if errors.Is(err, ErrPermanent) {
+					// Already aborted by nested guardrails
+					return err
+				}
+				LoggerFrom(ctx).Warn("task aborted by its guardrails", "error", cause)
+				return Permanent(cause)
+			}
+			if output, ok := ctx.Value(outputKey{}).(*string); ok && err == nil && g.MaxResultBytes > 0 && len(*output) > g.MaxResultBytes {
+				err = fmt.Errorf("%w: output of %d bytes, limit is %d", ErrResultTooLarge, len(*output), g.MaxResultBytes)
+				LoggerFrom(ctx).Warn("task aborted by its guardrails", "error", err)
+				return Permanent(err)
+			}
+			return err
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package go_playground
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrUnknownTaskType fails, without retries, the tasks whose type has no
+// registered handler when the pool has no fallback, see RegisterHandler
+var ErrUnknownTaskType = errors.New("no handler for task type")
+
+// TaskHandler processes a single task
+type TaskHandler interface {
+	Handle(ctx context.Context, t Task) error
+}
+
+// TaskHandlerFunc adapts an ordinary function to a TaskHandler
+type TaskHandlerFunc func(ctx context.Context, t Task) error
+
+// Handle calls f(ctx, t)
+func (f TaskHandlerFunc) Handle(ctx context.Context, t Task) error {
+	return f(ctx, t)
+}
+
+// defaultHandler simulates work
+var defaultHandler = TaskHandlerFunc(func(ctx context.Context, _ Task) error {
+	LoggerFrom(ctx).Debug("simulating work", "duration", time.Second)
+	select {
+	case <-time.After(time.Second):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+})
+
+// HandlerOption overrides a pool default for the tasks of the type a
+// handler is registered for, see RegisterHandler
+type HandlerOption func(*handlerConfig)
+
+// handlerConfig holds the overrides of a registered handler, zero fields
+// keeping the pool defaults
+type handlerConfig struct {
+	timeout        time.Duration
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	multiplier     float64
+	concurrency    int
+}
+
+// HandlerTimeout bounds each attempt of the tasks of the handler, in place
+// of WithTaskTimeout. Task.Timeout still wins when set
+func HandlerTimeout(d time.Duration) HandlerOption {
+	return func(c *handlerConfig) { c.timeout = max(d, 0) }
+}
+
+// HandlerMaxAttempts gives the tasks of the handler n attempts, including
+// the first, in place of RetryPolicy.MaxAttempts. The other fields of the
+// retry policy of the pool still apply
+func HandlerMaxAttempts(n int) HandlerOption {
+	return func(c *handlerConfig) { c.maxAttempts = max(n, 0) }
+}
+
+// HandlerBackoff sets the curve of the delays between the retries of the
+// tasks of the handler, in place of the one of the retry policy of the
+// pool. Zero arguments keep the value of the pool
+func HandlerBackoff(initial, maxBackoff time.Duration, multiplier float64) HandlerOption {
+	return func(c *handlerConfig) {
+		c.initialBackoff, c.maxBackoff, c.multiplier = max(initial, 0), max(maxBackoff, 0), max(multiplier, 0)
+	}
+}
+
+// HandlerConcurrency caps the running tasks of the handler at n, held back
+// by the dispatcher as with WithTypeConcurrency, whose limit for the type
+// it replaces
+func HandlerConcurrency(n int) HandlerOption {
+	return func(c *handlerConfig) { c.concurrency = max(n, 0) }
+}
+
+// retry returns rp with the overrides of the handler applied
+func (c handlerConfig) retry(rp RetryPolicy) RetryPolicy {
+	rp.MaxAttempts = cmp.Or(c.maxAttempts, rp.MaxAttempts)
+	rp.InitialBackoff = cmp.Or(c.initialBackoff, rp.InitialBackoff)
+	rp.MaxBackoff = cmp.Or(c.maxBackoff, rp.MaxBackoff)
+	rp.Multiplier = cmp.Or(c.multiplier, rp.Multiplier)
+	return rp
+}
+
+// registeredHandler is a handler with its overrides
+type registeredHandler struct {
+	TaskHandler
+	config handlerConfig
+}
+
+// handlerRegistry routes tasks to the handler registered for their type
+type handlerRegistry struct {
+	fallback TaskHandler // the handler of WithHandler
+	strict   bool        // no WithHandler: unknown types fail once some are registered
+
+	mu       sync.RWMutex
+	handlers map[string]registeredHandler
+}
+
+// config returns the overrides of the handler of a type, zero for types
+// without one
+func (r *handlerRegistry) config(taskType string) handlerConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.handlers[taskType].config
+}
+
+// concurrency returns the cap of the handler of a type, zero when it has
+// none
+func (r *handlerRegistry) concurrency(taskType string) int {
+	return r.config(taskType).concurrency
+}
+
+// route returns the handler of t, failing with ErrUnknownTaskType when it
+// has none
+func (r *handlerRegistry) route(t Task) (TaskHandler, error) {
+	r.mu.RLock()
+	h, ok := r.handlers[t.Type]
+	n := len(r.handlers)
+	r.mu.RUnlock()
+	switch {
+	case ok:
+		return h, nil
+	case r.strict && n > 0:
+		return nil, fmt.Errorf("%w %q", ErrUnknownTaskType, t.Type)
+	}
+	return r.fallback, nil
+}
+
+func (r *handlerRegistry) Handle(ctx context.Context, t Task) error {
+	h, err := r.route(t)
+	if err != nil {
+		return err
+	}
+	return h.Handle(ctx, t)
+}
+
+// RegisterHandler routes the tasks of the given type to h, replacing the
+// handler registered for it before, so one pool serves many job kinds. It
+// may be called while the pool runs. Tasks of other types go to the
+// handler of WithHandler; without one they fail with ErrUnknownTaskType
+// and are dead-lettered. The middleware of the pool wraps every handler.
+// Options override the timeout, retries and concurrency of the pool for
+// the tasks of the type, so slow and fast jobs can share a pool
+func (p *WorkerPool) RegisterHandler(taskType string, h TaskHandler, opts ...HandlerOption) {
+	var cfg handlerConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	p.handlers.mu.Lock()
+	defer p.handlers.mu.Unlock()
+	if h == nil {
+		delete(p.handlers.handlers, taskType)
+	} else {
+		p.handlers.handlers[taskType] = registeredHandler{TaskHandler: h, config: cfg}
+	}
+}
+
+// retryPolicy returns how failed tasks of a type are retried: the policy
+// of the pool with the overrides of the handler of the type
+func (p *WorkerPool) retryPolicy(taskType string) RetryPolicy {
+	return p.handlers.config(taskType).retry(p.RetryPolicy())
+}
+
+// HandledTypes returns the task types with a registered handler, sorted
+func (p *WorkerPool) HandledTypes() []string {
+	p.handlers.mu.RLock()
+	defer p.handlers.mu.RUnlock()
+	return slices.Sorted(maps.Keys(p.handlers.handlers))
+}
+
+// TaskMiddleware wraps a TaskHandler to add behaviour around every run
+type TaskMiddleware func(next TaskHandler) TaskHandler
+
+// Chain wraps h in the middleware. The first one is the outermost, so it
+// sees the task first and the result last
+func Chain(h TaskHandler, mw ...TaskMiddleware) TaskHandler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// RecoverPanics turns a handler panic into a *PanicError returned from
+// the run, leaving the retry policy to decide what happens next. Without it
+// the pool dead-letters the task and replaces the worker
+func RecoverPanics() TaskMiddleware {
+	return func(next TaskHandler) TaskHandler {
+		return TaskHandlerFunc(func(ctx context.Context, t Task) (err error) {
+			defer func() {
+				if v := recover(); v != nil {
+					err = &PanicError{Value: v, Stack: debug.Stack()}
+				}
+			}()
+			return next.Handle(ctx, t)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package go_playground
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// DefaultPropagatedHeaders are the request headers WithHeaderPropagation
+// copies onto tasks besides the ones it is given
+var DefaultPropagatedHeaders = []string{"Traceparent", "Tracestate", "X-Request-Id"}
+
+// maxPropagatedValue bounds the values copied onto tasks, longer ones
+// being left out
+const maxPropagatedValue = 1024
+
+// WithHeaderPropagation copies the named headers of submission requests,
+// and DefaultPropagatedHeaders, onto the Headers of their tasks, so the
+// calls handlers make downstream carry the identity of the original
+// request, see PropagatedHeaders
+func WithHeaderPropagation(names ...string) ServerOption {
+	return func(s *Server) {
+		for _, name := range slices.Concat(DefaultPropagatedHeaders, names) {
+			name = http.CanonicalHeaderKey(name)
+			if !slices.Contains(s.propagate, name) {
+				s.propagate = append(s.propagate, name)
+			}
+		}
+	}
+}
+
+// propagateHeaders copies the propagated headers of r onto t, several
+// values of one header being joined with commas
+func (s *Server) propagateHeaders(r *http.Request, t *Task) {
+	for _, name := range s.propagate {
+		v := strings.Join(r.Header.Values(name), ", ")
+		if v == "" || len(v) > maxPropagatedValue {
+			continue
+		}
+		if t.Headers == nil {
+			t.Headers = make(map[string]string, len(s.propagate))
+		}
+		t.Headers[name] = v
+	}
+}
+
+// headersKey is the context key of the headers of the task being handled
+type headersKey struct{}
+
+// PropagatedHeaders returns the headers copied from the submission request
+// of the task being handled, see WithHeaderPropagation, for the handler
+// to set on the requests it makes. It is empty outside handlers
+func PropagatedHeaders(ctx context.Context) http.Header {
+	h := make(http.Header)
+	m, _ := ctx.Value(headersKey{}).(map[string]string)
+	for name, v := range m {
+		h.Set(name, v)
+	}
+	return h
+}
@@ -0,0 +1,103 @@
+package go_playground
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrPoolPaused is reported by Ready while the pool is paused
+	ErrPoolPaused = errors.New("worker pool is paused")
+	// ErrQueueSaturated is reported by Ready while a bounded queue is full
+	ErrQueueSaturated = errors.New("queue is saturated")
+)
+
+// readyTimeout bounds the backend checks of GET /readyz
+const readyTimeout = 2 * time.Second
+
+// pinger is implemented by backends that can check their connection, such
+// as the Redis queue
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// capped is implemented by backends with a fixed capacity
+type capped interface {
+	Cap() int
+}
+
+// Ready reports why the pool cannot take tasks right now, nil when it can:
+// it is closed or paused, its queue is full, or its backend is unreachable
+func (p *WorkerPool) Ready(ctx context.Context) error {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	switch {
+	case closed:
+		return ErrPoolClosed
+	case p.Paused():
+		return ErrPoolPaused
+	}
+	if c, ok := p.queue.(capped); ok && p.queue.Len() >= c.Cap() {
+		return ErrQueueSaturated
+	}
+	if pg, ok := p.queue.(pinger); ok {
+		if err := pg.Ping(ctx); err != nil {
+			return fmt.Errorf("queue backend unreachable: %w", err)
+		}
+	}
+	return nil
+}
+
+// readiness is the body of GET /readyz
+type readiness struct {
+	Ready  bool              `json:"ready"`
+	Queues map[string]string `json:"queues,omitempty"` // queue -> why it is not ready
+}
+
+// healthRoutes adds the liveness and readiness probes
+func (s *Server) healthRoutes() {
+	s.router.HandleFunc("/healthz", s.healthHandler).Methods("GET")
+	s.router.HandleFunc("/readyz", s.readyHandler).Methods("GET")
+}
+
+// healthHandler answers as long as the process serves requests
+func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// readyHandler answers 200 when every pool accepts tasks, 503 otherwise
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	res := readiness{Ready: true}
+	check := func(name string, p *WorkerPool) {
+		if err := p.Ready(ctx); err != nil {
+			if res.Queues == nil {
+				res.Queues = make(map[string]string)
+			}
+			res.Ready = false
+			res.Queues[name] = err.Error()
+		}
+	}
+	name := s.pool.Name()
+	if name == "" {
+		name = "default"
+	}
+	check(name, s.pool)
+	for name, p := range s.queues {
+		if p != s.pool {
+			check(name, p)
+		}
+	}
+
+	status := http.StatusOK
+	if !res.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, res)
+}
@@ -0,0 +1,134 @@
+package go_playground
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrHedgeLost is the cause canceling the execution of a hedged attempt
+// that did not finish first
+var ErrHedgeLost = errors.New("another execution of the attempt finished first")
+
+// Hedging starts a second execution of an attempt of a task marked Hedge
+// that has not finished within After, takes the outcome of the first to
+// succeed, or of the last to fail, and cancels the other with
+// ErrHedgeLost. Handlers of hedged tasks must tolerate running twice at
+// once. The second execution runs beside the workers, without their
+// WithWorkerHooks state
+type Hedging struct {
+	After time.Duration // attempt duration before hedging
+	Max   int           // second executions running at once, unbounded when zero
+}
+
+// hedging bounds the second executions running
+type hedging struct {
+	cfg     Hedging
+	running atomic.Int64
+}
+
+func (h *hedging) acquire() bool {
+	if h.running.Add(1) > int64(h.cfg.Max) && h.cfg.Max > 0 {
+		h.running.Add(-1)
+		return false
+	}
+	return true
+}
+
+func (h *hedging) release() { h.running.Add(-1) }
+
+// hedges reports whether the attempts of t are hedged
+func (p *WorkerPool) hedges(t Task) bool {
+	return t.Hedge && p.hedging != nil
+}
+
+// execution is the outcome of one execution of a hedged attempt
+type execution struct {
+	vals  *attemptValues
+	err   error
+	panic *PanicError
+}
+
+// hedge runs the attempt set up in first, starting a second execution if
+// it is still running after the threshold. It returns the values of the
+// execution whose outcome is taken, with the task updated by its
+// checkpoints, and panics again with a panic of that execution
+func (p *WorkerPool) hedge(task *Task, first *attemptValues) (*attemptValues, error) {
+	// Each execution saves checkpoints to its own copy of the task, so the
+	// one left running cannot touch the task once it is returned
+	firstTask := *task
+	first.checkpoint.task = &firstTask
+	// Both executions stop with the attempt, on a timeout or Cancel
+	parent := first.Context
+	var cancelFirst context.CancelCauseFunc
+	first.Context, cancelFirst = context.WithCancelCause(parent)
+	// Canceling the execution taken once it returned is harmless
+	defer cancelFirst(ErrHedgeLost)
+
+	done := make(chan execution, 2)
+	execute := func(vals *attemptValues, t Task) {
+		out := execution{vals: vals}
+		defer func() {
+			if v := recover(); v != nil {
+				out.panic = panicError(v)
+				out.err = out.panic
+			}
+			done <- out
+		}()
+		out.err = p.handle(vals, t)
+	}
+	go execute(first, firstTask)
+
+	timer := time.NewTimer(p.hedging.cfg.After)
+	defer timer.Stop()
+	var second *attemptValues
+	var cpu time.Duration // of the executions that returned
+	running := 1
+	for {
+		select {
+		case <-timer.C:
+			if !p.hedging.acquire() {
+				continue
+			}
+			secondTask := *task
+			second = &attemptValues{
+				result:     resultSlot{max: first.result.max},
+				progress:   first.progress,
+				checkpoint: checkpointSlot{p: p, task: &secondTask},
+				logs:       first.logs,
+				once:       first.once,
+				headers:    first.headers,
+			}
+			var cancelSecond context.CancelCauseFunc
+			second.Context, cancelSecond = context.WithCancelCause(parent)
+			defer cancelSecond(ErrHedgeLost)
+			running++
+			p.taskLogger(*task).Info("task hedged", "attempt", task.Attempts, "after", p.hedging.cfg.After)
+			go func() {
+				defer p.hedging.release()
+				execute(second, secondTask)
+			}()
+		case out := <-done:
+			running--
+			cpu += out.vals.cpu
+			out.vals.cpu = cpu
+			if out.err != nil && running > 0 {
+				// Wait for the other, which may yet succeed
+				continue
+			}
+			if second != nil {
+				winner := "first"
+				if out.vals == second {
+					winner = "second"
+				}
+				p.metrics.hedged.WithLabelValues(winner).Inc()
+			}
+			task.Checkpoint = out.vals.checkpoint.task.Checkpoint
+			if out.panic != nil {
+				panic(out.panic)
+			}
+			return out.vals, out.err
+		}
+	}
+}
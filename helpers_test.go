@@ -0,0 +1,130 @@
+package go_playground
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errBroken = errors.New("broken")
+
+// handle runs fn on each task
+func handle(fn func(Task) error) Option {
+	return WithHandler(TaskHandlerFunc(func(_ context.Context, task Task) error { return fn(task) }))
+}
+
+// nopHandler spares the tests the simulated work of the default handler
+func nopHandler() Option {
+	return handle(func(Task) error { return nil })
+}
+
+// failing fails every task for good, dead-lettering it
+func failing() Option {
+	return handle(func(Task) error { return Permanent(errBroken) })
+}
+
+// newPool returns a pool of one worker that logs nowhere and runs tasks
+// with nopHandler, as changed by opts, shut down once the test ends. It is
+// not started, so its tasks stay as submitted until it is
+func newPool(t *testing.T, opts ...Option) *WorkerPool {
+	t.Helper()
+	p := NewWorkerPool(append([]Option{WithWorkers(1), WithLogger(slog.New(slog.DiscardHandler)), nopHandler()}, opts...)...)
+	t.Cleanup(func() {
+		ctx := context.Background()
+		p.mu.Lock()
+		if !p.started {
+			// Nothing would ever run its delayed and blocked tasks, so
+			// shut it down without waiting for them
+			ctx = t.Context()
+		}
+		p.mu.Unlock()
+		_ = p.Shutdown(ctx)
+	})
+	return p
+}
+
+// startPool returns a started newPool
+func startPool(t *testing.T, opts ...Option) *WorkerPool {
+	t.Helper()
+	p := newPool(t, opts...)
+	p.Start()
+	return p
+}
+
+// submit submits tasks, failing the test when one is refused, and returns
+// them as submitted
+func submit(t *testing.T, p *WorkerPool, tasks ...Task) []Task {
+	t.Helper()
+	for i, task := range tasks {
+		task, err := p.Submit(task)
+		if err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+		tasks[i] = task
+	}
+	return tasks
+}
+
+// waitState waits for a task to finish and returns its record
+func waitState(t *testing.T, p *WorkerPool, id int) TaskRecord {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rec, err := p.WaitTask(ctx, id)
+	if err != nil {
+		t.Fatalf("WaitTask(%d): %v", id, err)
+	}
+	return rec
+}
+
+// process submits tasks and waits for each to finish in state want,
+// failing the test otherwise, and returns their records
+func process(t *testing.T, p *WorkerPool, want TaskState, tasks ...Task) []TaskRecord {
+	t.Helper()
+	recs := make([]TaskRecord, len(tasks))
+	for i, task := range submit(t, p, tasks...) {
+		recs[i] = waitState(t, p, task.ID)
+		if recs[i].State != want {
+			t.Fatalf("task %d %s, want %s", task.ID, recs[i].State, want)
+		}
+	}
+	return recs
+}
+
+// waitWorkers waits for the pool to have n workers
+func waitWorkers(t *testing.T, p *WorkerPool, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Workers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("pool has %d workers, want %d", p.Workers(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// serve sends a request with body to h and returns the response, header
+// holding pairs of names and values
+func serve(h http.Handler, method, path, body string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// decode decodes the JSON body of the response w into out
+func decode(t *testing.T, w *httptest.ResponseRecorder, out any) {
+	t.Helper()
+	if err := json.NewDecoder(w.Body).Decode(out); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+}
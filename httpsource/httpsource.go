@@ -0,0 +1,278 @@
+// Package httpsource is a pool.Source polling an HTTP endpoint for work,
+// for systems that cannot push their items to POST /event
+package httpsource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	pool "playground"
+)
+
+// Options configures a Source
+type Options struct {
+	// URL is polled with GET
+	URL string
+	// Interval is the wait between polls that found nothing new. Defaults
+	// to 10s
+	Interval time.Duration
+	// Header is sent with every poll, such as an Authorization
+	Header http.Header
+	// Client defaults to a client with a 30s timeout
+	Client *http.Client
+
+	// Items is the field of the JSON response holding the array of items,
+	// the response being the array itself when empty
+	Items string
+	// Cursor is the field of the response holding where the next poll
+	// resumes, sent back as the CursorParam query parameter. A poll
+	// returning a new cursor and items is followed by another right away.
+	// It needs Items
+	Cursor string
+	// CursorParam defaults to "cursor"
+	CursorParam string
+	// ID is the field of an item identifying it. Tasks get an idempotency
+	// key from it, so items returned again, such as after a restart, are
+	// dropped within the idempotency TTL of the pool
+	ID string
+
+	// Decode converts an item into a task. Defaults to a task of type
+	// Type carrying the JSON of the item as its data
+	Decode func(item json.RawMessage) (pool.Task, error)
+	// Type is the type of the tasks of the default Decode
+	Type string
+	// Logger receives failed polls and dropped items. Defaults to
+	// slog.Default()
+	Logger *slog.Logger
+}
+
+// Source polls an endpoint, converting the items of each response into
+// tasks. Polls are conditional on the ETag or Last-Modified of the
+// previous response, an unchanged 304 costing nothing. The cursor moves
+// on once every item of a response is queued; it is kept in memory, so a
+// restarted source polls from the start again
+type Source struct {
+	opts Options
+
+	cursor       string
+	etag         string
+	lastModified string
+}
+
+// New creates a source. Nothing is polled until Run
+func New(opts Options) *Source {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if opts.CursorParam == "" {
+		opts.CursorParam = "cursor"
+	}
+	if opts.Decode == nil {
+		opts.Decode = func(item json.RawMessage) (pool.Task, error) {
+			return pool.Task{Type: opts.Type, Data: string(item)}, nil
+		}
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return &Source{opts: opts}
+}
+
+// Name implements pool.Source
+func (s *Source) Name() string {
+	return "http:" + s.opts.URL
+}
+
+// Run implements pool.Source. Failed polls are logged and tried again
+// after Interval, or the Retry-After of the endpoint
+func (s *Source) Run(ctx context.Context, submit func(context.Context, pool.Task) error) error {
+	if _, err := url.Parse(s.opts.URL); err != nil {
+		return fmt.Errorf("httpsource: %w", err)
+	}
+	for {
+		wait := s.opts.Interval
+		more, err := s.poll(ctx, submit)
+		if ctx.Err() != nil {
+			return nil
+		}
+		var re *retryAfterError
+		switch {
+		case errors.As(err, &re):
+			s.opts.Logger.Warn("httpsource: poll refused", "url", s.opts.URL, "status", re.status, "retry_after", re.after)
+			wait = max(re.after, wait)
+		case err != nil:
+			s.opts.Logger.Error("httpsource: polling", "url", s.opts.URL, "error", err)
+		case more:
+			continue
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// retryAfterError is a poll refused with 429 or 503
+type retryAfterError struct {
+	status int
+	after  time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return fmt.Sprintf("status %d, retry after %s", e.status, e.after)
+}
+
+// poll fetches and submits one response, reporting whether the next page
+// should be fetched right away
+func (s *Source) poll(ctx context.Context, submit func(context.Context, pool.Task) error) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.pollURL(), nil)
+	if err != nil {
+		return false, err
+	}
+	for name, values := range s.opts.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if s.etag != "" {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	if s.lastModified != "" {
+		req.Header.Set("If-Modified-Since", s.lastModified)
+	}
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		secs, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return false, &retryAfterError{status: resp.StatusCode, after: time.Duration(secs) * time.Second}
+	case resp.StatusCode != http.StatusOK:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return false, fmt.Errorf("status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	items, cursor, err := s.parse(body)
+	if err != nil {
+		return false, err
+	}
+
+	for _, item := range items {
+		task, err := s.decode(item)
+		if err == nil {
+			err = submit(ctx, task)
+		}
+		if ctx.Err() != nil {
+			// The cursor stays, the page is fetched again
+			return false, ctx.Err()
+		}
+		if err != nil {
+			s.opts.Logger.Warn("httpsource: dropping item", "url", s.opts.URL, "error", err)
+		}
+	}
+	s.etag = resp.Header.Get("ETag")
+	s.lastModified = resp.Header.Get("Last-Modified")
+	if cursor == "" || cursor == s.cursor {
+		return false, nil
+	}
+	// Validators are those of another URL once the cursor moves
+	s.cursor, s.etag, s.lastModified = cursor, "", ""
+	return len(items) > 0, nil
+}
+
+// pollURL returns the URL with the cursor of the last response
+func (s *Source) pollURL() string {
+	if s.cursor == "" {
+		return s.opts.URL
+	}
+	u, _ := url.Parse(s.opts.URL)
+	q := u.Query()
+	q.Set(s.opts.CursorParam, s.cursor)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// parse returns the items and cursor of a response
+func (s *Source) parse(body []byte) ([]json.RawMessage, string, error) {
+	var items []json.RawMessage
+	if s.opts.Items == "" {
+		if err := json.Unmarshal(body, &items); err != nil {
+			return nil, "", fmt.Errorf("decoding items: %w", err)
+		}
+		return items, "", nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, "", fmt.Errorf("decoding response: %w", err)
+	}
+	if raw := fields[s.opts.Items]; len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, "", fmt.Errorf("decoding %q: %w", s.opts.Items, err)
+		}
+	}
+	var cursor string
+	if s.opts.Cursor != "" {
+		cursor = scalar(fields[s.opts.Cursor])
+	}
+	return items, cursor, nil
+}
+
+// decode converts an item, keyed by its ID
+func (s *Source) decode(item json.RawMessage) (pool.Task, error) {
+	task, err := s.opts.Decode(item)
+	if err != nil {
+		return task, err
+	}
+	if s.opts.ID != "" && task.IdempotencyKey == "" {
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(item, &fields) == nil {
+			if id := scalar(fields[s.opts.ID]); id != "" {
+				task.IdempotencyKey = s.keyPrefix() + id
+			}
+		}
+	}
+	return task, nil
+}
+
+// keyPrefix is the start of the idempotency keys of the items, naming the
+// endpoint without its query
+func (s *Source) keyPrefix() string {
+	u, err := url.Parse(s.opts.URL)
+	if err != nil {
+		return "http:"
+	}
+	return "http:" + u.Host + u.Path + ":"
+}
+
+// scalar returns a JSON string or number as text, empty for other values
+func scalar(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	if n := strings.TrimSpace(string(raw)); n != "" && (n[0] == '-' || n[0] >= '0' && n[0] <= '9') {
+		return n
+	}
+	return ""
+}
@@ -0,0 +1,233 @@
+package go_playground
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// HTTPTaskType is the task type HTTPTasks handlers are usually registered
+// for
+const HTTPTaskType = "http"
+
+// HTTPTask is the payload of a task making an outbound HTTP call. URL,
+// header values and Body are text/template templates executed with the
+// task as .Task, its attempt as .Attempt and Vars as .Vars, plus a json
+// function encoding its argument
+type HTTPTask struct {
+	Method  string            `json:"method,omitempty"` // GET by default, POST with a body
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Vars    map[string]string `json:"vars,omitempty"`
+	// Timeout bounds the call, below the attempt timeout of the task
+	Timeout time.Duration `json:"timeout,omitzero"`
+	// SuccessStatus lists the statuses the call succeeds with, any 2xx
+	// when empty. RetryStatus adds statuses to retry to 408, 425, 429 and
+	// 5xx, other statuses failing the task for good
+	SuccessStatus []int `json:"success_status,omitempty"`
+	RetryStatus   []int `json:"retry_status,omitempty"`
+}
+
+// HTTPTasks configures the handler of HTTPTask tasks
+type HTTPTasks struct {
+	// Client sends the requests. Defaults to http.DefaultClient
+	Client *http.Client
+	// Timeout bounds calls whose task sets none. Defaults to 30s
+	Timeout time.Duration
+	// MaxResponseBytes of the response body kept as the task output,
+	// 64 KiB by default
+	MaxResponseBytes int64
+	// AllowedHosts restricts the hosts called, any host when empty. A
+	// leading dot allows the subdomains of a domain
+	AllowedHosts []string
+	// UserAgent sent unless the task sets one. Defaults to workerpool-http
+	UserAgent string
+}
+
+// httpTemplateData is what the templates of an HTTPTask see
+type httpTemplateData struct {
+	Task    Task
+	Attempt int
+	Vars    map[string]string
+}
+
+var httpTemplateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// HTTPTaskHandler returns the handler making the call described by the
+// HTTPTask payload of each task. 2xx responses succeed, their body becoming
+// the task output; 429 and 503 are retried no sooner than their
+// Retry-After; the traced and propagated headers of the task are forwarded
+func HTTPTaskHandler(cfg HTTPTasks) TaskHandler {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.MaxResponseBytes <= 0 {
+		cfg.MaxResponseBytes = 64 << 10
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = "workerpool-http"
+	}
+	return TypedHandler(JSONPayload[HTTPTask]{}, cfg.call)
+}
+
+// call makes one attempt of the call of t
+func (cfg HTTPTasks) call(ctx context.Context, ht HTTPTask, t Task) error {
+	req, err := cfg.request(ctx, ht, t)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, cmp.Or(ht.Timeout, cfg.Timeout))
+	defer cancel()
+	resp, err := cfg.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil && req.Context().Err() == nil {
+			return Retryable(fmt.Errorf("%s %s: timed out", req.Method, req.URL.Redacted()))
+		}
+		return Retryable(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, cfg.MaxResponseBytes))
+	if err != nil {
+		return Retryable(fmt.Errorf("reading the response: %w", err))
+	}
+	LoggerFrom(ctx).Debug("http task answered", "method", req.Method, "url", req.URL.Redacted(), "status", resp.StatusCode)
+	if err := classifyHTTPStatus(ht, resp); err != nil {
+		return err
+	}
+	SetOutput(ctx, string(body))
+	return nil
+}
+
+// request builds the request of the call from the templates of ht
+func (cfg HTTPTasks) request(ctx context.Context, ht HTTPTask, t Task) (*http.Request, error) {
+	data := httpTemplateData{Task: t, Attempt: t.Attempts, Vars: ht.Vars}
+	target, err := renderHTTPTemplate("url", ht.URL, data)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid url %q, want an absolute http or https URL", target)
+	}
+	if !cfg.allowed(u.Hostname()) {
+		return nil, fmt.Errorf("host %q is not allowed", u.Hostname())
+	}
+	body, err := renderHTTPTemplate("body", ht.Body, data)
+	if err != nil {
+		return nil, err
+	}
+	method := strings.ToUpper(ht.Method)
+	if method == "" {
+		method = http.MethodGet
+		if body != "" {
+			method = http.MethodPost
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == "" {
+		req.Body, req.ContentLength = http.NoBody, 0
+	}
+	for name, v := range PropagatedHeaders(ctx) {
+		req.Header[name] = v
+	}
+	// The attempt span, when traced, is the parent of the call
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	req.Header.Set("User-Agent", cfg.UserAgent)
+	for name, tmpl := range ht.Headers {
+		v, err := renderHTTPTemplate("headers."+name, tmpl, data)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(name, v)
+	}
+	return req, nil
+}
+
+// allowed reports whether host may be called
+func (cfg HTTPTasks) allowed(host string) bool {
+	if len(cfg.AllowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, h := range cfg.AllowedHosts {
+		h = strings.ToLower(h)
+		if host == h || strings.HasPrefix(h, ".") && (strings.HasSuffix(host, h) || host == h[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderHTTPTemplate executes the template named name, unknown vars
+// failing it
+func renderHTTPTemplate(name, text string, data httpTemplateData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := template.New(name).Funcs(httpTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// classifyHTTPStatus returns nil for a successful status, an error marked
+// for the retry policy otherwise
+func classifyHTTPStatus(ht HTTPTask, resp *http.Response) error {
+	code := resp.StatusCode
+	if slices.Contains(ht.SuccessStatus, code) || len(ht.SuccessStatus) == 0 && code >= 200 && code < 300 {
+		return nil
+	}
+	err := fmt.Errorf("%s %s answered %s", resp.Request.Method, resp.Request.URL.Redacted(), resp.Status)
+	switch {
+	case code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable:
+		if after := parseRetryAfter(resp.Header.Get("Retry-After")); after > 0 {
+			return Throttled(after, err)
+		}
+		return Retryable(err)
+	case code == http.StatusRequestTimeout, code == http.StatusTooEarly, code >= 500, slices.Contains(ht.RetryStatus, code):
+		return Retryable(err)
+	}
+	return Permanent(err)
+}
+
+// parseRetryAfter reads a Retry-After header, seconds or an HTTP date,
+// zero when absent or invalid
+func parseRetryAfter(v string) time.Duration {
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
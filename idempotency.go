@@ -0,0 +1,275 @@
+package go_playground
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultIdempotencyTTL is how long a submitted idempotency key is remembered
+const defaultIdempotencyTTL = time.Hour
+
+// maxIdempotencyKey bounds the length of an idempotency key
+const maxIdempotencyKey = 255
+
+// idempotencyKeys remembers the task created for each recent key so that
+// client retries do not enqueue it twice
+type idempotencyKeys struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	keys      map[string]*keyEntry
+	lastSweep time.Time
+}
+
+type keyEntry struct {
+	done    chan struct{} // closed once the first submission settles
+	task    Task
+	err     error
+	expires time.Time
+}
+
+// claim returns the entry for key, creating it when the key is new or
+// expired. The owner must call settle once the submission is done
+func (k *idempotencyKeys) claim(key string) (e *keyEntry, owner bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := time.Now()
+	k.sweep(now)
+	if e, ok := k.keys[key]; ok && (e.expires.IsZero() || now.Before(e.expires)) {
+		return e, false
+	}
+	if k.keys == nil {
+		k.keys = make(map[string]*keyEntry)
+	}
+	e = &keyEntry{done: make(chan struct{})}
+	k.keys[key] = e
+	return e, true
+}
+
+// settle records the outcome of the first submission. A failed one frees
+// the key so the client can try again
+func (k *idempotencyKeys) settle(key string, e *keyEntry, task Task, err error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	e.task, e.err = task, err
+	if err != nil {
+		delete(k.keys, key)
+	} else {
+		e.expires = time.Now().Add(k.ttl)
+	}
+	close(e.done)
+}
+
+// sweep drops expired keys
+func (k *idempotencyKeys) sweep(now time.Time) {
+	if now.Sub(k.lastSweep) < time.Minute {
+		return
+	}
+	k.lastSweep = now
+	for key, e := range k.keys {
+		if !e.expires.IsZero() && !now.Before(e.expires) {
+			delete(k.keys, key)
+		}
+	}
+}
+
+// deduplicates reports whether the task takes part in deduplication
+func (k *idempotencyKeys) deduplicates(t Task) bool {
+	return k.ttl > 0 && t.IdempotencyKey != ""
+}
+
+// submitOnce submits a task unless its idempotency key was seen within the
+// TTL, in which case the task created the first time is returned
+func (p *WorkerPool) submitOnce(task Task) (Task, error) {
+	for {
+		e, owner := p.idem.claim(task.IdempotencyKey)
+		if owner {
+			task, err := p.submit(task)
+			p.idem.settle(task.IdempotencyKey, e, task, err)
+			return task, err
+		}
+
+		<-e.done
+		if e.err == nil {
+			p.taskLogger(e.task).Info("duplicate submission", "idempotency_key", task.IdempotencyKey)
+			return e.task, nil
+		}
+	}
+}
+
+// IdempotentReplayHeader is set on responses replayed for a retried
+// submission, see WithIdempotentResponses
+const IdempotentReplayHeader = "Idempotent-Replayed"
+
+// maxCachedResponses and maxCachedBody bound the memory of the response
+// cache. Responses past them are served but not cached
+const (
+	maxCachedResponses = 100_000
+	maxCachedBody      = 1 << 20
+)
+
+// WithIdempotentResponses caches for ttl the response to each submission
+// carrying an Idempotency-Key, per client and route, so a client retrying
+// a POST that timed out gets the original status and body, with the same
+// task ID, marked by the Idempotent-Replayed header. A retry arriving while
+// the first request still runs waits for its response. Reusing a key with
+// another body gets 422. Server errors and 429 are not cached, the retry
+// running again
+func WithIdempotentResponses(ttl time.Duration) ServerOption {
+	return func(s *Server) {
+		if ttl > 0 {
+			s.responses = &responseCache{ttl: ttl, entries: make(map[string]*cachedResponse)}
+		}
+	}
+}
+
+// responseCache keeps the responses to recent idempotent submissions
+type responseCache struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*cachedResponse
+	lastSweep time.Time
+}
+
+type cachedResponse struct {
+	done        chan struct{} // closed once the first request has answered
+	fingerprint [sha256.Size]byte
+	status      int
+	header      http.Header
+	body        []byte
+	expires     time.Time
+}
+
+// claim returns the entry of key, creating it when the key is new or
+// expired. The owner must call settle, or drop when the response is not
+// to be kept
+func (c *responseCache) claim(key string, fp [sha256.Size]byte) (e *cachedResponse, owner bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if now.Sub(c.lastSweep) >= time.Minute {
+		c.lastSweep = now
+		for k, e := range c.entries {
+			if !e.expires.IsZero() && !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if e, ok := c.entries[key]; ok && (e.expires.IsZero() || now.Before(e.expires)) {
+		return e, false
+	}
+	e = &cachedResponse{done: make(chan struct{}), fingerprint: fp}
+	if len(c.entries) < maxCachedResponses {
+		c.entries[key] = e
+	}
+	return e, true
+}
+
+func (c *responseCache) settle(key string, e *cachedResponse, rec *responseRecorder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if rec.status >= 500 || rec.status == http.StatusTooManyRequests || rec.overflow {
+		delete(c.entries, key)
+	} else {
+		e.status, e.header, e.body = rec.status, rec.Header().Clone(), rec.body.Bytes()
+		e.expires = time.Now().Add(c.ttl)
+	}
+	close(e.done)
+}
+
+// responseRecorder passes a response through while copying it
+type responseRecorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool // past maxCachedBody
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if !r.overflow {
+		if r.body.Len()+len(b) > maxCachedBody {
+			r.overflow = true
+			r.body = bytes.Buffer{}
+		} else {
+			r.body.Write(b)
+		}
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// idempotent serves submissions through the response cache, see
+// WithIdempotentResponses
+func (s *Server) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyHeader)
+		if s.responses == nil || key == "" || len(key) > maxIdempotencyKey {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			badRequest(w, malformedBody(err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		h := sha256.New()
+		h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+		h.Write(body)
+		var fp [sha256.Size]byte
+		h.Sum(fp[:0])
+		scope := ClientID(r.Context()) + "\x00" + TenantID(r.Context()) + "\x00" + r.URL.Path + "\x00" + key
+
+		for {
+			e, owner := s.responses.claim(scope, fp)
+			if owner {
+				rec := &responseRecorder{ResponseWriter: w}
+				next.ServeHTTP(rec, r)
+				s.responses.settle(scope, e, rec)
+				return
+			}
+			select {
+			case <-e.done:
+			case <-r.Context().Done():
+				return
+			}
+			if e.expires.IsZero() {
+				// Not kept, this request runs on its own
+				continue
+			}
+			if e.fingerprint != fp {
+				writeErrorCode(w, http.StatusUnprocessableEntity, CodeIdempotencyMismatch, "idempotency key was used with another request", IdempotencyHeader)
+				return
+			}
+			for k, vs := range e.header {
+				if k != CorrelationHeader {
+					w.Header()[k] = vs
+				}
+			}
+			w.Header().Set(IdempotentReplayHeader, "true")
+			w.WriteHeader(e.status)
+			w.Write(e.body)
+			return
+		}
+	})
+}
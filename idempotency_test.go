@@ -0,0 +1,108 @@
+package go_playground
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubmitDeduplicatesIdempotencyKeys(t *testing.T) {
+	var runs atomic.Int64
+	p := NewTestPool(WithHandler(TaskHandlerFunc(func(context.Context, Task) error {
+		runs.Add(1)
+		return nil
+	})))
+	defer p.Shutdown(context.Background())
+
+	first, err := p.Submit(Task{IdempotencyKey: "order-1"})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	again, err := p.Submit(Task{IdempotencyKey: "order-1", Data: "changed"})
+	if err != nil {
+		t.Fatalf("Submit of a duplicate: %v", err)
+	}
+	if again.ID != first.ID || runs.Load() != 1 {
+		t.Errorf("duplicate got task %d after %d runs, want task %d run once", again.ID, runs.Load(), first.ID)
+	}
+	other, err := p.Submit(Task{IdempotencyKey: "order-2"})
+	if err != nil || other.ID == first.ID {
+		t.Errorf("another key got task %d, %v, want a new task", other.ID, err)
+	}
+}
+
+func TestSubmitDeduplicatesConcurrentSubmissions(t *testing.T) {
+	p := startPool(t, failing())
+	ids := make([]int, 10)
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Go(func() {
+			task, err := p.Submit(Task{IdempotencyKey: "once"})
+			if err != nil {
+				t.Errorf("Submit: %v", err)
+			}
+			ids[i] = task.ID
+		})
+	}
+	wg.Wait()
+	for _, id := range ids {
+		if id != ids[0] {
+			t.Fatalf("concurrent submissions got tasks %v, want one task", ids)
+		}
+	}
+}
+
+func TestSubmitFreesKeysOfFailedSubmissions(t *testing.T) {
+	var refuse atomic.Bool
+	refuse.Store(true)
+	p := NewTestPool(nopHandler(), WithValidator(func(Task) error {
+		if refuse.Load() {
+			return errBroken
+		}
+		return nil
+	}))
+	defer p.Shutdown(context.Background())
+
+	if _, err := p.Submit(Task{IdempotencyKey: "k"}); err == nil {
+		t.Fatal("Submit passed a refusing validator")
+	}
+	refuse.Store(false)
+	if task, err := p.Submit(Task{IdempotencyKey: "k"}); err != nil || task.ID == 0 {
+		t.Errorf("retried submission got task %d, %v, want a new task", task.ID, err)
+	}
+}
+
+func TestSubmitForgetsKeysAfterTheTTL(t *testing.T) {
+	p := NewTestPool(nopHandler(), WithIdempotencyTTL(time.Millisecond))
+	defer p.Shutdown(context.Background())
+	first, _ := p.Submit(Task{IdempotencyKey: "k"})
+	time.Sleep(5 * time.Millisecond)
+	if again, _ := p.Submit(Task{IdempotencyKey: "k"}); again.ID == first.ID {
+		t.Errorf("key still deduplicated to task %d after its TTL", first.ID)
+	}
+}
+
+func TestIdempotentResponsesReplay(t *testing.T) {
+	p := NewTestPool(nopHandler())
+	defer p.Shutdown(context.Background())
+	srv := NewServer(p, WithIdempotentResponses(time.Hour))
+	post := func(body string) *httptest.ResponseRecorder {
+		return serve(srv, http.MethodPost, "/event", body, "Content-Type", "application/json", IdempotencyHeader, "req-1")
+	}
+
+	first := post(`{"data":"a"}`)
+	if first.Code != http.StatusOK || first.Header().Get(IdempotentReplayHeader) != "" {
+		t.Fatalf("first response %d replayed %q, want 200 not replayed: %s", first.Code, first.Header().Get(IdempotentReplayHeader), first.Body)
+	}
+	again := post(`{"data":"a"}`)
+	if again.Code != first.Code || again.Body.String() != first.Body.String() || again.Header().Get(IdempotentReplayHeader) != "true" {
+		t.Errorf("retry got %d %s, want the replayed %d %s", again.Code, again.Body, first.Code, first.Body)
+	}
+	if other := post(`{"data":"b"}`); other.Code != http.StatusUnprocessableEntity {
+		t.Errorf("key reused with another body got %d, want 422", other.Code)
+	}
+}
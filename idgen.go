@@ -0,0 +1,210 @@
+package go_playground
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IDGenerator hands out task IDs. IDs are integers, as the HTTP paths, the
+// gRPC API and the queue backends use them, and must be positive. Snowflake
+// gives IDs unique across processes and sortable by time; a UIDGenerator
+// adds a ULID or UUID to every task besides
+type IDGenerator interface {
+	NextID() (int, error)
+}
+
+// UIDGenerator hands out the UIDs of tasks, see WithUIDGenerator. UIDs are
+// unique across processes and restarts without coordination
+type UIDGenerator interface {
+	NextUID() (string, error)
+}
+
+// sequence is the default IDGenerator: a counter local to the pool, kept
+// lock-free as every submission goes through it
+type sequence struct {
+	last atomic.Int64
+}
+
+func (s *sequence) NextID() (int, error) {
+	return int(s.last.Add(1)), nil
+}
+
+// Snowflake layout: 41 bits of milliseconds since snowflakeEpoch, 10 bits of
+// node and 12 bits of sequence within the millisecond
+const (
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+	// MaxSnowflakeNode is the highest node number of NewSnowflake
+	MaxSnowflakeNode = 1<<snowflakeNodeBits - 1
+)
+
+// snowflakeEpoch leaves room for 69 years of IDs
+var snowflakeEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Snowflake is an IDGenerator whose IDs sort by creation time and never
+// collide between processes with different node numbers, nor across
+// restarts of one process. IDs take 63 bits and need a 64-bit int
+type Snowflake struct {
+	node int64
+
+	mu  sync.Mutex
+	ms  int64 // timestamp of the last ID
+	seq int64
+}
+
+// NewSnowflake creates a generator for the given node, between 0 and
+// MaxSnowflakeNode. A negative node picks one at random, which is fine for
+// a handful of processes but may collide in large deployments
+func NewSnowflake(node int) (*Snowflake, error) {
+	if node > MaxSnowflakeNode {
+		return nil, fmt.Errorf("snowflake node %d above %d", node, MaxSnowflakeNode)
+	}
+	if node < 0 {
+		var b [2]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return nil, err
+		}
+		node = int(binary.BigEndian.Uint16(b[:]) & MaxSnowflakeNode)
+	}
+	return &Snowflake{node: int64(node)}, nil
+}
+
+// Node returns the node number embedded in the IDs
+func (s *Snowflake) Node() int {
+	return int(s.node)
+}
+
+// NextID implements IDGenerator. When the clock goes backwards IDs keep
+// counting from the last timestamp, so they stay increasing
+func (s *Snowflake) NextID() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms := max(time.Now().Sub(snowflakeEpoch).Milliseconds(), s.ms)
+	if ms == s.ms {
+		s.seq = (s.seq + 1) & (1<<snowflakeSeqBits - 1)
+		if s.seq == 0 {
+			// Sequence exhausted for this millisecond
+			time.Sleep(time.Millisecond)
+			ms = max(time.Now().Sub(snowflakeEpoch).Milliseconds(), s.ms+1)
+		}
+	} else {
+		s.seq = 0
+	}
+	s.ms = ms
+	return int(ms<<(snowflakeNodeBits+snowflakeSeqBits) | s.node<<snowflakeSeqBits | s.seq), nil
+}
+
+// SnowflakeTime returns when a Snowflake ID was generated
+func SnowflakeTime(id int) time.Time {
+	return snowflakeEpoch.Add(time.Duration(id>>(snowflakeNodeBits+snowflakeSeqBits)) * time.Millisecond)
+}
+
+// ULID is a UIDGenerator of ULIDs: 26 characters of Crockford base32
+// holding 48 bits of milliseconds and 80 random bits, sorting by time. The
+// IDs of one generator within a millisecond count up from its random bits,
+// so they sort in order of creation as well
+type ULID struct {
+	mu sync.Mutex
+	ms int64  // timestamp of the last ID
+	hi uint16 // random bits of the last ID
+	lo uint64
+}
+
+// NewULID creates a ULID generator
+func NewULID() *ULID {
+	return &ULID{}
+}
+
+// crockford is the alphabet of ULIDs, without I, L, O and U
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NextUID implements UIDGenerator. When the clock goes backwards IDs keep
+// the last timestamp, so they stay increasing
+func (g *ULID) NextUID() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := max(time.Now().UnixMilli(), g.ms)
+	if ms == g.ms {
+		g.lo++
+		if g.lo == 0 {
+			g.hi++
+			if g.hi == 0 {
+				return "", errors.New("ulid: random bits exhausted within a millisecond")
+			}
+		}
+	} else {
+		var b [10]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return "", err
+		}
+		g.hi, g.lo = binary.BigEndian.Uint16(b[:2]), binary.BigEndian.Uint64(b[2:])
+	}
+	g.ms = ms
+
+	// 128 bits in 26 characters of 5 bits, the first taking the top 3
+	hi, lo := uint64(ms)<<16|uint64(g.hi), g.lo
+	var id [26]byte
+	for i := range id {
+		shift := uint(5 * (25 - i))
+		var v uint64
+		switch {
+		case shift >= 64:
+			v = hi >> (shift - 64)
+		case shift == 0:
+			v = lo
+		default:
+			v = lo>>shift | hi<<(64-shift)
+		}
+		id[i] = crockford[v&31]
+	}
+	return string(id[:]), nil
+}
+
+// UUIDv7 is a UIDGenerator of version 7 UUIDs, RFC 9562: 48 bits of
+// milliseconds, a 12-bit counter within the millisecond and 62 random bits,
+// sorting by time
+type UUIDv7 struct {
+	mu  sync.Mutex
+	ms  int64 // timestamp of the last ID
+	seq uint16
+}
+
+// NewUUIDv7 creates a UUIDv7 generator
+func NewUUIDv7() *UUIDv7 {
+	return &UUIDv7{}
+}
+
+// NextUID implements UIDGenerator. Past 4096 IDs in a millisecond, or when
+// the clock goes backwards, the timestamp runs ahead of the clock so IDs
+// stay increasing
+func (g *UUIDv7) NextUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[8:]); err != nil {
+		return "", err
+	}
+	g.mu.Lock()
+	ms := max(time.Now().UnixMilli(), g.ms)
+	if ms == g.ms {
+		g.seq++
+		if g.seq > 0xfff {
+			ms++
+			g.seq = 0
+		}
+	} else {
+		g.seq = 0
+	}
+	g.ms = ms
+	seq := g.seq
+	g.mu.Unlock()
+
+	binary.BigEndian.PutUint64(b[:8], uint64(ms)<<16|0x7000|uint64(seq))
+	b[8] = b[8]&0x3f | 0x80 // RFC 9562 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
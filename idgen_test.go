@@ -0,0 +1,143 @@
+package go_playground
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSnowflakeIDsIncreaseAndEmbedNode(t *testing.T) {
+	s, err := NewSnowflake(42)
+	if err != nil {
+		t.Fatalf("NewSnowflake: %v", err)
+	}
+	before := time.Now().Add(-time.Millisecond)
+	last := 0
+	// More than the sequence of one millisecond holds
+	for range 3 << snowflakeSeqBits {
+		id, err := s.NextID()
+		if err != nil {
+			t.Fatalf("NextID: %v", err)
+		}
+		if id <= last {
+			t.Fatalf("ID %d after %d, want increasing IDs", id, last)
+		}
+		if node := id >> snowflakeSeqBits & MaxSnowflakeNode; node != 42 {
+			t.Fatalf("ID %d carries node %d, want 42", id, node)
+		}
+		last = id
+	}
+	if at := SnowflakeTime(last); at.Before(before) || at.After(time.Now().Add(time.Millisecond)) {
+		t.Errorf("SnowflakeTime = %v, want about now", at)
+	}
+}
+
+func TestSnowflakeNodesDoNotCollide(t *testing.T) {
+	seen := make(map[int]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for node := range 4 {
+		s, err := NewSnowflake(node)
+		if err != nil {
+			t.Fatalf("NewSnowflake(%d): %v", node, err)
+		}
+		wg.Go(func() {
+			for range 1000 {
+				id, _ := s.NextID()
+				mu.Lock()
+				if seen[id] {
+					t.Errorf("ID %d handed out twice", id)
+				}
+				seen[id] = true
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func TestNewSnowflakeRejectsLargeNodes(t *testing.T) {
+	if _, err := NewSnowflake(MaxSnowflakeNode + 1); err == nil {
+		t.Error("NewSnowflake accepted a node above MaxSnowflakeNode")
+	}
+	s, err := NewSnowflake(-1)
+	if err != nil || s.Node() < 0 || s.Node() > MaxSnowflakeNode {
+		t.Errorf("NewSnowflake(-1) = node %v, %v, want a random valid node", s, err)
+	}
+}
+
+// uidsIncrease draws more IDs from g than a millisecond holds and checks
+// each sorts after the one before, returning the last
+func uidsIncrease(t *testing.T, g UIDGenerator, valid *regexp.Regexp) string {
+	t.Helper()
+	last := ""
+	for range 3 * 4096 {
+		uid, err := g.NextUID()
+		if err != nil {
+			t.Fatalf("NextUID: %v", err)
+		}
+		if !valid.MatchString(uid) {
+			t.Fatalf("UID %q, want one matching %s", uid, valid)
+		}
+		if uid <= last {
+			t.Fatalf("UID %s after %s, want increasing UIDs", uid, last)
+		}
+		last = uid
+	}
+	return last
+}
+
+func TestULIDsIncreaseAndEmbedTime(t *testing.T) {
+	before := time.Now().UnixMilli()
+	last := uidsIncrease(t, NewULID(), regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`))
+	var ms int64
+	for _, c := range last[:10] {
+		ms = ms<<5 | int64(strings.IndexRune(crockford, c))
+	}
+	if ms < before || ms > time.Now().UnixMilli() {
+		t.Errorf("ULID %s made at %d ms, want between %d and now", last, ms, before)
+	}
+}
+
+func TestUUIDv7sIncreaseAndEmbedTime(t *testing.T) {
+	before := time.Now().UnixMilli()
+	last := uidsIncrease(t, NewUUIDv7(), regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+	ms, err := strconv.ParseInt(strings.ReplaceAll(last[:13], "-", ""), 16, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Past 4096 UUIDs a millisecond the timestamp may run a little ahead
+	if ms < before || ms > time.Now().UnixMilli()+3 {
+		t.Errorf("UUID %s made at %d ms, want between %d and now", last, ms, before)
+	}
+}
+
+func TestSubmitStampsUIDs(t *testing.T) {
+	p := newPool(t, WithUIDGenerator(NewULID()))
+	tasks := submit(t, p, Task{}, Task{UID: "kept"})
+	batch, err := p.SubmitBatch([]Task{{}, {}})
+	if err != nil {
+		t.Fatalf("SubmitBatch: %v", err)
+	}
+	uids := map[string]bool{}
+	for _, task := range append(tasks, batch...) {
+		if len(task.UID) != 26 && task.UID != "kept" {
+			t.Errorf("task %d got UID %q, want a ULID", task.ID, task.UID)
+		}
+		uids[task.UID] = true
+	}
+	if len(uids) != 4 || !uids["kept"] {
+		t.Errorf("UIDs %v, want 4 distinct ones, kept included", uids)
+	}
+
+	recs, err := p.Tasks(TaskQuery{UID: tasks[0].UID})
+	if err != nil || len(recs) != 1 || recs[0].ID != tasks[0].ID {
+		t.Errorf("Tasks of UID %s = %v, %v, want task %d", tasks[0].UID, recs, err, tasks[0].ID)
+	}
+	if submit(t, newPool(t), Task{})[0].UID != "" {
+		t.Error("task got a UID without WithUIDGenerator")
+	}
+}
@@ -0,0 +1,112 @@
+package go_playground
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ConcurrencyLimit bounds the submissions being served at once, protecting
+// the enqueue path itself from clients that open many slow requests, such
+// as large batches or submissions waiting for their task
+type ConcurrencyLimit struct {
+	Global    int // submissions in flight across clients, unlimited when zero
+	PerClient int // submissions in flight per client, unlimited when zero
+	// Key identifies the client. Defaults to ClientKey
+	Key func(*http.Request) string
+	// RetryAfter is advertised to refused clients, 1s by default
+	RetryAfter time.Duration
+}
+
+// WithConcurrencyLimit answers submissions past the limits with 503 and
+// Retry-After
+func WithConcurrencyLimit(c ConcurrencyLimit) ServerOption {
+	return func(s *Server) {
+		if c.Global > 0 || c.PerClient > 0 {
+			s.inflight = newInflightLimiter(c)
+		}
+	}
+}
+
+// inflightLimiter counts the submissions being served
+type inflightLimiter struct {
+	cfg ConcurrencyLimit
+
+	mu      sync.Mutex
+	total   int
+	clients map[string]int // only clients with requests in flight
+
+	rejected *prometheus.CounterVec
+}
+
+func newInflightLimiter(cfg ConcurrencyLimit) *inflightLimiter {
+	if cfg.Key == nil {
+		cfg.Key = ClientKey
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = time.Second
+	}
+	return &inflightLimiter{
+		cfg:     cfg,
+		clients: make(map[string]int),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workerpool_http_inflight_rejected_total",
+			Help: "Submissions refused for too many in flight, by limit hit.",
+		}, []string{"limit"}),
+	}
+}
+
+func (l *inflightLimiter) register(reg prometheus.Registerer) {
+	var are prometheus.AlreadyRegisteredError
+	if err := reg.Register(l.rejected); errors.As(err, &are) {
+		l.rejected = are.ExistingCollector.(*prometheus.CounterVec)
+	}
+}
+
+// acquire takes a slot for key, returning the limit hit when there is none
+func (l *inflightLimiter) acquire(key string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cfg.Global > 0 && l.total >= l.cfg.Global {
+		return "global", false
+	}
+	if l.cfg.PerClient > 0 && l.clients[key] >= l.cfg.PerClient {
+		return "client", false
+	}
+	l.total++
+	l.clients[key]++
+	return "", true
+}
+
+func (l *inflightLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	if l.clients[key]--; l.clients[key] <= 0 {
+		delete(l.clients, key)
+	}
+}
+
+// serve refuses requests past the limits with 503 and passes the others
+// to next
+func (l *inflightLimiter) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	key := l.cfg.Key(r)
+	limit, ok := l.acquire(key)
+	if !ok {
+		l.rejected.WithLabelValues(limit).Inc()
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(l.cfg.RetryAfter.Seconds()))))
+		msg := "too many submissions in flight"
+		if limit == "client" {
+			msg = "too many submissions in flight for this client"
+		}
+		writeError(w, http.StatusServiceUnavailable, msg, "")
+		return
+	}
+	defer l.release(key)
+	next.ServeHTTP(w, r)
+}
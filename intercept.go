@@ -0,0 +1,89 @@
+package go_playground
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// ErrTaskDropped is returned for submissions an Interceptor dropped
+var ErrTaskDropped = errors.New("task dropped by an interceptor")
+
+// Interceptor transforms a task on submission, before it is validated and
+// enqueued. It returns the tasks to enqueue in its place: the task itself,
+// enriched or normalized, several tasks to split it, or none to drop it.
+// An error rejects the submission; return a *ValidationError to point at
+// the fields at fault. ctx carries the HTTP request of submissions made
+// through the API, see SubmitRequest
+type Interceptor func(ctx context.Context, t Task) ([]Task, error)
+
+// WithInterceptor runs every submitted task through ic, after the
+// interceptors given earlier, each task returned by one going through the
+// next. Retries, requeues, replays and imported snapshots are not
+// intercepted again
+func WithInterceptor(ic Interceptor) Option {
+	return func(p *WorkerPool) {
+		p.interceptors = append(p.interceptors, ic)
+	}
+}
+
+// Transform returns an interceptor applying fn to every task, for the
+// common case of enriching or normalizing without splitting
+func Transform(fn func(ctx context.Context, t *Task) error) Interceptor {
+	return func(ctx context.Context, t Task) ([]Task, error) {
+		if err := fn(ctx, &t); err != nil {
+			return nil, err
+		}
+		return []Task{t}, nil
+	}
+}
+
+// requestKey is the context key of the HTTP request a submission came in
+type requestKey struct{}
+
+// SubmitRequest returns the HTTP request of a submission made through the
+// API, for interceptors reading its client address or headers
+func SubmitRequest(ctx context.Context) (*http.Request, bool) {
+	r, ok := ctx.Value(requestKey{}).(*http.Request)
+	return r, ok
+}
+
+// submitContext is the context the server submits the tasks of r with
+func submitContext(r *http.Request) context.Context {
+	return context.WithValue(r.Context(), requestKey{}, r)
+}
+
+// intercept runs tasks through the interceptors of the pool. Tasks split
+// in several that kept the idempotency key of their original get it
+// suffixed with their position, so they are not taken for duplicates
+func (p *WorkerPool) intercept(ctx context.Context, tasks []Task) ([]Task, error) {
+	for _, ic := range p.interceptors {
+		var next []Task
+		for _, t := range tasks {
+			out, err := ic(ctx, t)
+			if err != nil {
+				var ve *ValidationError
+				if !errors.As(err, &ve) {
+					err = fmt.Errorf("intercepting task: %w", err)
+				}
+				return nil, err
+			}
+			if len(out) > 1 && t.IdempotencyKey != "" {
+				for i := range out {
+					if out[i].IdempotencyKey == t.IdempotencyKey {
+						out[i].IdempotencyKey += "/" + strconv.Itoa(i)
+					}
+				}
+			}
+			next = append(next, out...)
+		}
+		tasks = next
+	}
+	if len(tasks) == 0 {
+		p.log.Debug("submission dropped by an interceptor")
+		return nil, ErrTaskDropped
+	}
+	return tasks, nil
+}
@@ -0,0 +1,92 @@
+// Package kafkasource is a pool.Source reading tasks from a Kafka topic
+package kafkasource
+
+import (
+	"context"
+	"log/slog"
+
+	pool "playground"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Options configures a Source
+type Options struct {
+	Brokers []string
+	Topic   string
+	// GroupID is the consumer group, whose members share the partitions
+	// of the topic and its committed offsets
+	GroupID string
+	// Logger receives dropped messages. Defaults to slog.Default()
+	Logger *slog.Logger
+}
+
+// Source consumes a topic in a consumer group. Offsets are committed once
+// a message is queued, so messages fetched but not queued before a crash
+// or shutdown are delivered again
+type Source struct {
+	opts Options
+}
+
+// New creates a source. Nothing connects until Run
+func New(opts Options) *Source {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return &Source{opts: opts}
+}
+
+// Name implements pool.Source
+func (s *Source) Name() string {
+	return "kafka:" + s.opts.Topic
+}
+
+// Run implements pool.Source
+func (s *Source) Run(ctx context.Context, submit func(context.Context, pool.Task) error) error {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: s.opts.Brokers,
+		Topic:   s.opts.Topic,
+		GroupID: s.opts.GroupID,
+	})
+	defer r.Close()
+
+	for {
+		m, err := r.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		task, err := pool.DecodeMessage(m.Value, header(m))
+		if err == nil {
+			err = submit(ctx, task)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			s.opts.Logger.Warn("kafkasource: dropping message",
+				"partition", m.Partition, "offset", m.Offset, "error", err)
+		}
+		if err := r.CommitMessages(ctx, m); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// header looks up message headers by name
+func header(m kafka.Message) func(string) string {
+	return func(name string) string {
+		for _, h := range m.Headers {
+			if h.Key == name {
+				return string(h.Value)
+			}
+		}
+		return ""
+	}
+}
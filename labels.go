@@ -0,0 +1,317 @@
+package go_playground
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Label limits, keeping the labels stored with every task record small
+const (
+	maxLabels     = 32
+	maxLabelKey   = 63
+	maxLabelValue = 255
+)
+
+// checkLabels validates the labels of an event request. Keys cannot hold
+// the colon separating them from values in queries
+func checkLabels(labels map[string]string) error {
+	if len(labels) > maxLabels {
+		return &badRequestError{field: "labels", msg: fmt.Sprintf("at most %d labels are allowed", maxLabels)}
+	}
+	for k, v := range labels {
+		switch {
+		case k == "" || len(k) > maxLabelKey || strings.Contains(k, ":"):
+			return &badRequestError{field: "labels", msg: fmt.Sprintf("invalid label key %q, want 1 to %d bytes without a colon", k, maxLabelKey)}
+		case len(v) > maxLabelValue:
+			return &badRequestError{field: "labels." + k, msg: fmt.Sprintf("label values must be at most %d bytes", maxLabelValue)}
+		}
+	}
+	return nil
+}
+
+// ErrQueryUnsupported is returned by Tasks and the bulk operations when
+// the task store cannot be searched, see TaskLister
+var ErrQueryUnsupported = errors.New("task store cannot be queried")
+
+// TaskQuery selects task records. Empty fields match every record
+type TaskQuery struct {
+	Labels map[string]string // every one must be carried by the task
+	State  TaskState
+	Type   string
+	Tenant string
+	Queue  string // the queue the task was submitted to, default for unnamed pools
+	UID    string // see WithUIDGenerator
+	// Since and Until bound the time the task was last queued, Until
+	// excluded
+	Since time.Time
+	Until time.Time
+	// After resumes a listing past the task of this ID: records with a
+	// higher ID, or a lower one with Desc
+	After int
+	Desc  bool // lists by descending ID, newest first
+	Limit int  // records returned at most, no limit when zero
+}
+
+// Matches reports whether rec passes the query
+func (q TaskQuery) Matches(rec TaskRecord) bool {
+	if (q.State != "" && rec.State != q.State) ||
+		(q.Type != "" && rec.Type != q.Type) ||
+		(q.Tenant != "" && rec.Tenant != q.Tenant) ||
+		(q.Queue != "" && cmp.Or(rec.Queue, "default") != q.Queue) ||
+		(q.UID != "" && rec.UID != q.UID) ||
+		!inRange(rec.QueuedAt, q.Since, q.Until) {
+		return false
+	}
+	if q.After > 0 && (q.Desc && rec.ID >= q.After || !q.Desc && rec.ID <= q.After) {
+		return false
+	}
+	for k, v := range q.Labels {
+		if got, ok := rec.Labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// TaskLister is implemented by task stores that can be searched, such as
+// MemoryStore
+type TaskLister interface {
+	// List returns the records matching q by ascending ID, or descending
+	// with q.Desc
+	List(q TaskQuery) ([]TaskRecord, error)
+}
+
+// List implements TaskLister
+func (s *MemoryStore) List(q TaskQuery) ([]TaskRecord, error) {
+	s.mu.RLock()
+	var recs []TaskRecord
+	for _, rec := range s.records {
+		if q.Matches(rec) {
+			recs = append(recs, rec)
+		}
+	}
+	s.mu.RUnlock()
+	slices.SortFunc(recs, func(a, b TaskRecord) int {
+		if q.Desc {
+			return cmp.Compare(b.ID, a.ID)
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	if q.Limit > 0 && len(recs) > q.Limit {
+		recs = recs[:q.Limit]
+	}
+	return recs, nil
+}
+
+// Tasks returns the records of the pool matching q by ascending ID, or
+// descending with q.Desc. Pass the ID of the last record as q.After to get
+// the next page
+func (p *WorkerPool) Tasks(q TaskQuery) ([]TaskRecord, error) {
+	l, ok := p.store.(TaskLister)
+	if !ok {
+		return nil, ErrQueryUnsupported
+	}
+	return l.List(q)
+}
+
+// BulkResult lists the tasks a bulk operation acted on
+type BulkResult struct {
+	Tasks []BulkTask `json:"tasks"`
+}
+
+// BulkTask is a task a bulk operation acted on, Error telling why it
+// failed for this one
+type BulkTask struct {
+	ID    int    `json:"id"`
+	Error string `json:"error,omitempty"`
+}
+
+// CancelTasks cancels the queued and running tasks matching q, as Cancel.
+// Finished tasks are left out, whatever the state of q
+func (p *WorkerPool) CancelTasks(q TaskQuery) (BulkResult, error) {
+	return p.bulk(q, cancelableRecord, func(rec TaskRecord) error {
+		return p.Cancel(rec.ID)
+	})
+}
+
+// cancelableRecord selects the records of the tasks CancelTasks cancels
+func cancelableRecord(rec TaskRecord) bool { return !rec.State.Terminal() }
+
+// RetryTasks queues again the failed tasks matching q with a fresh
+// attempt count, keeping their ID. Dead letters leave the dead-letter queue
+// like with RetryDeadLetter
+func (p *WorkerPool) RetryTasks(q TaskQuery) (BulkResult, error) {
+	return p.bulk(q, func(rec TaskRecord) bool { return rec.State == StateFailed }, func(rec TaskRecord) error {
+		if _, err := p.RetryDeadLetter(rec.ID); !errors.Is(err, ErrTaskNotFound) {
+			return err
+		}
+		// Failed without reaching the dead-letter queue, such as expired
+		// tasks
+		task := rec.Task
+		task.Attempts = 0
+		return p.enqueue(task)
+	})
+}
+
+// bulk applies op to the records matching q that want selects, up to the
+// limit of q
+func (p *WorkerPool) bulk(q TaskQuery, want func(TaskRecord) bool, op func(TaskRecord) error) (BulkResult, error) {
+	limit := q.Limit
+	q.Limit = 0
+	recs, err := p.Tasks(q)
+	if err != nil {
+		return BulkResult{}, err
+	}
+	res := BulkResult{Tasks: []BulkTask{}}
+	for _, rec := range recs {
+		if !want(rec) {
+			continue
+		}
+		if limit > 0 && len(res.Tasks) == limit {
+			break
+		}
+		bt := BulkTask{ID: rec.ID}
+		if err := op(rec); err != nil {
+			bt.Error = err.Error()
+		}
+		res.Tasks = append(res.Tasks, bt)
+	}
+	return res, nil
+}
+
+// hasFilter refuses a bulk operation on every task with 400, reporting
+// whether q has a filter
+func hasFilter(w http.ResponseWriter, q TaskQuery) bool {
+	if len(q.Labels) == 0 && q.State == "" && q.Type == "" && q.Tenant == "" && q.UID == "" && q.Since.IsZero() && q.Until.IsZero() {
+		writeError(w, http.StatusBadRequest, "at least one of label, status, type, tenant, uid, since, until or older_than is required", "")
+		return false
+	}
+	return true
+}
+
+// parseTaskQuery reads the label, status, type, tenant, queue, uid, since,
+// until, older_than and limit query parameters. Labels are key:value, every
+// label parameter having to match; older_than is a duration moving until
+// back to that long ago
+func parseTaskQuery(r *http.Request, defaultLimit int) (TaskQuery, error) {
+	v := r.URL.Query()
+	q := TaskQuery{
+		State:  TaskState(v.Get("status")),
+		Type:   v.Get("type"),
+		Tenant: v.Get("tenant"),
+		Queue:  v.Get("queue"),
+		UID:    v.Get("uid"),
+	}
+	switch q.State {
+	case "", StateQueued, StateRunning, StateSucceeded, StateFailed, StateCanceled:
+	default:
+		return q, &badRequestError{field: "status", msg: fmt.Sprintf("invalid status %q", q.State)}
+	}
+	for _, l := range v["label"] {
+		key, value, ok := strings.Cut(l, ":")
+		if !ok || key == "" {
+			return q, &badRequestError{field: "label", msg: fmt.Sprintf("invalid label %q, want key:value", l)}
+		}
+		if q.Labels == nil {
+			q.Labels = make(map[string]string)
+		}
+		q.Labels[key] = value
+	}
+	var err error
+	if q.Since, q.Until, err = parseTimeRange(r); err != nil {
+		return q, err
+	}
+	if s := v.Get("older_than"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return q, &badRequestError{field: "older_than", msg: fmt.Sprintf("invalid duration %q", s)}
+		}
+		if until := time.Now().Add(-d); q.Until.IsZero() || until.Before(q.Until) {
+			q.Until = until
+		}
+	}
+	q.Limit, err = parseLimit(r, defaultLimit)
+	return q, err
+}
+
+// listTasksHandler serves GET /events, a page of records sorted by ID
+func (s *Server) listTasksHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	q, err := parseTaskQuery(r, defaultPageLimit)
+	if err == nil {
+		_, q.Desc, err = parseSort(r, "id")
+	}
+	var cursor []string
+	if err == nil {
+		cursor, err = decodeCursor(r, "tasks", 2)
+	}
+	if cursor != nil {
+		after, aerr := strconv.Atoi(cursor[1])
+		if aerr != nil || cursor[0] != strconv.FormatBool(q.Desc) {
+			err = &badRequestError{field: "cursor", msg: "cursor of another sort order"}
+		}
+		q.After = after
+	}
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	limit := q.Limit
+	q.Limit++ // one more tells whether a page follows
+	recs, err := p.Tasks(q)
+	switch {
+	case errors.Is(err, ErrQueryUnsupported):
+		writeError(w, http.StatusNotImplemented, err.Error(), "")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	for i := range recs {
+		// Served by GET /event/{id}/logs
+		recs[i].Logs, recs[i].LogsDropped = nil, 0
+	}
+	if len(recs) > limit {
+		recs = recs[:limit]
+		setNextPage(w, r, encodeCursor("tasks", strconv.FormatBool(q.Desc), strconv.Itoa(recs[limit-1].ID)))
+	}
+	if recs == nil {
+		recs = []TaskRecord{}
+	}
+	writeJSON(w, http.StatusOK, recs)
+}
+
+// bulkTasksHandler serves POST /events/retry, which needs a filter so a
+// bare request does not act on every task. POST /events/cancel is
+// confirmed first, see confirmedBulkHandler
+func (s *Server) bulkTasksHandler(action string, op func(*WorkerPool, TaskQuery) (BulkResult, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := s.target(w, r, "")
+		if !ok {
+			return
+		}
+		q, err := parseTaskQuery(r, 0)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		if !hasFilter(w, q) {
+			return
+		}
+		res, err := op(p, q)
+		if !bulkQueryOK(w, err) {
+			return
+		}
+		s.audit(r, p, action, map[string]any{"query": r.URL.RawQuery, "tasks": len(res.Tasks)}, nil)
+		writeJSON(w, http.StatusOK, res)
+	}
+}
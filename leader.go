@@ -0,0 +1,83 @@
+package go_playground
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Elector picks one leader among the processes sharing a backend, such as
+// redisqueue.Elector. Leadership is a lease that lapses unless renewed
+type Elector interface {
+	// Acquire takes or renews the lease for ttl and reports whether this
+	// process holds it
+	Acquire(ctx context.Context, ttl time.Duration) (bool, error)
+	// Release gives the lease up if this process holds it
+	Release(ctx context.Context) error
+}
+
+// LeaderElection makes recurring schedules fire on the leader only, so
+// several processes registering the same schedules against a shared
+// backend submit each occurrence once. Delayed tasks are not affected
+type LeaderElection struct {
+	Elector Elector
+	TTL     time.Duration // lease length, 15s by default; renewed every TTL/3
+}
+
+// DefaultLeaderTTL is the lease length unless LeaderElection.TTL is set
+const DefaultLeaderTTL = 15 * time.Second
+
+// leadership tracks the lease of this process
+type leadership struct {
+	cfg   LeaderElection
+	until atomic.Int64 // Unix nanoseconds the lease is known to last until
+}
+
+// IsLeader reports whether this process holds the leader lease, always
+// true without WithLeaderElection
+func (p *WorkerPool) IsLeader() bool {
+	if p.leader == nil {
+		return true
+	}
+	return time.Now().UnixNano() < p.leader.until.Load()
+}
+
+// campaign renews the lease, or tries to take it, until the pool shuts
+// down and then releases it
+func (p *WorkerPool) campaign() {
+	l := p.leader
+	ticker := time.NewTicker(l.cfg.TTL / 3)
+	defer ticker.Stop()
+	for {
+		// Counted from before the request, so the lease is never believed
+		// to last longer than the backend keeps it
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(p.ctx, l.cfg.TTL/3)
+		ok, err := l.cfg.Elector.Acquire(ctx, l.cfg.TTL)
+		cancel()
+		was := p.IsLeader()
+		switch {
+		case err != nil:
+			p.log.Warn("leader election: renewing lease", "error", err)
+		case ok:
+			l.until.Store(start.Add(l.cfg.TTL).UnixNano())
+		default:
+			l.until.Store(0)
+		}
+		if is := p.IsLeader(); is != was {
+			p.log.Info("leader election: leadership changed", "leader", is)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-p.quit:
+			l.until.Store(0)
+			ctx, cancel := context.WithTimeout(context.Background(), l.cfg.TTL/3)
+			if err := l.cfg.Elector.Release(ctx); err != nil {
+				p.log.Warn("leader election: releasing lease", "error", err)
+			}
+			cancel()
+			return
+		}
+	}
+}
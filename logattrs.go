@@ -0,0 +1,57 @@
+package go_playground
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"slices"
+	"time"
+)
+
+// lazyAttrs is a slog.Handler adding attributes to the records it handles.
+// The built-in handlers format the attributes given to With up front, which
+// costs every task its log lines even when their level is disabled
+type lazyAttrs struct {
+	slog.Handler
+	attrs []slog.Attr
+	fixed [3]slog.Attr // backs attrs for taskLogger, saving an allocation
+}
+
+func (h *lazyAttrs) Handle(ctx context.Context, r slog.Record) error {
+	// The attributes go first, as With would have put them
+	rec := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	rec.AddAttrs(h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		rec.AddAttrs(a)
+		return true
+	})
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h *lazyAttrs) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &lazyAttrs{Handler: h.Handler, attrs: append(slices.Clip(h.attrs), attrs...)}
+}
+
+// WithGroup applies the attributes for good, as they stay outside the group
+func (h *lazyAttrs) WithGroup(name string) slog.Handler {
+	return h.Handler.WithAttrs(h.attrs).WithGroup(name)
+}
+
+// logTask logs a line about a task as taskLogger(t) would, without
+// building a logger, for the lines of every task such as "task enqueued"
+func (p *WorkerPool) logTask(t Task, level slog.Level, msg string, attrs ...slog.Attr) {
+	ctx := context.Background()
+	h := p.log.Handler()
+	if !h.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(2, pcs[:]) // the caller, for handlers adding the source
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.AddAttrs(slog.Int("task_id", t.ID))
+	if t.CorrelationID != "" {
+		r.AddAttrs(slog.String("correlation_id", t.CorrelationID))
+	}
+	r.AddAttrs(attrs...)
+	_ = h.Handle(ctx, r)
+}
@@ -0,0 +1,388 @@
+package go_playground
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// poolMetrics holds the Prometheus instruments updated by the pool
+type poolMetrics struct {
+	registry *prometheus.Registry
+
+	enqueued  prometheus.Counter
+	processed prometheus.Counter
+	failures  prometheus.Counter
+	retries   prometheus.Counter
+	shed      *prometheus.CounterVec
+	panics    prometheus.Counter
+	duration  prometheus.Histogram
+
+	expired            prometheus.Counter
+	circuitTrips       prometheus.Counter
+	webhooksDelivered  prometheus.Counter
+	webhooksFailed     prometheus.Counter
+	evicted            *prometheus.CounterVec
+	stuck              prometheus.Counter
+	rejected           prometheus.Counter
+	typeHeld           *prometheus.CounterVec
+	tenantHeld         *prometheus.CounterVec
+	tenantRefused      *prometheus.CounterVec
+	partitionHeld      prometheus.Counter
+	capacityHeld       prometheus.Counter
+	stolen             prometheus.Counter
+	archivedRecords    prometheus.Counter
+	archiveFiles       prometheus.Counter
+	archiveFailures    prometheus.Counter
+	archiveDropped     prometheus.Counter
+	duplicates         prometheus.Counter
+	chaosFaults        *prometheus.CounterVec
+	storageRefused     *prometheus.CounterVec
+	storageEvicted     prometheus.Counter
+	notifications      *prometheus.CounterVec
+	migrated           *prometheus.CounterVec
+	budgetDeferred     prometheus.Counter
+	dryRuns            *prometheus.CounterVec
+	dependencyFailed   prometheus.Counter
+	hedged             *prometheus.CounterVec
+	cpuTime            *prometheus.CounterVec
+	slaLatency         *prometheus.GaugeVec
+	slaBreached        *prometheus.GaugeVec
+	slaAlerts          *prometheus.CounterVec
+	recoveryIssues     *prometheus.CounterVec
+	deadLettersDropped prometheus.Counter
+}
+
+func newPoolMetrics(p *WorkerPool, reg *prometheus.Registry) *poolMetrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+		reg.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	}
+
+	m := &poolMetrics{
+		registry: reg,
+		enqueued: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_tasks_enqueued_total",
+			Help: "Tasks accepted onto the queue.",
+		}),
+		processed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_tasks_processed_total",
+			Help: "Handler runs that completed, successfully or not.",
+		}),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_tasks_failed_total",
+			Help: "Handler runs that returned an error.",
+		}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_tasks_retried_total",
+			Help: "Failed handler runs that were scheduled for another attempt.",
+		}),
+		shed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workerpool_tasks_shed_total",
+			Help: "Tasks dropped by the overflow policy of a full queue, by whether they were queued or incoming.",
+		}, []string{"task"}),
+		panics: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_worker_panics_total",
+			Help: "Handler panics recovered by restarting the worker.",
+		}),
+		expired: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_tasks_expired_total",
+			Help: "Tasks dropped because they were still queued past their expiry.",
+		}),
+		circuitTrips: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_circuit_trips_total",
+			Help: "Times the circuit breaker opened.",
+		}),
+		webhooksDelivered: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_webhooks_delivered_total",
+			Help: "Task results accepted by their callback URL.",
+		}),
+		webhooksFailed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_webhooks_failed_total",
+			Help: "Task results that could not be delivered to their callback URL.",
+		}),
+		evicted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workerpool_task_records_evicted_total",
+			Help: "Finished task records dropped by the retention policy, by reason.",
+		}, []string{"reason"}),
+		stuck: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_tasks_stuck_total",
+			Help: "Running tasks flagged by the watchdog for missing heartbeats.",
+		}),
+		rejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_tasks_rejected_total",
+			Help: "Submitted tasks refused by a validator.",
+		}),
+		typeHeld: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workerpool_tasks_type_held_total",
+			Help: "Tasks held back by the concurrency limit of their type.",
+		}, []string{"type"}),
+		tenantHeld: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workerpool_tasks_tenant_held_total",
+			Help: "Tasks held back by the in-flight quota of their tenant.",
+		}, []string{"tenant"}),
+		tenantRefused: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workerpool_tasks_tenant_refused_total",
+			Help: "Submissions refused by the queued or daily quota of their tenant.",
+		}, []string{"tenant", "quota"}),
+		partitionHeld: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_tasks_partition_held_total",
+			Help: "Tasks held back while an earlier task of their partition key ran.",
+		}),
+		capacityHeld: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_tasks_capacity_held_total",
+			Help: "Tasks held back until the running tasks left room for their weight.",
+		}),
+		stolen: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_tasks_stolen_total",
+			Help: "Tasks an idle worker took from the local queue of a peer.",
+		}),
+		archivedRecords: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_archived_records_total",
+			Help: "Finished task records written to the archive.",
+		}),
+		archiveFiles: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_archive_files_total",
+			Help: "Archive files stored.",
+		}),
+		archiveFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_archive_failures_total",
+			Help: "Archive files the sink failed to store, tried again later.",
+		}),
+		archiveDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_archive_dropped_total",
+			Help: "Finished task records dropped unarchived because too many were buffered.",
+		}),
+		duplicates: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_duplicate_deliveries_total",
+			Help: "Deliveries of tasks the completion log had as completed, acknowledged without running.",
+		}),
+		chaosFaults: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workerpool_chaos_faults_total",
+			Help: "Faults injected into handler runs by fault injection, by kind: latency, failure or panic.",
+		}, []string{"fault"}),
+		storageRefused: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workerpool_tasks_storage_refused_total",
+			Help: "Tasks submitted while the queue backend was over its storage quota, by action: rejected or dead_lettered.",
+		}, []string{"action"}),
+		storageEvicted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_storage_evicted_total",
+			Help: "Completed records evicted from the queue backend to bring it back under its storage quota.",
+		}),
+		notifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workerpool_notifications_total",
+			Help: "Operational notifications by kind and result: sent, failed, deduplicated or rate_limited.",
+		}, []string{"kind", "result"}),
+		migrated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workerpool_tasks_migrated_total",
+			Help: "Tasks whose data was upgraded to the schema version of their type before running, by type.",
+		}, []string{"type"}),
+		budgetDeferred: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_tasks_budget_deferred_total",
+			Help: "Tasks held until the next period of a spent execution budget.",
+		}),
+		dryRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workerpool_tasks_dry_run_total",
+			Help: "Attempts whose handler was skipped in a dry run, by type.",
+		}, []string{"type"}),
+		dependencyFailed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_tasks_dependency_failed_total",
+			Help: "Tasks failed without running because a task they depended on did not succeed.",
+		}),
+		hedged: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workerpool_attempts_hedged_total",
+			Help: "Attempts given a second execution, by the execution whose outcome was taken: first or second.",
+		}, []string{"winner"}),
+		cpuTime: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workerpool_task_cpu_seconds_total",
+			Help: "CPU time of the threads running the handlers, by type, with usage accounting on Linux.",
+		}, []string{"type"}),
+		slaLatency: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "workerpool_sla_latency_seconds",
+			Help: "Latency at the percentile of each SLO over its window, for the wait before the first attempt or the run of an attempt.",
+		}, []string{"type", "metric", "percentile"}),
+		slaBreached: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "workerpool_sla_breached",
+			Help: "1 while an SLO is in a sustained breach, 0 otherwise.",
+		}, []string{"type", "metric", "percentile"}),
+		slaAlerts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workerpool_sla_alerts_total",
+			Help: "Sustained SLO breaches alerted.",
+		}, []string{"type", "metric"}),
+		recoveryIssues: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workerpool_recovery_issues_total",
+			Help: "Inconsistencies found by recovery passes, by kind and whether they were repaired.",
+		}, []string{"kind", "repaired"}),
+		deadLettersDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "workerpool_dead_letters_dropped_total",
+			Help: "Oldest dead letters dropped because the dead-letter queue was over its limit.",
+		}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "workerpool_task_duration_seconds",
+			Help:    "Time spent in the task handler per attempt.",
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+		}),
+	}
+
+	var r prometheus.Registerer = reg
+	if p.name != "" {
+		r = prometheus.WrapRegistererWith(prometheus.Labels{"queue": p.name}, reg)
+	}
+	r.MustRegister(
+		m.enqueued, m.processed, m.failures, m.retries, m.shed, m.panics, m.duration, m.expired, m.circuitTrips,
+		m.webhooksDelivered, m.webhooksFailed, m.evicted, m.stuck, m.rejected, m.typeHeld, m.partitionHeld, m.capacityHeld,
+		m.tenantHeld, m.tenantRefused, m.stolen, m.archivedRecords, m.archiveFiles, m.archiveFailures, m.archiveDropped,
+		m.duplicates, m.chaosFaults, m.storageRefused, m.storageEvicted, m.notifications, m.migrated, m.budgetDeferred, m.dryRuns, m.dependencyFailed, m.hedged, m.cpuTime, m.slaLatency, m.slaBreached, m.slaAlerts, m.recoveryIssues, m.deadLettersDropped,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "workerpool_queue_depth",
+			Help: "Tasks waiting for a worker.",
+		}, func() float64 { return float64(p.QueueDepth()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "workerpool_tasks_blocked",
+			Help: "Tasks waiting for their dependencies to succeed.",
+		}, func() float64 { return float64(p.Blocked()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "workerpool_workers",
+			Help: "Running workers.",
+		}, func() float64 { return float64(p.Workers()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "workerpool_busy_workers",
+			Help: "Workers currently running a task.",
+		}, func() float64 { return float64(p.BusyWorkers()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "workerpool_paused",
+			Help: "1 while the pool is paused, 0 otherwise.",
+		}, func() float64 {
+			if p.Paused() {
+				return 1
+			}
+			return 0
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "workerpool_circuit_state",
+			Help: "Circuit breaker state: 0 closed, 1 half-open, 2 open.",
+		}, func() float64 { return float64(p.CircuitState()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "workerpool_worker_utilization",
+			Help: "Fraction of workers currently running a task.",
+		}, func() float64 {
+			if n := p.Workers(); n > 0 {
+				return float64(p.BusyWorkers()) / float64(n)
+			}
+			return 0
+		}),
+	)
+	if p.leader != nil {
+		r.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "workerpool_leader",
+			Help: "1 while this process holds the leader lease and fires recurring schedules.",
+		}, func() float64 {
+			if p.IsLeader() {
+				return 1
+			}
+			return 0
+		}))
+	}
+	if p.adaptiveConfig != nil {
+		r.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "workerpool_concurrency_limit",
+			Help: "Tasks allowed to run at once by adaptive concurrency.",
+		}, func() float64 { return float64(p.ConcurrencyLimit()) }))
+	}
+	if p.workStealing != nil || p.affinity != nil {
+		r.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "workerpool_local_queue_spread",
+			Help: "Tasks in the longest local worker queue minus those in the shortest.",
+		}, func() float64 { return float64(p.stealer.spread()) }))
+	}
+	if p.storage != nil {
+		r.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "workerpool_storage_bytes",
+			Help: "Storage taken by the queue backend at its last measure.",
+		}, func() float64 {
+			used, _ := p.StorageUsage()
+			return float64(used)
+		}), prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "workerpool_storage_quota_bytes",
+			Help: "Storage quota of the queue backend.",
+		}, func() float64 {
+			_, limit := p.StorageUsage()
+			return float64(limit)
+		}))
+	}
+	if c, ok := p.queue.(interface{ Codec() Codec }); ok {
+		if s, ok := c.Codec().(interface{ CompressionStats() CompressionStats }); ok {
+			registerCompression(r, "queue", s.CompressionStats)
+		}
+	}
+	if p.archiver != nil && p.archiver.compressor != nil {
+		registerCompression(r, "archive", p.archiver.compressor.stats)
+	}
+	if _, ok := p.Replication(); ok {
+		replication := func(f func(ReplicationStatus) float64) func() float64 {
+			return func() float64 {
+				rs, _ := p.Replication()
+				return f(rs)
+			}
+		}
+		r.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "workerpool_replication_lag_seconds",
+			Help: "Age of the oldest change to the queue not yet copied to the standby region.",
+		}, replication(func(rs ReplicationStatus) float64 { return rs.Lag.Seconds() })), prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "workerpool_replication_backlog",
+			Help: "Changes to the queue not yet copied to the standby region.",
+		}, replication(func(rs ReplicationStatus) float64 { return float64(rs.Backlog) })), prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "workerpool_replication_resyncs_total",
+			Help: "Full copies of the queue made by this process to a standby new or too far behind.",
+		}, replication(func(rs ReplicationStatus) float64 { return float64(rs.Resyncs) })))
+	}
+	if s, ok := p.store.(interface{ Len() int }); ok {
+		r.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "workerpool_task_records",
+			Help: "Task records kept by the task store.",
+		}, func() float64 { return float64(s.Len()) }))
+	}
+	return m
+}
+
+// registerCompression registers the metrics of the payloads compressed
+// for store, the queue backend or the archive
+func registerCompression(r prometheus.Registerer, store string, stats func() CompressionStats) {
+	labels := prometheus.Labels{"store": store, "algorithm": stats().Algorithm.String()}
+	r.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name:        "workerpool_compressed_payloads_total",
+		Help:        "Payloads, checkpoints and outputs stored compressed.",
+		ConstLabels: labels,
+	}, func() float64 { return float64(stats().Payloads) }), prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name:        "workerpool_compression_input_bytes_total",
+		Help:        "Bytes of the payloads stored compressed, before compression.",
+		ConstLabels: labels,
+	}, func() float64 { return float64(stats().Input) }), prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name:        "workerpool_compression_output_bytes_total",
+		Help:        "Bytes of the payloads stored compressed, after compression.",
+		ConstLabels: labels,
+	}, func() float64 { return float64(stats().Output) }), prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "workerpool_compression_ratio",
+		Help:        "Compressed over uncompressed size of the payloads stored compressed so far.",
+		ConstLabels: labels,
+	}, func() float64 { return stats().Ratio() }))
+}
+
+func (m *poolMetrics) observe(d time.Duration, err error) {
+	m.processed.Inc()
+	m.duration.Observe(d.Seconds())
+	if err != nil {
+		m.failures.Inc()
+	}
+}
+
+// MetricsHandler serves the pool metrics in the Prometheus text format
+func (p *WorkerPool) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(p.metrics.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,206 @@
+package go_playground
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BatchHandler processes tasks in bulk, for work far cheaper done many at a
+// time such as bulk inserts or batched API calls. An error fails every task
+// of the batch, a BatchErrors fails them one by one
+type BatchHandler interface {
+	HandleBatch(ctx context.Context, tasks []Task) error
+}
+
+// BatchHandlerFunc adapts an ordinary function to a BatchHandler
+type BatchHandlerFunc func(ctx context.Context, tasks []Task) error
+
+// HandleBatch calls f(ctx, tasks)
+func (f BatchHandlerFunc) HandleBatch(ctx context.Context, tasks []Task) error {
+	return f(ctx, tasks)
+}
+
+// BatchErrors is returned by a BatchHandler whose tasks failed
+// independently, holding the error of tasks[i] at i, nil for those that
+// succeeded
+type BatchErrors []error
+
+func (e BatchErrors) Error() string {
+	n := 0
+	for _, err := range e {
+		if err != nil {
+			n++
+		}
+	}
+	return fmt.Sprintf("%d of %d batched tasks failed", n, len(e))
+}
+
+// Batching sets how tasks are gathered into batches
+type Batching struct {
+	Size int           // tasks per batch at most, 100 by default
+	Wait time.Duration // how long a batch waits to fill from its first task, 50ms by default
+}
+
+// DefaultBatching hands over up to 100 tasks, or those arriving in 50ms
+var DefaultBatching = Batching{Size: 100, Wait: 50 * time.Millisecond}
+
+// Batch returns a TaskHandler handing the tasks given to it to h in
+// batches of up to b.Size, or of those arriving within b.Wait. Each task
+// keeps its own run, retries and record; the worker that got the first
+// task of a batch runs it while the others wait for its outcome. A batch
+// only fills with tasks workers are free for, so give the pool at least
+// b.Size workers. Register it for one type with RegisterHandler or for all
+// with WithHandler.
+//
+// The context of HandleBatch carries the values of no task. It is
+// canceled once the contexts of all its tasks are, such as when the pool
+// stops; tasks canceled before their batch starts are left out of it
+func Batch(h BatchHandler, b Batching) TaskHandler {
+	if b.Size <= 0 {
+		b.Size = DefaultBatching.Size
+	}
+	if b.Wait <= 0 {
+		b.Wait = DefaultBatching.Wait
+	}
+	return &batcher{h: h, cfg: b}
+}
+
+// batcher gathers the tasks of concurrent Handle calls
+type batcher struct {
+	h   BatchHandler
+	cfg Batching
+
+	mu   sync.Mutex
+	open *taskBatch // the batch taking tasks, nil when none is
+}
+
+// taskBatch is a batch being gathered or run
+type taskBatch struct {
+	tasks []Task
+	ctxs  []context.Context
+	errs  []error
+	ready chan struct{} // closed once full or past its wait
+	done  chan struct{} // closed once errs is set
+	once  sync.Once
+}
+
+func (b *batcher) Handle(ctx context.Context, t Task) error {
+	b.mu.Lock()
+	tb := b.open
+	leader := tb == nil
+	if leader {
+		tb = &taskBatch{ready: make(chan struct{}), done: make(chan struct{})}
+		b.open = tb
+		time.AfterFunc(b.cfg.Wait, func() { b.close(tb) })
+	}
+	i := len(tb.tasks)
+	tb.tasks = append(tb.tasks, t)
+	tb.ctxs = append(tb.ctxs, ctx)
+	if len(tb.tasks) >= b.cfg.Size {
+		b.closeLocked(tb)
+	}
+	b.mu.Unlock()
+
+	if !leader {
+		<-tb.done
+		return tb.errs[i]
+	}
+	select {
+	case <-tb.ready:
+	case <-ctx.Done():
+		// Run what was gathered rather than leave it waiting
+		b.close(tb)
+	}
+	b.run(tb)
+	return tb.errs[0]
+}
+
+// close stops tb taking tasks
+func (b *batcher) close(tb *taskBatch) {
+	b.mu.Lock()
+	b.closeLocked(tb)
+	b.mu.Unlock()
+}
+
+func (b *batcher) closeLocked(tb *taskBatch) {
+	if b.open == tb {
+		b.open = nil
+	}
+	tb.once.Do(func() { close(tb.ready) })
+}
+
+// run hands the tasks of a closed batch to the handler and their outcome
+// to the workers waiting on it. A panic fails the whole batch, the worker
+// running it panicking in turn
+func (b *batcher) run(tb *taskBatch) {
+	tb.errs = make([]error, len(tb.tasks))
+	var (
+		tasks   []Task
+		indexes []int
+	)
+	for i, ctx := range tb.ctxs {
+		if ctx.Err() != nil {
+			tb.errs[i] = context.Cause(ctx)
+			continue
+		}
+		tasks = append(tasks, tb.tasks[i])
+		indexes = append(indexes, i)
+	}
+	defer close(tb.done)
+	if len(tasks) == 0 {
+		return
+	}
+	ctx, cancel := b.context(tb, indexes)
+	defer cancel()
+	defer func() {
+		if v := recover(); v != nil {
+			perr := &PanicError{Value: v, Stack: debug.Stack()}
+			for _, i := range indexes {
+				tb.errs[i] = perr
+			}
+			panic(v)
+		}
+	}()
+
+	err := b.h.HandleBatch(ctx, tasks)
+	var each BatchErrors
+	if errors.As(err, &each) && len(each) != len(tasks) {
+		err = fmt.Errorf("batch handler returned %d errors for %d tasks", len(each), len(tasks))
+		each = nil
+	}
+	for j, i := range indexes {
+		if each != nil {
+			tb.errs[i] = each[j]
+		} else {
+			tb.errs[i] = err
+		}
+	}
+}
+
+// context returns the context of a batch, canceled once those of all the
+// tasks run in it are
+func (b *batcher) context(tb *taskBatch, indexes []int) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	var left atomic.Int64
+	left.Store(int64(len(indexes)))
+	stops := make([]func() bool, 0, len(indexes))
+	for _, i := range indexes {
+		tctx := tb.ctxs[i]
+		stops = append(stops, context.AfterFunc(tctx, func() {
+			if left.Add(-1) == 0 {
+				cancel(context.Cause(tctx))
+			}
+		}))
+	}
+	return ctx, func() {
+		for _, stop := range stops {
+			stop()
+		}
+		cancel(nil)
+	}
+}
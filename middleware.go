@@ -0,0 +1,96 @@
+package go_playground
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// CorrelationHeader carries the correlation ID of a request. Incoming values
+// are kept, otherwise a new ID is generated
+const CorrelationHeader = "X-Correlation-ID"
+
+type ctxKey int
+
+const (
+	correlationKey ctxKey = iota
+	clientKey             // *string filled in by the auth middleware
+	tenantKey             // string set by the auth middleware for mapped clients
+)
+
+// CorrelationID returns the correlation ID stored in ctx by the server
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey).(string)
+	return id
+}
+
+func newCorrelationID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validCorrelationID accepts short printable IDs so headers cannot inject
+// arbitrary content into the logs
+func validCorrelationID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// correlationMiddleware tags every request with a correlation ID and logs it
+func correlationMiddleware(log *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(CorrelationHeader)
+			if !validCorrelationID(id) {
+				id = newCorrelationID()
+			}
+			w.Header().Set(CorrelationHeader, id)
+
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			start := time.Now()
+			var client string
+			ctx := context.WithValue(r.Context(), correlationKey, id)
+			ctx = context.WithValue(ctx, clientKey, &client)
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			attrs := []any{
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", rec.status,
+				"duration", time.Since(start),
+				"correlation_id", id,
+			}
+			if client != "" {
+				attrs = append(attrs, "client", client)
+			}
+			log.Info("http request", attrs...)
+		})
+	}
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
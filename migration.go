@@ -0,0 +1,96 @@
+package go_playground
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrMigrationFailed dead-letters tasks whose data could not be upgraded to
+// the schema version of their type, see RegisterMigration
+var ErrMigrationFailed = errors.New("task schema migration failed")
+
+// Migration upgrades the data of a task from one schema version to the
+// next
+type Migration func(data string) (string, error)
+
+var (
+	migrationsMu sync.RWMutex
+	migrations   = map[string][]Migration{} // by type, the one upgrading from version i at i
+)
+
+// RegisterMigration makes m upgrade the data of tasks of taskType from
+// schema version from to from+1. Migrations are registered from version 0,
+// the tasks submitted before their type was versioned, up to the current
+// version, which submitted tasks are stamped with. Tasks of an older
+// version, queued before a deploy, are upgraded once read back from the
+// backend, before the handler decodes them; those whose payload is in a
+// PayloadStore are not. It panics when from skips a version
+func RegisterMigration(taskType string, from int, m Migration) {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+	chain := migrations[taskType]
+	switch {
+	case from < 0 || from > len(chain):
+		panic(fmt.Sprintf("migration of %q from version %d registered without the one from version %d", taskType, from, len(chain)))
+	case from == len(chain):
+		migrations[taskType] = append(chain, m)
+	default:
+		chain[from] = m
+	}
+}
+
+// SchemaVersion returns the current schema version of taskType, zero
+// without migrations
+func SchemaVersion(taskType string) int {
+	migrationsMu.RLock()
+	defer migrationsMu.RUnlock()
+	return len(migrations[taskType])
+}
+
+// MigrateTask upgrades the data of t to the schema version of its type.
+// On failure t is returned unchanged with an error wrapping
+// ErrMigrationFailed. Tasks of a version newer than the build, written by a
+// build deployed since, are left as they are
+func MigrateTask(t Task) (Task, error) {
+	migrationsMu.RLock()
+	chain := migrations[t.Type]
+	migrationsMu.RUnlock()
+	if t.SchemaVersion >= len(chain) || t.PayloadRef != "" {
+		return t, nil
+	}
+	data := t.Data
+	for v := t.SchemaVersion; v < len(chain); v++ {
+		var err error
+		if data, err = chain[v](data); err != nil {
+			return t, fmt.Errorf("%w: %s from version %d: %v", ErrMigrationFailed, t.Type, v, err)
+		}
+	}
+	t.Data, t.SchemaVersion = data, len(chain)
+	return t, nil
+}
+
+// stampSchema sets the schema version of a submitted task of a versioned
+// type, unless the producer set it
+func stampSchema(t *Task) {
+	if t.SchemaVersion == 0 {
+		t.SchemaVersion = SchemaVersion(t.Type)
+	}
+}
+
+// migrate upgrades a task about to run, reporting false when it failed and
+// was dead-lettered
+func (p *WorkerPool) migrate(task *Task) bool {
+	from := task.SchemaVersion
+	migrated, err := MigrateTask(*task)
+	if err != nil {
+		p.deadLetter(*task, err)
+		return false
+	}
+	if migrated.SchemaVersion != from {
+		p.metrics.migrated.WithLabelValues(task.Type).Inc()
+		p.taskLogger(*task).Info("task data migrated", "from", from, "to", migrated.SchemaVersion)
+	}
+	*task = migrated
+	return true
+}
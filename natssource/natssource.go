@@ -0,0 +1,88 @@
+// Package natssource is a pool.Source reading tasks from a NATS subject
+package natssource
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	pool "playground"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Options configures a Source
+type Options struct {
+	// Subject is the subject to subscribe to, wildcards allowed
+	Subject string
+	// QueueGroup spreads the messages over every server subscribed with
+	// the same group. Without a group each server gets every message
+	QueueGroup string
+	// Logger receives dropped messages. Defaults to slog.Default()
+	Logger *slog.Logger
+}
+
+// Source subscribes to a subject over core NATS, which delivers at most
+// once: messages published while no server is subscribed, or received
+// while shutting down, are lost
+type Source struct {
+	nc   *nats.Conn
+	opts Options
+}
+
+// New creates a source on the given connection, which the caller owns
+func New(nc *nats.Conn, opts Options) *Source {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return &Source{nc: nc, opts: opts}
+}
+
+// Name implements pool.Source
+func (s *Source) Name() string {
+	return "nats:" + s.opts.Subject
+}
+
+// Run implements pool.Source. Messages with a reply subject are answered
+// once queued, with an empty body, or with the error if they were dropped
+func (s *Source) Run(ctx context.Context, submit func(context.Context, pool.Task) error) error {
+	sub, err := s.nc.QueueSubscribeSync(s.opts.Subject, s.opts.QueueGroup)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		task, err := pool.DecodeMessage(msg.Data, msg.Header.Get)
+		if err == nil {
+			err = submit(ctx, task)
+		}
+		if err != nil && ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			s.opts.Logger.Warn("natssource: dropping message", "subject", msg.Subject, "error", err)
+		}
+		if msg.Reply != "" {
+			s.respond(msg, err)
+		}
+	}
+}
+
+func (s *Source) respond(msg *nats.Msg, err error) {
+	reply := nats.NewMsg(msg.Reply)
+	if err != nil {
+		reply.Header.Set("Error", err.Error())
+	}
+	if err := msg.RespondMsg(reply); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+		s.opts.Logger.Error("natssource: replying", "subject", msg.Subject, "error", err)
+	}
+}
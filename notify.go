@@ -0,0 +1,282 @@
+package go_playground
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Kinds of Notification
+const (
+	NotifySaturation       = "queue_saturation"
+	NotifyBreakerOpen      = "circuit_breaker_open"
+	NotifyDeadLetterGrowth = "dead_letter_growth"
+	NotifyWorkerPanics     = "worker_panics"
+	NotifySLABreach        = "sla_breach"
+)
+
+// Notification is an operational alert sent to the Notifiers of
+// WithNotifications
+type Notification struct {
+	Queue   string    `json:"queue,omitempty"`
+	Kind    string    `json:"kind"`
+	Message string    `json:"message"`
+	Value   float64   `json:"value"` // what crossed its threshold, such as the queue fill ratio
+	Time    time.Time `json:"time"`
+}
+
+// Notifier delivers notifications, such as WebhookNotifier and
+// SMTPNotifier
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// NotifierFunc adapts an ordinary function to a Notifier
+type NotifierFunc func(ctx context.Context, n Notification) error
+
+// Notify calls f(ctx, n)
+func (f NotifierFunc) Notify(ctx context.Context, n Notification) error {
+	return f(ctx, n)
+}
+
+// Notifications alerts Notifiers on the conditions an operator should
+// look at. Each condition is checked every Interval; a condition still
+// holding is notified again once Dedup has passed, and no more than
+// MaxPerHour notifications are sent in total
+type Notifications struct {
+	Notifiers []Notifier
+	Interval  time.Duration // 30s by default
+	// Saturation is the fill ratio of a bounded queue that alerts, 0.9 by
+	// default
+	Saturation float64
+	// DeadLetterGrowth is the tasks dead-lettered within an Interval that
+	// alert, 10 by default
+	DeadLetterGrowth int
+	// Panics is the worker panics within an Interval that alert, 3 by
+	// default. Circuit breaker trips alert at once
+	Panics     int
+	Dedup      time.Duration // 15m by default
+	MaxPerHour int           // 20 by default
+}
+
+// notifier checks the conditions of Notifications and sends the alerts.
+// A nil notifier does nothing
+type notifier struct {
+	cfg    Notifications
+	events chan Notification
+	panics atomic.Int64
+
+	mu          sync.Mutex
+	lastSent    map[string]time.Time // by kind
+	sent        []time.Time          // within the last hour
+	deadLetters int                  // at the previous check
+}
+
+// WithNotifications sends alerts on operational conditions, see
+// Notifications
+func WithNotifications(n Notifications) Option {
+	return func(p *WorkerPool) {
+		if len(n.Notifiers) == 0 {
+			return
+		}
+		if n.Interval <= 0 {
+			n.Interval = 30 * time.Second
+		}
+		if n.Saturation <= 0 {
+			n.Saturation = 0.9
+		}
+		if n.DeadLetterGrowth <= 0 {
+			n.DeadLetterGrowth = 10
+		}
+		if n.Panics <= 0 {
+			n.Panics = 3
+		}
+		if n.Dedup <= 0 {
+			n.Dedup = 15 * time.Minute
+		}
+		if n.MaxPerHour <= 0 {
+			n.MaxPerHour = 20
+		}
+		p.notes = &notifier{cfg: n, events: make(chan Notification, 16), lastSent: make(map[string]time.Time)}
+	}
+}
+
+// raise queues a notification of a condition detected outside the
+// monitor, dropped when alerts already pile up
+func (n *notifier) raise(kind, msg string, value float64) {
+	if n == nil {
+		return
+	}
+	select {
+	case n.events <- Notification{Kind: kind, Message: msg, Value: value, Time: time.Now()}:
+	default:
+	}
+}
+
+// panicked counts a worker panic toward the Panics threshold
+func (n *notifier) panicked() {
+	if n != nil {
+		n.panics.Add(1)
+	}
+}
+
+// notifyConditions checks the conditions every interval and sends the
+// notifications raised until the pool is torn down
+func (p *WorkerPool) notifyConditions() {
+	n := p.notes
+	n.deadLetters = p.dlq.len()
+	ticker := time.NewTicker(n.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case note := <-n.events:
+			p.sendNotification(note)
+		case now := <-ticker.C:
+			for _, note := range p.checkConditions(now) {
+				p.sendNotification(note)
+			}
+		}
+	}
+}
+
+// checkConditions returns the notifications of the conditions holding now
+func (p *WorkerPool) checkConditions(now time.Time) []Notification {
+	n := p.notes
+	var notes []Notification
+	if _, bounded := p.queue.(boundedQueue); bounded && p.queueSize > 0 {
+		depth := p.queue.Len()
+		if ratio := float64(depth) / float64(p.queueSize); ratio >= n.cfg.Saturation {
+			notes = append(notes, Notification{Kind: NotifySaturation, Value: ratio, Time: now,
+				Message: fmt.Sprintf("queue %d%% full, %d of %d tasks", int(ratio*100), depth, p.queueSize)})
+		}
+	}
+	dead := p.dlq.len()
+	if grown := dead - n.deadLetters; grown >= n.cfg.DeadLetterGrowth {
+		notes = append(notes, Notification{Kind: NotifyDeadLetterGrowth, Value: float64(grown), Time: now,
+			Message: fmt.Sprintf("%d tasks dead-lettered in %s, %d in the dead-letter queue", grown, n.cfg.Interval, dead)})
+	}
+	n.deadLetters = dead
+	if panics := n.panics.Swap(0); panics >= int64(n.cfg.Panics) {
+		notes = append(notes, Notification{Kind: NotifyWorkerPanics, Value: float64(panics), Time: now,
+			Message: fmt.Sprintf("%d worker panics in %s", panics, n.cfg.Interval)})
+	}
+	return notes
+}
+
+// sendNotification delivers note to every notifier unless it repeats one
+// sent within Dedup or the hourly budget is spent
+func (p *WorkerPool) sendNotification(note Notification) {
+	n := p.notes
+	note.Queue = p.name
+	log := p.log.With("kind", note.Kind)
+	n.mu.Lock()
+	if last, ok := n.lastSent[note.Kind]; ok && note.Time.Sub(last) < n.cfg.Dedup {
+		n.mu.Unlock()
+		p.metrics.notifications.WithLabelValues(note.Kind, "deduplicated").Inc()
+		return
+	}
+	hourAgo := note.Time.Add(-time.Hour)
+	for len(n.sent) > 0 && n.sent[0].Before(hourAgo) {
+		n.sent = n.sent[1:]
+	}
+	if len(n.sent) >= n.cfg.MaxPerHour {
+		n.mu.Unlock()
+		p.metrics.notifications.WithLabelValues(note.Kind, "rate_limited").Inc()
+		log.Warn("notification dropped, hourly limit reached", "message", note.Message, "max_per_hour", n.cfg.MaxPerHour)
+		return
+	}
+	n.lastSent[note.Kind] = note.Time
+	n.sent = append(n.sent, note.Time)
+	n.mu.Unlock()
+
+	log.Warn("sending notification", "message", note.Message)
+	for _, nt := range n.cfg.Notifiers {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := nt.Notify(ctx, note)
+		cancel()
+		if err != nil {
+			p.metrics.notifications.WithLabelValues(note.Kind, "failed").Inc()
+			log.Error("sending notification", "error", err)
+			continue
+		}
+		p.metrics.notifications.WithLabelValues(note.Kind, "sent").Inc()
+	}
+}
+
+// WebhookNotifier posts notifications to URL as JSON, signed like task
+// webhooks when Secret is set. Client defaults to http.DefaultClient
+type WebhookNotifier struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+// Notify implements Notifier
+func (w WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "workerpool-notifier")
+	req.Header.Set(WebhookTimestampHeader, ts)
+	if w.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(w.Secret, ts, body))
+	}
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notification webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// SMTPNotifier mails notifications from From to To through the server at
+// Addr, host:port, authenticating with PLAIN when Username is set
+type SMTPNotifier struct {
+	Addr     string
+	From     string
+	To       []string
+	Username string
+	Password string
+}
+
+// Notify implements Notifier. The context is not honored by net/smtp
+func (s SMTPNotifier) Notify(_ context.Context, n Notification) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := strings.Cut(s.Addr, ":")
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	subject := "[workerpool] " + n.Kind
+	if n.Queue != "" {
+		subject += " on " + n.Queue
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n", s.From, strings.Join(s.To, ", "), subject, n.Time.Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\nqueue: %s\r\nkind: %s\r\nvalue: %v\r\ntime: %s\r\n", n.Message, n.Queue, n.Kind, n.Value, n.Time.Format(time.RFC3339))
+	return smtp.SendMail(s.Addr, auth, s.From, s.To, []byte(msg.String()))
+}
@@ -0,0 +1,23 @@
+package go_playground
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openapiSpec describes the HTTP API. The client in package apiclient is
+// generated from it
+//
+//go:embed openapi.json
+var openapiSpec []byte
+
+// OpenAPISpec returns the OpenAPI 3 document of the HTTP API, served at
+// /openapi.json
+func OpenAPISpec() []byte {
+	return openapiSpec
+}
+
+func (s *Server) openapiHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openapiSpec)
+}
@@ -0,0 +1,434 @@
+package go_playground
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultWorkers   = 5
+	defaultQueueSize = 100
+)
+
+// Option configures a WorkerPool
+type Option func(*WorkerPool)
+
+// WithName names the queue served by the pool. The name is stamped on
+// submitted tasks, added to log lines and set as the queue label of the
+// metrics, so several pools can share a registry
+func WithName(name string) Option {
+	return func(p *WorkerPool) {
+		p.name = name
+	}
+}
+
+// WithWorkers sets the number of workers
+func WithWorkers(n int) Option {
+	return func(p *WorkerPool) {
+		if n > 0 {
+			p.workers = n
+		}
+	}
+}
+
+// WithQueueSize sets the capacity of the default in-memory queue
+func WithQueueSize(n int) Option {
+	return func(p *WorkerPool) {
+		if n > 0 {
+			p.queueSize = n
+		}
+	}
+}
+
+// WithHandler sets the handler that processes tasks, those of types
+// without a handler of RegisterHandler
+func WithHandler(h TaskHandler) Option {
+	return func(p *WorkerPool) {
+		if h != nil {
+			p.handler = h
+		}
+	}
+}
+
+// WithMiddleware wraps the handler in the given middleware, outermost
+// first. Repeated options append to the chain
+func WithMiddleware(mw ...TaskMiddleware) Option {
+	return func(p *WorkerPool) {
+		p.middleware = append(p.middleware, mw...)
+	}
+}
+
+// WithValidator checks every submitted task with v, after the validators
+// given earlier. Retries and requeues of accepted tasks are not checked again
+func WithValidator(v Validator) Option {
+	return func(p *WorkerPool) {
+		p.validators = append(p.validators, v)
+	}
+}
+
+// WithCircuitBreaker stops dispatching for cb.Cooldown once the handler
+// failed cb.Threshold times in a row, then lets a single trial task decide
+// whether to resume. Zero fields take their DefaultCircuitBreaker values
+func WithCircuitBreaker(cb CircuitBreaker) Option {
+	return func(p *WorkerPool) {
+		p.breakerConfig = &cb
+	}
+}
+
+// WithWebhooks enables Task.CallbackURL: once a task succeeds, fails or is
+// canceled its record is POSTed there as JSON
+func WithWebhooks(wh Webhooks) Option {
+	return func(p *WorkerPool) {
+		p.webhooks = newWebhookSender(wh)
+	}
+}
+
+// WithArchive writes the final record of every task to a.Sink, see
+// Archive. Shutdown waits for the last file to be stored
+func WithArchive(a Archive) Option {
+	return func(p *WorkerPool) {
+		if a.Sink != nil {
+			p.archiver = newArchiver(a)
+		}
+	}
+}
+
+// WithPayloadStore keeps the payloads uploaded to POST /events/upload in
+// ps. Handlers read them with OpenPayload
+func WithPayloadStore(ps PayloadStore) Option {
+	return func(p *WorkerPool) {
+		p.payloads = ps
+	}
+}
+
+// WithFairScheduling interleaves the tasks of different tenants on the
+// in-memory queue, see NewFairQueue. It has no effect with
+// WithQueueBackend
+func WithFairScheduling(fs FairScheduling) Option {
+	return func(p *WorkerPool) {
+		p.fair = &fs
+	}
+}
+
+// WithDispatchStrategy sets the order the in-memory queue pops tasks of
+// equal priority in, that of each tenant with WithFairScheduling unless
+// it sets its own. It has no effect with WithQueueBackend
+func WithDispatchStrategy(s DispatchStrategy) Option {
+	return func(p *WorkerPool) {
+		p.dispatchStrategy = s
+	}
+}
+
+// WithRetryPolicy sets how failed tasks are retried
+func WithRetryPolicy(rp RetryPolicy) Option {
+	return func(p *WorkerPool) {
+		if rp.MaxAttempts > 0 {
+			p.retry = rp
+		}
+	}
+}
+
+// WithDeadLetter sets a callback for tasks that exhausted their retries
+func WithDeadLetter(fn func(Task, error)) Option {
+	return func(p *WorkerPool) {
+		p.onDead = fn
+	}
+}
+
+// WithAutoscale lets the pool resize itself within the policy bounds
+func WithAutoscale(ap AutoscalePolicy) Option {
+	return func(p *WorkerPool) {
+		ap = ap.normalize()
+		p.autoscalePolicy = &ap
+	}
+}
+
+// WithTaskStore sets where task records are kept. Defaults to a MemoryStore
+func WithTaskStore(s TaskStore) Option {
+	return func(p *WorkerPool) {
+		p.store = s
+	}
+}
+
+// WithIDGenerator sets how task IDs are allocated. Defaults to a counter
+// local to the pool, resumed from durable backends. Backends allocating IDs
+// themselves, such as the Redis queue, ignore it
+func WithIDGenerator(g IDGenerator) Option {
+	return func(p *WorkerPool) {
+		p.ids = g
+	}
+}
+
+// WithUIDGenerator gives every task a UID from g, such as NewULID or
+// NewUUIDv7, besides its ID: a string unique across processes and
+// deployments, for systems keeping tasks of several pools apart
+func WithUIDGenerator(g UIDGenerator) Option {
+	return func(p *WorkerPool) {
+		p.uids = g
+	}
+}
+
+// WithWatchdog flags, and optionally stops, tasks going without a
+// heartbeat for longer than wd.StuckAfter. A zero StuckAfter disables it
+func WithWatchdog(wd Watchdog) Option {
+	return func(p *WorkerPool) {
+		if wd.StuckAfter <= 0 {
+			return
+		}
+		if wd.Interval <= 0 {
+			wd.Interval = wd.StuckAfter / 4
+		}
+		p.watchdog = &wd
+	}
+}
+
+// WithTypeConcurrency caps the running tasks of each type listed in
+// tc.Limits. Limits below 1 are ignored
+func WithTypeConcurrency(tc TypeConcurrency) Option {
+	return func(p *WorkerPool) {
+		limits := make(map[string]int, len(tc.Limits))
+		for typ, n := range tc.Limits {
+			if n >= 1 {
+				limits[typ] = n
+			}
+		}
+		if len(limits) == 0 {
+			return
+		}
+		tc.Limits = limits
+		p.typeLimits = &tc
+	}
+}
+
+// WithPartitioning orders the tasks sharing a PartitionKey
+func WithPartitioning(pt Partitioning) Option {
+	return func(p *WorkerPool) {
+		p.partitioning = &pt
+	}
+}
+
+// WithWeightedCapacity runs tasks only while their weights add up to at
+// most wc.Capacity, idle workers waiting otherwise. A capacity below 1 is
+// ignored
+func WithWeightedCapacity(wc WeightedCapacity) Option {
+	return func(p *WorkerPool) {
+		if wc.Capacity >= 1 {
+			p.capacity = &wc
+		}
+	}
+}
+
+// WithSLAMonitoring tracks the latencies of tasks against m.Objectives
+func WithSLAMonitoring(m SLAMonitoring) Option {
+	return func(p *WorkerPool) {
+		p.sla = newSLAMonitor(m)
+	}
+}
+
+// WithAnalytics samples the submitted tasks for GET /analytics
+func WithAnalytics(a Analytics) Option {
+	return func(p *WorkerPool) {
+		p.analytics = newAnalyticsSampler(a)
+	}
+}
+
+// WithHedging gives the late attempts of tasks marked Hedge a second
+// execution, see Hedging. It is ignored without a positive After
+func WithHedging(h Hedging) Option {
+	return func(p *WorkerPool) {
+		if h.After > 0 {
+			p.hedging = &hedging{cfg: h}
+		}
+	}
+}
+
+// WithUsageAccounting sums the wall and CPU time of the attempts by
+// tenant and type, see UsageAccounting
+func WithUsageAccounting(u UsageAccounting) Option {
+	return func(p *WorkerPool) {
+		p.usage = newUsageLedger(u)
+	}
+}
+
+// WithRecovery checks the backend and the task records as the pool
+// starts, see Recovery
+func WithRecovery(r Recovery) Option {
+	return func(p *WorkerPool) {
+		p.recovery = &r
+	}
+}
+
+// WithWorkerHooks runs h when each worker starts and stops
+func WithWorkerHooks(h WorkerHooks) Option {
+	return func(p *WorkerPool) {
+		p.hooks = newWorkerHooks(h)
+	}
+}
+
+// WithAffinity routes the tasks sharing a PartitionKey to one worker
+func WithAffinity(a Affinity) Option {
+	return func(p *WorkerPool) {
+		p.affinity = &a
+	}
+}
+
+// WithWorkStealing switches the workers to local queues that idle workers
+// steal from
+func WithWorkStealing(ws WorkStealing) Option {
+	return func(p *WorkerPool) {
+		p.workStealing = &ws
+	}
+}
+
+// WithRetention evicts finished task records from the task store as the
+// policy says. Stores that cannot evict keep every record
+func WithRetention(r Retention) Option {
+	return func(p *WorkerPool) {
+		if r.SweepInterval <= 0 {
+			r.SweepInterval = DefaultRetention.SweepInterval
+		}
+		p.retention = &r
+	}
+}
+
+// WithMetricsRegistry registers the pool metrics on reg instead of a
+// private registry
+func WithMetricsRegistry(reg *prometheus.Registry) Option {
+	return func(p *WorkerPool) {
+		p.registry = reg
+	}
+}
+
+// WithQueueBackend sets where queued tasks are stored. Defaults to a
+// MemoryQueue sized by WithQueueSize
+func WithQueueBackend(b QueueBackend) Option {
+	return func(p *WorkerPool) {
+		p.queue = b
+	}
+}
+
+// WithOverflowPolicy sets what Submit does when a bounded queue is full.
+// The timeout only applies to OverflowBlock; zero waits forever
+func WithOverflowPolicy(policy OverflowPolicy, timeout time.Duration) Option {
+	return func(p *WorkerPool) {
+		p.overflow = policy
+		p.overflowTimeout = timeout
+	}
+}
+
+// WithTaskTimeout limits every handler run unless the task sets its own
+// Timeout. Zero means no limit
+func WithTaskTimeout(d time.Duration) Option {
+	return func(p *WorkerPool) {
+		p.taskTimeout = d
+	}
+}
+
+// WithTaskTTL sets how long tasks without their own TTL or ExpiresAt may
+// wait in the queue. Zero, the default, means forever
+func WithTaskTTL(ttl time.Duration) Option {
+	return func(p *WorkerPool) {
+		p.taskTTL = ttl
+	}
+}
+
+// WithClock sets the clock of the pool, such as a FakeClock in tests.
+// Defaults to the real time
+func WithClock(c Clock) Option {
+	return func(p *WorkerPool) {
+		if c != nil {
+			p.clock = c
+		}
+	}
+}
+
+// WithSynchronous runs each task on the goroutine submitting it, before
+// Submit returns, so tests need neither sleeps nor waits. Retries follow
+// without backoff, RunAt is ignored and the pool has no workers, so Start,
+// pausing and resizing have no effect
+func WithSynchronous() Option {
+	return func(p *WorkerPool) {
+		p.synchronous = true
+	}
+}
+
+// WithChaos enables fault injection, starting with the faults of c, so
+// SetChaos and the admin API can change them. Meant for testing: faults
+// are injected below the middleware, into every handler
+func WithChaos(c Chaos) Option {
+	return func(p *WorkerPool) {
+		if c.validate() != nil {
+			c = Chaos{}
+		}
+		p.chaos = &chaos{}
+		p.chaos.cfg.Store(&c)
+	}
+}
+
+// WithLeaderElection fires recurring schedules only while this process is
+// the leader, see LeaderElection
+func WithLeaderElection(le LeaderElection) Option {
+	return func(p *WorkerPool) {
+		if le.Elector == nil {
+			return
+		}
+		if le.TTL <= 0 {
+			le.TTL = DefaultLeaderTTL
+		}
+		p.leader = &leadership{cfg: le}
+	}
+}
+
+// WithTenantQuotas bounds the tasks each Task.Tenant may queue, run and
+// submit per day, see TenantQuotas. Submissions over a quota fail with
+// ErrTenantQueueFull or ErrTenantDailyLimit
+func WithTenantQuotas(q TenantQuotas) Option {
+	return func(p *WorkerPool) {
+		p.tenantQuotas = &q
+	}
+}
+
+// WithTaskLogLimit sets the bytes of log lines kept with each task record,
+// DefaultTaskLogLimit by default. The oldest lines are dropped past it.
+// Zero or less keeps none
+func WithTaskLogLimit(bytes int) Option {
+	return func(p *WorkerPool) {
+		p.taskLogLimit = bytes
+	}
+}
+
+// WithDeadLetterExpired moves expired tasks to the dead letter queue
+// instead of only recording them as canceled
+func WithDeadLetterExpired() Option {
+	return func(p *WorkerPool) {
+		p.expiredDLQ = true
+	}
+}
+
+// WithLogger sets the structured logger. Defaults to slog.Default()
+func WithLogger(l *slog.Logger) Option {
+	return func(p *WorkerPool) {
+		p.log = l
+	}
+}
+
+// WithIdempotencyTTL sets how long idempotency keys are remembered. Zero
+// disables deduplication. Defaults to one hour
+func WithIdempotencyTTL(ttl time.Duration) Option {
+	return func(p *WorkerPool) {
+		if ttl >= 0 {
+			p.idem.ttl = ttl
+		}
+	}
+}
+
+// WithTracerProvider sets where task spans are sent. Defaults to the global
+// OpenTelemetry provider
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(p *WorkerPool) {
+		p.tracer = tp.Tracer(tracerName)
+	}
+}
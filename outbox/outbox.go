@@ -0,0 +1,243 @@
+// Package outbox enqueues tasks as part of the caller's own database
+// transaction. Enqueue writes the task to an outbox table in that
+// transaction, so it exists exactly when the business data committed with
+// it does, and a relay moves committed rows into the pool
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	pool "playground"
+)
+
+// Dialect is the SQL flavor of the database holding the outbox
+type Dialect int
+
+// Supported dialects, both claiming rows with SKIP LOCKED
+const (
+	Postgres Dialect = iota
+	MySQL
+)
+
+// Options configures an Outbox
+type Options struct {
+	// Table is the outbox table, created by New unless it exists. Defaults
+	// to "task_outbox"
+	Table   string
+	Dialect Dialect
+	// Interval is how often the relay looks for rows without Notify.
+	// Defaults to 1s
+	Interval time.Duration
+	// BatchSize bounds the rows relayed per transaction. Defaults to 100
+	BatchSize int
+	// Codec sets how tasks are stored. Defaults to pool.JSONCodec
+	Codec pool.Codec
+	// Logger receives relay errors. Defaults to slog.Default()
+	Logger *slog.Logger
+	// OnReject is called for tasks the pool refuses for good, such as
+	// those failing validation, before their row is deleted
+	OnReject func(t pool.Task, err error)
+}
+
+// Outbox stores tasks in a table of the caller's database until its relay
+// submits them to a pool. Several processes may relay the same table,
+// rows being claimed with FOR UPDATE SKIP LOCKED. Delivery is at least
+// once: a relay stopping between submitting a task and deleting its row
+// submits it again, which the pool drops within WithIdempotencyTTL as rows
+// get an idempotency key unless their task has one
+type Outbox struct {
+	db   *sql.DB
+	pool *pool.WorkerPool
+	opts Options
+
+	insert, claim, remove string // statements
+	notify                chan struct{}
+}
+
+// New creates the outbox table of opts if needed
+func New(ctx context.Context, db *sql.DB, p *pool.WorkerPool, opts Options) (*Outbox, error) {
+	if opts.Table == "" {
+		opts.Table = "task_outbox"
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Codec == nil {
+		opts.Codec = pool.JSONCodec
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if !validTable(opts.Table) {
+		return nil, fmt.Errorf("outbox: table name %q must be letters, digits and underscores", opts.Table)
+	}
+
+	o := &Outbox{db: db, pool: p, opts: opts, notify: make(chan struct{}, 1)}
+	var create string
+	switch opts.Dialect {
+	case Postgres:
+		create = `CREATE TABLE IF NOT EXISTS ` + opts.Table + ` (
+	id         bigserial PRIMARY KEY,
+	body       bytea NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now()
+)`
+		o.insert = `INSERT INTO ` + opts.Table + ` (body) VALUES ($1)`
+		o.remove = `DELETE FROM ` + opts.Table + ` WHERE id = $1`
+	case MySQL:
+		create = `CREATE TABLE IF NOT EXISTS ` + opts.Table + ` (
+	id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+	body       LONGBLOB NOT NULL,
+	created_at TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6)
+)`
+		o.insert = `INSERT INTO ` + opts.Table + ` (body) VALUES (?)`
+		o.remove = `DELETE FROM ` + opts.Table + ` WHERE id = ?`
+	default:
+		return nil, fmt.Errorf("outbox: unknown dialect %d", opts.Dialect)
+	}
+	o.claim = `SELECT id, body FROM ` + opts.Table + ` ORDER BY id LIMIT ` + strconv.Itoa(opts.BatchSize) + ` FOR UPDATE SKIP LOCKED`
+	if _, err := db.ExecContext(ctx, create); err != nil {
+		return nil, fmt.Errorf("outbox: creating %s: %w", opts.Table, err)
+	}
+	return o, nil
+}
+
+// Enqueue stores t in the outbox within tx. It reaches the pool once tx
+// commits; call Notify then to relay it without waiting for the next
+// Interval. The pool assigns the task its ID when it is relayed
+func (o *Outbox) Enqueue(ctx context.Context, tx *sql.Tx, t pool.Task) error {
+	t.ID = 0
+	body, err := pool.MarshalTask(o.opts.Codec, t)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, o.insert, body); err != nil {
+		return fmt.Errorf("outbox: inserting task: %w", err)
+	}
+	return nil
+}
+
+// Notify wakes the relay, after committing a transaction that enqueued
+func (o *Outbox) Notify() {
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run relays committed rows to the pool until ctx is done
+func (o *Outbox) Run(ctx context.Context) error {
+	ticker := time.NewTicker(o.opts.Interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := o.Relay(ctx)
+			if err != nil && ctx.Err() == nil {
+				o.opts.Logger.Error("outbox: relaying tasks", "table", o.opts.Table, "error", err)
+			}
+			// A full batch suggests more rows are waiting
+			if err != nil || n < o.opts.BatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-o.notify:
+		}
+	}
+}
+
+// Relay submits one batch of committed rows to the pool in a transaction,
+// deleting the rows submitted, and returns how many rows it handled. It
+// stops at the first task the pool cannot take for now, such as when its
+// queue is full, leaving it and the rows after it for the next call
+func (o *Outbox) Relay(ctx context.Context) (int, error) {
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, o.claim)
+	if err != nil {
+		return 0, err
+	}
+	type row struct {
+		id   int64
+		body []byte
+	}
+	var batch []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.body); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	handled := 0
+	var submitErr error
+	for _, r := range batch {
+		t, err := pool.UnmarshalTask(r.body)
+		if err != nil {
+			o.opts.Logger.Error("outbox: dropping undecodable row", "table", o.opts.Table, "id", r.id, "error", err)
+		} else {
+			if t.IdempotencyKey == "" {
+				t.IdempotencyKey = "outbox:" + o.opts.Table + ":" + strconv.FormatInt(r.id, 10)
+			}
+			if _, err := o.pool.Submit(t); err != nil {
+				if !rejected(err) {
+					submitErr = err
+					break
+				}
+				o.opts.Logger.Warn("outbox: task rejected by the pool", "table", o.opts.Table, "id", r.id, "error", err)
+				if o.opts.OnReject != nil {
+					o.opts.OnReject(t, err)
+				}
+			}
+		}
+		if _, err := tx.ExecContext(ctx, o.remove, r.id); err != nil {
+			return 0, err
+		}
+		handled++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if submitErr != nil {
+		return handled, fmt.Errorf("outbox: submitting task: %w", submitErr)
+	}
+	return handled, nil
+}
+
+// rejected reports whether the pool refuses a task whatever the time, so
+// retrying would not help
+func rejected(err error) bool {
+	var ve *pool.ValidationError
+	return errors.As(err, &ve) ||
+		errors.Is(err, pool.ErrCallbacksDisabled) ||
+		errors.Is(err, pool.ErrInvalidPayload) ||
+		errors.Is(err, pool.ErrTaskDropped) ||
+		errors.Is(err, pool.ErrIdempotentGroup)
+}
+
+func validTable(name string) bool {
+	return name != "" && strings.Trim(name, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_") == "" &&
+		(name[0] < '0' || name[0] > '9')
+}
@@ -0,0 +1,178 @@
+package go_playground
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// ErrTaskShed is recorded on tasks a shedding policy dropped from a full
+// queue, queued or just submitted
+var ErrTaskShed = errors.New("task shed from full queue")
+
+// OverflowPolicy decides what Submit does when the queue is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for room, up to the configured timeout if any
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReject fails right away with ErrQueueFull
+	OverflowReject
+	// OverflowShedOldest evicts the oldest queued task to make room
+	OverflowShedOldest
+	// OverflowShedNewest drops the submitted task. Submit still succeeds
+	// and the task is recorded as failed with ErrTaskShed
+	OverflowShedNewest
+	// OverflowShedLowestPriority evicts the queued task with the lowest
+	// priority, the newest among equals, or drops the submitted task when
+	// its priority is not higher
+	OverflowShedLowestPriority
+	// OverflowSample evicts a random queued task or drops the submitted one,
+	// all equally likely, so the queue holds a uniform sample of the load
+	OverflowSample
+)
+
+// overflowPolicies lists the policies in the order of their names in errors
+var overflowPolicies = []OverflowPolicy{
+	OverflowBlock, OverflowReject, OverflowShedOldest, OverflowShedNewest, OverflowShedLowestPriority, OverflowSample,
+}
+
+// String returns the policy name
+func (op OverflowPolicy) String() string {
+	switch op {
+	case OverflowBlock:
+		return "block"
+	case OverflowReject:
+		return "reject"
+	case OverflowShedOldest:
+		return "shed-oldest"
+	case OverflowShedNewest:
+		return "shed-newest"
+	case OverflowShedLowestPriority:
+		return "shed-lowest-priority"
+	case OverflowSample:
+		return "sample"
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", int(op))
+}
+
+// ParseOverflowPolicy accepts the names returned by String
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	for _, op := range overflowPolicies {
+		if s == op.String() {
+			return op, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid overflow policy %q, want block, reject, shed-oldest, shed-newest, shed-lowest-priority or sample", s)
+}
+
+// shedPicker chooses the queued task to drop in favour of t, returning its
+// index or -1 to drop t itself
+type shedPicker func(queued []*queuedTask, t Task) int
+
+// shedPickers maps the shedding policies to their choice of task
+var shedPickers = map[OverflowPolicy]shedPicker{
+	OverflowShedOldest:         shedOldest,
+	OverflowShedNewest:         func([]*queuedTask, Task) int { return -1 },
+	OverflowShedLowestPriority: shedLowestPriority,
+	OverflowSample:             shedSample,
+}
+
+func shedOldest(queued []*queuedTask, _ Task) int {
+	oldest := 0
+	for i, qt := range queued {
+		if qt.seq < queued[oldest].seq {
+			oldest = i
+		}
+	}
+	return oldest
+}
+
+func shedLowestPriority(queued []*queuedTask, t Task) int {
+	lowest := 0
+	for i, qt := range queued {
+		l := queued[lowest]
+		if qt.task.Priority < l.task.Priority || (qt.task.Priority == l.task.Priority && qt.seq > l.seq) {
+			lowest = i
+		}
+	}
+	if t.Priority <= queued[lowest].task.Priority {
+		return -1
+	}
+	return lowest
+}
+
+func shedSample(queued []*queuedTask, _ Task) int {
+	if i := rand.IntN(len(queued) + 1); i < len(queued) {
+		return i
+	}
+	return -1
+}
+
+// boundedQueue is implemented by backends with a fixed capacity, such as
+// MemoryQueue. Unbounded backends always use a plain Push
+type boundedQueue interface {
+	PushWait(t Task, timeout time.Duration) error
+	PushEvict(t Task) (evicted Task, ok bool, err error)
+}
+
+// shedQueue is implemented by bounded backends that can shed any task.
+// Others shed their oldest task whatever the policy
+type shedQueue interface {
+	pushShed(t Task, pick shedPicker) (shed Task, ok bool, err error)
+}
+
+// errShedOnArrival tells enqueue the overflow policy dropped the submitted
+// task, which is already recorded
+var errShedOnArrival = errors.New("task shed on arrival")
+
+// pushBounded applies the overflow policy. It reports false when the
+// backend is unbounded and the caller should fall back to Push
+func (p *WorkerPool) pushBounded(task Task) (bool, error) {
+	bq, ok := p.queue.(boundedQueue)
+	if !ok {
+		return false, nil
+	}
+
+	switch p.overflow {
+	case OverflowReject:
+		return true, bq.PushWait(task, 0)
+	case OverflowShedOldest, OverflowShedNewest, OverflowShedLowestPriority, OverflowSample:
+		var (
+			shed Task
+			ok   bool
+			err  error
+		)
+		if sq, can := p.queue.(shedQueue); can {
+			shed, ok, err = sq.pushShed(task, shedPickers[p.overflow])
+		} else {
+			shed, ok, err = bq.PushEvict(task)
+		}
+		if ok && shed.ID == task.ID {
+			p.taskLogger(task).Warn("task shed on arrival at full queue", "policy", p.overflow)
+			p.metrics.shed.WithLabelValues("incoming").Inc()
+			p.track(task, StateFailed, ErrTaskShed)
+			return true, errShedOnArrival
+		}
+		if ok {
+			p.taskLogger(shed).Warn("task shed from full queue", "policy", p.overflow, "replaced_by", task.ID)
+			p.metrics.shed.WithLabelValues("queued").Inc()
+			p.track(shed, StateFailed, ErrTaskShed)
+		}
+		return true, err
+	default:
+		timeout := p.overflowTimeout
+		if timeout <= 0 {
+			timeout = -1
+		}
+		return true, bq.PushWait(task, timeout)
+	}
+}
+
+// retryAfter estimates how long until the queue has room again
+func (p *WorkerPool) retryAfter() time.Duration {
+	workers := max(p.Workers(), 1)
+	d := p.avgLatency() * time.Duration(p.QueueDepth()) / time.Duration(workers)
+	return min(max(d, time.Second), time.Minute)
+}
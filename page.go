@@ -0,0 +1,118 @@
+package go_playground
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bounds of the limit query parameter of the list endpoints
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// NextCursorHeader carries the cursor of the next page of a listing, absent
+// on the last page. The Link header holds the URL of that page as well
+const NextCursorHeader = "X-Next-Cursor"
+
+// encodeCursor makes the opaque cursor resuming a listing of kind past the
+// item identified by parts
+func encodeCursor(kind string, parts ...string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(append([]string{kind}, parts...), "\n")))
+}
+
+// decodeCursor reads the cursor query parameter of a listing of kind,
+// returning the n parts it was made of, nil without a cursor
+func decodeCursor(r *http.Request, kind string, n int) ([]string, error) {
+	v := r.URL.Query().Get("cursor")
+	if v == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(v)
+	parts := strings.Split(string(raw), "\n")
+	if err != nil || len(parts) != n+1 || parts[0] != kind {
+		return nil, &badRequestError{field: "cursor", msg: "invalid cursor, pass the one of the previous page unchanged"}
+	}
+	return parts[1:], nil
+}
+
+// parseLimit reads the limit query parameter, up to maxPageLimit
+func parseLimit(r *http.Request, def int) (int, error) {
+	s := r.URL.Query().Get("limit")
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > maxPageLimit {
+		return 0, &badRequestError{field: "limit", msg: fmt.Sprintf("limit must be between 1 and %d", maxPageLimit)}
+	}
+	return n, nil
+}
+
+// parseSort reads the sort query parameter, one of fields optionally
+// prefixed with - for descending order, the first field by default
+func parseSort(r *http.Request, fields ...string) (field string, desc bool, err error) {
+	s := r.URL.Query().Get("sort")
+	if s == "" {
+		return fields[0], false, nil
+	}
+	field, desc = strings.CutPrefix(s, "-")
+	if !slices.Contains(fields, field) {
+		return "", false, &badRequestError{field: "sort", msg: fmt.Sprintf("invalid sort %q, want one of %s, - prefixed for descending order", s, strings.Join(fields, ", "))}
+	}
+	return field, desc, nil
+}
+
+// parseTimeRange reads the since and until query parameters, RFC 3339
+// times
+func parseTimeRange(r *http.Request) (since, until time.Time, err error) {
+	v := r.URL.Query()
+	for _, tp := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &since}, {"until", &until}} {
+		if s := v.Get(tp.name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return since, until, &badRequestError{field: tp.name, msg: fmt.Sprintf("invalid %s %q, want an RFC 3339 time", tp.name, s)}
+			}
+			*tp.dst = t
+		}
+	}
+	return since, until, nil
+}
+
+// inRange reports whether t is within since, inclusive, and until,
+// exclusive, zero bounds being open
+func inRange(t, since, until time.Time) bool {
+	return (since.IsZero() || !t.Before(since)) && (until.IsZero() || t.Before(until))
+}
+
+// page returns the sorted items past the cursor, those for which past is
+// false being skipped, up to limit and whether more follow
+func page[T any](items []T, past func(T) bool, limit int) ([]T, bool) {
+	if past != nil {
+		i := slices.IndexFunc(items, past)
+		if i < 0 {
+			return nil, false
+		}
+		items = items[i:]
+	}
+	if len(items) > limit {
+		return items[:limit], true
+	}
+	return items, false
+}
+
+// setNextPage points the client at the page following the one served
+func setNextPage(w http.ResponseWriter, r *http.Request, cursor string) {
+	q := r.URL.Query()
+	q.Set("cursor", cursor)
+	w.Header().Set(NextCursorHeader, cursor)
+	w.Header().Set("Link", fmt.Sprintf("<%s?%s>; rel=\"next\"", r.URL.Path, q.Encode()))
+}
@@ -0,0 +1,57 @@
+package go_playground
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// PanicError is recorded on a task whose handler panicked
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task handler panicked: %v", e.Value)
+}
+
+// panicError wraps a recovered value, keeping the PanicError of a panic
+// raised again from another goroutine, see Hedging
+func panicError(v any) *PanicError {
+	if perr, ok := v.(*PanicError); ok {
+		return perr
+	}
+	return &PanicError{Value: v, Stack: debug.Stack()}
+}
+
+// recoverWorker fails the task a worker panicked on and starts a
+// replacement, so a buggy handler never shrinks the pool. Panics are not
+// retried
+func (p *WorkerPool) recoverWorker(id int, task Task, elapsed time.Duration, perr *PanicError) {
+	p.failPanicked(id, task, elapsed, perr)
+	if p.leaveDrained(id) {
+		// It was leaving anyway
+		return
+	}
+
+	// The replacement is started even while shutting down, the queue still
+	// has to be drained
+	p.mu.Lock()
+	p.startWorkerLocked()
+	p.mu.Unlock()
+}
+
+// failPanicked dead-letters the task whose handler panicked
+func (p *WorkerPool) failPanicked(id int, task Task, elapsed time.Duration, perr *PanicError) {
+	p.metrics.panics.Inc()
+	p.notes.panicked()
+	p.metrics.observe(elapsed, perr)
+	p.breaker.report(perr)
+	if rec, err := p.store.Get(task.ID); err == nil {
+		task.Attempts = rec.Attempts
+	}
+	p.taskLogger(task).With("worker", id).Error("worker panicked",
+		"panic", fmt.Sprint(perr.Value), "stack", string(perr.Stack))
+	p.deadLetter(task, perr)
+}
@@ -0,0 +1,103 @@
+package go_playground
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidPayload is returned for task data that cannot be decoded into
+// the expected payload type. Such tasks are never retried
+var ErrInvalidPayload = errors.New("invalid task payload")
+
+// PayloadCodec converts typed payloads to and from Task.Data
+type PayloadCodec[T any] interface {
+	Encode(v T) (string, error)
+	Decode(data string) (T, error)
+}
+
+// JSONPayload is a PayloadCodec storing payloads as JSON
+type JSONPayload[T any] struct{}
+
+// Encode implements PayloadCodec
+func (JSONPayload[T]) Encode(v T) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// Decode implements PayloadCodec
+func (JSONPayload[T]) Decode(data string) (T, error) {
+	var v T
+	err := json.Unmarshal([]byte(data), &v)
+	return v, err
+}
+
+// Typed submits payloads of type T to a pool and decodes them back, so
+// producers and handlers share one compile-time checked type
+type Typed[T any] struct {
+	pool  *WorkerPool
+	codec PayloadCodec[T]
+}
+
+// NewTyped wraps p for payloads of type T. A nil codec means JSONPayload
+func NewTyped[T any](p *WorkerPool, codec PayloadCodec[T]) *Typed[T] {
+	if codec == nil {
+		codec = JSONPayload[T]{}
+	}
+	return &Typed[T]{pool: p, codec: codec}
+}
+
+// Submit encodes v into the Data of task and submits it. The other task
+// fields, such as Priority or Delay, are used as given
+func (tq *Typed[T]) Submit(v T, task Task) (Task, error) {
+	data, err := tq.codec.Encode(v)
+	if err != nil {
+		return task, fmt.Errorf("encoding payload: %w", err)
+	}
+	task.Data = data
+	return tq.pool.Submit(task)
+}
+
+// SubmitBatch encodes every payload on a copy of task and submits them
+// together, see WorkerPool.SubmitBatch
+func (tq *Typed[T]) SubmitBatch(vs []T, task Task) ([]Task, error) {
+	tasks := make([]Task, len(vs))
+	for i, v := range vs {
+		data, err := tq.codec.Encode(v)
+		if err != nil {
+			return nil, fmt.Errorf("encoding payload %d: %w", i, err)
+		}
+		tasks[i] = task
+		tasks[i].Data = data
+	}
+	return tq.pool.SubmitBatch(tasks)
+}
+
+// Payload decodes the data of t
+func (tq *Typed[T]) Payload(t Task) (T, error) {
+	return decodePayload(tq.codec, t)
+}
+
+// TypedHandler adapts fn to a TaskHandler that decodes each task's data
+// first. A nil codec means JSONPayload
+func TypedHandler[T any](codec PayloadCodec[T], fn func(ctx context.Context, v T, t Task) error) TaskHandler {
+	if codec == nil {
+		codec = JSONPayload[T]{}
+	}
+	return TaskHandlerFunc(func(ctx context.Context, t Task) error {
+		v, err := decodePayload(codec, t)
+		if err != nil {
+			return err
+		}
+		return fn(ctx, v, t)
+	})
+}
+
+func decodePayload[T any](codec PayloadCodec[T], t Task) (T, error) {
+	v, err := codec.Decode(t.Data)
+	if err != nil {
+		return v, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	return v, nil
+}
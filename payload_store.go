@@ -0,0 +1,196 @@
+package go_playground
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoPayloadStore is returned for payload references on a pool without
+// WithPayloadStore
+var ErrNoPayloadStore = errors.New("no payload store configured")
+
+// PayloadStore keeps payloads too large to travel in Task.Data, which then
+// carries a reference to them in Task.PayloadRef, see POST /events/upload
+type PayloadStore interface {
+	// Put stores the content of r under name, returning its size
+	Put(ctx context.Context, name string, r io.Reader) (int64, error)
+	// Open reads the payload stored under name, failing with an error
+	// matching fs.ErrNotExist when there is none
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// DirPayloadStore keeps payloads as files of a local or shared directory
+type DirPayloadStore struct {
+	Dir string
+}
+
+// Put implements PayloadStore. The file appears complete or not at all
+func (s DirPayloadStore) Put(_ context.Context, name string, r io.Reader) (int64, error) {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return 0, err
+	}
+	f, err := os.CreateTemp(s.Dir, name+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.file(name))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return 0, err
+	}
+	return n, nil
+}
+
+// Open implements PayloadStore
+func (s DirPayloadStore) Open(_ context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(s.file(name))
+}
+
+// Delete implements PayloadStore, ignoring payloads already gone
+func (s DirPayloadStore) Delete(_ context.Context, name string) error {
+	if err := os.Remove(s.file(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s DirPayloadStore) file(name string) string {
+	return filepath.Join(s.Dir, filepath.Base(name))
+}
+
+// OpenPayload reads the payload of the task run with ctx: the stored one
+// for a task with a PayloadRef, else its Data. A stored payload that is
+// gone fails with ErrInvalidPayload, so the task is not retried
+func OpenPayload(ctx context.Context, t Task) (io.ReadCloser, error) {
+	if t.PayloadRef == "" {
+		return io.NopCloser(strings.NewReader(t.Data)), nil
+	}
+	slot, ok := ctx.Value(checkpointKey{}).(*checkpointSlot)
+	if !ok {
+		return nil, ErrNoTask
+	}
+	if slot.p.payloads == nil {
+		return nil, ErrNoPayloadStore
+	}
+	rc, err := slot.p.payloads.Open(ctx, t.PayloadRef)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: payload %s is gone", ErrInvalidPayload, t.PayloadRef)
+	}
+	return rc, err
+}
+
+// dropPayload deletes the stored payload of a task done for good. Those of
+// dead-lettered tasks are kept for a retry
+func (p *WorkerPool) dropPayload(task Task) {
+	if task.PayloadRef == "" || p.payloads == nil {
+		return
+	}
+	if err := p.payloads.Delete(context.Background(), task.PayloadRef); err != nil {
+		p.taskLogger(task).Error("deleting payload", "payload_ref", task.PayloadRef, "error", err)
+	}
+}
+
+// newPayloadRef returns a random name for a stored payload
+func newPayloadRef() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// uploadResponse is the body of POST /events/upload
+type uploadResponse struct {
+	ID         int    `json:"id"`
+	PayloadRef string `json:"payload_ref"`
+	Size       int64  `json:"size"`
+}
+
+// uploadHandler streams the raw request body to the payload store of the
+// pool and submits a task referencing it. The other fields of the event
+// are query parameters named like the JSON ones of POST /event
+func (s *Server) uploadHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	p, ok := s.target(w, r, q.Get("queue"))
+	if !ok {
+		return
+	}
+	if p.payloads == nil {
+		writeError(w, http.StatusNotImplemented, ErrNoPayloadStore.Error(), "")
+		return
+	}
+	priority, err := ParsePriority(q.Get("priority"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), "priority")
+		return
+	}
+	key, err := idempotencyKey(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	task := Task{
+		Priority:       priority,
+		Tenant:         TenantID(r.Context()),
+		CorrelationID:  CorrelationID(r.Context()),
+		IdempotencyKey: key,
+	}
+	TraceTask(r.Context(), &task)
+	s.propagateHeaders(r, &task)
+	req := eventRequest{
+		Delay:        q.Get("delay"),
+		Timeout:      q.Get("timeout"),
+		TTL:          q.Get("ttl"),
+		Type:         q.Get("type"),
+		PartitionKey: q.Get("partition_key"),
+		Tenant:       q.Get("tenant"),
+		CallbackURL:  q.Get("callback_url"),
+	}
+	if q.Has("data") {
+		data := q.Get("data")
+		req.Data = &data
+	}
+	if err := req.apply(&task); err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	ref := newPayloadRef()
+	size, err := p.payloads.Put(r.Context(), ref, r.Body)
+	if err != nil {
+		_ = p.payloads.Delete(context.WithoutCancel(r.Context()), ref)
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("body must be at most %d bytes", mbe.Limit), "")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "storing payload: "+err.Error(), "")
+		return
+	}
+	task.PayloadRef = ref
+	task, err = p.SubmitContext(submitContext(r), task)
+	// A duplicate submission answers with the earlier task and its payload
+	if err != nil || task.PayloadRef != ref {
+		_ = p.payloads.Delete(context.WithoutCancel(r.Context()), ref)
+	}
+	if err != nil {
+		submitError(w, p, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, uploadResponse{ID: task.ID, PayloadRef: task.PayloadRef, Size: size})
+}
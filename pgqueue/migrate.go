@@ -0,0 +1,133 @@
+package pgqueue
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// migration is one step of the schema, applied once in its own
+// transaction. {p} stands for the table prefix
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// migrations are applied in order. Released ones must never change, new
+// schema changes go in a new migration at the end
+var migrations = []migration{
+	{1, "create tasks, completions and schedules", `
+CREATE TABLE IF NOT EXISTS {p}_tasks (
+	id           bigint PRIMARY KEY,
+	priority     integer NOT NULL,
+	body         bytea NOT NULL,
+	leased_until timestamptz,
+	lease_owner  text
+);
+CREATE INDEX IF NOT EXISTS {p}_tasks_pending ON {p}_tasks (priority DESC, id) WHERE leased_until IS NULL;
+CREATE INDEX IF NOT EXISTS {p}_tasks_leased ON {p}_tasks (leased_until) WHERE leased_until IS NOT NULL;
+CREATE SEQUENCE IF NOT EXISTS {p}_task_ids;
+CREATE TABLE IF NOT EXISTS {p}_completed (
+	key        text PRIMARY KEY,
+	expires_at timestamptz NOT NULL
+);
+CREATE TABLE IF NOT EXISTS {p}_schedules (
+	name text PRIMARY KEY,
+	def  text NOT NULL
+);`},
+	{2, "create results", `
+CREATE TABLE IF NOT EXISTS {p}_results (
+	id         bigint PRIMARY KEY,
+	data       bytea NOT NULL,
+	expires_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS {p}_results_expiry ON {p}_results (expires_at);`},
+	{3, "create quarantine", `
+CREATE TABLE IF NOT EXISTS {p}_quarantine (
+	id             bigint PRIMARY KEY,
+	body           bytea NOT NULL,
+	reason         text NOT NULL,
+	quarantined_at timestamptz NOT NULL DEFAULT now()
+);`},
+	{4, "create dead letters", `
+CREATE TABLE IF NOT EXISTS {p}_dead_letters (
+	id        bigint PRIMARY KEY,
+	body      bytea NOT NULL,
+	failed_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS {p}_dead_letters_failed ON {p}_dead_letters (failed_at);`},
+}
+
+// Migrate brings the tables of prefix to the latest schema and returns the
+// number of migrations applied. Processes starting together wait for each
+// other on an advisory lock, so each migration runs once. New calls it;
+// call it directly to migrate ahead of a deployment
+func Migrate(ctx context.Context, db *sql.DB, prefix string) (int, error) {
+	if err := checkPrefix(prefix); err != nil {
+		return 0, err
+	}
+	versions := prefix + "_schema_migrations"
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+versions+` (
+	version    integer PRIMARY KEY,
+	name       text NOT NULL,
+	applied_at timestamptz NOT NULL DEFAULT now()
+)`)
+	if err != nil {
+		return 0, fmt.Errorf("pgqueue: creating %s: %w", versions, err)
+	}
+
+	applied := 0
+	for _, m := range migrations {
+		done, err := migrate(ctx, db, prefix, versions, m)
+		if err != nil {
+			return applied, fmt.Errorf("pgqueue: migration %d (%s): %w", m.version, m.name, err)
+		}
+		if done {
+			applied++
+		}
+	}
+	return applied, nil
+}
+
+// migrate applies m unless it already was, reporting whether it ran
+func migrate(ctx context.Context, db *sql.DB, prefix, versions string, m migration) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	// Held until the transaction ends
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, versions); err != nil {
+		return false, err
+	}
+	var n int
+	if err := tx.QueryRowContext(ctx, `SELECT count(*) FROM `+versions+` WHERE version = $1`, m.version).Scan(&n); err != nil {
+		return false, err
+	}
+	if n > 0 {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, strings.ReplaceAll(m.sql, "{p}", prefix)); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO `+versions+` (version, name) VALUES ($1, $2)`, m.version, m.name); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// checkPrefix accepts lower case SQL identifiers only, as the prefix is
+// spliced into statements
+func checkPrefix(prefix string) error {
+	if prefix == "" || len(prefix) > 40 {
+		return fmt.Errorf("pgqueue: table prefix %q must be 1 to 40 characters", prefix)
+	}
+	for i, r := range prefix {
+		if r != '_' && (r < 'a' || r > 'z') && (i == 0 || r < '0' || r > '9') {
+			return fmt.Errorf("pgqueue: table prefix %q must be lower case letters, digits and underscores", prefix)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,496 @@
+// Package pgqueue is a QueueBackend stored in PostgreSQL, so several
+// server processes can work off one queue without running Redis. It works
+// on a *sql.DB of any Postgres driver, such as pgx's stdlib or lib/pq
+package pgqueue
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	pool "playground"
+)
+
+// Options configures a Queue
+type Options struct {
+	// Prefix starts the names of the tables, which must be a lower case
+	// SQL identifier. Defaults to "workerpool"
+	Prefix string
+	// VisibilityTimeout is how long a claimed task stays invisible to other
+	// consumers without its lease being renewed. Defaults to 30s
+	VisibilityTimeout time.Duration
+	// PollInterval is how often an idle consumer looks for new tasks.
+	// Defaults to 250ms
+	PollInterval time.Duration
+	// Logger receives lease maintenance errors. Defaults to slog.Default()
+	Logger *slog.Logger
+	// Codec sets how new tasks are stored. Defaults to pool.JSONCodec; tasks
+	// stored with any registered codec are still read back
+	Codec pool.Codec
+	// CompletionTTL is how long completed tasks and steps are remembered, so
+	// a redelivery within it does not run them again. Defaults to 24h
+	CompletionTTL time.Duration
+}
+
+// Queue keeps tasks in a table until they are acknowledged. Consumers
+// claim the best pending row with SELECT ... FOR UPDATE SKIP LOCKED, so
+// they never wait on each other, and lease it until a deadline renewed in
+// the background; expired leases of crashed consumers are requeued. The
+// queue is a pool.CompletionLog, a pool.ScheduleStore and a
+// pool.DeadLetterStore, and allocates task IDs from a sequence shared by
+// all its consumers
+type Queue struct {
+	db    *sql.DB
+	opts  Options
+	owner string // marks the leases of this process
+
+	tasks, completed, schedules, results, quarantine, dead, ids string // table and sequence names
+
+	mu     sync.Mutex
+	held   int // tasks claimed and not acknowledged yet
+	closed chan struct{}
+	once   sync.Once
+}
+
+// New migrates the schema of the tables and starts lease maintenance. The
+// caller owns db and closes it after the pool has shut down
+func New(ctx context.Context, db *sql.DB, opts Options) (*Queue, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = "workerpool"
+	}
+	if opts.VisibilityTimeout <= 0 {
+		opts.VisibilityTimeout = 30 * time.Second
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 250 * time.Millisecond
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.Codec == nil {
+		opts.Codec = pool.JSONCodec
+	}
+	if opts.CompletionTTL <= 0 {
+		opts.CompletionTTL = 24 * time.Hour
+	}
+	if _, err := Migrate(ctx, db, opts.Prefix); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	q := &Queue{
+		db:         db,
+		opts:       opts,
+		owner:      hex.EncodeToString(b),
+		tasks:      opts.Prefix + "_tasks",
+		completed:  opts.Prefix + "_completed",
+		schedules:  opts.Prefix + "_schedules",
+		results:    opts.Prefix + "_results",
+		quarantine: opts.Prefix + "_quarantine",
+		dead:       opts.Prefix + "_dead_letters",
+		ids:        opts.Prefix + "_task_ids",
+		closed:     make(chan struct{}),
+	}
+	go q.maintain()
+	return q, nil
+}
+
+// Push implements pool.QueueBackend
+func (q *Queue) Push(t pool.Task) error {
+	return q.PushBatch([]pool.Task{t})
+}
+
+// PushBatch adds all tasks in a single transaction
+func (q *Queue) PushBatch(ts []pool.Task) error {
+	if q.isClosed() {
+		return pool.ErrQueueClosed
+	}
+	ctx := context.Background()
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, t := range ts {
+		body, err := pool.MarshalTask(q.opts.Codec, t)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO `+q.tasks+` (id, priority, body) VALUES ($1, $2, $3)`, t.ID, t.Priority, body)
+		if err != nil {
+			return fmt.Errorf("pgqueue: inserting task %d: %w", t.ID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Pop implements pool.QueueBackend. Unlike the in-memory queue it stops
+// claiming as soon as the queue is closed and leaves the backlog to the
+// other consumers
+func (q *Queue) Pop() (pool.Task, error) {
+	for {
+		if q.isClosed() {
+			return pool.Task{}, pool.ErrQueueClosed
+		}
+
+		var body []byte
+		err := q.db.QueryRowContext(context.Background(), `
+UPDATE `+q.tasks+` SET leased_until = now() + $1::bigint * interval '1 millisecond', lease_owner = $2
+WHERE id = (
+	SELECT id FROM `+q.tasks+` WHERE leased_until IS NULL
+	ORDER BY priority DESC, id LIMIT 1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING body`, q.opts.VisibilityTimeout.Milliseconds(), q.owner).Scan(&body)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			select {
+			case <-time.After(q.opts.PollInterval):
+			case <-q.closed:
+			}
+			continue
+		case err != nil:
+			return pool.Task{}, err
+		}
+
+		t, err := pool.UnmarshalTask(body)
+		if err != nil {
+			return pool.Task{}, fmt.Errorf("pgqueue: decoding task: %w", err)
+		}
+		q.mu.Lock()
+		q.held++
+		q.mu.Unlock()
+		return t, nil
+	}
+}
+
+// Ack implements pool.QueueBackend. A lease that expired and was claimed
+// by another consumer is left to it
+func (q *Queue) Ack(t pool.Task) error {
+	_, err := q.db.ExecContext(context.Background(), `DELETE FROM `+q.tasks+` WHERE id = $1 AND lease_owner = $2`, t.ID, q.owner)
+	q.release()
+	return err
+}
+
+// AckTx deletes a claimed task as part of the caller's transaction, so the
+// handler's writes and the completion of its task commit together. Ack,
+// called by the pool afterwards, then finds nothing left to delete. It
+// reports false when the lease of the task was lost to another consumer
+func (q *Queue) AckTx(ctx context.Context, tx *sql.Tx, t pool.Task) (bool, error) {
+	res, err := tx.ExecContext(ctx, `DELETE FROM `+q.tasks+` WHERE id = $1 AND lease_owner = $2`, t.ID, q.owner)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (q *Queue) release() {
+	q.mu.Lock()
+	q.held = max(q.held-1, 0)
+	q.mu.Unlock()
+}
+
+// SaveCheckpoint replaces the leased copy of t, so whichever consumer
+// picks it up after an expired lease resumes from the checkpoint
+func (q *Queue) SaveCheckpoint(t pool.Task) error {
+	body, err := pool.MarshalTask(q.opts.Codec, t)
+	if err != nil {
+		return err
+	}
+	res, err := q.db.ExecContext(context.Background(), `UPDATE `+q.tasks+` SET body = $1 WHERE id = $2 AND lease_owner = $3`, body, t.ID, q.owner)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("pgqueue: lease of task %d expired", t.ID)
+	}
+	return nil
+}
+
+// Flush removes and returns every pending task, for all consumers of the
+// queue, in pop order. Leased tasks are left alone
+func (q *Queue) Flush() ([]pool.Task, error) {
+	rows, err := q.db.QueryContext(context.Background(), `
+WITH flushed AS (DELETE FROM `+q.tasks+` WHERE leased_until IS NULL RETURNING id, priority, body)
+SELECT body FROM flushed ORDER BY priority DESC, id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanTasks(rows)
+}
+
+// Pending returns the pending tasks in the order they are claimed, leaving
+// them queued. Tasks leased by consumers are not included
+func (q *Queue) Pending() ([]pool.Task, error) {
+	rows, err := q.db.QueryContext(context.Background(), `SELECT body FROM `+q.tasks+` WHERE leased_until IS NULL ORDER BY priority DESC, id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanTasks(rows)
+}
+
+func scanTasks(rows *sql.Rows) ([]pool.Task, error) {
+	defer rows.Close()
+	tasks := []pool.Task{}
+	for rows.Next() {
+		var body []byte
+		if err := rows.Scan(&body); err != nil {
+			return tasks, err
+		}
+		t, err := pool.UnmarshalTask(body)
+		if err != nil {
+			return tasks, fmt.Errorf("pgqueue: decoding task: %w", err)
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// Codec returns the codec new tasks are stored with, for the pool to
+// report what a pool.CompressedCodec saves
+func (q *Queue) Codec() pool.Codec { return q.opts.Codec }
+
+// StorageBytes implements pool.StorageSizer, adding up the live rows of
+// the tables of the queue. Unlike the table files, which only shrink once
+// vacuumed, it drops as soon as rows are deleted
+func (q *Queue) StorageBytes(ctx context.Context) (int64, error) {
+	var n int64
+	err := q.db.QueryRowContext(ctx, `SELECT
+	(SELECT coalesce(sum(pg_column_size(t.*)), 0) FROM `+q.tasks+` t) +
+	(SELECT coalesce(sum(pg_column_size(c.*)), 0) FROM `+q.completed+` c) +
+	(SELECT coalesce(sum(pg_column_size(s.*)), 0) FROM `+q.schedules+` s) +
+	(SELECT coalesce(sum(pg_column_size(r.*)), 0) FROM `+q.results+` r) +
+	(SELECT coalesce(sum(pg_column_size(x.*)), 0) FROM `+q.quarantine+` x)`).Scan(&n)
+	return n, err
+}
+
+// EvictCompleted implements pool.StorageEvicter, deleting the completion
+// marks and results expiring first
+func (q *Queue) EvictCompleted(ctx context.Context, n int) (int, error) {
+	var deleted int
+	err := q.db.QueryRowContext(ctx, `
+WITH victims AS (
+	SELECT 'c' AS kind, key AS k, expires_at FROM `+q.completed+`
+	UNION ALL
+	SELECT 'r', id::text, expires_at FROM `+q.results+`
+	ORDER BY expires_at LIMIT $1
+), marks AS (
+	DELETE FROM `+q.completed+` WHERE key IN (SELECT k FROM victims WHERE kind = 'c') RETURNING 1
+), results AS (
+	DELETE FROM `+q.results+` WHERE id::text IN (SELECT k FROM victims WHERE kind = 'r') RETURNING 1
+)
+SELECT (SELECT count(*) FROM marks) + (SELECT count(*) FROM results)`, n).Scan(&deleted)
+	return deleted, err
+}
+
+// Len implements pool.QueueBackend
+func (q *Queue) Len() int {
+	var n int
+	if err := q.db.QueryRowContext(context.Background(), `SELECT count(*) FROM `+q.tasks+` WHERE leased_until IS NULL`).Scan(&n); err != nil {
+		return 0
+	}
+	return n
+}
+
+// Close implements pool.QueueBackend. Leases of tasks still being worked on
+// keep getting renewed until they are acknowledged. It does not close the
+// database
+func (q *Queue) Close() error {
+	q.once.Do(func() { close(q.closed) })
+	return nil
+}
+
+// Ping checks that Postgres answers
+func (q *Queue) Ping(ctx context.Context) error {
+	return q.db.PingContext(ctx)
+}
+
+// NextID implements pool.IDGenerator with IDs unique across all processes
+// sharing the queue. Pools on this queue always use it, as tasks of equal
+// priority are ordered by ID
+func (q *Queue) NextID() (int, error) {
+	var id int
+	err := q.db.QueryRowContext(context.Background(), `SELECT nextval('`+q.ids+`')`).Scan(&id)
+	return id, err
+}
+
+// Completed implements pool.CompletionLog
+func (q *Queue) Completed(key string) (bool, error) {
+	var n int
+	err := q.db.QueryRowContext(context.Background(), `SELECT count(*) FROM `+q.completed+` WHERE key = $1 AND expires_at > now()`, key).Scan(&n)
+	return n > 0, err
+}
+
+// MarkCompleted implements pool.CompletionLog, remembering key for
+// Options.CompletionTTL
+func (q *Queue) MarkCompleted(key string) error {
+	_, err := q.db.ExecContext(context.Background(), `
+INSERT INTO `+q.completed+` (key, expires_at) VALUES ($1, now() + $2::bigint * interval '1 millisecond')
+ON CONFLICT (key) DO UPDATE SET expires_at = EXCLUDED.expires_at`, key, q.opts.CompletionTTL.Milliseconds())
+	return err
+}
+
+// SaveResult implements pool.ResultStore, keeping the result for ttl
+func (q *Queue) SaveResult(id int, data []byte, ttl time.Duration) error {
+	_, err := q.db.ExecContext(context.Background(), `
+INSERT INTO `+q.results+` (id, data, expires_at) VALUES ($1, $2, now() + $3::bigint * interval '1 millisecond')
+ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data, expires_at = EXCLUDED.expires_at`, id, data, ttl.Milliseconds())
+	return err
+}
+
+// LoadResult implements pool.ResultStore
+func (q *Queue) LoadResult(id int) ([]byte, error) {
+	var data []byte
+	err := q.db.QueryRowContext(context.Background(), `SELECT data FROM `+q.results+` WHERE id = $1 AND expires_at > now()`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, pool.ErrNoResult
+	}
+	return data, err
+}
+
+// SaveSchedule implements pool.ScheduleStore, sharing the schedule with
+// every process on the queue
+func (q *Queue) SaveSchedule(def pool.ScheduleDef) error {
+	v, err := json.Marshal(def)
+	if err != nil {
+		return err
+	}
+	_, err = q.db.ExecContext(context.Background(), `
+INSERT INTO `+q.schedules+` (name, def) VALUES ($1, $2)
+ON CONFLICT (name) DO UPDATE SET def = EXCLUDED.def`, def.Name, string(v))
+	return err
+}
+
+// DeleteSchedule implements pool.ScheduleStore
+func (q *Queue) DeleteSchedule(name string) (bool, error) {
+	res, err := q.db.ExecContext(context.Background(), `DELETE FROM `+q.schedules+` WHERE name = $1`, name)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// LoadSchedules implements pool.ScheduleStore
+func (q *Queue) LoadSchedules() ([]pool.ScheduleDef, error) {
+	rows, err := q.db.QueryContext(context.Background(), `SELECT name, def FROM `+q.schedules+` ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	defs := []pool.ScheduleDef{}
+	for rows.Next() {
+		var name, v string
+		if err := rows.Scan(&name, &v); err != nil {
+			return defs, err
+		}
+		var def pool.ScheduleDef
+		if err := json.Unmarshal([]byte(v), &def); err != nil {
+			return nil, fmt.Errorf("pgqueue: decoding schedule %q: %w", name, err)
+		}
+		defs = append(defs, def)
+	}
+	return defs, rows.Err()
+}
+
+// SaveDeadLetter implements pool.DeadLetterStore, sharing the dead letter
+// with every process on the queue
+func (q *Queue) SaveDeadLetter(dl pool.DeadLetter) error {
+	v, err := pool.MarshalDeadLetter(q.opts.Codec, dl)
+	if err != nil {
+		return err
+	}
+	_, err = q.db.ExecContext(context.Background(), `
+INSERT INTO `+q.dead+` (id, body, failed_at) VALUES ($1, $2, $3)
+ON CONFLICT (id) DO UPDATE SET body = EXCLUDED.body, failed_at = EXCLUDED.failed_at`, dl.Task.ID, v, dl.FailedAt)
+	return err
+}
+
+// DeleteDeadLetter implements pool.DeadLetterStore
+func (q *Queue) DeleteDeadLetter(id int) (bool, error) {
+	res, err := q.db.ExecContext(context.Background(), `DELETE FROM `+q.dead+` WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// LoadDeadLetters implements pool.DeadLetterStore
+func (q *Queue) LoadDeadLetters() ([]pool.DeadLetter, error) {
+	rows, err := q.db.QueryContext(context.Background(), `SELECT id, body FROM `+q.dead+` ORDER BY failed_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	dls := []pool.DeadLetter{}
+	for rows.Next() {
+		var id int
+		var v []byte
+		if err := rows.Scan(&id, &v); err != nil {
+			return dls, err
+		}
+		dl, err := pool.UnmarshalDeadLetter(v)
+		if err != nil {
+			return nil, fmt.Errorf("pgqueue: decoding dead letter %d: %w", id, err)
+		}
+		dls = append(dls, dl)
+	}
+	return dls, rows.Err()
+}
+
+func (q *Queue) isClosed() bool {
+	select {
+	case <-q.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// maintain renews the leases held by this process, requeues expired ones
+// and forgets expired completions, until the queue is closed and every
+// held task is acknowledged
+func (q *Queue) maintain() {
+	ticker := time.NewTicker(q.opts.VisibilityTimeout / 3)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+		q.mu.Lock()
+		held := q.held
+		q.mu.Unlock()
+
+		if held > 0 {
+			_, err := q.db.ExecContext(ctx, `UPDATE `+q.tasks+` SET leased_until = now() + $1::bigint * interval '1 millisecond' WHERE lease_owner = $2 AND leased_until IS NOT NULL`,
+				q.opts.VisibilityTimeout.Milliseconds(), q.owner)
+			if err != nil {
+				q.opts.Logger.Error("pgqueue: renewing leases", "error", err)
+			}
+		} else if q.isClosed() {
+			return
+		}
+
+		res, err := q.db.ExecContext(ctx, `UPDATE `+q.tasks+` SET leased_until = NULL, lease_owner = NULL WHERE leased_until < now()`)
+		if err != nil {
+			q.opts.Logger.Error("pgqueue: requeueing expired leases", "error", err)
+		} else if n, _ := res.RowsAffected(); n > 0 {
+			q.opts.Logger.Warn("pgqueue: requeued tasks from expired leases", "count", n)
+		}
+		if _, err := q.db.ExecContext(ctx, `DELETE FROM `+q.completed+` WHERE expires_at < now()`); err != nil {
+			q.opts.Logger.Error("pgqueue: forgetting expired completions", "error", err)
+		}
+		if _, err := q.db.ExecContext(ctx, `DELETE FROM `+q.results+` WHERE expires_at < now()`); err != nil {
+			q.opts.Logger.Error("pgqueue: deleting expired results", "error", err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package pgqueue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	pool "playground"
+)
+
+// storedRow is a row of the tasks table
+type storedRow struct {
+	id, priority int
+	body         []byte
+	leasedUntil  sql.NullTime
+	owner        sql.NullString
+}
+
+// CheckConsistency implements pool.ConsistencyChecker. It looks for
+// expired leases, leases running past any deadline a consumer sets, lease
+// columns out of step, bodies that do not decode or disagree with their
+// row, an ID sequence behind the tasks and migrations out of step with
+// this version. Repairs requeue the leases, fix the columns and sequence,
+// apply missing migrations and move the rows that cannot be trusted to
+// the quarantine table, with the error as reason, for inspection
+func (q *Queue) CheckConsistency(ctx context.Context, repair bool) (pool.ConsistencyReport, error) {
+	var report pool.ConsistencyReport
+	var errs []error
+	issue := func(is pool.RecoveryIssue, fix func() error) {
+		if repair && fix != nil {
+			if err := fix(); err != nil {
+				errs = append(errs, fmt.Errorf("pgqueue: repairing %q: %w", is.Detail, err))
+			} else {
+				is.Repaired = true
+			}
+		}
+		report.Issues = append(report.Issues, is)
+	}
+
+	if err := q.checkMigrations(ctx, issue); err != nil {
+		return report, err
+	}
+
+	var now time.Time
+	if err := q.db.QueryRowContext(ctx, `SELECT now()`).Scan(&now); err != nil {
+		return report, err
+	}
+	rows, err := q.db.QueryContext(ctx, `SELECT id, priority, body, leased_until, lease_owner FROM `+q.tasks+` ORDER BY id`)
+	if err != nil {
+		return report, err
+	}
+	var stored []storedRow
+	for rows.Next() {
+		var r storedRow
+		if err := rows.Scan(&r.id, &r.priority, &r.body, &r.leasedUntil, &r.owner); err != nil {
+			rows.Close()
+			return report, err
+		}
+		stored = append(stored, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	// Deadlines are set to a visibility timeout from now, the margin
+	// covering slow renewals
+	latest := now.Add(2 * q.opts.VisibilityTimeout)
+	maxID := 0
+	for _, r := range stored {
+		maxID = max(maxID, r.id)
+		t, err := pool.UnmarshalTask(r.body)
+		if err == nil && t.ID != r.id {
+			err = fmt.Errorf("body holds task %d", t.ID)
+		}
+		if err != nil {
+			issue(pool.RecoveryIssue{Kind: pool.IssueSchema, TaskID: r.id, Detail: fmt.Sprintf("task body cannot be trusted: %v", err)},
+				func() error { return q.quarantineRow(ctx, r, err) })
+			continue
+		}
+		report.Held = append(report.Held, r.id)
+		if t.Priority != r.priority {
+			issue(pool.RecoveryIssue{Kind: pool.IssueSchema, TaskID: r.id, Detail: fmt.Sprintf("priority column at %d, the task at %d", r.priority, t.Priority)},
+				func() error {
+					_, err := q.db.ExecContext(ctx, `UPDATE `+q.tasks+` SET priority = $1 WHERE id = $2`, t.Priority, r.id)
+					return err
+				})
+		}
+		switch {
+		case r.leasedUntil.Valid != r.owner.Valid:
+			issue(pool.RecoveryIssue{Kind: pool.IssueSchema, TaskID: r.id, Detail: "lease deadline and owner set apart"},
+				func() error { return q.requeueRow(ctx, r) })
+		case !r.leasedUntil.Valid || r.owner.String == q.owner:
+		case r.leasedUntil.Time.Before(now):
+			issue(pool.RecoveryIssue{Kind: pool.IssueOrphanedClaim, TaskID: r.id,
+				Detail: fmt.Sprintf("lease of %s expired at %s", r.owner.String, r.leasedUntil.Time.Format(time.RFC3339))},
+				func() error { return q.requeueRow(ctx, r) })
+		case r.leasedUntil.Time.After(latest):
+			issue(pool.RecoveryIssue{Kind: pool.IssueStuckRunning, TaskID: r.id,
+				Detail: fmt.Sprintf("lease of %s runs until %s, past any deadline a consumer sets", r.owner.String, r.leasedUntil.Time.Format(time.RFC3339))},
+				func() error { return q.requeueRow(ctx, r) })
+		}
+	}
+
+	var last int
+	var called bool
+	if err := q.db.QueryRowContext(ctx, `SELECT last_value, is_called FROM `+q.ids).Scan(&last, &called); err != nil {
+		return report, errors.Join(append(errs, fmt.Errorf("pgqueue: reading %s: %w", q.ids, err))...)
+	}
+	if !called {
+		last = 0
+	}
+	if last < maxID {
+		issue(pool.RecoveryIssue{Kind: pool.IssueSchema, Detail: fmt.Sprintf("ID sequence at %d, behind task %d", last, maxID)},
+			func() error {
+				// Only ever raised, IDs being taken meanwhile
+				_, err := q.db.ExecContext(ctx, `SELECT setval('`+q.ids+`', greatest($1::bigint, (SELECT last_value FROM `+q.ids+`)))`, maxID)
+				return err
+			})
+	}
+	return report, errors.Join(errs...)
+}
+
+// checkMigrations reports the migrations not applied or unknown to this
+// version, applying the missing ones on repair
+func (q *Queue) checkMigrations(ctx context.Context, issue func(pool.RecoveryIssue, func() error)) error {
+	rows, err := q.db.QueryContext(ctx, `SELECT version, name FROM `+q.opts.Prefix+`_schema_migrations ORDER BY version`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		var name string
+		if err := rows.Scan(&version, &name); err != nil {
+			return err
+		}
+		applied[version] = true
+		if version > migrations[len(migrations)-1].version {
+			// Left alone: a newer version of the queue may be running
+			issue(pool.RecoveryIssue{Kind: pool.IssueSchema, Detail: fmt.Sprintf("migration %d (%s) is newer than this version", version, name)}, nil)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if !applied[m.version] {
+			issue(pool.RecoveryIssue{Kind: pool.IssueSchema, Detail: fmt.Sprintf("migration %d (%s) is not applied", m.version, m.name)},
+				func() error {
+					_, err := Migrate(ctx, q.db, q.opts.Prefix)
+					return err
+				})
+		}
+	}
+	return nil
+}
+
+// requeueRow drops the lease of r, unless it changed since it was read
+func (q *Queue) requeueRow(ctx context.Context, r storedRow) error {
+	_, err := q.db.ExecContext(ctx, `UPDATE `+q.tasks+` SET leased_until = NULL, lease_owner = NULL
+WHERE id = $1 AND leased_until IS NOT DISTINCT FROM $2 AND lease_owner IS NOT DISTINCT FROM $3`, r.id, r.leasedUntil, r.owner)
+	return err
+}
+
+// quarantineRow moves r into the quarantine table
+func (q *Queue) quarantineRow(ctx context.Context, r storedRow, reason error) error {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `INSERT INTO `+q.quarantine+` (id, body, reason) VALUES ($1, $2, $3)
+ON CONFLICT (id) DO UPDATE SET body = EXCLUDED.body, reason = EXCLUDED.reason, quarantined_at = now()`, r.id, r.body, reason.Error())
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+q.tasks+` WHERE id = $1`, r.id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
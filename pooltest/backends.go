@@ -0,0 +1,237 @@
+package pooltest
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pool "playground"
+	"playground/boltqueue"
+	"playground/pgqueue"
+	"playground/redisqueue"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Environment variables pointing the backends at servers already running,
+// such as the services of a CI job, rather than ones started for the test
+const (
+	RedisAddrEnv   = "POOLTEST_REDIS_ADDR"
+	PostgresDSNEnv = "POOLTEST_POSTGRES_DSN"
+)
+
+// Images of the containers started by RedisContainer and Postgres
+var (
+	RedisImage    = "redis:7-alpine"
+	PostgresImage = "postgres:17-alpine"
+)
+
+// Backend provides the queue backend of a test, releasing what it took
+// with t.Cleanup, nil for the one of the pool. Tests sharing a server get
+// their own prefix
+type Backend func(t testing.TB) pool.QueueBackend
+
+// Memory runs the pool on its in-memory queue, sized and ordered by the
+// pool options
+func Memory() Backend {
+	return func(testing.TB) pool.QueueBackend { return nil }
+}
+
+// Bolt runs the pool on a boltqueue in a file of the test directory
+func Bolt(opts ...boltqueue.Option) Backend {
+	return func(t testing.TB) pool.QueueBackend {
+		t.Helper()
+		db, err := bolt.Open(filepath.Join(t.TempDir(), "queue.db"), 0o600, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			t.Fatalf("pooltest: opening the bolt database: %v", err)
+		}
+		t.Cleanup(func() { _ = db.Close() })
+		q, err := boltqueue.New(db, opts...)
+		if err != nil {
+			t.Fatalf("pooltest: creating the bolt queue: %v", err)
+		}
+		return q
+	}
+}
+
+// Redis runs the pool on a redisqueue, on the server at RedisAddrEnv when
+// set and on an embedded miniredis otherwise. The Prefix of opts is
+// replaced by one of the test
+func Redis(opts redisqueue.Options) Backend {
+	return func(t testing.TB) pool.QueueBackend {
+		t.Helper()
+		addr := os.Getenv(RedisAddrEnv)
+		if addr == "" {
+			mr, err := miniredis.Run()
+			if err != nil {
+				t.Fatalf("pooltest: starting miniredis: %v", err)
+			}
+			t.Cleanup(mr.Close)
+			addr = mr.Addr()
+		}
+		return redisBackend(t, addr, opts)
+	}
+}
+
+// RedisContainer runs the pool on a redisqueue, on the server at
+// RedisAddrEnv when set and on a Redis container otherwise, for the
+// commands miniredis lacks. Tests are skipped without docker
+func RedisContainer(opts redisqueue.Options) Backend {
+	return func(t testing.TB) pool.QueueBackend {
+		t.Helper()
+		addr := os.Getenv(RedisAddrEnv)
+		if addr == "" {
+			addr = startContainer(t, RedisImage, "6379")
+		}
+		return redisBackend(t, addr, opts)
+	}
+}
+
+func redisBackend(t testing.TB, addr string, opts redisqueue.Options) pool.QueueBackend {
+	t.Helper()
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { _ = rdb.Close() })
+	if err := waitFor(func(ctx context.Context) error { return rdb.Ping(ctx).Err() }); err != nil {
+		t.Fatalf("pooltest: connecting to Redis at %s: %v", addr, err)
+	}
+	opts.Prefix = testPrefix()
+	t.Cleanup(func() {
+		// Registered after closing the client, so run before it
+		ctx := context.Background()
+		iter := rdb.Scan(ctx, 0, opts.Prefix+":*", 0).Iterator()
+		for iter.Next(ctx) {
+			rdb.Del(ctx, iter.Val())
+		}
+	})
+	return redisqueue.New(rdb, opts)
+}
+
+// Postgres runs the pool on a pgqueue, on the database at PostgresDSNEnv
+// when set and on a Postgres container otherwise, opened with the
+// database/sql driver registered as driver, such as "pgx" or "postgres".
+// The Prefix of opts is replaced by one of the test, whose tables are
+// dropped once it ends. Tests are skipped without docker
+func Postgres(driver string, opts pgqueue.Options) Backend {
+	return func(t testing.TB) pool.QueueBackend {
+		t.Helper()
+		dsn := os.Getenv(PostgresDSNEnv)
+		if dsn == "" {
+			addr := startContainer(t, PostgresImage, "5432", "POSTGRES_PASSWORD=pooltest")
+			dsn = "postgres://postgres:pooltest@" + addr + "/postgres?sslmode=disable"
+		}
+		db, err := sql.Open(driver, dsn)
+		if err != nil {
+			t.Fatalf("pooltest: opening the database: %v", err)
+		}
+		t.Cleanup(func() { _ = db.Close() })
+		if err := waitFor(db.PingContext); err != nil {
+			t.Fatalf("pooltest: connecting to Postgres: %v", err)
+		}
+		opts.Prefix = testPrefix()
+		t.Cleanup(func() { dropTables(t, db, opts.Prefix) })
+		q, err := pgqueue.New(context.Background(), db, opts)
+		if err != nil {
+			t.Fatalf("pooltest: creating the postgres queue: %v", err)
+		}
+		return q
+	}
+}
+
+// dropTables drops the tables and sequence of the queue of prefix
+func dropTables(t testing.TB, db *sql.DB, prefix string) {
+	ctx := context.Background()
+	rows, err := db.QueryContext(ctx, `SELECT tablename FROM pg_tables WHERE schemaname = current_schema() AND tablename LIKE $1`, prefix+`\_%`)
+	if err != nil {
+		t.Logf("pooltest: listing the tables of %s: %v", prefix, err)
+		return
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) == nil {
+			tables = append(tables, name)
+		}
+	}
+	rows.Close()
+	stmts := []string{`DROP SEQUENCE IF EXISTS ` + prefix + `_task_ids CASCADE`}
+	if len(tables) > 0 {
+		stmts = append(stmts, `DROP TABLE IF EXISTS `+strings.Join(tables, ", ")+` CASCADE`)
+	}
+	for _, stmt := range stmts {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Logf("pooltest: dropping the tables of %s: %v", prefix, err)
+		}
+	}
+}
+
+// testPrefix returns a prefix of keys and tables no other test uses, in
+// the lower case pgqueue requires
+func testPrefix() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return "pooltest_" + hex.EncodeToString(b)
+}
+
+// startup bounds how long a server takes to accept connections
+const startup = 30 * time.Second
+
+// waitFor calls ping until it succeeds or startup passed, returning its
+// last error then
+func waitFor(ping func(context.Context) error) error {
+	deadline := time.Now().Add(startup)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err := ping(ctx)
+		cancel()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// startContainer runs image with port published on a port of the
+// loopback interface, returning its address. The container is removed
+// once the test ends, and the test is skipped without docker
+func startContainer(t testing.TB, image, port string, env ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skipf("pooltest: docker is needed to run %s: %v", image, err)
+	}
+	args := []string{"run", "--detach", "--rm", "--publish", "127.0.0.1::" + port}
+	for _, e := range env {
+		args = append(args, "--env", e)
+	}
+	out, err := exec.Command("docker", append(args, image)...).Output()
+	if err != nil {
+		t.Skipf("pooltest: starting %s: %v", image, commandError(err))
+	}
+	id := strings.TrimSpace(string(out))
+	t.Cleanup(func() { _ = exec.Command("docker", "rm", "--force", id).Run() })
+
+	out, err = exec.Command("docker", "port", id, port+"/tcp").Output()
+	if err != nil {
+		t.Fatalf("pooltest: reading the port of %s: %v", image, commandError(err))
+	}
+	// One line per address the port is published on
+	addr, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return addr
+}
+
+// commandError adds the standard error of a failed command to err
+func commandError(err error) error {
+	if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(ee.Stderr)))
+	}
+	return err
+}
@@ -0,0 +1,179 @@
+// Package pooltest runs a worker pool against a real backend in a test, so
+// handlers can be tested end to end, and checks what became of their tasks
+package pooltest
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pool "playground"
+)
+
+// DefaultTimeout bounds the waits of the assertions, see WithTimeout
+const DefaultTimeout = 10 * time.Second
+
+// Harness is a pool started for a test, shut down as the test ends
+type Harness struct {
+	Pool    *pool.WorkerPool
+	t       testing.TB
+	timeout time.Duration
+}
+
+// Option configures a Harness
+type Option func(*config)
+
+type config struct {
+	backend Backend
+	opts    []pool.Option
+	timeout time.Duration
+}
+
+// WithBackend runs the pool on the backend b provides, Memory by default
+func WithBackend(b Backend) Option {
+	return func(c *config) { c.backend = b }
+}
+
+// WithPoolOptions configures the pool, after the backend, task store,
+// handler and logger of the harness so they may be overridden
+func WithPoolOptions(opts ...pool.Option) Option {
+	return func(c *config) { c.opts = append(c.opts, opts...) }
+}
+
+// WithTimeout bounds the waits of the assertions, DefaultTimeout by default
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) { c.timeout = d }
+}
+
+// New starts a pool running h on the backend of the options, with an
+// in-memory task store and a logger writing to the test log. The pool is
+// shut down once the test and its subtests are done
+func New(t testing.TB, h pool.TaskHandler, opts ...Option) *Harness {
+	t.Helper()
+	cfg := config{backend: Memory(), timeout: DefaultTimeout}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	w := &testWriter{t: t}
+	poolOpts := []pool.Option{
+		pool.WithTaskStore(pool.NewMemoryStore()),
+		pool.WithHandler(h),
+		pool.WithLogger(slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+	}
+	if q := cfg.backend(t); q != nil {
+		poolOpts = append(poolOpts, pool.WithQueueBackend(q))
+	}
+	p := pool.NewWorkerPool(append(poolOpts, cfg.opts...)...)
+	p.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+		defer cancel()
+		if err := p.Shutdown(ctx); err != nil {
+			t.Errorf("pooltest: shutting down the pool: %v", err)
+		}
+		// Lines logged past the end of a test panic
+		w.close()
+	})
+	return &Harness{Pool: p, t: t, timeout: cfg.timeout}
+}
+
+// Submit submits task, failing the test when the pool refuses it
+func (h *Harness) Submit(task pool.Task) pool.Task {
+	h.t.Helper()
+	task, err := h.Pool.Submit(task)
+	if err != nil {
+		h.t.Fatalf("pooltest: submitting the task: %v", err)
+	}
+	return task
+}
+
+// Wait returns the record of the task once it finished, failing the test
+// when it does not within the timeout
+func (h *Harness) Wait(id int) pool.TaskRecord {
+	h.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	rec, err := h.Pool.WaitTask(ctx, id)
+	if err != nil {
+		h.t.Fatalf("pooltest: task %d not finished after %s, %s: %v", id, h.timeout, describe(rec), err)
+	}
+	return rec
+}
+
+// EventuallyProcessed waits for the tasks to succeed, failing the test
+// when one fails, is canceled or is still running past the timeout. It
+// returns the records in the order of ids
+func (h *Harness) EventuallyProcessed(ids ...int) []pool.TaskRecord {
+	h.t.Helper()
+	recs := make([]pool.TaskRecord, len(ids))
+	for i, id := range ids {
+		recs[i] = h.Wait(id)
+		if recs[i].State != pool.StateSucceeded {
+			h.t.Fatalf("pooltest: task %d %s, want it to succeed", id, describe(recs[i]))
+		}
+	}
+	return recs
+}
+
+// FailedWith waits for the task to fail, retries included, with an error
+// whose message holds the one of err, failing the test otherwise. Records
+// keep errors as text, so errors.Is cannot tell
+func (h *Harness) FailedWith(id int, err error) pool.TaskRecord {
+	h.t.Helper()
+	rec := h.Wait(id)
+	if rec.State != pool.StateFailed || !strings.Contains(rec.Error, err.Error()) {
+		h.t.Fatalf("pooltest: task %d %s, want it to fail with %q", id, describe(rec), err)
+	}
+	return rec
+}
+
+// Eventually polls cond until it holds, failing the test with msg when it
+// does not within the timeout
+func (h *Harness) Eventually(cond func() bool, msg string) {
+	h.t.Helper()
+	deadline := time.Now().Add(h.timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			h.t.Fatalf("pooltest: %s, still not after %s", msg, h.timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// describe tells what became of the task of rec
+func describe(rec pool.TaskRecord) string {
+	if rec.State == "" {
+		return "unknown"
+	}
+	s := fmt.Sprintf("%s after %d attempts", rec.State, rec.Attempts)
+	if rec.Error != "" {
+		s += ": " + rec.Error
+	}
+	return s
+}
+
+// testWriter writes the pool log to the test log until closed
+type testWriter struct {
+	mu     sync.Mutex
+	t      testing.TB
+	closed bool
+}
+
+func (w *testWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.t.Log(strings.TrimSuffix(string(b), "\n"))
+	}
+	return len(b), nil
+}
+
+func (w *testWriter) close() {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+}
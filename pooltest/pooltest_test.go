@@ -0,0 +1,104 @@
+package pooltest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	pool "playground"
+	"playground/pooltest"
+	"playground/redisqueue"
+)
+
+var errBroken = errors.New("broken handler")
+
+// backends are those the tests run on without docker
+var backends = map[string]pooltest.Backend{
+	"memory":    pooltest.Memory(),
+	"bolt":      pooltest.Bolt(),
+	"miniredis": pooltest.Redis(redisqueue.Options{PollInterval: 10 * time.Millisecond}),
+}
+
+// handler fails the tasks of data "bad" for good and runs the others
+func handler() pool.TaskHandler {
+	return pool.TaskHandlerFunc(func(_ context.Context, task pool.Task) error {
+		if task.Data == "bad" {
+			return pool.Permanent(errBroken)
+		}
+		return nil
+	})
+}
+
+func TestEventuallyProcessed(t *testing.T) {
+	for name, b := range backends {
+		t.Run(name, func(t *testing.T) {
+			h := pooltest.New(t, handler(), pooltest.WithBackend(b))
+			var ids []int
+			for i := range 3 {
+				ids = append(ids, h.Submit(pool.Task{Data: fmt.Sprint(i)}).ID)
+			}
+			recs := h.EventuallyProcessed(ids...)
+			for i, rec := range recs {
+				if rec.ID != ids[i] || rec.State != pool.StateSucceeded {
+					t.Errorf("record %d = task %d %s, want task %d %s", i, rec.ID, rec.State, ids[i], pool.StateSucceeded)
+				}
+			}
+		})
+	}
+}
+
+func TestFailedWith(t *testing.T) {
+	for name, b := range backends {
+		t.Run(name, func(t *testing.T) {
+			h := pooltest.New(t, handler(), pooltest.WithBackend(b))
+			task := h.Submit(pool.Task{Data: "bad"})
+			if rec := h.FailedWith(task.ID, errBroken); rec.Attempts != 1 {
+				t.Errorf("task failed after %d attempts, want 1", rec.Attempts)
+			}
+		})
+	}
+}
+
+// fatalTB records the failure of an assertion instead of failing the test
+type fatalTB struct {
+	testing.TB
+	failed bool
+}
+
+func (f *fatalTB) Fatalf(string, ...any) {
+	f.failed = true
+	runtime.Goexit()
+}
+
+// fails reports whether assert, run on its own goroutine as Fatalf ends
+// it, fails the test
+func (f *fatalTB) fails(assert func()) bool {
+	f.failed = false
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert()
+	}()
+	<-done
+	return f.failed
+}
+
+func TestAssertionsFail(t *testing.T) {
+	tb := &fatalTB{TB: t}
+	h := pooltest.New(tb, handler(), pooltest.WithTimeout(time.Second))
+	good, bad := h.Submit(pool.Task{Data: "good"}), h.Submit(pool.Task{Data: "bad"})
+
+	for name, assert := range map[string]func(){
+		"EventuallyProcessed of a failed task": func() { h.EventuallyProcessed(good.ID, bad.ID) },
+		"FailedWith of a succeeded task":       func() { h.FailedWith(good.ID, errBroken) },
+		"FailedWith of another error":          func() { h.FailedWith(bad.ID, errors.New("other")) },
+		"Eventually of a condition never met":  func() { h.Eventually(func() bool { return false }, "never") },
+	} {
+		if !tb.fails(assert) {
+			t.Errorf("%s passed", name)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package go_playground
+
+import (
+	"context"
+	"time"
+)
+
+// Progress is the latest progress reported by a running task
+type Progress struct {
+	Percent   int       `json:"percent"` // 0 to 100
+	Message   string    `json:"message,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProgressReporter lets a handler report how far along its task is
+type ProgressReporter struct {
+	p    *WorkerPool
+	task Task
+}
+
+// progressKey is the context key of the task's ProgressReporter
+type progressKey struct{}
+
+// ProgressFrom returns the reporter of the task run with ctx. Outside of a
+// pool handler the reporter discards updates
+func ProgressFrom(ctx context.Context) *ProgressReporter {
+	if r, ok := ctx.Value(progressKey{}).(*ProgressReporter); ok {
+		return r
+	}
+	return &ProgressReporter{}
+}
+
+// Set records the progress on the task record and publishes it to event
+// subscribers. Percent is clamped to 0..100
+func (r *ProgressReporter) Set(percent int, msg string) {
+	if r.p == nil {
+		return
+	}
+	r.p.beat(r.task.ID, time.Now())
+	r.p.reportProgress(r.task, Progress{
+		Percent:   min(max(percent, 0), 100),
+		Message:   msg,
+		UpdatedAt: time.Now(),
+	})
+}
+
+// reportProgress stores progress on the record of a running task
+func (p *WorkerPool) reportProgress(task Task, pr Progress) {
+	rec, err := p.store.Get(task.ID)
+	if err != nil || rec.State != StateRunning {
+		return
+	}
+	rec.Progress = &pr
+	if err := p.store.Save(rec); err != nil {
+		p.taskLogger(task).Error("task store: saving progress", "error", err)
+		return
+	}
+	p.events.publish(TaskEvent{Task: rec.Task, State: rec.State, Progress: &pr, Time: pr.UpdatedAt})
+}
@@ -0,0 +1,239 @@
+package go_playground
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// DefaultConfirmationTTL is how long the confirmation token of a bulk
+// operation stays valid, see WithConfirmationTTL
+const DefaultConfirmationTTL = 5 * time.Minute
+
+// confirmationSample bounds the IDs listed by a BulkPreview
+const confirmationSample = 20
+
+// ErrConfirmationInvalid refuses a bulk operation whose confirmation token
+// is unknown, expired, used already or issued for another request
+var ErrConfirmationInvalid = errors.New("confirmation token is invalid or expired, ask for a new one")
+
+// PurgeTasks drops the queued tasks matching q, running ones being left
+// alone, so the flood of a bad producer can be cleared. Without a filter
+// the waiting tasks are flushed from the backend as with Flush, then the
+// delayed ones are cancelled; otherwise the matching tasks are cancelled,
+// skipped when they reach a worker
+func (p *WorkerPool) PurgeTasks(q TaskQuery) (BulkResult, error) {
+	q.State = StateQueued
+	res := BulkResult{Tasks: []BulkTask{}}
+	if q.unfiltered() {
+		tasks, err := p.flush()
+		if err != nil && !errors.Is(err, ErrFlushUnsupported) {
+			return res, err
+		}
+		for _, t := range tasks {
+			res.Tasks = append(res.Tasks, BulkTask{ID: t.ID})
+		}
+	}
+	rest, err := p.bulk(q, queuedRecord, func(rec TaskRecord) error { return p.Cancel(rec.ID) })
+	if errors.Is(err, ErrQueryUnsupported) && q.unfiltered() {
+		// Flushed, the delayed tasks are out of reach
+		return res, nil
+	}
+	res.Tasks = append(res.Tasks, rest.Tasks...)
+	return res, err
+}
+
+// queuedRecord selects the records of the tasks PurgeTasks drops
+func queuedRecord(rec TaskRecord) bool { return rec.State == StateQueued }
+
+// unfiltered reports whether q selects the tasks of every type, tenant,
+// label, UID and age
+func (q TaskQuery) unfiltered() bool {
+	return len(q.Labels) == 0 && q.Type == "" && q.Tenant == "" && q.UID == "" && q.Since.IsZero() && q.Until.IsZero() && q.Limit == 0
+}
+
+// BulkPreview answers a bulk operation asked without a confirmation token:
+// the tasks it would act on now, and the token to repeat the request with
+// as its confirm parameter to go ahead
+type BulkPreview struct {
+	Action       string    `json:"action"`
+	Matched      int       `json:"matched"`
+	Sample       []int     `json:"sample"` // IDs of the first matching tasks
+	ConfirmToken string    `json:"confirm_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// WithConfirmationTTL sets how long the confirmation tokens of bulk cancel
+// and purge stay valid. Defaults to DefaultConfirmationTTL
+func WithConfirmationTTL(ttl time.Duration) ServerOption {
+	return func(s *Server) {
+		if ttl > 0 {
+			s.confirms.ttl = ttl
+		}
+	}
+}
+
+// confirmations holds the tokens issued for bulk operations. A token is
+// bound to the action, queue, client and filters of the request it was
+// issued for, and used once
+type confirmations struct {
+	ttl time.Duration
+
+	mu     sync.Mutex
+	tokens map[string]pendingConfirmation
+}
+
+type pendingConfirmation struct {
+	request string
+	expires time.Time
+}
+
+// confirmationRequest identifies what a token confirms
+func confirmationRequest(r *http.Request, p *WorkerPool, action string) string {
+	v := r.URL.Query()
+	v.Del("confirm")
+	for _, vals := range v {
+		// Labels come in any order
+		slices.Sort(vals)
+	}
+	return url.Values{"action": {action}, "queue": {p.Name()}, "client": {ClientID(r.Context())}, "query": {v.Encode()}}.Encode()
+}
+
+// issue returns a new token for request
+func (c *confirmations) issue(request string, now time.Time) (string, time.Time) {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	token := hex.EncodeToString(b)
+	expires := now.Add(c.ttl)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for t, pc := range c.tokens {
+		if !now.Before(pc.expires) {
+			delete(c.tokens, t)
+		}
+	}
+	c.tokens[token] = pendingConfirmation{request: request, expires: expires}
+	return token, expires
+}
+
+// redeem reports whether token was issued for request and is still valid,
+// using it up
+func (c *confirmations) redeem(token, request string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pc, ok := c.tokens[token]
+	if !ok || pc.request != request {
+		return false
+	}
+	delete(c.tokens, token)
+	return now.Before(pc.expires)
+}
+
+func (s *Server) purgeRoutes(r *mux.Router) {
+	r.HandleFunc("/purge", s.confirmedBulkHandler(AuditPurgeTasks, false, (*WorkerPool).previewPurge, (*WorkerPool).PurgeTasks)).Methods("POST")
+}
+
+// previewPurge counts the tasks PurgeTasks would drop, from the backend
+// when the store cannot be searched
+func (p *WorkerPool) previewPurge(q TaskQuery) (int, []int, error) {
+	q.State = StateQueued
+	n, sample, err := p.preview(q, queuedRecord)
+	if errors.Is(err, ErrQueryUnsupported) && q.unfiltered() {
+		return p.QueueDepth(), nil, nil
+	}
+	return n, sample, err
+}
+
+// previewCancel counts the tasks CancelTasks would cancel
+func (p *WorkerPool) previewCancel(q TaskQuery) (int, []int, error) {
+	return p.preview(q, cancelableRecord)
+}
+
+// preview counts the records matching q that want selects, up to the
+// limit of q, and returns the first IDs
+func (p *WorkerPool) preview(q TaskQuery, want func(TaskRecord) bool) (int, []int, error) {
+	limit := q.Limit
+	q.Limit = 0
+	recs, err := p.Tasks(q)
+	if err != nil {
+		return 0, nil, err
+	}
+	n, sample := 0, []int{}
+	for _, rec := range recs {
+		if !want(rec) {
+			continue
+		}
+		if limit > 0 && n == limit {
+			break
+		}
+		if n++; len(sample) < confirmationSample {
+			sample = append(sample, rec.ID)
+		}
+	}
+	return n, sample, nil
+}
+
+// confirmedBulkHandler serves a bulk operation in two steps: a request
+// without a confirm parameter gets a BulkPreview, the same request with
+// its token then acts and is audited. With needFilter, requests without a
+// filter are refused
+func (s *Server) confirmedBulkHandler(action string, needFilter bool, preview func(*WorkerPool, TaskQuery) (int, []int, error), op func(*WorkerPool, TaskQuery) (BulkResult, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := s.target(w, r, "")
+		if !ok {
+			return
+		}
+		q, err := parseTaskQuery(r, 0)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		if needFilter && !hasFilter(w, q) {
+			return
+		}
+		request := confirmationRequest(r, p, action)
+		token := r.URL.Query().Get("confirm")
+		if token == "" {
+			n, sample, err := preview(p, q)
+			if !bulkQueryOK(w, err) {
+				return
+			}
+			token, expires := s.confirms.issue(request, time.Now())
+			writeJSON(w, http.StatusOK, BulkPreview{Action: action, Matched: n, Sample: sample, ConfirmToken: token, ExpiresAt: expires})
+			return
+		}
+		if !s.confirms.redeem(token, request, time.Now()) {
+			writeErrorCode(w, http.StatusConflict, CodeConfirmationInvalid, ErrConfirmationInvalid.Error(), "confirm")
+			return
+		}
+		res, err := op(p, q)
+		if !bulkQueryOK(w, err) {
+			return
+		}
+		params := r.URL.Query()
+		params.Del("confirm")
+		s.audit(r, p, action, map[string]any{"query": params.Encode(), "tasks": len(res.Tasks)}, nil)
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+// bulkQueryOK answers the error of a bulk operation, reporting whether
+// there was none
+func bulkQueryOK(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, ErrQueryUnsupported), errors.Is(err, ErrFlushUnsupported):
+		writeError(w, http.StatusNotImplemented, err.Error(), "")
+		return false
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error(), "")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,305 @@
+package go_playground
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Task priorities. Any int is valid, higher values run first
+const (
+	PriorityLow    = -1
+	PriorityNormal = 0
+	PriorityHigh   = 1
+)
+
+// ParsePriority accepts "low", "normal", "high" or an integer
+func ParsePriority(s string) (int, error) {
+	switch strings.ToLower(s) {
+	case "", "normal":
+		return PriorityNormal, nil
+	case "low":
+		return PriorityLow, nil
+	case "high":
+		return PriorityHigh, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid priority %q", s)
+	}
+	return n, nil
+}
+
+// ErrQueueClosed is returned by a QueueBackend that no longer accepts tasks,
+// or has no tasks left after being closed
+var ErrQueueClosed = errors.New("queue is closed")
+
+// ErrQueueFull is returned when a bounded queue has no room for a task
+var ErrQueueFull = errors.New("queue is full")
+
+// QueueBackend stores tasks until a worker picks them up
+type QueueBackend interface {
+	// Push adds a task, blocking while the backend is full
+	Push(t Task) error
+	// Pop removes the next task, blocking while the backend is empty.
+	// After Close it keeps returning tasks until drained, then ErrQueueClosed
+	Pop() (Task, error)
+	// Ack marks a popped task as finished so it is never delivered again.
+	// Durable backends redeliver unacknowledged tasks after a restart
+	Ack(t Task) error
+	// Len returns the number of tasks waiting to be popped
+	Len() int
+	// Close stops accepting tasks and wakes blocked callers
+	Close() error
+}
+
+// MemoryQueue is a bounded in-memory QueueBackend. Higher priority tasks
+// are popped first and tasks of equal priority keep their submission order
+type MemoryQueue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	items    pendingTasks
+	capacity int
+	seq      uint64
+	closed   bool
+}
+
+// NewMemoryQueue creates a queue holding at most capacity tasks, see
+// NewDispatchQueue for other orders than submission order
+func NewMemoryQueue(capacity int) *MemoryQueue {
+	return NewDispatchQueue(capacity, DispatchFIFO)
+}
+
+func newMemoryQueue(capacity int, items pendingTasks) *MemoryQueue {
+	q := &MemoryQueue{capacity: max(capacity, 1), items: items}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// Push implements QueueBackend
+func (q *MemoryQueue) Push(t Task) error {
+	return q.PushWait(t, -1)
+}
+
+// PushWait adds a task, waiting at most timeout for room. A negative
+// timeout waits forever and zero fails right away with ErrQueueFull
+func (q *MemoryQueue) PushWait(t Task, timeout time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// Allocated only when waiting, so the common push does not
+	var expired *bool
+	if timeout > 0 && !q.closed && q.items.Len() >= q.capacity {
+		e := new(bool)
+		expired = e
+		timer := time.AfterFunc(timeout, func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			*e = true
+			q.notFull.Broadcast()
+		})
+		defer timer.Stop()
+	}
+	for !q.closed && q.items.Len() >= q.capacity {
+		if timeout == 0 || (expired != nil && *expired) {
+			return ErrQueueFull
+		}
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	q.pushLocked(t)
+	return nil
+}
+
+// PushEvict adds a task, making room by removing the oldest queued task
+// when the queue is full. The evicted task is returned with ok set
+func (q *MemoryQueue) PushEvict(t Task) (evicted Task, ok bool, err error) {
+	return q.pushShed(t, shedOldest)
+}
+
+// pushShed adds a task, calling pick when the queue is full to choose the
+// queued task removed in its favour. When pick returns -1 the new task is
+// dropped instead. The task shed, either one, is returned with ok set
+func (q *MemoryQueue) pushShed(t Task, pick shedPicker) (shed Task, ok bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return Task{}, false, ErrQueueClosed
+	}
+
+	if q.items.Len() >= q.capacity {
+		qt, removed := q.items.shed(t, pick)
+		if !removed {
+			return t, true, nil
+		}
+		shed, ok = qt.task, true
+	}
+	q.pushLocked(t)
+	return shed, ok, nil
+}
+
+// PushBatch adds all tasks or none of them, failing with ErrQueueFull
+// rather than waiting when they do not fit
+func (q *MemoryQueue) PushBatch(ts []Task) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if q.items.Len()+len(ts) > q.capacity {
+		return ErrQueueFull
+	}
+
+	for _, t := range ts {
+		q.pushLocked(t)
+	}
+	return nil
+}
+
+func (q *MemoryQueue) pushLocked(t Task) {
+	q.seq++
+	q.items.add(queuedTask{task: t, seq: q.seq})
+	q.notEmpty.Signal()
+}
+
+// Pop implements QueueBackend
+func (q *MemoryQueue) Pop() (Task, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.closed && q.items.Len() == 0 {
+		q.notEmpty.Wait()
+	}
+	if q.items.Len() == 0 {
+		return Task{}, ErrQueueClosed
+	}
+
+	qt := q.items.next()
+	q.notFull.Signal()
+	return qt.task, nil
+}
+
+// Flush removes and returns every queued task
+func (q *MemoryQueue) Flush() ([]Task, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	tasks := q.items.drain()
+	q.notFull.Broadcast()
+	return tasks, nil
+}
+
+// Ack implements QueueBackend. Memory queues forget tasks once popped
+func (q *MemoryQueue) Ack(Task) error { return nil }
+
+// Len implements QueueBackend
+func (q *MemoryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.items.Len()
+}
+
+// Cap returns the number of tasks the queue holds at most
+func (q *MemoryQueue) Cap() int {
+	return q.capacity
+}
+
+// Close implements QueueBackend
+func (q *MemoryQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+	return nil
+}
+
+type queuedTask struct {
+	task Task
+	seq  uint64
+	rank uint64 // random, see DispatchRandom
+}
+
+// pendingTasks orders the tasks held by a MemoryQueue
+type pendingTasks interface {
+	Len() int
+	add(qt queuedTask)
+	// next removes the task to pop
+	next() queuedTask
+	// shed removes the task pick chooses to make room for t, if any
+	shed(t Task, pick shedPicker) (queuedTask, bool)
+	// drain removes every task
+	drain() []Task
+	// list returns every task, leaving them in place
+	list() []Task
+}
+
+// taskHeap implements heap.Interface ordered by priority, then following
+// its strategy. It holds pointers so that sifting swaps words instead of
+// whole tasks
+type taskHeap struct {
+	items    []*queuedTask
+	strategy DispatchStrategy
+}
+
+func (h *taskHeap) Len() int { return len(h.items) }
+
+func (h *taskHeap) Less(i, j int) bool { return h.strategy.before(h.items[i], h.items[j]) }
+
+func (h *taskHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *taskHeap) Push(x any) { h.items = append(h.items, x.(*queuedTask)) }
+
+func (h *taskHeap) Pop() any {
+	old := h.items
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	h.items = old[:n-1]
+	return x
+}
+
+// heapEntries recycles the entries of taskHeap, so a busy queue does not
+// allocate one per task pushed
+var heapEntries = sync.Pool{New: func() any { return new(queuedTask) }}
+
+func (h *taskHeap) add(qt queuedTask) {
+	e := heapEntries.Get().(*queuedTask)
+	*e = qt
+	h.strategy.queued(e)
+	heap.Push(h, e)
+}
+
+func (h *taskHeap) next() queuedTask { return release(heap.Pop(h).(*queuedTask)) }
+
+func (h *taskHeap) shed(t Task, pick shedPicker) (queuedTask, bool) {
+	i := pick(h.items, t)
+	if i < 0 {
+		return queuedTask{}, false
+	}
+	return release(heap.Remove(h, i).(*queuedTask)), true
+}
+
+func (h *taskHeap) drain() []Task {
+	tasks := make([]Task, len(h.items))
+	for i, e := range h.items {
+		tasks[i] = release(e).task
+	}
+	h.items = nil
+	return tasks
+}
+
+// release returns an entry removed from a taskHeap to heapEntries
+func release(e *queuedTask) queuedTask {
+	qt := *e
+	*e = queuedTask{} // drop the task for the collector
+	heapEntries.Put(e)
+	return qt
+}
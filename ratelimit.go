@@ -0,0 +1,138 @@
+package go_playground
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit configures per-client token buckets for task submission
+type RateLimit struct {
+	Rate  float64 // tokens added per second
+	Burst int     // bucket size
+	// Key identifies the client. Defaults to ClientKey
+	Key func(*http.Request) string
+}
+
+// ClientKey identifies a client by its authenticated name, else by its
+// X-API-Key header, falling back to the remote IP address
+func ClientKey(r *http.Request) string {
+	if id := ClientID(r.Context()); id != "" {
+		return "client:" + id
+	}
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return "key:" + key
+	}
+	return "ip:" + clientIP(r)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter holds one token bucket per client key
+type rateLimiter struct {
+	cfg RateLimit
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(cfg RateLimit) *rateLimiter {
+	if cfg.Burst < 1 {
+		cfg.Burst = max(1, int(math.Ceil(cfg.Rate)))
+	}
+	if cfg.Key == nil {
+		cfg.Key = ClientKey
+	}
+	return &rateLimiter{cfg: cfg, buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+// allow takes a token for key. It returns the tokens left and, when the
+// request is refused, how long until the next token is available
+func (rl *rateLimiter) allow(key string) (bool, int, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	rl.sweep(now)
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rl.cfg.Burst), last: now}
+		rl.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(rl.cfg.Burst), b.tokens+now.Sub(b.last).Seconds()*rl.cfg.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rl.cfg.Rate * float64(time.Second))
+		return false, 0, wait
+	}
+	b.tokens--
+	return true, int(b.tokens), 0
+}
+
+// sweep drops buckets that have refilled completely, since they are
+// indistinguishable from new ones
+func (rl *rateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < time.Minute {
+		return
+	}
+	rl.lastSweep = now
+	for key, b := range rl.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rl.cfg.Rate >= float64(rl.cfg.Burst) {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// serve refuses requests over the limit with 429 and passes the others to
+// next
+func (rl *rateLimiter) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	ok, remaining, wait := rl.allow(rl.cfg.Key(r))
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rl.cfg.Burst))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeError(w, http.StatusTooManyRequests, "rate limit exceeded", "")
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+// ParseRate reads limits such as "10/s", "600/m" or "5000/h"
+func ParseRate(s string) (float64, error) {
+	n, unit, ok := strings.Cut(s, "/")
+	if !ok {
+		unit = "s"
+	}
+	v, err := strconv.ParseFloat(n, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	switch unit {
+	case "s":
+		return v, nil
+	case "m":
+		return v / 60, nil
+	case "h":
+		return v / 3600, nil
+	}
+	return 0, fmt.Errorf("invalid rate unit in %q", s)
+}
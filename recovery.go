@@ -0,0 +1,293 @@
+package go_playground
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ErrRecoveryUnsupported is returned by Recover when the queue backend
+// cannot check what it stores
+var ErrRecoveryUnsupported = errors.New("queue backend cannot check its consistency")
+
+// ErrTaskLost dead-letters the tasks a recovery pass found recorded as
+// queued or running, but held neither by the backend nor by a worker
+var ErrTaskLost = errors.New("task lost: recorded as queued or running by a previous process")
+
+// Kinds of RecoveryIssue
+const (
+	// IssueOrphanedClaim is a task whose lease expired, the consumer that
+	// claimed it having stopped without acknowledging it
+	IssueOrphanedClaim = "orphaned_claim"
+	// IssueStuckRunning is a task that would not run again on its own: a
+	// lease deadline past any a live consumer sets, or a record left queued
+	// or running by a previous process for a task the backend lost
+	IssueStuckRunning = "stuck_running"
+	// IssueSchema is stored data out of step with the layout of the
+	// backend, such as a task that does not decode or a stale index
+	IssueSchema = "schema"
+)
+
+// RecoveryIssue is an inconsistency found by a recovery pass
+type RecoveryIssue struct {
+	Kind     string `json:"kind"`
+	TaskID   int    `json:"task_id,omitempty"`
+	Detail   string `json:"detail"`
+	Repaired bool   `json:"repaired,omitempty"`
+}
+
+// ConsistencyReport is what a ConsistencyChecker found
+type ConsistencyReport struct {
+	Issues []RecoveryIssue
+	// Held lists the tasks queued or leased once repaired, for the pool to
+	// check its records against
+	Held []int
+}
+
+// ConsistencyChecker is implemented by persistent backends that can check
+// what they store, such as redisqueue and pgqueue
+type ConsistencyChecker interface {
+	// CheckConsistency reports the issues found, repairing those it can
+	// with repair set
+	CheckConsistency(ctx context.Context, repair bool) (ConsistencyReport, error)
+}
+
+// Recovery runs a recovery pass as the pool starts on a backend that is a
+// ConsistencyChecker, Start returning once it is done. The backend reports the claims orphaned by stopped
+// consumers, leases that would keep tasks stuck and the data it cannot
+// make sense of; with a TaskLister store, the records a previous process
+// left queued or running for tasks the backend no longer holds are
+// reported as stuck. With Repair the backend requeues the claims and
+// fixes or sets aside the data, and the lost tasks are dead-lettered with
+// ErrTaskLost, ready for a retry. The records check assumes the store is
+// not shared with pools of other processes
+type Recovery struct {
+	Repair  bool          // fix the issues found rather than only report them
+	Timeout time.Duration // bound of a pass, 1m by default
+}
+
+// RecoveryReport is the outcome of a recovery pass. Counts and Repaired
+// cover every issue, Issues lists the first maxRecoveryIssues
+type RecoveryReport struct {
+	Started   time.Time       `json:"started"`
+	Duration  time.Duration   `json:"duration"`
+	Boot      bool            `json:"boot"` // run as the pool started rather than on request
+	Repair    bool            `json:"repair"`
+	Counts    map[string]int  `json:"counts"` // issues by kind
+	Repaired  int             `json:"repaired"`
+	Issues    []RecoveryIssue `json:"issues"`
+	Truncated bool            `json:"truncated,omitempty"`
+	// Error stopped the pass, the issues found before it being reported
+	Error string `json:"error,omitempty"`
+}
+
+// maxRecoveryIssues bounds the issues listed in a report
+const maxRecoveryIssues = 1000
+
+// recoveries serializes the recovery passes of a pool and keeps the last
+// report
+type recoveries struct {
+	run  sync.Mutex
+	mu   sync.Mutex
+	last *RecoveryReport
+}
+
+// Recover runs a recovery pass, as WithRecovery does at startup, repairing
+// the issues found with repair set. It returns ErrRecoveryUnsupported when
+// the backend is not a ConsistencyChecker, and the report with the error
+// that stopped the pass otherwise
+func (p *WorkerPool) Recover(ctx context.Context, repair bool) (RecoveryReport, error) {
+	return p.recover(ctx, repair, false)
+}
+
+// LastRecovery returns the report of the last recovery pass, ok being
+// unset before the first
+func (p *WorkerPool) LastRecovery() (report RecoveryReport, ok bool) {
+	p.recoveries.mu.Lock()
+	defer p.recoveries.mu.Unlock()
+	if p.recoveries.last == nil {
+		return RecoveryReport{}, false
+	}
+	return *p.recoveries.last, true
+}
+
+// recoverAtBoot runs the recovery pass of WithRecovery
+func (p *WorkerPool) recoverAtBoot() {
+	if _, err := p.recover(p.ctx, p.recovery.Repair, true); errors.Is(err, ErrRecoveryUnsupported) {
+		p.log.Warn("recovery: skipped", "error", err)
+	}
+}
+
+func (p *WorkerPool) recover(ctx context.Context, repair, boot bool) (RecoveryReport, error) {
+	c, ok := p.queue.(ConsistencyChecker)
+	if !ok {
+		return RecoveryReport{}, ErrRecoveryUnsupported
+	}
+	timeout := time.Minute
+	if p.recovery != nil && p.recovery.Timeout > 0 {
+		timeout = p.recovery.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	p.recoveries.run.Lock()
+	defer p.recoveries.run.Unlock()
+
+	report := RecoveryReport{Started: time.Now(), Boot: boot, Repair: repair, Counts: map[string]int{}, Issues: []RecoveryIssue{}}
+	var issues []RecoveryIssue
+	cr, err := c.CheckConsistency(ctx, repair)
+	issues = append(issues, cr.Issues...)
+	if err == nil {
+		var lost []RecoveryIssue
+		lost, err = p.lostRecords(cr.Held, repair)
+		issues = append(issues, lost...)
+	}
+	report.Duration = time.Since(report.Started)
+	for _, is := range issues {
+		report.Counts[is.Kind]++
+		if is.Repaired {
+			report.Repaired++
+		}
+		p.metrics.recoveryIssues.WithLabelValues(is.Kind, strconv.FormatBool(is.Repaired)).Inc()
+	}
+	report.Issues = append(report.Issues, issues[:min(len(issues), maxRecoveryIssues)]...)
+	report.Truncated = len(issues) > maxRecoveryIssues
+	if err != nil {
+		err = fmt.Errorf("recovery: %w", err)
+		report.Error = err.Error()
+	}
+
+	attrs := []any{"boot", boot, "repair", repair, "issues", len(issues), "repaired", report.Repaired, "duration", report.Duration}
+	for kind, n := range report.Counts {
+		attrs = append(attrs, kind, n)
+	}
+	switch {
+	case err != nil:
+		p.log.Error("recovery pass failed", append(attrs, "error", err)...)
+	case len(issues) > 0:
+		p.log.Warn("recovery pass found issues", attrs...)
+	default:
+		p.log.Info("recovery pass found no issues", attrs...)
+	}
+
+	p.recoveries.mu.Lock()
+	p.recoveries.last = &report
+	p.recoveries.mu.Unlock()
+	return report, err
+}
+
+// lostRecords reports the records of the tasks queued before the pool
+// started that are still queued or running, but neither held by the
+// backend nor running here, dead-lettering them with repair set. Tasks
+// queued since, possibly held back by the pool, are not checked
+func (p *WorkerPool) lostRecords(held []int, repair bool) ([]RecoveryIssue, error) {
+	l, ok := p.store.(TaskLister)
+	if !ok {
+		return nil, nil
+	}
+	p.mu.Lock()
+	booted := p.booted
+	p.mu.Unlock()
+	if booted.IsZero() {
+		// Before Start every task is held by the pool or the backend
+		return nil, nil
+	}
+	var recs []TaskRecord
+	for _, state := range []TaskState{StateQueued, StateRunning} {
+		found, err := l.List(TaskQuery{State: state, Until: booted})
+		if err != nil {
+			return nil, fmt.Errorf("listing %s records: %w", state, err)
+		}
+		recs = append(recs, found...)
+	}
+	slices.SortFunc(recs, func(a, b TaskRecord) int { return cmp.Compare(a.ID, b.ID) })
+
+	// Read after the records, so a task claimed after the backend was
+	// checked is either running or finished
+	running := p.InFlight()
+	holds := make(map[int]bool, len(held)+len(running))
+	for _, id := range slices.Concat(held, running) {
+		holds[id] = true
+	}
+	var issues []RecoveryIssue
+	for _, rec := range recs {
+		if holds[rec.ID] {
+			continue
+		}
+		is := RecoveryIssue{Kind: IssueStuckRunning, TaskID: rec.ID,
+			Detail: fmt.Sprintf("recorded as %s since %s, but neither queued nor claimed", rec.State, rec.QueuedAt.Format(time.RFC3339))}
+		if repair {
+			// The task may have finished since it was listed
+			if cur, err := p.store.Get(rec.ID); err == nil && !cur.State.Terminal() {
+				p.deadLetter(cur.Task, ErrTaskLost)
+				is.Repaired = true
+			}
+		}
+		issues = append(issues, is)
+	}
+	return issues, nil
+}
+
+func (s *Server) recoveryRoutes(r *mux.Router) {
+	r.HandleFunc("/admin/recovery", s.lastRecoveryHandler).Methods("GET")
+	r.HandleFunc("/admin/recovery", s.recoverHandler).Methods("POST")
+}
+
+// lastRecoveryHandler serves GET /admin/recovery, the report of the last
+// recovery pass
+func (s *Server) lastRecoveryHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	if _, ok := p.queue.(ConsistencyChecker); !ok {
+		writeError(w, http.StatusNotImplemented, ErrRecoveryUnsupported.Error(), "")
+		return
+	}
+	report, ok := p.LastRecovery()
+	if !ok {
+		writeError(w, http.StatusNotFound, "no recovery pass has run", "")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// recoverHandler serves POST /admin/recovery, running a recovery pass that
+// repairs the issues found with the repair parameter set
+func (s *Server) recoverHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	repair := false
+	if v := r.URL.Query().Get("repair"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid repair %q, want true or false", v), "repair")
+			return
+		}
+		repair = b
+	}
+	report, err := p.Recover(r.Context(), repair)
+	if errors.Is(err, ErrRecoveryUnsupported) {
+		writeError(w, http.StatusNotImplemented, err.Error(), "")
+		return
+	}
+	found := 0
+	for _, n := range report.Counts {
+		found += n
+	}
+	s.audit(r, p, AuditRecover, map[string]any{"repair": repair, "issues": found, "repaired": report.Repaired}, err)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,52 @@
+package redisqueue_test
+
+import (
+	"testing"
+	"time"
+
+	pool "playground"
+	"playground/redisqueue"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestDeadLetterStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	q := redisqueue.New(rdb, redisqueue.Options{})
+	defer q.Close()
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i, id := range []int{3, 1, 2} {
+		dl := pool.DeadLetter{Task: pool.Task{ID: id, Data: "data"}, Error: "broken", FailedAt: at.Add(time.Duration(i) * time.Second)}
+		if err := q.SaveDeadLetter(dl); err != nil {
+			t.Fatalf("SaveDeadLetter: %v", err)
+		}
+	}
+	// Another process on the queue sees them, in failure order
+	other := redisqueue.New(rdb, redisqueue.Options{})
+	defer other.Close()
+	dls, err := other.LoadDeadLetters()
+	if err != nil {
+		t.Fatalf("LoadDeadLetters: %v", err)
+	}
+	var ids []int
+	for _, dl := range dls {
+		ids = append(ids, dl.Task.ID)
+	}
+	if len(ids) != 3 || ids[0] != 3 || ids[1] != 1 || ids[2] != 2 {
+		t.Fatalf("dead letters of tasks %v, want [3 1 2]", ids)
+	}
+
+	if ok, err := q.DeleteDeadLetter(1); !ok || err != nil {
+		t.Errorf("DeleteDeadLetter(1) = %v, %v, want true", ok, err)
+	}
+	if ok, err := q.DeleteDeadLetter(1); ok || err != nil {
+		t.Errorf("DeleteDeadLetter(1) again = %v, %v, want false", ok, err)
+	}
+	if dls, _ := q.LoadDeadLetters(); len(dls) != 2 {
+		t.Errorf("%d dead letters left, want 2", len(dls))
+	}
+}
@@ -0,0 +1,73 @@
+package redisqueue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireScript renews lease KEYS[1] for ARGV[2] milliseconds when ARGV[1]
+// holds it, or takes it when nobody does
+var acquireScript = redis.NewScript(`
+local holder = redis.call('GET', KEYS[1])
+if holder == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+if holder then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+// releaseScript drops lease KEYS[1] if ARGV[1] holds it
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Elector implements pool.Elector with a lease key in Redis, holding the ID
+// of the leader until it expires
+type Elector struct {
+	rdb redis.UniversalClient
+	key string
+	id  string
+}
+
+// Elector returns an elector among the processes sharing the queue
+func (q *Queue) Elector() *Elector {
+	return NewElector(q.rdb, q.opts.Prefix+":leader")
+}
+
+// NewElector returns an elector on the given key. Each call gets an ID of
+// its own, made of the host name, the process ID and a random part
+func NewElector(rdb redis.UniversalClient, key string) *Elector {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return &Elector{rdb: rdb, key: key, id: fmt.Sprintf("%s:%d:%s", host, os.Getpid(), hex.EncodeToString(b))}
+}
+
+// ID returns what the lease key holds while this elector leads
+func (e *Elector) ID() string {
+	return e.id
+}
+
+// Acquire implements pool.Elector
+func (e *Elector) Acquire(ctx context.Context, ttl time.Duration) (bool, error) {
+	n, err := acquireScript.Run(ctx, e.rdb, []string{e.key}, e.id, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// Release implements pool.Elector
+func (e *Elector) Release(ctx context.Context) error {
+	return releaseScript.Run(ctx, e.rdb, []string{e.key}, e.id).Err()
+}
@@ -0,0 +1,256 @@
+package redisqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	pool "playground"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keepScoreScript keeps score ARGV[2] for lease ARGV[1] of KEYS[1] in
+// KEYS[2], unless the lease is gone or has one
+var keepScoreScript = redis.NewScript(`
+if redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	redis.call('HSETNX', KEYS[2], ARGV[1], ARGV[2])
+end
+return 1
+`)
+
+// dropScoreScript drops the score of ARGV[1] from KEYS[2] unless it is
+// leased in KEYS[1]
+var dropScoreScript = redis.NewScript(`
+if not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	redis.call('HDEL', KEYS[2], ARGV[1])
+end
+return 1
+`)
+
+// raiseIDScript raises the ID counter KEYS[1] to ARGV[1]
+var raiseIDScript = redis.NewScript(`
+if tonumber(ARGV[1]) > tonumber(redis.call('GET', KEYS[1]) or '0') then
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// storedTask is a member of the pending or lease set
+type storedTask struct {
+	member string
+	score  float64 // priority order when pending, lease deadline in ms when leased
+	task   pool.Task
+	err    error // decoding the member
+}
+
+// CheckConsistency implements pool.ConsistencyChecker. It looks for
+// expired leases, leases running past any deadline a consumer sets, scores
+// and copies out of step with the leases, members that do not decode and
+// an ID counter behind the tasks. Repairs requeue the leases, fix the
+// scores and counter, drop the queued copies of leased tasks and move the
+// members that do not decode to the quarantine hash, keyed by member with
+// the error as value, for inspection
+func (q *Queue) CheckConsistency(ctx context.Context, repair bool) (pool.ConsistencyReport, error) {
+	var pending, leases *redis.ZSliceCmd
+	var scores *redis.MapStringStringCmd
+	var lastID *redis.StringCmd
+	// One transaction, so a task moving between the sets is seen once
+	_, err := q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pending = pipe.ZRangeWithScores(ctx, q.pendingKey, 0, -1)
+		leases = pipe.ZRangeWithScores(ctx, q.leasesKey, 0, -1)
+		scores = pipe.HGetAll(ctx, q.scoresKey)
+		lastID = pipe.Get(ctx, q.idKey)
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return pool.ConsistencyReport{}, err
+	}
+	now := time.Now()
+	q.mu.Lock()
+	ours := make(map[string]bool, len(q.held))
+	for _, m := range q.held {
+		ours[m] = true
+	}
+	q.mu.Unlock()
+
+	var report pool.ConsistencyReport
+	var errs []error
+	issue := func(is pool.RecoveryIssue, fix func() error) {
+		if repair && fix != nil {
+			if err := fix(); err != nil {
+				errs = append(errs, fmt.Errorf("redisqueue: repairing %q: %w", is.Detail, err))
+			} else {
+				is.Repaired = true
+			}
+		}
+		report.Issues = append(report.Issues, is)
+	}
+	decode := func(zs []redis.Z) []storedTask {
+		stored := make([]storedTask, len(zs))
+		for i, z := range zs {
+			m, _ := z.Member.(string)
+			stored[i] = storedTask{member: m, score: z.Score}
+			stored[i].task, stored[i].err = pool.UnmarshalTask([]byte(m))
+		}
+		return stored
+	}
+	queued, leased := decode(pending.Val()), decode(leases.Val())
+	leasedMembers := make(map[string]bool, len(leased))
+	leasedIDs := make(map[int]bool, len(leased))
+	for _, s := range leased {
+		leasedMembers[s.member] = true
+		if s.err == nil {
+			leasedIDs[s.task.ID] = true
+		}
+	}
+
+	// Deadlines are set to a visibility timeout from now, the margin
+	// covering the clocks of other processes
+	latest := now.Add(2 * q.opts.VisibilityTimeout).UnixMilli()
+	var requeued []int // issues repaired by requeueing the expired leases
+	for _, s := range leased {
+		if s.err != nil {
+			issue(pool.RecoveryIssue{Kind: pool.IssueSchema, Detail: fmt.Sprintf("leased task does not decode: %v", s.err)},
+				func() error { return q.quarantine(ctx, q.leasesKey, s.member, s.err) })
+			continue
+		}
+		if _, ok := scores.Val()[s.member]; !ok {
+			issue(pool.RecoveryIssue{Kind: pool.IssueSchema, TaskID: s.task.ID, Detail: "lease without the score to requeue it with"},
+				func() error {
+					return keepScoreScript.Run(ctx, q.rdb, []string{q.leasesKey, q.scoresKey}, s.member, score(s.task)).Err()
+				})
+		}
+		deadline := time.UnixMilli(int64(s.score))
+		switch {
+		case ours[s.member]:
+		case s.score < float64(now.UnixMilli()):
+			requeued = append(requeued, len(report.Issues))
+			issue(pool.RecoveryIssue{Kind: pool.IssueOrphanedClaim, TaskID: s.task.ID,
+				Detail: fmt.Sprintf("lease expired at %s", deadline.Format(time.RFC3339))}, nil)
+		case s.score > float64(latest):
+			requeued = append(requeued, len(report.Issues))
+			issue(pool.RecoveryIssue{Kind: pool.IssueStuckRunning, TaskID: s.task.ID,
+				Detail: fmt.Sprintf("lease runs until %s, past any deadline a consumer sets", deadline.Format(time.RFC3339))}, nil)
+		}
+	}
+	if repair && len(requeued) > 0 {
+		err := q.requeueLeases(ctx, now, leased, report.Issues, requeued)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("redisqueue: requeueing leases: %w", err))
+		}
+		for _, i := range requeued {
+			report.Issues[i].Repaired = err == nil
+		}
+	}
+
+	copies := make(map[int]int, len(queued))
+	for _, s := range queued {
+		if s.err == nil {
+			copies[s.task.ID]++
+		}
+	}
+	for _, s := range queued {
+		switch {
+		case s.err != nil:
+			issue(pool.RecoveryIssue{Kind: pool.IssueSchema, Detail: fmt.Sprintf("queued task does not decode: %v", s.err)},
+				func() error { return q.quarantine(ctx, q.pendingKey, s.member, s.err) })
+		case leasedIDs[s.task.ID]:
+			issue(pool.RecoveryIssue{Kind: pool.IssueSchema, TaskID: s.task.ID, Detail: "task both queued and leased"},
+				func() error { return q.dropQueuedCopy(ctx, s.member, leasedMembers[s.member]) })
+		case copies[s.task.ID] > 1:
+			// Reported once, without a repair: the copies may differ
+			copies[s.task.ID] = 0
+			issue(pool.RecoveryIssue{Kind: pool.IssueSchema, TaskID: s.task.ID, Detail: "task queued more than once"}, nil)
+		}
+	}
+
+	for m := range scores.Val() {
+		if leasedMembers[m] {
+			continue
+		}
+		is := pool.RecoveryIssue{Kind: pool.IssueSchema, Detail: "score kept for a task not leased"}
+		if t, err := pool.UnmarshalTask([]byte(m)); err == nil {
+			is.TaskID = t.ID
+		}
+		issue(is, func() error { return dropScoreScript.Run(ctx, q.rdb, []string{q.leasesKey, q.scoresKey}, m).Err() })
+	}
+
+	maxID := 0
+	for _, s := range slices.Concat(queued, leased) {
+		if s.err == nil {
+			maxID = max(maxID, s.task.ID)
+		}
+	}
+	if n, _ := strconv.Atoi(lastID.Val()); n < maxID {
+		issue(pool.RecoveryIssue{Kind: pool.IssueSchema, Detail: fmt.Sprintf("ID counter at %d, behind task %d", n, maxID)},
+			func() error { return raiseIDScript.Run(ctx, q.rdb, []string{q.idKey}, maxID).Err() })
+	}
+
+	for _, s := range queued {
+		if s.err == nil && !leasedIDs[s.task.ID] {
+			report.Held = append(report.Held, s.task.ID)
+		}
+	}
+	for id := range leasedIDs {
+		report.Held = append(report.Held, id)
+	}
+	return report, errors.Join(errs...)
+}
+
+// quarantine moves member out of set into the quarantine hash
+func (q *Queue) quarantine(ctx context.Context, set, member string, reason error) error {
+	_, err := q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, set, member)
+		pipe.HDel(ctx, q.scoresKey, member)
+		pipe.HSet(ctx, q.quarantineKey, member, reason.Error())
+		if q.logKey != "" {
+			pipe.XAdd(ctx, &redis.XAddArgs{Stream: q.logKey, Values: []any{"op", "del", "m", member}})
+		}
+		return nil
+	})
+	return err
+}
+
+// requeueLeases requeues the leases of issues picked from all, expiring
+// first those running too long
+func (q *Queue) requeueLeases(ctx context.Context, now time.Time, leased []storedTask, all []pool.RecoveryIssue, picked []int) error {
+	ids := make(map[int]bool, len(picked))
+	for _, i := range picked {
+		if all[i].Kind == pool.IssueStuckRunning {
+			ids[all[i].TaskID] = true
+		}
+	}
+	var expire []redis.Z
+	for _, s := range leased {
+		if s.err == nil && ids[s.task.ID] {
+			expire = append(expire, redis.Z{Score: float64(now.UnixMilli()), Member: s.member})
+		}
+	}
+	if len(expire) > 0 {
+		// Only while still leased, a consumer acknowledging it meanwhile
+		if err := q.rdb.ZAddXX(ctx, q.leasesKey, expire...).Err(); err != nil {
+			return err
+		}
+	}
+	return requeueScript.Run(ctx, q.rdb, []string{q.pendingKey, q.leasesKey, q.scoresKey}, now.UnixMilli(), math.MaxInt32).Err()
+}
+
+// dropQueuedCopy removes the queued copy member of a leased task. The
+// standby keeps leased tasks queued, so only a copy differing from the
+// lease is dropped there
+func (q *Queue) dropQueuedCopy(ctx context.Context, member string, same bool) error {
+	if q.logKey == "" || same {
+		return q.rdb.ZRem(ctx, q.pendingKey, member).Err()
+	}
+	_, err := q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, q.pendingKey, member)
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: q.logKey, Values: []any{"op", "del", "m", member}})
+		return nil
+	})
+	return err
+}
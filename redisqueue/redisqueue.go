@@ -0,0 +1,590 @@
+// Package redisqueue is a QueueBackend shared through Redis, so several
+// server processes can work off one queue
+package redisqueue
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	pool "playground"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Options configures a Queue
+type Options struct {
+	// Prefix namespaces the Redis keys. Defaults to "workerpool"
+	Prefix string
+	// VisibilityTimeout is how long a claimed task stays invisible to other
+	// consumers without its lease being renewed. Defaults to 30s
+	VisibilityTimeout time.Duration
+	// PollInterval is how often an idle consumer looks for new tasks.
+	// Defaults to 250ms
+	PollInterval time.Duration
+	// Logger receives lease maintenance errors. Defaults to slog.Default()
+	Logger *slog.Logger
+	// Codec sets how new tasks are stored. Defaults to pool.JSONCodec; tasks
+	// stored with any registered codec, or before codecs existed, are still
+	// read back
+	Codec pool.Codec
+	// CompletionTTL is how long completed tasks and steps are remembered, so
+	// a redelivery within it does not run them again. Defaults to 24h
+	CompletionTTL time.Duration
+	// Standby, usually the Redis of another region, receives a copy of the
+	// queued tasks, see Replication
+	Standby redis.UniversalClient
+	// Replication tunes the copy to Standby
+	Replication Replication
+}
+
+// Queue stores pending tasks in a sorted set ordered by priority and ID.
+// Claiming a task atomically moves it into a lease set scored by its
+// deadline; leases of tasks held by this process are renewed in the
+// background, and expired leases of crashed consumers are requeued. The
+// queue is a pool.CompletionLog, so a requeued task that had completed
+// before its consumer crashed is acknowledged without running again
+type Queue struct {
+	rdb  redis.UniversalClient
+	opts Options
+
+	pendingKey string
+	leasesKey  string
+	scoresKey  string
+	idKey      string
+	doneKey    string // prefix of the completion marks
+	schedKey   string // hash of schedule definitions by name
+	deadKey    string // hash of the dead letters by task ID
+	resultKey  string // prefix of the task results
+	logKey     string // stream of the changes for the standby, empty without one
+	// quarantineKey is the hash of the members CheckConsistency set aside
+	quarantineKey string
+
+	repl *replicator // nil without a standby
+
+	mu     sync.Mutex
+	held   map[int]string // claimed task ID -> set member
+	closed chan struct{}
+	once   sync.Once
+}
+
+// claimScript pops the best pending task and leases it until ARGV[1],
+// keeping its pending score in KEYS[3] for a requeue. Members are opaque
+// envelopes that scripts cannot decode
+var claimScript = redis.NewScript(`
+local item = redis.call('ZPOPMIN', KEYS[1])
+if #item == 0 then
+	return false
+end
+redis.call('ZADD', KEYS[2], ARGV[1], item[1])
+redis.call('HSET', KEYS[3], item[1], item[2])
+return item[1]
+`)
+
+// requeueScript moves up to ARGV[2] leases that expired before ARGV[1]
+// back into the pending set. Leases taken before scores were kept are
+// plain JSON tasks scored from their fields
+var requeueScript = redis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, member in ipairs(expired) do
+	local score = redis.call('HGET', KEYS[3], member)
+	if not score then
+		local t = cjson.decode(member)
+		score = -(t.priority or 0) * 1e12 + t.id
+	end
+	redis.call('ZREM', KEYS[2], member)
+	redis.call('HDEL', KEYS[3], member)
+	redis.call('ZADD', KEYS[1], score, member)
+end
+return #expired
+`)
+
+// ackScript drops lease ARGV[1] and its score, logging its removal to the
+// stream KEYS[3] when replicating
+var ackScript = redis.NewScript(`
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+if KEYS[3] then
+	redis.call('XADD', KEYS[3], '*', 'op', 'del', 'm', ARGV[1])
+end
+return 1
+`)
+
+// flushScript empties the pending set and returns what it held, logging
+// the removals as ackScript does
+var flushScript = redis.NewScript(`
+local members = redis.call('ZRANGE', KEYS[1], 0, -1)
+redis.call('DEL', KEYS[1])
+if KEYS[2] then
+	for _, member in ipairs(members) do
+		redis.call('XADD', KEYS[2], '*', 'op', 'del', 'm', member)
+	end
+end
+return members
+`)
+
+// replaceScript swaps lease ARGV[1] for ARGV[2], keeping its deadline and
+// score. It returns false when the lease is gone. When replicating, the
+// swap is logged to KEYS[3] as ackScript does, ARGV[3] being the score
+var replaceScript = redis.NewScript(`
+local deadline = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not deadline then
+	return false
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('ZADD', KEYS[1], deadline, ARGV[2])
+local score = redis.call('HGET', KEYS[2], ARGV[1])
+if score then
+	redis.call('HDEL', KEYS[2], ARGV[1])
+	redis.call('HSET', KEYS[2], ARGV[2], score)
+end
+if KEYS[3] then
+	redis.call('XADD', KEYS[3], '*', 'op', 'del', 'm', ARGV[1])
+	redis.call('XADD', KEYS[3], '*', 'op', 'add', 'm', ARGV[2], 's', ARGV[3])
+end
+return 1
+`)
+
+// New creates a queue on the given client and starts lease maintenance
+func New(rdb redis.UniversalClient, opts Options) *Queue {
+	if opts.Prefix == "" {
+		opts.Prefix = "workerpool"
+	}
+	if opts.VisibilityTimeout <= 0 {
+		opts.VisibilityTimeout = 30 * time.Second
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 250 * time.Millisecond
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.Codec == nil {
+		opts.Codec = pool.JSONCodec
+	}
+	if opts.CompletionTTL <= 0 {
+		opts.CompletionTTL = 24 * time.Hour
+	}
+
+	q := &Queue{
+		rdb:           rdb,
+		opts:          opts,
+		pendingKey:    opts.Prefix + ":pending",
+		leasesKey:     opts.Prefix + ":leases",
+		scoresKey:     opts.Prefix + ":scores",
+		idKey:         opts.Prefix + ":last_id",
+		doneKey:       opts.Prefix + ":done:",
+		schedKey:      opts.Prefix + ":schedules",
+		deadKey:       opts.Prefix + ":deadletters",
+		resultKey:     opts.Prefix + ":result:",
+		quarantineKey: opts.Prefix + ":quarantine",
+		held:          make(map[int]string),
+		closed:        make(chan struct{}),
+	}
+	if opts.Standby != nil {
+		q.logKey = opts.Prefix + ":replication"
+		q.repl = newReplicator(q)
+		go q.replicate()
+	}
+	go q.maintain()
+	return q
+}
+
+// Push implements pool.QueueBackend
+func (q *Queue) Push(t pool.Task) error {
+	if q.isClosed() {
+		return pool.ErrQueueClosed
+	}
+
+	return q.PushBatch([]pool.Task{t})
+}
+
+// PushBatch adds all tasks with a single ZADD, which Redis applies
+// atomically, in one transaction with their log entries when replicating
+func (q *Queue) PushBatch(ts []pool.Task) error {
+	if q.isClosed() {
+		return pool.ErrQueueClosed
+	}
+
+	members := make([]redis.Z, len(ts))
+	for i, t := range ts {
+		member, err := pool.MarshalTask(q.opts.Codec, t)
+		if err != nil {
+			return err
+		}
+		members[i] = redis.Z{Score: score(t), Member: member}
+	}
+	ctx := context.Background()
+	if q.logKey == "" {
+		return q.rdb.ZAdd(ctx, q.pendingKey, members...).Err()
+	}
+	_, err := q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, q.pendingKey, members...)
+		for _, z := range members {
+			pipe.XAdd(ctx, q.logAdd(z))
+		}
+		return nil
+	})
+	return err
+}
+
+// Pop implements pool.QueueBackend. Unlike the in-memory queue it stops
+// claiming as soon as the queue is closed and leaves the backlog to the
+// other consumers
+func (q *Queue) Pop() (pool.Task, error) {
+	for {
+		if q.isClosed() {
+			return pool.Task{}, pool.ErrQueueClosed
+		}
+
+		deadline := time.Now().Add(q.opts.VisibilityTimeout).UnixMilli()
+		member, err := claimScript.Run(context.Background(), q.rdb,
+			[]string{q.pendingKey, q.leasesKey, q.scoresKey}, deadline).Text()
+		switch {
+		case errors.Is(err, redis.Nil):
+			select {
+			case <-time.After(q.opts.PollInterval):
+			case <-q.closed:
+			}
+			continue
+		case err != nil:
+			return pool.Task{}, err
+		}
+
+		t, err := pool.UnmarshalTask([]byte(member))
+		if err != nil {
+			return pool.Task{}, fmt.Errorf("redisqueue: decoding task: %w", err)
+		}
+		q.mu.Lock()
+		q.held[t.ID] = member
+		q.mu.Unlock()
+		return t, nil
+	}
+}
+
+// Ack implements pool.QueueBackend
+func (q *Queue) Ack(t pool.Task) error {
+	q.mu.Lock()
+	member, ok := q.held[t.ID]
+	delete(q.held, t.ID)
+	q.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return ackScript.Run(context.Background(), q.rdb, q.withLog(q.leasesKey, q.scoresKey), member).Err()
+}
+
+// SaveCheckpoint replaces the leased copy of t, so whichever consumer
+// picks it up after an expired lease resumes from the checkpoint
+func (q *Queue) SaveCheckpoint(t pool.Task) error {
+	member, err := pool.MarshalTask(q.opts.Codec, t)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	old, ok := q.held[t.ID]
+	if !ok {
+		return fmt.Errorf("redisqueue: task %d is not held", t.ID)
+	}
+	err = replaceScript.Run(context.Background(), q.rdb, q.withLog(q.leasesKey, q.scoresKey), old, member, score(t)).Err()
+	if errors.Is(err, redis.Nil) {
+		return fmt.Errorf("redisqueue: lease of task %d expired", t.ID)
+	}
+	if err != nil {
+		return err
+	}
+	q.held[t.ID] = string(member)
+	return nil
+}
+
+// Flush removes and returns every pending task, for all consumers of the
+// queue. Leased tasks are left alone
+func (q *Queue) Flush() ([]pool.Task, error) {
+	members, err := flushScript.Run(context.Background(), q.rdb, q.withLog(q.pendingKey)).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]pool.Task, 0, len(members))
+	for _, m := range members {
+		t, err := pool.UnmarshalTask([]byte(m))
+		if err != nil {
+			return tasks, fmt.Errorf("redisqueue: decoding task: %w", err)
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}
+
+// Pending returns the pending tasks in the order they are claimed, leaving
+// them queued. Tasks leased by consumers are not included
+func (q *Queue) Pending() ([]pool.Task, error) {
+	members, err := q.rdb.ZRange(context.Background(), q.pendingKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]pool.Task, 0, len(members))
+	for _, m := range members {
+		t, err := pool.UnmarshalTask([]byte(m))
+		if err != nil {
+			return nil, fmt.Errorf("redisqueue: decoding task: %w", err)
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}
+
+// Codec returns the codec new tasks are stored with, for the pool to
+// report what a pool.CompressedCodec saves
+func (q *Queue) Codec() pool.Codec { return q.opts.Codec }
+
+// StorageBytes implements pool.StorageSizer, adding up the memory Redis
+// reports for every key of the queue
+func (q *Queue) StorageBytes(ctx context.Context) (int64, error) {
+	keys := q.withLog(q.pendingKey, q.leasesKey, q.scoresKey, q.idKey, q.schedKey, q.quarantineKey)
+	for _, prefix := range []string{q.doneKey, q.resultKey} {
+		found, err := q.scan(ctx, prefix)
+		if err != nil {
+			return 0, err
+		}
+		keys = append(keys, found...)
+	}
+	pipe := q.rdb.Pipeline()
+	usage := make([]*redis.IntCmd, len(keys))
+	for i, k := range keys {
+		usage[i] = pipe.MemoryUsage(ctx, k)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+	var n int64
+	for _, u := range usage {
+		n += u.Val() // zero for missing keys
+	}
+	return n, nil
+}
+
+// EvictCompleted implements pool.StorageEvicter, deleting the completion
+// marks and results closest to expiring, the oldest as they share a TTL
+func (q *Queue) EvictCompleted(ctx context.Context, n int) (int, error) {
+	var keys []string
+	for _, prefix := range []string{q.doneKey, q.resultKey} {
+		found, err := q.scan(ctx, prefix)
+		if err != nil {
+			return 0, err
+		}
+		keys = append(keys, found...)
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	pipe := q.rdb.Pipeline()
+	ttls := make([]*redis.DurationCmd, len(keys))
+	for i, k := range keys {
+		ttls[i] = pipe.PTTL(ctx, k)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	idx := make([]int, len(keys))
+	for i := range idx {
+		idx[i] = i
+	}
+	slices.SortFunc(idx, func(a, b int) int { return cmp.Compare(ttls[a].Val(), ttls[b].Val()) })
+	victims := make([]string, 0, min(n, len(keys)))
+	for _, i := range idx[:min(n, len(idx))] {
+		victims = append(victims, keys[i])
+	}
+	deleted, err := q.rdb.Del(ctx, victims...).Result()
+	return int(deleted), err
+}
+
+// scan returns the keys starting with prefix
+func (q *Queue) scan(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	it := q.rdb.Scan(ctx, 0, prefix+"*", 1000).Iterator()
+	for it.Next(ctx) {
+		keys = append(keys, it.Val())
+	}
+	return keys, it.Err()
+}
+
+// Len implements pool.QueueBackend
+func (q *Queue) Len() int {
+	n, err := q.rdb.ZCard(context.Background(), q.pendingKey).Result()
+	if err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+// Close implements pool.QueueBackend. Leases of tasks still being worked on
+// keep getting renewed until they are acknowledged, and replication to
+// the standby stops
+func (q *Queue) Close() error {
+	q.once.Do(func() { close(q.closed) })
+	return nil
+}
+
+// Ping checks that Redis answers
+func (q *Queue) Ping(ctx context.Context) error {
+	return q.rdb.Ping(ctx).Err()
+}
+
+// NextID implements pool.IDGenerator with IDs unique across all processes
+// sharing the queue. Pools on this queue always use it, as tasks of equal
+// priority are ordered by ID
+func (q *Queue) NextID() (int, error) {
+	id, err := q.rdb.Incr(context.Background(), q.idKey).Result()
+	return int(id), err
+}
+
+// Completed implements pool.CompletionLog
+func (q *Queue) Completed(key string) (bool, error) {
+	n, err := q.rdb.Exists(context.Background(), q.doneKey+key).Result()
+	return n > 0, err
+}
+
+// MarkCompleted implements pool.CompletionLog, remembering key for
+// Options.CompletionTTL
+func (q *Queue) MarkCompleted(key string) error {
+	return q.rdb.Set(context.Background(), q.doneKey+key, 1, q.opts.CompletionTTL).Err()
+}
+
+// SaveResult implements pool.ResultStore, Redis expiring the result after
+// ttl
+func (q *Queue) SaveResult(id int, data []byte, ttl time.Duration) error {
+	return q.rdb.Set(context.Background(), q.resultKey+strconv.Itoa(id), data, ttl).Err()
+}
+
+// LoadResult implements pool.ResultStore
+func (q *Queue) LoadResult(id int) ([]byte, error) {
+	data, err := q.rdb.Get(context.Background(), q.resultKey+strconv.Itoa(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, pool.ErrNoResult
+	}
+	return data, err
+}
+
+// SaveSchedule implements pool.ScheduleStore, sharing the schedule with
+// every process on the queue
+func (q *Queue) SaveSchedule(def pool.ScheduleDef) error {
+	v, err := json.Marshal(def)
+	if err != nil {
+		return err
+	}
+	return q.rdb.HSet(context.Background(), q.schedKey, def.Name, v).Err()
+}
+
+// DeleteSchedule implements pool.ScheduleStore
+func (q *Queue) DeleteSchedule(name string) (bool, error) {
+	n, err := q.rdb.HDel(context.Background(), q.schedKey, name).Result()
+	return n > 0, err
+}
+
+// LoadSchedules implements pool.ScheduleStore
+func (q *Queue) LoadSchedules() ([]pool.ScheduleDef, error) {
+	all, err := q.rdb.HGetAll(context.Background(), q.schedKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	defs := make([]pool.ScheduleDef, 0, len(all))
+	for name, v := range all {
+		var def pool.ScheduleDef
+		if err := json.Unmarshal([]byte(v), &def); err != nil {
+			return nil, fmt.Errorf("redisqueue: decoding schedule %q: %w", name, err)
+		}
+		defs = append(defs, def)
+	}
+	return defs, nil
+}
+
+// SaveDeadLetter implements pool.DeadLetterStore, sharing the dead letter
+// with every process on the queue
+func (q *Queue) SaveDeadLetter(dl pool.DeadLetter) error {
+	v, err := pool.MarshalDeadLetter(q.opts.Codec, dl)
+	if err != nil {
+		return err
+	}
+	return q.rdb.HSet(context.Background(), q.deadKey, strconv.Itoa(dl.Task.ID), v).Err()
+}
+
+// DeleteDeadLetter implements pool.DeadLetterStore
+func (q *Queue) DeleteDeadLetter(id int) (bool, error) {
+	n, err := q.rdb.HDel(context.Background(), q.deadKey, strconv.Itoa(id)).Result()
+	return n > 0, err
+}
+
+// LoadDeadLetters implements pool.DeadLetterStore
+func (q *Queue) LoadDeadLetters() ([]pool.DeadLetter, error) {
+	all, err := q.rdb.HGetAll(context.Background(), q.deadKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	dls := make([]pool.DeadLetter, 0, len(all))
+	for id, v := range all {
+		dl, err := pool.UnmarshalDeadLetter([]byte(v))
+		if err != nil {
+			return nil, fmt.Errorf("redisqueue: decoding dead letter %s: %w", id, err)
+		}
+		dls = append(dls, dl)
+	}
+	pool.SortDeadLetters(dls)
+	return dls, nil
+}
+
+func (q *Queue) isClosed() bool {
+	select {
+	case <-q.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// maintain renews the leases held by this process and requeues expired
+// ones, until the queue is closed and every held task is acknowledged
+func (q *Queue) maintain() {
+	ticker := time.NewTicker(q.opts.VisibilityTimeout / 3)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+		now := time.Now()
+
+		q.mu.Lock()
+		members := make([]redis.Z, 0, len(q.held))
+		for _, m := range q.held {
+			members = append(members, redis.Z{Score: float64(now.Add(q.opts.VisibilityTimeout).UnixMilli()), Member: m})
+		}
+		q.mu.Unlock()
+
+		if len(members) > 0 {
+			if err := q.rdb.ZAddXX(ctx, q.leasesKey, members...).Err(); err != nil {
+				q.opts.Logger.Error("redisqueue: renewing leases", "error", err)
+			}
+		} else if q.isClosed() {
+			return
+		}
+
+		n, err := requeueScript.Run(ctx, q.rdb, []string{q.pendingKey, q.leasesKey, q.scoresKey}, now.UnixMilli(), 100).Int()
+		if err != nil {
+			q.opts.Logger.Error("redisqueue: requeueing expired leases", "error", err)
+		} else if n > 0 {
+			q.opts.Logger.Warn("redisqueue: requeued tasks from expired leases", "count", n)
+		}
+	}
+}
+
+// score orders pending tasks by priority (highest first), then by ID
+func score(t pool.Task) float64 {
+	return -float64(t.Priority)*1e12 + float64(t.ID)
+}
@@ -0,0 +1,414 @@
+package redisqueue
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pool "playground"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrPromoted stops replication to a standby that took over as primary
+var ErrPromoted = errors.New("redisqueue: standby was promoted")
+
+// ErrNotStandby is returned by Promote on a Redis no queue replicates to
+var ErrNotStandby = errors.New("redisqueue: not a standby")
+
+// Replication copies the queued tasks to Options.Standby asynchronously.
+// Every change to the tasks queued or leased is logged to a stream in the
+// same transaction, and one of the processes sharing the queue applies
+// the log to the standby, where leased tasks stay queued: should the
+// region be lost, Promote turns the standby into a queue missing at most
+// the changes of the last Interval, and redelivering the tasks that were
+// running. Completion marks, results and schedules are not copied
+type Replication struct {
+	// Interval is how often the log is applied once caught up. Defaults
+	// to 1s
+	Interval time.Duration
+	// MaxLog bounds the changes logged while the standby cannot be
+	// reached. Past it the log is dropped and the standby copied again in
+	// full once back. Defaults to 100000
+	MaxLog int64
+}
+
+// Standby keys, under the prefix of the queue
+const (
+	cursorSuffix   = ":replica:cursor"   // last change applied, set while a standby
+	promotedSuffix = ":replica:promoted" // when the standby took over
+)
+
+// staleSuffix is the key, on the primary, set to the time of the oldest
+// change dropped from the log, until the standby is copied again
+const staleSuffix = ":replication:stale"
+
+// replicateBatch is the changes applied at once
+const replicateBatch = 1000
+
+// applyScript applies changes to the standby pending set KEYS[1] as
+// ARGV[3..] triples of op, member and score, raises the ID counter KEYS[4]
+// to ARGV[2] and records ARGV[1] as the last change applied in KEYS[2],
+// unless the standby was promoted as KEYS[3] says
+var applyScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[3]) == 1 then
+	return redis.error_reply('PROMOTED standby was promoted')
+end
+for i = 3, #ARGV, 3 do
+	if ARGV[i] == 'add' then
+		redis.call('ZADD', KEYS[1], ARGV[i+2], ARGV[i+1])
+	elseif ARGV[i] == 'del' then
+		redis.call('ZREM', KEYS[1], ARGV[i+1])
+	end
+end
+if tonumber(ARGV[2]) > tonumber(redis.call('GET', KEYS[4]) or '0') then
+	redis.call('SET', KEYS[4], ARGV[2])
+end
+redis.call('SET', KEYS[2], ARGV[1])
+return 1
+`)
+
+// resyncScript replaces the standby pending set with the ARGV[3..] pairs
+// of member and score, otherwise like applyScript
+var resyncScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[3]) == 1 then
+	return redis.error_reply('PROMOTED standby was promoted')
+end
+redis.call('DEL', KEYS[1])
+for i = 3, #ARGV, 2 do
+	redis.call('ZADD', KEYS[1], ARGV[i+1], ARGV[i])
+end
+if tonumber(ARGV[2]) > tonumber(redis.call('GET', KEYS[4]) or '0') then
+	redis.call('SET', KEYS[4], ARGV[2])
+end
+redis.call('SET', KEYS[2], ARGV[1])
+return 1
+`)
+
+// promoteScript marks standby KEYS[1] as promoted in KEYS[2] at ARGV[1]
+// and returns the tasks it holds in KEYS[3], or false when it is not a
+// standby
+var promoteScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return false
+end
+redis.call('DEL', KEYS[1])
+redis.call('SET', KEYS[2], ARGV[1])
+return redis.call('ZCARD', KEYS[3])
+`)
+
+// replicator is the state of the copy to the standby
+type replicator struct {
+	cursorKey   string
+	promotedKey string
+	staleKey    string
+	elector     *Elector // picks the process applying the log
+
+	mu     sync.Mutex
+	status pool.ReplicationStatus
+}
+
+func newReplicator(q *Queue) *replicator {
+	if q.opts.Replication.Interval <= 0 {
+		q.opts.Replication.Interval = time.Second
+	}
+	if q.opts.Replication.MaxLog <= 0 {
+		q.opts.Replication.MaxLog = 100000
+	}
+	return &replicator{
+		cursorKey:   q.opts.Prefix + cursorSuffix,
+		promotedKey: q.opts.Prefix + promotedSuffix,
+		staleKey:    q.opts.Prefix + staleSuffix,
+		elector:     NewElector(q.rdb, q.opts.Prefix+":replicator"),
+	}
+}
+
+// Replication implements pool.Replicator
+func (q *Queue) Replication() (pool.ReplicationStatus, bool) {
+	if q.repl == nil {
+		return pool.ReplicationStatus{}, false
+	}
+	q.repl.mu.Lock()
+	defer q.repl.mu.Unlock()
+	return q.repl.status, true
+}
+
+// withLog appends the log stream to keys when replicating
+func (q *Queue) withLog(keys ...string) []string {
+	if q.logKey != "" {
+		keys = append(keys, q.logKey)
+	}
+	return keys
+}
+
+// logAdd returns the log entry of member z being queued
+func (q *Queue) logAdd(z redis.Z) *redis.XAddArgs {
+	return &redis.XAddArgs{
+		Stream: q.logKey,
+		Values: []any{"op", "add", "m", z.Member, "s", strconv.FormatFloat(z.Score, 'f', -1, 64)},
+	}
+}
+
+// replicate applies the log to the standby while this process holds the
+// replicator lease, and measures the lag, until the queue is closed or the
+// standby promoted
+func (q *Queue) replicate() {
+	r := q.repl
+	interval := q.opts.Replication.Interval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer r.elector.Release(context.Background())
+
+	for {
+		ctx := context.Background()
+		active, err := r.elector.Acquire(ctx, 3*interval)
+		if err == nil && active {
+			err = q.applyLog(ctx)
+		}
+		promoted := errors.Is(err, ErrPromoted)
+		switch {
+		case promoted:
+			q.opts.Logger.Error("redisqueue: standby was promoted, replication stopped")
+		case err != nil:
+			q.opts.Logger.Error("redisqueue: replicating to the standby", "error", err)
+			if active {
+				q.boundLog(ctx)
+			}
+		}
+		q.measureLag(ctx, active, promoted, err)
+		if promoted {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-q.closed:
+			return
+		}
+	}
+}
+
+// applyLog applies the changes logged since the last applied, copying the
+// whole queue instead when the standby is new or changes were dropped
+func (q *Queue) applyLog(ctx context.Context) error {
+	r := q.repl
+	cursor, err := q.opts.Standby.Get(ctx, r.cursorKey).Result()
+	if errors.Is(err, redis.Nil) {
+		if n, err := q.opts.Standby.Exists(ctx, r.promotedKey).Result(); err != nil || n > 0 {
+			return cmp.Or(err, ErrPromoted)
+		}
+		return q.resync(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := q.rdb.Exists(ctx, r.staleKey).Result(); err != nil || n > 0 {
+		if err != nil {
+			return err
+		}
+		q.opts.Logger.Warn("redisqueue: changes were dropped while the standby was unreachable, copying the queue again")
+		return q.resync(ctx)
+	}
+
+	for {
+		entries, err := q.rdb.XRangeN(ctx, q.logKey, "("+cursor, "+", replicateBatch).Result()
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		last := entries[len(entries)-1].ID
+		lastID, err := q.rdb.Get(ctx, q.idKey).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		args := []any{last, cmp.Or(lastID, "0")}
+		for _, e := range entries {
+			op, _ := e.Values["op"].(string)
+			member, _ := e.Values["m"].(string)
+			score, _ := e.Values["s"].(string)
+			args = append(args, op, member, cmp.Or(score, "0"))
+		}
+		err = applyScript.Run(ctx, q.opts.Standby, q.standbyKeys(), args...).Err()
+		if err != nil {
+			return standbyErr(err)
+		}
+		// The applied changes are no longer needed
+		if err := q.rdb.XTrimMinID(ctx, q.logKey, nextStreamID(last)).Err(); err != nil {
+			return err
+		}
+		cursor = last
+		q.applied(false)
+		if len(entries) < replicateBatch {
+			return nil
+		}
+	}
+}
+
+// resync copies the tasks queued and leased to the standby, replacing what
+// it held. The copy is taken in one transaction with a mark logged, the
+// next changes being applied from it
+func (q *Queue) resync(ctx context.Context) error {
+	var mark *redis.StringCmd
+	var pending *redis.ZSliceCmd
+	var leased *redis.MapStringStringCmd
+	var lastID *redis.StringCmd
+	_, err := q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		mark = pipe.XAdd(ctx, &redis.XAddArgs{Stream: q.logKey, Values: []any{"op", "sync"}})
+		pipe.Del(ctx, q.repl.staleKey)
+		pending = pipe.ZRangeWithScores(ctx, q.pendingKey, 0, -1)
+		leased = pipe.HGetAll(ctx, q.scoresKey)
+		lastID = pipe.Get(ctx, q.idKey)
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+
+	cursor := mark.Val()
+	args := []any{cursor, cmp.Or(lastID.Val(), "0")}
+	for _, z := range pending.Val() {
+		args = append(args, z.Member, strconv.FormatFloat(z.Score, 'f', -1, 64))
+	}
+	for member, score := range leased.Val() {
+		args = append(args, member, score)
+	}
+	if err := resyncScript.Run(ctx, q.opts.Standby, q.standbyKeys(), args...).Err(); err != nil {
+		return standbyErr(err)
+	}
+	if err := q.rdb.XTrimMinID(ctx, q.logKey, nextStreamID(cursor)).Err(); err != nil {
+		return err
+	}
+	q.opts.Logger.Info("redisqueue: queue copied to the standby", "tasks", (len(args)-2)/2)
+	q.applied(true)
+	return nil
+}
+
+// boundLog drops the log once it holds more than MaxLog changes the
+// standby could not take, recording the time of the oldest so the lag
+// keeps growing until the standby is copied again
+func (q *Queue) boundLog(ctx context.Context) {
+	n, err := q.rdb.XLen(ctx, q.logKey).Result()
+	if err != nil || n <= q.opts.Replication.MaxLog {
+		return
+	}
+	oldest, err := q.rdb.XRangeN(ctx, q.logKey, "-", "+", 1).Result()
+	if err != nil || len(oldest) == 0 {
+		return
+	}
+	ms, _, _ := parseStreamID(oldest[0].ID)
+	_, err = q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetNX(ctx, q.repl.staleKey, ms, 0)
+		pipe.Del(ctx, q.logKey)
+		return nil
+	})
+	if err != nil {
+		q.opts.Logger.Error("redisqueue: dropping the replication log", "error", err)
+		return
+	}
+	q.opts.Logger.Warn("redisqueue: replication log dropped, the standby will be copied again", "changes", n)
+}
+
+// standbyKeys are the keys of the apply scripts, on the standby
+func (q *Queue) standbyKeys() []string {
+	return []string{q.pendingKey, q.repl.cursorKey, q.repl.promotedKey, q.idKey}
+}
+
+// applied records changes applied to the standby
+func (q *Queue) applied(resync bool) {
+	r := q.repl
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.LastApplied = time.Now()
+	if resync {
+		r.status.Resyncs++
+	}
+}
+
+// measureLag updates the status with the changes left in the log, those
+// applied being trimmed, and those dropped from it
+func (q *Queue) measureLag(ctx context.Context, active, promoted bool, failed error) {
+	var backlog *redis.IntCmd
+	var first *redis.XMessageSliceCmd
+	var stale *redis.StringCmd
+	_, err := q.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		backlog = pipe.XLen(ctx, q.logKey)
+		first = pipe.XRangeN(ctx, q.logKey, "-", "+", 1)
+		stale = pipe.Get(ctx, q.repl.staleKey)
+		return nil
+	})
+	if errors.Is(err, redis.Nil) {
+		err = nil
+	}
+	failed = cmp.Or(failed, err)
+
+	r := q.repl
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.Active, r.status.Promoted = active, promoted
+	r.status.Error = ""
+	if failed != nil {
+		r.status.Error = failed.Error()
+	}
+	if err != nil {
+		return
+	}
+	r.status.Backlog, r.status.Lag = int(backlog.Val()), 0
+	oldest, _ := stale.Uint64()
+	if msgs := first.Val(); oldest == 0 && len(msgs) > 0 {
+		oldest, _, _ = parseStreamID(msgs[0].ID)
+	}
+	if oldest > 0 {
+		r.status.Lag = max(time.Since(time.UnixMilli(int64(oldest))), 0)
+	}
+}
+
+// IsStandby reports whether the queue under prefix on rdb is the standby
+// of another, which must be promoted before pools use it
+func IsStandby(ctx context.Context, rdb redis.UniversalClient, prefix string) (bool, error) {
+	n, err := rdb.Exists(ctx, cmp.Or(prefix, "workerpool")+cursorSuffix).Result()
+	return n > 0, err
+}
+
+// Promote turns the standby under prefix on rdb into a queue of its own,
+// after its primary region was lost, and returns the number of tasks it
+// holds. Replication to it stops for good: a primary coming back sees
+// ErrPromoted. Tasks that were running in the lost region are among those
+// queued, and run again
+func Promote(ctx context.Context, rdb redis.UniversalClient, prefix string) (int, error) {
+	prefix = cmp.Or(prefix, "workerpool")
+	n, err := promoteScript.Run(ctx, rdb, []string{prefix + cursorSuffix, prefix + promotedSuffix, prefix + ":pending"},
+		time.Now().UnixMilli()).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrNotStandby
+	}
+	return n, err
+}
+
+// standbyErr turns the refusal of the apply scripts into ErrPromoted
+func standbyErr(err error) error {
+	if strings.HasPrefix(err.Error(), "PROMOTED") {
+		return ErrPromoted
+	}
+	return err
+}
+
+// parseStreamID splits a stream entry ID into its time and sequence
+func parseStreamID(id string) (ms, seq uint64, ok bool) {
+	a, b, found := strings.Cut(id, "-")
+	ms, err1 := strconv.ParseUint(a, 10, 64)
+	seq, err2 := strconv.ParseUint(b, 10, 64)
+	return ms, seq, found && err1 == nil && err2 == nil
+}
+
+// nextStreamID returns the smallest ID after id, for trimming up to it
+func nextStreamID(id string) string {
+	ms, seq, _ := parseStreamID(id)
+	return strconv.FormatUint(ms, 10) + "-" + strconv.FormatUint(seq+1, 10)
+}
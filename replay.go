@@ -0,0 +1,203 @@
+package go_playground
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrReplayUnsupported is returned by Replay from an archive that is not
+// configured or whose sink cannot be read back, see ArchiveReader
+var ErrReplayUnsupported = errors.New("archive cannot be replayed")
+
+// ReplaySource is where Replay finds the tasks to submit again
+type ReplaySource string
+
+const (
+	ReplayDeadLetters ReplaySource = "deadletter"
+	ReplayArchive     ReplaySource = "archive"
+)
+
+// ReplayFilter selects the tasks to replay. Empty fields match every task
+type ReplayFilter struct {
+	Source ReplaySource `json:"source"` // dead letters by default
+	// Since and Until bound the time the task failed, or finished for
+	// archived tasks
+	Since time.Time `json:"since,omitzero"`
+	Until time.Time `json:"until,omitzero"`
+	// Queue is the queue the tasks ran on. An archive holds the tasks of
+	// every queue writing to it, this pool's own are replayed by default
+	Queue string `json:"queue,omitempty"`
+	// Error is a substring of the error the tasks failed with
+	Error string `json:"error,omitempty"`
+	// State is the final state of archived tasks, failed by default. Dead
+	// letters have all failed
+	State  TaskState `json:"state,omitempty"`
+	Limit  int       `json:"limit,omitempty"`   // tasks replayed at most, no limit when zero
+	DryRun bool      `json:"dry_run,omitempty"` // only list the matching tasks
+}
+
+// ReplayedTask is a task submitted again by Replay
+type ReplayedTask struct {
+	OriginalID int    `json:"original_id"`
+	ID         int    `json:"id,omitempty"` // the new ID, unset in a dry run
+	Error      string `json:"error,omitempty"`
+}
+
+// ReplayResult lists the tasks replayed
+type ReplayResult struct {
+	Tasks []ReplayedTask `json:"tasks"`
+}
+
+// Replay submits again the dead letters or archived tasks matching f, to
+// run them with a fixed handler. Dead letters leave the dead-letter queue
+// and keep their ID like with RetryDeadLetter. Archived tasks are
+// submitted as new tasks. A failed submission stops the replay, the
+// result listing the tasks replayed until then
+func (p *WorkerPool) Replay(ctx context.Context, f ReplayFilter) (ReplayResult, error) {
+	switch f.Source {
+	case "", ReplayDeadLetters:
+		return p.replayDeadLetters(f)
+	case ReplayArchive:
+		return p.replayArchive(ctx, f)
+	}
+	return ReplayResult{}, fmt.Errorf("unknown replay source %q", f.Source)
+}
+
+// matches reports whether a task that ended at the given time with the
+// given error passes the filter
+func (f ReplayFilter) matches(t Task, at time.Time, errMsg string) bool {
+	return (f.Since.IsZero() || !at.Before(f.Since)) &&
+		(f.Until.IsZero() || at.Before(f.Until)) &&
+		(f.Queue == "" || f.Queue == cmp.Or(t.Queue, "default")) &&
+		strings.Contains(errMsg, f.Error)
+}
+
+func (p *WorkerPool) replayDeadLetters(f ReplayFilter) (ReplayResult, error) {
+	var res ReplayResult
+	match := func(dl DeadLetter) bool { return f.matches(dl.Task, dl.FailedAt, dl.Error) }
+	if f.DryRun {
+		dls, err := p.dlq.list()
+		if err != nil {
+			return res, fmt.Errorf("loading dead letters: %w", err)
+		}
+		for _, dl := range dls {
+			if match(dl) {
+				res.Tasks = append(res.Tasks, ReplayedTask{OriginalID: dl.Task.ID, Error: dl.Error})
+				if len(res.Tasks) == f.Limit {
+					break
+				}
+			}
+		}
+		return res, nil
+	}
+
+	taken, err := p.dlq.takeMatching(match, f.Limit)
+	if err != nil && len(taken) == 0 {
+		return res, fmt.Errorf("taking dead letters: %w", err)
+	}
+	if err != nil {
+		p.log.Error("taking dead letters", "error", err)
+	}
+	for i, dl := range taken {
+		task := dl.Task
+		task.Attempts = 0
+		if err := p.enqueue(task); err != nil {
+			for _, dl := range taken[i:] {
+				p.dlq.putBack(dl)
+			}
+			return res, fmt.Errorf("task %d: %w", task.ID, err)
+		}
+		res.Tasks = append(res.Tasks, ReplayedTask{OriginalID: task.ID, ID: task.ID, Error: dl.Error})
+	}
+	if len(taken) > 0 {
+		p.log.Info("dead letters replayed", "tasks", len(taken))
+	}
+	return res, nil
+}
+
+func (p *WorkerPool) replayArchive(ctx context.Context, f ReplayFilter) (ReplayResult, error) {
+	var res ReplayResult
+	if p.archiver == nil {
+		return res, ErrReplayUnsupported
+	}
+	r, ok := p.archiver.cfg.Sink.(ArchiveReader)
+	if !ok {
+		return res, ErrReplayUnsupported
+	}
+	queue := cmp.Or(f.Queue, p.archiver.queue)
+	state := cmp.Or(f.State, StateFailed)
+	names, err := r.List(ctx, p.archiver.cfg.Prefix+queue+"/")
+	if err != nil {
+		return res, fmt.Errorf("listing the archive: %w", err)
+	}
+
+	for _, name := range names {
+		// A file only holds tasks finished before it was rolled
+		if rolled, ok := archiveFileTime(name); ok && rolled.Before(f.Since) {
+			continue
+		}
+		data, err := r.Get(ctx, name)
+		if err != nil {
+			return res, fmt.Errorf("reading %s: %w", name, err)
+		}
+		records, err := decodeArchive(name, data)
+		if err != nil {
+			return res, fmt.Errorf("decoding %s: %w", name, err)
+		}
+		for _, rec := range records {
+			if c := p.archiver.cipher; c != nil {
+				if err := c.openRecord(&rec); err != nil {
+					return res, fmt.Errorf("decrypting task %d of %s: %w", rec.ID, name, err)
+				}
+			}
+			// Whether or not compression is still enabled, as it was when
+			// the file was written
+			if err := decompressRecord(&rec); err != nil {
+				return res, fmt.Errorf("decompressing task %d of %s: %w", rec.ID, name, err)
+			}
+			at := rec.QueuedAt
+			if rec.FinishedAt != nil {
+				at = *rec.FinishedAt
+			}
+			rec.Queue = cmp.Or(rec.Queue, queue)
+			if rec.State != state || !f.matches(rec.Task, at, rec.Error) {
+				continue
+			}
+			replayed := ReplayedTask{OriginalID: rec.ID, Error: rec.Error}
+			if !f.DryRun {
+				task, err := p.submitOne(replayTask(rec.Task))
+				if err != nil {
+					return res, fmt.Errorf("task %d: %w", rec.ID, err)
+				}
+				replayed.ID = task.ID
+			}
+			res.Tasks = append(res.Tasks, replayed)
+			if f.Limit > 0 && len(res.Tasks) == f.Limit {
+				return res, nil
+			}
+		}
+	}
+	if !f.DryRun && len(res.Tasks) > 0 {
+		p.log.Info("archived tasks replayed", "queue", queue, "tasks", len(res.Tasks))
+	}
+	return res, nil
+}
+
+// replayTask resets an archived task to how it was submitted, leaving out
+// what tied it to its first run
+func replayTask(t Task) Task {
+	t.ID = 0
+	t.Attempts = 0
+	t.RunAt = time.Time{}
+	t.ExpiresAt = time.Time{}
+	t.Checkpoint = ""
+	t.IdempotencyKey = ""
+	t.WorkflowID, t.Step = "", ""
+	t.GroupID = ""
+	t.DependsOn = nil
+	return t
+}
@@ -0,0 +1,37 @@
+package go_playground
+
+import "time"
+
+// ReplicationStatus reports how far the standby copy of a queue, kept by
+// the backend in another region, is behind the queue
+type ReplicationStatus struct {
+	// Active is set on the process applying the changes to the standby,
+	// the others only measure the lag
+	Active  bool          `json:"active"`
+	Lag     time.Duration `json:"lag"`     // age of the oldest change not yet applied, zero when caught up
+	Backlog int           `json:"backlog"` // changes not yet applied
+	// LastApplied is when the process last applied changes, and Resyncs
+	// counts the full copies it made of a standby new or too far behind
+	LastApplied time.Time `json:"last_applied,omitzero"`
+	Resyncs     int       `json:"resyncs"`
+	// Promoted is set once the standby took over, replication having
+	// stopped for good
+	Promoted bool   `json:"promoted,omitempty"`
+	Error    string `json:"error,omitempty"` // of the last attempt, if it failed
+}
+
+// Replicator is implemented by backends that can copy their queue to a
+// standby, such as redisqueue. Replication sets ok when they do
+type Replicator interface {
+	Replication() (status ReplicationStatus, ok bool)
+}
+
+// Replication returns the status of the standby copy of the queue, with
+// ok unset when the backend keeps none
+func (p *WorkerPool) Replication() (status ReplicationStatus, ok bool) {
+	r, ok := p.queue.(Replicator)
+	if !ok {
+		return ReplicationStatus{}, false
+	}
+	return r.Replication()
+}
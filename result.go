@@ -0,0 +1,214 @@
+package go_playground
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Result is the final record of a task
+type Result struct {
+	TaskRecord
+}
+
+// Err returns the error the task ended with, nil if it succeeded
+func (r Result) Err() error {
+	if r.State == StateSucceeded {
+		return nil
+	}
+	if r.Error == "" {
+		return errors.New(string(r.State))
+	}
+	return errors.New(r.Error)
+}
+
+// outputKey is the context key of the slot filled by SetOutput
+type outputKey struct{}
+
+// SetOutput records the output of the running task, reported with its
+// record once it succeeds. It returns false outside of a pool handler.
+// Outputs count against the memory budget of Guardrails
+func SetOutput(ctx context.Context, output string) bool {
+	slot, ok := ctx.Value(outputKey{}).(*string)
+	if ok {
+		// Past the budget the attempt is canceled, which is enough
+		_ = TrackAllocation(ctx, int64(len(output)-len(*slot)))
+		*slot = output
+	}
+	return ok
+}
+
+// waiters holds the callers waiting for tasks to finish
+type waiters struct {
+	mu sync.Mutex
+	m  map[int][]chan TaskRecord
+}
+
+func (w *waiters) add(id int) chan TaskRecord {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.m == nil {
+		w.m = make(map[int][]chan TaskRecord)
+	}
+	ch := make(chan TaskRecord, 1)
+	w.m[id] = append(w.m[id], ch)
+	return ch
+}
+
+func (w *waiters) remove(id int, ch chan TaskRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	chans := w.m[id]
+	for i, c := range chans {
+		if c == ch {
+			chans = append(chans[:i], chans[i+1:]...)
+			break
+		}
+	}
+	if len(chans) == 0 {
+		delete(w.m, id)
+	} else {
+		w.m[id] = chans
+	}
+}
+
+// notify hands a terminal record to everyone waiting for it
+func (w *waiters) notify(rec TaskRecord) {
+	w.mu.Lock()
+	chans := w.m[rec.ID]
+	delete(w.m, rec.ID)
+	w.mu.Unlock()
+	for _, ch := range chans {
+		ch <- rec
+	}
+}
+
+// Future is a handle on a submitted task
+type Future struct {
+	p    *WorkerPool
+	task Task
+	ch   chan TaskRecord
+
+	once     sync.Once
+	done     chan struct{}
+	released chan struct{}
+	result   Result
+}
+
+// SubmitFuture submits a task and returns a handle to wait for it. Only
+// tasks run by this pool complete the future, not those picked up by
+// another process sharing the backend
+func (p *WorkerPool) SubmitFuture(task Task) (*Future, error) {
+	return p.submitFuture(context.Background(), task)
+}
+
+// submitFuture is SubmitFuture handing ctx to the interceptors. The future
+// of a task split by them follows its first part
+func (p *WorkerPool) submitFuture(ctx context.Context, task Task) (*Future, error) {
+	task, err := p.SubmitContext(ctx, task)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Future{
+		p:        p,
+		task:     task,
+		ch:       p.waiters.add(task.ID),
+		done:     make(chan struct{}),
+		released: make(chan struct{}),
+	}
+	// The task may have finished before the waiter was registered
+	if rec, err := p.store.Get(task.ID); err == nil && rec.State.Terminal() {
+		p.waiters.remove(task.ID, f.ch)
+		f.resolve(rec)
+		return f, nil
+	}
+	go f.collect()
+	return f, nil
+}
+
+// Task returns the task as submitted, with its ID
+func (f *Future) Task() Task {
+	return f.task
+}
+
+// Done is closed once the task has finished
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the task finishes or ctx is done
+func (f *Future) Wait(ctx context.Context) (Result, error) {
+	select {
+	case <-f.Done():
+		return f.result, nil
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
+}
+
+func (f *Future) collect() {
+	select {
+	case rec := <-f.ch:
+		f.resolve(rec)
+	case <-f.released:
+	}
+}
+
+func (f *Future) resolve(rec TaskRecord) {
+	f.once.Do(func() {
+		f.result = Result{rec}
+		close(f.done)
+	})
+}
+
+// release stops waiting for a task that has not finished
+func (f *Future) release() {
+	f.p.waiters.remove(f.task.ID, f.ch)
+	close(f.released)
+}
+
+// SubmitAndWait submits a task and blocks until it finishes or ctx is done.
+// The error reports a failed submission or an expired ctx, the outcome of
+// the task itself is in the Result
+func (p *WorkerPool) SubmitAndWait(ctx context.Context, task Task) (Result, error) {
+	f, err := p.SubmitFuture(task)
+	if err != nil {
+		return Result{}, err
+	}
+	res, err := f.Wait(ctx)
+	if err != nil {
+		f.release()
+	}
+	return res, err
+}
+
+// WaitTask blocks until the task finishes or ctx is done, and returns its
+// record either way, with the error of ctx in the latter case. Like
+// SubmitFuture it only sees tasks finish on this pool
+func (p *WorkerPool) WaitTask(ctx context.Context, id int) (TaskRecord, error) {
+	ch := p.waiters.add(id)
+	// The task may have finished before the waiter was registered
+	rec, err := p.store.Get(id)
+	if err != nil || rec.State.Terminal() {
+		p.waiters.remove(id, ch)
+		return rec, err
+	}
+	select {
+	case rec := <-ch:
+		return rec, nil
+	case <-ctx.Done():
+		p.waiters.remove(id, ch)
+		// Notified meanwhile, the record is final
+		select {
+		case rec := <-ch:
+			return rec, nil
+		default:
+		}
+		rec, err := p.store.Get(id)
+		if err != nil {
+			return rec, err
+		}
+		return rec, ctx.Err()
+	}
+}
@@ -0,0 +1,176 @@
+package go_playground
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNoResult is returned for tasks without a stored result: those still
+// running, those whose handler did not call SetResult and those whose
+// result expired
+var ErrNoResult = errors.New("task has no result")
+
+// ErrResultTooLarge is returned by SetResult for results past the limit of
+// WithResults
+var ErrResultTooLarge = errors.New("task result too large")
+
+// ResultStore keeps the results handlers set with SetResult, as JSON.
+// Pools on a backend implementing it, such as redisqueue and pgqueue, use
+// it, so results outlive the process and are shared with other processes
+type ResultStore interface {
+	SaveResult(id int, data []byte, ttl time.Duration) error
+	// LoadResult returns ErrNoResult for tasks without a result
+	LoadResult(id int) ([]byte, error)
+}
+
+// Results configures the storage of task results
+type Results struct {
+	// Store keeps the results. Defaults to the backend when it is a
+	// ResultStore, else to a MemoryResultStore
+	Store ResultStore
+	// MaxBytes bounds the JSON of a result, 1 MiB by default
+	MaxBytes int
+	// TTL is how long results are kept, 24h by default
+	TTL time.Duration
+}
+
+// DefaultResults bounds results to 1 MiB kept for a day
+var DefaultResults = Results{MaxBytes: 1 << 20, TTL: 24 * time.Hour}
+
+// WithResults sets where task results are stored and their limits
+func WithResults(r Results) Option {
+	return func(p *WorkerPool) {
+		if r.MaxBytes <= 0 {
+			r.MaxBytes = DefaultResults.MaxBytes
+		}
+		if r.TTL <= 0 {
+			r.TTL = DefaultResults.TTL
+		}
+		p.results = r
+	}
+}
+
+// resultKey is the context key of the slot filled by SetResult
+type resultKey struct{}
+
+// resultSlot holds the result of the running attempt
+type resultSlot struct {
+	max  int
+	data []byte
+}
+
+// SetResult records v, encoded as JSON, as the result of the running task.
+// It is stored once the task succeeds, readable with TaskResult and
+// GET /event/{id}/result until the TTL of WithResults. Results past its
+// MaxBytes fail with ErrResultTooLarge, outside of a pool handler SetResult
+// fails with ErrNoTask. Results count against the memory budget of
+// Guardrails, ErrMemoryBudget being returned past it
+func SetResult(ctx context.Context, v any) error {
+	slot, ok := ctx.Value(resultKey{}).(*resultSlot)
+	if !ok {
+		return ErrNoTask
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encoding result: %w", err)
+	}
+	if len(data) > slot.max {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrResultTooLarge, len(data), slot.max)
+	}
+	// Held until the task finishes
+	err = TrackAllocation(ctx, int64(len(data)-len(slot.data)))
+	slot.data = data
+	return err
+}
+
+// saveResult stores the result of a task that succeeded, reporting whether
+// it did. A result that cannot be stored is logged, the task having
+// succeeded all the same
+func (p *WorkerPool) saveResult(task Task, data []byte) bool {
+	if data == nil {
+		return false
+	}
+	if err := p.results.Store.SaveResult(task.ID, data, p.results.TTL); err != nil {
+		p.taskLogger(task).Error("storing task result", "error", err)
+		return false
+	}
+	return true
+}
+
+// TaskResult returns the JSON result of a task that succeeded. It fails
+// with ErrTaskNotFound for unknown tasks and ErrNoResult for those without
+// a result
+func (p *WorkerPool) TaskResult(id int) (json.RawMessage, error) {
+	data, err := p.results.Store.LoadResult(id)
+	if errors.Is(err, ErrNoResult) {
+		if _, serr := p.store.Get(id); serr != nil {
+			return nil, serr
+		}
+	}
+	return data, err
+}
+
+// ResultAs decodes the result of a task into a T
+func ResultAs[T any](p *WorkerPool, id int) (T, error) {
+	var v T
+	data, err := p.TaskResult(id)
+	if err != nil {
+		return v, err
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return v, fmt.Errorf("decoding result of task %d: %w", id, err)
+	}
+	return v, nil
+}
+
+// MemoryResultStore is a ResultStore backed by a map
+type MemoryResultStore struct {
+	mu      sync.Mutex
+	results map[int]storedResult
+	swept   time.Time
+}
+
+type storedResult struct {
+	data    []byte
+	expires time.Time
+}
+
+// resultSweepInterval is how often MemoryResultStore evicts expired results
+const resultSweepInterval = time.Minute
+
+// NewMemoryResultStore creates an empty in-memory result store
+func NewMemoryResultStore() *MemoryResultStore {
+	return &MemoryResultStore{results: make(map[int]storedResult), swept: time.Now()}
+}
+
+// SaveResult implements ResultStore
+func (s *MemoryResultStore) SaveResult(id int, data []byte, ttl time.Duration) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.swept) >= resultSweepInterval {
+		for id, r := range s.results {
+			if now.After(r.expires) {
+				delete(s.results, id)
+			}
+		}
+		s.swept = now
+	}
+	s.results[id] = storedResult{data: data, expires: now.Add(ttl)}
+	return nil
+}
+
+// LoadResult implements ResultStore
+func (s *MemoryResultStore) LoadResult(id int) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.results[id]
+	if !ok || time.Now().After(r.expires) {
+		return nil, ErrNoResult
+	}
+	return r.data, nil
+}
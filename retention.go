@@ -0,0 +1,101 @@
+package go_playground
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// Retention bounds how many finished task records a store keeps. Queued
+// and running tasks are never evicted
+type Retention struct {
+	MaxAge        time.Duration // records finished longer ago are evicted, zero keeps them
+	MaxRecords    int           // oldest finished records beyond this are evicted, zero means no limit
+	SweepInterval time.Duration // how often the store is swept
+}
+
+// DefaultRetention keeps finished records for a day, sweeping every minute
+var DefaultRetention = Retention{MaxAge: 24 * time.Hour, SweepInterval: time.Minute}
+
+// pruner is implemented by stores that can evict finished records, such as
+// MemoryStore
+type pruner interface {
+	// Prune evicts records finished before cutoff, then the oldest finished
+	// records while more than maxRecords are kept, and returns the counts
+	Prune(cutoff time.Time, maxRecords int) (expired, overflow int, err error)
+}
+
+// Prune implements the retention sweep of Retention
+func (s *MemoryStore) Prune(cutoff time.Time, maxRecords int) (expired, overflow int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var finished []TaskRecord
+	for id, rec := range s.records {
+		if rec.FinishedAt == nil || !rec.State.Terminal() {
+			continue
+		}
+		if !cutoff.IsZero() && rec.FinishedAt.Before(cutoff) {
+			delete(s.records, id)
+			expired++
+			continue
+		}
+		finished = append(finished, rec)
+	}
+
+	if maxRecords <= 0 || len(s.records) <= maxRecords {
+		return expired, 0, nil
+	}
+	slices.SortFunc(finished, func(a, b TaskRecord) int {
+		return cmp.Or(a.FinishedAt.Compare(*b.FinishedAt), cmp.Compare(a.ID, b.ID))
+	})
+	for _, rec := range finished {
+		if len(s.records) <= maxRecords {
+			break
+		}
+		delete(s.records, rec.ID)
+		overflow++
+	}
+	return expired, overflow, nil
+}
+
+// Len returns the number of records kept
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.records)
+}
+
+// sweepRecords applies the retention policy until the pool is torn down
+func (p *WorkerPool) sweepRecords() {
+	pr, ok := p.store.(pruner)
+	if !ok {
+		p.log.Warn("task store does not support retention, records are kept forever")
+		return
+	}
+	r := *p.retention
+	ticker := time.NewTicker(r.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var cutoff time.Time
+		if r.MaxAge > 0 {
+			cutoff = p.clock.Now().Add(-r.MaxAge)
+		}
+		expired, overflow, err := pr.Prune(cutoff, r.MaxRecords)
+		if err != nil {
+			p.log.Error("task store: pruning records", "error", err)
+			continue
+		}
+		p.metrics.evicted.WithLabelValues("age").Add(float64(expired))
+		p.metrics.evicted.WithLabelValues("count").Add(float64(overflow))
+		if expired+overflow > 0 {
+			p.log.Debug("task records evicted", "expired", expired, "overflow", overflow)
+		}
+	}
+}
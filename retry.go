@@ -0,0 +1,141 @@
+package go_playground
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Classes of handler errors, matched with errors.Is. Handlers mark the
+// errors they return with Retryable, Permanent or Throttled; unmarked
+// errors are retried unless RetryPolicy.RetryableOnly is set
+var (
+	// ErrRetryable marks a transient failure, retried within MaxAttempts
+	// even when it is a timeout and RetryTimeouts is off
+	ErrRetryable = errors.New("retryable")
+	// ErrPermanent marks a failure no retry would fix, the task is
+	// dead-lettered at once
+	ErrPermanent = errors.New("permanent")
+	// ErrThrottled marks a retryable failure whose retry waits at least
+	// the time asked by the downstream, see Throttled
+	ErrThrottled = errors.New("throttled")
+)
+
+// classifiedError is an error marked with its class by Retryable or
+// Permanent. Its message is the one of the error
+type classifiedError struct {
+	err   error
+	class error
+}
+
+func (e *classifiedError) Error() string   { return e.err.Error() }
+func (e *classifiedError) Unwrap() []error { return []error{e.err, e.class} }
+
+// Retryable marks err as transient, nil staying nil
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{err: err, class: ErrRetryable}
+}
+
+// Permanent marks err as not worth a retry, nil staying nil
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{err: err, class: ErrPermanent}
+}
+
+// ThrottledError is a failure caused by a downstream asking to slow down,
+// as with HTTP 429 and Retry-After
+type ThrottledError struct {
+	After time.Duration // wait before the retry, at least
+	Err   error
+}
+
+// Throttled marks err as a throttling failure to retry no sooner than
+// after
+func Throttled(after time.Duration, err error) error {
+	if err == nil {
+		err = ErrThrottled
+	}
+	return &ThrottledError{After: after, Err: err}
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%v (retry after %s)", e.Err, e.After)
+}
+
+func (e *ThrottledError) Unwrap() []error { return []error{e.Err, ErrThrottled} }
+
+// throttledFor returns the wait a throttled failure asks for, zero for
+// others
+func throttledFor(err error) time.Duration {
+	var te *ThrottledError
+	if errors.As(err, &te) {
+		return max(te.After, 0)
+	}
+	return 0
+}
+
+// RetryPolicy controls how failed tasks are retried
+type RetryPolicy struct {
+	MaxAttempts    int           // total attempts including the first one
+	InitialBackoff time.Duration // delay before the first retry
+	MaxBackoff     time.Duration // upper bound for a single delay
+	Multiplier     float64       // growth factor between retries
+	Jitter         float64       // random spread as a fraction of the delay, 0..1
+	RetryTimeouts  bool          // also retry attempts that hit their timeout
+	RetryableOnly  bool          // retry only errors marked Retryable or Throttled
+}
+
+// DefaultRetryPolicy runs every task exactly once
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    1,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// Backoff returns the delay before the retry that follows the given attempt
+func (rp RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	mult := rp.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+
+	d := float64(rp.InitialBackoff) * math.Pow(mult, float64(attempt-1))
+	if rp.MaxBackoff > 0 && d > float64(rp.MaxBackoff) {
+		d = float64(rp.MaxBackoff)
+	}
+	if rp.Jitter > 0 {
+		j := math.Min(rp.Jitter, 1)
+		d += d * j * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// shouldRetry reports whether a task that failed its latest attempt gets another one
+func (rp RetryPolicy) shouldRetry(t Task, err error) bool {
+	if errors.Is(err, ErrPermanent) || errors.Is(err, ErrInvalidPayload) || errors.Is(err, ErrUnknownTaskType) {
+		return false
+	}
+	marked := errors.Is(err, ErrRetryable) || errors.Is(err, ErrThrottled)
+	if !marked && (rp.RetryableOnly || errors.Is(err, ErrTaskTimeout) && !rp.RetryTimeouts) {
+		return false
+	}
+	return t.Attempts < rp.MaxAttempts
+}
+
+// delay returns the wait before retrying a task after the given attempt
+// failed with err: the backoff, or longer when a downstream throttled it
+func (rp RetryPolicy) delay(attempt int, err error) time.Duration {
+	return max(rp.Backoff(attempt), throttledFor(err))
+}
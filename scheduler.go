@@ -0,0 +1,252 @@
+package go_playground
+
+import (
+	"container/heap"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// scheduler holds delayed tasks and recurring schedules in a min-heap
+// ordered by their next due time
+type scheduler struct {
+	mu     sync.Mutex
+	items  schedHeap
+	nextID int
+	wake   chan struct{}
+	named  map[string]time.Time // version of the armed stored schedules
+}
+
+type schedEntry struct {
+	at   time.Time
+	task Task
+	cron *cronSchedule // nil for one-shot delayed tasks
+	id   int           // schedule ID of recurring entries
+	// name and version identify entries of stored schedules, see
+	// PutSchedule
+	name    string
+	version time.Time
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{wake: make(chan struct{}, 1), named: make(map[string]time.Time)}
+}
+
+func (s *scheduler) add(e schedEntry) {
+	s.mu.Lock()
+	heap.Push(&s.items, e)
+	s.mu.Unlock()
+	s.notify()
+}
+
+func (s *scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// put arms the entry of a stored schedule in place of any earlier version
+func (s *scheduler) put(e schedEntry) {
+	s.mu.Lock()
+	s.removeLocked(func(old schedEntry) bool { return old.name == e.name })
+	s.named[e.name] = e.version
+	heap.Push(&s.items, e)
+	s.mu.Unlock()
+	s.notify()
+}
+
+// rearm puts back the entry of a stored schedule that just fired, unless
+// the schedule was replaced or deleted meanwhile
+func (s *scheduler) rearm(e schedEntry) {
+	s.mu.Lock()
+	v, ok := s.named[e.name]
+	if ok && v.Equal(e.version) {
+		heap.Push(&s.items, e)
+	}
+	s.mu.Unlock()
+	s.notify()
+}
+
+// drop disarms a stored schedule
+func (s *scheduler) drop(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeLocked(func(e schedEntry) bool { return e.name == name })
+	delete(s.named, name)
+}
+
+// armed reports whether version of a stored schedule is armed
+func (s *scheduler) armed(name string, version time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.named[name]
+	return ok && v.Equal(version)
+}
+
+// names returns the names of the armed stored schedules
+func (s *scheduler) names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Collect(maps.Keys(s.named))
+}
+
+// popDue removes the entries due at now and returns them together with the
+// time until the next entry, or -1 when nothing is left
+func (s *scheduler) popDue(now time.Time) ([]schedEntry, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []schedEntry
+	for len(s.items) > 0 && !s.items[0].at.After(now) {
+		due = append(due, heap.Pop(&s.items).(schedEntry))
+	}
+	if len(s.items) == 0 {
+		return due, -1
+	}
+	return due, s.items[0].at.Sub(now)
+}
+
+// remove drops the entries matching fn and reports how many were removed
+func (s *scheduler) remove(fn func(schedEntry) bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.removeLocked(fn)
+}
+
+func (s *scheduler) removeLocked(fn func(schedEntry) bool) int {
+	kept := s.items[:0]
+	for _, e := range s.items {
+		if !fn(e) {
+			kept = append(kept, e)
+		} else if e.name != "" {
+			delete(s.named, e.name)
+		}
+	}
+	n := len(s.items) - len(kept)
+	s.items = kept
+	heap.Init(&s.items)
+	return n
+}
+
+func (s *scheduler) newScheduleID() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	return s.nextID
+}
+
+// Schedule submits a copy of task each time the cron spec fires, in local
+// time. Besides five-field expressions it accepts @hourly, @daily, @weekly,
+// @monthly, @yearly and "@every <duration>". The returned ID can be passed
+// to Unschedule. With WithLeaderElection only the leader submits
+func (p *WorkerPool) Schedule(spec string, task Task) (int, error) {
+	cs, err := parseCron(spec)
+	if err != nil {
+		return 0, err
+	}
+	next := cs.next(p.clock.Now())
+	if next.IsZero() {
+		return 0, fmt.Errorf("cron %q never fires", spec)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0, ErrPoolClosed
+	}
+	id := p.sched.newScheduleID()
+	p.sched.add(schedEntry{at: next, task: task, cron: cs, id: id})
+	return id, nil
+}
+
+// Unschedule stops a recurring schedule and reports whether it existed
+func (p *WorkerPool) Unschedule(id int) bool {
+	return p.sched.remove(func(e schedEntry) bool { return e.cron != nil && e.name == "" && e.id == id }) > 0
+}
+
+// runScheduler releases due entries until the pool shuts down and every
+// delayed task has been queued
+func (p *WorkerPool) runScheduler() {
+	quit := p.quit
+	for {
+		due, wait := p.sched.popDue(p.clock.Now())
+		for _, e := range due {
+			p.fire(e)
+		}
+
+		if quit == nil && wait < 0 {
+			return
+		}
+
+		var timer Timer
+		var timeout <-chan time.Time
+		if wait >= 0 {
+			timer = p.clock.NewTimer(wait)
+			timeout = timer.C()
+		}
+		select {
+		case <-timeout:
+		case <-p.sched.wake:
+		case <-quit:
+			// Recurring schedules end with the pool, delayed tasks still drain
+			quit = nil
+			p.sched.remove(func(e schedEntry) bool { return e.cron != nil })
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// fire queues a due entry and re-arms recurring ones
+func (p *WorkerPool) fire(e schedEntry) {
+	if e.cron == nil {
+		defer p.delayed.Done()
+		if err := p.push(e.task); err != nil {
+			p.track(e.task, StateFailed, err)
+		}
+		return
+	}
+
+	tmpl := e.task
+	tmpl.RunAt = time.Time{}
+	log := p.log.With("schedule_id", e.id)
+	if e.name != "" {
+		log = p.log.With("schedule", e.name)
+	}
+	if !p.IsLeader() {
+		log.Debug("schedule: not the leader, skipping")
+	} else if task, err := p.Submit(tmpl); err != nil {
+		log.Error("schedule: submitting task", "error", err)
+	} else {
+		log.Info("schedule: submitted task", "task_id", task.ID)
+	}
+
+	if next := e.cron.next(p.clock.Now()); !next.IsZero() {
+		e.at = next
+		if e.name != "" {
+			p.sched.rearm(e)
+		} else {
+			p.sched.add(e)
+		}
+	}
+}
+
+// schedHeap implements heap.Interface ordered by due time
+type schedHeap []schedEntry
+
+func (h schedHeap) Len() int           { return len(h) }
+func (h schedHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h schedHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *schedHeap) Push(x any)        { *h = append(*h, x.(schedEntry)) }
+
+func (h *schedHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
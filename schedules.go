@@ -0,0 +1,416 @@
+package go_playground
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	// ErrScheduleNotFound is returned for names no schedule is stored under
+	ErrScheduleNotFound = errors.New("schedule not found")
+	// ErrScheduleExists is returned by CreateSchedule for a name in use
+	ErrScheduleExists = errors.New("schedule already exists")
+	// ErrInvalidSchedule is returned for schedules with a bad name, cron
+	// spec or task template
+	ErrInvalidSchedule = errors.New("invalid schedule")
+)
+
+// scheduleSyncInterval is how often schedules stored in a shared backend
+// are reloaded, so changes made through other processes take effect
+const scheduleSyncInterval = 30 * time.Second
+
+// ScheduleDef is a recurring task managed at runtime: a copy of Task is
+// submitted each time the cron spec fires, see Schedule for the syntax
+type ScheduleDef struct {
+	Name      string    `json:"name"`
+	Cron      string    `json:"cron"`
+	Task      Task      `json:"task"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"` // identifies the version of the schedule
+}
+
+// ScheduleStore persists schedule definitions. Backends implementing it,
+// such as redisqueue and boltqueue, keep them across restarts and share
+// them between the processes on the backend; others keep them in memory
+type ScheduleStore interface {
+	SaveSchedule(def ScheduleDef) error
+	// DeleteSchedule reports whether a schedule was stored under name
+	DeleteSchedule(name string) (bool, error)
+	LoadSchedules() ([]ScheduleDef, error)
+}
+
+// memorySchedules is the ScheduleStore of backends without one
+type memorySchedules struct {
+	mu   sync.Mutex
+	defs map[string]ScheduleDef
+}
+
+func (m *memorySchedules) SaveSchedule(def ScheduleDef) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.defs == nil {
+		m.defs = make(map[string]ScheduleDef)
+	}
+	m.defs[def.Name] = def
+	return nil
+}
+
+func (m *memorySchedules) DeleteSchedule(name string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.defs[name]
+	delete(m.defs, name)
+	return ok, nil
+}
+
+func (m *memorySchedules) LoadSchedules() ([]ScheduleDef, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Collect(maps.Values(m.defs)), nil
+}
+
+var scheduleName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// checkSchedule validates def and returns its parsed cron spec
+func (p *WorkerPool) checkSchedule(def ScheduleDef) (*cronSchedule, error) {
+	if !scheduleName.MatchString(def.Name) {
+		return nil, fmt.Errorf("%w: name %q must be 1 to 128 letters, digits, dots, dashes or underscores", ErrInvalidSchedule, def.Name)
+	}
+	cs, err := parseCron(def.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSchedule, err)
+	}
+	if cs.next(p.clock.Now()).IsZero() {
+		return nil, fmt.Errorf("%w: cron %q never fires", ErrInvalidSchedule, def.Cron)
+	}
+	if def.Task.IdempotencyKey != "" {
+		return nil, fmt.Errorf("%w: the task of a schedule cannot have an idempotency key", ErrInvalidSchedule)
+	}
+	return cs, nil
+}
+
+// CreateSchedule stores a new schedule and arms it, failing with
+// ErrScheduleExists if the name is taken
+func (p *WorkerPool) CreateSchedule(def ScheduleDef) (ScheduleDef, error) {
+	if _, err := p.GetSchedule(def.Name); err == nil {
+		return ScheduleDef{}, fmt.Errorf("%w: %s", ErrScheduleExists, def.Name)
+	} else if !errors.Is(err, ErrScheduleNotFound) {
+		return ScheduleDef{}, err
+	}
+	return p.PutSchedule(def)
+}
+
+// PutSchedule stores a schedule, replacing the one of the same name, and
+// arms it on this process. Other processes sharing the backend pick it up
+// within scheduleSyncInterval
+func (p *WorkerPool) PutSchedule(def ScheduleDef) (ScheduleDef, error) {
+	cs, err := p.checkSchedule(def)
+	if err != nil {
+		return ScheduleDef{}, err
+	}
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return ScheduleDef{}, ErrPoolClosed
+	}
+
+	now := p.clock.Now().UTC()
+	def.CreatedAt, def.UpdatedAt = now, now
+	if old, err := p.GetSchedule(def.Name); err == nil {
+		def.CreatedAt = old.CreatedAt
+	}
+	if err := p.schedules.SaveSchedule(def); err != nil {
+		return ScheduleDef{}, fmt.Errorf("saving schedule: %w", err)
+	}
+	p.armSchedule(def, cs)
+	return def, nil
+}
+
+// GetSchedule returns the schedule stored under name
+func (p *WorkerPool) GetSchedule(name string) (ScheduleDef, error) {
+	defs, err := p.ListSchedules()
+	if err != nil {
+		return ScheduleDef{}, err
+	}
+	for _, def := range defs {
+		if def.Name == name {
+			return def, nil
+		}
+	}
+	return ScheduleDef{}, fmt.Errorf("%w: %s", ErrScheduleNotFound, name)
+}
+
+// ListSchedules returns the stored schedules sorted by name. Those
+// registered with Schedule are not included
+func (p *WorkerPool) ListSchedules() ([]ScheduleDef, error) {
+	defs, err := p.schedules.LoadSchedules()
+	if err != nil {
+		return nil, fmt.Errorf("loading schedules: %w", err)
+	}
+	slices.SortFunc(defs, func(a, b ScheduleDef) int { return cmp.Compare(a.Name, b.Name) })
+	return defs, nil
+}
+
+// DeleteSchedule removes a stored schedule and stops it on this process
+func (p *WorkerPool) DeleteSchedule(name string) error {
+	ok, err := p.schedules.DeleteSchedule(name)
+	if err != nil {
+		return fmt.Errorf("deleting schedule: %w", err)
+	}
+	p.sched.drop(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrScheduleNotFound, name)
+	}
+	return nil
+}
+
+// NextRun returns when the schedule fires next, the zero time if never
+func (p *WorkerPool) NextRun(def ScheduleDef) time.Time {
+	cs, err := parseCron(def.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	return cs.next(p.clock.Now())
+}
+
+func (p *WorkerPool) armSchedule(def ScheduleDef, cs *cronSchedule) {
+	tmpl := def.Task
+	tmpl.RunAt = time.Time{}
+	p.sched.put(schedEntry{at: cs.next(p.clock.Now()), task: tmpl, cron: cs, name: def.Name, version: def.UpdatedAt})
+}
+
+// syncSchedules arms the stored schedules that changed since they were
+// last armed and stops those deleted
+func (p *WorkerPool) syncSchedules() {
+	defs, err := p.schedules.LoadSchedules()
+	if err != nil {
+		p.log.Error("schedule: loading schedules", "error", err)
+		return
+	}
+	stored := make(map[string]bool, len(defs))
+	for _, def := range defs {
+		stored[def.Name] = true
+		if p.sched.armed(def.Name, def.UpdatedAt) {
+			continue
+		}
+		cs, err := p.checkSchedule(def)
+		if err != nil {
+			p.log.Error("schedule: skipping stored schedule", "schedule", def.Name, "error", err)
+			continue
+		}
+		p.armSchedule(def, cs)
+	}
+	for _, name := range p.sched.names() {
+		if !stored[name] {
+			p.sched.drop(name)
+		}
+	}
+}
+
+// watchSchedules keeps the armed schedules in line with a shared store
+// until the pool shuts down
+func (p *WorkerPool) watchSchedules() {
+	t := time.NewTicker(scheduleSyncInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			p.syncSchedules()
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// scheduleRequest is the JSON body of POST /schedules and
+// PUT /schedules/{name}
+type scheduleRequest struct {
+	Name string       `json:"name"` // generated when empty on POST, must match the path on PUT
+	Cron string       `json:"cron"`
+	Task eventRequest `json:"task"`
+}
+
+// scheduleResponse is a stored schedule and when it fires next
+type scheduleResponse struct {
+	ScheduleDef
+	NextRun time.Time `json:"next_run,omitzero"`
+}
+
+// scheduleRoutes adds the schedule routes to r
+func (s *Server) scheduleRoutes(r *mux.Router) {
+	r.HandleFunc("/schedules", s.listSchedulesHandler).Methods("GET")
+	r.HandleFunc("/schedules", s.createScheduleHandler).Methods("POST")
+	r.HandleFunc("/schedules/{name}", s.scheduleHandler).Methods("GET")
+	r.HandleFunc("/schedules/{name}", s.putScheduleHandler).Methods("PUT")
+	r.HandleFunc("/schedules/{name}", s.deleteScheduleHandler).Methods("DELETE")
+}
+
+func (s *Server) listSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	limit, err := parseLimit(r, defaultPageLimit)
+	var cursor []string
+	if err == nil {
+		cursor, err = decodeCursor(r, "schedules", 1)
+	}
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	defs, err := p.ListSchedules()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	var past func(ScheduleDef) bool
+	if cursor != nil {
+		past = func(def ScheduleDef) bool { return def.Name > cursor[0] }
+	}
+	defs, more := page(defs, past, limit)
+	if more {
+		setNextPage(w, r, encodeCursor("schedules", defs[len(defs)-1].Name))
+	}
+	resp := make([]scheduleResponse, len(defs))
+	for i, def := range defs {
+		resp[i] = scheduleResponse{ScheduleDef: def, NextRun: p.NextRun(def)}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) scheduleHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	def, err := p.GetSchedule(mux.Vars(r)["name"])
+	if err != nil {
+		scheduleError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, scheduleResponse{ScheduleDef: def, NextRun: p.NextRun(def)})
+}
+
+func (s *Server) createScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	def, ok := decodeSchedule(w, r)
+	if !ok {
+		return
+	}
+	if def.Name == "" {
+		def.Name = newScheduleName()
+	}
+	p, ok := s.target(w, r, def.Task.Queue)
+	if !ok {
+		return
+	}
+	def, err := p.CreateSchedule(def)
+	if err != nil {
+		scheduleError(w, err)
+		return
+	}
+	s.audit(r, p, AuditPutSchedule, map[string]any{"name": def.Name, "cron": def.Cron, "created": true}, nil)
+	writeJSON(w, http.StatusCreated, scheduleResponse{ScheduleDef: def, NextRun: p.NextRun(def)})
+}
+
+func (s *Server) putScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	def, ok := decodeSchedule(w, r)
+	if !ok {
+		return
+	}
+	name := mux.Vars(r)["name"]
+	if def.Name != "" && def.Name != name {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("name %q does not match the path", def.Name), "name")
+		return
+	}
+	def.Name = name
+	p, ok := s.target(w, r, def.Task.Queue)
+	if !ok {
+		return
+	}
+	def, err := p.PutSchedule(def)
+	if err != nil {
+		scheduleError(w, err)
+		return
+	}
+	s.audit(r, p, AuditPutSchedule, map[string]any{"name": def.Name, "cron": def.Cron}, nil)
+	writeJSON(w, http.StatusOK, scheduleResponse{ScheduleDef: def, NextRun: p.NextRun(def)})
+}
+
+func (s *Server) deleteScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	name := mux.Vars(r)["name"]
+	if err := p.DeleteSchedule(name); err != nil {
+		scheduleError(w, err)
+		return
+	}
+	s.audit(r, p, AuditDeleteSchedule, map[string]any{"name": name}, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newScheduleName returns a random name for a schedule created without one
+func newScheduleName() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// decodeSchedule reads a scheduleRequest into a definition whose task
+// template defaults like the events of POST /event
+func decodeSchedule(w http.ResponseWriter, r *http.Request) (ScheduleDef, bool) {
+	var req scheduleRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		badRequest(w, malformedBody(err))
+		return ScheduleDef{}, false
+	}
+	if req.Cron == "" {
+		writeError(w, http.StatusBadRequest, "cron must not be empty", "cron")
+		return ScheduleDef{}, false
+	}
+	def := ScheduleDef{
+		Name: req.Name,
+		Cron: req.Cron,
+		Task: Task{Data: "Event received", Tenant: TenantID(r.Context())},
+	}
+	if err := req.Task.apply(&def.Task); err != nil {
+		be := err.(*badRequestError)
+		be.field = "task." + be.field
+		badRequest(w, be)
+		return ScheduleDef{}, false
+	}
+	return def, true
+}
+
+// scheduleError maps a schedule operation failure to a response
+func scheduleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrScheduleNotFound):
+		writeError(w, http.StatusNotFound, err.Error(), "")
+	case errors.Is(err, ErrScheduleExists):
+		writeError(w, http.StatusConflict, err.Error(), "name")
+	case errors.Is(err, ErrInvalidSchedule):
+		writeError(w, http.StatusBadRequest, err.Error(), "")
+	case errors.Is(err, ErrPoolClosed):
+		writeError(w, http.StatusServiceUnavailable, err.Error(), "")
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error(), "")
+	}
+}
@@ -0,0 +1,832 @@
+package go_playground
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+)
+
+// Server exposes a WorkerPool over HTTP
+type Server struct {
+	pool     *WorkerPool
+	queues   map[string]*WorkerPool // named queues, see WithQueue
+	router   *mux.Router
+	limiter  atomic.Pointer[rateLimiter] // nil without a rate limit
+	inflight *inflightLimiter            // nil without WithConcurrencyLimit
+	auth     *authenticator
+	debug    bool // see WithDebug
+
+	maxBody   int64 // see WithBodyLimit
+	maxUpload int64 // see WithUploadLimit
+
+	compress      bool // see WithCompression
+	compressLevel int
+
+	propagate []string // canonical header names, see WithHeaderPropagation
+
+	auditLog  AuditLog       // nil without WithAuditLog
+	responses *responseCache // nil without WithIdempotentResponses
+	confirms  *confirmations // tokens of bulk cancel and purge
+
+	closing   chan struct{} // closed by CloseStreams
+	closeOnce sync.Once
+}
+
+// ServerOption configures a Server
+type ServerOption func(*Server)
+
+// WithRateLimit limits how fast each client can submit events
+func WithRateLimit(rl RateLimit) ServerOption {
+	return func(s *Server) {
+		s.SetRateLimit(rl)
+	}
+}
+
+// SetRateLimit replaces the submission rate limit while the server runs,
+// removing it when rl.Rate is zero. Clients start with a full bucket
+func (s *Server) SetRateLimit(rl RateLimit) {
+	if rl.Rate <= 0 {
+		s.limiter.Store(nil)
+		return
+	}
+	s.limiter.Store(newRateLimiter(rl))
+}
+
+// WithAuth requires an API key on every request but those to a.Public
+// paths. Without keys the server stays open
+func WithAuth(a Auth) ServerOption {
+	return func(s *Server) {
+		if len(a.Keys) > 0 {
+			s.auth = newAuthenticator(a)
+		}
+	}
+}
+
+// DefaultMaxBodyBytes bounds request bodies without WithBodyLimit
+const DefaultMaxBodyBytes = 1 << 20
+
+// WithBodyLimit refuses request bodies over n bytes with 413, unlimited
+// when n is zero. Uploads have their own limit, see WithUploadLimit
+func WithBodyLimit(n int64) ServerOption {
+	return func(s *Server) {
+		s.maxBody = n
+	}
+}
+
+// WithUploadLimit bounds the payloads streamed to POST /events/upload and
+// the snapshots loaded by POST /admin/snapshot, unlimited by default
+func WithUploadLimit(n int64) ServerOption {
+	return func(s *Server) {
+		s.maxUpload = n
+	}
+}
+
+// WithDebug serves net/http/pprof under /debug/pprof/ and the diagnostics
+// of the pools at /debug/pool. Profiles reveal internals, so keep it behind
+// WithAuth, and Auth.Admins
+func WithDebug() ServerOption {
+	return func(s *Server) {
+		s.debug = true
+	}
+}
+
+// WithQueue serves a pool named with WithName under /queues/{name}, and
+// for events whose body names it. Unnamed pools are ignored
+func WithQueue(p *WorkerPool) ServerOption {
+	return func(s *Server) {
+		if p.Name() != "" {
+			s.queues[p.Name()] = p
+		}
+	}
+}
+
+// NewServer creates the HTTP API for the given pool
+func NewServer(pool *WorkerPool, opts ...ServerOption) *Server {
+	s := &Server{
+		pool:    pool,
+		queues:  make(map[string]*WorkerPool),
+		router:  mux.NewRouter(),
+		closing: make(chan struct{}),
+		maxBody: DefaultMaxBodyBytes,
+		confirms: &confirmations{
+			ttl:    DefaultConfirmationTTL,
+			tokens: make(map[string]pendingConfirmation),
+		},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.router.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+	s.router.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowedHandler)
+	s.router.Use(otelmux.Middleware("workerpool"), correlationMiddleware(pool.log))
+	if s.auth != nil {
+		s.auth.register(s.pool.metrics.registry)
+		s.router.Use(s.auth.middleware)
+	}
+	if s.inflight != nil {
+		s.inflight.register(s.pool.metrics.registry)
+	}
+	s.router.Use(s.encoding, s.limitBody)
+	s.router.Handle("/event", s.idempotent(s.limit(s.eventHandler))).Methods("POST")
+	s.router.Handle("/events/batch", s.idempotent(s.limit(s.batchHandler))).Methods("POST")
+	s.router.Handle("/events/upload", s.limit(s.uploadHandler)).Methods("POST")
+	s.router.HandleFunc("/event/{id:[0-9]+}", s.statusHandler).Methods("GET")
+	s.router.HandleFunc("/event/{id:[0-9]+}", s.cancelHandler).Methods("DELETE")
+	s.router.HandleFunc("/event/{id:[0-9]+}/logs", s.taskLogsHandler).Methods("GET")
+	s.router.HandleFunc("/event/{id:[0-9]+}/result", s.taskResultHandler).Methods("GET")
+	s.router.HandleFunc("/event/{id:[0-9]+}/wait", s.waitHandler).Methods("GET")
+	s.router.HandleFunc("/events/stream", s.streamHandler).Methods("GET")
+	s.router.HandleFunc("/events", s.listTasksHandler).Methods("GET")
+	s.router.HandleFunc("/events/cancel", s.confirmedBulkHandler(AuditCancelTasks, true, (*WorkerPool).previewCancel, (*WorkerPool).CancelTasks)).Methods("POST")
+	s.router.HandleFunc("/events/retry", s.bulkTasksHandler(AuditRetryTasks, (*WorkerPool).RetryTasks)).Methods("POST")
+	s.router.Handle("/metrics", pool.MetricsHandler()).Methods("GET")
+	s.router.HandleFunc("/openapi.json", s.openapiHandler).Methods("GET")
+	s.healthRoutes()
+	s.dashboardRoutes()
+	s.router.HandleFunc("/deadletter", s.listDeadLettersHandler).Methods("GET")
+	s.router.HandleFunc("/deadletter", s.purgeDeadLettersHandler).Methods("DELETE")
+	s.router.HandleFunc("/deadletter/{id:[0-9]+}/retry", s.retryDeadLetterHandler).Methods("POST")
+	s.adminRoutes(s.router)
+	s.workflowRoutes(s.router)
+	s.scheduleRoutes(s.router)
+	s.groupRoutes(s.router)
+	s.tenantRoutes(s.router)
+	s.budgetRoutes(s.router)
+	s.analyticsRoutes(s.router)
+	s.usageRoutes(s.router)
+	s.recoveryRoutes(s.router)
+	s.purgeRoutes(s.router)
+	s.router.HandleFunc("/queues", s.listQueuesHandler).Methods("GET")
+	s.router.HandleFunc("/admin/audit", s.auditHandler).Methods("GET")
+	if s.debug {
+		s.debugRoutes()
+	}
+
+	q := s.router.PathPrefix("/queues/{queue}").Subrouter()
+	q.Handle("/events", s.idempotent(s.limit(s.eventHandler))).Methods("POST")
+	q.Handle("/events/batch", s.idempotent(s.limit(s.batchHandler))).Methods("POST")
+	q.Handle("/events/upload", s.limit(s.uploadHandler)).Methods("POST")
+	q.HandleFunc("/events/{id:[0-9]+}", s.statusHandler).Methods("GET")
+	q.HandleFunc("/events/{id:[0-9]+}", s.cancelHandler).Methods("DELETE")
+	q.HandleFunc("/events/{id:[0-9]+}/logs", s.taskLogsHandler).Methods("GET")
+	q.HandleFunc("/events/{id:[0-9]+}/result", s.taskResultHandler).Methods("GET")
+	q.HandleFunc("/events/{id:[0-9]+}/wait", s.waitHandler).Methods("GET")
+	q.HandleFunc("/events/stream", s.streamHandler).Methods("GET")
+	q.HandleFunc("/events", s.listTasksHandler).Methods("GET")
+	q.HandleFunc("/events/cancel", s.confirmedBulkHandler(AuditCancelTasks, true, (*WorkerPool).previewCancel, (*WorkerPool).CancelTasks)).Methods("POST")
+	q.HandleFunc("/events/retry", s.bulkTasksHandler(AuditRetryTasks, (*WorkerPool).RetryTasks)).Methods("POST")
+	q.HandleFunc("/deadletter", s.listDeadLettersHandler).Methods("GET")
+	q.HandleFunc("/deadletter", s.purgeDeadLettersHandler).Methods("DELETE")
+	q.HandleFunc("/deadletter/{id:[0-9]+}/retry", s.retryDeadLetterHandler).Methods("POST")
+	s.adminRoutes(q)
+	s.workflowRoutes(q)
+	s.scheduleRoutes(q)
+	s.groupRoutes(q)
+	s.tenantRoutes(q)
+	s.budgetRoutes(q)
+	s.analyticsRoutes(q)
+	s.usageRoutes(q)
+	s.recoveryRoutes(q)
+	s.purgeRoutes(q)
+	return s
+}
+
+// limit applies the submission rate and concurrency limits, if any, to a
+// handler
+func (s *Server) limit(h http.HandlerFunc) http.Handler {
+	var next http.Handler = h
+	if l := s.inflight; l != nil {
+		next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l.serve(w, r, h)
+		})
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rl := s.limiter.Load(); rl != nil {
+			rl.serve(w, r, next)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitBody bounds the request body to the limit of its route, answering
+// 413 right away when Content-Length is already past it
+func (s *Server) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := s.maxBody
+		if strings.HasSuffix(r.URL.Path, "/events/upload") || strings.HasSuffix(r.URL.Path, "/admin/snapshot") {
+			limit = s.maxUpload
+		}
+		if limit > 0 && r.Body != nil && r.Body != http.NoBody {
+			if r.ContentLength > limit {
+				writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("body must be at most %d bytes", limit), "")
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// target resolves the pool a request is for: the queue named in the path,
+// else the one named in the body, else the default pool
+func (s *Server) target(w http.ResponseWriter, r *http.Request, body string) (*WorkerPool, bool) {
+	name := mux.Vars(r)["queue"]
+	switch {
+	case name == "":
+		name = body
+	case body != "" && body != name:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("queue %q does not match the path", body), "queue")
+		return nil, false
+	}
+
+	if name == "" || name == s.pool.Name() {
+		return s.pool, true
+	}
+	p, ok := s.queues[name]
+	if !ok {
+		writeErrorCode(w, http.StatusNotFound, CodeUnknownQueue, fmt.Sprintf("unknown queue %q", name), "queue")
+		return nil, false
+	}
+	return p, true
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+func (s *Server) eventHandler(w http.ResponseWriter, r *http.Request) {
+	priority, err := ParsePriority(r.URL.Query().Get("priority"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), "priority")
+		return
+	}
+
+	key, err := idempotencyKey(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	wait, err := parseWait(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	task := Task{
+		Data:           "Event received",
+		Priority:       priority,
+		Tenant:         TenantID(r.Context()),
+		CorrelationID:  CorrelationID(r.Context()),
+		IdempotencyKey: key,
+	}
+	TraceTask(r.Context(), &task)
+	s.propagateHeaders(r, &task)
+	if err := decodeEvent(r, &task); err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	p, ok := s.target(w, r, task.Queue)
+	if !ok {
+		return
+	}
+	if wait > 0 {
+		s.submitAndWait(w, r, p, task, wait)
+		return
+	}
+	task, err = p.SubmitContext(submitContext(r), task)
+	if err != nil {
+		submitError(w, p, err)
+		return
+	}
+	s.respondSubmitted(w, r, p, task)
+}
+
+// respondSubmitted answers the submission of task to p with its record
+func (s *Server) respondSubmitted(w http.ResponseWriter, r *http.Request, p *WorkerPool, task Task) {
+	rec, err := p.Status(task.ID)
+	if err != nil {
+		rec = TaskRecord{Task: task, State: StateQueued}
+	}
+	status := p.submissionStatus(rec)
+	msg := submissionMessage(rec, status)
+	respond(w, r, http.StatusOK, submitted{TaskRecord: rec, Status: status, Message: msg, Links: s.taskLinks(p, task.ID)}, msg)
+}
+
+// submitAndWait answers with the final task record, or with the current
+// one and 202 if the task is still going after wait
+func (s *Server) submitAndWait(w http.ResponseWriter, r *http.Request, p *WorkerPool, task Task, wait time.Duration) {
+	holdOpen(w, wait)
+	f, err := p.submitFuture(submitContext(r), task)
+	if err != nil {
+		submitError(w, p, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	res, err := f.Wait(ctx)
+	if err != nil {
+		f.release()
+		rec, err := p.Status(f.Task().ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error(), "")
+			return
+		}
+		writeJSON(w, http.StatusAccepted, rec)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.TaskRecord)
+}
+
+// batchResponse is the envelope of a batch, with the IDs assigned and the
+// status of each task in request order, an event split by an interceptor
+// taking several. Its status is the one every task shares, or mixed
+type batchResponse struct {
+	envelope
+	IDs      []int    `json:"ids"`
+	Statuses []string `json:"statuses"`
+}
+
+func (s *Server) batchHandler(w http.ResponseWriter, r *http.Request) {
+	p, tasks, ok := s.batchRequest(w, r)
+	if !ok {
+		return
+	}
+
+	tasks, err := p.SubmitBatchContext(submitContext(r), tasks)
+	if err != nil {
+		submitError(w, p, err)
+		return
+	}
+	resp := batchResponse{IDs: make([]int, len(tasks)), Statuses: make([]string, len(tasks))}
+	for i, t := range tasks {
+		rec, err := p.Status(t.ID)
+		if err != nil {
+			rec = TaskRecord{Task: t, State: StateQueued}
+		}
+		resp.IDs[i], resp.Statuses[i] = t.ID, p.submissionStatus(rec)
+		if i == 0 || resp.Statuses[i] == resp.Status {
+			resp.Status = resp.Statuses[i]
+		} else {
+			resp.Status = "mixed"
+		}
+	}
+	resp.Count = count(len(tasks))
+	resp.Message = fmt.Sprintf("%d events submitted", len(tasks))
+	if resp.Status == "queued" {
+		resp.Message = fmt.Sprintf("%d events added to queue", len(tasks))
+	}
+	respond(w, r, http.StatusOK, resp, resp.Message)
+}
+
+// batchRequest decodes a JSON array of events and resolves the pool they
+// all go to
+func (s *Server) batchRequest(w http.ResponseWriter, r *http.Request) (*WorkerPool, []Task, bool) {
+	priority, err := ParsePriority(r.URL.Query().Get("priority"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), "priority")
+		return nil, nil, false
+	}
+
+	key, err := idempotencyKey(r)
+	if err != nil {
+		badRequest(w, err)
+		return nil, nil, false
+	}
+
+	base := Task{
+		Data:           "Event received",
+		Priority:       priority,
+		Tenant:         TenantID(r.Context()),
+		CorrelationID:  CorrelationID(r.Context()),
+		IdempotencyKey: key,
+	}
+	TraceTask(r.Context(), &base)
+	s.propagateHeaders(r, &base)
+	tasks, err := decodeBatch(r, base)
+	if err != nil {
+		badRequest(w, err)
+		return nil, nil, false
+	}
+
+	for i, t := range tasks {
+		if t.Queue != tasks[0].Queue {
+			writeError(w, http.StatusBadRequest, "all events of a batch must go to the same queue", fmt.Sprintf("[%d].queue", i))
+			return nil, nil, false
+		}
+	}
+	p, ok := s.target(w, r, tasks[0].Queue)
+	if !ok {
+		return nil, nil, false
+	}
+	return p, tasks, true
+}
+
+func (s *Server) statusHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := taskID(w, r)
+	if !ok {
+		return
+	}
+
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+
+	rec, err := p.Status(id)
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
+		writeErrorCode(w, http.StatusNotFound, CodeTaskNotFound, err.Error(), "")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	// Served by GET /event/{id}/logs
+	rec.Logs, rec.LogsDropped = nil, 0
+	writeJSON(w, http.StatusOK, rec)
+}
+
+// taskLogsResponse is the body of GET /event/{id}/logs
+type taskLogsResponse struct {
+	ID      int       `json:"id"`
+	Logs    []TaskLog `json:"logs"`
+	Dropped int       `json:"dropped"` // older lines past the size limit
+}
+
+func (s *Server) taskLogsHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := taskID(w, r)
+	if !ok {
+		return
+	}
+
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+
+	logs, dropped, err := p.TaskLogs(id)
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
+		writeErrorCode(w, http.StatusNotFound, CodeTaskNotFound, err.Error(), "")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if logs == nil {
+		logs = []TaskLog{}
+	}
+	writeJSON(w, http.StatusOK, taskLogsResponse{ID: id, Logs: logs, Dropped: dropped})
+}
+
+// taskResultHandler answers with the JSON result of a task, 409 while it
+// has not finished
+func (s *Server) taskResultHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := taskID(w, r)
+	if !ok {
+		return
+	}
+
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+
+	result, err := p.TaskResult(id)
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
+		writeErrorCode(w, http.StatusNotFound, CodeTaskNotFound, err.Error(), "")
+		return
+	case errors.Is(err, ErrNoResult):
+		if rec, serr := p.Status(id); serr == nil && !rec.State.Terminal() {
+			writeErrorCode(w, http.StatusConflict, CodeTaskNotFinished, "task is "+string(rec.State), "")
+			return
+		}
+		writeError(w, http.StatusNotFound, err.Error(), "")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(result)
+}
+
+// waitHandler long-polls a task: it answers with the final record once the
+// task finishes, or with the current one and 202 after the timeout
+// parameter, 30s by default
+func (s *Server) waitHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := taskID(w, r)
+	if !ok {
+		return
+	}
+
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+
+	timeout, err := parseWaitTimeout(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	holdOpen(w, timeout)
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	rec, err := p.WaitTask(ctx, id)
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
+		writeErrorCode(w, http.StatusNotFound, CodeTaskNotFound, err.Error(), "")
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		writeJSON(w, http.StatusAccepted, rec)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error(), "")
+	default:
+		writeJSON(w, http.StatusOK, rec)
+	}
+}
+
+func (s *Server) cancelHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := taskID(w, r)
+	if !ok {
+		return
+	}
+
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+
+	err := p.Cancel(id)
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
+		writeErrorCode(w, http.StatusNotFound, CodeTaskNotFound, err.Error(), "")
+		return
+	case errors.Is(err, ErrTaskFinished):
+		writeErrorCode(w, http.StatusConflict, CodeTaskFinished, err.Error(), "")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	msg := fmt.Sprintf("Event %d canceled", id)
+	respond(w, r, http.StatusOK, envelope{ID: id, Status: "canceled", Message: msg, Links: s.taskLinks(p, id)}, msg)
+}
+
+// listDeadLettersHandler serves a page of the dead letters, by failure
+// time then ID, filtered by type, error substring and failure time range
+func (s *Server) listDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	v := r.URL.Query()
+	limit, err := parseLimit(r, defaultPageLimit)
+	var desc bool
+	if err == nil {
+		_, desc, err = parseSort(r, "failed_at")
+	}
+	var since, until time.Time
+	if err == nil {
+		since, until, err = parseTimeRange(r)
+	}
+	var cursor []string
+	if err == nil {
+		cursor, err = decodeCursor(r, "deadletter", 3)
+	}
+	var afterTime time.Time
+	var afterID int
+	if cursor != nil {
+		nanos, terr := strconv.ParseInt(cursor[1], 10, 64)
+		id, ierr := strconv.Atoi(cursor[2])
+		if terr != nil || ierr != nil || cursor[0] != strconv.FormatBool(desc) {
+			err = &badRequestError{field: "cursor", msg: "cursor of another sort order"}
+		}
+		afterTime, afterID = time.Unix(0, nanos), id
+	}
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	order := func(a, b DeadLetter) int {
+		c := cmp.Or(a.FailedAt.Compare(b.FailedAt), cmp.Compare(a.Task.ID, b.Task.ID))
+		if desc {
+			return -c
+		}
+		return c
+	}
+	typ, errText := v.Get("type"), v.Get("error")
+	dls := slices.DeleteFunc(p.DeadLetters(), func(dl DeadLetter) bool {
+		return (typ != "" && dl.Task.Type != typ) || !strings.Contains(dl.Error, errText) || !inRange(dl.FailedAt, since, until)
+	})
+	slices.SortFunc(dls, order)
+	var past func(DeadLetter) bool
+	if cursor != nil {
+		mark := DeadLetter{Task: Task{ID: afterID}, FailedAt: afterTime}
+		past = func(dl DeadLetter) bool { return order(dl, mark) > 0 }
+	}
+	dls, more := page(dls, past, limit)
+	if more {
+		last := dls[len(dls)-1]
+		setNextPage(w, r, encodeCursor("deadletter", strconv.FormatBool(desc), strconv.FormatInt(last.FailedAt.UnixNano(), 10), strconv.Itoa(last.Task.ID)))
+	}
+	if dls == nil {
+		dls = []DeadLetter{}
+	}
+	writeJSON(w, http.StatusOK, dls)
+}
+
+func (s *Server) purgeDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	n := p.PurgeDeadLetters()
+	s.audit(r, p, AuditPurgeDeadLetters, map[string]any{"purged": n}, nil)
+	msg := fmt.Sprintf("%d dead letters purged", n)
+	respond(w, r, http.StatusOK, envelope{Status: "purged", Message: msg, Count: count(n)}, msg)
+}
+
+func (s *Server) retryDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := taskID(w, r)
+	if !ok {
+		return
+	}
+
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+
+	task, err := p.RetryDeadLetter(id)
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
+		writeErrorCode(w, http.StatusNotFound, CodeTaskNotFound, err.Error(), "")
+		return
+	case err != nil:
+		submitError(w, p, err)
+		return
+	}
+	s.audit(r, p, AuditRetryDeadLetter, map[string]any{"task_id": id, "new_id": task.ID}, nil)
+	s.respondSubmitted(w, r, p, task)
+}
+
+// queueInfo describes a queue in GET /queues
+type queueInfo struct {
+	Name        string `json:"name"`
+	Workers     int    `json:"workers"`
+	BusyWorkers int    `json:"busy_workers"`
+	QueueDepth  int    `json:"queue_depth"`
+	Paused      bool   `json:"paused"`
+}
+
+// allPools returns the default pool followed by the named queues, by name
+func (s *Server) allPools() []*WorkerPool {
+	pools := []*WorkerPool{s.pool}
+	for _, name := range slices.Sorted(maps.Keys(s.queues)) {
+		pools = append(pools, s.queues[name])
+	}
+	return pools
+}
+
+func (s *Server) listQueuesHandler(w http.ResponseWriter, r *http.Request) {
+	pools := s.allPools()
+	queues := make([]queueInfo, len(pools))
+	for i, p := range pools {
+		queues[i] = queueInfo{
+			Name:        p.Name(),
+			Workers:     p.Workers(),
+			BusyWorkers: p.BusyWorkers(),
+			QueueDepth:  p.QueueDepth(),
+			Paused:      p.Paused(),
+		}
+	}
+	writeJSON(w, http.StatusOK, queues)
+}
+
+// taskID reads the {id} route variable, answering 400 when it is malformed
+func taskID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid task id", "id")
+		return 0, false
+	}
+	return id, true
+}
+
+// badRequest answers 400 for a request body that failed validation
+func badRequest(w http.ResponseWriter, err error) {
+	var field string
+	status := http.StatusBadRequest
+	var be *badRequestError
+	if errors.As(err, &be) {
+		field = be.field
+		status = cmp.Or(be.status, status)
+	}
+	writeError(w, status, err.Error(), field)
+}
+
+// submitError maps an enqueue failure on p to a response
+func submitError(w http.ResponseWriter, p *WorkerPool, err error) {
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		writeJSON(w, http.StatusUnprocessableEntity, apiError{Error: err.Error(), Code: CodeValidationFailed, Fields: ve.Fields})
+		return
+	}
+	if errors.Is(err, ErrCallbacksDisabled) {
+		writeErrorCode(w, http.StatusBadRequest, CodeCallbacksDisabled, err.Error(), "callback_url")
+		return
+	}
+	if errors.Is(err, ErrDependencyNotFound) {
+		writeErrorCode(w, http.StatusBadRequest, CodeDependencyNotFound, err.Error(), "depends_on")
+		return
+	}
+	if errors.Is(err, ErrTaskDropped) {
+		writeErrorCode(w, http.StatusUnprocessableEntity, CodeTaskDropped, err.Error(), "")
+		return
+	}
+	if errors.Is(err, ErrQueueFull) || errors.Is(err, ErrTenantQueueFull) {
+		secs := int(math.Ceil(p.retryAfter().Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+		code := CodeQueueFull
+		if errors.Is(err, ErrTenantQueueFull) {
+			code = CodeTenantQueueFull
+		}
+		writeErrorCode(w, http.StatusTooManyRequests, code, err.Error(), "")
+		return
+	}
+	if errors.Is(err, ErrStorageDeadLettered) {
+		writeErrorCode(w, http.StatusInsufficientStorage, CodeTaskDeadLettered, err.Error(), "")
+		return
+	}
+	if errors.Is(err, ErrStorageFull) {
+		writeError(w, http.StatusInsufficientStorage, err.Error(), "")
+		return
+	}
+	if errors.Is(err, ErrTenantDailyLimit) {
+		secs := int(math.Ceil(untilTomorrow(time.Now()).Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+		writeErrorCode(w, http.StatusForbidden, CodeTenantDailyLimit, err.Error(), "")
+		return
+	}
+	writeError(w, http.StatusServiceUnavailable, err.Error(), "")
+}
+
+// apiError is the JSON body of a failed request
+type apiError struct {
+	Error  string       `json:"error"`
+	Code   string       `json:"code"` // one of the Code constants
+	Field  string       `json:"field,omitempty"`
+	Fields []FieldError `json:"fields,omitempty"` // set when a Validator refused the task
+}
+
+// writeError answers with a structured error body, coded after status
+func writeError(w http.ResponseWriter, status int, msg, field string) {
+	writeErrorCode(w, status, statusCode(status), msg, field)
+}
+
+// writeErrorCode answers with a structured error body with a code more
+// specific than the status
+func writeErrorCode(w http.ResponseWriter, status int, code, msg, field string) {
+	writeJSON(w, status, apiError{Error: msg, Code: code, Field: field})
+}
+
+// holdOpen pushes back the write deadline of a response meant to wait up
+// to d, forever when d is zero, so the http.Server WriteTimeout does not
+// cut it short
+func holdOpen(w http.ResponseWriter, d time.Duration) {
+	var deadline time.Time
+	if d > 0 {
+		deadline = time.Now().Add(d + 10*time.Second)
+	}
+	// Writers without deadlines have no timeout to lift
+	_ = http.NewResponseController(w).SetWriteDeadline(deadline)
+}
+
+// writeJSON encodes v as the response body
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
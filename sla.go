@@ -0,0 +1,271 @@
+package go_playground
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// AnyType makes an SLO cover the tasks of every type
+const AnyType = "*"
+
+// SLO is a latency objective of the tasks of a type, met while the given
+// percentile of their latencies over the monitoring window stays within
+// the limits set
+type SLO struct {
+	Type       string        // Task.Type covered, AnyType for all of them
+	Percentile float64       // such as 0.99, 0.95 when zero
+	MaxWait    time.Duration // from submission, or RunAt, to the first attempt; unchecked when zero
+	MaxRun     time.Duration // duration of an attempt; unchecked when zero
+}
+
+// SLAMonitoring checks the time tasks wait in the queue and take to run
+// against objectives. A breach lasting Sustain is logged, counted in
+// workerpool_sla_alerts_total and handed to Alert, and so is its end
+type SLAMonitoring struct {
+	Objectives []SLO
+	Window     time.Duration  // latencies percentiles are computed over, 5m by default
+	Sustain    time.Duration  // how long a breach lasts before it is alerted, 1m by default
+	Interval   time.Duration  // how often objectives are checked, 10s by default
+	MinSamples int            // observations in the window below which an objective is not judged, 10 by default
+	Alert      func(SLAAlert) // called for each alert and recovery, such as SLAWebhook
+}
+
+// SLAAlert reports a sustained breach of an SLO, or its end
+type SLAAlert struct {
+	Queue      string        `json:"queue,omitempty"`
+	Type       string        `json:"type"`
+	Metric     string        `json:"metric"` // wait or run
+	Percentile float64       `json:"percentile"`
+	Objective  time.Duration `json:"objective"`
+	Observed   time.Duration `json:"observed"`
+	Since      time.Time     `json:"since"`    // when the breach began
+	Resolved   bool          `json:"resolved"` // the latency is back within the objective
+}
+
+// SLA metrics
+const (
+	slaWait = "wait"
+	slaRun  = "run"
+)
+
+// maxSLASamples bounds the latencies kept per objective, the oldest going
+// first
+const maxSLASamples = 10000
+
+// SLAWebhook returns an Alert hook posting each alert to url as JSON, with
+// client or http.DefaultClient when nil. Failed deliveries are not retried
+func SLAWebhook(url string, client *http.Client) func(SLAAlert) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(a SLAAlert) {
+		body, _ := json.Marshal(a)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}
+}
+
+// slaSample is a latency observed at a time
+type slaSample struct {
+	at time.Time
+	d  time.Duration
+}
+
+// slaSeries is the latency window of one metric of one objective
+type slaSeries struct {
+	slo       SLO
+	metric    string
+	limit     time.Duration
+	samples   []slaSample   // oldest first
+	observed  time.Duration // percentile at the last check
+	breaching time.Time     // when the current breach began, zero within the objective
+	alerted   bool
+}
+
+// slaMonitor keeps the latencies of the objectives of a pool
+type slaMonitor struct {
+	cfg SLAMonitoring
+
+	mu     sync.Mutex
+	series []*slaSeries
+}
+
+func newSLAMonitor(cfg SLAMonitoring) *slaMonitor {
+	if cfg.Window <= 0 {
+		cfg.Window = 5 * time.Minute
+	}
+	if cfg.Sustain <= 0 {
+		cfg.Sustain = time.Minute
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.MinSamples <= 0 {
+		cfg.MinSamples = 10
+	}
+	m := &slaMonitor{cfg: cfg}
+	for _, slo := range cfg.Objectives {
+		if slo.Percentile <= 0 || slo.Percentile > 1 {
+			slo.Percentile = 0.95
+		}
+		if slo.MaxWait > 0 {
+			m.series = append(m.series, &slaSeries{slo: slo, metric: slaWait, limit: slo.MaxWait})
+		}
+		if slo.MaxRun > 0 {
+			m.series = append(m.series, &slaSeries{slo: slo, metric: slaRun, limit: slo.MaxRun})
+		}
+	}
+	return m
+}
+
+// observe records a latency of a task for the objectives covering it
+func (m *slaMonitor) observe(task Task, metric string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.series {
+		if s.metric != metric || (s.slo.Type != AnyType && s.slo.Type != task.Type) {
+			continue
+		}
+		if len(s.samples) >= maxSLASamples {
+			s.samples = slices.Delete(s.samples, 0, len(s.samples)-maxSLASamples+1)
+		}
+		s.samples = append(s.samples, slaSample{at: now, d: d})
+	}
+}
+
+// percentile returns the latency at the percentile of the objective of s,
+// dropping the samples older than cutoff, and false with too few left
+func (s *slaSeries) percentile(cutoff time.Time, minSamples int) (time.Duration, bool) {
+	i, _ := slices.BinarySearchFunc(s.samples, cutoff, func(x slaSample, t time.Time) int { return x.at.Compare(t) })
+	s.samples = slices.Delete(s.samples, 0, i)
+	if len(s.samples) < minSamples {
+		return 0, false
+	}
+	ds := make([]time.Duration, len(s.samples))
+	for i, x := range s.samples {
+		ds[i] = x.d
+	}
+	slices.Sort(ds)
+	rank := int(math.Ceil(s.slo.Percentile*float64(len(ds)))) - 1
+	return ds[max(rank, 0)], true
+}
+
+// check compares every objective with its window, returning the alerts
+// and recoveries due
+func (m *slaMonitor) check(now time.Time) []SLAAlert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var alerts []SLAAlert
+	for _, s := range m.series {
+		observed, ok := s.percentile(now.Add(-m.cfg.Window), m.cfg.MinSamples)
+		s.observed = observed
+		alert := SLAAlert{Type: s.slo.Type, Metric: s.metric, Percentile: s.slo.Percentile, Objective: s.limit, Observed: observed, Since: s.breaching}
+		switch {
+		case ok && observed > s.limit:
+			if s.breaching.IsZero() {
+				s.breaching = now
+			}
+			if !s.alerted && now.Sub(s.breaching) >= m.cfg.Sustain {
+				s.alerted = true
+				alert.Since = s.breaching
+				alerts = append(alerts, alert)
+			}
+		case !s.breaching.IsZero():
+			// Back within the objective, or too few tasks to tell
+			if s.alerted {
+				alert.Resolved = true
+				alerts = append(alerts, alert)
+			}
+			s.breaching, s.alerted = time.Time{}, false
+		}
+	}
+	return alerts
+}
+
+// state hands fn the objectives as of the last check, for the metrics
+func (m *slaMonitor) state(fn func(s *slaSeries)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.series {
+		fn(s)
+	}
+}
+
+// observeWait records how long a task waited for its first attempt, from
+// its submission or RunAt
+func (p *WorkerPool) observeWait(task Task, queuedAt, now time.Time) {
+	if p.sla == nil || task.Attempts != 1 {
+		return
+	}
+	from := queuedAt
+	if task.RunAt.After(from) {
+		from = task.RunAt
+	}
+	p.sla.observe(task, slaWait, max(now.Sub(from), 0))
+}
+
+// monitorSLA checks the objectives every interval until the pool is torn
+// down
+func (p *WorkerPool) monitorSLA() {
+	ticker := time.NewTicker(p.sla.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, a := range p.sla.check(now) {
+				p.alertSLA(a)
+			}
+			p.sla.state(func(s *slaSeries) {
+				labels := []string{s.slo.Type, s.metric, fmt.Sprint(s.slo.Percentile)}
+				p.metrics.slaLatency.WithLabelValues(labels...).Set(s.observed.Seconds())
+				p.metrics.slaBreached.WithLabelValues(labels...).Set(boolGauge(s.alerted))
+			})
+		}
+	}
+}
+
+// alertSLA logs and counts an alert and hands it to the hook
+func (p *WorkerPool) alertSLA(a SLAAlert) {
+	a.Queue = p.name
+	if a.Resolved {
+		p.log.Info("SLO met again", "type", a.Type, "metric", a.Metric, "percentile", a.Percentile,
+			"objective", a.Objective, "observed", a.Observed, "since", a.Since)
+	} else {
+		p.log.Warn("SLO breached", "type", a.Type, "metric", a.Metric, "percentile", a.Percentile,
+			"objective", a.Objective, "observed", a.Observed, "since", a.Since)
+		p.metrics.slaAlerts.WithLabelValues(a.Type, a.Metric).Inc()
+		p.notes.raise(NotifySLABreach, fmt.Sprintf("p%v %s latency of %s tasks at %s, objective %s, since %s",
+			a.Percentile, a.Metric, a.Type, a.Observed, a.Objective, a.Since.Format(time.RFC3339)), a.Observed.Seconds())
+	}
+	if p.sla.cfg.Alert != nil {
+		p.sla.cfg.Alert(a)
+	}
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,234 @@
+package go_playground
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// ErrSnapshotUnsupported is returned by Export when the backend cannot
+// list its pending tasks without popping them
+var ErrSnapshotUnsupported = errors.New("queue backend does not support snapshots")
+
+// SnapshotVersion is the format version written by Export
+const SnapshotVersion = 1
+
+// pendingLister is implemented by backends that can list the tasks waiting
+// to be popped, in the order they would be
+type pendingLister interface {
+	Pending() ([]Task, error)
+}
+
+// Snapshot is the content of a pool, to move it to another instance or
+// backend with Import. Tasks already handed to workers are not part of it
+type Snapshot struct {
+	Version   int           `json:"version"`
+	Queue     string        `json:"queue,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	Paused    bool          `json:"paused"`
+	Tasks     []Task        `json:"tasks"`     // queued, in dispatch order
+	Delayed   []Task        `json:"delayed"`   // waiting for their RunAt
+	Schedules []ScheduleDef `json:"schedules"` // see PutSchedule
+}
+
+// Export returns the queued and delayed tasks of the pool, its stored
+// schedules and whether it is paused, leaving all of them in place. Pause
+// the pool first for a consistent copy. Tasks still waiting for their
+// dependencies are left out
+func (p *WorkerPool) Export() (Snapshot, error) {
+	l, ok := p.queue.(pendingLister)
+	if !ok {
+		return Snapshot{}, ErrSnapshotUnsupported
+	}
+	tasks, err := l.Pending()
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("listing queued tasks: %w", err)
+	}
+	defs, err := p.ListSchedules()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	// A task popped before a pause waits in the dispatcher
+	if held := p.held.Load(); held != nil {
+		tasks = append([]Task{*held}, tasks...)
+	}
+	if tasks == nil {
+		tasks = []Task{}
+	}
+	if defs == nil {
+		defs = []ScheduleDef{}
+	}
+	return Snapshot{
+		Version:   SnapshotVersion,
+		Queue:     p.name,
+		CreatedAt: time.Now().UTC(),
+		Paused:    p.Paused(),
+		Tasks:     tasks,
+		Delayed:   p.sched.delayedTasks(),
+		Schedules: defs,
+	}, nil
+}
+
+// ImportResult lists the tasks submitted by Import, under their ID in the
+// snapshot and the one they got in this pool
+type ImportResult struct {
+	Tasks     []ReplayedTask `json:"tasks"`
+	Schedules int            `json:"schedules"` // schedules stored
+	Paused    bool           `json:"paused"`    // whether the pool was paused
+}
+
+// Import submits the tasks of a snapshot as new tasks, delayed ones
+// keeping their RunAt, stores its schedules and pauses the pool if the
+// snapshot was taken paused. Idempotency keys are kept, so importing a
+// snapshot twice within WithIdempotencyTTL does not duplicate its tasks.
+// A failed submission stops the import, the result listing what was
+// imported until then
+func (p *WorkerPool) Import(snap Snapshot) (ImportResult, error) {
+	if snap.Version != SnapshotVersion {
+		return ImportResult{}, fmt.Errorf("unsupported snapshot version %d, want %d", snap.Version, SnapshotVersion)
+	}
+	var res ImportResult
+	if snap.Paused {
+		p.Pause()
+		res.Paused = true
+	}
+	for _, def := range snap.Schedules {
+		if _, err := p.PutSchedule(def); err != nil {
+			return res, fmt.Errorf("schedule %s: %w", def.Name, err)
+		}
+		res.Schedules++
+	}
+	for _, t := range slices.Concat(snap.Tasks, snap.Delayed) {
+		orig := t.ID
+		t.ID = 0
+		t.Queue = ""
+		// Queued, its dependencies already succeeded
+		t.DependsOn = nil
+		task, err := p.submitOne(t)
+		if err != nil {
+			res.Tasks = append(res.Tasks, ReplayedTask{OriginalID: orig, Error: err.Error()})
+			return res, fmt.Errorf("task %d: %w", orig, err)
+		}
+		res.Tasks = append(res.Tasks, ReplayedTask{OriginalID: orig, ID: task.ID})
+	}
+	p.log.Info("snapshot imported", "tasks", len(res.Tasks), "schedules", res.Schedules, "from_queue", snap.Queue)
+	return res, nil
+}
+
+// delayedTasks returns the one-shot entries, soonest first
+func (s *scheduler) delayedTasks() []Task {
+	s.mu.Lock()
+	entries := slices.Clone(s.items)
+	s.mu.Unlock()
+	slices.SortFunc(entries, func(a, b schedEntry) int { return a.at.Compare(b.at) })
+	tasks := []Task{}
+	for _, e := range entries {
+		if e.cron == nil {
+			tasks = append(tasks, e.task)
+		}
+	}
+	return tasks
+}
+
+// list returns the queued tasks in pop order, leaving them queued
+func (h *taskHeap) list() []Task {
+	sorted := slices.Clone(h.items)
+	slices.SortFunc(sorted, h.strategy.compare)
+	tasks := make([]Task, len(sorted))
+	for i, qt := range sorted {
+		tasks[i] = qt.task
+	}
+	return tasks
+}
+
+// list returns the queued tasks in submission order, the order tenants
+// are interleaved in depending on the dispatches to come
+func (f *fairTasks) list() []Task {
+	var all []*queuedTask
+	for _, t := range f.active {
+		all = append(all, t.tasks.items...)
+	}
+	slices.SortFunc(all, func(a, b *queuedTask) int { return cmp.Compare(a.seq, b.seq) })
+	tasks := make([]Task, len(all))
+	for i, qt := range all {
+		tasks[i] = qt.task
+	}
+	return tasks
+}
+
+// Pending returns the queued tasks without popping them
+func (q *MemoryQueue) Pending() ([]Task, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.items.list(), nil
+}
+
+// snapshotHandler answers GET /admin/snapshot with the snapshot of the
+// pool as a JSON file download
+func (s *Server) snapshotHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	snap, err := p.Export()
+	switch {
+	case errors.Is(err, ErrSnapshotUnsupported):
+		writeError(w, http.StatusNotImplemented, err.Error(), "")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	name := cmp.Or(p.Name(), "default")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-%s.json", name, snap.CreatedAt.Format("20060102T150405Z"))))
+	writeJSON(w, http.StatusOK, snap)
+}
+
+// importResponse is the body of POST /admin/snapshot. Error is set when a
+// submission failed, after the tasks listed were imported
+type importResponse struct {
+	ImportResult
+	Error string `json:"error,omitempty"`
+}
+
+// importHandler loads a snapshot exported by GET /admin/snapshot
+func (s *Server) importHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	var snap Snapshot
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&snap); err != nil {
+		badRequest(w, malformedBody(err))
+		return
+	}
+	if snap.Version != SnapshotVersion {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported snapshot version %d, want %d", snap.Version, SnapshotVersion), "version")
+		return
+	}
+
+	res, err := p.Import(snap)
+	switch {
+	case errors.Is(err, ErrInvalidSchedule):
+		badRequest(w, err)
+		return
+	case err != nil && len(res.Tasks) == 0 && res.Schedules == 0:
+		submitError(w, p, err)
+		return
+	}
+	s.audit(r, p, AuditImport, map[string]any{"from_queue": snap.Queue, "tasks": len(res.Tasks), "schedules": res.Schedules, "paused": res.Paused}, err)
+	resp := importResponse{ImportResult: res}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	if resp.Tasks == nil {
+		resp.Tasks = []ReplayedTask{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
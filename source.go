@@ -0,0 +1,89 @@
+package go_playground
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+)
+
+// Source delivers tasks from outside the HTTP and gRPC APIs, such as a
+// message bus
+type Source interface {
+	// Name identifies the source in logs
+	Name() string
+	// Run receives messages until ctx is done, handing each task to submit.
+	// A nil error means the task is queued and its message can be
+	// acknowledged. Otherwise the message is left for redelivery if ctx is
+	// done, and dropped as invalid if not
+	Run(ctx context.Context, submit func(context.Context, Task) error) error
+}
+
+// DecodeMessage reads a message body with the JSON fields of POST /event.
+// An empty body yields a task with no data. header looks up message
+// headers, which may carry the idempotency key, correlation ID and trace
+// context under their HTTP names
+func DecodeMessage(body []byte, header func(name string) string) (Task, error) {
+	var task Task
+	if key := header(IdempotencyHeader); key != "" {
+		if len(key) > maxIdempotencyKey {
+			return Task{}, fmt.Errorf("%w: idempotency key must be at most %d bytes", ErrInvalidPayload, maxIdempotencyKey)
+		}
+		task.IdempotencyKey = key
+	}
+	if err := decodeEventJSON(bytes.NewReader(body), &task); err != nil {
+		return Task{}, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	task.CorrelationID = header(CorrelationHeader)
+	if !validCorrelationID(task.CorrelationID) {
+		task.CorrelationID = newCorrelationID()
+	}
+	for _, field := range otel.GetTextMapPropagator().Fields() {
+		if v := header(field); v != "" {
+			if task.TraceContext == nil {
+				task.TraceContext = make(map[string]string)
+			}
+			task.TraceContext[field] = v
+		}
+	}
+	return task, nil
+}
+
+// maxSourceBackoff bounds the wait between attempts to queue a message while
+// the queue is full
+const maxSourceBackoff = time.Second
+
+// Consume runs src, submitting its tasks to p until ctx is done. A full
+// queue holds the source back rather than dropping messages
+func (p *WorkerPool) Consume(ctx context.Context, src Source) error {
+	log := p.log.With("source", src.Name())
+	log.Info("source started")
+	err := src.Run(ctx, func(ctx context.Context, task Task) error {
+		if task.Queue != "" && task.Queue != p.name {
+			return fmt.Errorf("%w: task is for queue %q", ErrInvalidPayload, task.Queue)
+		}
+		backoff := 10 * time.Millisecond
+		for {
+			_, err := p.Submit(task)
+			if !errors.Is(err, ErrQueueFull) {
+				return err
+			}
+			select {
+			case <-time.After(backoff):
+				backoff = min(2*backoff, maxSourceBackoff)
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Error("source stopped", "error", err)
+		return err
+	}
+	log.Info("source stopped")
+	return nil
+}
@@ -0,0 +1,137 @@
+package go_playground
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// WithSpillFile keeps the tasks of an in-memory queue across clean
+// restarts: Shutdown writes the tasks still queued or delayed, those a
+// deadline kept from running, to path as a Snapshot, and Start submits
+// them again, as Import does, before removing the file. A file already
+// there is added to rather than replaced, so the tasks of a process
+// restarted with the listeners handed over survive. Tasks interrupted
+// while running are not kept. Ignored with durable backends
+func WithSpillFile(path string) Option {
+	return func(p *WorkerPool) {
+		p.spillFile = path
+	}
+}
+
+// spilling reports whether the pool keeps its tasks in a spill file
+func (p *WorkerPool) spilling() bool {
+	_, mem := p.queue.(*MemoryQueue)
+	return p.spillFile != "" && mem
+}
+
+// restoreSpill submits the tasks of the spill file left by the previous
+// shutdown. A file that fails to load is renamed rather than lost
+func (p *WorkerPool) restoreSpill() {
+	defer p.delayed.Done()
+	data, err := os.ReadFile(p.spillFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	var snap Snapshot
+	if err == nil {
+		err = json.Unmarshal(data, &snap)
+	}
+	var res ImportResult
+	if err == nil {
+		res, err = p.Import(snap)
+	}
+	if err != nil {
+		p.log.Error("restoring spilled tasks", "file", p.spillFile, "restored", len(res.Tasks), "kept_as", p.setSpillAside(), "error", err)
+		return
+	}
+	if err := os.Remove(p.spillFile); err != nil {
+		p.log.Error("removing spill file", "file", p.spillFile, "error", err)
+	}
+	p.log.Info("spilled tasks restored", "file", p.spillFile, "tasks", len(res.Tasks))
+}
+
+// setSpillAside renames a spill file that failed to load so the next
+// spill does not replace it, and returns its new name
+func (p *WorkerPool) setSpillAside() string {
+	failed := p.spillFile + "." + strconv.FormatInt(time.Now().Unix(), 10) + ".failed"
+	if err := os.Rename(p.spillFile, failed); err != nil {
+		p.log.Error("keeping spill file", "file", p.spillFile, "error", err)
+	}
+	return failed
+}
+
+// writeSpill writes the tasks left in the queue once the dispatcher has
+// stopped, nothing when there are none. The tasks of a spill file already
+// there come first: on a graceful restart the process handing over its
+// listeners spills after the new one has started and found no file
+func (p *WorkerPool) writeSpill() error {
+	snap, err := p.Export()
+	if err != nil {
+		return fmt.Errorf("spilling tasks: %w", err)
+	}
+	if len(snap.Tasks)+len(snap.Delayed) == 0 {
+		return nil
+	}
+	p.mergeSpill(&snap)
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("spilling tasks: %w", err)
+	}
+	// Written aside then renamed, so a crash never leaves half a file
+	tmp, err := os.CreateTemp(filepath.Dir(p.spillFile), filepath.Base(p.spillFile)+".*")
+	if err != nil {
+		return fmt.Errorf("spilling tasks: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), p.spillFile)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("spilling tasks: %w", err)
+	}
+	p.log.Warn("unprocessed tasks spilled", "file", p.spillFile, "tasks", len(snap.Tasks), "delayed", len(snap.Delayed))
+	return nil
+}
+
+// mergeSpill puts the tasks and schedules of the spill file already there,
+// if any, into snap, ahead of its own tasks. Its schedules are left out
+// when snap has one of the same name
+func (p *WorkerPool) mergeSpill(snap *Snapshot) {
+	data, err := os.ReadFile(p.spillFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	var prev Snapshot
+	if err == nil {
+		err = json.Unmarshal(data, &prev)
+	}
+	if err == nil && prev.Version != snap.Version {
+		err = fmt.Errorf("unsupported snapshot version %d, want %d", prev.Version, snap.Version)
+	}
+	if err != nil {
+		p.log.Error("merging spill file", "file", p.spillFile, "kept_as", p.setSpillAside(), "error", err)
+		return
+	}
+	snap.Tasks = append(prev.Tasks, snap.Tasks...)
+	snap.Delayed = append(prev.Delayed, snap.Delayed...)
+	for _, def := range prev.Schedules {
+		if !slices.ContainsFunc(snap.Schedules, func(d ScheduleDef) bool { return d.Name == def.Name }) {
+			snap.Schedules = append(snap.Schedules, def)
+		}
+	}
+	p.log.Info("spill file merged", "file", p.spillFile, "tasks", len(prev.Tasks), "delayed", len(prev.Delayed))
+}
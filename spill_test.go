@@ -0,0 +1,61 @@
+package go_playground
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// spillPool returns an idle pool spilling to path, holding a task of each
+// of data
+func spillPool(t *testing.T, path string, data ...string) *WorkerPool {
+	t.Helper()
+	p := newPool(t, WithSpillFile(path))
+	for _, d := range data {
+		submit(t, p, Task{Data: d})
+	}
+	return p
+}
+
+// TestSpillSurvivesHandoff spills the way a graceful restart does: the new
+// process starts before the old one spills, and spills in turn later
+func TestSpillSurvivesHandoff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spill.json")
+	// The worker of the child is held up, so its next task stays queued
+	child := startPool(t, WithSpillFile(path), WithHandler(TaskHandlerFunc(func(ctx context.Context, _ Task) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})))
+	parent := spillPool(t, path, "parent-1", "parent-2")
+	if err := parent.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown of the parent: %v", err)
+	}
+	submit(t, child, Task{Data: "running"}, Task{Data: "child"})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := child.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown of the child = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	var mu sync.Mutex
+	var ran []string
+	next := startPool(t, WithSpillFile(path), handle(func(task Task) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, task.Data)
+		return nil
+	}))
+	if err := next.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	// The child may have restored the tasks of the parent itself, if its
+	// restore ran late, and spilled them with its own
+	slices.Sort(ran)
+	if want := []string{"child", "parent-1", "parent-2"}; !slices.Equal(ran, want) {
+		t.Errorf("restored tasks ran %q, want %q", ran, want)
+	}
+}
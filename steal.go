@@ -0,0 +1,326 @@
+package go_playground
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// WorkStealing gives every worker a local queue the dispatcher fills in
+// turn, instead of all workers receiving from one channel. A worker runs
+// its own tasks first and, once out of them, steals the oldest task of the
+// peer with the longest backlog, so a worker stuck on a slow task does not
+// keep the tasks queued behind it waiting
+type WorkStealing struct {
+	LocalQueue int // tasks queued on one worker at most, 2 by default
+}
+
+// defaultLocalQueue bounds the local queue of a worker unless set
+const defaultLocalQueue = 2
+
+// localQueue is the backlog of one worker
+type localQueue struct {
+	tasks  []Task
+	notify chan struct{} // wakes the owner, buffered so signals are not lost
+	idle   bool          // the owner is waiting for work
+	stolen int           // tasks the owner took from peers
+	owned  bool          // false once the owner left; peers drain it
+}
+
+// stealScheduler hands tasks from the dispatcher to the local queues of
+// the workers. Tasks in it were popped but not acknowledged
+type stealScheduler struct {
+	capacity int
+	onSteal  func()
+	ring     *hashRing // nil without Affinity
+
+	mu      sync.Mutex
+	locals  map[int]*localQueue // by worker ID
+	order   []int               // owned queues, for round robin
+	next    int
+	queued  int
+	closed  bool
+	changed chan struct{} // closed and replaced when a task is taken
+}
+
+func newStealScheduler(capacity int, onSteal func()) *stealScheduler {
+	if capacity <= 0 {
+		capacity = defaultLocalQueue
+	}
+	return &stealScheduler{
+		capacity: capacity,
+		onSteal:  onSteal,
+		locals:   make(map[int]*localQueue),
+		changed:  make(chan struct{}),
+	}
+}
+
+// join gives worker id a local queue
+func (s *stealScheduler) join(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.locals[id] = &localQueue{notify: make(chan struct{}, 1), owned: true}
+	s.order = append(s.order, id)
+	if s.ring != nil {
+		s.ring.add(id)
+		s.rebalance()
+	}
+	s.signalChanged()
+}
+
+// leave drops worker id from the rotation. Tasks left in its queue are
+// stolen by the others, which are woken up for them, but for keyed tasks
+// that move to the new owner of their key
+func (s *stealScheduler) leave(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.locals[id]
+	if l == nil {
+		return
+	}
+	s.order = slices.DeleteFunc(s.order, func(w int) bool { return w == id })
+	if s.ring != nil {
+		s.ring.remove(id)
+		s.rebalance()
+	}
+	if len(l.tasks) == 0 {
+		delete(s.locals, id)
+	} else {
+		l.owned = false
+		s.wakeIdle()
+	}
+	s.signalChanged()
+}
+
+// push queues task on the next worker with room, or on the worker of its
+// key with Affinity, waiting while there is no room. It reports false if
+// ctx is done first
+func (s *stealScheduler) push(ctx context.Context, task Task) bool {
+	for {
+		s.mu.Lock()
+		if s.place(task) {
+			s.queued++
+			s.mu.Unlock()
+			return true
+		}
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// place appends task to the local queue it goes to if that has room
+func (s *stealScheduler) place(task Task) bool {
+	if w, ok := s.routed(task); ok {
+		l := s.locals[w]
+		if len(l.tasks) >= s.capacity {
+			return false
+		}
+		l.tasks = append(l.tasks, task)
+		signal(l.notify)
+		return true
+	}
+	for range len(s.order) {
+		s.next = (s.next + 1) % len(s.order)
+		l := s.locals[s.order[s.next]]
+		if len(l.tasks) >= s.capacity {
+			continue
+		}
+		l.tasks = append(l.tasks, task)
+		signal(l.notify)
+		s.wakeIdle()
+		return true
+	}
+	return false
+}
+
+// take returns the next task of worker id: its own oldest task, or else the
+// oldest task it may steal from the longest queue. Finding nothing marks the worker idle,
+// so that new tasks anywhere wake it
+func (s *stealScheduler) take(id int) (Task, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	own := s.locals[id]
+	from, i := own, 0
+	if len(own.tasks) == 0 {
+		from = nil
+		for _, l := range s.locals {
+			if j := s.stealable(l); j >= 0 && (from == nil || len(l.tasks) > len(from.tasks)) {
+				from, i = l, j
+			}
+		}
+	}
+	if from == nil {
+		own.idle = true
+		return Task{}, false
+	}
+	own.idle = false
+	task := from.tasks[i]
+	from.tasks = slices.Delete(from.tasks, i, i+1)
+	s.queued--
+	if s.closed && s.queued == 0 {
+		// Peers waiting for tasks they may not steal can leave
+		for _, l := range s.locals {
+			signal(l.notify)
+		}
+	}
+	if from != own {
+		own.stolen++
+		s.onSteal()
+	}
+	if !from.owned && len(from.tasks) == 0 {
+		for w, l := range s.locals {
+			if l == from {
+				delete(s.locals, w)
+			}
+		}
+	}
+	s.signalChanged()
+	return task, true
+}
+
+// wait blocks until worker id may find a task. It reports false once the
+// scheduler is closed and no task is left anywhere
+func (s *stealScheduler) wait(id int) (<-chan struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed && s.queued == 0 {
+		return nil, false
+	}
+	return s.locals[id].notify, true
+}
+
+// close tells workers that no more tasks are coming
+func (s *stealScheduler) close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, l := range s.locals {
+		signal(l.notify)
+	}
+}
+
+// flush removes every locally queued task
+func (s *stealScheduler) flush() []Task {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tasks []Task
+	for w, l := range s.locals {
+		tasks = append(tasks, l.tasks...)
+		l.tasks = nil
+		if !l.owned {
+			delete(s.locals, w)
+		}
+	}
+	s.queued = 0
+	s.signalChanged()
+	return tasks
+}
+
+// len returns the number of locally queued tasks
+func (s *stealScheduler) len() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queued
+}
+
+// spread returns the difference between the longest and the shortest
+// local queue of the running workers, 0 when they are balanced
+func (s *stealScheduler) spread() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lo, hi := -1, 0
+	for _, w := range s.order {
+		n := len(s.locals[w].tasks)
+		hi = max(hi, n)
+		if lo < 0 || n < lo {
+			lo = n
+		}
+	}
+	return hi - max(lo, 0)
+}
+
+// local returns the queued and stolen task counts of worker id
+func (s *stealScheduler) local(id int) (queued, stolen int) {
+	if s == nil {
+		return 0, 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l := s.locals[id]; l != nil && l.owned {
+		return len(l.tasks), l.stolen
+	}
+	return 0, 0
+}
+
+// wakeIdle signals every idle worker, one of which steals the new task
+func (s *stealScheduler) wakeIdle() {
+	for _, l := range s.locals {
+		if l.idle && l.owned {
+			signal(l.notify)
+		}
+	}
+}
+
+func (s *stealScheduler) signalChanged() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// signal sends on a wake-up channel without blocking
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// nextStolen waits for the next task of worker id in work stealing mode,
+// reporting false when the worker should leave
+func (p *WorkerPool) nextStolen(id int) (Task, bool) {
+	for {
+		if task, ok := p.stealer.take(id); ok {
+			// Queued locally, maybe since before a pause
+			if !p.waitResumed() {
+				return Task{}, false
+			}
+			return task, true
+		}
+		notify, ok := p.stealer.wait(id)
+		if !ok || p.ctx.Err() != nil {
+			// Tasks left behind on a teardown are not acknowledged, so
+			// durable backends redeliver them
+			return Task{}, false
+		}
+		select {
+		case <-notify:
+		case t := <-p.gate.ready:
+			p.gate.taken()
+			if !p.waitResumed() {
+				return Task{}, false
+			}
+			return t, true
+		case <-p.retire:
+			return Task{}, false
+		case <-p.drainSignal(id):
+			if p.leaveDrained(id) {
+				return Task{}, false
+			}
+		case <-p.ctx.Done():
+			return Task{}, false
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package go_playground
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStealSchedulerStealsOldestTask(t *testing.T) {
+	var steals int
+	s := newStealScheduler(2, func() { steals++ })
+	s.join(0)
+	s.join(1)
+	ctx := context.Background()
+	for id := 1; id <= 4; id++ {
+		if !s.push(ctx, Task{ID: id}) {
+			t.Fatalf("push of task %d failed", id)
+		}
+	}
+	if s.len() != 4 || s.spread() != 0 {
+		t.Fatalf("%d tasks queued %d apart, want 4 spread evenly", s.len(), s.spread())
+	}
+	// Worker 1 drains its own queue, then takes the oldest task of worker 0
+	var got []int
+	for range 3 {
+		task, ok := s.take(1)
+		if !ok {
+			t.Fatalf("take found no task after %v", got)
+		}
+		got = append(got, task.ID)
+	}
+	if want := []int{1, 3, 2}; !slices.Equal(got, want) {
+		t.Errorf("worker 1 took tasks %v, want %v", got, want)
+	}
+	if queued, stolen := s.local(1); queued != 0 || stolen != 1 || steals != 1 {
+		t.Errorf("worker 1 has %d queued and %d stolen, %d steals counted, want 0, 1 and 1", queued, stolen, steals)
+	}
+	if task, ok := s.take(0); !ok || task.ID != 4 {
+		t.Errorf("worker 0 took %d, %v, want its task 4", task.ID, ok)
+	}
+	if _, ok := s.take(1); ok {
+		t.Error("take found a task in empty queues")
+	}
+}
+
+func TestStealSchedulerPushWaitsForRoom(t *testing.T) {
+	s := newStealScheduler(1, func() {})
+	s.join(0)
+	if !s.push(context.Background(), Task{ID: 1}) {
+		t.Fatal("push to an empty queue failed")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if s.push(ctx, Task{ID: 2}) {
+		t.Fatal("push to a full queue succeeded")
+	}
+
+	done := make(chan bool)
+	go func() { done <- s.push(context.Background(), Task{ID: 2}) }()
+	s.take(0)
+	if !<-done {
+		t.Error("push did not go through once a task was taken")
+	}
+}
+
+func TestWorkStealingRunsTasksQueuedBehindASlowOne(t *testing.T) {
+	release := make(chan struct{})
+	var first atomic.Bool
+	p := startPool(t,
+		WithWorkers(2),
+		WithWorkStealing(WorkStealing{LocalQueue: 8}),
+		WithHandler(TaskHandlerFunc(func(ctx context.Context, _ Task) error {
+			if first.CompareAndSwap(false, true) {
+				select {
+				case <-release:
+				case <-ctx.Done():
+				}
+			}
+			return nil
+		})),
+	)
+	defer close(release)
+
+	submit(t, p, Task{})
+	for range 10 {
+		process(t, p, StateSucceeded, Task{})
+	}
+}
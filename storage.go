@@ -0,0 +1,200 @@
+package go_playground
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Errors of submissions while the queue backend is over its StorageQuota
+var (
+	// ErrStorageFull fails submissions, see StorageReject
+	ErrStorageFull = errors.New("queue storage quota exceeded")
+	// ErrStorageDeadLettered fails submissions whose task was dead-lettered
+	// instead, see StorageDeadLetter. It matches ErrStorageFull
+	ErrStorageDeadLettered = fmt.Errorf("%w, task dead-lettered", ErrStorageFull)
+)
+
+// StoragePolicy decides what happens to submissions while the backend is
+// over its StorageQuota
+type StoragePolicy int
+
+const (
+	// StorageReject fails submissions with ErrStorageFull, 507 over HTTP
+	StorageReject StoragePolicy = iota
+	// StorageEvict evicts the oldest completed records of the backend, such
+	// as completion marks and results, until it is back under its quota.
+	// Submissions are rejected while nothing is left to evict
+	StorageEvict
+	// StorageDeadLetter dead-letters submitted tasks with ErrStorageFull
+	// instead of queueing them, to be retried from the dead-letter queue.
+	// Submit returns the task, with its ID, and ErrStorageDeadLettered
+	StorageDeadLetter
+)
+
+// storagePolicies lists the policies in the order of their names in errors
+var storagePolicies = []StoragePolicy{StorageReject, StorageEvict, StorageDeadLetter}
+
+// String returns the policy name
+func (sp StoragePolicy) String() string {
+	switch sp {
+	case StorageReject:
+		return "reject"
+	case StorageEvict:
+		return "evict"
+	case StorageDeadLetter:
+		return "dead-letter"
+	}
+	return fmt.Sprintf("StoragePolicy(%d)", int(sp))
+}
+
+// ParseStoragePolicy accepts the names returned by String
+func ParseStoragePolicy(s string) (StoragePolicy, error) {
+	for _, sp := range storagePolicies {
+		if s == sp.String() {
+			return sp, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid storage policy %q, want reject, evict or dead-letter", s)
+}
+
+// StorageQuota bounds the storage a persistent backend takes for the
+// queue. The backend is measured every CheckInterval, so it may go over
+// MaxBytes by what is submitted in between
+type StorageQuota struct {
+	MaxBytes      int64
+	Policy        StoragePolicy
+	CheckInterval time.Duration // 10s by default
+}
+
+// StorageSizer is implemented by backends that can measure the storage
+// the queue takes, such as boltqueue, redisqueue and pgqueue
+type StorageSizer interface {
+	StorageBytes(ctx context.Context) (int64, error)
+}
+
+// StorageEvicter is implemented by backends that keep records of
+// completed tasks, which StorageEvict frees
+type StorageEvicter interface {
+	// EvictCompleted deletes the n oldest completed records and returns
+	// how many it deleted, zero when none are left
+	EvictCompleted(ctx context.Context, n int) (int, error)
+}
+
+// storageEvictBatch is the records evicted between two measures
+const storageEvictBatch = 1000
+
+// storageState is the last measure of the backend against its quota
+type storageState struct {
+	quota StorageQuota
+	used  atomic.Int64
+	full  atomic.Bool
+}
+
+// WithStorageQuota applies q to the queue backend, which must implement
+// StorageSizer. See StoragePolicy for what happens over the quota
+func WithStorageQuota(q StorageQuota) Option {
+	return func(p *WorkerPool) {
+		if q.MaxBytes <= 0 {
+			return
+		}
+		if q.CheckInterval <= 0 {
+			q.CheckInterval = 10 * time.Second
+		}
+		p.storage = &storageState{quota: q}
+	}
+}
+
+// StorageUsage returns the bytes the backend took at its last measure and
+// the quota, zero without WithStorageQuota
+func (p *WorkerPool) StorageUsage() (used, limit int64) {
+	if p.storage == nil {
+		return 0, 0
+	}
+	return p.storage.used.Load(), p.storage.quota.MaxBytes
+}
+
+// storageFull reports whether submissions are refused storage
+func (p *WorkerPool) storageFull() bool {
+	return p.storage != nil && p.storage.full.Load()
+}
+
+// refuseStorage applies the policy to a task submitted over the quota
+func (p *WorkerPool) refuseStorage(task Task) error {
+	if p.storage.quota.Policy != StorageDeadLetter {
+		p.metrics.storageRefused.WithLabelValues("rejected").Inc()
+		return ErrStorageFull
+	}
+	p.metrics.storageRefused.WithLabelValues("dead_lettered").Inc()
+	p.taskLogger(task).Warn("task dead-lettered, queue storage full")
+	p.track(task, StateFailed, ErrStorageFull)
+	if err := p.dlq.add(task, ErrStorageFull); err != nil {
+		p.taskLogger(task).Error("storing dead letter", "error", err)
+		return fmt.Errorf("%w, storing the dead letter failed: %w", ErrStorageFull, err)
+	}
+	if p.onDead != nil {
+		p.onDead(task, ErrStorageFull)
+	}
+	return fmt.Errorf("%w: task %d", ErrStorageDeadLettered, task.ID)
+}
+
+// watchStorage measures the backend until the pool is torn down
+func (p *WorkerPool) watchStorage(sizer StorageSizer) {
+	evicter, _ := p.queue.(StorageEvicter)
+	if p.storage.quota.Policy == StorageEvict && evicter == nil {
+		p.log.Warn("queue backend keeps no completed records to evict, rejecting tasks over the storage quota")
+	}
+	ticker := time.NewTicker(p.storage.quota.CheckInterval)
+	defer ticker.Stop()
+	for {
+		p.measureStorage(sizer, evicter)
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// measureStorage records the storage taken by the backend, first evicting
+// completed records while over the quota with StorageEvict
+func (p *WorkerPool) measureStorage(sizer StorageSizer, evicter StorageEvicter) {
+	st := p.storage
+	ctx, cancel := context.WithTimeout(p.ctx, st.quota.CheckInterval)
+	defer cancel()
+	used, err := sizer.StorageBytes(ctx)
+	if err != nil {
+		p.log.Error("measuring queue storage", "error", err)
+		return
+	}
+	evicted := 0
+	for used > st.quota.MaxBytes && st.quota.Policy == StorageEvict && evicter != nil {
+		n, err := evicter.EvictCompleted(ctx, storageEvictBatch)
+		if err != nil {
+			p.log.Error("evicting completed records", "error", err)
+			break
+		}
+		if n == 0 {
+			break
+		}
+		evicted += n
+		if used, err = sizer.StorageBytes(ctx); err != nil {
+			p.log.Error("measuring queue storage", "error", err)
+			return
+		}
+	}
+	if evicted > 0 {
+		p.metrics.storageEvicted.Add(float64(evicted))
+		p.log.Info("completed records evicted over the storage quota", "records", evicted, "bytes", used)
+	}
+	st.used.Store(used)
+	full := used > st.quota.MaxBytes
+	switch was := st.full.Swap(full); {
+	case full && !was:
+		p.log.Warn("queue storage over quota", "bytes", used, "max_bytes", st.quota.MaxBytes, "policy", st.quota.Policy)
+	case !full && was:
+		p.log.Info("queue storage back under quota", "bytes", used, "max_bytes", st.quota.MaxBytes)
+	}
+}
@@ -0,0 +1,78 @@
+package go_playground
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// sizedQueue is a memory queue measured as taking bytes of storage
+type sizedQueue struct {
+	*MemoryQueue
+	bytes int64
+}
+
+func (q *sizedQueue) StorageBytes(context.Context) (int64, error) { return q.bytes, nil }
+
+// fullPool starts a pool whose backend is over its storage quota
+func fullPool(t *testing.T, policy StoragePolicy) *WorkerPool {
+	t.Helper()
+	p := startPool(t, failing(),
+		WithQueueBackend(&sizedQueue{MemoryQueue: NewMemoryQueue(10), bytes: 100}),
+		WithStorageQuota(StorageQuota{MaxBytes: 10, Policy: policy, CheckInterval: time.Hour}),
+	)
+	deadline := time.Now().Add(5 * time.Second)
+	for !p.storageFull() {
+		if time.Now().After(deadline) {
+			t.Fatal("storage never measured over the quota")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return p
+}
+
+func TestStorageRejectFailsSubmissions(t *testing.T) {
+	p := fullPool(t, StorageReject)
+	if _, err := p.Submit(Task{}); !errors.Is(err, ErrStorageFull) || errors.Is(err, ErrStorageDeadLettered) {
+		t.Errorf("Submit = %v, want %v", err, ErrStorageFull)
+	}
+	if _, err := p.SubmitBatch([]Task{{}, {}}); !errors.Is(err, ErrStorageFull) {
+		t.Errorf("SubmitBatch = %v, want %v", err, ErrStorageFull)
+	}
+	if dls := p.DeadLetters(); len(dls) != 0 {
+		t.Errorf("%d tasks dead-lettered, want none", len(dls))
+	}
+}
+
+func TestStorageDeadLetterReportsTheDeadLetter(t *testing.T) {
+	p := fullPool(t, StorageDeadLetter)
+	task, err := p.Submit(Task{Data: "a"})
+	if !errors.Is(err, ErrStorageDeadLettered) || !errors.Is(err, ErrStorageFull) {
+		t.Fatalf("Submit = %v, want %v", err, ErrStorageDeadLettered)
+	}
+	if task.ID == 0 {
+		t.Fatal("dead-lettered task has no ID")
+	}
+	if _, err := p.SubmitBatch([]Task{{Data: "b"}, {Data: "c"}}); !errors.Is(err, ErrStorageDeadLettered) {
+		t.Errorf("SubmitBatch = %v, want %v", err, ErrStorageDeadLettered)
+	}
+	dls := p.DeadLetters()
+	if len(dls) != 3 || dls[0].Task.ID != task.ID {
+		t.Errorf("dead letters %+v, want the 3 tasks submitted", dls)
+	}
+	if rec, _ := p.Status(task.ID); rec.State != StateFailed {
+		t.Errorf("dead-lettered task %s, want %s", rec.State, StateFailed)
+	}
+}
+
+func TestStorageDeadLetterOverHTTP(t *testing.T) {
+	p := fullPool(t, StorageDeadLetter)
+	w := serve(NewServer(p), http.MethodPost, "/event", `{"data":"a"}`)
+	var body apiError
+	decode(t, w, &body)
+	if w.Code != http.StatusInsufficientStorage || body.Code != CodeTaskDeadLettered {
+		t.Errorf("POST /event = %d %+v, want 507 %s", w.Code, body, CodeTaskDeadLettered)
+	}
+}
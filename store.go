@@ -0,0 +1,137 @@
+package go_playground
+
+import (
+	"sync"
+	"time"
+)
+
+// TaskState is a step in the task lifecycle
+type TaskState string
+
+const (
+	StateQueued    TaskState = "queued"
+	StateRunning   TaskState = "running"
+	StateSucceeded TaskState = "succeeded"
+	StateFailed    TaskState = "failed"
+	StateCanceled  TaskState = "canceled"
+)
+
+// Terminal reports whether the task will not change state anymore
+func (s TaskState) Terminal() bool {
+	return s == StateSucceeded || s == StateFailed || s == StateCanceled
+}
+
+// TaskRecord is the tracked status of a task
+type TaskRecord struct {
+	Task
+	State     TaskState `json:"state"`
+	Error     string    `json:"error,omitempty"`
+	Output    string    `json:"output,omitempty"`     // set by the handler through SetOutput
+	HasResult bool      `json:"has_result,omitempty"` // set once a result set through SetResult is stored
+	Progress  *Progress `json:"progress,omitempty"`
+	// Logs are the latest lines logged through LoggerFrom, LogsDropped
+	// counts the older ones past the limit
+	Logs        []TaskLog  `json:"logs,omitempty"`
+	LogsDropped int        `json:"logs_dropped,omitempty"`
+	QueuedAt    time.Time  `json:"queued_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// TaskStore persists task records
+type TaskStore interface {
+	Save(rec TaskRecord) error
+	Get(id int) (TaskRecord, error) // returns ErrTaskNotFound for unknown IDs
+}
+
+// MemoryStore is a TaskStore backed by a map
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[int]TaskRecord
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[int]TaskRecord)}
+}
+
+// Save implements TaskStore
+func (s *MemoryStore) Save(rec TaskRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[rec.ID] = rec
+	return nil
+}
+
+// Get implements TaskStore
+func (s *MemoryStore) Get(id int) (TaskRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.records[id]
+	if !ok {
+		return TaskRecord{}, ErrTaskNotFound
+	}
+	return rec, nil
+}
+
+// Status returns the tracked record for a task
+func (p *WorkerPool) Status(id int) (TaskRecord, error) {
+	return p.store.Get(id)
+}
+
+// track records a state transition for the task
+func (p *WorkerPool) track(task Task, state TaskState, taskErr error) {
+	p.trackOutput(task, state, taskErr, "", false)
+}
+
+// trackOutput is track for a transition that also records handler output
+// and whether a result was stored
+func (p *WorkerPool) trackOutput(task Task, state TaskState, taskErr error, output string, hasResult bool) {
+	now := p.clock.Now()
+	rec, err := p.store.Get(task.ID)
+	if err != nil {
+		rec = TaskRecord{QueuedAt: now}
+	}
+	p.tenants.tracked(task, rec.State, state)
+
+	rec.Task = task
+	rec.State = state
+	switch state {
+	case StateQueued:
+		rec.QueuedAt = now
+		rec.StartedAt, rec.FinishedAt = nil, nil
+		rec.Error, rec.Output, rec.HasResult = "", "", false
+		rec.Progress = nil
+		rec.Logs, rec.LogsDropped = nil, 0
+	case StateRunning:
+		p.observeWait(task, rec.QueuedAt, now)
+		started := now // copied so other transitions do not allocate now
+		rec.StartedAt = &started
+		rec.Progress = nil // each attempt starts over
+	case StateSucceeded, StateFailed, StateCanceled:
+		finished := now
+		rec.FinishedAt = &finished
+	}
+	if taskErr != nil {
+		rec.Error = taskErr.Error()
+	}
+	if output != "" {
+		rec.Output = output
+	}
+	if hasResult {
+		rec.HasResult = true
+	}
+
+	if err := p.store.Save(rec); err != nil {
+		p.taskLogger(task).Error("task store: saving record", "state", state, "error", err)
+	}
+	p.events.publish(TaskEvent{Task: task, State: state, Error: rec.Error, Time: now})
+	if state.Terminal() {
+		p.waiters.notify(rec)
+		p.sendWebhook(rec)
+		p.advanceWorkflow(rec)
+		p.groupTaskDone(rec)
+		p.dependencyDone(rec)
+		p.archiveRecord(rec)
+	}
+}
@@ -0,0 +1,95 @@
+package go_playground
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	streamBuffer    = 256
+	streamHeartbeat = 15 * time.Second
+)
+
+// streamHandler pushes task state transitions as server-sent events.
+// ?task_id=1,2 limits the stream to some tasks and ?terminal=true to final
+// states only
+func (s *Server) streamHandler(w http.ResponseWriter, r *http.Request) {
+	ids := make(map[int]bool)
+	if raw := r.URL.Query().Get("task_id"); raw != "" {
+		for _, part := range strings.Split(raw, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid task id %q", part), "task_id")
+				return
+			}
+			ids[id] = true
+		}
+	}
+	terminalOnly := r.URL.Query().Get("terminal") == "true"
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+
+	holdOpen(w, 0)
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	events, cancel := p.Subscribe(streamBuffer)
+	defer cancel()
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if len(ids) > 0 && !ids[ev.Task.ID] {
+				continue
+			}
+			if terminalOnly && !ev.State.Terminal() {
+				continue
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			name := string(ev.State)
+			if ev.Progress != nil {
+				name = "progress"
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Task.ID, name, data); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// CloseStreams ends open event streams, which would otherwise keep an
+// http.Server Shutdown waiting. Register it with http.Server.RegisterOnShutdown
+func (s *Server) CloseStreams() {
+	s.closeOnce.Do(func() { close(s.closing) })
+}
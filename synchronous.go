@@ -0,0 +1,42 @@
+package go_playground
+
+import (
+	"log/slog"
+	"time"
+)
+
+// NewTestPool returns a started pool for unit tests of handlers and of
+// submission code: it is synchronous, see WithSynchronous, and does not
+// log. Options are applied after those, so WithLogger brings logs back
+func NewTestPool(opts ...Option) *WorkerPool {
+	p := NewWorkerPool(append([]Option{WithSynchronous(), WithLogger(slog.New(slog.DiscardHandler))}, opts...)...)
+	p.Start()
+	return p
+}
+
+// runInline runs a task on the goroutine submitting it, for synchronous
+// pools
+func (p *WorkerPool) runInline(task Task) error {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return ErrPoolClosed
+	}
+	if err := p.startInline(); err != nil {
+		return err
+	}
+
+	p.track(task, StateQueued, nil)
+	p.metrics.enqueued.Inc()
+	p.busy.Add(1)
+	defer p.busy.Add(-1)
+	start := time.Now()
+	defer func() {
+		if v := recover(); v != nil {
+			p.failPanicked(0, task, time.Since(start), panicError(v))
+		}
+	}()
+	p.process(0, task)
+	return nil
+}
@@ -0,0 +1,65 @@
+package go_playground
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTestPoolRunsTasksBeforeSubmitReturns(t *testing.T) {
+	var ran []int
+	p := NewTestPool(WithHandler(TaskHandlerFunc(func(_ context.Context, task Task) error {
+		ran = append(ran, task.ID)
+		return nil
+	})))
+	defer p.Shutdown(context.Background())
+
+	// RunAt is ignored as well
+	for _, task := range []Task{{}, {RunAt: time.Now().Add(time.Hour)}} {
+		task, err := p.Submit(task)
+		if err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+		if len(ran) == 0 || ran[len(ran)-1] != task.ID {
+			t.Fatalf("task %d had not run when Submit returned, ran %v", task.ID, ran)
+		}
+		if rec, err := p.Status(task.ID); err != nil || rec.State != StateSucceeded {
+			t.Errorf("Status(%d) = %s, %v, want %s", task.ID, rec.State, err, StateSucceeded)
+		}
+	}
+}
+
+func TestTestPoolRetriesWithoutBackoff(t *testing.T) {
+	attempts := 0
+	p := NewTestPool(
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour, Multiplier: 2}),
+		WithHandler(TaskHandlerFunc(func(context.Context, Task) error {
+			attempts++
+			if attempts < 3 {
+				return errBroken
+			}
+			return nil
+		})),
+	)
+	defer p.Shutdown(context.Background())
+
+	start := time.Now()
+	process(t, p, StateSucceeded, Task{})
+	if attempts != 3 {
+		t.Errorf("task succeeded after %d attempts, want 3", attempts)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("retries took %v, want no backoff", d)
+	}
+}
+
+func TestTestPoolRefusesTasksAfterShutdown(t *testing.T) {
+	p := NewTestPool(nopHandler())
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if _, err := p.Submit(Task{}); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Submit after Shutdown = %v, want %v", err, ErrPoolClosed)
+	}
+}
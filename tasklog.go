@@ -0,0 +1,192 @@
+package go_playground
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultTaskLogLimit is the size of the log lines kept per task, see
+// WithTaskLogLimit
+const DefaultTaskLogLimit = 16 << 10
+
+// TaskLog is a line logged by a handler through LoggerFrom
+type TaskLog struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Attempt int               `json:"attempt"`
+	Attrs   map[string]string `json:"attrs,omitempty"`
+}
+
+// size approximates the bytes the line takes, for the per-task limit
+func (l TaskLog) size() int {
+	n := len(l.Level) + len(l.Message) + 32
+	for k, v := range l.Attrs {
+		n += len(k) + len(v)
+	}
+	return n
+}
+
+// taskLogKey is the context key of the running task's taskLogs
+type taskLogKey struct{}
+
+// taskLogs captures the lines logged for one task, keeping the latest ones
+// within the limit
+type taskLogs struct {
+	p      *WorkerPool
+	id     int
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	limit   int // taskLogLimit, or lower for tasks with Guardrails
+	attempt int
+	lines   []TaskLog
+	size    int
+	dropped int
+}
+
+// newTaskLogs returns the logs of a task about to run, logging through log
+// as well. With capture disabled the lines only go to log
+func (p *WorkerPool) newTaskLogs(task Task, log *slog.Logger) *taskLogs {
+	l := &taskLogs{p: p, id: task.ID, logger: log, limit: p.taskLogLimit}
+	if p.taskLogLimit > 0 {
+		l.logger = slog.New(&taskLogHandler{next: log.Handler(), logs: l})
+	}
+	return l
+}
+
+// setAttempt tags the lines logged from now on
+func (l *taskLogs) setAttempt(n int) {
+	l.mu.Lock()
+	l.attempt = n
+	l.mu.Unlock()
+}
+
+// bound lowers the limit to n, the lines past it being dropped with the
+// next one
+func (l *taskLogs) bound(n int) {
+	l.mu.Lock()
+	l.limit = min(l.limit, n)
+	l.mu.Unlock()
+}
+
+// add keeps line, dropping the oldest ones past the limit, and stores the
+// lines on the record of the running task
+func (l *taskLogs) add(line TaskLog) {
+	l.mu.Lock()
+	if len(line.Message) > l.limit {
+		line.Message = line.Message[:l.limit]
+	}
+	line.Attempt = l.attempt
+	l.lines = append(l.lines, line)
+	l.size += line.size()
+	for l.size > l.limit && len(l.lines) > 1 {
+		l.size -= l.lines[0].size()
+		l.lines = slices.Delete(l.lines, 0, 1)
+		l.dropped++
+	}
+	lines, dropped := slices.Clone(l.lines), l.dropped
+	l.mu.Unlock()
+
+	rec, err := l.p.store.Get(l.id)
+	if err != nil || rec.State != StateRunning {
+		return
+	}
+	rec.Logs, rec.LogsDropped = lines, dropped
+	if err := l.p.store.Save(rec); err != nil {
+		l.p.taskLogger(rec.Task).Error("task store: saving logs", "error", err)
+	}
+}
+
+// LoggerFrom returns the logger of the task run with ctx. Its lines go to
+// the pool log with the task ID and are kept with the task record, all
+// levels included, see WithTaskLogLimit. Outside of a pool handler it is
+// slog.Default()
+func LoggerFrom(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(taskLogKey{}).(*taskLogs); ok {
+		return l.logger
+	}
+	return slog.Default()
+}
+
+// TaskLogs returns the lines logged by the handler of a task, and how many
+// older ones were dropped past the limit
+func (p *WorkerPool) TaskLogs(id int) ([]TaskLog, int, error) {
+	rec, err := p.store.Get(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rec.Logs, rec.LogsDropped, nil
+}
+
+// taskLogHandler captures records into taskLogs and passes the ones its
+// level allows on to next
+type taskLogHandler struct {
+	next   slog.Handler
+	logs   *taskLogs
+	attrs  map[string]string // from WithAttrs, keys prefixed by their groups
+	prefix string            // the groups opened by WithGroup, dot separated
+}
+
+func (h *taskLogHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *taskLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	line := TaskLog{Time: r.Time, Level: r.Level.String(), Message: r.Message}
+	if len(h.attrs) > 0 || r.NumAttrs() > 0 {
+		line.Attrs = make(map[string]string, len(h.attrs)+r.NumAttrs())
+		maps.Copy(line.Attrs, h.attrs)
+		r.Attrs(func(a slog.Attr) bool {
+			flattenAttr(line.Attrs, h.prefix, a)
+			return true
+		})
+	}
+	h.logs.add(line)
+	if !h.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *taskLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.next = h.next.WithAttrs(attrs)
+	c.attrs = make(map[string]string, len(h.attrs)+len(attrs))
+	maps.Copy(c.attrs, h.attrs)
+	for _, a := range attrs {
+		flattenAttr(c.attrs, h.prefix, a)
+	}
+	return &c
+}
+
+func (h *taskLogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.next = h.next.WithGroup(name)
+	c.prefix += name + "."
+	return &c
+}
+
+// flattenAttr adds a to m, naming the members of groups with dotted keys
+func flattenAttr(m map[string]string, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() != slog.KindGroup {
+		if a.Key != "" {
+			m[prefix+a.Key] = v.String()
+		}
+		return
+	}
+	if a.Key != "" {
+		prefix += a.Key + "."
+	}
+	for _, g := range v.Group() {
+		flattenAttr(m, prefix, g)
+	}
+}
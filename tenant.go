@@ -0,0 +1,287 @@
+package go_playground
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Errors returned by Submit for tasks over the quota of their tenant, see
+// WithTenantQuotas
+var (
+	ErrTenantQueueFull  = errors.New("tenant has too many queued tasks")
+	ErrTenantDailyLimit = errors.New("tenant reached its daily submission limit")
+)
+
+// TenantQuota bounds the use of a pool by one Task.Tenant. Zero fields
+// leave that use unbounded
+type TenantQuota struct {
+	MaxQueued   int `json:"max_queued,omitempty"`    // tasks waiting to run, delayed ones included
+	MaxInFlight int `json:"max_in_flight,omitempty"` // tasks running at once
+	MaxPerDay   int `json:"max_per_day,omitempty"`   // submissions per UTC day
+}
+
+// TenantQuotas sets the quotas of every tenant. Tasks without a tenant are
+// not bounded. Tasks of a tenant at MaxInFlight are held back by the
+// dispatcher like those of a type at its TypeConcurrency limit
+type TenantQuotas struct {
+	Default TenantQuota            // for tenants not listed
+	Tenants map[string]TenantQuota // Task.Tenant -> quota
+	MaxHeld int                    // held tasks before the dispatcher waits for a slot, 100 by default
+}
+
+// quota returns the quota of a tenant
+func (q TenantQuotas) quota(tenant string) TenantQuota {
+	if tq, ok := q.Tenants[tenant]; ok {
+		return tq
+	}
+	return q.Default
+}
+
+// limitsInFlight reports whether some tenant has an in-flight quota
+func (q TenantQuotas) limitsInFlight() bool {
+	if q.Default.MaxInFlight > 0 {
+		return true
+	}
+	for _, tq := range q.Tenants {
+		if tq.MaxInFlight > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// TenantUsage is what a tenant uses of a pool, with its quota
+type TenantUsage struct {
+	Tenant   string      `json:"tenant"`
+	Queued   int         `json:"queued"`
+	InFlight int         `json:"in_flight"`
+	Today    int         `json:"submitted_today"`
+	Quota    TenantQuota `json:"quota"`
+}
+
+// tenantUse counts the tasks of one tenant
+type tenantUse struct {
+	queued, running int
+	day             string // UTC date today counts submissions of
+	today           int
+}
+
+// tenantLedger enforces TenantQuotas. Queued and running tasks are counted
+// from the state transitions of their records
+type tenantLedger struct {
+	quotas TenantQuotas
+
+	mu       sync.Mutex
+	use      map[string]*tenantUse
+	reserved map[int]bool // tasks being submitted, true once their record counts them as queued
+}
+
+func newTenantLedger(q TenantQuotas) *tenantLedger {
+	return &tenantLedger{quotas: q, use: make(map[string]*tenantUse), reserved: make(map[int]bool)}
+}
+
+// get returns the counts of a tenant, resetting the daily count on a new
+// day. The caller holds mu
+func (l *tenantLedger) get(tenant string, now time.Time) *tenantUse {
+	u, ok := l.use[tenant]
+	if !ok {
+		u = &tenantUse{}
+		l.use[tenant] = u
+	}
+	if day := now.UTC().Format(time.DateOnly); u.day != day {
+		u.day, u.today = day, 0
+	}
+	return u
+}
+
+// reserve counts the submission of tasks, refusing them all when some
+// would exceed the quota of their tenant. The caller ends the reservation
+// with submitted once the tasks are queued, or with release
+func (l *tenantLedger) reserve(tasks []Task, refused *prometheus.CounterVec) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	counts := make(map[string]int)
+	for _, t := range tasks {
+		if t.Tenant != "" {
+			counts[t.Tenant]++
+		}
+	}
+	for tenant, n := range counts {
+		u, q := l.get(tenant, now), l.quotas.quota(tenant)
+		if q.MaxPerDay > 0 && u.today+n > q.MaxPerDay {
+			refused.WithLabelValues(tenant, "daily").Add(float64(n))
+			return fmt.Errorf("%w: %s may submit %d tasks a day", ErrTenantDailyLimit, tenant, q.MaxPerDay)
+		}
+		if q.MaxQueued > 0 && u.queued+n > q.MaxQueued {
+			refused.WithLabelValues(tenant, "queued").Add(float64(n))
+			return fmt.Errorf("%w: %s may queue %d tasks", ErrTenantQueueFull, tenant, q.MaxQueued)
+		}
+	}
+	for _, t := range tasks {
+		if t.Tenant == "" {
+			continue
+		}
+		u := l.get(t.Tenant, now)
+		u.today++
+		u.queued++
+		l.reserved[t.ID] = false
+	}
+	return nil
+}
+
+// submitted keeps the reservation of tasks that were queued
+func (l *tenantLedger) submitted(tasks []Task) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, t := range tasks {
+		delete(l.reserved, t.ID)
+	}
+}
+
+// release gives back the reservation of tasks that were not submitted
+// after all, such as when the queue refused them. Their records, if any,
+// have already given back the queued count
+func (l *tenantLedger) release(tasks []Task) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for _, t := range tasks {
+		tracked, ok := l.reserved[t.ID]
+		if !ok {
+			continue
+		}
+		delete(l.reserved, t.ID)
+		u := l.get(t.Tenant, now)
+		if !tracked {
+			u.queued = max(u.queued-1, 0)
+		}
+		u.today = max(u.today-1, 0)
+	}
+}
+
+// tracked follows a task from state prev, empty when it had no record, to
+// state
+func (l *tenantLedger) tracked(t Task, prev, state TaskState) {
+	if l == nil || t.Tenant == "" || prev == state {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	u := l.get(t.Tenant, time.Now())
+	switch prev {
+	case StateQueued:
+		u.queued = max(u.queued-1, 0)
+	case StateRunning:
+		u.running = max(u.running-1, 0)
+	}
+	switch state {
+	case StateQueued:
+		if tracked, ok := l.reserved[t.ID]; ok && !tracked {
+			l.reserved[t.ID] = true
+		} else {
+			u.queued++
+		}
+	case StateRunning:
+		u.running++
+	}
+}
+
+// usage returns the use of every tenant seen, sorted by name
+func (l *tenantLedger) usage() []TenantUsage {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	out := make([]TenantUsage, 0, len(l.use))
+	for _, tenant := range slices.Sorted(maps.Keys(l.use)) {
+		u := l.get(tenant, now)
+		out = append(out, TenantUsage{
+			Tenant:   tenant,
+			Queued:   u.queued,
+			InFlight: u.running,
+			Today:    u.today,
+			Quota:    l.quotas.quota(tenant),
+		})
+	}
+	return out
+}
+
+// TenantUsage returns what each tenant seen since the pool started uses of
+// it, sorted by tenant. It is empty without WithTenantQuotas
+func (p *WorkerPool) TenantUsage() []TenantUsage {
+	return p.tenants.usage()
+}
+
+// TenantUsageOf returns what one tenant uses of the pool
+func (p *WorkerPool) TenantUsageOf(tenant string) TenantUsage {
+	for _, u := range p.tenants.usage() {
+		if u.Tenant == tenant {
+			return u
+		}
+	}
+	u := TenantUsage{Tenant: tenant}
+	if p.tenants != nil {
+		u.Quota = p.tenants.quotas.quota(tenant)
+	}
+	return u
+}
+
+// untilTomorrow returns the time left until daily quotas reset
+func untilTomorrow(now time.Time) time.Duration {
+	now = now.UTC()
+	y, m, d := now.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC).Sub(now)
+}
+
+// tenantRoutes adds the tenant usage routes
+func (s *Server) tenantRoutes(r *mux.Router) {
+	r.HandleFunc("/tenants", s.tenantsHandler).Methods("GET")
+	r.HandleFunc("/tenant", s.ownTenantHandler).Methods("GET")
+}
+
+// tenantsHandler lists the usage of every tenant of the pool
+func (s *Server) tenantsHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	usage := p.TenantUsage()
+	if usage == nil {
+		usage = []TenantUsage{}
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
+
+// ownTenantHandler returns the usage of the tenant of the caller
+func (s *Server) ownTenantHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := TenantID(r.Context())
+	if tenant == "" {
+		writeError(w, http.StatusNotFound, "request has no tenant, the server does not authenticate clients", "")
+		return
+	}
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, p.TenantUsageOf(tenant))
+}
@@ -0,0 +1,72 @@
+package go_playground
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// refusingQueue is a memory queue that fails every push while refuse is set
+type refusingQueue struct {
+	*MemoryQueue
+	refuse atomic.Bool
+}
+
+func (q *refusingQueue) Push(t Task) error { return q.PushWait(t, -1) }
+
+func (q *refusingQueue) PushWait(t Task, timeout time.Duration) error {
+	if q.refuse.Load() {
+		return errBroken
+	}
+	return q.MemoryQueue.PushWait(t, timeout)
+}
+
+func (q *refusingQueue) PushBatch(ts []Task) error {
+	if q.refuse.Load() {
+		return errBroken
+	}
+	return q.MemoryQueue.PushBatch(ts)
+}
+
+// acmeUsage returns the use of the only tenant of the tests
+func acmeUsage(t *testing.T, p *WorkerPool) TenantUsage {
+	t.Helper()
+	for _, u := range p.TenantUsage() {
+		if u.Tenant == "acme" {
+			return u
+		}
+	}
+	return TenantUsage{}
+}
+
+func TestTenantRefusedPushesKeepDailyQuota(t *testing.T) {
+	q := &refusingQueue{MemoryQueue: NewMemoryQueue(10)}
+	p := startPool(t, failing(), WithQueueBackend(q), WithTenantQuotas(TenantQuotas{Default: TenantQuota{MaxPerDay: 2}}))
+
+	q.refuse.Store(true)
+	for range 3 {
+		if _, err := p.Submit(Task{Tenant: "acme"}); !errors.Is(err, errBroken) {
+			t.Fatalf("Submit to a refusing queue = %v, want %v", err, errBroken)
+		}
+	}
+	if _, err := p.SubmitBatch([]Task{{Tenant: "acme"}, {Tenant: "acme"}}); !errors.Is(err, errBroken) {
+		t.Fatalf("SubmitBatch to a refusing queue = %v, want %v", err, errBroken)
+	}
+	if u := acmeUsage(t, p); u.Today != 0 || u.Queued != 0 {
+		t.Fatalf("after refused pushes usage = %+v, want nothing submitted or queued", u)
+	}
+
+	q.refuse.Store(false)
+	for range 2 {
+		if _, err := p.Submit(Task{Tenant: "acme"}); err != nil {
+			t.Fatalf("Submit within quota: %v", err)
+		}
+	}
+	if _, err := p.Submit(Task{Tenant: "acme"}); !errors.Is(err, ErrTenantDailyLimit) {
+		t.Errorf("Submit over quota = %v, want %v", err, ErrTenantDailyLimit)
+	}
+	if u := acmeUsage(t, p); u.Today != 2 {
+		t.Errorf("submitted today = %d, want 2", u.Today)
+	}
+}
@@ -0,0 +1,81 @@
+package go_playground
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans created by the pool
+const tracerName = "playground"
+
+// TraceTask records the span context of ctx on the task, so enqueueing and
+// processing it join the caller's trace
+func TraceTask(ctx context.Context, t *Task) {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) > 0 {
+		t.TraceContext = carrier
+	}
+}
+
+// traceParent returns a context carrying the span recorded on the task
+func traceParent(ctx context.Context, t Task) context.Context {
+	if len(t.TraceContext) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(t.TraceContext))
+}
+
+// Options of the enqueue and process spans, built once for the hot path
+var (
+	producerSpan = []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindProducer)}
+	consumerSpan = []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindConsumer)}
+)
+
+// setTaskAttributes labels a span with its task, unless it is not recorded
+// such as when tracing is off, sparing the allocations
+func setTaskAttributes(span trace.Span, t Task) {
+	if span.IsRecording() {
+		span.SetAttributes(attribute.Int("task.id", t.ID), attribute.Int("task.priority", t.Priority))
+	}
+}
+
+// traceEnqueue starts the producer span of a submission and points the
+// task's trace context at it, so processing shows up as its child
+func (p *WorkerPool) traceEnqueue(task *Task) trace.Span {
+	ctx, span := p.tracer.Start(traceParent(context.Background(), *task), "task.enqueue", producerSpan...)
+	setTaskAttributes(span, *task)
+	if span.SpanContext().IsValid() {
+		TraceTask(ctx, task)
+	}
+	return span
+}
+
+// traceProcess starts the consumer span of a task on top of ctx. The time
+// the task spent queued is recorded as a sibling span ending now
+func (p *WorkerPool) traceProcess(ctx context.Context, task Task) (context.Context, trace.Span) {
+	parent := traceParent(context.Background(), task)
+	if rec, err := p.store.Get(task.ID); err == nil && !rec.QueuedAt.IsZero() {
+		_, wait := p.tracer.Start(parent, "task.queued", trace.WithTimestamp(rec.QueuedAt))
+		setTaskAttributes(wait, task)
+		wait.End()
+	}
+
+	_, span := p.tracer.Start(parent, "task.process", consumerSpan...)
+	setTaskAttributes(span, task)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+// endSpan ends a span, marking it failed when err is set
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
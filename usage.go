@@ -0,0 +1,276 @@
+package go_playground
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// UsageAccounting records the wall and CPU time of every attempt, summed
+// by tenant and type, for GET /reports/usage. CPU time is that of the
+// worker thread running the handler, Linux only: the work a handler hands
+// to other goroutines is not counted. Usage is kept in memory
+type UsageAccounting struct {
+	Resolution time.Duration // width of the periods usage is summed over, 1h by default
+	Retention  time.Duration // how long usage is kept, 31 days by default
+}
+
+// UsageTotals sums the attempts of a set of tasks
+type UsageTotals struct {
+	Attempts int           `json:"attempts"`
+	Failed   int           `json:"failed"` // attempts that returned an error
+	WallTime time.Duration `json:"wall_time"`
+	CPUTime  time.Duration `json:"cpu_time"`
+}
+
+func (t *UsageTotals) add(o UsageTotals) {
+	t.Attempts += o.Attempts
+	t.Failed += o.Failed
+	t.WallTime += o.WallTime
+	t.CPUTime += o.CPUTime
+}
+
+// UsageRow is the usage of a queue, tenant and type, the dimensions not
+// grouped by being empty
+type UsageRow struct {
+	Queue  string `json:"queue,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+	Type   string `json:"type,omitempty"`
+	UsageTotals
+}
+
+// UsageReport is the usage over a period, the rows taking the most wall
+// time first
+type UsageReport struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// CPUMeasured is unset on platforms where CPU time is not recorded
+	CPUMeasured bool        `json:"cpu_measured"`
+	Total       UsageTotals `json:"total"`
+	Rows        []UsageRow  `json:"rows"`
+}
+
+// usageKey identifies the usage of a tenant and type over a period
+type usageKey struct {
+	start  int64 // unix seconds
+	tenant string
+	typ    string
+}
+
+// usageGroup is a row of a usage report
+type usageGroup struct {
+	queue, tenant, typ string
+}
+
+// usageLedger sums the attempts of a pool by period, tenant and type
+type usageLedger struct {
+	cfg UsageAccounting
+
+	mu     sync.Mutex
+	totals map[usageKey]*UsageTotals
+	oldest int64 // start of the oldest period kept
+}
+
+func newUsageLedger(cfg UsageAccounting) *usageLedger {
+	if cfg.Resolution <= 0 {
+		cfg.Resolution = time.Hour
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 31 * 24 * time.Hour
+	}
+	return &usageLedger{cfg: cfg, totals: make(map[usageKey]*UsageTotals)}
+}
+
+// observe adds an attempt of task finished at now
+func (l *usageLedger) observe(task Task, now time.Time, wall, cpu time.Duration, err error) {
+	if l == nil {
+		return
+	}
+	key := usageKey{start: now.Truncate(l.cfg.Resolution).Unix(), tenant: task.Tenant, typ: task.Type}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	t, ok := l.totals[key]
+	if !ok {
+		t = &UsageTotals{}
+		l.totals[key] = t
+		l.expire(now)
+	}
+	t.Attempts++
+	if err != nil {
+		t.Failed++
+	}
+	t.WallTime += wall
+	t.CPUTime += cpu
+}
+
+// expire drops the periods past the retention, at most once a period
+func (l *usageLedger) expire(now time.Time) {
+	cutoff := now.Add(-l.cfg.Retention).Unix()
+	if l.oldest >= cutoff {
+		return
+	}
+	oldest := now.Unix()
+	for k := range l.totals {
+		if k.start < cutoff {
+			delete(l.totals, k)
+			continue
+		}
+		oldest = min(oldest, k.start)
+	}
+	l.oldest = oldest
+}
+
+// Usage returns the usage of the pool by tenant and type over the periods
+// starting from since, ok being unset without WithUsageAccounting
+func (p *WorkerPool) Usage(since time.Time) (rows []UsageRow, ok bool) {
+	l := p.usage
+	if l == nil {
+		return nil, false
+	}
+	from := since.Truncate(l.cfg.Resolution).Unix()
+	sums := make(map[usageGroup]*UsageTotals)
+	l.mu.Lock()
+	for k, t := range l.totals {
+		if k.start < from {
+			continue
+		}
+		g := usageGroup{tenant: k.tenant, typ: k.typ}
+		if sums[g] == nil {
+			sums[g] = &UsageTotals{}
+		}
+		sums[g].add(*t)
+	}
+	l.mu.Unlock()
+	for g, t := range sums {
+		rows = append(rows, UsageRow{Queue: p.name, Tenant: g.tenant, Type: g.typ, UsageTotals: *t})
+	}
+	return rows, true
+}
+
+// handle runs the handler of an attempt, recording in vals the CPU time
+// of the thread running it with WithUsageAccounting
+func (p *WorkerPool) handle(vals *attemptValues, task Task) error {
+	if p.usage == nil {
+		return p.handler.Handle(vals, task)
+	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	start, ok := threadCPUTime()
+	err := p.handler.Handle(vals, task)
+	if end, _ := threadCPUTime(); ok {
+		vals.cpu = end - start
+	}
+	return err
+}
+
+// usageDimensions are the values of the group_by parameter
+var usageDimensions = []string{"queue", "tenant", "type"}
+
+// parsePeriod reads a duration, also accepting a whole number of days
+// such as 7d
+func parsePeriod(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("must be positive")
+	}
+	return d, err
+}
+
+func (s *Server) usageRoutes(r *mux.Router) {
+	r.HandleFunc("/reports/usage", s.usageHandler).Methods("GET")
+}
+
+// usageHandler serves GET /reports/usage, the usage of every queue over
+// the period parameter, 24h by default, grouped by the comma-separated
+// dimensions of group_by, all of them by default
+func (s *Server) usageHandler(w http.ResponseWriter, r *http.Request) {
+	v := r.URL.Query()
+	period := 24 * time.Hour
+	if ps := v.Get("period"); ps != "" {
+		d, err := parsePeriod(ps)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid period %q, want a duration such as 24h or 7d", ps), "period")
+			return
+		}
+		period = d
+	}
+	group := usageDimensions
+	if gs := v.Get("group_by"); gs != "" {
+		group = strings.Split(gs, ",")
+		for _, dim := range group {
+			if !slices.Contains(usageDimensions, dim) {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid group_by %q, want a list of queue, tenant and type", gs), "group_by")
+				return
+			}
+		}
+	}
+
+	pools := s.allPools()
+	if mux.Vars(r)["queue"] != "" {
+		p, ok := s.target(w, r, "")
+		if !ok {
+			return
+		}
+		pools = []*WorkerPool{p}
+	}
+	now := time.Now()
+	since := now.Add(-period)
+	report := UsageReport{From: since, To: now, CPUMeasured: cpuTimeMeasured}
+	sums := make(map[usageGroup]*UsageTotals)
+	enabled := false
+	for _, p := range pools {
+		rows, ok := p.Usage(since)
+		if !ok {
+			continue
+		}
+		enabled = true
+		// Whole periods are reported, the first one starting before since
+		if from := since.Truncate(p.usage.cfg.Resolution); from.Before(report.From) {
+			report.From = from
+		}
+		for _, row := range rows {
+			var g usageGroup
+			for _, dim := range group {
+				switch dim {
+				case "queue":
+					g.queue = row.Queue
+				case "tenant":
+					g.tenant = row.Tenant
+				case "type":
+					g.typ = row.Type
+				}
+			}
+			if sums[g] == nil {
+				sums[g] = &UsageTotals{}
+			}
+			sums[g].add(row.UsageTotals)
+			report.Total.add(row.UsageTotals)
+		}
+	}
+	if !enabled {
+		writeError(w, http.StatusNotImplemented, "usage accounting is not enabled", "")
+		return
+	}
+	report.Rows = make([]UsageRow, 0, len(sums))
+	for g, t := range sums {
+		report.Rows = append(report.Rows, UsageRow{Queue: g.queue, Tenant: g.tenant, Type: g.typ, UsageTotals: *t})
+	}
+	slices.SortFunc(report.Rows, func(a, b UsageRow) int {
+		return cmp.Or(cmp.Compare(b.WallTime, a.WallTime),
+			cmp.Compare(a.Queue, b.Queue), cmp.Compare(a.Tenant, b.Tenant), cmp.Compare(a.Type, b.Type))
+	})
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,138 @@
+package go_playground
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Validator checks a task before it is enqueued. A non-nil error rejects
+// the submission; return a *ValidationError to point at the fields at fault
+type Validator func(Task) error
+
+// FieldError is one problem found by a Validator
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists the invalid fields of a rejected task. It matches
+// ErrInvalidPayload with errors.Is
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Add records a problem with field
+func (e *ValidationError) Add(field, format string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns e when it holds problems and nil otherwise, so validators can
+// end with return v.Err()
+func (e *ValidationError) Err() error {
+	if e == nil || len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return fmt.Sprintf("%v: %s", ErrInvalidPayload, strings.Join(msgs, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidPayload
+}
+
+// PayloadValidator decodes Task.Data with codec, a nil codec meaning
+// JSONPayload, and hands the payload to check. Undecodable data is
+// reported on the data field
+func PayloadValidator[T any](codec PayloadCodec[T], check func(v T, errs *ValidationError)) Validator {
+	if codec == nil {
+		codec = JSONPayload[T]{}
+	}
+	return func(t Task) error {
+		var errs ValidationError
+		v, err := codec.Decode(t.Data)
+		if err != nil {
+			errs.Add("data", "cannot be decoded: %v", err)
+			return errs.Err()
+		}
+		check(v, &errs)
+		return errs.Err()
+	}
+}
+
+// MaxDataSize refuses tasks whose data is longer than n bytes
+func MaxDataSize(n int) Validator {
+	return func(t Task) error {
+		if len(t.Data) > n {
+			return &ValidationError{Fields: []FieldError{{Field: "data", Message: fmt.Sprintf("must be at most %d bytes, got %d", n, len(t.Data))}}}
+		}
+		return nil
+	}
+}
+
+// JSONData refuses tasks whose data is not a JSON document
+func JSONData() Validator {
+	return func(t Task) error {
+		if !json.Valid([]byte(t.Data)) {
+			return &ValidationError{Fields: []FieldError{{Field: "data", Message: "must be valid JSON"}}}
+		}
+		return nil
+	}
+}
+
+// validate runs the validators of the pool on a task. Plain errors are
+// turned into a ValidationError without a field
+func (p *WorkerPool) validate(task Task) error {
+	// Accepted tasks, the common case, allocate nothing
+	var fields []FieldError
+	for _, v := range p.validators {
+		err := v(task)
+		if err == nil {
+			continue
+		}
+		var ve *ValidationError
+		if errors.As(err, &ve) {
+			fields = append(fields, ve.Fields...)
+			continue
+		}
+		fields = append(fields, FieldError{Message: err.Error()})
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	err := &ValidationError{Fields: fields}
+	p.metrics.rejected.Inc()
+	p.log.Debug("task rejected by validation", "error", err)
+	return err
+}
+
+// validateBatch validates every task of a batch, prefixing fields with the
+// index of their task as the HTTP API does for malformed batches
+func (p *WorkerPool) validateBatch(tasks []Task) error {
+	if len(p.validators) == 0 {
+		return nil
+	}
+	var errs ValidationError
+	for i, t := range tasks {
+		err := p.validate(t)
+		if err == nil {
+			continue
+		}
+		for _, f := range err.(*ValidationError).Fields {
+			field := fmt.Sprintf("[%d]", i)
+			if f.Field != "" {
+				field += "." + f.Field
+			}
+			errs.Fields = append(errs.Fields, FieldError{Field: field, Message: f.Message})
+		}
+	}
+	return errs.Err()
+}
@@ -0,0 +1,150 @@
+package go_playground
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTaskStuck is recorded on runs the watchdog stopped for going without
+// a heartbeat for too long
+var ErrTaskStuck = errors.New("task stuck without heartbeat")
+
+// WatchdogAction is what the watchdog does with a stuck task
+type WatchdogAction int
+
+const (
+	// WatchdogReport only flags the task in the worker status and logs it
+	WatchdogReport WatchdogAction = iota
+	// WatchdogCancel stops the run and fails the task with ErrTaskStuck
+	WatchdogCancel
+	// WatchdogRequeue stops the run and puts the task back in the queue
+	WatchdogRequeue
+)
+
+// String returns the action name
+func (a WatchdogAction) String() string {
+	switch a {
+	case WatchdogReport:
+		return "report"
+	case WatchdogCancel:
+		return "cancel"
+	case WatchdogRequeue:
+		return "requeue"
+	}
+	return fmt.Sprintf("WatchdogAction(%d)", int(a))
+}
+
+// ParseWatchdogAction accepts the names returned by String
+func ParseWatchdogAction(s string) (WatchdogAction, error) {
+	for _, a := range []WatchdogAction{WatchdogReport, WatchdogCancel, WatchdogRequeue} {
+		if s == a.String() {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid watchdog action %q, want report, cancel or requeue", s)
+}
+
+// Watchdog flags tasks whose worker has not had a heartbeat for StuckAfter.
+// Workers beat when they start a task, and handlers keep beating through
+// Heartbeat, progress updates and checkpoints. Stopping a run cancels its
+// context, so it only helps handlers that honour it
+type Watchdog struct {
+	StuckAfter time.Duration
+	Interval   time.Duration // how often workers are checked, StuckAfter/4 by default
+	Action     WatchdogAction
+}
+
+// Heartbeat tells the watchdog the task run with ctx is making progress. It
+// returns false outside of a pool handler
+func Heartbeat(ctx context.Context) bool {
+	r, ok := ctx.Value(progressKey{}).(*ProgressReporter)
+	if ok {
+		r.p.beat(r.task.ID, time.Now())
+	}
+	return ok
+}
+
+// beat sets the heartbeat of the worker running a task to at
+func (p *WorkerPool) beat(taskID int, at time.Time) {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	for id, ws := range p.statuses {
+		if ws.Busy && ws.TaskID == taskID {
+			if ws.Stuck {
+				p.log.Info("stuck task recovered", "task_id", taskID, "worker", id)
+			}
+			ws.Heartbeat, ws.Stuck = at, false
+			p.statuses[id] = ws
+			return
+		}
+	}
+}
+
+// StuckTasks returns the IDs of the tasks flagged by the watchdog
+func (p *WorkerPool) StuckTasks() []int {
+	var ids []int
+	for _, ws := range p.WorkerStatuses() {
+		if ws.Stuck {
+			ids = append(ids, ws.TaskID)
+		}
+	}
+	return ids
+}
+
+// watch checks the workers until the pool is torn down
+func (p *WorkerPool) watch() {
+	wd := *p.watchdog
+	ticker := time.NewTicker(wd.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, ws := range p.flagStuck(time.Now().Add(-wd.StuckAfter)) {
+			p.log.Warn("task stuck", "task_id", ws.TaskID, "worker", ws.ID,
+				"running_for", time.Since(ws.Since), "last_heartbeat", ws.Heartbeat, "action", wd.Action.String())
+			p.metrics.stuck.Inc()
+			if wd.Action == WatchdogCancel || wd.Action == WatchdogRequeue {
+				p.runMu.Lock()
+				if cancel, ok := p.running[ws.TaskID]; ok {
+					cancel(ErrTaskStuck)
+				}
+				p.runMu.Unlock()
+			}
+		}
+	}
+}
+
+// flagStuck marks busy workers without a heartbeat since cutoff and returns
+// the newly flagged ones
+func (p *WorkerPool) flagStuck(cutoff time.Time) []WorkerStatus {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	var flagged []WorkerStatus
+	for id, ws := range p.statuses {
+		if ws.Busy && !ws.Stuck && ws.Heartbeat.Before(cutoff) {
+			ws.Stuck = true
+			p.statuses[id] = ws
+			flagged = append(flagged, ws)
+		}
+	}
+	return flagged
+}
+
+// requeueStuck puts a task stopped by the watchdog back in the queue. The
+// run must have ended, so the task is acknowledged first and a worker
+// picking it up again is not mistaken for the old run
+func (p *WorkerPool) requeueStuck(task Task) {
+	p.ack(task)
+	p.track(task, StateQueued, nil)
+	if err := p.push(task); err != nil {
+		p.taskLogger(task).Error("requeueing stuck task", "error", err)
+		p.track(task, StateFailed, fmt.Errorf("%w: requeue: %v", ErrTaskStuck, err))
+		return
+	}
+	p.taskLogger(task).Info("stuck task requeued", "attempts", task.Attempts)
+}
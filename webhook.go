@@ -0,0 +1,162 @@
+package go_playground
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCallbacksDisabled is returned when submitting a task with a
+// CallbackURL to a pool without WithWebhooks
+var ErrCallbacksDisabled = errors.New("callback URLs are not enabled on this queue")
+
+// Webhook request headers
+const (
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// Webhooks configures the POST of a task's final record to its CallbackURL
+type Webhooks struct {
+	// Secret signs each delivery: the signature header carries
+	// "sha256=" and the hex HMAC-SHA256 of the timestamp header, a dot
+	// and the body. Deliveries are unsigned when empty
+	Secret string
+	// Retry paces delivery attempts. Defaults to DefaultWebhookRetry
+	Retry RetryPolicy
+	// Timeout bounds each delivery request. Defaults to 10s
+	Timeout time.Duration
+	// Client sends the requests. Defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// DefaultWebhookRetry tries a delivery 5 times over about 15 seconds
+var DefaultWebhookRetry = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// webhookSender holds the configuration and the deliveries in progress
+type webhookSender struct {
+	cfg Webhooks
+	wg  sync.WaitGroup
+}
+
+func newWebhookSender(cfg Webhooks) *webhookSender {
+	if cfg.Retry.MaxAttempts < 1 {
+		cfg.Retry = DefaultWebhookRetry
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return &webhookSender{cfg: cfg}
+}
+
+// validCallbackURL accepts absolute http and https URLs
+func validCallbackURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// sendWebhook delivers a finished task's record in the background
+func (p *WorkerPool) sendWebhook(rec TaskRecord) {
+	if p.webhooks == nil || rec.CallbackURL == "" {
+		return
+	}
+	body, err := json.Marshal(rec)
+	if err != nil {
+		p.taskLogger(rec.Task).Error("webhook: encoding record", "error", err)
+		return
+	}
+	task := rec.Task // rather than rec, which would escape for every task
+	p.webhooks.wg.Go(func() { p.deliverWebhook(task, body) })
+}
+
+// deliverWebhook retries until the receiver accepts the delivery, rejects
+// it for good, or the attempts run out
+func (p *WorkerPool) deliverWebhook(task Task, body []byte) {
+	cfg := p.webhooks.cfg
+	log := p.taskLogger(task).With("callback_url", task.CallbackURL)
+	for attempt := 1; ; attempt++ {
+		retry, err := p.postWebhook(task.CallbackURL, body)
+		if err == nil {
+			p.metrics.webhooksDelivered.Inc()
+			log.Info("webhook delivered", "attempt", attempt)
+			return
+		}
+		if !retry || attempt >= cfg.Retry.MaxAttempts {
+			p.metrics.webhooksFailed.Inc()
+			log.Error("webhook delivery failed", "attempt", attempt, "error", err)
+			return
+		}
+		backoff := cfg.Retry.Backoff(attempt)
+		log.Warn("webhook delivery failed, retrying", "attempt", attempt, "backoff", backoff, "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-p.ctx.Done():
+			p.metrics.webhooksFailed.Inc()
+			log.Error("webhook delivery abandoned on shutdown", "attempt", attempt)
+			return
+		}
+	}
+}
+
+// postWebhook makes one delivery attempt, reporting whether a failure is
+// worth retrying
+func (p *WorkerPool) postWebhook(target string, body []byte) (retry bool, err error) {
+	cfg := p.webhooks.cfg
+	ctx, cancel := context.WithTimeout(p.ctx, cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "workerpool-webhook")
+	req.Header.Set(WebhookTimestampHeader, ts)
+	if cfg.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(cfg.Secret, ts, body))
+	}
+
+	resp, err := cfg.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return true, fmt.Errorf("receiver answered %s", resp.Status)
+	default:
+		return false, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+}
+
+// SignWebhook returns the signature header value of a delivery, for
+// receivers to compare against with hmac.Equal
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
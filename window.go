@@ -0,0 +1,215 @@
+package go_playground
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Window is a daily span of time tasks may start in, such as 01:00-05:00.
+// A window ending before it starts runs past midnight, into the next day
+type Window struct {
+	Start, End time.Duration  // since midnight, End at most 24h
+	Days       []time.Weekday // days the window opens on, every day when empty
+}
+
+// ProcessingWindows restricts when the tasks of a pool start. Tasks
+// submitted outside every window are held as delayed tasks until the next
+// one opens, as are tasks reaching a worker outside of them, such as those
+// still queued when a window closed. Attempts already started finish, and
+// their retries are not held
+type ProcessingWindows struct {
+	Windows []Window
+	// Location is the time zone the windows are in, UTC by default
+	Location *time.Location
+	// Types are the task types the windows apply to, all when empty
+	Types []string
+}
+
+// WithProcessingWindows holds the tasks of the pool outside of the windows
+// of w. A pool without windows runs tasks at any time
+func WithProcessingWindows(w ProcessingWindows) Option {
+	return func(p *WorkerPool) {
+		if len(w.Windows) == 0 {
+			return
+		}
+		if w.Location == nil {
+			w.Location = time.UTC
+		}
+		p.windows = &w
+	}
+}
+
+// ParseWindow parses a window such as "01:00-05:00", preceded by the days
+// it opens on for windows not open daily: "mon-fri 09:00-17:00" or
+// "sat,sun 00:00-24:00"
+func ParseWindow(s string) (Window, error) {
+	var w Window
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 1:
+	case 2:
+		days, err := parseDays(fields[0])
+		if err != nil {
+			return w, fmt.Errorf("window %q: %w", s, err)
+		}
+		w.Days = days
+		fields = fields[1:]
+	default:
+		return w, fmt.Errorf("window %q: want [days] HH:MM-HH:MM", s)
+	}
+	start, end, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return w, fmt.Errorf("window %q: want HH:MM-HH:MM", s)
+	}
+	var err error
+	if w.Start, err = parseClock(start); err != nil {
+		return w, fmt.Errorf("window %q: %w", s, err)
+	}
+	if w.End, err = parseClock(end); err != nil {
+		return w, fmt.Errorf("window %q: %w", s, err)
+	}
+	if w.Start == w.End || w.Start == 24*time.Hour {
+		return w, fmt.Errorf("window %q is empty", s)
+	}
+	return w, nil
+}
+
+// parseClock parses HH:MM, 24:00 included
+func parseClock(s string) (time.Duration, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || len(s) != 5 || h < 0 || h > 24 || m < 0 || m > 59 || h == 24 && m != 0 {
+		return 0, fmt.Errorf("invalid time of day %q, want HH:MM", s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseDays parses comma separated days and ranges of days, such as
+// mon-fri or sat,sun
+func parseDays(s string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for part := range strings.SplitSeq(strings.ToLower(s), ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok := weekdays[from]
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[to]; !ok {
+				return nil, fmt.Errorf("unknown day %q", to)
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			if !slices.Contains(days, d) {
+				days = append(days, d)
+			}
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// applies reports whether the windows hold back t
+func (w *ProcessingWindows) applies(t Task) bool {
+	return w != nil && (len(w.Types) == 0 || slices.Contains(w.Types, t.Type))
+}
+
+// next returns t when it is within a window, else when the next window
+// opens
+func (w *ProcessingWindows) next(t time.Time) time.Time {
+	local := t.In(w.Location)
+	y, m, d := local.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, w.Location)
+	var earliest time.Time
+	// Windows opened yesterday may still be open, those opening within a
+	// week cover every day
+	for day := -1; day <= 7; day++ {
+		date := midnight.AddDate(0, 0, day)
+		for _, win := range w.Windows {
+			if len(win.Days) > 0 && !slices.Contains(win.Days, date.Weekday()) {
+				continue
+			}
+			open, end := at(date, win.Start), at(date, win.End)
+			if win.End <= win.Start {
+				end = at(date.AddDate(0, 0, 1), win.End)
+			}
+			if !t.Before(open) && t.Before(end) {
+				return t
+			}
+			if open.After(t) && (earliest.IsZero() || open.Before(earliest)) {
+				earliest = open
+			}
+		}
+		if !earliest.IsZero() && day >= 0 {
+			return earliest
+		}
+	}
+	return earliest
+}
+
+// at returns the wall clock time of day d since the midnight of date,
+// following daylight saving changes
+func at(date time.Time, d time.Duration) time.Time {
+	y, m, day := date.Date()
+	return time.Date(y, m, day, int(d/time.Hour), int(d%time.Hour/time.Minute), 0, 0, date.Location())
+}
+
+// holdForWindow delays a submitted task to the next window when it would
+// start outside of them
+func (p *WorkerPool) holdForWindow(task *Task) {
+	if !p.windows.applies(*task) {
+		return
+	}
+	start := p.clock.Now()
+	if task.RunAt.After(start) {
+		start = task.RunAt
+	}
+	if open := p.windows.next(start); open.After(start) {
+		task.RunAt = open
+	}
+}
+
+// heldByWindow puts a task that reached a worker outside the windows back
+// with the delayed tasks until the next one opens, reporting whether it did
+func (p *WorkerPool) heldByWindow(task Task) bool {
+	if !p.windows.applies(task) {
+		return false
+	}
+	now := p.clock.Now()
+	open := p.windows.next(now)
+	if !open.After(now) {
+		return false
+	}
+	return p.hold(task, open, "its processing window")
+}
+
+// hold puts a task that reached a worker back with the delayed tasks until
+// until, why telling what it waits for
+func (p *WorkerPool) hold(task Task, until time.Time, why string) bool {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		// Left unacknowledged for durable backends to deliver it again
+		p.interrupted(task, ErrPoolClosed)
+		return true
+	}
+	p.ack(task)
+	task.RunAt = until
+	if err := p.enqueueDelayed(task); err != nil {
+		p.taskLogger(task).Error("holding task until "+why, "error", err)
+		p.track(task, StateFailed, err)
+		return true
+	}
+	p.taskLogger(task).Info("task held until "+why, "run_at", until)
+	return true
+}
@@ -1,63 +1,1060 @@
 package go_playground
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// ErrPoolClosed is returned when submitting to a stopped pool
+var ErrPoolClosed = errors.New("worker pool is closed")
+
 // Task represents an event
 type Task struct {
-	ID   int
-	Data string
+	ID       int           `json:"id"`
+	Data     string        `json:"data"`
+	Priority int           `json:"priority"`
+	RunAt    time.Time     `json:"run_at,omitzero"`  // not dispatched before this time
+	Delay    time.Duration `json:"delay,omitzero"`   // sets RunAt relative to submission when RunAt is empty
+	Timeout  time.Duration `json:"timeout,omitzero"` // per-attempt limit, overrides the pool default
+	Attempts int           `json:"attempts"`         // number of times the handler has been run
+
+	ExpiresAt time.Time     `json:"expires_at,omitzero"` // dropped if still queued at this time
+	TTL       time.Duration `json:"ttl,omitzero"`        // sets ExpiresAt relative to submission when ExpiresAt is empty
+
+	// Type groups tasks for WithTypeConcurrency
+	Type string `json:"type,omitempty"`
+	// PartitionKey orders tasks, see WithPartitioning, or binds them to a
+	// worker, see WithAffinity
+	PartitionKey string `json:"partition_key,omitempty"`
+	// Tenant owns the task, see WithFairScheduling
+	Tenant string `json:"tenant,omitempty"`
+	// CorrelationID ties the task back to the request that created it
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// IdempotencyKey deduplicates submissions, see WithIdempotencyTTL
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// Queue names the pool the task was submitted to, see WithName
+	Queue string `json:"queue,omitempty"`
+	// TraceContext carries the W3C trace context across the queue, see TraceTask
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+	// Checkpoint is the state last saved by the handler, see Checkpoint
+	Checkpoint string `json:"checkpoint,omitempty"`
+	// CallbackURL receives the final record of the task, see WithWebhooks
+	CallbackURL string `json:"callback_url,omitempty"`
+	// WorkflowID and Step identify the workflow step run by the task, see
+	// SubmitWorkflow
+	WorkflowID string `json:"workflow_id,omitempty"`
+	Step       string `json:"step,omitempty"`
+	// GroupID is the group the task counts towards, see SubmitGroup
+	GroupID string `json:"group_id,omitempty"`
+	// PayloadRef names the payload kept in the PayloadStore for a task too
+	// large to carry it in Data, see OpenPayload
+	PayloadRef string `json:"payload_ref,omitempty"`
+	// Weight is the share of the pool capacity the task takes while it
+	// runs, 1 when unset, see WithWeightedCapacity
+	Weight int `json:"weight,omitempty"`
+	// Labels are free-form key/value pairs the task can be found by, see
+	// Tasks
+	Labels map[string]string `json:"labels,omitempty"`
+	// Headers are the headers copied from the submission request, see
+	// WithHeaderPropagation
+	Headers map[string]string `json:"headers,omitempty"`
+	// SchemaVersion is the version of the shape of Data, see
+	// RegisterMigration
+	SchemaVersion int `json:"schema_version,omitempty"`
+	// DryRun skips the handler, the task succeeding once routed, so the
+	// pipeline can be load-tested without side effects, see WithDryRun
+	DryRun bool `json:"dry_run,omitempty"`
+	// DependsOn are the IDs of tasks that must succeed before this one is
+	// queued, see Submit
+	DependsOn []int `json:"depends_on,omitempty"`
+	// Hedge allows a second execution of an attempt running late, the
+	// handler tolerating duplicates, see WithHedging
+	Hedge bool `json:"hedge,omitempty"`
+	// UID identifies the task across processes, see WithUIDGenerator. It is
+	// kept when a task carrying one is submitted again, as Import does
+	UID string `json:"uid,omitempty"`
+}
+
+// WorkerPool runs tasks from a queue backend on a set of workers
+type WorkerPool struct {
+	name       string
+	workers    int
+	queueSize  int
+	handler    TaskHandler
+	handlers   *handlerRegistry
+	middleware []TaskMiddleware
+	retryMu    sync.RWMutex
+	retry      RetryPolicy
+	onDead     func(Task, error)
+	dlq        deadLetterQueue
+	// deadLetterStore is the one of WithDeadLetterStore, nil to keep dead
+	// letters in the backend or in memory
+	deadLetterStore DeadLetterStore
+	deadLetterLimit int
+	store           TaskStore
+	events          eventBus
+	idem            idempotencyKeys
+	waiters         waiters
+	workflows       workflows
+	groups          groups
+	deps            dependencies
+	metrics         *poolMetrics
+	registry        *prometheus.Registry
+	log             *slog.Logger
+	tracer          trace.Tracer
+	breaker         *breaker
+	adaptive        *aimdLimiter // nil without WithAdaptiveConcurrency
+	webhooks        *webhookSender
+	hooks           *workerHooks      // nil without WithWorkerHooks
+	sla             *slaMonitor       // nil without WithSLAMonitoring
+	analytics       *analyticsSampler // nil without WithAnalytics
+	hedging         *hedging          // nil without WithHedging
+	usage           *usageLedger      // nil without WithUsageAccounting
+	recovery        *Recovery         // nil without WithRecovery
+	recoveries      recoveries
+	archiver        *archiver
+	payloads        PayloadStore // nil without WithPayloadStore
+	results         Results
+	validators      []Validator
+	interceptors    []Interceptor
+	windows         *ProcessingWindows // nil without WithProcessingWindows
+
+	taskTimeout      time.Duration
+	taskLogLimit     int
+	overflow         OverflowPolicy
+	overflowTimeout  time.Duration
+	dispatchStrategy DispatchStrategy
+
+	taskTTL         time.Duration
+	expiredDLQ      bool
+	autoscalePolicy *AutoscalePolicy
+	cpuSizing       *CPUSizing // nil without WithCPUSizing
+	pinWarning      sync.Once
+	fair            *FairScheduling
+	breakerConfig   *CircuitBreaker
+	adaptiveConfig  *AdaptiveConcurrency
+	retention       *Retention
+	storage         *storageState // nil without WithStorageQuota
+	notes           *notifier     // nil without WithNotifications
+	budgets         *budgets      // nil without WithExecutionBudget
+	watchdog        *Watchdog
+	typeLimits      *TypeConcurrency
+	tenantQuotas    *TenantQuotas
+	tenants         *tenantLedger // nil without tenantQuotas
+	partitioning    *Partitioning
+	capacity        *WeightedCapacity
+	gate            *dispatchGate
+	workStealing    *WorkStealing
+	affinity        *Affinity
+	stealer         *stealScheduler // nil without workStealing and affinity
+	leader          *leadership     // nil without leader election
+	chaos           *chaos          // nil without WithChaos
+	synchronous     bool
+	dryRun          bool // WithDryRun
+	clock           Clock
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	queue   QueueBackend
+	jobs    chan Task     // hands tasks from the dispatcher to the workers
+	quit    chan struct{} // closed when the pool stops accepting tasks
+	retire  chan struct{} // each receive makes one idle worker exit
+	wg      sync.WaitGroup
+	delayed sync.WaitGroup // tasks waiting for their RunAt
+	// spillFile keeps the tasks of in-memory queues across restarts, see
+	// WithSpillFile
+	spillFile  string
+	dispatched chan struct{} // closed once the dispatcher has returned
+	sched      *scheduler
+	// schedules keeps the definitions of PutSchedule, shared when the
+	// backend is a ScheduleStore
+	schedules       ScheduleStore
+	sharedSchedules bool
+	mu              sync.Mutex
+	started         bool
+	booted          time.Time // when Start was called, for the recovery of older records
+	closed          bool
+	ids             IDGenerator
+	uids            UIDGenerator // nil without WithUIDGenerator
+
+	nextWorker int
+	active     atomic.Int32
+	busy       atomic.Int32
+	held       atomic.Pointer[Task] // popped task the dispatcher has yet to hand off
+
+	statusMu sync.Mutex
+	statuses map[int]WorkerStatus
+	drains   map[int]*workerDrain // by worker ID, see Resize
+
+	pauseMu sync.Mutex
+	paused  chan struct{} // non-nil while paused, closed on Resume
+
+	latencyMu sync.Mutex
+	latency   time.Duration // moving average of handler duration
+
+	runMu    sync.Mutex
+	running  map[int]context.CancelCauseFunc // tasks held by a worker
+	canceled map[int]struct{}                // queued tasks to skip
+}
+
+// NewWorkerPool creates a pool configured by the given options
+func NewWorkerPool(opts ...Option) *WorkerPool {
+	p := &WorkerPool{
+		workers:         defaultWorkers,
+		queueSize:       defaultQueueSize,
+		retry:           DefaultRetryPolicy,
+		clock:           realClock{},
+		taskLogLimit:    DefaultTaskLogLimit,
+		deadLetterLimit: DefaultDeadLetterLimit,
+		idem:            idempotencyKeys{ttl: defaultIdempotencyTTL},
+		statuses:        make(map[int]WorkerStatus),
+		drains:          make(map[int]*workerDrain),
+		running:         make(map[int]context.CancelCauseFunc),
+		canceled:        make(map[int]struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.handlers = &handlerRegistry{fallback: p.handler, handlers: make(map[string]registeredHandler)}
+	if p.handler == nil {
+		p.handlers.fallback, p.handlers.strict = defaultHandler, true
+	}
+	var h TaskHandler = p.handlers
+	if p.chaos != nil {
+		h = p.chaosHandler(h)
+	}
+	p.handler = Chain(h, p.middleware...)
+	if p.store == nil {
+		p.store = NewMemoryStore()
+	}
+	if p.log == nil {
+		p.log = slog.Default()
+	}
+	if p.name != "" {
+		p.log = p.log.With("queue", p.name)
+	}
+	if p.tracer == nil {
+		p.tracer = otel.GetTracerProvider().Tracer(tracerName)
+	}
+	p.metrics = newPoolMetrics(p, p.registry)
+	if p.breakerConfig != nil {
+		p.breaker = newBreaker(*p.breakerConfig, p.log, func() {
+			p.metrics.circuitTrips.Inc()
+			p.notes.raise(NotifyBreakerOpen, fmt.Sprintf("circuit breaker open after %d failures in a row, dispatch held for %s",
+				p.breakerConfig.Threshold, p.breakerConfig.Cooldown), float64(p.breakerConfig.Threshold))
+		})
+	}
+	if p.autoscalePolicy != nil {
+		p.workers = min(max(p.workers, p.autoscalePolicy.MinWorkers), p.autoscalePolicy.MaxWorkers)
+	}
+	if p.adaptiveConfig != nil {
+		p.adaptive = newAIMDLimiter(*p.adaptiveConfig, p.workers, p.Workers, p.log)
+	}
+	if p.queue == nil && p.fair != nil {
+		fs := *p.fair
+		if fs.Strategy == DispatchFIFO {
+			fs.Strategy = p.dispatchStrategy
+		}
+		p.queue = NewFairQueue(p.queueSize, fs)
+	}
+	if p.queue == nil {
+		p.queue = NewDispatchQueue(p.queueSize, p.dispatchStrategy)
+	}
+	// Backends allocating IDs themselves order tasks by them
+	if g, ok := p.queue.(IDGenerator); ok {
+		if p.ids != nil {
+			p.log.Warn("queue backend allocates task IDs, ignoring the ID generator")
+		}
+		p.ids = g
+	}
+	if p.ids == nil {
+		seq := &sequence{}
+		// Durable backends remember IDs handed out before a restart
+		if s, ok := p.queue.(interface{ LastTaskID() int }); ok {
+			seq.last.Store(int64(s.LastTaskID()))
+		}
+		p.ids = seq
+	}
+	p.initDeadLetters()
+	if p.spillFile != "" && !p.spilling() {
+		p.log.Warn("queue backend is durable, ignoring the spill file", "file", p.spillFile)
+	}
+	p.jobs = make(chan Task)
+	p.dispatched = make(chan struct{})
+	p.quit = make(chan struct{})
+	p.retire = make(chan struct{})
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.sched = newScheduler()
+	go p.runScheduler()
+	if p.results.MaxBytes <= 0 {
+		p.results = DefaultResults
+	}
+	if p.results.Store == nil {
+		if rs, ok := p.queue.(ResultStore); ok {
+			p.results.Store = rs
+		} else {
+			p.results.Store = NewMemoryResultStore()
+		}
+	}
+	if st, ok := p.queue.(ScheduleStore); ok {
+		p.schedules, p.sharedSchedules = st, true
+	} else {
+		p.schedules = &memorySchedules{}
+	}
+	if p.tenantQuotas != nil {
+		p.tenants = newTenantLedger(*p.tenantQuotas)
+	}
+	inFlightQuotas := p.tenantQuotas != nil && p.tenantQuotas.limitsInFlight()
+	// Always there, as handlers registered later may cap their type
+	var limits map[string]int
+	var quotas *TenantQuotas
+	maxHeld, capacity := 0, 0
+	if p.typeLimits != nil {
+		limits, maxHeld = p.typeLimits.Limits, p.typeLimits.MaxHeld
+	}
+	if inFlightQuotas {
+		quotas, maxHeld = p.tenantQuotas, max(maxHeld, p.tenantQuotas.MaxHeld)
+	}
+	if p.partitioning != nil {
+		maxHeld = max(maxHeld, p.partitioning.MaxHeld)
+	}
+	if p.capacity != nil {
+		capacity, maxHeld = p.capacity.Capacity, max(maxHeld, p.capacity.MaxHeld)
+		p.validators = append(p.validators, p.capacity.check)
+	}
+	if maxHeld <= 0 {
+		maxHeld = defaultMaxHeld
+	}
+	p.gate = newDispatchGate(limits, p.handlers.concurrency, quotas, p.partitioning != nil, capacity, maxHeld)
+	if p.workStealing != nil || p.affinity != nil {
+		localQueue := 0
+		if p.workStealing != nil {
+			localQueue = p.workStealing.LocalQueue
+		}
+		if p.affinity != nil {
+			localQueue = max(localQueue, p.affinity.LocalQueue)
+		}
+		p.stealer = newStealScheduler(localQueue, p.metrics.stolen.Inc)
+		if p.affinity != nil {
+			p.stealer.ring = newHashRing(p.affinity.VirtualNodes)
+		}
+	}
+	if p.archiver != nil {
+		p.archiver.queue = cmp.Or(p.name, p.archiver.queue)
+		go p.runArchiver()
+	}
+	if p.retention != nil {
+		go p.sweepRecords()
+	}
+	if p.storage != nil {
+		if sizer, ok := p.queue.(StorageSizer); ok {
+			go p.watchStorage(sizer)
+		} else {
+			p.log.Warn("queue backend cannot measure its storage, ignoring the storage quota")
+			p.storage = nil
+		}
+	}
+	return p
+}
+
+// Start launches the workers. Calling Start more than once has no effect
+func (p *WorkerPool) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.started || p.closed {
+		return
+	}
+	p.started = true
+	p.booted = p.clock.Now()
+	if p.recovery != nil {
+		// Before the workers claim anything, and without the lock as
+		// repairs dead-letter tasks
+		p.mu.Unlock()
+		p.recoverAtBoot()
+		p.mu.Lock()
+		if p.closed {
+			return
+		}
+	}
+	if p.sharedSchedules {
+		p.syncSchedules()
+		go p.watchSchedules()
+	}
+	if p.synchronous {
+		return
+	}
+
+	go p.dispatch()
+	for range p.workers {
+		p.startWorkerLocked()
+	}
+	if p.spilling() {
+		// Shutdown waits for the tasks to be back in the queue
+		p.delayed.Add(1)
+		go p.restoreSpill()
+	}
+	if p.autoscalePolicy != nil {
+		go p.autoscale()
+	} else if p.cpuSizing != nil && p.cpuSizing.Interval > 0 {
+		go p.followCPUs()
+	}
+	if p.adaptive != nil {
+		go p.adaptConcurrency()
+	}
+	if p.watchdog != nil {
+		go p.watch()
+	}
+	if p.leader != nil {
+		go p.campaign()
+	}
+	if p.sla != nil {
+		go p.monitorSLA()
+	}
+	if p.notes != nil {
+		go p.notifyConditions()
+	}
+}
+
+// Name returns the queue name set with WithName
+func (p *WorkerPool) Name() string {
+	return p.name
+}
+
+// Workers returns the number of running workers
+func (p *WorkerPool) Workers() int {
+	return int(p.active.Load())
+}
+
+// BusyWorkers returns the number of workers currently running a task
+func (p *WorkerPool) BusyWorkers() int {
+	return int(p.busy.Load())
+}
+
+// QueueDepth returns the number of tasks waiting for a worker
+func (p *WorkerPool) QueueDepth() int {
+	return p.queue.Len() + p.heldCount() + p.stealer.len() + p.gate.heldCount()
+}
+
+// heldCount is 1 while the dispatcher holds a popped task, else 0
+func (p *WorkerPool) heldCount() int {
+	if p.held.Load() != nil {
+		return 1
+	}
+	return 0
+}
+
+// addWorker starts one more worker unless the pool is closed
+func (p *WorkerPool) addWorker() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.startWorkerLocked()
+}
+
+func (p *WorkerPool) startWorkerLocked() {
+	p.nextWorker++
+	p.addDrain(p.nextWorker)
+	p.active.Add(1)
+	p.wg.Add(1)
+	go p.worker(p.nextWorker)
+}
+
+// retireWorker asks one idle worker to exit and reports whether one did
+func (p *WorkerPool) retireWorker() bool {
+	select {
+	case p.retire <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop stops accepting tasks and waits for the workers to finish the queue
+func (p *WorkerPool) Stop() {
+	_ = p.Shutdown(context.Background())
+}
+
+// Shutdown stops accepting tasks, drains the queue and waits for in-flight
+// tasks to finish. If ctx expires first, the context passed to running
+// handlers is cancelled and Shutdown returns the context error
+func (p *WorkerPool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.quit)
+	}
+	dispatching := p.started && !p.synchronous
+	p.mu.Unlock()
+
+	// Delayed tasks still have to make it into the queue before it is closed
+	err := waitContext(ctx, &p.delayed)
+	_ = p.queue.Close()
+	if err == nil {
+		err = waitContext(ctx, &p.wg)
+	}
+	if err == nil && p.webhooks != nil {
+		err = waitContext(ctx, &p.webhooks.wg)
+	}
+	if err == nil && p.archiver != nil {
+		err = p.closeArchiver(ctx)
+	}
+	if p.synchronous {
+		p.stopWorker(0)
+	}
+	p.cancel()
+	if p.spilling() {
+		if dispatching {
+			<-p.dispatched
+		}
+		if serr := p.writeSpill(); serr != nil {
+			p.log.Error("spilling tasks", "file", p.spillFile, "error", serr)
+			err = cmp.Or(err, serr)
+		}
+	}
+	p.events.close()
+	return err
+}
+
+// waitContext waits for wg or until ctx is done
+func waitContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Submit assigns an ID to the task and puts it on the queue. A task whose
+// IdempotencyKey was already submitted is not enqueued again, the earlier
+// task is returned instead. Tasks refused by a Validator fail with a
+// *ValidationError. A task with DependsOn is held until those tasks
+// succeed, and fails with ErrDependencyFailed once one does not
+func (p *WorkerPool) Submit(task Task) (Task, error) {
+	return p.SubmitContext(context.Background(), task)
+}
+
+// SubmitContext is Submit handing ctx to the interceptors of the pool. A
+// task an interceptor split is enqueued as a batch of its parts, the first
+// of which is returned
+func (p *WorkerPool) SubmitContext(ctx context.Context, task Task) (Task, error) {
+	if len(p.interceptors) > 0 {
+		tasks, err := p.intercept(ctx, []Task{task})
+		if err != nil {
+			return task, err
+		}
+		if len(tasks) > 1 {
+			if tasks, err = p.submitAll(tasks); len(tasks) == 0 {
+				return task, err
+			}
+			return tasks[0], err
+		}
+		task = tasks[0]
+	}
+	return p.submitOne(task)
+}
+
+// submitOne submits a task without intercepting it
+func (p *WorkerPool) submitOne(task Task) (Task, error) {
+	if err := p.validate(task); err != nil {
+		return task, err
+	}
+	if p.idem.deduplicates(task) {
+		return p.submitOnce(task)
+	}
+	return p.submit(task)
+}
+
+func (p *WorkerPool) submit(task Task) (Task, error) {
+	if task.CallbackURL != "" && p.webhooks == nil {
+		return task, ErrCallbacksDisabled
+	}
+	if err := p.checkDependencies(task); err != nil {
+		return task, err
+	}
+	id, err := p.newID()
+	if err != nil {
+		return task, err
+	}
+	task.ID = id
+	if err = p.stampUID(&task); err != nil {
+		return task, err
+	}
+	task.Queue = p.name
+	span := p.traceEnqueue(&task)
+	defer func() { endSpan(span, err) }()
+	p.setDeadlines(&task)
+	stampSchema(&task)
+	if p.storageFull() {
+		err = p.refuseStorage(task)
+		return task, err
+	}
+	if err = p.tenants.reserve([]Task{task}, p.metrics.tenantRefused); err != nil {
+		return task, err
+	}
+
+	if len(task.DependsOn) > 0 {
+		err = p.enqueueBlocked(task)
+	} else {
+		err = p.enqueue(task)
+	}
+	if err != nil {
+		p.tenants.release([]Task{task})
+		return task, err
+	}
+	p.tenants.submitted([]Task{task})
+	p.analytics.sample(task, time.Now())
+	return task, nil
+}
+
+// newID hands out the next task ID
+func (p *WorkerPool) newID() (int, error) {
+	id, err := p.ids.NextID()
+	if err == nil && id <= 0 {
+		err = fmt.Errorf("ID generator returned invalid task ID %d", id)
+	}
+	return id, err
+}
+
+// stampUID gives the task a UID when the pool hands them out and it has
+// none yet
+func (p *WorkerPool) stampUID(task *Task) error {
+	if p.uids == nil || task.UID != "" {
+		return nil
+	}
+	uid, err := p.uids.NextUID()
+	if err != nil {
+		return fmt.Errorf("generating task UID: %w", err)
+	}
+	task.UID = uid
+	return nil
+}
+
+// enqueue puts an already identified task on the queue, holding it back
+// until its RunAt time if that is in the future
+func (p *WorkerPool) enqueue(task Task) error {
+	if p.synchronous {
+		return p.runInline(task)
+	}
+	if p.until(task.RunAt) > 0 {
+		return p.enqueueDelayed(task)
+	}
+
+	p.track(task, StateQueued, nil)
+	if err := p.push(task); err != nil {
+		if errors.Is(err, errShedOnArrival) {
+			return nil
+		}
+		p.taskLogger(task).Warn("task rejected", "error", err)
+		p.track(task, StateFailed, err)
+		return err
+	}
+	p.logTask(task, slog.LevelInfo, "task enqueued", slog.Int("priority", task.Priority))
+	return nil
+}
+
+func (p *WorkerPool) push(task Task) error {
+	bounded, err := p.pushBounded(task)
+	if !bounded {
+		err = p.queue.Push(task)
+	}
+	if err != nil {
+		if errors.Is(err, ErrQueueClosed) {
+			return ErrPoolClosed
+		}
+		return err
+	}
+	p.metrics.enqueued.Inc()
+	return nil
+}
+
+// enqueueDelayed hands a task to the scheduler until its RunAt
+func (p *WorkerPool) enqueueDelayed(task Task) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+	p.delayed.Add(1)
+	p.mu.Unlock()
+
+	p.delay(task)
+	return nil
+}
+
+// delay schedules a task whose slot in the delayed group is already taken
+func (p *WorkerPool) delay(task Task) {
+	p.track(task, StateQueued, nil)
+	p.sched.add(schedEntry{at: task.RunAt, task: task})
+	p.taskLogger(task).Info("task delayed", "run_at", task.RunAt)
+}
+
+// dispatch feeds queued tasks to the workers until the queue is closed and
+// drained, or the pool is torn down
+func (p *WorkerPool) dispatch() {
+	defer close(p.dispatched)
+	defer close(p.jobs)
+	defer p.stealer.close()
+	for {
+		// Leave tasks in the queue while paused, where they can be counted
+		// and flushed
+		if !p.waitResumed() || !p.breaker.wait(p.ctx) {
+			return
+		}
+		task, err := p.queue.Pop()
+		if errors.Is(err, ErrQueueClosed) {
+			// Tasks held back by the gate still need the workers
+			p.gate.waitBelow(p.ctx, 0)
+			return
+		}
+		if err != nil {
+			p.log.Error("dispatcher: popping task", "error", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if !p.admit(task) {
+			continue
+		}
+
+		// A pause that began while Pop was blocked holds back this task
+		p.held.Store(&task)
+		if !p.waitResumed() {
+			return
+		}
+		if p.stealer != nil {
+			if !p.stealer.push(p.ctx, task) {
+				return
+			}
+			p.held.Store(nil)
+			continue
+		}
+		select {
+		case p.jobs <- task: // Send task to worker pool
+			p.held.Store(nil)
+		case <-p.ctx.Done():
+			// Left unacknowledged so durable backends redeliver it
+			return
+		}
+	}
+}
+
+// taskLogger returns the pool logger annotated with the task identity
+func (p *WorkerPool) taskLogger(t Task, attrs ...slog.Attr) *slog.Logger {
+	h := &lazyAttrs{Handler: p.log.Handler()}
+	h.attrs = append(h.fixed[:0], slog.Int("task_id", t.ID))
+	if t.CorrelationID != "" {
+		h.attrs = append(h.attrs, slog.String("correlation_id", t.CorrelationID))
+	}
+	h.attrs = append(h.attrs, attrs...)
+	return slog.New(h)
 }
 
 // Worker function that listens for tasks
-func worker(id int, jobs <-chan Task, wg *sync.WaitGroup) {
-	defer wg.Done()
-	for task := range jobs {
-		fmt.Printf("Worker %d processing task %d with data: %s\n", id, task.ID, task.Data)
-		time.Sleep(time.Second) // Simulating work
+func (p *WorkerPool) worker(id int) {
+	defer p.wg.Done()
+	defer p.active.Add(-1)
+	defer p.clearStatus(id)
+	p.labelWorker(id)
+	p.pinWorker(id)
+	p.setStatus(id, 0)
+	if !p.startWorker(id) {
+		return
+	}
+	defer p.stopWorker(id)
+	if p.stealer != nil {
+		p.stealer.join(id)
+		defer p.stealer.leave(id)
+	}
+	for {
+		task, ok := p.nextTask(id)
+		if !ok {
+			return
+		}
+		for {
+			alive := p.run(id, task)
+			// A draining worker leaves the rest of the partition to others
+			next, ok := p.released(task, alive && !p.drainRequested(id))
+			if !alive {
+				return // replaced after a panic
+			}
+			if !ok {
+				break
+			}
+			// The next task of the same partition
+			if !p.waitResumed() {
+				return
+			}
+			task = next
+		}
+		if p.leaveDrained(id) {
+			return
+		}
 	}
 }
 
-// Global variables
-var (
-	jobQueue = make(chan Task, 100) // Buffered channel for tasks
-	taskID   = 0
-	mu       sync.Mutex
-)
+// nextTask waits for the next task of worker id, reporting false when the
+// worker should leave
+func (p *WorkerPool) nextTask(id int) (Task, bool) {
+	if p.stealer != nil {
+		return p.nextStolen(id)
+	}
+	for {
+		select {
+		case t, ok := <-p.jobs:
+			return t, ok
+		case t := <-p.gate.ready:
+			// Held back by the gate, maybe since before a pause
+			p.gate.taken()
+			if !p.waitResumed() {
+				return Task{}, false
+			}
+			return t, true
+		case <-p.retire:
+			return Task{}, false
+		case <-p.drainSignal(id):
+			if p.leaveDrained(id) {
+				return Task{}, false
+			}
+			// Taken back by a Resize meanwhile
+		}
+	}
+}
+
+// run processes one task, reporting false when the handler panicked
+func (p *WorkerPool) run(id int, task Task) (ok bool) {
+	p.busy.Add(1)
+	p.setStatus(id, task.ID)
+	start := time.Now()
+	defer func() {
+		p.busy.Add(-1)
+		p.setStatus(id, 0)
+		if v := recover(); v != nil {
+			p.recoverWorker(id, task, time.Since(start), panicError(v))
+			ok = false
+			return
+		}
+		p.observeLatency(time.Since(start))
+	}()
+
+	p.process(id, task)
+	return true
+}
 
-func eventHandler(w http.ResponseWriter, r *http.Request) {
-	mu.Lock()
-	taskID++
-	task := Task{ID: taskID, Data: "Event received"}
-	mu.Unlock()
+// observeLatency folds a task duration into the moving average
+func (p *WorkerPool) observeLatency(d time.Duration) {
+	p.latencyMu.Lock()
+	defer p.latencyMu.Unlock()
+	if p.latency == 0 {
+		p.latency = d
+		return
+	}
+	p.latency += (d - p.latency) / 5
+}
 
-	jobQueue <- task // Send task to worker pool
-	fmt.Fprintf(w, "Event %d added to queue\n", task.ID)
+func (p *WorkerPool) avgLatency() time.Duration {
+	p.latencyMu.Lock()
+	defer p.latencyMu.Unlock()
+	return p.latency
 }
 
-func main() {
-	numWorkers := 5 // Fixed number of workers
-	var wg sync.WaitGroup
+// process runs the handler, retrying with backoff until the task succeeds
+// or the retry policy gives up on it
+func (p *WorkerPool) process(id int, task Task) {
+	ctx, ok := p.begin(task.ID)
+	if !ok {
+		p.breaker.skip()
+		p.ack(task)
+		return
+	}
+	requeue := false
+	defer func() {
+		p.end(task.ID)
+		if requeue {
+			p.requeueStuck(task)
+		}
+	}()
+	if p.dropExpired(task) || p.alreadyCompleted(task) || p.heldByWindow(task) || !p.migrate(&task) || p.heldByBudget(task) {
+		p.breaker.skip()
+		return
+	}
+
+	ctx, span := p.traceProcess(ctx, task)
+	var failure error
+	defer func() { endSpan(span, failure) }()
 
-	// Start worker pool
-	for i := 1; i <= numWorkers; i++ {
-		wg.Add(1)
-		go worker(i, jobQueue, &wg)
+	log := p.taskLogger(task, slog.Int("worker", id))
+	logs := p.newTaskLogs(task, log)
+	once := &onceScope{p: p, task: task, done: make(map[string]bool)}
+	if task.Checkpoint != "" {
+		log.Info("task resuming from checkpoint")
 	}
+	for {
+		if !p.adaptive.acquire(ctx) {
+			p.breaker.skip()
+			if p.ctx.Err() != nil {
+				p.interrupted(task, ctx.Err())
+			} else {
+				p.canceledRun(task)
+			}
+			return
+		}
+		failure = nil
+		task.Attempts++
+		log.Info("task started", "attempt", task.Attempts)
+		logs.setAttempt(task.Attempts)
+		p.beat(task.ID, time.Now())
+		p.track(task, StateRunning, nil)
+		start := time.Now()
+		attemptCtx, cancel := p.attemptContext(ctx, task)
+		attemptCtx, attempt := p.tracer.Start(attemptCtx, "task.attempt",
+			trace.WithAttributes(attribute.Int("task.attempt", task.Attempts)))
+		vals := &attemptValues{
+			Context:    attemptCtx,
+			result:     resultSlot{max: p.results.MaxBytes},
+			progress:   ProgressReporter{p: p, task: task},
+			checkpoint: checkpointSlot{p: p, task: &task},
+			logs:       logs,
+			once:       once,
+			headers:    task.Headers,
+		}
+		vals.state, vals.hasState = p.hooks.started(id)
+		attemptCtx = vals
+		var err error
+		switch {
+		case p.isDryRun(task):
+			err = p.simulate(attemptCtx, task)
+		case p.hedges(task):
+			vals, err = p.hedge(&task, vals)
+			attemptCtx = vals
+		default:
+			err = p.handle(vals, task)
+		}
+		if err != nil && errors.Is(context.Cause(attemptCtx), ErrTaskTimeout) {
+			err = fmt.Errorf("%w: %w", ErrTaskTimeout, err)
+		}
+		endSpan(attempt, err)
+		cancel()
+		elapsed := time.Since(start)
+		p.adaptive.release(elapsed, err, ctx.Err() == nil && p.ctx.Err() == nil)
+		p.metrics.observe(elapsed, err)
+		p.sla.observe(task, slaRun, elapsed)
+		p.usage.observe(task, time.Now(), elapsed, vals.cpu, err)
+		if vals.cpu > 0 {
+			p.metrics.cpuTime.WithLabelValues(task.Type).Add(vals.cpu.Seconds())
+		}
+		if err == nil {
+			p.breaker.report(nil)
+			log.Info("task succeeded", "attempt", task.Attempts, "duration", elapsed)
+			p.trackOutput(task, StateSucceeded, nil, vals.output, p.saveResult(task, vals.result.data))
+			p.markCompleted(task)
+			p.ack(task)
+			p.dropPayload(task)
+			return
+		}
+		log.Warn("task failed", "attempt", task.Attempts, "duration", elapsed, "error", err)
+		failure = err
 
-	// Set up HTTP server
-	router := mux.NewRouter()
-	router.HandleFunc("/event", eventHandler).Methods("POST")
+		if p.ctx.Err() != nil {
+			p.breaker.skip()
+			p.interrupted(task, err)
+			return
+		}
+		if errors.Is(context.Cause(ctx), ErrTaskCanceled) {
+			p.breaker.skip()
+			p.canceledRun(task)
+			return
+		}
+		if errors.Is(context.Cause(ctx), ErrTaskStuck) {
+			if p.watchdog.Action == WatchdogRequeue {
+				p.breaker.skip()
+				requeue = true
+				return
+			}
+			p.breaker.report(err)
+			p.deadLetter(task, fmt.Errorf("%w: %v", ErrTaskStuck, err))
+			return
+		}
+		p.breaker.report(err)
+		retry := p.retryPolicy(task.Type)
+		if !retry.shouldRetry(task, err) {
+			p.deadLetter(task, err)
+			return
+		}
+		p.metrics.retries.Inc()
+		backoff := retry.delay(task.Attempts, err)
+		if p.synchronous {
+			backoff = 0
+		}
+		log.Info("task retry scheduled", "attempt", task.Attempts, "backoff", backoff)
+		// Waiting out a backoff is not being stuck
+		p.beat(task.ID, time.Now().Add(backoff))
+		if !p.sleep(ctx, backoff) {
+			if p.ctx.Err() != nil {
+				p.interrupted(task, err)
+			} else {
+				p.canceledRun(task)
+			}
+			return
+		}
+	}
+}
+
+// canceledRun records a task stopped by Cancel while it was running
+func (p *WorkerPool) canceledRun(task Task) {
+	p.taskLogger(task).Info("task canceled", "attempts", task.Attempts)
+	p.track(task, StateCanceled, ErrTaskCanceled)
+	p.ack(task)
+	p.dropPayload(task)
+}
+
+// ack tells the backend a task is done for good
+func (p *WorkerPool) ack(task Task) {
+	if err := p.queue.Ack(task); err != nil {
+		p.taskLogger(task).Error("acknowledging task", "error", err)
+	}
+}
 
-	fmt.Println("Server is running on port 8080...")
-	log.Fatal(http.ListenAndServe(":8080", router))
+// interrupted records a task cut short by a forced shutdown. It is not
+// acknowledged, so durable backends run it again after a restart
+func (p *WorkerPool) interrupted(task Task, err error) {
+	p.taskLogger(task).Warn("task interrupted by shutdown", "error", err)
+	p.track(task, StateFailed, err)
+}
 
-	wg.Wait() // Wait for workers (never actually reached since server runs forever)
+// deadLetter stores a permanently failed task and notifies the callback
+func (p *WorkerPool) deadLetter(task Task, err error) {
+	p.taskLogger(task).Error("task dead-lettered", "attempts", task.Attempts, "error", err)
+	p.track(task, StateFailed, err)
+	switch serr := p.dlq.add(task, err); {
+	case serr != nil:
+		// Left unacknowledged so durable backends deliver it again rather
+		// than lose it
+		p.taskLogger(task).Error("storing dead letter", "error", serr)
+	case p.dlq.durable || p.volatileQueue():
+		p.ack(task)
+	default:
+		p.taskLogger(task).Warn("dead letter kept in memory only, task left unacknowledged for the backend to deliver it again after a restart")
+	}
+	if p.onDead != nil {
+		p.onDead(task, err)
+	}
 }
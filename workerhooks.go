@@ -0,0 +1,153 @@
+package go_playground
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WorkerHooks run code at both ends of the life of each worker, to set up
+// what a worker keeps for all its tasks, such as a database connection or
+// a loaded model, and release it
+type WorkerHooks struct {
+	// OnWorkerStart runs before a worker takes its first task. The value it
+	// returns is handed to the handlers of that worker by WorkerState. A
+	// failed start is retried with backoff, the worker taking no task
+	// meanwhile
+	OnWorkerStart func(ctx context.Context, worker int) (any, error)
+	// OnWorkerStop runs with the value returned by OnWorkerStart once the
+	// worker has left, on Shutdown, when the pool scales down or after a
+	// handler panicked. Its context is not cancelled by Shutdown
+	OnWorkerStop func(ctx context.Context, worker int, state any)
+}
+
+// Backoff between attempts to start a worker whose OnWorkerStart failed
+const (
+	minWorkerStartBackoff = time.Second
+	maxWorkerStartBackoff = 30 * time.Second
+)
+
+type workerStateKey struct{}
+
+// WorkerState returns the value OnWorkerStart returned for the worker
+// running the task of ctx, nil without WithWorkerHooks
+func WorkerState(ctx context.Context) any {
+	return ctx.Value(workerStateKey{})
+}
+
+// workerHooks keeps the state of the started workers
+type workerHooks struct {
+	WorkerHooks
+
+	mu     sync.Mutex
+	states map[int]any // by worker ID, for started workers
+	inline sync.Mutex  // serializes starting the worker of a synchronous pool
+}
+
+func newWorkerHooks(h WorkerHooks) *workerHooks {
+	return &workerHooks{WorkerHooks: h, states: make(map[int]any)}
+}
+
+// start runs OnWorkerStart for worker id
+func (h *workerHooks) start(ctx context.Context, id int) (err error) {
+	var state any
+	if h.OnWorkerStart != nil {
+		defer func() {
+			if v := recover(); v != nil {
+				err = fmt.Errorf("OnWorkerStart panicked: %v", v)
+			}
+		}()
+		if state, err = h.OnWorkerStart(ctx, id); err != nil {
+			return err
+		}
+	}
+	h.mu.Lock()
+	h.states[id] = state
+	h.mu.Unlock()
+	return nil
+}
+
+// started reports whether worker id has started and gives its state
+func (h *workerHooks) started(id int) (any, bool) {
+	if h == nil {
+		return nil, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state, ok := h.states[id]
+	return state, ok
+}
+
+// stop runs OnWorkerStop for worker id if it started
+func (h *workerHooks) stop(ctx context.Context, id int) {
+	h.mu.Lock()
+	state, ok := h.states[id]
+	delete(h.states, id)
+	h.mu.Unlock()
+	if ok && h.OnWorkerStop != nil {
+		h.OnWorkerStop(ctx, id, state)
+	}
+}
+
+// startWorker runs the start hook of worker id until it succeeds,
+// reporting false when the worker should leave first
+func (p *WorkerPool) startWorker(id int) bool {
+	if p.hooks == nil {
+		return true
+	}
+	wait := minWorkerStartBackoff
+	for attempt := 1; ; attempt++ {
+		err := p.hooks.start(p.ctx, id)
+		if err == nil {
+			return true
+		}
+		p.log.Error("worker start hook failed", "worker", id, "attempt", attempt, "retry_in", wait, "error", err)
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-p.retire:
+			t.Stop()
+			return false
+		case <-p.drainSignal(id):
+			if p.leaveDrained(id) {
+				t.Stop()
+				return false
+			}
+		case <-p.quit:
+			t.Stop()
+			return false
+		}
+		wait = min(2*wait, maxWorkerStartBackoff)
+	}
+}
+
+// stopWorker runs the stop hook of worker id, recovering a panic in it
+func (p *WorkerPool) stopWorker(id int) {
+	if p.hooks == nil {
+		return
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			p.log.Error("worker stop hook panicked", "worker", id, "panic", v)
+		}
+	}()
+	p.hooks.stop(context.WithoutCancel(p.ctx), id)
+}
+
+// startInline starts the one worker of a synchronous pool before its
+// first task, its stop hook running on Shutdown
+func (p *WorkerPool) startInline() error {
+	if p.hooks == nil {
+		return nil
+	}
+	p.hooks.inline.Lock()
+	defer p.hooks.inline.Unlock()
+	if _, ok := p.hooks.started(0); ok {
+		return nil
+	}
+	if err := p.hooks.start(p.ctx, 0); err != nil {
+		return fmt.Errorf("starting worker: %w", err)
+	}
+	return nil
+}
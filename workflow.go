@@ -0,0 +1,324 @@
+package go_playground
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ErrWorkflowNotFound is returned for unknown workflow IDs
+var ErrWorkflowNotFound = errors.New("workflow not found")
+
+// workflowRetention is how long finished workflows stay queryable
+const workflowRetention = time.Hour
+
+// FailurePolicy decides what a workflow does when one of its steps fails
+type FailurePolicy int
+
+const (
+	// AbortOnFailure skips the remaining steps and fails the workflow
+	AbortOnFailure FailurePolicy = iota
+	// ContinueOnFailure passes the failed step's input on to the next step
+	ContinueOnFailure
+)
+
+// String returns the policy name
+func (fp FailurePolicy) String() string {
+	switch fp {
+	case AbortOnFailure:
+		return "abort"
+	case ContinueOnFailure:
+		return "continue"
+	}
+	return fmt.Sprintf("FailurePolicy(%d)", int(fp))
+}
+
+// ParseFailurePolicy reads "abort" or "continue", abort when empty
+func ParseFailurePolicy(s string) (FailurePolicy, error) {
+	switch s {
+	case "", "abort":
+		return AbortOnFailure, nil
+	case "continue":
+		return ContinueOnFailure, nil
+	}
+	return 0, fmt.Errorf("invalid failure policy %q, want abort or continue", s)
+}
+
+// Step is one task of a workflow. Its handler tells steps apart by
+// Task.Step and receives the previous step's output as Task.Data
+type Step struct {
+	Name      string
+	Priority  int
+	Timeout   time.Duration
+	OnFailure FailurePolicy
+}
+
+// Workflow is a sequence of steps, see Pipeline
+type Workflow struct {
+	Steps []Step
+}
+
+// Pipeline runs steps one after the other, each fed the output the
+// previous one set with SetOutput
+func Pipeline(steps ...Step) Workflow {
+	return Workflow{Steps: steps}
+}
+
+// StepStatus is the progress of one step of a workflow
+type StepStatus struct {
+	Name   string    `json:"name"`
+	TaskID int       `json:"task_id,omitempty"` // zero until the step is submitted
+	State  TaskState `json:"state,omitempty"`
+	Error  string    `json:"error,omitempty"`
+	Output string    `json:"output,omitempty"`
+}
+
+// WorkflowStatus is the tracked state of a workflow. It is running until
+// a step aborts it or the last step ends
+type WorkflowStatus struct {
+	ID         string       `json:"id"`
+	State      TaskState    `json:"state"`
+	Error      string       `json:"error,omitempty"`
+	Steps      []StepStatus `json:"steps"`
+	CreatedAt  time.Time    `json:"created_at"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+}
+
+type workflowRun struct {
+	status WorkflowStatus
+	steps  []Step
+	input  string // data of the current step
+}
+
+// workflows tracks the workflows started on a pool
+type workflows struct {
+	mu        sync.Mutex
+	runs      map[string]*workflowRun
+	lastSweep time.Time
+}
+
+// SubmitWorkflow submits the first step of w with input as its data. Later
+// steps are submitted as their predecessors finish. Workflow state lives
+// in memory: steps left when the process stops are not submitted
+func (p *WorkerPool) SubmitWorkflow(w Workflow, input string) (WorkflowStatus, error) {
+	if len(w.Steps) == 0 {
+		return WorkflowStatus{}, errors.New("workflow has no steps")
+	}
+	run := &workflowRun{
+		status: WorkflowStatus{
+			ID:        newCorrelationID(),
+			State:     StateRunning,
+			Steps:     make([]StepStatus, len(w.Steps)),
+			CreatedAt: time.Now(),
+		},
+		steps: w.Steps,
+		input: input,
+	}
+	for i, s := range w.Steps {
+		run.status.Steps[i].Name = s.Name
+	}
+
+	p.workflows.mu.Lock()
+	defer p.workflows.mu.Unlock()
+	if p.workflows.runs == nil {
+		p.workflows.runs = make(map[string]*workflowRun)
+	}
+	p.workflows.sweep(run.status.CreatedAt)
+	p.workflows.runs[run.status.ID] = run
+
+	if err := p.submitStep(run, 0); err != nil {
+		delete(p.workflows.runs, run.status.ID)
+		return WorkflowStatus{}, err
+	}
+	p.log.Info("workflow started", "workflow_id", run.status.ID, "steps", len(w.Steps))
+	return run.status.clone(), nil
+}
+
+// Workflow returns the status of a workflow
+func (p *WorkerPool) Workflow(id string) (WorkflowStatus, error) {
+	p.workflows.mu.Lock()
+	defer p.workflows.mu.Unlock()
+	run, ok := p.workflows.runs[id]
+	if !ok {
+		return WorkflowStatus{}, ErrWorkflowNotFound
+	}
+	return run.status.clone(), nil
+}
+
+// submitStep submits step i of run. The caller holds p.workflows.mu
+func (p *WorkerPool) submitStep(run *workflowRun, i int) error {
+	s := run.steps[i]
+	task, err := p.submitOne(Task{
+		Data:       run.input,
+		Priority:   s.Priority,
+		Timeout:    s.Timeout,
+		WorkflowID: run.status.ID,
+		Step:       s.Name,
+	})
+	if err != nil {
+		return err
+	}
+	run.status.Steps[i].TaskID = task.ID
+	run.status.Steps[i].State = StateQueued
+	return nil
+}
+
+// advanceWorkflow moves the workflow of a finished step task on. The next
+// step is submitted from its own goroutine so a worker never blocks on a
+// full queue
+func (p *WorkerPool) advanceWorkflow(rec TaskRecord) {
+	if rec.WorkflowID == "" {
+		return
+	}
+	go func(rec TaskRecord) {
+		p.workflows.mu.Lock()
+		defer p.workflows.mu.Unlock()
+		run, ok := p.workflows.runs[rec.WorkflowID]
+		if !ok || run.status.State.Terminal() {
+			return
+		}
+		i := run.stepOf(rec.ID)
+		if i < 0 {
+			return
+		}
+		step := &run.status.Steps[i]
+		step.State, step.Error, step.Output = rec.State, rec.Error, rec.Output
+
+		log := p.log.With("workflow_id", run.status.ID, "step", step.Name)
+		switch {
+		case rec.State == StateSucceeded:
+			run.input = rec.Output
+		case run.steps[i].OnFailure == AbortOnFailure:
+			run.finish(StateFailed, fmt.Sprintf("step %q %s: %s", step.Name, rec.State, rec.Error))
+			log.Warn("workflow aborted", "error", run.status.Error)
+			return
+		}
+		if i == len(run.steps)-1 {
+			run.finish(StateSucceeded, "")
+			log.Info("workflow succeeded")
+			return
+		}
+		if err := p.submitStep(run, i+1); err != nil {
+			run.finish(StateFailed, fmt.Sprintf("submitting step %q: %v", run.steps[i+1].Name, err))
+			log.Error("workflow aborted", "error", run.status.Error)
+		}
+	}(rec)
+}
+
+func (run *workflowRun) stepOf(taskID int) int {
+	for i, s := range run.status.Steps {
+		if s.TaskID == taskID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (run *workflowRun) finish(state TaskState, msg string) {
+	now := time.Now()
+	run.status.State, run.status.Error, run.status.FinishedAt = state, msg, &now
+}
+
+func (s WorkflowStatus) clone() WorkflowStatus {
+	s.Steps = append([]StepStatus(nil), s.Steps...)
+	return s
+}
+
+// sweep forgets workflows finished for longer than workflowRetention. The
+// caller holds w.mu
+func (w *workflows) sweep(now time.Time) {
+	if now.Sub(w.lastSweep) < time.Minute {
+		return
+	}
+	w.lastSweep = now
+	for id, run := range w.runs {
+		if f := run.status.FinishedAt; f != nil && now.Sub(*f) > workflowRetention {
+			delete(w.runs, id)
+		}
+	}
+}
+
+// workflowRequest is the body of POST /workflows
+type workflowRequest struct {
+	Input string `json:"input"`
+	Steps []struct {
+		Name      string `json:"name"`
+		Priority  int    `json:"priority"`
+		Timeout   string `json:"timeout"`
+		OnFailure string `json:"on_failure"`
+	} `json:"steps"`
+}
+
+// workflowRoutes adds the workflow routes to r
+func (s *Server) workflowRoutes(r *mux.Router) {
+	r.HandleFunc("/workflows", s.submitWorkflowHandler).Methods("POST")
+	r.HandleFunc("/workflows/{workflow}", s.workflowHandler).Methods("GET")
+}
+
+func (s *Server) submitWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+
+	var req workflowRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		badRequest(w, malformedBody(err))
+		return
+	}
+	if len(req.Steps) == 0 {
+		writeError(w, http.StatusBadRequest, "workflow must have at least one step", "steps")
+		return
+	}
+	var wf Workflow
+	for i, rs := range req.Steps {
+		field := fmt.Sprintf("steps[%d]", i)
+		if rs.Name == "" {
+			writeError(w, http.StatusBadRequest, "step name must not be empty", field+".name")
+			return
+		}
+		step := Step{Name: rs.Name, Priority: rs.Priority}
+		if rs.Timeout != "" {
+			d, err := time.ParseDuration(rs.Timeout)
+			if err != nil || d <= 0 {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid timeout %q", rs.Timeout), field+".timeout")
+				return
+			}
+			step.Timeout = d
+		}
+		fp, err := ParseFailurePolicy(rs.OnFailure)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error(), field+".on_failure")
+			return
+		}
+		step.OnFailure = fp
+		wf.Steps = append(wf.Steps, step)
+	}
+
+	status, err := p.SubmitWorkflow(wf, req.Input)
+	if err != nil {
+		submitError(w, p, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+func (s *Server) workflowHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.target(w, r, "")
+	if !ok {
+		return
+	}
+	status, err := p.Workflow(mux.Vars(r)["workflow"])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error(), "")
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}